@@ -2,13 +2,18 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // ExternalIssuerSpec defines the desired state of ExternalIssuer
+// +kubebuilder:validation:XValidation:rule="!(has(self.configMapRef) && has(self.profileRef))",message="configMapRef and profileRef are mutually exclusive"
+// +kubebuilder:validation:XValidation:rule="!has(self.signerType) || self.signerType != 'pki' || has(self.configMapRef) || has(self.profileRef)",message="signerType pki requires configMapRef or profileRef"
+// +kubebuilder:validation:XValidation:rule="!has(self.mode) || self.mode != 'spiffe-svid' || (has(self.policy) && has(self.policy.spiffe))",message="mode spiffe-svid requires policy.spiffe"
 type ExternalIssuerSpec struct {
 	// URL is the base URL of the CA API (used when configMapRef is not set)
 	// This is primarily for testing with the built-in Mock CA
 	// +optional
+	// +kubebuilder:validation:XValidation:rule="self == '' || (isURL(self) && url(self).getScheme() in ['http', 'https'] && url(self).getHostname() != '')",message="url must be an http or https URL"
 	URL string `json:"url,omitempty"`
 
 	// ConfigMapRef references a ConfigMap containing PKI API configuration
@@ -16,29 +21,369 @@ type ExternalIssuerSpec struct {
 	// +optional
 	ConfigMapRef *ConfigMapReference `json:"configMapRef,omitempty"`
 
+	// ProfileRef references a cluster-scoped PKIProfile holding the PKI
+	// configuration, so several issuers can share one backend definition
+	// Mutually exclusive with configMapRef
+	// +optional
+	ProfileRef *PKIProfileReference `json:"profileRef,omitempty"`
+
 	// AuthSecretName is the name of a Secret containing authentication credentials
-	// The secret should contain a key named 'token', 'api-key', or 'password'
+	// The token key is detected, trying 'token', 'api-key', 'password' and 'apiKey'
+	// Key detection is deprecated; use authSecretRef, which names the key explicitly
 	// +optional
 	AuthSecretName string `json:"authSecretName,omitempty"`
 
+	// AuthSecretRef selects the Secret and keys holding authentication credentials
+	// Takes precedence over authSecretName
+	// +optional
+	AuthSecretRef *AuthSecretReference `json:"authSecretRef,omitempty"`
+
 	// SignerType specifies which signer to use: "mockca" or "pki"
 	// - "mockca": Use the built-in Mock CA (for testing/development)
-	// - "pki": Use the external PKI API configured in configMapRef
-	// Default is "mockca" for backward compatibility
+	// - "pki": Use the external PKI API configured in configMapRef or profileRef;
+	//   the API server rejects it without either, and issuers stored before
+	//   fail with reason InvalidIssuerConfig unless the controller runs with
+	//   --allow-mockca-fallback
+	// Default is "mockca" for backward compatibility; controllers started with
+	// --disable-mockca-signer or built with the nomockca tag refuse it
 	// +optional
 	// +kubebuilder:validation:Enum=mockca;pki
 	// +kubebuilder:default=mockca
 	SignerType string `json:"signerType,omitempty"`
+
+	// Mode selects what the issuer issues:
+	// - "x509": regular X.509 certificates (default)
+	// - "spiffe-svid": SPIFFE X.509-SVIDs for service mesh workloads; every
+	//   request must carry exactly one well-formed spiffe:// URI SAN in a
+	//   trust domain allowed by policy.spiffe, which is sent to the PKI
+	// +optional
+	// +kubebuilder:validation:Enum=x509;spiffe-svid
+	Mode string `json:"mode,omitempty"`
+
+	// Policy restricts which certificates the issuer will sign
+	// Requests violating the policy are marked Failed without contacting the CA
+	// +optional
+	Policy *IssuerPolicy `json:"policy,omitempty"`
+
+	// SecretTemplate defines labels and annotations placed on every Secret
+	// holding a certificate issued through this issuer
+	// +optional
+	SecretTemplate *SecretTemplate `json:"secretTemplate,omitempty"`
+
+	// Subject pins subject attributes of every certificate issued through this
+	// issuer, e.g. the organization required by the PKI contract
+	// +optional
+	Subject *IssuerSubject `json:"subject,omitempty"`
+
+	// RevokeOnDelete revokes certificates through the PKI backend when their
+	// cert-manager Certificate (or a standalone CertificateRequest) is deleted
+	// A finalizer holds the CertificateRequest until the revocation succeeded
+	// +optional
+	RevokeOnDelete bool `json:"revokeOnDelete,omitempty"`
+
+	// Paused holds issuance, e.g. during PKI maintenance or a credential
+	// rotation: CertificateRequests wait with reason IssuerPaused and the PKI
+	// is not contacted, not even for health checks or revocations
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// Degraded sets the thresholds of the Degraded condition, which reports an
+	// issuer that still works but is slow or will break soon
+	// +optional
+	Degraded *DegradedThresholds `json:"degraded,omitempty"`
+
+	// Backdate is how far NotBefore of issued certificates lies before the
+	// time of signing, for clients whose clock is behind. The mockca signer
+	// backdates by it (default 1m); with signerType pki it is the most the PKI
+	// may backdate, overriding response.maxBackdateSeconds of the PKI config
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('0s')",message="backdate must not be negative"
+	Backdate *metav1.Duration `json:"backdate,omitempty"`
+
+	// FailedRequestRetention is how long CertificateRequests of this issuer
+	// are kept after they failed or were denied before they are deleted,
+	// overriding --failed-request-retention of the controller; 0s keeps them
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('0s')",message="failedRequestRetention must not be negative"
+	FailedRequestRetention *metav1.Duration `json:"failedRequestRetention,omitempty"`
+
+	// SigningTimeout bounds a signing request to the PKI as a whole, including
+	// authentication, failover between endpoints and waiting for a queued
+	// reply, and each poll of an asynchronous order. A signing that exceeds
+	// it is not sent again automatically, as the PKI may still issue the
+	// certificate; a poll that exceeds it is retried later.
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="duration(self) > duration('0s')",message="signingTimeout must be positive"
+	SigningTimeout *metav1.Duration `json:"signingTimeout,omitempty"`
+
+	// SelfTest makes the controller issue a throwaway certificate through the
+	// issuer's signer and report whether it worked in the Verified condition.
+	// Annotating the issuer with external-issuer.io/self-test runs it on
+	// demand, with or without this field.
+	// +optional
+	SelfTest *SelfTestSpec `json:"selfTest,omitempty"`
+}
+
+// SelfTestSpec configures the test issuance of an issuer
+type SelfTestSpec struct {
+	// CommonName is the common name of the test certificate
+	// (default "external-issuer-self-test.invalid")
+	// +optional
+	CommonName string `json:"commonName,omitempty"`
+
+	// DNSNames are the DNS SANs of the test certificate, e.g. a name the PKI
+	// is allowed to issue for; defaults to the common name
+	// +optional
+	DNSNames []string `json:"dnsNames,omitempty"`
+
+	// Interval repeats the self-test; without it, it runs when the issuer's
+	// spec changes
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('1m')",message="interval must be at least 1m"
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// DegradedThresholds defines when an issuer is reported as Degraded.
+// A threshold of 0 disables its check.
+type DegradedThresholds struct {
+	// HealthCheckLatency is the PKI health check duration above which the
+	// backend is considered slow (default 5s)
+	// +optional
+	HealthCheckLatency *metav1.Duration `json:"healthCheckLatency,omitempty"`
+
+	// CAExpiry reports the issuer once its CA certificate expires within this
+	// duration (default 720h, 30 days). The CA is taken from the chains of
+	// issued certificates.
+	// +optional
+	CAExpiry *metav1.Duration `json:"caExpiry,omitempty"`
+
+	// CredentialsExpiry reports the issuer once its auth Secret expires within
+	// this duration (default 168h, 7 days). The expiry is read from the
+	// Secret's external-issuer.io/expires-at annotation (RFC 3339).
+	// +optional
+	CredentialsExpiry *metav1.Duration `json:"credentialsExpiry,omitempty"`
+}
+
+// IssuerSubject defines subject attributes enforced on outgoing requests.
+// Attributes left empty are taken from the CSR.
+type IssuerSubject struct {
+	// Organizations (O)
+	// +optional
+	Organizations []string `json:"organizations,omitempty"`
+
+	// OrganizationalUnits (OU)
+	// +optional
+	OrganizationalUnits []string `json:"organizationalUnits,omitempty"`
+
+	// Countries (C)
+	// +optional
+	Countries []string `json:"countries,omitempty"`
+
+	// Provinces (ST)
+	// +optional
+	Provinces []string `json:"provinces,omitempty"`
+
+	// Localities (L)
+	// +optional
+	Localities []string `json:"localities,omitempty"`
+
+	// Mode is "Override" to replace the attributes of the CSR in the request
+	// sent to the CA, or "Reject" to fail requests whose CSR doesn't carry them
+	// Defaults to "Override"
+	// +optional
+	// +kubebuilder:validation:Enum=Override;Reject
+	Mode string `json:"mode,omitempty"`
+}
+
+// SecretTemplate defines metadata copied onto issued certificates' Secrets
+type SecretTemplate struct {
+	// Labels to add to the Secret, e.g. for audit or ownership tracking
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations to add to the Secret
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// IssuerPolicy defines checks applied to CertificateRequests before signing
+type IssuerPolicy struct {
+	// Mode is Enforce to fail requests that violate the policy, or Audit to
+	// only report the violations and issue the certificates anyway
+	// Defaults to Enforce
+	// +optional
+	// +kubebuilder:validation:Enum=Enforce;Audit
+	Mode string `json:"mode,omitempty"`
+
+	// DNSNameOwnership verifies that requested DNS names belong to the requesting namespace
+	// +optional
+	DNSNameOwnership *DNSNameOwnershipPolicy `json:"dnsNameOwnership,omitempty"`
+
+	// SPIFFE verifies that SPIFFE ID URI SANs match the requesting ServiceAccount
+	// +optional
+	SPIFFE *SPIFFEPolicy `json:"spiffe,omitempty"`
+
+	// AllowedDNSDomains restricts DNS SANs to these domains and their subdomains
+	// +optional
+	AllowedDNSDomains []string `json:"allowedDNSDomains,omitempty"`
+
+	// AllowWildcards permits wildcard DNS SANs such as "*.example.com"
+	// Defaults to true
+	// +optional
+	AllowWildcards *bool `json:"allowWildcards,omitempty"`
+
+	// AllowIPSANs permits IP address SANs
+	// Defaults to true
+	// +optional
+	AllowIPSANs *bool `json:"allowIPSANs,omitempty"`
+
+	// AllowURISANs permits URI SANs, including SPIFFE IDs
+	// Defaults to true
+	// +optional
+	AllowURISANs *bool `json:"allowURISANs,omitempty"`
+
+	// AllowEmailSANs permits email address SANs
+	// Defaults to true
+	// +optional
+	AllowEmailSANs *bool `json:"allowEmailSANs,omitempty"`
+
+	// AllowCAIssuance permits requests for CA certificates (spec.isCA), which are
+	// issued as subordinate CAs if the signer supports it; otherwise they fail
+	// +optional
+	AllowCAIssuance bool `json:"allowCAIssuance,omitempty"`
+
+	// IssuanceWindows restricts when certificates are issued, e.g. during a change freeze
+	// Requests outside the allowed windows stay Pending and resume automatically
+	// +optional
+	IssuanceWindows *IssuanceWindowPolicy `json:"issuanceWindows,omitempty"`
+
+	// SecondApproval holds high-value certificates until a second approver
+	// sets the SecondApproval condition of the CertificateRequest
+	// +optional
+	SecondApproval *SecondApprovalPolicy `json:"secondApproval,omitempty"`
+
+	// Validators are conditions external validation controllers set on the
+	// CertificateRequests, e.g. after vetting the CSR; a request is only
+	// signed once all of them are True and fails when one is False
+	// +optional
+	Validators []ExternalValidator `json:"validators,omitempty"`
+}
+
+// ExternalValidator is a condition an external validation controller sets
+// on the CertificateRequests of an issuer
+type ExternalValidator struct {
+	// ConditionType is the type of the condition, e.g. "SecurityScanPassed"
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:XValidation:rule="!(self in ['Ready', 'InvalidRequest', 'Approved', 'Denied', 'SecondApproval'])",message="conditionType cannot be a condition set by cert-manager or the controller"
+	ConditionType string `json:"conditionType"`
+
+	// Timeout fails requests the validator hasn't set the condition of this
+	// long after they were created; they wait indefinitely when unset
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// SecondApprovalPolicy selects the certificates that need a second approval
+// before they are signed; a request matching any criterion needs one
+type SecondApprovalPolicy struct {
+	// Wildcards requires a second approval for wildcard DNS SANs
+	// +optional
+	Wildcards bool `json:"wildcards,omitempty"`
+
+	// MinDuration requires a second approval for certificates requested for
+	// at least this long, e.g. "8760h"; requests without a duration count as
+	// cert-manager's default of 90 days
+	// +optional
+	MinDuration *metav1.Duration `json:"minDuration,omitempty"`
+
+	// DNSDomains requires a second approval for DNS SANs in these domains and their subdomains
+	// +optional
+	DNSDomains []string `json:"dnsDomains,omitempty"`
+
+	// AllowRenewals issues renewals of existing certificates without a second approval
+	// +optional
+	AllowRenewals bool `json:"allowRenewals,omitempty"`
+}
+
+// IssuanceWindowPolicy defines recurring windows in which issuance is allowed or blocked
+type IssuanceWindowPolicy struct {
+	// Allowed windows; when set, certificates are only issued while one is open
+	// +optional
+	Allowed []IssuanceWindow `json:"allowed,omitempty"`
+
+	// Blocked windows, e.g. change freezes, in which no certificates are issued
+	// +optional
+	Blocked []IssuanceWindow `json:"blocked,omitempty"`
+
+	// AllowRenewals issues renewals of existing certificates outside the windows
+	// +optional
+	AllowRenewals bool `json:"allowRenewals,omitempty"`
+}
+
+// IssuanceWindow is a recurring time window opened by a cron schedule
+type IssuanceWindow struct {
+	// Schedule is a five-field cron expression opening the window, e.g. "0 8 * * MON-FRI"
+	Schedule string `json:"schedule"`
+
+	// Duration is how long the window stays open after each scheduled start, e.g. "10h"
+	// +kubebuilder:validation:XValidation:rule="duration(self) > duration('0s')",message="duration must be positive"
+	Duration metav1.Duration `json:"duration"`
+
+	// TimeZone is the IANA time zone the schedule is evaluated in
+	// Defaults to "UTC"
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// DNSNameOwnershipPolicy permits a DNS name only if it matches a Service or
+// Ingress in the CertificateRequest's namespace, or lies in an allowed zone
+type DNSNameOwnershipPolicy struct {
+	// ClusterDomain is the cluster DNS domain used to build Service names
+	// Defaults to "cluster.local"
+	// +optional
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+
+	// AllowedZones are external DNS zones any namespace may request names in
+	// A zone permits its apex and all subdomains, e.g. "apps.example.com"
+	// permits "apps.example.com" and "web.apps.example.com"
+	// +optional
+	AllowedZones []string `json:"allowedZones,omitempty"`
+}
+
+// SPIFFEPolicy ties spiffe:// URI SANs to the identity that created the
+// CertificateRequest, as recorded by cert-manager in spec.username
+// +kubebuilder:validation:XValidation:rule="has(self.trustDomain) || (has(self.trustDomains) && size(self.trustDomains) > 0)",message="trustDomain or trustDomains is required"
+type SPIFFEPolicy struct {
+	// TrustDomain is the trust domain SPIFFE IDs may use
+	// +optional
+	TrustDomain string `json:"trustDomain,omitempty"`
+
+	// TrustDomains are further trust domains SPIFFE IDs may use, e.g. while
+	// migrating workloads to a new trust domain
+	// +optional
+	TrustDomains []string `json:"trustDomains,omitempty"`
+
+	// PathTemplate is the expected SPIFFE ID path; {namespace} and
+	// {serviceAccount} are replaced with the requester's ServiceAccount
+	// Defaults to "/ns/{namespace}/sa/{serviceAccount}"
+	// +optional
+	PathTemplate string `json:"pathTemplate,omitempty"`
+
+	// Required rejects requests without a SPIFFE ID URI SAN
+	// +optional
+	Required bool `json:"required,omitempty"`
 }
 
 // ConfigMapReference references a ConfigMap in a namespace
 type ConfigMapReference struct {
 	// Name is the name of the ConfigMap
+	// +kubebuilder:validation:MinLength=1
 	Name string `json:"name"`
 
 	// Namespace is the namespace of the ConfigMap
 	// For ExternalIssuer: defaults to the issuer's namespace
-	// For ExternalClusterIssuer: defaults to "external-issuer-system"
+	// For ExternalClusterIssuer: defaults to the controller's cluster resource
+	// namespace (--cluster-resource-namespace, "external-issuer-system" by default)
 	// +optional
 	Namespace string `json:"namespace,omitempty"`
 
@@ -49,17 +394,125 @@ type ConfigMapReference struct {
 	Key string `json:"key,omitempty"`
 }
 
+// PKIProfileReference references a PKIProfile by name
+type PKIProfileReference struct {
+	// Name is the name of the PKIProfile
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// AuthSecretReference selects credentials in a Secret
+type AuthSecretReference struct {
+	// Name is the name of the Secret
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the Secret
+	// Defaults to the issuer's namespace; for ExternalClusterIssuer, to the
+	// controller's cluster resource namespace
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Key is the key holding the token (bearer, header and pre-encoded basic auth)
+	// When no key is set, 'token', 'api-key', 'password' and 'apiKey' are tried,
+	// which is deprecated and can be disabled with --secret-key-autodetect
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// UsernameKey is the key holding the username for basic auth
+	// +optional
+	UsernameKey string `json:"usernameKey,omitempty"`
+
+	// PasswordKey is the key holding the password for basic auth
+	// +optional
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
 // ExternalIssuerStatus defines the observed state of ExternalIssuer
 type ExternalIssuerStatus struct {
 	// Conditions represent the latest observed conditions of the issuer
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// SignerType is the signer handling the issuer's requests: mockca or pki
+	// +optional
+	SignerType string `json:"signerType,omitempty"`
+
+	// Endpoint is the host of the PKI API, the transport of PKIs reached
+	// over a message queue or files, or "built-in" for the Mock CA
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// CANotAfter is the earliest expiry in the CA chain of the certificates
+	// last issued through the issuer
+	// +optional
+	CANotAfter *metav1.Time `json:"caNotAfter,omitempty"`
+
+	// CertificatesIssued counts the certificates issued through the issuer
+	// +optional
+	CertificatesIssued int64 `json:"certificatesIssued,omitempty"`
+
+	// LastIssuanceTime is when a certificate was last issued through the issuer
+	// +optional
+	LastIssuanceTime *metav1.Time `json:"lastIssuanceTime,omitempty"`
+
+	// LastFailureTime is when a CertificateRequest of the issuer last failed
+	// +optional
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+
+	// LastFailureReason is the Ready condition reason of the CertificateRequest
+	// that last failed, e.g. SigningFailed
+	// +optional
+	LastFailureReason string `json:"lastFailureReason,omitempty"`
+
+	// PolicyAudit lists the most recent requests issued despite violating
+	// the policy in Audit mode, oldest first
+	// +optional
+	PolicyAudit []PolicyViolationRecord `json:"policyAudit,omitempty"`
+
+	// SelfTest records the last self-test of the issuer
+	// +optional
+	SelfTest *SelfTestStatus `json:"selfTest,omitempty"`
+}
+
+// SelfTestStatus records the last test issuance of an issuer
+type SelfTestStatus struct {
+	// LastRunTime is when the self-test last ran
+	LastRunTime metav1.Time `json:"lastRunTime"`
+
+	// Trigger is the value of the external-issuer.io/self-test annotation the
+	// self-test last ran for
+	// +optional
+	Trigger string `json:"trigger,omitempty"`
+
+	// SerialNumber is the upper-case hexadecimal serial number of the test
+	// certificate, if one was issued
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+}
+
+// PolicyViolationRecord is a CertificateRequest that violated the issuer
+// policy in Audit mode
+type PolicyViolationRecord struct {
+	// Time is when the violation was found
+	Time metav1.Time `json:"time"`
+
+	// CertificateRequest is the namespace/name of the request
+	CertificateRequest string `json:"certificateRequest"`
+
+	// Violations lists what the request violated
+	Violations []string `json:"violations"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
 // +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].reason"
+// +kubebuilder:printcolumn:name="Signer",type="string",JSONPath=".status.signerType"
+// +kubebuilder:printcolumn:name="Endpoint",type="string",JSONPath=".status.endpoint"
+// +kubebuilder:printcolumn:name="CA Expiry",type="date",JSONPath=".status.caNotAfter",priority=1
+// +kubebuilder:printcolumn:name="Last Issued",type="date",JSONPath=".status.lastIssuanceTime",priority=1
+// +kubebuilder:printcolumn:name="Verified",type="string",JSONPath=".status.conditions[?(@.type=='Verified')].status",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // ExternalIssuer is the Schema for the externalissuers API
@@ -86,6 +539,11 @@ type ExternalIssuerList struct {
 // +kubebuilder:resource:scope=Cluster
 // +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
 // +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].reason"
+// +kubebuilder:printcolumn:name="Signer",type="string",JSONPath=".status.signerType"
+// +kubebuilder:printcolumn:name="Endpoint",type="string",JSONPath=".status.endpoint"
+// +kubebuilder:printcolumn:name="CA Expiry",type="date",JSONPath=".status.caNotAfter",priority=1
+// +kubebuilder:printcolumn:name="Last Issued",type="date",JSONPath=".status.lastIssuanceTime",priority=1
+// +kubebuilder:printcolumn:name="Verified",type="string",JSONPath=".status.conditions[?(@.type=='Verified')].status",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // ExternalClusterIssuer is the Schema for the externalclusterissuers API
@@ -107,7 +565,249 @@ type ExternalClusterIssuerList struct {
 	Items           []ExternalClusterIssuer `json:"items"`
 }
 
+// PKIProfileSpec defines a reusable PKI backend configuration
+type PKIProfileSpec struct {
+	// Config is the PKI configuration, in the same format as the JSON stored
+	// in a PKI configuration ConfigMap (baseUrl, parameters, auth, tls, ...)
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	Config runtime.RawExtension `json:"config"`
+
+	// AuthSecretRef selects the Secret and keys holding authentication
+	// credentials, used by issuers that don't set their own
+	// Without a namespace, each issuer reads the Secret from its own namespace
+	// (ExternalClusterIssuers from the controller's cluster resource namespace)
+	// +optional
+	AuthSecretRef *AuthSecretReference `json:"authSecretRef,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="URL",type="string",JSONPath=".spec.config.baseUrl"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// PKIProfile is the Schema for the pkiprofiles API
+// It defines a PKI backend configuration shared by issuers referencing it
+type PKIProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PKIProfileSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PKIProfileList contains a list of PKIProfile
+type PKIProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PKIProfile `json:"items"`
+}
+
+// CertificateRevocationRequestSpec selects the certificate to revoke
+// Exactly one of serialNumber and secretName must be set
+// +kubebuilder:validation:XValidation:rule="has(self.serialNumber) != has(self.secretName)",message="exactly one of serialNumber and secretName must be set"
+type CertificateRevocationRequestSpec struct {
+	// IssuerRef is the issuer whose PKI backend revokes the certificate
+	// Defaults to the issuer recorded in the cert-manager annotations of the Secret
+	// +optional
+	IssuerRef *RevocationIssuerReference `json:"issuerRef,omitempty"`
+
+	// SerialNumber is the serial number of the certificate in hexadecimal,
+	// optionally colon-separated (as printed by openssl x509 -serial)
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// SecretName is a TLS Secret in the same namespace whose tls.crt is revoked
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// Reason is the RFC 5280 revocation reason passed to the PKI backend, e.g.
+	// "keyCompromise". certificateHold suspends the certificate; removeFromCRL
+	// releases a held certificate instead of revoking it.
+	// +kubebuilder:validation:Enum=unspecified;keyCompromise;cACompromise;affiliationChanged;superseded;cessationOfOperation;certificateHold;removeFromCRL;privilegeWithdrawn;aACompromise
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// RevocationIssuerReference references the issuer of a certificate to revoke
+type RevocationIssuerReference struct {
+	// Name is the name of the issuer
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Kind is ExternalIssuer (in the request's namespace) or ExternalClusterIssuer
+	// +kubebuilder:validation:Enum=ExternalIssuer;ExternalClusterIssuer
+	// +kubebuilder:default=ExternalIssuer
+	// +optional
+	Kind string `json:"kind,omitempty"`
+}
+
+// CertificateRevocationRequestStatus defines the observed state of CertificateRevocationRequest
+type CertificateRevocationRequestStatus struct {
+	// Conditions represent the latest observed conditions of the request
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// SerialNumber is the hexadecimal serial number of the revoked certificate
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// RevocationTime is when the PKI backend revoked the certificate
+	// +optional
+	RevocationTime *metav1.Time `json:"revocationTime,omitempty"`
+
+	// Reason is the revocation reason sent to the PKI backend
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=crr
+// +kubebuilder:printcolumn:name="Serial",type="string",JSONPath=".status.serialNumber"
+// +kubebuilder:printcolumn:name="Revoked",type="string",JSONPath=".status.conditions[?(@.type=='Revoked')].status"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type=='Revoked')].reason"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CertificateRevocationRequest is the Schema for the certificaterevocationrequests API
+// It revokes a certificate issued through an ExternalIssuer or ExternalClusterIssuer
+type CertificateRevocationRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CertificateRevocationRequestSpec   `json:"spec,omitempty"`
+	Status CertificateRevocationRequestStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CertificateRevocationRequestList contains a list of CertificateRevocationRequest
+type CertificateRevocationRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CertificateRevocationRequest `json:"items"`
+}
+
+// ExternalIssuerReportStatus summarizes the issuers of a controller
+type ExternalIssuerReportStatus struct {
+	// LastUpdateTime is when the controller last refreshed the report
+	// +optional
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+
+	// ReadyIssuers is the number of issuers whose Ready condition is True
+	ReadyIssuers int32 `json:"readyIssuers"`
+
+	// Requests counts the CertificateRequests of all issuers
+	Requests RequestCounts `json:"requests"`
+
+	// CANotAfter is the earliest CA expiry of all issuers
+	// +optional
+	CANotAfter *metav1.Time `json:"caNotAfter,omitempty"`
+
+	// Issuers reports each issuer, sorted by kind, namespace and name
+	// +optional
+	Issuers []IssuerReport `json:"issuers,omitempty"`
+}
+
+// IssuerReport summarizes an ExternalIssuer or ExternalClusterIssuer
+type IssuerReport struct {
+	// Kind is ExternalIssuer or ExternalClusterIssuer
+	Kind string `json:"kind"`
+
+	// Namespace is the namespace of an ExternalIssuer
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name is the name of the issuer
+	Name string `json:"name"`
+
+	// Ready is the status of the issuer's Ready condition
+	// +optional
+	Ready metav1.ConditionStatus `json:"ready,omitempty"`
+
+	// Reason is the reason of the issuer's Ready condition
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Degraded is the reason of the issuer's Degraded condition while it is True
+	// +optional
+	Degraded string `json:"degraded,omitempty"`
+
+	// Paused is set for issuers with spec.paused
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// LastHealthCheckTime is when the controller last health checked the PKI
+	// +optional
+	LastHealthCheckTime *metav1.Time `json:"lastHealthCheckTime,omitempty"`
+
+	// HealthCheckError is the error of the last health check, empty if it succeeded
+	// +optional
+	HealthCheckError string `json:"healthCheckError,omitempty"`
+
+	// FailingSince is the first of the consecutive failed health checks
+	// +optional
+	FailingSince *metav1.Time `json:"failingSince,omitempty"`
+
+	// CANotAfter is the earliest expiry in the CA chain of the certificates
+	// last issued through the issuer
+	// +optional
+	CANotAfter *metav1.Time `json:"caNotAfter,omitempty"`
+
+	// Requests counts the CertificateRequests of the issuer
+	Requests RequestCounts `json:"requests"`
+}
+
+// RequestCounts counts CertificateRequests by their state. Only requests
+// that still exist are counted; cert-manager's revisionHistoryLimit and the
+// failed request retention delete old ones.
+type RequestCounts struct {
+	// Issued requests are Ready
+	Issued int32 `json:"issued"`
+
+	// Pending requests wait for approval, for the PKI or for a retry
+	Pending int32 `json:"pending"`
+
+	// Failed requests failed for good
+	Failed int32 `json:"failed"`
+
+	// Denied requests were denied by an approver
+	Denied int32 `json:"denied"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName=eir
+// +kubebuilder:printcolumn:name="Issuers",type="integer",JSONPath=".status.readyIssuers",description="Ready issuers"
+// +kubebuilder:printcolumn:name="Issued",type="integer",JSONPath=".status.requests.issued"
+// +kubebuilder:printcolumn:name="Pending",type="integer",JSONPath=".status.requests.pending"
+// +kubebuilder:printcolumn:name="Failed",type="integer",JSONPath=".status.requests.failed"
+// +kubebuilder:printcolumn:name="CA Expiry",type="date",JSONPath=".status.caNotAfter"
+// +kubebuilder:printcolumn:name="Updated",type="date",JSONPath=".status.lastUpdateTime"
+
+// ExternalIssuerReport is the Schema for the externalissuerreports API
+// It is written by the controller and summarizes the state of its issuers
+type ExternalIssuerReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status ExternalIssuerReportStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ExternalIssuerReportList contains a list of ExternalIssuerReport
+type ExternalIssuerReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ExternalIssuerReport `json:"items"`
+}
+
 func init() {
 	SchemeBuilder.Register(&ExternalIssuer{}, &ExternalIssuerList{})
 	SchemeBuilder.Register(&ExternalClusterIssuer{}, &ExternalClusterIssuerList{})
+	SchemeBuilder.Register(&PKIProfile{}, &PKIProfileList{})
+	SchemeBuilder.Register(&CertificateRevocationRequest{}, &CertificateRevocationRequestList{})
+	SchemeBuilder.Register(&ExternalIssuerReport{}, &ExternalIssuerReportList{})
 }
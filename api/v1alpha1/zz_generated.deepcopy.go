@@ -147,6 +147,56 @@ func (in *ExternalIssuerSpec) DeepCopyInto(out *ExternalIssuerSpec) {
 		*out = new(ConfigMapReference)
 		**out = **in
 	}
+	if in.ProfileRef != nil {
+		in, out := &in.ProfileRef, &out.ProfileRef
+		*out = new(PKIProfileReference)
+		**out = **in
+	}
+	if in.AuthSecretRef != nil {
+		in, out := &in.AuthSecretRef, &out.AuthSecretRef
+		*out = new(AuthSecretReference)
+		**out = **in
+	}
+	if in.Policy != nil {
+		in, out := &in.Policy, &out.Policy
+		*out = new(IssuerPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretTemplate != nil {
+		in, out := &in.SecretTemplate, &out.SecretTemplate
+		*out = new(SecretTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Subject != nil {
+		in, out := &in.Subject, &out.Subject
+		*out = new(IssuerSubject)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Degraded != nil {
+		in, out := &in.Degraded, &out.Degraded
+		*out = new(DegradedThresholds)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Backdate != nil {
+		in, out := &in.Backdate, &out.Backdate
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.FailedRequestRetention != nil {
+		in, out := &in.FailedRequestRetention, &out.FailedRequestRetention
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.SigningTimeout != nil {
+		in, out := &in.SigningTimeout, &out.SigningTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.SelfTest != nil {
+		in, out := &in.SelfTest, &out.SelfTest
+		*out = new(SelfTestSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalIssuerSpec.
@@ -169,6 +219,30 @@ func (in *ExternalIssuerStatus) DeepCopyInto(out *ExternalIssuerStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.CANotAfter != nil {
+		in, out := &in.CANotAfter, &out.CANotAfter
+		*out = (*in).DeepCopy()
+	}
+	if in.LastIssuanceTime != nil {
+		in, out := &in.LastIssuanceTime, &out.LastIssuanceTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastFailureTime != nil {
+		in, out := &in.LastFailureTime, &out.LastFailureTime
+		*out = (*in).DeepCopy()
+	}
+	if in.PolicyAudit != nil {
+		in, out := &in.PolicyAudit, &out.PolicyAudit
+		*out = make([]PolicyViolationRecord, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SelfTest != nil {
+		in, out := &in.SelfTest, &out.SelfTest
+		*out = new(SelfTestStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalIssuerStatus.
@@ -181,6 +255,26 @@ func (in *ExternalIssuerStatus) DeepCopy() *ExternalIssuerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalValidator) DeepCopyInto(out *ExternalValidator) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalValidator.
+func (in *ExternalValidator) DeepCopy() *ExternalValidator {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalValidator)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConfigMapReference) DeepCopyInto(out *ConfigMapReference) {
 	*out = *in
@@ -195,3 +289,698 @@ func (in *ConfigMapReference) DeepCopy() *ConfigMapReference {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthSecretReference) DeepCopyInto(out *AuthSecretReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthSecretReference.
+func (in *AuthSecretReference) DeepCopy() *AuthSecretReference {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthSecretReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecondApprovalPolicy) DeepCopyInto(out *SecondApprovalPolicy) {
+	*out = *in
+	if in.MinDuration != nil {
+		in, out := &in.MinDuration, &out.MinDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.DNSDomains != nil {
+		in, out := &in.DNSDomains, &out.DNSDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecondApprovalPolicy.
+func (in *SecondApprovalPolicy) DeepCopy() *SecondApprovalPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SecondApprovalPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretTemplate) DeepCopyInto(out *SecretTemplate) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretTemplate.
+func (in *SecretTemplate) DeepCopy() *SecretTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SelfTestSpec) DeepCopyInto(out *SelfTestSpec) {
+	*out = *in
+	if in.DNSNames != nil {
+		in, out := &in.DNSNames, &out.DNSNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SelfTestSpec.
+func (in *SelfTestSpec) DeepCopy() *SelfTestSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SelfTestSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SelfTestStatus) DeepCopyInto(out *SelfTestStatus) {
+	*out = *in
+	in.LastRunTime.DeepCopyInto(&out.LastRunTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SelfTestStatus.
+func (in *SelfTestStatus) DeepCopy() *SelfTestStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SelfTestStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuanceWindowPolicy) DeepCopyInto(out *IssuanceWindowPolicy) {
+	*out = *in
+	if in.Allowed != nil {
+		in, out := &in.Allowed, &out.Allowed
+		*out = make([]IssuanceWindow, len(*in))
+		copy(*out, *in)
+	}
+	if in.Blocked != nil {
+		in, out := &in.Blocked, &out.Blocked
+		*out = make([]IssuanceWindow, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuanceWindowPolicy.
+func (in *IssuanceWindowPolicy) DeepCopy() *IssuanceWindowPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuanceWindowPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuanceWindow) DeepCopyInto(out *IssuanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuanceWindow.
+func (in *IssuanceWindow) DeepCopy() *IssuanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuerPolicy) DeepCopyInto(out *IssuerPolicy) {
+	*out = *in
+	if in.DNSNameOwnership != nil {
+		in, out := &in.DNSNameOwnership, &out.DNSNameOwnership
+		*out = new(DNSNameOwnershipPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SPIFFE != nil {
+		in, out := &in.SPIFFE, &out.SPIFFE
+		*out = new(SPIFFEPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AllowedDNSDomains != nil {
+		in, out := &in.AllowedDNSDomains, &out.AllowedDNSDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowWildcards != nil {
+		in, out := &in.AllowWildcards, &out.AllowWildcards
+		*out = new(bool)
+		**out = **in
+	}
+	if in.AllowIPSANs != nil {
+		in, out := &in.AllowIPSANs, &out.AllowIPSANs
+		*out = new(bool)
+		**out = **in
+	}
+	if in.AllowURISANs != nil {
+		in, out := &in.AllowURISANs, &out.AllowURISANs
+		*out = new(bool)
+		**out = **in
+	}
+	if in.AllowEmailSANs != nil {
+		in, out := &in.AllowEmailSANs, &out.AllowEmailSANs
+		*out = new(bool)
+		**out = **in
+	}
+	if in.IssuanceWindows != nil {
+		in, out := &in.IssuanceWindows, &out.IssuanceWindows
+		*out = new(IssuanceWindowPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecondApproval != nil {
+		in, out := &in.SecondApproval, &out.SecondApproval
+		*out = new(SecondApprovalPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Validators != nil {
+		in, out := &in.Validators, &out.Validators
+		*out = make([]ExternalValidator, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuerPolicy.
+func (in *IssuerPolicy) DeepCopy() *IssuerPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuerPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DegradedThresholds) DeepCopyInto(out *DegradedThresholds) {
+	*out = *in
+	if in.HealthCheckLatency != nil {
+		in, out := &in.HealthCheckLatency, &out.HealthCheckLatency
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.CAExpiry != nil {
+		in, out := &in.CAExpiry, &out.CAExpiry
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.CredentialsExpiry != nil {
+		in, out := &in.CredentialsExpiry, &out.CredentialsExpiry
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DegradedThresholds.
+func (in *DegradedThresholds) DeepCopy() *DegradedThresholds {
+	if in == nil {
+		return nil
+	}
+	out := new(DegradedThresholds)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSNameOwnershipPolicy) DeepCopyInto(out *DNSNameOwnershipPolicy) {
+	*out = *in
+	if in.AllowedZones != nil {
+		in, out := &in.AllowedZones, &out.AllowedZones
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSNameOwnershipPolicy.
+func (in *DNSNameOwnershipPolicy) DeepCopy() *DNSNameOwnershipPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSNameOwnershipPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIFFEPolicy) DeepCopyInto(out *SPIFFEPolicy) {
+	*out = *in
+	if in.TrustDomains != nil {
+		in, out := &in.TrustDomains, &out.TrustDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIFFEPolicy.
+func (in *SPIFFEPolicy) DeepCopy() *SPIFFEPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIFFEPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuerSubject) DeepCopyInto(out *IssuerSubject) {
+	*out = *in
+	if in.Organizations != nil {
+		in, out := &in.Organizations, &out.Organizations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.OrganizationalUnits != nil {
+		in, out := &in.OrganizationalUnits, &out.OrganizationalUnits
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Countries != nil {
+		in, out := &in.Countries, &out.Countries
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Provinces != nil {
+		in, out := &in.Provinces, &out.Provinces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Localities != nil {
+		in, out := &in.Localities, &out.Localities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuerSubject.
+func (in *IssuerSubject) DeepCopy() *IssuerSubject {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuerSubject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PKIProfileReference) DeepCopyInto(out *PKIProfileReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PKIProfileReference.
+func (in *PKIProfileReference) DeepCopy() *PKIProfileReference {
+	if in == nil {
+		return nil
+	}
+	out := new(PKIProfileReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PKIProfileSpec) DeepCopyInto(out *PKIProfileSpec) {
+	*out = *in
+	in.Config.DeepCopyInto(&out.Config)
+	if in.AuthSecretRef != nil {
+		in, out := &in.AuthSecretRef, &out.AuthSecretRef
+		*out = new(AuthSecretReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PKIProfileSpec.
+func (in *PKIProfileSpec) DeepCopy() *PKIProfileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PKIProfileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PKIProfile) DeepCopyInto(out *PKIProfile) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PKIProfile.
+func (in *PKIProfile) DeepCopy() *PKIProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(PKIProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PKIProfile) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PKIProfileList) DeepCopyInto(out *PKIProfileList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PKIProfile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PKIProfileList.
+func (in *PKIProfileList) DeepCopy() *PKIProfileList {
+	if in == nil {
+		return nil
+	}
+	out := new(PKIProfileList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PKIProfileList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyViolationRecord) DeepCopyInto(out *PolicyViolationRecord) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.Violations != nil {
+		in, out := &in.Violations, &out.Violations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyViolationRecord.
+func (in *PolicyViolationRecord) DeepCopy() *PolicyViolationRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyViolationRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateRevocationRequestSpec) DeepCopyInto(out *CertificateRevocationRequestSpec) {
+	*out = *in
+	if in.IssuerRef != nil {
+		in, out := &in.IssuerRef, &out.IssuerRef
+		*out = new(RevocationIssuerReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateRevocationRequestSpec.
+func (in *CertificateRevocationRequestSpec) DeepCopy() *CertificateRevocationRequestSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateRevocationRequestSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RevocationIssuerReference) DeepCopyInto(out *RevocationIssuerReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RevocationIssuerReference.
+func (in *RevocationIssuerReference) DeepCopy() *RevocationIssuerReference {
+	if in == nil {
+		return nil
+	}
+	out := new(RevocationIssuerReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateRevocationRequestStatus) DeepCopyInto(out *CertificateRevocationRequestStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RevocationTime != nil {
+		in, out := &in.RevocationTime, &out.RevocationTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateRevocationRequestStatus.
+func (in *CertificateRevocationRequestStatus) DeepCopy() *CertificateRevocationRequestStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateRevocationRequestStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateRevocationRequest) DeepCopyInto(out *CertificateRevocationRequest) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateRevocationRequest.
+func (in *CertificateRevocationRequest) DeepCopy() *CertificateRevocationRequest {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateRevocationRequest)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CertificateRevocationRequest) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateRevocationRequestList) DeepCopyInto(out *CertificateRevocationRequestList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CertificateRevocationRequest, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateRevocationRequestList.
+func (in *CertificateRevocationRequestList) DeepCopy() *CertificateRevocationRequestList {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateRevocationRequestList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CertificateRevocationRequestList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalIssuerReportStatus) DeepCopyInto(out *ExternalIssuerReportStatus) {
+	*out = *in
+	if in.LastUpdateTime != nil {
+		in, out := &in.LastUpdateTime, &out.LastUpdateTime
+		*out = (*in).DeepCopy()
+	}
+	out.Requests = in.Requests
+	if in.CANotAfter != nil {
+		in, out := &in.CANotAfter, &out.CANotAfter
+		*out = (*in).DeepCopy()
+	}
+	if in.Issuers != nil {
+		in, out := &in.Issuers, &out.Issuers
+		*out = make([]IssuerReport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalIssuerReportStatus.
+func (in *ExternalIssuerReportStatus) DeepCopy() *ExternalIssuerReportStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalIssuerReportStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuerReport) DeepCopyInto(out *IssuerReport) {
+	*out = *in
+	if in.LastHealthCheckTime != nil {
+		in, out := &in.LastHealthCheckTime, &out.LastHealthCheckTime
+		*out = (*in).DeepCopy()
+	}
+	if in.FailingSince != nil {
+		in, out := &in.FailingSince, &out.FailingSince
+		*out = (*in).DeepCopy()
+	}
+	if in.CANotAfter != nil {
+		in, out := &in.CANotAfter, &out.CANotAfter
+		*out = (*in).DeepCopy()
+	}
+	out.Requests = in.Requests
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuerReport.
+func (in *IssuerReport) DeepCopy() *IssuerReport {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuerReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RequestCounts) DeepCopyInto(out *RequestCounts) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequestCounts.
+func (in *RequestCounts) DeepCopy() *RequestCounts {
+	if in == nil {
+		return nil
+	}
+	out := new(RequestCounts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalIssuerReport) DeepCopyInto(out *ExternalIssuerReport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalIssuerReport.
+func (in *ExternalIssuerReport) DeepCopy() *ExternalIssuerReport {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalIssuerReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExternalIssuerReport) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalIssuerReportList) DeepCopyInto(out *ExternalIssuerReportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ExternalIssuerReport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalIssuerReportList.
+func (in *ExternalIssuerReportList) DeepCopy() *ExternalIssuerReportList {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalIssuerReportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExternalIssuerReportList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// configAPIVersion is the only version of the configuration file so far
+	configAPIVersion = "controller.external-issuer.io/v1alpha1"
+
+	configKind = "ControllerConfiguration"
+)
+
+// ControllerConfiguration is the configuration file of the controller. Every
+// field stands for a flag; flags given on the command line take precedence.
+type ControllerConfiguration struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	// Concurrency is how many CertificateRequests are reconciled at once (--max-concurrent-reconciles)
+	Concurrency *int `json:"concurrency,omitempty"`
+
+	// WatchNamespaces restricts the controller to these namespaces (--watch-namespaces)
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+
+	// ClusterResourceNamespace holds the ConfigMaps and Secrets of ExternalClusterIssuers (--cluster-resource-namespace)
+	ClusterResourceNamespace string `json:"clusterResourceNamespace,omitempty"`
+
+	LeaderElection *LeaderElectionConfiguration `json:"leaderElection,omitempty"`
+
+	Metrics *EndpointConfiguration `json:"metrics,omitempty"`
+	Health  *EndpointConfiguration `json:"health,omitempty"`
+
+	// FeatureGates switch optional features on or off by name, see featureGateFlags
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+
+	// DefaultValidity is requested for certificates whose request sets no duration (--default-validity)
+	DefaultValidity *metav1.Duration `json:"defaultValidity,omitempty"`
+
+	// ShutdownDrainTimeout bounds in-flight signings after SIGTERM (--shutdown-drain-timeout)
+	ShutdownDrainTimeout *metav1.Duration `json:"shutdownDrainTimeout,omitempty"`
+}
+
+// LeaderElectionConfiguration configures leader election (--leader-elect*)
+type LeaderElectionConfiguration struct {
+	LeaderElect       *bool            `json:"leaderElect,omitempty"`
+	ResourceName      string           `json:"resourceName,omitempty"`
+	ResourceNamespace string           `json:"resourceNamespace,omitempty"`
+	LeaseDuration     *metav1.Duration `json:"leaseDuration,omitempty"`
+	RenewDeadline     *metav1.Duration `json:"renewDeadline,omitempty"`
+	RetryPeriod       *metav1.Duration `json:"retryPeriod,omitempty"`
+}
+
+// EndpointConfiguration configures an HTTP endpoint of the controller
+type EndpointConfiguration struct {
+	BindAddress string `json:"bindAddress,omitempty"`
+}
+
+// featureGateFlags maps feature gates to the boolean flags they set; gates
+// marked inverted set the flag to the opposite value
+var featureGateFlags = map[string]struct {
+	flag     string
+	inverted bool
+}{
+	"AutoApprover":            {flag: "enable-auto-approver"},
+	"ClusterIssuers":          {flag: "enable-cluster-issuers"},
+	"DefaultingWebhook":       {flag: "enable-defaulting-webhook"},
+	"MockCASigner":            {flag: "disable-mockca-signer", inverted: true},
+	"ReadyzIncludeBackends":   {flag: "readyz-include-backends"},
+	"SecretRenewal":           {flag: "enable-secret-renewal"},
+	"StorageVersionMigration": {flag: "migrate-storage-versions"},
+	"ValidatingWebhook":       {flag: "enable-validating-webhook"},
+}
+
+// loadConfigFile reads a configuration file and returns the flag values it sets
+func loadConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var config ControllerConfiguration
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if config.APIVersion != configAPIVersion || config.Kind != configKind {
+		return nil, fmt.Errorf("config file %s: unsupported apiVersion %q and kind %q (supported: %s %s)",
+			path, config.APIVersion, config.Kind, configAPIVersion, configKind)
+	}
+	return config.flagValues()
+}
+
+// flagValues returns the values of the flags set by the configuration
+func (c *ControllerConfiguration) flagValues() (map[string]string, error) {
+	values := map[string]string{}
+	setString := func(name, value string) {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	setDuration := func(name string, value *metav1.Duration) {
+		if value != nil {
+			values[name] = value.Duration.String()
+		}
+	}
+
+	if c.Concurrency != nil {
+		values["max-concurrent-reconciles"] = strconv.Itoa(*c.Concurrency)
+	}
+	setString("watch-namespaces", strings.Join(c.WatchNamespaces, ","))
+	setString("cluster-resource-namespace", c.ClusterResourceNamespace)
+	if le := c.LeaderElection; le != nil {
+		if le.LeaderElect != nil {
+			values["leader-elect"] = strconv.FormatBool(*le.LeaderElect)
+		}
+		setString("leader-election-id", le.ResourceName)
+		setString("leader-election-namespace", le.ResourceNamespace)
+		setDuration("leader-election-lease-duration", le.LeaseDuration)
+		setDuration("leader-election-renew-deadline", le.RenewDeadline)
+		setDuration("leader-election-retry-period", le.RetryPeriod)
+	}
+	if c.Metrics != nil {
+		setString("metrics-bind-address", c.Metrics.BindAddress)
+	}
+	if c.Health != nil {
+		setString("health-probe-bind-address", c.Health.BindAddress)
+	}
+	setDuration("default-validity", c.DefaultValidity)
+	setDuration("shutdown-drain-timeout", c.ShutdownDrainTimeout)
+
+	for gate, enabled := range c.FeatureGates {
+		target, ok := featureGateFlags[gate]
+		if !ok {
+			return nil, fmt.Errorf("unknown feature gate %q (known: %s)", gate, strings.Join(featureGates(), ", "))
+		}
+		values[target.flag] = strconv.FormatBool(enabled != target.inverted)
+	}
+	return values, nil
+}
+
+// featureGates returns the names of the feature gates, sorted
+func featureGates() []string {
+	names := make([]string, 0, len(featureGateFlags))
+	for name := range featureGateFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyConfigFile sets the flags of a configuration file that were not given
+// on the command line
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	values, err := loadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for name, value := range values {
+		if explicit[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("config file %s: invalid value %q for --%s: %w", path, value, name, err)
+		}
+	}
+	return nil
+}
@@ -1,19 +1,35 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
 	"github.com/bvorland/cert-manager-external-issuer/controllers"
+	"github.com/bvorland/cert-manager-external-issuer/internal/audit"
+	"github.com/bvorland/cert-manager-external-issuer/internal/exporter"
+	"github.com/bvorland/cert-manager-external-issuer/internal/hooks"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	"github.com/bvorland/cert-manager-external-issuer/internal/tracing"
+	"github.com/bvorland/cert-manager-external-issuer/internal/version"
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 var (
@@ -25,18 +41,169 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(cmapi.AddToScheme(scheme))
 	utilruntime.Must(externalissuerapi.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 }
 
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var leaderElectionID string
+	var leaderElectionNamespace string
+	var leaseDuration, renewDeadline, retryPeriod time.Duration
 	var probeAddr string
+	var readyzIncludeBackends bool
+	var backendLivenessTimeout time.Duration
+	var traceOpts tracing.Options
+	var showVersion bool
+	var drainTimeout time.Duration
+	var enableSecretRenewal bool
+	var failedRequestRetention time.Duration
+	var issuerReportName string
+	var exportOpts exporter.Options
+	var exportKafkaBrokers string
+	var hookOpts hooks.Options
+	var enabledHooks string
+	var auditOpts audit.Options
+	var watchNamespaces string
+	var requestLabelSelector string
+	var enableClusterIssuers bool
+	var disableApprovedCheck bool
+	var enableAutoApprover bool
+	var autoApproveNamespaceSelector string
+	var autoApproveLabelSelector string
+	var migrateStorageVersions bool
+	var disableMockCASigner bool
+	var allowMockCAFallback bool
+	var clusterResourceNamespace string
+	var secretKeyAutodetect string
+	var istioCA controllers.IstioCAServer
+	var configFile string
+	var enableDefaultingWebhook bool
+	var enableValidatingWebhook bool
+	var webhookPort int
+	var webhookCertDir string
+	var maxConcurrentReconciles int
+	var defaultValidity time.Duration
+	var istioCAIssuer string
 
+	flag.StringVar(&configFile, "config", "",
+		"ControllerConfiguration YAML file setting flags such as concurrency, namespaces, leader election and feature gates. "+
+			"Flags given on the command line take precedence.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.BoolVar(&readyzIncludeBackends, "readyz-include-backends", true,
+		"Fail /readyz while issuers were health checked recently and none of them reached its PKI backend.")
+	flag.DurationVar(&backendLivenessTimeout, "backend-liveness-timeout", 0,
+		"Fail /healthz, so the kubelet restarts the controller, once no PKI backend has been reachable for this long. Disabled when 0.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&leaderElectionID, "leader-election-id", "external-issuer.io",
+		"Name of the Lease used for leader election. Controller instances with different IDs run independently, e.g. shards.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "",
+		"Namespace of the leader election Lease. Defaults to the controller's namespace.")
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", 15*time.Second,
+		"How long standby replicas wait before taking over the Lease of a leader that stopped renewing it.")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", 10*time.Second,
+		"How long the leader retries renewing the Lease before it stops reconciling and exits.")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", 2*time.Second,
+		"Interval between attempts to acquire or renew the Lease.")
+	flag.StringVar(&traceOpts.Endpoint, "otlp-endpoint", "",
+		"OTLP collector address (host:port) to export traces to. Tracing is disabled when empty.")
+	flag.StringVar(&traceOpts.Protocol, "otlp-protocol", "grpc", "OTLP transport: grpc or http.")
+	flag.BoolVar(&traceOpts.Insecure, "otlp-insecure", false, "Disable TLS when connecting to the OTLP collector.")
+	flag.Float64Var(&traceOpts.SampleRatio, "trace-sample-ratio", 1.0,
+		"Fraction of reconciles that start a sampled trace (0-1). Incoming sampled parents are always honored.")
+	flag.DurationVar(&drainTimeout, "shutdown-drain-timeout", 20*time.Second,
+		"How long in-flight signings may take to finish and record their result after SIGTERM. "+
+			"Keep it below the pod's terminationGracePeriodSeconds.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"How many CertificateRequests are reconciled at once. Raise it for PKIs that take long to answer.")
+	flag.DurationVar(&defaultValidity, "default-validity", 365*24*time.Hour,
+		"Validity requested for certificates whose CertificateRequest sets no duration. Signers issue whole days.")
+	flag.BoolVar(&enableSecretRenewal, "enable-secret-renewal", false,
+		"Renew certificates in TLS Secrets annotated with external-issuer.io/renew=true that are not managed by a cert-manager Certificate.")
+	flag.DurationVar(&failedRequestRetention, "failed-request-retention", 0,
+		"Delete failed and denied CertificateRequests of external issuers this long after they failed, e.g. 168h. "+
+			"Issuers override it with spec.failedRequestRetention. 0 keeps them.")
+	flag.StringVar(&issuerReportName, "issuer-report-name", "external-issuer",
+		"Name of the cluster-scoped ExternalIssuerReport summarizing the issuers, refreshed every minute. "+
+			"Give each shard its own name. Empty disables the report.")
+	flag.StringVar(&exportOpts.HTTPURL, "export-http-url", "",
+		"Inventory (CMDB) endpoint that receives a JSON record of every issued certificate.")
+	flag.StringVar(&exportOpts.HTTPBearerTokenFile, "export-http-token-file", "",
+		"File with a bearer token sent to --export-http-url, e.g. a mounted Secret.")
+	flag.StringVar(&exportKafkaBrokers, "export-kafka-brokers", "",
+		"Comma-separated Kafka brokers (host:port) to publish records of issued certificates to.")
+	flag.StringVar(&exportOpts.KafkaTopic, "export-kafka-topic", "", "Kafka topic for certificate records.")
+	flag.StringVar(&enabledHooks, "post-issuance-hooks", "",
+		"Comma-separated names of in-process hooks to run after every issuance. Hooks are registered by plugin packages compiled into the controller.")
+	flag.StringVar(&hookOpts.WebhookURL, "post-issuance-webhook-url", "",
+		"Endpoint that receives every issued certificate and its chain as a JSON POST.")
+	flag.StringVar(&hookOpts.WebhookBearerTokenFile, "post-issuance-webhook-token-file", "",
+		"File with a bearer token sent to --post-issuance-webhook-url, e.g. a mounted Secret.")
+	flag.StringVar(&auditOpts.File, "audit-log-file", "",
+		"File the hash-chained audit trail of issued and failed requests is appended to, e.g. on a persistent volume. "+
+			"Check it with \"external-issuer audit verify\".")
+	flag.StringVar(&auditOpts.WebhookURL, "audit-webhook-url", "",
+		"Endpoint that receives every audit record as a JSON POST, in sequence, e.g. a SIEM collector.")
+	flag.StringVar(&auditOpts.WebhookBearerTokenFile, "audit-webhook-token-file", "",
+		"File with a bearer token sent to --audit-webhook-url, e.g. a mounted Secret.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma-separated namespaces to watch instead of the whole cluster. "+
+			"Each namespace gets its own informers, so RBAC can be granted per namespace with Roles.")
+	flag.StringVar(&requestLabelSelector, "certificaterequest-label-selector", "",
+		"Label selector of the CertificateRequests this instance caches and signs, e.g. shard=a. "+
+			"Lets several controller instances split the requests between them. All requests when empty.")
+	flag.BoolVar(&enableClusterIssuers, "enable-cluster-issuers", true,
+		"Reconcile ExternalClusterIssuers and the CertificateRequests that reference them. "+
+			"Disable in namespaced deployments that must not watch cluster-scoped resources.")
+	flag.BoolVar(&disableApprovedCheck, "disable-approved-check", false,
+		"Sign CertificateRequests without waiting for them to be approved. "+
+			"Only for clusters without an approver; requests would otherwise wait forever.")
+	flag.BoolVar(&enableAutoApprover, "enable-auto-approver", false,
+		"Approve CertificateRequests for ExternalIssuers and ExternalClusterIssuers. "+
+			"For clusters without cert-manager's internal approver or approver-policy; requires the auto-approver RBAC.")
+	flag.StringVar(&autoApproveNamespaceSelector, "auto-approve-namespace-selector", "",
+		"Label selector of namespaces whose requests are auto-approved, e.g. env=dev. All namespaces when empty.")
+	flag.StringVar(&autoApproveLabelSelector, "auto-approve-label-selector", "",
+		"Label selector of CertificateRequests that are auto-approved. All requests when empty. "+
+			"Not an authorization boundary: whoever creates a Certificate or CertificateRequest sets its labels, "+
+			"so restrict who gets certificates with --auto-approve-namespace-selector.")
+	flag.StringVar(&istioCA.Addr, "istio-ca-address", "",
+		"Address to serve the Istio CA gRPC API (istio.v1.auth.IstioCertificateService) on, e.g. :6443. Empty disables it.")
+	flag.StringVar(&istioCAIssuer, "istio-ca-issuer", "",
+		"Issuer signing the certificates of Istio proxies: ExternalClusterIssuer/<name> or ExternalIssuer/<namespace>/<name>.")
+	flag.StringVar(&istioCA.TrustDomain, "istio-ca-trust-domain", "cluster.local", "Trust domain of the SPIFFE IDs of Istio proxies.")
+	flag.StringVar(&istioCA.Audience, "istio-ca-audience", "istio-ca", "Audience the ServiceAccount tokens of Istio proxies must be bound to.")
+	flag.StringVar(&istioCA.CertFile, "istio-ca-tls-cert-file", "", "Serving certificate of the Istio CA API, re-read on every handshake.")
+	flag.StringVar(&istioCA.KeyFile, "istio-ca-tls-key-file", "", "Private key of the Istio CA serving certificate.")
+	flag.DurationVar(&istioCA.MaxValidity, "istio-ca-max-validity", 24*time.Hour, "Longest validity Istio proxies may request, at least 24h.")
+	flag.BoolVar(&enableDefaultingWebhook, "enable-defaulting-webhook", false,
+		"Serve the mutating webhook filling in the defaults of issuers and PKIProfiles and normalizing their URLs. "+
+			"Requires deploy/webhook.yaml.")
+	flag.BoolVar(&enableValidatingWebhook, "enable-validating-webhook", false,
+		"Serve the validating webhook rejecting PKIProfiles whose PKI configuration is invalid. "+
+			"Requires deploy/webhook.yaml and deploy/webhook-validating.yaml.")
+	flag.IntVar(&webhookPort, "webhook-port", 9443, "Port the webhook server listens on.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs",
+		"Directory holding the webhook serving certificate as tls.crt and tls.key.")
+	flag.BoolVar(&disableMockCASigner, "disable-mockca-signer", false,
+		"Never self-sign certificates with the built-in mockca signer; issuers without PKI configuration are not ready. "+
+			"Builds with the nomockca tag don't contain the signer at all.")
+	flag.BoolVar(&allowMockCAFallback, "allow-mockca-fallback", false,
+		"Sign requests of issuers with signerType pki but neither configMapRef nor profileRef with the mockca signer. "+
+			"Without it such issuers fail with reason InvalidIssuerConfig instead of issuing untrusted certificates.")
+	flag.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", "",
+		"Namespace of the ConfigMaps and Secrets of ExternalClusterIssuers that don't name one. "+
+			"Defaults to the controller's namespace (POD_NAMESPACE, else external-issuer-system).")
+	flag.StringVar(&secretKeyAutodetect, "secret-key-autodetect", controllers.SecretKeyAutodetectWarn,
+		"Whether the token key of auth Secrets is guessed when authSecretRef names none: "+
+			"warn (try token, api-key, password and apiKey and emit a deprecation event naming the key found) or disabled.")
+	flag.BoolVar(&migrateStorageVersions, "migrate-storage-versions", true,
+		"Rewrite issuers and other custom resources stored in an older API version after a CRD upgrade. "+
+			"Ignored with --watch-namespaces, which can't list cluster-wide.")
+	flag.BoolVar(&showVersion, "version", false, "Print build information and exit.")
 
 	opts := zap.Options{
 		Development: true,
@@ -44,49 +211,442 @@ func main() {
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
+	if configFile != "" {
+		if err := applyConfigFile(flag.CommandLine, configFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	buildInfo := version.Get()
+	if showVersion {
+		fmt.Println("external-issuer-controller", buildInfo)
+		os.Exit(0)
+	}
+
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	if configFile != "" {
+		setupLog.Info("loaded config file", "path", configFile)
+	}
+	setupLog.Info("build info", "version", buildInfo.Version, "commit", buildInfo.GitCommit,
+		"buildDate", buildInfo.BuildDate, "platform", buildInfo.Platform)
+
+	traceOpts.ServiceName = "external-issuer-controller"
+	traceOpts.ServiceVersion = buildInfo.Version
+	shutdownTracing, err := tracing.Setup(context.Background(), traceOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	if traceOpts.Endpoint != "" {
+		setupLog.Info("tracing enabled", "endpoint", traceOpts.Endpoint, "protocol", traceOpts.Protocol)
+	}
+
+	if exportKafkaBrokers != "" {
+		exportOpts.KafkaBrokers = strings.Split(exportKafkaBrokers, ",")
+	}
+	certExporter, err := exporter.New(exportOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up certificate exporter")
+		os.Exit(1)
+	}
+
+	if enabledHooks != "" {
+		hookOpts.Enabled = strings.Split(enabledHooks, ",")
+	}
+	postIssuanceHooks, err := hooks.New(hookOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up post-issuance hooks")
+		os.Exit(1)
+	}
+
+	auditTrail, err := audit.New(auditOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up audit trail")
+		os.Exit(1)
+	}
+	if auditTrail != nil {
+		setupLog.Info("audit trail enabled", "file", auditOpts.File, "webhookURL", auditOpts.WebhookURL)
+	}
+
+	if !signer.MockCABuiltIn {
+		disableMockCASigner = true
+	}
+	if disableMockCASigner {
+		setupLog.Info("mockca signer disabled", "builtIn", signer.MockCABuiltIn)
+	}
+
+	if maxConcurrentReconciles < 1 {
+		setupLog.Error(fmt.Errorf("must be at least 1, got %d", maxConcurrentReconciles), "invalid --max-concurrent-reconciles")
+		os.Exit(1)
+	}
+	if defaultValidity < time.Hour {
+		setupLog.Error(fmt.Errorf("must be at least 1h, got %s", defaultValidity), "invalid --default-validity")
+		os.Exit(1)
+	}
+
+	if !controllers.ValidSecretKeyAutodetect(secretKeyAutodetect) {
+		setupLog.Error(fmt.Errorf("unsupported mode %q (supported: warn, disabled)", secretKeyAutodetect), "invalid --secret-key-autodetect")
+		os.Exit(1)
+	}
+
+	if enableLeaderElection && (renewDeadline >= leaseDuration || retryPeriod >= renewDeadline) {
+		setupLog.Error(fmt.Errorf("need retry period %s < renew deadline %s < lease duration %s", retryPeriod, renewDeadline, leaseDuration),
+			"invalid leader election durations")
+		os.Exit(1)
+	}
+
+	podNamespace := envOrDefault("POD_NAMESPACE", "external-issuer-system")
+	if clusterResourceNamespace == "" {
+		clusterResourceNamespace = podNamespace
+	}
+
+	// Namespaced deployments use one cache per namespace instead of cluster-wide informers
+	var cacheOpts cache.Options
+	if watchNamespaces != "" {
+		cacheOpts.DefaultNamespaces = map[string]cache.Config{}
+		for _, ns := range strings.Split(watchNamespaces, ",") {
+			if ns = strings.TrimSpace(ns); ns != "" {
+				cacheOpts.DefaultNamespaces[ns] = cache.Config{}
+			}
+		}
+		if enableClusterIssuers {
+			// ClusterIssuer configuration and credentials live in the cluster resource namespace
+			cacheOpts.DefaultNamespaces[clusterResourceNamespace] = cache.Config{}
+		}
+		setupLog.Info("watching selected namespaces", "namespaces", watchNamespaces, "clusterIssuers", enableClusterIssuers)
+	}
+
+	// Shards only cache, and therefore only reconcile, their own CertificateRequests
+	requestSelector, err := parseSelector(requestLabelSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid --certificaterequest-label-selector")
+		os.Exit(1)
+	}
+	if requestSelector != nil {
+		cacheOpts.ByObject = map[client.Object]cache.ByObject{
+			&cmapi.CertificateRequest{}: {Label: requestSelector},
+		}
+		setupLog.Info("watching selected CertificateRequests", "labelSelector", requestLabelSelector)
+	}
+
+	// Leave room for in-flight signings to drain before runnables are abandoned
+	gracefulShutdownTimeout := drainTimeout + 5*time.Second
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
+		Cache:  cacheOpts,
 		Metrics: metricsserver.Options{
 			BindAddress: metricsAddr,
+			ExtraHandlers: map[string]http.Handler{
+				"/version": version.Handler(),
+			},
 		},
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "external-issuer.io",
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    webhookPort,
+			CertDir: webhookCertDir,
+		}),
+		HealthProbeBindAddress:  probeAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        leaderElectionID,
+		LeaderElectionNamespace: leaderElectionNamespace,
+		LeaseDuration:           &leaseDuration,
+		RenewDeadline:           &renewDeadline,
+		RetryPeriod:             &retryPeriod,
+		// The process exits right after the manager stops, so the lease can be
+		// released for the new pod instead of waiting for it to expire
+		LeaderElectionReleaseOnCancel: true,
+		GracefulShutdownTimeout:       &gracefulShutdownTimeout,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	// All reconcilers share a client that records a span per Kubernetes API call
+	k8sClient := controllers.WithTracing(mgr.GetClient())
+
+	// Auth tokens are cached between reconciles and dropped when their Secret changes
+	credentials := controllers.NewCredentialCache()
+
+	// CA expiry seen in issued certificates, reported in the issuers' Degraded condition
+	caExpiry := controllers.NewCAExpiryTracker()
+	policyAudit := controllers.NewPolicyAuditTracker()
+
+	// Bound tokens of our own ServiceAccount for PKI auth type kubernetes
+	serviceAccountTokens := controllers.NewServiceAccountTokens(k8sClient, podNamespace,
+		envOrDefault("SERVICE_ACCOUNT_NAME", "external-issuer-controller"))
+
+	// Access tokens refreshed from OAuth token endpoints for PKI auth with refresh configured
+	oauthTokens := controllers.NewOAuthTokens()
+
+	// Issuer health check results, reported by the readiness and liveness probes
+	backendHealth := controllers.NewBackendHealth(nil)
+
+	// Issuers sharing a PKI endpoint share its scheduled health check probes
+	healthChecks := controllers.NewHealthChecker(backendHealth)
+	if err := mgr.Add(healthChecks); err != nil {
+		setupLog.Error(err, "unable to set up issuer health checks")
+		os.Exit(1)
+	}
+
+	// Records of issued certificates are delivered to the inventory in the background
+	var exportQueue *exporter.Queue
+	if certExporter != nil {
+		exportQueue = exporter.NewQueue(certExporter, 0)
+		if err := mgr.Add(exportQueue); err != nil {
+			setupLog.Error(err, "unable to set up certificate exporter")
+			os.Exit(1)
+		}
+		setupLog.Info("certificate export enabled", "httpURL", exportOpts.HTTPURL, "kafkaTopic", exportOpts.KafkaTopic)
+	}
+
+	// Post-issuance hooks run in the background as well
+	var hookRunner *hooks.Runner
+	if postIssuanceHooks != nil {
+		hookRunner = hooks.NewRunner(postIssuanceHooks, 0)
+		if err := mgr.Add(hookRunner); err != nil {
+			setupLog.Error(err, "unable to set up post-issuance hooks")
+			os.Exit(1)
+		}
+		setupLog.Info("post-issuance hooks enabled", "hooks", hookRunner.Names())
+	}
+
 	// Set up CertificateRequest reconciler
-	if err = (&controllers.CertificateRequestReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	requestReconciler := &controllers.CertificateRequestReconciler{
+		Client:                   k8sClient,
+		APIReader:                mgr.GetAPIReader(),
+		Scheme:                   mgr.GetScheme(),
+		Credentials:              credentials,
+		ServiceAccountTokens:     serviceAccountTokens,
+		OAuthTokens:              oauthTokens,
+		Exporter:                 exportQueue,
+		Hooks:                    hookRunner,
+		Audit:                    auditTrail,
+		Recorder:                 mgr.GetEventRecorderFor("external-issuer-controller"),
+		DrainTimeout:             drainTimeout,
+		MaxConcurrentReconciles:  maxConcurrentReconciles,
+		DefaultValidity:          defaultValidity,
+		DisableApprovedCheck:     disableApprovedCheck,
+		DisableClusterIssuers:    !enableClusterIssuers,
+		DisablePKIProfiles:       !enableClusterIssuers,
+		DisableMockCA:            disableMockCASigner,
+		AllowMockCAFallback:      allowMockCAFallback,
+		ClusterResourceNamespace: clusterResourceNamespace,
+		SecretKeyAutodetect:      secretKeyAutodetect,
+		CAExpiry:                 caExpiry,
+		PolicyAudit:              policyAudit,
+	}
+	if err = requestReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CertificateRequest")
 		os.Exit(1)
 	}
 
+	// Istio proxies get workload certificates from the issuer's signer directly
+	if istioCA.Addr != "" {
+		if istioCA.IssuerKind, istioCA.IssuerNamespace, istioCA.IssuerName, err = parseIssuerReference(istioCAIssuer); err != nil {
+			setupLog.Error(err, "invalid --istio-ca-issuer")
+			os.Exit(1)
+		}
+		if istioCA.CertFile == "" || istioCA.KeyFile == "" {
+			setupLog.Error(fmt.Errorf("--istio-ca-tls-cert-file and --istio-ca-tls-key-file are required"), "unable to set up the Istio CA API")
+			os.Exit(1)
+		}
+		if err := istioCA.Validate(); err != nil {
+			setupLog.Error(err, "invalid --istio-ca-max-validity")
+			os.Exit(1)
+		}
+		istioCA.Requests = requestReconciler
+		if err := mgr.Add(&istioCA); err != nil {
+			setupLog.Error(err, "unable to set up the Istio CA API")
+			os.Exit(1)
+		}
+		setupLog.Info("Istio CA API enabled", "address", istioCA.Addr, "issuer", istioCAIssuer, "trustDomain", istioCA.TrustDomain)
+	}
+
+	// Stored issuers and profiles state their defaults
+	if enableDefaultingWebhook {
+		if err := (&controllers.Defaulter{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to set up defaulting webhook")
+			os.Exit(1)
+		}
+		setupLog.Info("defaulting webhook enabled", "port", webhookPort)
+	}
+
+	// PKIProfiles with invalid configurations are rejected when they are written
+	if enableValidatingWebhook {
+		if err := (&controllers.ConfigValidator{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to set up validating webhook")
+			os.Exit(1)
+		}
+		setupLog.Info("validating webhook enabled", "port", webhookPort)
+	}
+
+	// Set up revocation of issued certificates through the issuers' PKI backends
+	if err = (&controllers.RevocationReconciler{
+		Client:                   k8sClient,
+		Scheme:                   mgr.GetScheme(),
+		Credentials:              credentials,
+		ServiceAccountTokens:     serviceAccountTokens,
+		OAuthTokens:              oauthTokens,
+		Exporter:                 exportQueue,
+		Recorder:                 mgr.GetEventRecorderFor("external-issuer-controller"),
+		DisableClusterIssuers:    !enableClusterIssuers,
+		DisablePKIProfiles:       !enableClusterIssuers,
+		DisableMockCA:            disableMockCASigner,
+		AllowMockCAFallback:      allowMockCAFallback,
+		ClusterResourceNamespace: clusterResourceNamespace,
+		SecretKeyAutodetect:      secretKeyAutodetect,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CertificateRevocationRequest")
+		os.Exit(1)
+	}
+
+	// Set up Secret watcher invalidating cached credentials on rotation
+	if err = (&controllers.SecretReconciler{
+		Credentials: credentials,
+		OAuthTokens: oauthTokens,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Secret")
+		os.Exit(1)
+	}
+
 	// Set up Issuer reconciler
 	if err = (&controllers.IssuerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:              k8sClient,
+		Scheme:              mgr.GetScheme(),
+		DisablePKIProfiles:  !enableClusterIssuers,
+		DisableMockCA:       disableMockCASigner,
+		AllowMockCAFallback: allowMockCAFallback,
+		CAExpiry:            caExpiry,
+		PolicyAudit:         policyAudit,
+		OAuthTokens:         oauthTokens,
+		Backends:            backendHealth,
+		HealthChecks:        healthChecks,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ExternalIssuer")
 		os.Exit(1)
 	}
 
 	// Set up ClusterIssuer reconciler
-	if err = (&controllers.ClusterIssuerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+	if enableClusterIssuers {
+		if err = (&controllers.ClusterIssuerReconciler{
+			Client:                   k8sClient,
+			Scheme:                   mgr.GetScheme(),
+			DisableMockCA:            disableMockCASigner,
+			AllowMockCAFallback:      allowMockCAFallback,
+			ClusterResourceNamespace: clusterResourceNamespace,
+			CAExpiry:                 caExpiry,
+			PolicyAudit:              policyAudit,
+			OAuthTokens:              oauthTokens,
+			Backends:                 backendHealth,
+			HealthChecks:             healthChecks,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ExternalClusterIssuer")
+			os.Exit(1)
+		}
+	}
+
+	// Set up test issuances of issuers with spec.selfTest or the self-test annotation
+	selfTestKinds := []string{"ExternalIssuer"}
+	if enableClusterIssuers {
+		selfTestKinds = append(selfTestKinds, "ExternalClusterIssuer")
+	}
+	for _, kind := range selfTestKinds {
+		if err = (&controllers.SelfTestReconciler{
+			Requests: requestReconciler,
+			Kind:     kind,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "SelfTest"+kind)
+			os.Exit(1)
+		}
+	}
+
+	// Set up application of issuer secret templates to issued certificates' Secrets
+	if err = (&controllers.SecretTemplateReconciler{
+		Client:                k8sClient,
+		Scheme:                mgr.GetScheme(),
+		DisableClusterIssuers: !enableClusterIssuers,
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "ExternalClusterIssuer")
+		setupLog.Error(err, "unable to create controller", "controller", "SecretTemplate")
 		os.Exit(1)
 	}
 
+	// Set up renewal of Secrets not managed by cert-manager Certificates
+	if enableSecretRenewal {
+		if err = (&controllers.SecretRenewalReconciler{
+			Client: k8sClient,
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "SecretRenewal")
+			os.Exit(1)
+		}
+	}
+
+	// Set up the optional approver for clusters without another approver
+	if enableAutoApprover {
+		approver := &controllers.ApproverReconciler{
+			Client:                k8sClient,
+			Scheme:                mgr.GetScheme(),
+			Recorder:              mgr.GetEventRecorderFor("external-issuer-approver"),
+			APIReader:             mgr.GetAPIReader(),
+			DisableClusterIssuers: !enableClusterIssuers,
+		}
+		if approver.NamespaceSelector, err = parseSelector(autoApproveNamespaceSelector); err != nil {
+			setupLog.Error(err, "invalid --auto-approve-namespace-selector")
+			os.Exit(1)
+		}
+		if approver.RequestSelector, err = parseSelector(autoApproveLabelSelector); err != nil {
+			setupLog.Error(err, "invalid --auto-approve-label-selector")
+			os.Exit(1)
+		}
+		if err = approver.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Approver")
+			os.Exit(1)
+		}
+		setupLog.Info("auto-approver enabled", "namespaceSelector", autoApproveNamespaceSelector,
+			"labelSelector", autoApproveLabelSelector)
+	}
+
+	// Move objects stored in an older API version to the current storage version
+	if migrateStorageVersions {
+		if watchNamespaces != "" {
+			setupLog.Info("storage version migration disabled, it needs cluster-wide access")
+		} else if err := mgr.Add(&controllers.StorageVersionMigrator{
+			Client:    mgr.GetClient(),
+			APIReader: mgr.GetAPIReader(),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up storage version migration")
+			os.Exit(1)
+		}
+	}
+
+	// Delete failed requests after their retention; issuers may opt in even
+	// when --failed-request-retention is 0
+	if err := mgr.Add(&controllers.RequestJanitor{
+		Client:                mgr.GetClient(),
+		Retention:             failedRequestRetention,
+		DisableClusterIssuers: !enableClusterIssuers,
+	}); err != nil {
+		setupLog.Error(err, "unable to set up the CertificateRequest janitor")
+		os.Exit(1)
+	}
+
+	// Summarize the issuers in an ExternalIssuerReport
+	if issuerReportName != "" {
+		if watchNamespaces != "" {
+			setupLog.Info("issuer report disabled, it needs cluster-wide access")
+		} else if err := mgr.Add(&controllers.IssuerReporter{
+			Client:                mgr.GetClient(),
+			Name:                  issuerReportName,
+			Backends:              backendHealth,
+			DisableClusterIssuers: !enableClusterIssuers,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up the issuer report")
+			os.Exit(1)
+		}
+	}
+
 	// Health and readiness probes
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
@@ -96,10 +656,65 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if readyzIncludeBackends {
+		if err := mgr.AddReadyzCheck("backends", backendHealth.ReadyzCheck); err != nil {
+			setupLog.Error(err, "unable to set up backend ready check")
+			os.Exit(1)
+		}
+	}
+	if backendLivenessTimeout > 0 {
+		if err := mgr.AddHealthzCheck("backends", backendHealth.LivenessCheck(backendLivenessTimeout)); err != nil {
+			setupLog.Error(err, "unable to set up backend health check")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
-		setupLog.Error(err, "problem running manager")
+	runErr := mgr.Start(ctrl.SetupSignalHandler())
+
+	if err := auditTrail.Close(); err != nil {
+		setupLog.Error(err, "failed to close audit trail")
+	}
+
+	// Flush buffered spans before exiting
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		setupLog.Error(err, "failed to flush traces")
+	}
+
+	if runErr != nil {
+		setupLog.Error(runErr, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// envOrDefault returns the value of an environment variable or a default
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// parseIssuerReference parses an issuer given as ExternalClusterIssuer/<name>
+// or ExternalIssuer/<namespace>/<name>
+func parseIssuerReference(ref string) (kind, namespace, name string, err error) {
+	parts := strings.Split(ref, "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "ExternalClusterIssuer" && parts[1] != "":
+		return parts[0], "", parts[1], nil
+	case len(parts) == 3 && parts[0] == "ExternalIssuer" && parts[1] != "" && parts[2] != "":
+		return parts[0], parts[1], parts[2], nil
+	}
+	return "", "", "", fmt.Errorf("%q is not ExternalClusterIssuer/<name> or ExternalIssuer/<namespace>/<name>", ref)
+}
+
+// parseSelector parses a label selector flag, returning nil (no filtering)
+// when it is empty
+func parseSelector(selector string) (labels.Selector, error) {
+	if selector == "" {
+		return nil, nil
+	}
+	return labels.Parse(selector)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/audit"
+)
+
+// auditVerify checks the hash chain of an audit trail written with
+// --audit-log-file
+func auditVerify(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	count, err := audit.Verify(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w (%d records verified before it)", path, err, count)
+	}
+	fmt.Printf("%s: %d records, chain intact\n", path, count)
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	"github.com/bvorland/cert-manager-external-issuer/pkg/signer/configbuilder"
+	"sigs.k8s.io/yaml"
+)
+
+// configOptions are the flags of "config generate"
+type configOptions struct {
+	baseURL      string
+	preset       string
+	method       string
+	request      string
+	csrParam     string
+	csrFormat    string
+	subjectParam string
+	dnFormat     string
+	dnsPrefix    string
+	dnsStart     int
+	dnsMax       int
+	auth         string
+	authSecret   string
+	authHeader   string
+	audience     string
+	response     string
+	certField    string
+	chainField   string
+	proxy        string
+	pollURL      string
+	orderIDField string
+	name         string
+	namespace    string
+	key          string
+	output       string
+}
+
+// configGenerate writes a PKIConfig built from flags, validated the same way
+// the controller validates ConfigMaps, as a ConfigMap manifest or plain JSON
+func configGenerate(args []string) error {
+	var opts configOptions
+	fs := flag.NewFlagSet("config generate", flag.ContinueOnError)
+	fs.StringVar(&opts.baseURL, "base-url", "", "URL of the PKI API signing endpoint (required).")
+	fs.StringVar(&opts.preset, "preset", "", "Start from a vendor preset: "+strings.Join(signer.PresetNames(), ", ")+".")
+	fs.StringVar(&opts.method, "method", "", "HTTP method: GET or POST (default: POST, or the preset's).")
+	fs.StringVar(&opts.request, "request", "", "Request encoding: form, semicolon, json, multipart or raw-der (default: form, or the preset's).")
+	fs.StringVar(&opts.csrParam, "csr-param", "", "Parameter carrying the PEM CSR, or the file field with --request multipart.")
+	fs.StringVar(&opts.csrFormat, "csr-format", "pem", "Encoding of the CSR file uploaded with --request multipart: pem or der.")
+	fs.StringVar(&opts.subjectParam, "subject-param", "", "Parameter carrying the subject DN.")
+	fs.StringVar(&opts.dnFormat, "dn-format", "comma", "Subject DN format with --subject-param: comma or slash.")
+	fs.StringVar(&opts.dnsPrefix, "dns-prefix", "", "Prefix of the numbered parameters carrying DNS SANs, e.g. dns for dns1, dns2.")
+	fs.IntVar(&opts.dnsStart, "dns-start-index", 1, "Number of the first DNS SAN parameter.")
+	fs.IntVar(&opts.dnsMax, "dns-max", 0, "Maximum number of DNS SANs sent (0: no limit).")
+	fs.StringVar(&opts.auth, "auth", "", "Authentication: bearer, basic, header or serviceaccount.")
+	fs.StringVar(&opts.authSecret, "auth-secret", "", "Secret holding the credentials of --auth bearer, basic or header.")
+	fs.StringVar(&opts.authHeader, "auth-header", "", "Header carrying the token with --auth header.")
+	fs.StringVar(&opts.audience, "audience", "", "Token audience with --auth serviceaccount.")
+	fs.StringVar(&opts.response, "response", "", "Response format: pem, json or pkcs7 (default: pem, or the preset's).")
+	fs.StringVar(&opts.certField, "certificate-field", "", "JSON field holding the certificate with --response json.")
+	fs.StringVar(&opts.chainField, "chain-field", "", "JSON field holding the CA chain with --response json.")
+	fs.StringVar(&opts.proxy, "proxy", "", "Forward proxy for PKI API requests.")
+	fs.StringVar(&opts.pollURL, "poll-url", "", `Poll URL of asynchronous issuance; "{id}" is replaced with the order ID.`)
+	fs.StringVar(&opts.orderIDField, "order-id-field", "", "JSON field holding the order ID with --poll-url.")
+	fs.StringVar(&opts.name, "name", "pki-config", "Name of the ConfigMap.")
+	fs.StringVar(&opts.namespace, "namespace", "cert-manager", "Namespace of the ConfigMap.")
+	fs.StringVar(&opts.key, "key", "pki-config.json", "ConfigMap key holding the configuration.")
+	fs.StringVar(&opts.output, "output", "yaml", "Output: yaml (ConfigMap manifest) or json (the configuration only).")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if opts.output != "yaml" && opts.output != "json" {
+		return fmt.Errorf("unsupported output %q, expected yaml or json", opts.output)
+	}
+
+	b, err := opts.builder()
+	if err != nil {
+		return err
+	}
+	config, err := b.Build()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	if opts.output == "json" {
+		_, err = fmt.Printf("%s\n", data)
+		return err
+	}
+
+	manifest, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]string{"name": opts.name, "namespace": opts.namespace},
+		"data":       map[string]string{opts.key: string(data) + "\n"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode ConfigMap: %w", err)
+	}
+	_, err = os.Stdout.Write(manifest)
+	return err
+}
+
+// builder turns the flags into a configuration builder; flags left unset
+// keep the defaults or the preset's settings
+func (o configOptions) builder() (*configbuilder.Builder, error) {
+	b := configbuilder.New(o.baseURL)
+	if o.preset != "" {
+		b = configbuilder.FromPreset(o.preset, o.baseURL)
+	}
+	if o.method != "" {
+		b.WithMethod(o.method)
+	}
+
+	switch o.request {
+	case "":
+	case "form":
+		b.WithFormRequest()
+	case "semicolon":
+		b.WithSemicolonRequest()
+	case "json":
+		b.WithJSONRequest()
+	case "multipart":
+		b.WithMultipartRequest(o.csrParam, o.csrFormat)
+	case "raw-der":
+		b.WithRawCSRRequest()
+	default:
+		return nil, fmt.Errorf("unsupported request encoding %q, expected form, semicolon, json, multipart or raw-der", o.request)
+	}
+	if o.csrParam != "" && o.request != "multipart" {
+		b.WithCSRParam(o.csrParam)
+	}
+	if o.subjectParam != "" {
+		b.WithSubjectParam(o.subjectParam, o.dnFormat)
+	}
+	if o.dnsPrefix != "" {
+		b.WithDNSParams(o.dnsPrefix, o.dnsStart, o.dnsMax)
+	}
+
+	switch o.auth {
+	case "":
+	case "bearer":
+		b.WithBearerFromSecret(o.authSecret)
+	case "basic":
+		b.WithBasicFromSecret(o.authSecret)
+	case "header":
+		b.WithHeaderFromSecret(o.authHeader, o.authSecret)
+	case "serviceaccount":
+		b.WithServiceAccountToken(o.audience)
+	default:
+		return nil, fmt.Errorf("unsupported authentication %q, expected bearer, basic, header or serviceaccount", o.auth)
+	}
+
+	switch o.response {
+	case "":
+	case "json":
+		b.WithJSONResponse(o.certField, o.chainField)
+	case "pkcs7":
+		b.WithPKCS7Response()
+	case "pem":
+		b.WithPEMResponse()
+	default:
+		return nil, fmt.Errorf("unsupported response format %q, expected pem, json or pkcs7", o.response)
+	}
+
+	if o.proxy != "" {
+		b.WithProxy(o.proxy)
+	}
+	if o.pollURL != "" {
+		b.WithAsync(o.pollURL, o.orderIDField)
+	}
+	return b, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// csrSecretKey is the Secret key holding the generated CSR next to tls.key
+const csrSecretKey = "tls.csr"
+
+// csrOptions are the flags of "csr create"
+type csrOptions struct {
+	commonName     string
+	organizations  string
+	dnsNames       string
+	ipAddresses    string
+	uris           string
+	emailAddresses string
+	spiffeID       string
+	usages         string
+	keyAlgorithm   string
+	keySize        int
+	keyEncoding    string
+	keyFile        string
+	csrFile        string
+	secretName     string
+	namespace      string
+	kubeconfig     string
+}
+
+// csrCreate generates a private key and a CSR the same way cert-manager does
+// for a Certificate, so PKIConfig mappings can be tested against the external
+// PKI without creating Certificates in a cluster
+func csrCreate(args []string) error {
+	var opts csrOptions
+	fs := flag.NewFlagSet("csr create", flag.ContinueOnError)
+	fs.StringVar(&opts.commonName, "common-name", "", "Subject common name.")
+	fs.StringVar(&opts.organizations, "organizations", "", "Comma-separated subject organizations.")
+	fs.StringVar(&opts.dnsNames, "dns-names", "", "Comma-separated DNS SANs.")
+	fs.StringVar(&opts.ipAddresses, "ip-addresses", "", "Comma-separated IP SANs.")
+	fs.StringVar(&opts.uris, "uris", "", "Comma-separated URI SANs.")
+	fs.StringVar(&opts.emailAddresses, "email-addresses", "", "Comma-separated email SANs.")
+	fs.StringVar(&opts.spiffeID, "spiffe-id", "", "SPIFFE ID added as URI SAN, e.g. spiffe://cluster.local/ns/default/sa/app.")
+	fs.StringVar(&opts.usages, "usages", "",
+		`Comma-separated key usages as in a Certificate spec, e.g. "digital signature,key encipherment,server auth" `+
+			`(default: cert-manager's defaults).`)
+	fs.StringVar(&opts.keyAlgorithm, "key-algorithm", "RSA", "Private key algorithm: RSA, ECDSA or Ed25519.")
+	fs.IntVar(&opts.keySize, "key-size", 0, "Key size (RSA: 2048, 3072, 4096; ECDSA: 256, 384, 521; default per algorithm).")
+	fs.StringVar(&opts.keyEncoding, "key-encoding", "PKCS1", "Private key encoding: PKCS1 or PKCS8.")
+	fs.StringVar(&opts.keyFile, "key-file", "tls.key", "File the private key is written to.")
+	fs.StringVar(&opts.csrFile, "csr-file", "tls.csr", "File the CSR is written to.")
+	fs.StringVar(&opts.secretName, "secret", "",
+		"Write the key and CSR to this Secret (keys tls.key and tls.csr) instead of files.")
+	fs.StringVar(&opts.namespace, "namespace", "default", "Namespace of --secret.")
+	fs.StringVar(&opts.kubeconfig, "kubeconfig", "", "Kubeconfig used with --secret (default: KUBECONFIG, in-cluster or ~/.kube/config).")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	crt, err := opts.certificate()
+	if err != nil {
+		return err
+	}
+
+	key, err := pki.GeneratePrivateKeyForCertificate(crt)
+	if err != nil {
+		return fmt.Errorf("failed to generate private key: %w", err)
+	}
+	keyPEM, err := pki.EncodePrivateKey(key, crt.Spec.PrivateKey.Encoding)
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+	template, err := pki.GenerateCSR(crt)
+	if err != nil {
+		return fmt.Errorf("failed to build CSR: %w", err)
+	}
+	csrDER, err := pki.EncodeCSR(template, key)
+	if err != nil {
+		return fmt.Errorf("failed to sign CSR: %w", err)
+	}
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+
+	if opts.secretName != "" {
+		if err := writeCSRSecret(opts, keyPEM, csrPEM); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote private key and CSR to Secret %s/%s\n", opts.namespace, opts.secretName)
+		return nil
+	}
+
+	if err := os.WriteFile(opts.keyFile, keyPEM, 0o600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := os.WriteFile(opts.csrFile, csrPEM, 0o644); err != nil {
+		return fmt.Errorf("failed to write CSR: %w", err)
+	}
+	fmt.Printf("Wrote private key to %s and CSR to %s\n", opts.keyFile, opts.csrFile)
+	fmt.Printf("Inspect with: openssl req -in %s -noout -text\n", opts.csrFile)
+	return nil
+}
+
+// certificate turns the flags into a Certificate spec for cert-manager's CSR helpers
+func (o csrOptions) certificate() (*cmapi.Certificate, error) {
+	uris := splitList(o.uris)
+	if o.spiffeID != "" {
+		id, err := url.Parse(o.spiffeID)
+		if err != nil || id.Scheme != "spiffe" || id.Host == "" {
+			return nil, fmt.Errorf("invalid SPIFFE ID %q, expected spiffe://<trust-domain>/<path>", o.spiffeID)
+		}
+		uris = append(uris, o.spiffeID)
+	}
+
+	var usages []cmapi.KeyUsage
+	for _, u := range splitList(o.usages) {
+		usages = append(usages, cmapi.KeyUsage(u))
+	}
+
+	crt := &cmapi.Certificate{
+		Spec: cmapi.CertificateSpec{
+			CommonName:     o.commonName,
+			DNSNames:       splitList(o.dnsNames),
+			IPAddresses:    splitList(o.ipAddresses),
+			URIs:           uris,
+			EmailAddresses: splitList(o.emailAddresses),
+			Usages:         usages,
+			PrivateKey: &cmapi.CertificatePrivateKey{
+				Algorithm: cmapi.PrivateKeyAlgorithm(o.keyAlgorithm),
+				Size:      o.keySize,
+				Encoding:  cmapi.PrivateKeyEncoding(o.keyEncoding),
+			},
+		},
+	}
+	if orgs := splitList(o.organizations); len(orgs) > 0 {
+		crt.Spec.Subject = &cmapi.X509Subject{Organizations: orgs}
+	}
+
+	if crt.Spec.CommonName == "" && len(crt.Spec.DNSNames) == 0 && len(crt.Spec.IPAddresses) == 0 &&
+		len(crt.Spec.URIs) == 0 && len(crt.Spec.EmailAddresses) == 0 {
+		return nil, fmt.Errorf("at least one of --common-name, --dns-names, --ip-addresses, --uris, --email-addresses or --spiffe-id is required")
+	}
+	return crt, nil
+}
+
+// writeCSRSecret stores the key and CSR in a new Secret
+func writeCSRSecret(opts csrOptions, keyPEM, csrPEM []byte) error {
+	cfg, err := restConfig(opts.kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	c, err := client.New(cfg, client.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.secretName,
+			Namespace: opts.namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "external-issuer-cli",
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			corev1.TLSPrivateKeyKey: keyPEM,
+			csrSecretKey:            csrPEM,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := c.Create(ctx, secret); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("secret %s/%s already exists, delete it or choose another name", opts.namespace, opts.secretName)
+		}
+		return fmt.Errorf("failed to create Secret %s/%s: %w", opts.namespace, opts.secretName, err)
+	}
+	return nil
+}
+
+// restConfig loads an explicit kubeconfig or falls back to controller-runtime's lookup
+func restConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" {
+		return clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	return config.GetConfig()
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,68 @@
+// Package main provides the external-issuer command line tool.
+//
+// Usage:
+//
+//	external-issuer csr create [flags]   Generate a private key and CSR
+//	external-issuer config generate [flags] Generate a validated PKIConfig ConfigMap
+//	external-issuer audit verify FILE    Verify the chain of an audit trail
+//	external-issuer version              Print build information
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/version"
+)
+
+const usage = `external-issuer - helper tool for the cert-manager external issuer
+
+Usage:
+  external-issuer csr create [flags]   Generate a private key and CSR as files or a Secret
+  external-issuer config generate [flags]
+                                       Generate a PKIConfig ConfigMap, validated as the controller does
+  external-issuer audit verify FILE    Verify the hash chain of the controller's audit trail
+  external-issuer version              Print build information
+
+Run "external-issuer csr create -h" for the flags of a command.
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "csr":
+		if len(args) < 2 || args[1] != "create" {
+			return fmt.Errorf("unknown csr command, expected: external-issuer csr create")
+		}
+		return csrCreate(args[2:])
+	case "config":
+		if len(args) < 2 || args[1] != "generate" {
+			return fmt.Errorf("unknown config command, expected: external-issuer config generate")
+		}
+		return configGenerate(args[2:])
+	case "audit":
+		if len(args) != 3 || args[1] != "verify" {
+			return fmt.Errorf("unknown audit command, expected: external-issuer audit verify FILE")
+		}
+		return auditVerify(args[2])
+	case "version":
+		fmt.Printf("external-issuer %s\n", version.Get())
+		return nil
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+	}
+}
@@ -0,0 +1,496 @@
+// Package main provides a soak and load test for PKI backends.
+//
+// loadtest sends CSRs at a fixed rate to the PKI API described by a PKIConfig
+// (the JSON stored in an issuer's ConfigMap), using the same signer as the
+// controller, and reports the latency distribution and error rates. Use it to
+// size the controller and to agree on rate limits with the PKI team.
+//
+// Usage:
+//
+//	loadtest -config pki-config.json -rate 20 -duration 5m
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	"github.com/bvorland/cert-manager-external-issuer/pkg/signer/configbuilder"
+)
+
+// maxErrorGroups bounds the distinct error messages listed in the report
+const maxErrorGroups = 10
+
+// options are the command line flags
+type options struct {
+	configFile       string
+	tokenFile        string
+	username         string
+	passwordFile     string
+	rate             float64
+	duration         time.Duration
+	concurrency      int
+	keys             int
+	dnsSuffix        string
+	validityDays     int
+	timeout          time.Duration
+	progressInterval time.Duration
+	output           string
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	var opts options
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	fs.StringVar(&opts.configFile, "config", "", "PKIConfig JSON file, as stored in the issuer's ConfigMap (required).")
+	fs.StringVar(&opts.tokenFile, "token-file", "", "File holding the token for auth types bearer and header.")
+	fs.StringVar(&opts.username, "username", "", "Username for auth type basic.")
+	fs.StringVar(&opts.passwordFile, "password-file", "", "File holding the password for auth type basic.")
+	fs.Float64Var(&opts.rate, "rate", 10, "CSRs sent per second.")
+	fs.DurationVar(&opts.duration, "duration", time.Minute, "How long to send CSRs.")
+	fs.IntVar(&opts.concurrency, "concurrency", 50,
+		"Maximum requests in flight; CSRs due while it is reached are dropped and reported.")
+	fs.IntVar(&opts.keys, "keys", 100, "Number of ECDSA P-256 keys the CSRs are signed with.")
+	fs.StringVar(&opts.dnsSuffix, "dns-suffix", "loadtest.example.com", "DNS suffix of the unique common names.")
+	fs.IntVar(&opts.validityDays, "validity-days", 1, "Validity requested for each certificate, in days.")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "Timeout of each signing request.")
+	fs.DurationVar(&opts.progressInterval, "progress-interval", 10*time.Second, "Interval of progress lines on stderr (0 disables them).")
+	fs.StringVar(&opts.output, "output", "text", "Report format: text or json.")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	pkiSigner, err := opts.signer()
+	if err != nil {
+		return err
+	}
+	keys, err := generateKeys(opts.keys)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "Sending %.1f CSRs/s for %s to %s (concurrency %d)\n",
+		opts.rate, opts.duration, pkiSigner.target, opts.concurrency)
+	stats := loadTest(ctx, pkiSigner, keys, opts)
+
+	rep := stats.report()
+	if opts.output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	rep.print()
+	return nil
+}
+
+// validate checks the flags for values the test cannot run with
+func (o options) validate() error {
+	switch {
+	case o.configFile == "":
+		return fmt.Errorf("-config is required")
+	case o.rate <= 0:
+		return fmt.Errorf("-rate must be positive")
+	case o.duration <= 0:
+		return fmt.Errorf("-duration must be positive")
+	case o.concurrency < 1:
+		return fmt.Errorf("-concurrency must be at least 1")
+	case o.keys < 1:
+		return fmt.Errorf("-keys must be at least 1")
+	case o.validityDays < 1:
+		return fmt.Errorf("-validity-days must be at least 1")
+	case o.output != "text" && o.output != "json":
+		return fmt.Errorf("-output must be text or json, got %q", o.output)
+	}
+	return nil
+}
+
+// loadSigner is the signer under test and a description of its backend
+type loadSigner struct {
+	*signer.PKISigner
+	target string
+}
+
+// signer creates the PKI signer the controller would create for the config
+func (o options) signer() (*loadSigner, error) {
+	data, err := os.ReadFile(o.configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	config, err := configbuilder.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", o.configFile, err)
+	}
+
+	pkiSigner, err := signer.NewPKISigner(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signer: %w", err)
+	}
+	if o.tokenFile != "" {
+		token, err := os.ReadFile(o.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token: %w", err)
+		}
+		pkiSigner.SetAuthToken(strings.TrimSpace(string(token)))
+	}
+	if o.username != "" {
+		password, err := os.ReadFile(o.passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password: %w", err)
+		}
+		pkiSigner.SetBasicAuth(o.username, strings.TrimSpace(string(password)))
+	}
+
+	target := strings.Join(config.EndpointURLs(), ", ")
+	if config.Transport != nil && config.Transport.Type != "" && config.Transport.Type != "http" {
+		target = "transport " + config.Transport.Type
+	}
+	return &loadSigner{PKISigner: pkiSigner, target: target}, nil
+}
+
+// generateKeys creates the keys CSRs are signed with. Keys are reused across
+// CSRs so key generation doesn't limit the achievable rate.
+func generateKeys(n int) ([]*ecdsa.PrivateKey, error) {
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range keys {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// newCSR creates a PEM CSR for a unique common name
+func newCSR(key *ecdsa.PrivateKey, commonName string) ([]byte, error) {
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName, Organization: []string{"cert-manager-external-issuer loadtest"}},
+		DNSNames: []string{commonName},
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CSR: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// loadTest sends CSRs at the configured rate until the duration has passed or
+// ctx is cancelled, then waits for the requests in flight
+func loadTest(ctx context.Context, s *loadSigner, keys []*ecdsa.PrivateKey, opts options) *stats {
+	st := &stats{errors: map[string]int{}}
+	runID := time.Now().Unix()
+
+	interval := time.Duration(float64(time.Second) / opts.rate)
+	if interval <= 0 {
+		interval = time.Nanosecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var progress <-chan time.Time
+	if opts.progressInterval > 0 {
+		progressTicker := time.NewTicker(opts.progressInterval)
+		defer progressTicker.Stop()
+		progress = progressTicker.C
+	}
+
+	deadline := time.NewTimer(opts.duration)
+	defer deadline.Stop()
+
+	slots := make(chan struct{}, opts.concurrency)
+	var wg sync.WaitGroup
+	var seq int64
+	st.start = time.Now()
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(os.Stderr, "Interrupted, waiting for requests in flight")
+			break loop
+		case <-deadline.C:
+			break loop
+		case <-progress:
+			st.printProgress()
+		case <-ticker.C:
+			select {
+			case slots <- struct{}{}:
+			default:
+				atomic.AddInt64(&st.dropped, 1)
+				continue
+			}
+			n := atomic.AddInt64(&seq, 1)
+			key := keys[int(n)%len(keys)]
+			commonName := fmt.Sprintf("lt-%d-%d.%s", runID, n, opts.dnsSuffix)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				st.record(signOne(s, key, commonName, opts))
+			}()
+		}
+	}
+	st.sendEnd = time.Now()
+	wg.Wait()
+	st.end = time.Now()
+	return st
+}
+
+// result is the outcome of one signing request
+type result struct {
+	latency time.Duration
+	err     error
+}
+
+// signOne sends a single CSR. Requests in flight complete even when the test
+// is interrupted, so their latency is not cut short.
+func signOne(s *loadSigner, key *ecdsa.PrivateKey, commonName string, opts options) result {
+	csrPEM, err := newCSR(key, commonName)
+	if err != nil {
+		return result{err: err}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	start := time.Now()
+	certPEM, _, err := s.Sign(ctx, csrPEM, opts.validityDays)
+	latency := time.Since(start)
+	if err == nil {
+		if block, _ := pem.Decode(certPEM); block == nil || block.Type != "CERTIFICATE" {
+			err = fmt.Errorf("response contains no PEM certificate")
+		}
+	}
+	return result{latency: latency, err: err}
+}
+
+// stats collects the results of a load test
+type stats struct {
+	mu        sync.Mutex
+	succeeded []time.Duration
+	failed    []time.Duration
+	pending   int
+	errors    map[string]int
+	dropped   int64
+
+	start, sendEnd, end time.Time
+}
+
+// record adds the result of one request
+func (s *stats) record(res result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending *signer.PendingError
+	switch {
+	case res.err == nil:
+		s.succeeded = append(s.succeeded, res.latency)
+	case errors.As(res.err, &pending):
+		// Asynchronous PKIs accept the request; the latency is that of the order
+		s.pending++
+		s.succeeded = append(s.succeeded, res.latency)
+	default:
+		s.failed = append(s.failed, res.latency)
+		s.errors[errorGroup(res.err)]++
+	}
+}
+
+// errorGroup shortens an error message so errors of the same kind are counted together
+func errorGroup(err error) string {
+	msg := strings.Join(strings.Fields(err.Error()), " ")
+	if len(msg) > 120 {
+		msg = msg[:117] + "..."
+	}
+	return msg
+}
+
+// printProgress prints the counts so far on stderr
+func (s *stats) printProgress() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elapsed := time.Since(s.start).Round(time.Second)
+	fmt.Fprintf(os.Stderr, "[%s] succeeded=%d failed=%d dropped=%d\n",
+		elapsed, len(s.succeeded), len(s.failed), atomic.LoadInt64(&s.dropped))
+}
+
+// report summarizes the results of a load test
+type report struct {
+	Sent      int     `json:"sent"`
+	Succeeded int     `json:"succeeded"`
+	Pending   int     `json:"pending"`
+	Failed    int     `json:"failed"`
+	Dropped   int64   `json:"dropped"`
+	ErrorRate float64 `json:"errorRate"`
+
+	DurationSeconds float64 `json:"durationSeconds"`
+	// Rate is the rate CSRs were actually sent at, per second
+	Rate float64 `json:"rate"`
+	// Throughput is the rate of successful responses, per second
+	Throughput float64 `json:"throughput"`
+
+	// Latency of successful requests
+	Latency latencySummary `json:"latency"`
+	// FailedLatency is the latency of failed requests, e.g. to spot timeouts
+	FailedLatency *latencySummary `json:"failedLatency,omitempty"`
+
+	Errors []errorCount `json:"errors,omitempty"`
+}
+
+// latencySummary is a latency distribution in milliseconds
+type latencySummary struct {
+	Min  float64 `json:"minMs"`
+	Mean float64 `json:"meanMs"`
+	P50  float64 `json:"p50Ms"`
+	P90  float64 `json:"p90Ms"`
+	P95  float64 `json:"p95Ms"`
+	P99  float64 `json:"p99Ms"`
+	Max  float64 `json:"maxMs"`
+}
+
+// errorCount is the number of failures with the same message
+type errorCount struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+// report computes the summary once all requests have completed
+func (s *stats) report() report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := report{
+		Succeeded:       len(s.succeeded),
+		Pending:         s.pending,
+		Failed:          len(s.failed),
+		Dropped:         s.dropped,
+		DurationSeconds: s.end.Sub(s.start).Seconds(),
+		Latency:         summarize(s.succeeded),
+	}
+	if len(s.failed) > 0 {
+		failed := summarize(s.failed)
+		r.FailedLatency = &failed
+	}
+	r.Sent = r.Succeeded + r.Failed
+	if r.Sent > 0 {
+		r.ErrorRate = float64(r.Failed) / float64(r.Sent)
+	}
+	if sending := s.sendEnd.Sub(s.start).Seconds(); sending > 0 {
+		r.Rate = float64(r.Sent) / sending
+	}
+	if r.DurationSeconds > 0 {
+		r.Throughput = float64(r.Succeeded) / r.DurationSeconds
+	}
+
+	for msg, count := range s.errors {
+		r.Errors = append(r.Errors, errorCount{Message: msg, Count: count})
+	}
+	sort.Slice(r.Errors, func(i, j int) bool {
+		if r.Errors[i].Count != r.Errors[j].Count {
+			return r.Errors[i].Count > r.Errors[j].Count
+		}
+		return r.Errors[i].Message < r.Errors[j].Message
+	})
+	if len(r.Errors) > maxErrorGroups {
+		r.Errors = r.Errors[:maxErrorGroups]
+	}
+	return r
+}
+
+// summarize computes the latency distribution of the given requests
+func summarize(latencies []time.Duration) latencySummary {
+	if len(latencies) == 0 {
+		return latencySummary{}
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, l := range sorted {
+		total += l
+	}
+	percentile := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return ms(sorted[i])
+	}
+	return latencySummary{
+		Min:  ms(sorted[0]),
+		Mean: ms(total / time.Duration(len(sorted))),
+		P50:  percentile(0.50),
+		P90:  percentile(0.90),
+		P95:  percentile(0.95),
+		P99:  percentile(0.99),
+		Max:  ms(sorted[len(sorted)-1]),
+	}
+}
+
+// ms converts a duration to milliseconds rounded to 0.1ms
+func ms(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*10) / 10
+}
+
+// print writes the report as text
+func (r report) print() {
+	fmt.Printf("Requests:   %d sent, %d succeeded (%d pending), %d failed, %d dropped\n",
+		r.Sent, r.Succeeded, r.Pending, r.Failed, r.Dropped)
+	fmt.Printf("Error rate: %.2f%%\n", r.ErrorRate*100)
+	fmt.Printf("Duration:   %.1fs, sent %.2f/s, succeeded %.2f/s\n", r.DurationSeconds, r.Rate, r.Throughput)
+	if r.Succeeded > 0 {
+		fmt.Println()
+		fmt.Println("Latency of successful requests (ms):")
+		r.Latency.print()
+	}
+	if r.Failed > 0 {
+		fmt.Println()
+		fmt.Println("Latency of failed requests (ms):")
+		r.FailedLatency.print()
+		fmt.Println()
+		fmt.Println("Errors:")
+		for _, e := range r.Errors {
+			fmt.Printf("  %6d  %s\n", e.Count, e.Message)
+		}
+	}
+	if r.Dropped > 0 {
+		fmt.Println()
+		fmt.Println("CSRs were dropped because -concurrency requests were in flight; the PKI can't keep up with -rate.")
+	}
+}
+
+func (l latencySummary) print() {
+	fmt.Printf("  min %.1f  mean %.1f  p50 %.1f  p90 %.1f  p95 %.1f  p99 %.1f  max %.1f\n",
+		l.Min, l.Mean, l.P50, l.P90, l.P95, l.P99, l.Max)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accessLogEntry is a line of the access log, one per signing request
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	// ForwardedFor is the X-Forwarded-For header, for servers behind a proxy
+	ForwardedFor string `json:"forwarded_for,omitempty"`
+	UserAgent    string `json:"user_agent,omitempty"`
+	// Client identifies the client by its credentials, see clientIdentity
+	Client string              `json:"client,omitempty"`
+	Tenant string              `json:"tenant,omitempty"`
+	Method string              `json:"method"`
+	Path   string              `json:"path"`
+	Query  map[string][]string `json:"query,omitempty"`
+	// Params are the parsed body as in /admin/requests, passwords redacted
+	Params     map[string]any `json:"params,omitempty"`
+	Status     int            `json:"status"`
+	DurationMS float64        `json:"duration_ms"`
+}
+
+// accessLog appends signing requests to a JSONL file, rotating it when it
+// reaches its size limit. Unlike /admin/requests it survives restarts and
+// never holds credentials, so shared instances keep an auditable record.
+type accessLog struct {
+	mu   sync.Mutex
+	file *os.File
+	size int64
+
+	// path is the current file; rotated files get the suffixes .1 (newest) to .maxFiles
+	path string
+	// maxSize is the size in bytes at which the file is rotated (0 = never)
+	maxSize int64
+	// maxFiles is how many rotated files are kept
+	maxFiles int
+
+	logger *slog.Logger
+}
+
+// newAccessLog opens the access log at path, appending to an existing file
+func newAccessLog(path string, maxSize int64, maxFiles int, logger *slog.Logger) (*accessLog, error) {
+	l := &accessLog{path: path, maxSize: maxSize, maxFiles: maxFiles, logger: logger}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the current file for appending
+func (l *accessLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// write appends an entry, rotating the file first if it would exceed maxSize
+func (l *accessLog) write(entry accessLogEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		l.logger.Error("Failed to encode access log entry", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			l.logger.Error("Failed to rotate access log", "path", l.path, "error", err)
+			if l.file == nil {
+				return
+			}
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		l.logger.Error("Failed to write access log", "path", l.path, "error", err)
+	}
+}
+
+// rotate shifts the rotated files by one, dropping the oldest, and starts a
+// new current file
+func (l *accessLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		l.logger.Warn("Failed to close access log", "path", l.path, "error", err)
+	}
+	l.file = nil
+
+	rotated := func(i int) string { return fmt.Sprintf("%s.%d", l.path, i) }
+	if l.maxFiles == 0 {
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		if err := os.Remove(rotated(l.maxFiles)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for i := l.maxFiles - 1; i >= 1; i-- {
+			if err := os.Rename(rotated(i), rotated(i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(l.path, rotated(1)); err != nil {
+			return err
+		}
+	}
+	l.logger.Info("Rotated access log", "path", l.path, "max_files", l.maxFiles)
+	return l.open()
+}
+
+// close closes the current file; later entries are dropped
+func (l *accessLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// accessLogEntry builds the access log entry of a signing request
+func (ca *MockCA) accessLogEntry(r *http.Request, body []byte, status int, duration time.Duration) accessLogEntry {
+	entry := accessLogEntry{
+		Time:         ca.clock.Now().UTC(),
+		RemoteAddr:   r.RemoteAddr,
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		UserAgent:    r.UserAgent(),
+		Client:       ca.clientIdentity(r),
+		Tenant:       recordedTenant(r),
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		Params:       redactParams(recordedParams(r, body)),
+		Status:       status,
+		DurationMS:   float64(duration.Microseconds()) / 1000,
+	}
+	if query := r.URL.Query(); len(query) > 0 {
+		for k := range query {
+			if strings.EqualFold(k, "password") {
+				query[k] = []string{"[redacted]"}
+			}
+		}
+		entry.Query = query
+	}
+	return entry
+}
+
+// clientIdentity identifies the client of a request without logging its
+// credentials: the username of basic auth, or a fingerprint of a bearer
+// token or the credential header
+func (ca *MockCA) clientIdentity(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	if v, ok := cutPrefixFold(authorization, "Basic "); ok {
+		if decoded, err := base64.StdEncoding.DecodeString(v); err == nil {
+			username, _, _ := strings.Cut(string(decoded), ":")
+			return "basic:" + username
+		}
+	}
+	if v, ok := cutPrefixFold(authorization, "Bearer "); ok && v != "" {
+		return "bearer:" + credentialFingerprint(v)
+	}
+	if name := ca.config.AuthHeaderName; name != "" {
+		if v := r.Header.Get(name); v != "" {
+			return "header:" + credentialFingerprint(v)
+		}
+	}
+	return ""
+}
+
+// credentialFingerprint returns a short SHA-256 fingerprint of a credential,
+// telling clients apart without revealing it
+func credentialFingerprint(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// redactParams replaces passwords, such as those of PKCS#12 output, in parsed parameters
+func redactParams(params map[string]any) map[string]any {
+	for k := range params {
+		if strings.EqualFold(k, "password") {
+			params[k] = "[redacted]"
+		}
+	}
+	return params
+}
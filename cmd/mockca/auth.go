@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// validateAuthConfig checks that the credentials required by the auth type are set
+func validateAuthConfig(config *Config) error {
+	switch config.AuthType {
+	case "", "none":
+	case "bearer":
+		if config.AuthToken == "" {
+			return fmt.Errorf("auth type bearer requires -auth-token")
+		}
+	case "basic":
+		if config.AuthUsername == "" || config.AuthPassword == "" {
+			return fmt.Errorf("auth type basic requires -auth-username and -auth-password")
+		}
+	case "header":
+		if config.AuthHeaderName == "" || config.AuthToken == "" {
+			return fmt.Errorf("auth type header requires -auth-header-name and -auth-token")
+		}
+	default:
+		return fmt.Errorf("unsupported auth type %q (supported: none, bearer, basic, header)", config.AuthType)
+	}
+	return nil
+}
+
+// requireAuth wraps a handler so it is only served to authenticated clients.
+// Missing credentials get 401 Unauthorized, wrong credentials 403 Forbidden.
+func (ca *MockCA) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	cfg := ca.config
+	if cfg.AuthType == "" || cfg.AuthType == "none" {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var presented, expected string
+		switch cfg.AuthType {
+		case "bearer":
+			if v, ok := cutPrefixFold(r.Header.Get("Authorization"), "Bearer "); ok {
+				presented = v
+			}
+			expected = cfg.AuthToken
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mockca"`)
+		case "basic":
+			// Compare the encoded form, which is what the controller sends
+			if v, ok := cutPrefixFold(r.Header.Get("Authorization"), "Basic "); ok {
+				presented = v
+			}
+			expected = base64.StdEncoding.EncodeToString([]byte(cfg.AuthUsername + ":" + cfg.AuthPassword))
+			w.Header().Set("WWW-Authenticate", `Basic realm="mockca"`)
+		case "header":
+			presented = r.Header.Get(cfg.AuthHeaderName)
+			expected = cfg.AuthToken
+		}
+
+		if presented == "" {
+			ca.sendError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required", fmt.Sprintf("auth type %s", cfg.AuthType))
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(expected)) != 1 {
+			ca.sendError(w, http.StatusForbidden, "FORBIDDEN", "Invalid credentials", "")
+			return
+		}
+
+		w.Header().Del("WWW-Authenticate")
+		next(w, r)
+	}
+}
+
+// cutPrefixFold removes a case-insensitive prefix such as an auth scheme
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(s[len(prefix):]), true
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// issuingCA is a CA hierarchy certificates are signed with. Besides the
+// default CA, -cas adds named CAs with their own roots, so one server can
+// stand in for PKIs with distinct trust chains.
+type issuingCA struct {
+	// name selects the CA in requests; empty for the default CA
+	name string
+	// caCert and caKey are the issuing CA (the intermediate in intermediate chain mode)
+	caCert *x509.Certificate
+	caKey  *rsa.PrivateKey
+	// rootCert and rootKey are the root CA, which signs subordinate CAs
+	rootCert *x509.Certificate
+	rootKey  *rsa.PrivateKey
+	// rootPEM is the root CA certificate
+	rootPEM []byte
+	// chainPEM is the CA chain appended after issued leaves: issuing CA up to the root
+	chainPEM []byte
+	// crlNumber is the number of the last CRL signed
+	crlNumber atomic.Int64
+	// subjectDefaults fill attributes missing from requested subjects (tenants only)
+	subjectDefaults pkix.Name
+	// certValidityDays replaces -cert-validity when set (tenants only)
+	certValidityDays int
+	// generation counts the rotations of the CA by /admin/rotate-ca; rotated
+	// CAs have it appended to their names, e.g. "Mock CA G2"
+	generation int
+	// crossPEM is the root cross-signed by the root it replaced in
+	// /admin/rotate-ca, served with previousRootPEM until crossSignedUntil
+	crossPEM         []byte
+	previousRootPEM  []byte
+	crossSignedUntil time.Time
+}
+
+// caCommonNames returns the common names of the root and intermediate CA of
+// a CA hierarchy; named CAs get the name appended
+func caCommonNames(config *Config, name string) (string, string) {
+	if name == "" {
+		return config.CACN, config.IntermediateCN
+	}
+	return config.CACN + " " + name, config.IntermediateCN + " " + name
+}
+
+// newIssuingCA generates a CA hierarchy in the configured chain mode
+func newIssuingCA(logger *slog.Logger, random io.Reader, config *Config, name, rootCN, intermediateCN string, notBefore time.Time) (*issuingCA, error) {
+	rootSubject := pkix.Name{
+		CommonName:   rootCN,
+		Organization: []string{config.CAOrg},
+	}
+	// A path length of 2 leaves room for the intermediate below a root
+	// cross-signed when the CA is rotated
+	rootCert, rootKey, rootPEM, err := generateCA(logger, random, rootSubject, notBefore, config.CAValidityYrs, 2, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	issuingCert, issuingKey, chainPEM := rootCert, rootKey, rootPEM
+
+	switch config.ChainMode {
+	case "", "root":
+	case "intermediate":
+		intermediateSubject := pkix.Name{
+			CommonName:   intermediateCN,
+			Organization: []string{config.CAOrg},
+		}
+		var intermediatePEM []byte
+		issuingCert, issuingKey, intermediatePEM, err = generateCA(logger, random, intermediateSubject, notBefore, config.CAValidityYrs, 0, rootCert, rootKey)
+		if err != nil {
+			return nil, err
+		}
+		chainPEM = append(append([]byte{}, intermediatePEM...), rootPEM...)
+	default:
+		return nil, fmt.Errorf("unsupported chain mode %q (supported: root, intermediate)", config.ChainMode)
+	}
+
+	logger.Info("Mock CA initialized successfully",
+		"name", name,
+		"chain_mode", config.ChainMode,
+		"ca_subject", issuingCert.Subject.String(),
+		"ca_serial", issuingCert.SerialNumber.String(),
+		"ca_not_before", issuingCert.NotBefore.Format(time.RFC3339),
+		"ca_not_after", issuingCert.NotAfter.Format(time.RFC3339),
+		"root_subject", rootCert.Subject.String(),
+	)
+
+	return &issuingCA{
+		name:       name,
+		generation: 1,
+		caCert:     issuingCert,
+		caKey:      issuingKey,
+		rootCert:   rootCert,
+		rootKey:    rootKey,
+		rootPEM:    rootPEM,
+		chainPEM:   chainPEM,
+	}, nil
+}
+
+// validityDays returns the default validity of certificates the CA issues
+func (issuer *issuingCA) validityDays(configured int) int {
+	if issuer.certValidityDays > 0 {
+		return issuer.certValidityDays
+	}
+	return configured
+}
+
+// subject returns a requested subject with the attributes it lacks taken
+// from the CA's subject defaults
+func (issuer *issuingCA) subject(requested pkix.Name) pkix.Name {
+	defaults := issuer.subjectDefaults
+	fill := func(values, fallback []string) []string {
+		if len(values) > 0 {
+			return values
+		}
+		return fallback
+	}
+	requested.Organization = fill(requested.Organization, defaults.Organization)
+	requested.OrganizationalUnit = fill(requested.OrganizationalUnit, defaults.OrganizationalUnit)
+	requested.Country = fill(requested.Country, defaults.Country)
+	requested.Province = fill(requested.Province, defaults.Province)
+	requested.Locality = fill(requested.Locality, defaults.Locality)
+	return requested
+}
+
+// subjectRDNs is subject for a DN parsed from a legacy request, keeping its
+// RDN order and multi-valued RDNs; defaults go before the requested RDNs
+func (issuer *issuingCA) subjectRDNs(requested pkix.RDNSequence) pkix.RDNSequence {
+	name := subjectName(requested)
+	defaults := issuer.subjectDefaults
+	var rdns pkix.RDNSequence
+	fill := func(key string, values, fallback []string) {
+		if len(values) > 0 {
+			return
+		}
+		for _, v := range fallback {
+			rdns = append(rdns, pkix.RelativeDistinguishedNameSET{{Type: dnAttributeTypes[key], Value: v}})
+		}
+	}
+	fill("C", name.Country, defaults.Country)
+	fill("ST", name.Province, defaults.Province)
+	fill("L", name.Locality, defaults.Locality)
+	fill("O", name.Organization, defaults.Organization)
+	fill("OU", name.OrganizationalUnit, defaults.OrganizationalUnit)
+	return append(rdns, requested...)
+}
+
+// selectCA returns the CA named in a request, the default CA if none is
+// named. Requests of a tenant are always signed by the tenant's CA.
+func (ca *MockCA) selectCA(r *http.Request, name string) (*issuingCA, error) {
+	t := requestTenant(r)
+	if t != nil && name != "" {
+		return nil, fmt.Errorf("tenant %s has a single CA, got %q", t.Name, name)
+	}
+
+	ca.caMu.RLock()
+	var issuer *issuingCA
+	switch {
+	case t != nil:
+		issuer = t.ca
+	case name == "":
+		issuer = ca.issuingCA
+	default:
+		issuer = ca.cas[name]
+	}
+	ca.caMu.RUnlock()
+
+	if issuer == nil {
+		return nil, fmt.Errorf("unknown CA %q (configured: %v)", name, ca.caNames())
+	}
+	return issuer, nil
+}
+
+// caNames returns the names of the additional CAs, sorted
+func (ca *MockCA) caNames() []string {
+	ca.caMu.RLock()
+	defer ca.caMu.RUnlock()
+	names := make([]string, 0, len(ca.cas))
+	for name := range ca.cas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requestedCA returns the CA a signing request names in the -ca-param query
+// parameter, form field or JSON field
+func (ca *MockCA) requestedCA(r *http.Request, body []byte) (*issuingCA, error) {
+	param := ca.config.CAParam
+	name := r.URL.Query().Get(param)
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case name != "":
+	case strings.Contains(contentType, "application/json"):
+		var fields map[string]any
+		if err := json.Unmarshal(body, &fields); err == nil {
+			if v, ok := fields[param].(string); ok {
+				name = v
+			}
+		}
+	case strings.Contains(contentType, "application/x-www-form-urlencoded"):
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			name = values.Get(param)
+		}
+	}
+	return ca.selectCA(r, name)
+}
+
+// queryCA returns the CA named in the -ca-param query parameter of a CA,
+// chain or CRL download, writing an error response if it is unknown
+func (ca *MockCA) queryCA(w http.ResponseWriter, r *http.Request) (*issuingCA, bool) {
+	issuer, err := ca.selectCA(r, r.URL.Query().Get(ca.config.CAParam))
+	if err != nil {
+		ca.sendError(w, http.StatusBadRequest, "UNKNOWN_CA", "Unknown CA", err.Error())
+		return nil, false
+	}
+	return issuer, true
+}
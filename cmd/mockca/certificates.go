@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/revocation"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// issuedCert records a certificate issued by the Mock CA
+type issuedCert struct {
+	Cert     *x509.Certificate
+	CertPEM  []byte
+	IssuedAt time.Time
+	// LastUsed is when the certificate was issued or last retrieved
+	LastUsed time.Time
+}
+
+// CertificateInfo describes an issued certificate in API responses
+type CertificateInfo struct {
+	SerialNumber   string   `json:"serial_number"`
+	Subject        string   `json:"subject"`
+	Issuer         string   `json:"issuer"`
+	DNSNames       []string `json:"dns_names,omitempty"`
+	IPAddresses    []string `json:"ip_addresses,omitempty"`
+	URIs           []string `json:"uris,omitempty"`
+	EmailAddresses []string `json:"email_addresses,omitempty"`
+	NotBefore      string   `json:"not_before"`
+	NotAfter       string   `json:"not_after"`
+	IssuedAt       string   `json:"issued_at"`
+	RevokedAt      string   `json:"revoked_at,omitempty"`
+	// RevocationReason is the RFC 5280 reason of the revocation, e.g. certificateHold
+	RevocationReason string `json:"revocation_reason,omitempty"`
+	Certificate      string `json:"certificate,omitempty"`
+}
+
+// RevokeRequest is the optional body of a revocation request
+type RevokeRequest struct {
+	// Reason is an RFC 5280 reason name or code; certificateHold suspends the
+	// certificate and removeFromCRL releases it
+	Reason string `json:"reason,omitempty"`
+}
+
+// RevocationListResponse lists all revocation records, including those of
+// certificates evicted from the store
+type RevocationListResponse struct {
+	Items []revocationRecord `json:"items"`
+}
+
+// CertificateListResponse is a page of issued certificates
+type CertificateListResponse struct {
+	Items  []CertificateInfo `json:"items"`
+	Total  int               `json:"total"`
+	Limit  int               `json:"limit"`
+	Offset int               `json:"offset"`
+	// NextOffset is set when more certificates are available
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+// info converts an issued certificate into its API representation
+func (c *issuedCert) info(includePEM bool) CertificateInfo {
+	info := CertificateInfo{
+		SerialNumber:   c.Cert.SerialNumber.String(),
+		Subject:        c.Cert.Subject.String(),
+		Issuer:         c.Cert.Issuer.String(),
+		DNSNames:       c.Cert.DNSNames,
+		EmailAddresses: c.Cert.EmailAddresses,
+		NotBefore:      c.Cert.NotBefore.Format(time.RFC3339),
+		NotAfter:       c.Cert.NotAfter.Format(time.RFC3339),
+		IssuedAt:       c.IssuedAt.Format(time.RFC3339),
+	}
+	for _, ip := range c.Cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, uri := range c.Cert.URIs {
+		info.URIs = append(info.URIs, uri.String())
+	}
+	if includePEM {
+		info.Certificate = string(c.CertPEM)
+	}
+	return info
+}
+
+// handleCertificates serves the issued certificates collection
+//
+//	GET    /api/v1/certificates?limit=50&offset=0 - List issued certificates (oldest first)
+//	DELETE /api/v1/certificates                   - Delete all issued certificates and revocation records
+func (ca *MockCA) handleCertificates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		limit, err := queryInt(r, "limit", defaultListLimit)
+		if err != nil || limit <= 0 {
+			ca.sendError(w, http.StatusBadRequest, "INVALID_PARAMETER", "limit must be a positive integer", "")
+			return
+		}
+		if limit > maxListLimit {
+			limit = maxListLimit
+		}
+		offset, err := queryInt(r, "offset", 0)
+		if err != nil || offset < 0 {
+			ca.sendError(w, http.StatusBadRequest, "INVALID_PARAMETER", "offset must be a non-negative integer", "")
+			return
+		}
+
+		certs := ca.store.list()
+
+		response := CertificateListResponse{
+			Items:  []CertificateInfo{},
+			Total:  len(certs),
+			Limit:  limit,
+			Offset: offset,
+		}
+		for i := offset; i < len(certs) && i < offset+limit; i++ {
+			response.Items = append(response.Items, ca.certificateInfo(certs[i], false))
+		}
+		if next := offset + limit; next < len(certs) {
+			response.NextOffset = &next
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodDelete:
+		count := ca.store.clear()
+		ca.logger.Info("Deleted all issued certificates", "count", count)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		ca.sendError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only GET and DELETE methods are supported", "")
+	}
+}
+
+// handleCertificate serves a single issued certificate by serial number
+//
+//	GET    /api/v1/certificates/{serial} - Get certificate details including PEM
+//	DELETE /api/v1/certificates/{serial} - Delete the certificate
+func (ca *MockCA) handleCertificate(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+	stored, exists := ca.store.get(serial)
+	if !exists {
+		ca.sendError(w, http.StatusNotFound, "NOT_FOUND", "Certificate not found", serial)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ca.certificateInfo(stored, true))
+
+	case http.MethodDelete:
+		ca.store.delete(serial)
+		ca.logger.Info("Deleted issued certificate", "serial", serial)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		ca.sendError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only GET and DELETE methods are supported", "")
+	}
+}
+
+// certificateInfo converts an issued certificate into its API representation,
+// including its revocation
+func (ca *MockCA) certificateInfo(c *issuedCert, includePEM bool) CertificateInfo {
+	info := c.info(includePEM)
+	if record, revoked := ca.store.revocation(info.SerialNumber); revoked {
+		info.RevokedAt = record.RevokedAt.Format(time.RFC3339)
+		info.RevocationReason = record.Reason
+	}
+	return info
+}
+
+// handleRevoke revokes an issued certificate
+//
+//	POST /api/v1/certificates/{serial}/revoke - Revoke the certificate, optionally with {"reason": "..."}
+//
+// Reason certificateHold puts the certificate on hold; it can be revoked for
+// good later. Reason removeFromCRL releases a held certificate.
+func (ca *MockCA) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ca.sendError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is supported", "")
+		return
+	}
+
+	var req RevokeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			ca.sendError(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to parse request body", err.Error())
+			return
+		}
+	}
+
+	var reason string
+	var code int
+	if req.Reason != "" {
+		var err error
+		if reason, code, err = revocation.Parse(req.Reason); err != nil {
+			ca.sendError(w, http.StatusBadRequest, "INVALID_REASON", "Invalid revocation reason", err.Error())
+			return
+		}
+	}
+
+	serial := r.PathValue("serial")
+	if reason == revocation.RemoveFromCRL {
+		ca.unhold(w, serial)
+		return
+	}
+	record, found := ca.store.revoke(serial, reason, code)
+	if !found {
+		ca.sendError(w, http.StatusNotFound, "NOT_FOUND", "Certificate not found", serial)
+		return
+	}
+	ca.logger.Info("Revoked certificate", "serial", serial, "reason", record.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// handleUnhold releases a certificate on hold
+//
+//	POST /api/v1/certificates/{serial}/unhold - Release the certificate from hold
+func (ca *MockCA) handleUnhold(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ca.sendError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is supported", "")
+		return
+	}
+	ca.unhold(w, r.PathValue("serial"))
+}
+
+// unhold releases a held certificate and answers with its former revocation record
+func (ca *MockCA) unhold(w http.ResponseWriter, serial string) {
+	record, held, found := ca.store.unhold(serial)
+	switch {
+	case !found:
+		ca.sendError(w, http.StatusNotFound, "NOT_FOUND", "Certificate not found", serial)
+		return
+	case !held:
+		ca.sendError(w, http.StatusConflict, "NOT_HELD", "Certificate is not on hold", serial)
+		return
+	}
+	ca.logger.Info("Released certificate from hold", "serial", serial)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// handleRevocations lists revocation records
+//
+//	GET /api/v1/revocations - List all revocations, oldest first
+func (ca *MockCA) handleRevocations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ca.sendError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only GET method is supported", "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RevocationListResponse{Items: ca.store.revocations()})
+}
+
+// queryInt reads an integer query parameter, returning def when absent
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
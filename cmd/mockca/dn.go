@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// dnAttributeTypes maps the attribute type names accepted in subject DNs,
+// upper-cased, to their OIDs
+var dnAttributeTypes = map[string]asn1.ObjectIdentifier{
+	"CN":           {2, 5, 4, 3},
+	"SERIALNUMBER": {2, 5, 4, 5},
+	"C":            {2, 5, 4, 6},
+	"L":            {2, 5, 4, 7},
+	"ST":           {2, 5, 4, 8},
+	"STREET":       {2, 5, 4, 9},
+	"O":            {2, 5, 4, 10},
+	"OU":           {2, 5, 4, 11},
+	"POSTALCODE":   {2, 5, 4, 17},
+	"UID":          {0, 9, 2342, 19200300, 100, 1, 1},
+	"DC":           {0, 9, 2342, 19200300, 100, 1, 25},
+	"EMAILADDRESS": {1, 2, 840, 113549, 1, 9, 1},
+	"EMAIL":        {1, 2, 840, 113549, 1, 9, 1},
+	"E":            {1, 2, 840, 113549, 1, 9, 1},
+}
+
+// ia5AttributeTypes are encoded as IA5String, as RFC 4519 and PKCS #9 define
+var ia5AttributeTypes = []asn1.ObjectIdentifier{dnAttributeTypes["DC"], dnAttributeTypes["EMAILADDRESS"]}
+
+// attributeKeyword matches the syntax of an attribute type name or dotted OID
+var attributeKeyword = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9-]*|(OID\.|oid\.)?[0-2](\.(0|[1-9][0-9]*))+)$`)
+
+// dnSegment is an attribute of a DN before its value is unescaped
+type dnSegment struct {
+	// rdnStart is set for the first attribute of an RDN, unset for the others
+	// of a multi-valued RDN
+	rdnStart bool
+	key      string
+	rawValue string
+}
+
+// parseDN parses a subject DN in the slash format of OpenSSL's -subj
+// (/C=US/O=Example/CN=example.com, most general attribute first) or in the
+// comma format of RFC 4514 (CN=example.com,O=Example,C=US, most specific
+// first). Separators and special characters in values are escaped with a
+// backslash, and "+" joins the attributes of a multi-valued RDN. Separators
+// not followed by an attribute, as in O=Acme/Engineering, are kept in the
+// value, so legacy clients that don't escape them keep working.
+// The RDNs are returned in the order of the certificate, most general first.
+func parseDN(dn string) (pkix.RDNSequence, error) {
+	dn = trimUnescaped(dn)
+	slash := strings.HasPrefix(dn, "/")
+	var segments []dnSegment
+	if slash {
+		segments = splitDN(dn[1:], '/')
+	} else {
+		segments = splitDN(dn, ',')
+	}
+
+	var rdns pkix.RDNSequence
+	for _, segment := range segments {
+		atv, err := parseAttribute(segment, slash)
+		if err != nil {
+			return nil, err
+		}
+		if segment.rdnStart || len(rdns) == 0 {
+			rdns = append(rdns, pkix.RelativeDistinguishedNameSET{atv})
+		} else {
+			rdns[len(rdns)-1] = append(rdns[len(rdns)-1], atv)
+		}
+	}
+	if !slash {
+		// RFC 4514 lists the RDNs in reverse order
+		for i, j := 0, len(rdns)-1; i < j; i, j = i+1, j-1 {
+			rdns[i], rdns[j] = rdns[j], rdns[i]
+		}
+	}
+	return rdns, nil
+}
+
+// splitDN splits a DN at its unescaped separators and "+" into attributes.
+// Text between separators that doesn't start with an attribute type and "="
+// belongs to the value of the previous attribute.
+func splitDN(dn string, separator byte) []dnSegment {
+	var segments []dnSegment
+	start, rdnStart := 0, true
+	quoted := false
+	add := func(end int, next bool) {
+		text := dn[start:end]
+		key, value, ok := cutAttribute(text)
+		switch {
+		case ok:
+			segments = append(segments, dnSegment{rdnStart: rdnStart, key: key, rawValue: value})
+		case len(segments) > 0:
+			// The separator before the text was part of the previous value
+			last := &segments[len(segments)-1]
+			last.rawValue += string(dn[start-1]) + text
+		case strings.TrimSpace(text) != "":
+			segments = append(segments, dnSegment{rdnStart: rdnStart, rawValue: text})
+		}
+		rdnStart = next
+	}
+	for i := 0; i < len(dn); i++ {
+		switch c := dn[i]; {
+		case c == '\\':
+			i++
+		case c == '"' && separator == ',':
+			quoted = !quoted
+		case quoted:
+		case c == separator, c == '+':
+			add(i, c == separator)
+			start = i + 1
+		}
+	}
+	add(len(dn), true)
+	return segments
+}
+
+// cutAttribute splits "type=value" at the first "=", if type is the syntax
+// of an attribute type
+func cutAttribute(text string) (string, string, bool) {
+	key, value, ok := strings.Cut(text, "=")
+	key = strings.TrimSpace(key)
+	if !ok || !attributeKeyword.MatchString(key) {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+// parseAttribute returns the type and value of an attribute of a DN
+func parseAttribute(segment dnSegment, slash bool) (pkix.AttributeTypeAndValue, error) {
+	if segment.key == "" {
+		return pkix.AttributeTypeAndValue{}, fmt.Errorf("invalid DN attribute %q: expected type=value", strings.TrimSpace(segment.rawValue))
+	}
+	oid, err := attributeType(segment.key)
+	if err != nil {
+		return pkix.AttributeTypeAndValue{}, err
+	}
+
+	raw := trimUnescaped(segment.rawValue)
+	if strings.HasPrefix(raw, "#") {
+		// A hex-encoded BER value, as RFC 4514 section 2.4 allows
+		value, err := parseHexValue(raw[1:], isNamedType(oid))
+		if err == nil {
+			return pkix.AttributeTypeAndValue{Type: oid, Value: value}, nil
+		}
+		if !slash {
+			return pkix.AttributeTypeAndValue{}, fmt.Errorf("invalid value of DN attribute %s: %w", segment.key, err)
+		}
+	}
+	value, err := unescapeDNValue(raw, !slash)
+	if err != nil {
+		return pkix.AttributeTypeAndValue{}, fmt.Errorf("invalid value of DN attribute %s: %w", segment.key, err)
+	}
+	return pkix.AttributeTypeAndValue{Type: oid, Value: encodeDNValue(oid, value)}, nil
+}
+
+// attributeType returns the OID of an attribute type name or dotted OID
+func attributeType(key string) (asn1.ObjectIdentifier, error) {
+	if oid, ok := dnAttributeTypes[strings.ToUpper(key)]; ok {
+		return oid, nil
+	}
+	dotted := strings.TrimPrefix(strings.TrimPrefix(key, "OID."), "oid.")
+	if dotted[0] < '0' || dotted[0] > '2' {
+		return nil, fmt.Errorf("unsupported DN attribute type %q", key)
+	}
+	var oid asn1.ObjectIdentifier
+	for _, arc := range strings.Split(dotted, ".") {
+		var n int
+		if _, err := fmt.Sscan(arc, &n); err != nil {
+			return nil, fmt.Errorf("invalid DN attribute type %q", key)
+		}
+		oid = append(oid, n)
+	}
+	return oid, nil
+}
+
+// parseHexValue decodes the value of "#<hex>", a single BER-encoded ASN.1
+// value. String values of named types are returned as strings, so pkix.Name
+// picks them up, others in their encoding.
+func parseHexValue(h string, named bool) (any, error) {
+	der, err := hex.DecodeString(h)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex value: %w", err)
+	}
+	var raw asn1.RawValue
+	if rest, err := asn1.Unmarshal(der, &raw); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("hex value is not a single ASN.1 value")
+	}
+	var s string
+	if _, err := asn1.Unmarshal(der, &s); err == nil && named {
+		return s, nil
+	}
+	return raw, nil
+}
+
+// isNamedType reports whether an attribute type has a name in dnAttributeTypes
+func isNamedType(oid asn1.ObjectIdentifier) bool {
+	for _, t := range dnAttributeTypes {
+		if t.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// trimUnescaped trims the spaces around a raw value, except escaped ones
+func trimUnescaped(raw string) string {
+	raw = strings.TrimLeft(raw, " ")
+	for strings.HasSuffix(raw, " ") {
+		escapes := len(raw) - 1 - len(strings.TrimRight(raw[:len(raw)-1], `\`))
+		if escapes%2 == 1 {
+			break
+		}
+		raw = raw[:len(raw)-1]
+	}
+	return raw
+}
+
+// unescapeDNValue resolves the backslash escapes of a value: "\" followed by
+// a character stands for the character, and in RFC 4514 DNs "\" followed by
+// two hex digits for a byte of the UTF-8 encoding. Quotes around a value of
+// an RFC 4514 DN, a form of RFC 1779, are removed.
+func unescapeDNValue(raw string, rfc4514 bool) (string, error) {
+	if rfc4514 && len(raw) >= 2 && strings.HasPrefix(raw, `"`) && strings.HasSuffix(raw, `"`) {
+		raw = raw[1 : len(raw)-1]
+	}
+	var b []byte
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			b = append(b, raw[i])
+			continue
+		}
+		i++
+		if i == len(raw) {
+			return "", fmt.Errorf("trailing backslash")
+		}
+		if rfc4514 && i+1 < len(raw) && isHex(raw[i]) && isHex(raw[i+1]) {
+			decoded, _ := hex.DecodeString(raw[i : i+2])
+			b = append(b, decoded...)
+			i++
+			continue
+		}
+		b = append(b, raw[i])
+	}
+	if !utf8.Valid(b) {
+		return "", fmt.Errorf("value is not valid UTF-8")
+	}
+	return string(b), nil
+}
+
+// isHex reports whether c is a hex digit
+func isHex(c byte) bool {
+	return strings.IndexByte("0123456789abcdefABCDEF", c) >= 0
+}
+
+// encodeDNValue returns the value of an attribute to marshal: IA5String for
+// the types defined as such, otherwise a string that encoding/asn1 marshals
+// as PrintableString where possible and UTF8String otherwise
+func encodeDNValue(oid asn1.ObjectIdentifier, value string) any {
+	for _, t := range ia5AttributeTypes {
+		if t.Equal(oid) && isASCII(value) {
+			return asn1.RawValue{Tag: asn1.TagIA5String, Bytes: []byte(value)}
+		}
+	}
+	return value
+}
+
+// isASCII reports whether s holds ASCII characters only
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// subjectName returns the attributes of a parsed DN as pkix.Name fields
+func subjectName(rdns pkix.RDNSequence) pkix.Name {
+	var name pkix.Name
+	name.FillFromRDNSequence(&rdns)
+	return name
+}
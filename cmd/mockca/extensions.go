@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"slices"
+)
+
+// Modes of -csr-extensions
+const (
+	// csrExtensionsPermissive issues the usages and non-critical extensions the CSR requests
+	csrExtensionsPermissive = "permissive"
+	// csrExtensionsStrict honors requested usages the profile allows and rejects the rest
+	csrExtensionsStrict = "strict"
+	// csrExtensionsIgnore issues the profile's usages, as before CSR extensions were honored
+	csrExtensionsIgnore = "ignore"
+)
+
+var (
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// extKeyUsageOIDs maps the extended key usages Go knows to their OIDs
+var extKeyUsageOIDs = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+	x509.ExtKeyUsageAny:                            {2, 5, 29, 37, 0},
+	x509.ExtKeyUsageServerAuth:                     {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	x509.ExtKeyUsageClientAuth:                     {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	x509.ExtKeyUsageCodeSigning:                    {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	x509.ExtKeyUsageEmailProtection:                {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	x509.ExtKeyUsageIPSECEndSystem:                 {1, 3, 6, 1, 5, 5, 7, 3, 5},
+	x509.ExtKeyUsageIPSECTunnel:                    {1, 3, 6, 1, 5, 5, 7, 3, 6},
+	x509.ExtKeyUsageIPSECUser:                      {1, 3, 6, 1, 5, 5, 7, 3, 7},
+	x509.ExtKeyUsageTimeStamping:                   {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	x509.ExtKeyUsageOCSPSigning:                    {1, 3, 6, 1, 5, 5, 7, 3, 9},
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     {1, 3, 6, 1, 4, 1, 311, 10, 3, 3},
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      {2, 16, 840, 1, 113730, 4, 1},
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: {1, 3, 6, 1, 4, 1, 311, 2, 1, 22},
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     {1, 3, 6, 1, 4, 1, 311, 61, 1, 1},
+}
+
+// certUsages are the key usages and extensions of an issued certificate
+type certUsages struct {
+	keyUsage           x509.KeyUsage
+	extKeyUsage        []x509.ExtKeyUsage
+	unknownExtKeyUsage []asn1.ObjectIdentifier
+	// extra are custom extensions copied from the CSR
+	extra []pkix.Extension
+}
+
+// usagesFor returns the usages to issue a CSR with under the -csr-extensions
+// mode. Usages the CSR doesn't request come from the profile. An error means
+// the request must be rejected.
+func (ca *MockCA) usagesFor(csr *x509.CertificateRequest, profile *certProfile) (*certUsages, error) {
+	usages := &certUsages{keyUsage: profile.KeyUsage, extKeyUsage: profile.ExtKeyUsage}
+	mode := ca.config.CSRExtensions
+	if mode == csrExtensionsIgnore {
+		return usages, nil
+	}
+	strict := mode == csrExtensionsStrict
+
+	for _, ext := range csr.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			var bits asn1.BitString
+			if _, err := asn1.Unmarshal(ext.Value, &bits); err != nil {
+				return nil, fmt.Errorf("invalid key usage extension: %w", err)
+			}
+			var requested x509.KeyUsage
+			for i := 0; i < bits.BitLength; i++ {
+				if bits.At(i) != 0 {
+					requested |= 1 << i
+				}
+			}
+			if strict && requested&^profile.KeyUsage != 0 {
+				return nil, fmt.Errorf("key usage %#x is not allowed by profile %s (allowed: %#x)", int(requested), profile.Name, int(profile.KeyUsage))
+			}
+			if requested != 0 {
+				usages.keyUsage = requested
+			}
+		case ext.Id.Equal(oidExtensionExtendedKeyUsage):
+			var oids []asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(ext.Value, &oids); err != nil {
+				return nil, fmt.Errorf("invalid extended key usage extension: %w", err)
+			}
+			usages.extKeyUsage = nil
+			for _, oid := range oids {
+				eku, known := extKeyUsage(oid)
+				if strict && (!known || !slices.Contains(profile.ExtKeyUsage, eku)) {
+					return nil, fmt.Errorf("extended key usage %s is not allowed by profile %s", oid, profile.Name)
+				}
+				if known {
+					usages.extKeyUsage = append(usages.extKeyUsage, eku)
+				} else {
+					usages.unknownExtKeyUsage = append(usages.unknownExtKeyUsage, oid)
+				}
+			}
+		case ext.Id.Equal(oidExtensionSubjectAltName), ext.Id.Equal(oidExtensionBasicConstraints):
+			// SANs are copied from the parsed CSR; the profile decides whether it is a CA
+		default:
+			if strict {
+				return nil, fmt.Errorf("extension %s is not allowed in strict mode", ext.Id)
+			}
+			if ext.Critical {
+				return nil, fmt.Errorf("critical extension %s is not supported", ext.Id)
+			}
+			usages.extra = append(usages.extra, ext)
+		}
+	}
+	return usages, nil
+}
+
+// extKeyUsage returns the extended key usage of an OID, if Go knows it
+func extKeyUsage(oid asn1.ObjectIdentifier) (x509.ExtKeyUsage, bool) {
+	for eku, known := range extKeyUsageOIDs {
+		if oid.Equal(known) {
+			return eku, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+)
+
+// Output formats of issued certificates, selected with the format request
+// parameter. Several real PKIs answer with DER or PKCS#7 rather than PEM,
+// which these let the signer's parsing of be tested against.
+const (
+	// formatJSON is the SignResponse of the signing endpoints (their default)
+	formatJSON = "json"
+	// formatPEM is the certificate chain, leaf first (default of /cgi/pki.cgi)
+	formatPEM = "pem"
+	// formatDER is the leaf certificate alone
+	formatDER = "der"
+	// formatPKCS7 is a certs-only PKCS#7 SignedData bundle of the chain
+	formatPKCS7 = "pkcs7"
+	// formatPKCS12 is a PKCS#12 file of the chain and, if the CA generated
+	// it, the key, protected by the password request parameter
+	formatPKCS12 = "pkcs12"
+)
+
+// formatContentTypes are the content types of the output formats
+var formatContentTypes = map[string]string{
+	formatJSON:   "application/json",
+	formatPEM:    "application/x-pem-file",
+	formatDER:    "application/pkix-cert",
+	formatPKCS7:  "application/pkcs7-mime",
+	formatPKCS12: "application/x-pkcs12",
+}
+
+// pkcs12Iterations is the iteration count of the PKCS#12 key derivations
+const pkcs12Iterations = 2048
+
+var (
+	oidData                          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData                    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEncryptedData                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidLocalKeyID                    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidX509Certificate               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidPBEWithSHAAnd3KeyTripleDESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidShroudedKeyBag                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag                       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidSHA1                          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+)
+
+// contentInfo is a PKCS#7 ContentInfo; Content is [0] EXPLICIT
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+// signedData is a PKCS#7 SignedData without signers
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+	Certificates     asn1.RawValue
+	SignerInfos      asn1.RawValue
+}
+
+// pfx is a PKCS#12 file (RFC 7292)
+type pfx struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data asn1.RawValue
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType      asn1.ObjectIdentifier
+	Algorithm        pkix.AlgorithmIdentifier
+	EncryptedContent []byte `asn1:"tag:0"`
+}
+
+// checkFormat rejects formats an endpoint doesn't support; json is only
+// supported by the endpoints answering with a SignResponse
+func checkFormat(format string, jsonSupported bool) error {
+	if _, ok := formatContentTypes[format]; !ok || (format == formatJSON && !jsonSupported) {
+		supported := "pem, der, pkcs7, pkcs12"
+		if jsonSupported {
+			supported = "json, " + supported
+		}
+		return fmt.Errorf("unsupported format %q (supported: %s)", format, supported)
+	}
+	return nil
+}
+
+// writeCertificates answers with a certificate chain, leaf first, in a
+// format other than json. key is only included in PKCS#12 files.
+func (ca *MockCA) writeCertificates(w http.ResponseWriter, format string, chainPEM []byte, key *rsa.PrivateKey, password string) error {
+	var certs [][]byte
+	for rest := chainPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		certs = append(certs, block.Bytes)
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("no certificate to encode")
+	}
+
+	var body []byte
+	var err error
+	switch format {
+	case formatPEM:
+		body = chainPEM
+	case formatDER:
+		body = certs[0]
+	case formatPKCS7:
+		body, err = encodePKCS7(certs)
+	case formatPKCS12:
+		body, err = encodePKCS12(ca.random, certs, key, password)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.Write(body)
+	return nil
+}
+
+// encodePKCS7 encodes certificates as a certs-only PKCS#7 SignedData bundle
+func encodePKCS7(certs [][]byte) ([]byte, error) {
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true},
+		ContentInfo:      struct{ ContentType asn1.ObjectIdentifier }{oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: joinDER(certs)},
+		SignerInfos:      asn1.RawValue{Tag: asn1.TagSet, IsCompound: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: explicitTag0(sd)})
+}
+
+// encodePKCS12 encodes certificates, leaf first, and an optional key as a
+// PKCS#12 file. Both are encrypted with pbeWithSHAAnd3-KeyTripleDES-CBC and
+// the file is integrity protected with an HMAC-SHA1, as by
+// "openssl pkcs12 -export -legacy", which every PKCS#12 reader supports.
+func encodePKCS12(random io.Reader, certs [][]byte, key *rsa.PrivateKey, password string) ([]byte, error) {
+	bmpPassword := bmpString(password)
+	leafID := sha1.Sum(certs[0])
+	localKeyID, err := pkcs12LocalKeyID(leafID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// The certificates are one encrypted SafeContents
+	var certBags []safeBag
+	for i, der := range certs {
+		octets, err := asn1.Marshal(der)
+		if err != nil {
+			return nil, err
+		}
+		bag, err := asn1.Marshal(certBag{ID: oidX509Certificate, Data: explicitTag0(octets)})
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, safeBag{ID: oidCertBag, Value: explicitTag0(bag)})
+		if i == 0 && key != nil {
+			certBags[0].Attributes = localKeyID
+		}
+	}
+	certContents, err := asn1.Marshal(certBags)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, encrypted, err := pbeEncrypt(random, bmpPassword, certContents)
+	if err != nil {
+		return nil, err
+	}
+	ed, err := asn1.Marshal(encryptedData{EncryptedContentInfo: encryptedContentInfo{
+		ContentType:      oidData,
+		Algorithm:        algorithm,
+		EncryptedContent: encrypted,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	authSafe := []contentInfo{{ContentType: oidEncryptedData, Content: explicitTag0(ed)}}
+
+	// The key is a shrouded key bag in a plain SafeContents
+	if key != nil {
+		pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		algorithm, encrypted, err := pbeEncrypt(random, bmpPassword, pkcs8)
+		if err != nil {
+			return nil, err
+		}
+		shrouded, err := asn1.Marshal(encryptedPrivateKeyInfo{Algorithm: algorithm, EncryptedData: encrypted})
+		if err != nil {
+			return nil, err
+		}
+		keyContents, err := asn1.Marshal([]safeBag{{ID: oidShroudedKeyBag, Value: explicitTag0(shrouded), Attributes: localKeyID}})
+		if err != nil {
+			return nil, err
+		}
+		octets, err := asn1.Marshal(keyContents)
+		if err != nil {
+			return nil, err
+		}
+		authSafe = append(authSafe, contentInfo{ContentType: oidData, Content: explicitTag0(octets)})
+	}
+
+	authSafeDER, err := asn1.Marshal(authSafe)
+	if err != nil {
+		return nil, err
+	}
+	macSalt := make([]byte, 8)
+	if _, err := io.ReadFull(random, macSalt); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha1.New, pkcs12KDF(bmpPassword, macSalt, 3, pkcs12Iterations, sha1.Size))
+	mac.Write(authSafeDER)
+
+	octets, err := asn1.Marshal(authSafeDER)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pfx{
+		Version:  3,
+		AuthSafe: contentInfo{ContentType: oidData, Content: explicitTag0(octets)},
+		MacData: macData{
+			Mac: digestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+				Digest:    mac.Sum(nil),
+			},
+			MacSalt:    macSalt,
+			Iterations: pkcs12Iterations,
+		},
+	})
+}
+
+// pkcs12LocalKeyID returns the attributes pairing the leaf certificate with its key
+func pkcs12LocalKeyID(id []byte) ([]pkcs12Attribute, error) {
+	octets, err := asn1.Marshal(id)
+	if err != nil {
+		return nil, err
+	}
+	return []pkcs12Attribute{{
+		ID:    oidLocalKeyID,
+		Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: octets},
+	}}, nil
+}
+
+// pbeEncrypt encrypts data with pbeWithSHAAnd3-KeyTripleDES-CBC and a fresh salt
+func pbeEncrypt(random io.Reader, bmpPassword, data []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	salt := make([]byte, 8)
+	if _, err := io.ReadFull(random, salt); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	params, err := asn1.Marshal(pbeParams{Salt: salt, Iterations: pkcs12Iterations})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	block, err := des.NewTripleDESCipher(pkcs12KDF(bmpPassword, salt, 1, pkcs12Iterations, 24))
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	iv := pkcs12KDF(bmpPassword, salt, 2, pkcs12Iterations, block.BlockSize())
+
+	// PKCS#7 padding
+	padding := block.BlockSize() - len(data)%block.BlockSize()
+	encrypted := append(append([]byte{}, data...), make([]byte, padding)...)
+	for i := len(data); i < len(encrypted); i++ {
+		encrypted[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	algorithm := pkix.AlgorithmIdentifier{Algorithm: oidPBEWithSHAAnd3KeyTripleDESCBC, Parameters: asn1.RawValue{FullBytes: params}}
+	return algorithm, encrypted, nil
+}
+
+// pkcs12KDF derives size bytes of key material for purpose id (1: key,
+// 2: IV, 3: MAC key) with SHA-1, as in RFC 7292 appendix B.2
+func pkcs12KDF(bmpPassword, salt []byte, id byte, iterations, size int) []byte {
+	const v = 64
+	fill := func(s []byte) []byte {
+		if len(s) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(s)+v-1)/v))
+		for i := range out {
+			out[i] = s[i%len(s)]
+		}
+		return out
+	}
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+	input := append(fill(salt), fill(bmpPassword)...)
+
+	var out []byte
+	for len(out) < size {
+		h := sha1.New()
+		h.Write(d)
+		h.Write(input)
+		a := h.Sum(nil)
+		for j := 1; j < iterations; j++ {
+			sum := sha1.Sum(a)
+			a = sum[:]
+		}
+		out = append(out, a...)
+
+		// Each block of the input is incremented by B + 1, B being A repeated
+		b := fill(a)[:v]
+		for j := 0; j < len(input); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(input[j+k]) + int(b[k]) + carry
+				input[j+k], carry = byte(sum), sum>>8
+			}
+		}
+	}
+	return out[:size]
+}
+
+// bmpString encodes a password as a NUL-terminated big-endian UTF-16 string
+func bmpString(s string) []byte {
+	var out []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(r>>8), byte(r))
+	}
+	return append(out, 0, 0)
+}
+
+// explicitTag0 wraps DER in a [0] EXPLICIT tag
+func explicitTag0(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+// joinDER concatenates DER encodings
+func joinDER(ders [][]byte) []byte {
+	var out []byte
+	for _, der := range ders {
+		out = append(out, der...)
+	}
+	return out
+}
+
+// requestFormat returns the format and PKCS#12 password named in the query
+// of a request, for bodies that cannot carry them
+func requestFormat(r *http.Request) (string, string) {
+	query := r.URL.Query()
+	return strings.ToLower(query.Get("format")), query.Get("password")
+}
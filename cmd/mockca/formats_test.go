@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+)
+
+// TestSignerParsesPKCS7 issues through the signer the controller uses
+// against the Mock CA answering with a DER PKCS#7 bundle, the format several
+// real PKIs use, so the signer's non-PEM parsing is covered end to end
+func TestSignerParsesPKCS7(t *testing.T) {
+	ca, _ := testMockCA(t)
+	server := httptest.NewServer(http.HandlerFunc(ca.handleSign))
+	defer server.Close()
+
+	s, err := signer.NewPKISigner(&signer.PKIConfig{
+		BaseURL: server.URL + "/api/v1/sign?format=pkcs7",
+		Method:  "POST",
+		Parameters: signer.PKIParameters{
+			ParamFormat: "json",
+			GetCSRParam: "csr",
+		},
+		Response: signer.PKIResponse{Format: "pkcs7"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "pkcs7.example.com"},
+		DNSNames: []string{"pkcs7.example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, caPEM, err := s.Sign(context.Background(), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatalf("no PEM certificate in %q", certPEM)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "pkcs7.example.com" {
+		t.Errorf("leaf certificate has DNS names %v, want the CSR's", cert.DNSNames)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		t.Fatalf("no CA certificate in %q", caPEM)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, CurrentTime: cert.NotBefore}); err != nil {
+		t.Errorf("leaf certificate doesn't verify against the returned chain: %v", err)
+	}
+}
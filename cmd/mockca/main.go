@@ -17,13 +17,33 @@
 //	-ca-org string    CA Organization (default "cert-manager-external-issuer")
 //	-ca-validity int  CA validity in years (default 10)
 //	-cert-validity int Default certificate validity in days (default 365)
+//	-cert-backdate duration How far NotBefore of issued certificates lies in the past (default 1m)
+//	-ca-backdate duration How far NotBefore of the CA certificates lies in the past (default 1h)
+//	-chain-mode string Issue from the root CA ("root") or a Root -> Intermediate hierarchy ("intermediate") (default "root")
+//	-intermediate-cn string Intermediate CA Common Name (default "External Issuer Mock Intermediate CA")
+//	-store-path string Persist issued certificates to this JSON file (default: in-memory only)
+//	-store-max-size int Maximum number of issued certificates kept, least recently used evicted first (default 0 = unlimited)
+//	-store-ttl duration How long issued certificates are kept (default 0 = forever)
+//	-store-flush-interval duration How often changes are written to -store-path; also written on shutdown (default 5s, 0 = after every change)
+//	-maintenance-schedule string Cron expression opening a maintenance window (e.g. "0 2 * * SUN")
+//	-maintenance-duration duration Length of each maintenance window (default 30m)
+//	-default-profile string Profile used when a request names none: server, client, code-signing, peer (default "peer")
+//	-auth-type string Require authentication on signing and certificate endpoints: none, bearer, basic, header (default "none")
+//	-auth-token string Expected bearer token or header value (auth-type=bearer|header)
+//	-auth-username string Expected basic auth username (auth-type=basic)
+//	-auth-password string Expected basic auth password (auth-type=basic)
+//	-auth-header-name string Header carrying the credential (auth-type=header, e.g. "X-API-Key")
+//	-version          Print build information and exit
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/json"
 	"encoding/pem"
 	"flag"
@@ -31,16 +51,22 @@ import (
 	"io"
 	"log/slog"
 	"math/big"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
-)
 
-var (
-	version = "1.0.0"
+	"github.com/bvorland/cert-manager-external-issuer/internal/cron"
+	"github.com/bvorland/cert-manager-external-issuer/internal/version"
+	"k8s.io/utils/clock"
 )
 
 // Config holds the server configuration
@@ -52,26 +78,115 @@ type Config struct {
 	CAOrg            string
 	CAValidityYrs    int
 	CertValidityDays int
+	CertBackdate     time.Duration
+	CABackdate       time.Duration
+	StorePath        string
+	StoreMaxSize     int
+	StoreTTL         time.Duration
+	// StoreFlushInterval is how often store changes are written to
+	// StorePath (0: after every change)
+	StoreFlushInterval time.Duration
+
+	ChainMode      string
+	IntermediateCN string
+
+	MaintenanceSchedule string
+	MaintenanceDuration time.Duration
+
+	DefaultProfile string
+
+	// PendingMode answers signing requests with 202 and an order ID; the
+	// certificate is available from /api/v1/orders/{id} after PendingDelay
+	PendingMode  bool
+	PendingDelay time.Duration
+
+	// CAs names additional CAs with their own roots; CAParam is the request
+	// parameter selecting one of them
+	CAs     []string
+	CAParam string
+
+	// URIParam is the request parameter carrying comma-separated URI SANs,
+	// such as SPIFFE IDs, of certificates built from request parameters;
+	// empty leaves them without URI SANs
+	URIParam string
+
+	// TenantsFile is a JSON file of tenants sharing the server, each with its
+	// own CA hierarchy; TenantKeyHeader carries the API key of a tenant
+	TenantsFile     string
+	TenantKeyHeader string
+
+	// RecordRequests is how many signing requests /admin/requests keeps (0: none)
+	RecordRequests int
+
+	// AccessLogPath is a JSONL file every signing request is appended to ("":
+	// none), rotated at AccessLogMaxSize bytes keeping AccessLogMaxFiles files
+	AccessLogPath     string
+	AccessLogMaxSize  int64
+	AccessLogMaxFiles int
+
+	// DenyNames are glob patterns of common and DNS names the CA refuses to
+	// certify; MaxCertValidity caps the validity of issued certificates (0: none)
+	DenyNames       []string
+	MaxCertValidity time.Duration
+
+	// CSRExtensions is how key usages and extensions requested in CSRs are
+	// honored: permissive (default), strict or ignore
+	CSRExtensions string
+
+	AuthType       string
+	AuthToken      string
+	AuthUsername   string
+	AuthPassword   string
+	AuthHeaderName string
+
+	// Clock supplies the current time for validity periods, the store TTL and
+	// maintenance windows; tests replace it with a fake clock (default: real clock)
+	Clock clock.Clock
+
+	// Seed makes serial numbers, keys and order IDs deterministic and, unless
+	// Clock is set, stops the clock at a fixed time, so the same requests get
+	// the same certificates on every run (0: random)
+	Seed int64
 }
 
 // MockCA holds the CA state
 type MockCA struct {
-	caCert    *x509.Certificate
-	caKey     *rsa.PrivateKey
-	caPEM     []byte
+	// issuingCA is the default CA, used when a request names none
+	*issuingCA
+	// cas are the additional CAs by name, selected with the -ca-param request parameter
+	cas map[string]*issuingCA
+	// caMu guards the default CA, the additional CAs and the tenants' CAs,
+	// which /admin/rotate-ca replaces; use selectCA to read them
+	caMu sync.RWMutex
+	// tenants are the teams sharing the server, loaded from -tenants
+	tenants   []*tenant
 	config    *Config
 	logger    *slog.Logger
-	signCount int64
-	// certStore stores issued certificates keyed by subject CN for retrieval
-	certStore map[string]*storedCert
+	signCount atomic.Int64
+	// requests keeps the most recent requests for the dashboard
+	requests *requestLog
+	// recorder keeps the last signing requests verbatim for /admin/requests
+	recorder *requestRecorder
+	// accessLog appends signing requests to -access-log (nil if disabled)
+	accessLog *accessLog
+	// orders holds signing requests accepted for delayed issuance
+	orders *orderBook
+	// store holds issued certificates by serial number and by subject CN for retrieval
+	store *certStore
+	// clock supplies the current time; started is when the server started
+	clock   clock.Clock
+	started time.Time
+	// random is the source of serial numbers, keys and order IDs, seeded by -seed
+	random io.Reader
 }
 
 // storedCert holds a certificate and its key for retrieval
 type storedCert struct {
-	CertPEM []byte
-	KeyPEM  []byte
-	CSR     []byte
-	Subject string
+	CertPEM []byte `json:"certificate"`
+	KeyPEM  []byte `json:"key,omitempty"`
+	CSR     []byte `json:"csr,omitempty"`
+	Subject string `json:"subject"`
+	Serial  string `json:"serial_number"`
 }
 
 // SignRequest represents a certificate signing request
@@ -79,6 +194,12 @@ type SignRequest struct {
 	CSR          string `json:"csr"`
 	ValidityDays int    `json:"validity_days,omitempty"`
 	CommonName   string `json:"common_name,omitempty"`
+	// Profile selects the certificate profile (server, client, code-signing, peer)
+	Profile string `json:"profile,omitempty"`
+	// Format selects the response format (json, pem, der, pkcs7, pkcs12);
+	// Password protects PKCS#12 responses
+	Format   string `json:"format,omitempty"`
+	Password string `json:"password,omitempty"`
 }
 
 // SignResponse represents a certificate signing response
@@ -90,6 +211,9 @@ type SignResponse struct {
 	NotBefore        string `json:"not_before"`
 	NotAfter         string `json:"not_after"`
 	Subject          string `json:"subject"`
+	Profile          string `json:"profile"`
+	// IssuingCA names the CA that signed the certificate; empty for the default CA
+	IssuingCA string `json:"issuing_ca,omitempty"`
 }
 
 // ErrorResponse represents an error response
@@ -101,49 +225,99 @@ type ErrorResponse struct {
 
 // HealthResponse represents a health check response
 type HealthResponse struct {
-	Status    string `json:"status"`
-	Version   string `json:"version"`
-	CA        string `json:"ca_subject"`
-	CAExpires string `json:"ca_expires"`
-	SignCount int64  `json:"certificates_signed"`
-	Uptime    string `json:"uptime"`
+	Status    string   `json:"status"`
+	Version   string   `json:"version"`
+	CA        string   `json:"ca_subject"`
+	CAExpires string   `json:"ca_expires"`
+	CAs       []string `json:"cas,omitempty"`
+	Tenant    string   `json:"tenant,omitempty"`
+	Tenants   []string `json:"tenants,omitempty"`
+	SignCount int64    `json:"certificates_signed"`
+	Uptime    string   `json:"uptime"`
 }
 
-var startTime = time.Now()
-
 func main() {
 	config := parseFlags()
 	logger := setupLogger(config)
 
+	buildInfo := version.Get()
 	logger.Info("Starting Mock CA Server",
-		"version", version,
+		"version", buildInfo.Version,
+		"commit", buildInfo.GitCommit,
+		"platform", buildInfo.Platform,
 		"addr", config.Addr,
 		"log_level", config.LogLevel,
 	)
 
+	if _, ok := certProfiles[config.DefaultProfile]; !ok {
+		logger.Error("Invalid default profile", "profile", config.DefaultProfile, "supported", profileNames())
+		os.Exit(1)
+	}
+	if err := validateAuthConfig(config); err != nil {
+		logger.Error("Invalid authentication configuration", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize the Mock CA
 	ca, err := NewMockCA(config, logger)
 	if err != nil {
 		logger.Error("Failed to initialize Mock CA", "error", err)
 		os.Exit(1)
 	}
+	if config.Seed != 0 {
+		logger.Warn("Deterministic mode enabled: serial numbers and keys are predictable and the clock is stopped",
+			"seed", config.Seed,
+			"time", ca.clock.Now().Format(time.RFC3339),
+		)
+	}
 
 	// Set up HTTP routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", ca.handleHealth)
 	mux.HandleFunc("/healthz", ca.handleHealth)
 	mux.HandleFunc("/readyz", ca.handleHealth)
-	mux.HandleFunc("/sign", ca.handleSign)
-	mux.HandleFunc("/api/v1/sign", ca.handleSign)
-	mux.HandleFunc("/api/v1/certificate/sign", ca.handleSign)
-	mux.HandleFunc("/cgi/pki.cgi", ca.handlePKISign) // Legacy PKI-compatible endpoint
+	mux.Handle("/version", version.Handler())
+	mux.HandleFunc("/sign", ca.recordRequest(ca.requireAuth(ca.handleSign)))
+	mux.HandleFunc("/api/v1/sign", ca.recordRequest(ca.requireAuth(ca.handleSign)))
+	mux.HandleFunc("/api/v1/certificate/sign", ca.recordRequest(ca.requireAuth(ca.handleSign)))
+	mux.HandleFunc("/api/v1/ca/sign", ca.recordRequest(ca.requireAuth(ca.handleSignCA)))
+	mux.HandleFunc("/cgi/pki.cgi", ca.recordRequest(ca.requireAuth(ca.handlePKISign))) // Legacy PKI-compatible endpoint
+	mux.HandleFunc("/api/v1/certificates", ca.requireAuth(ca.handleCertificates))
+	mux.HandleFunc("/api/v1/certificates/{serial}", ca.requireAuth(ca.handleCertificate))
+	mux.HandleFunc("/api/v1/certificates/{serial}/revoke", ca.requireAuth(ca.handleRevoke))
+	mux.HandleFunc("/api/v1/certificates/{serial}/unhold", ca.requireAuth(ca.handleUnhold))
+	mux.HandleFunc("/api/v1/revocations", ca.requireAuth(ca.handleRevocations))
+	mux.HandleFunc("/api/v1/requests", ca.requireAuth(ca.handleRecentRequests))
+	mux.HandleFunc("/api/v1/orders/{id}", ca.requireAuth(ca.handleOrder))
+	mux.HandleFunc("/admin/requests", ca.requireAuth(ca.handleRecordedRequests))
+	mux.HandleFunc("/admin/rotate-ca", ca.requireAuth(ca.handleRotateCA))
+	mux.HandleFunc("/ui", ca.handleUI)
+	mux.Handle("/metrics", metricsHandler())
+	mux.HandleFunc("/openapi.json", ca.openAPIHandler())
 	mux.HandleFunc("/ca", ca.handleGetCA)
+	mux.HandleFunc("/ca/chain", ca.handleGetCAChain)
+	mux.HandleFunc("/crl", ca.handleCRL)
 	mux.HandleFunc("/", ca.handleRoot)
 
+	var handler http.Handler = ca.tenantMiddleware(mux)
+	if config.MaintenanceSchedule != "" {
+		window, err := cron.ParseWindow(config.MaintenanceSchedule, config.MaintenanceDuration)
+		if err != nil {
+			logger.Error("Invalid maintenance schedule", "error", err)
+			os.Exit(1)
+		}
+		handler = maintenanceMiddleware(window, logger, ca.clock, handler)
+		logger.Info("Maintenance windows enabled",
+			"schedule", config.MaintenanceSchedule,
+			"duration", config.MaintenanceDuration.String(),
+			"next_window", window.Schedule.Next(ca.clock.Now()).Format(time.RFC3339),
+		)
+	}
+
 	// Create server with timeouts
 	server := &http.Server{
 		Addr:         config.Addr,
-		Handler:      loggingMiddleware(logger, mux),
+		Handler:      loggingMiddleware(logger, ca.requests, handler),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -157,14 +331,24 @@ func main() {
 	go func() {
 		<-quit
 		logger.Info("Shutting down server...")
-		if err := server.Close(); err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
 			logger.Error("Server shutdown error", "error", err)
 		}
+		// Written once requests in flight have finished
+		ca.store.flush()
+		if ca.accessLog != nil {
+			if err := ca.accessLog.close(); err != nil {
+				logger.Error("Failed to close access log", "error", err)
+			}
+		}
 		close(done)
 	}()
 
 	logger.Info("Mock CA Server is ready",
 		"addr", config.Addr,
+		"auth_type", config.AuthType,
 		"ca_subject", ca.caCert.Subject.String(),
 		"ca_expires", ca.caCert.NotAfter.Format(time.RFC3339),
 	)
@@ -188,9 +372,56 @@ func parseFlags() *Config {
 	flag.StringVar(&config.CAOrg, "ca-org", "cert-manager-external-issuer", "CA Organization")
 	flag.IntVar(&config.CAValidityYrs, "ca-validity", 10, "CA validity in years")
 	flag.IntVar(&config.CertValidityDays, "cert-validity", 365, "Default certificate validity in days")
+	flag.DurationVar(&config.CertBackdate, "cert-backdate", time.Minute, "How far NotBefore of issued certificates lies in the past, for clients with clock skew")
+	flag.DurationVar(&config.CABackdate, "ca-backdate", time.Hour, "How far NotBefore of the CA certificates lies in the past")
+	flag.StringVar(&config.ChainMode, "chain-mode", "root", "CA hierarchy: root (leaves signed by a self-signed CA) or intermediate (Root -> Intermediate -> leaf)")
+	flag.StringVar(&config.IntermediateCN, "intermediate-cn", "External Issuer Mock Intermediate CA", "Intermediate CA Common Name (chain-mode=intermediate)")
+	flag.StringVar(&config.StorePath, "store-path", "", "Persist issued certificates to this JSON file (default: in-memory only)")
+	flag.IntVar(&config.StoreMaxSize, "store-max-size", 0, "Maximum number of issued certificates kept, least recently used evicted first (0 = unlimited)")
+	flag.DurationVar(&config.StoreTTL, "store-ttl", 0, "How long issued certificates are kept (0 = forever)")
+	flag.DurationVar(&config.StoreFlushInterval, "store-flush-interval", 5*time.Second, "How often changes are written to -store-path; they are also written on shutdown (0 = after every change)")
+	flag.StringVar(&config.MaintenanceSchedule, "maintenance-schedule", "", "Cron expression opening a maintenance window during which requests get 503 (e.g. \"0 2 * * SUN\")")
+	flag.DurationVar(&config.MaintenanceDuration, "maintenance-duration", 30*time.Minute, "Length of each maintenance window")
+	flag.BoolVar(&config.PendingMode, "pending-mode", false, "Answer signing requests with 202 and an order ID, issuing the certificate at /api/v1/orders/{id} after -pending-delay")
+	flag.DurationVar(&config.PendingDelay, "pending-delay", 30*time.Second, "How long orders stay pending in pending mode")
+	cas := flag.String("cas", "", "Comma-separated names of additional CAs with their own roots, selected by the -ca-param request parameter (e.g. prod,dev)")
+	flag.StringVar(&config.CAParam, "ca-param", "ca", "Request parameter (query, form or JSON field) naming the CA to sign with")
+	flag.StringVar(&config.URIParam, "uri-param", "", "Request parameter with comma-separated URI SANs, e.g. SPIFFE IDs, added to certificates built from request parameters; their subject may then lack a CN (empty = no URI SANs)")
+	denyNames := flag.String("deny-names", "", "Comma-separated glob patterns of common and DNS names rejected with 403 (e.g. *.evil.example,admin*)")
+	flag.DurationVar(&config.MaxCertValidity, "max-cert-validity", 0, "Cap the validity of issued certificates, shorter than requested if need be (e.g. 24h, 0 = no cap)")
+	flag.StringVar(&config.CSRExtensions, "csr-extensions", csrExtensionsPermissive, "How key usages and extensions requested in CSRs are honored: permissive (as requested, non-critical custom extensions copied), strict (only what the profile allows, others rejected), ignore (profile usages only)")
+	flag.StringVar(&config.TenantsFile, "tenants", "", "JSON file of tenants sharing the server, each with its own root CA, subject defaults and validity, selected by path prefix or API key")
+	flag.StringVar(&config.TenantKeyHeader, "tenant-key-header", "X-API-Key", "Header carrying the API key of a tenant")
+	flag.IntVar(&config.RecordRequests, "record-requests", 100, "How many signing requests /admin/requests keeps, headers and body included (0 = none)")
+	flag.StringVar(&config.AccessLogPath, "access-log", "", "Append every signing request, with client identity and parameters but no credentials, to this JSONL file")
+	flag.Int64Var(&config.AccessLogMaxSize, "access-log-max-size", 10<<20, "Size in bytes at which the access log is rotated (0 = never)")
+	flag.IntVar(&config.AccessLogMaxFiles, "access-log-max-files", 5, "How many rotated access log files are kept")
+	flag.StringVar(&config.DefaultProfile, "default-profile", "peer", "Certificate profile used when a request names none: server, client, code-signing, peer")
+	flag.StringVar(&config.AuthType, "auth-type", "none", "Require authentication on signing and certificate endpoints: none, bearer, basic, header")
+	flag.StringVar(&config.AuthToken, "auth-token", "", "Expected bearer token or header value (auth-type=bearer|header)")
+	flag.StringVar(&config.AuthUsername, "auth-username", "", "Expected basic auth username (auth-type=basic)")
+	flag.StringVar(&config.AuthPassword, "auth-password", "", "Expected basic auth password (auth-type=basic)")
+	flag.StringVar(&config.AuthHeaderName, "auth-header-name", "", "Header carrying the credential (auth-type=header, e.g. X-API-Key)")
+	flag.Int64Var(&config.Seed, "seed", 0, "Make serial numbers, keys, order IDs and validity periods deterministic for golden-file tests: the same requests get the same certificates on every run (0 = random)")
+	showVersion := flag.Bool("version", false, "Print build information and exit")
 
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println("mockca-server", version.Get())
+		os.Exit(0)
+	}
+	if *cas != "" {
+		for _, name := range strings.Split(*cas, ",") {
+			config.CAs = append(config.CAs, strings.TrimSpace(name))
+		}
+	}
+	if *denyNames != "" {
+		for _, pattern := range strings.Split(*denyNames, ",") {
+			config.DenyNames = append(config.DenyNames, strings.TrimSpace(pattern))
+		}
+	}
+
 	// Override from environment variables
 	if v := os.Getenv("MOCKCA_ADDR"); v != "" {
 		config.Addr = v
@@ -201,6 +432,16 @@ func parseFlags() *Config {
 	if v := os.Getenv("MOCKCA_LOG_FORMAT"); v != "" {
 		config.LogFormat = v
 	}
+	if v := os.Getenv("MOCKCA_STORE_PATH"); v != "" {
+		config.StorePath = v
+	}
+	// Credentials can be injected from a Secret instead of appearing in the pod spec
+	if v := os.Getenv("MOCKCA_AUTH_TOKEN"); v != "" {
+		config.AuthToken = v
+	}
+	if v := os.Getenv("MOCKCA_AUTH_PASSWORD"); v != "" {
+		config.AuthPassword = v
+	}
 
 	return config
 }
@@ -235,7 +476,7 @@ func setupLogger(config *Config) *slog.Logger {
 	return slog.New(handler)
 }
 
-func loggingMiddleware(logger *slog.Logger, next http.Handler) http.Handler {
+func loggingMiddleware(logger *slog.Logger, requests *requestLog, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
@@ -245,6 +486,14 @@ func loggingMiddleware(logger *slog.Logger, next http.Handler) http.Handler {
 		next.ServeHTTP(wrapped, r)
 
 		duration := time.Since(start)
+		requests.record(requestEntry{
+			Time:       start.UTC(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     wrapped.statusCode,
+			DurationMS: duration.Milliseconds(),
+			RemoteAddr: r.RemoteAddr,
+		})
 
 		logger.Info("HTTP request",
 			"method", r.Method,
@@ -267,50 +516,162 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// NewMockCA creates a new Mock CA with generated CA certificate
+// NewMockCA creates a new Mock CA with generated CA certificate(s).
+// In "intermediate" chain mode a root CA signs an intermediate CA, and leaf
+// certificates are issued by the intermediate.
 func NewMockCA(config *Config, logger *slog.Logger) (*MockCA, error) {
-	logger.Debug("Generating CA private key", "bits", 2048)
+	random := newRandom(config.Seed)
+	clk := config.Clock
+	switch {
+	case clk != nil:
+	case config.Seed != 0:
+		clk = newSeedClock()
+	default:
+		clk = clock.RealClock{}
+	}
+	if config.CertBackdate < 0 || config.CABackdate < 0 {
+		return nil, fmt.Errorf("backdating must not be negative")
+	}
+	if config.PendingDelay < 0 {
+		return nil, fmt.Errorf("pending delay must not be negative")
+	}
+	for _, pattern := range config.DenyNames {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+	}
+	switch config.CSRExtensions {
+	case "", csrExtensionsPermissive, csrExtensionsStrict, csrExtensionsIgnore:
+	default:
+		return nil, fmt.Errorf("unsupported CSR extensions mode %q (supported: permissive, strict, ignore)", config.CSRExtensions)
+	}
+	if config.MaxCertValidity < 0 {
+		return nil, fmt.Errorf("maximum certificate validity must not be negative")
+	}
+	if config.RecordRequests < 0 {
+		return nil, fmt.Errorf("number of recorded requests must not be negative")
+	}
+	var tenants []*tenant
+	if config.TenantsFile != "" {
+		var err error
+		if tenants, err = loadTenants(config.TenantsFile); err != nil {
+			return nil, err
+		}
+		// The API key of a tenant would be checked against -auth-token
+		if config.AuthType == "header" && strings.EqualFold(config.AuthHeaderName, config.TenantKeyHeader) {
+			return nil, fmt.Errorf("-tenant-key-header %s cannot also carry the -auth-token", config.TenantKeyHeader)
+		}
+	}
+	// The CA must be valid before the certificates it issues
+	caNotBefore := clk.Now().Add(-max(config.CABackdate, config.CertBackdate))
 
-	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	rootCN, intermediateCN := caCommonNames(config, "")
+	defaultCA, err := newIssuingCA(logger, random, config, "", rootCN, intermediateCN, caNotBefore)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+		return nil, err
+	}
+	cas := make(map[string]*issuingCA, len(config.CAs))
+	for _, name := range config.CAs {
+		if _, ok := cas[name]; ok || name == "" {
+			return nil, fmt.Errorf("CA names must be unique and not empty, got %q", name)
+		}
+		rootCN, intermediateCN := caCommonNames(config, name)
+		if cas[name], err = newIssuingCA(logger, random, config, name, rootCN, intermediateCN, caNotBefore); err != nil {
+			return nil, err
+		}
+	}
+
+	store, err := newCertStore(config.StorePath, config.StoreMaxSize, config.StoreTTL, config.StoreFlushInterval, clk, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Flushes follow the wall clock, as the clock of a seeded server stands still
+	if config.StorePath != "" && config.StoreFlushInterval > 0 {
+		go store.flushEvery(clock.RealClock{})
+	}
+
+	// Expired certificates are swept in the background, not only on issuance
+	if config.StoreTTL > 0 {
+		go store.sweep(min(config.StoreTTL, time.Minute))
+	}
+
+	ca := &MockCA{
+		issuingCA: defaultCA,
+		cas:       cas,
+		tenants:   tenants,
+		config:    config,
+		logger:    logger,
+		store:     store,
+		clock:     clk,
+		started:   clk.Now(),
+		random:    random,
+		requests:  &requestLog{},
+		recorder:  &requestRecorder{size: config.RecordRequests},
+		orders:    &orderBook{orders: map[string]*order{}},
+	}
+	if config.AccessLogPath != "" {
+		if ca.accessLog, err = newAccessLog(config.AccessLogPath, config.AccessLogMaxSize, config.AccessLogMaxFiles, logger); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range tenants {
+		if t.ca, err = newTenantCA(ca, t, caNotBefore); err != nil {
+			return nil, err
+		}
+	}
+	ca.registerMetrics()
+	return ca, nil
+}
+
+// generateCA creates a CA certificate valid from notBefore and its key. When
+// parent is nil the certificate is self-signed (a root CA); otherwise it is signed by parent.
+func generateCA(logger *slog.Logger, random io.Reader, subject pkix.Name, notBefore time.Time, validityYrs, maxPathLen int, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey, []byte, error) {
+	logger.Debug("Generating CA private key", "subject", subject.String(), "bits", 2048)
+
+	caKey, err := generateKey(random, 2048)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate CA key: %w", err)
 	}
 	logger.Debug("CA private key generated successfully")
 
-	serialNumber, err := generateSerialNumber()
+	serialNumber, err := generateSerialNumber(random)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate serial: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to generate serial: %w", err)
 	}
 	logger.Debug("CA serial number generated", "serial", serialNumber.String())
 
 	caTemplate := &x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			CommonName:   config.CACN,
-			Organization: []string{config.CAOrg},
-		},
-		NotBefore:             time.Now().Add(-1 * time.Hour),
-		NotAfter:              time.Now().AddDate(config.CAValidityYrs, 0, 0),
+		SerialNumber:          serialNumber,
+		Subject:               subject,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.AddDate(validityYrs, 0, 0),
 		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
 		BasicConstraintsValid: true,
 		IsCA:                  true,
-		MaxPathLen:            1,
+		MaxPathLen:            maxPathLen,
+		MaxPathLenZero:        maxPathLen == 0,
+	}
+
+	if parent == nil {
+		parent, parentKey = caTemplate, caKey
 	}
 
 	logger.Debug("Creating CA certificate",
 		"subject", caTemplate.Subject.String(),
+		"issuer", parent.Subject.String(),
 		"not_before", caTemplate.NotBefore.Format(time.RFC3339),
 		"not_after", caTemplate.NotAfter.Format(time.RFC3339),
 	)
 
-	caCertDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	caCertDER, err := x509.CreateCertificate(rand.Reader, caTemplate, parent, &caKey.PublicKey, parentKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to create CA certificate: %w", err)
 	}
 
 	caCert, err := x509.ParseCertificate(caCertDER)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to parse CA certificate: %w", err)
 	}
 
 	caPEM := pem.EncodeToMemory(&pem.Block{
@@ -318,21 +679,7 @@ func NewMockCA(config *Config, logger *slog.Logger) (*MockCA, error) {
 		Bytes: caCertDER,
 	})
 
-	logger.Info("Mock CA initialized successfully",
-		"ca_subject", caCert.Subject.String(),
-		"ca_serial", caCert.SerialNumber.String(),
-		"ca_not_before", caCert.NotBefore.Format(time.RFC3339),
-		"ca_not_after", caCert.NotAfter.Format(time.RFC3339),
-	)
-
-	return &MockCA{
-		caCert:    caCert,
-		caKey:     caKey,
-		caPEM:     caPEM,
-		config:    config,
-		logger:    logger,
-		certStore: make(map[string]*storedCert),
-	}, nil
+	return caCert, caKey, caPEM, nil
 }
 
 func (ca *MockCA) handleRoot(w http.ResponseWriter, r *http.Request) {
@@ -342,13 +689,32 @@ func (ca *MockCA) handleRoot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "text/plain")
-	fmt.Fprintf(w, "Mock CA Server v%s\n\n", version)
+	fmt.Fprintf(w, "Mock CA Server %s\n\n", version.Version)
 	fmt.Fprintln(w, "Endpoints:")
 	fmt.Fprintln(w, "  GET  /health              - Health check")
-	fmt.Fprintln(w, "  GET  /ca                  - Get CA certificate (PEM)")
+	fmt.Fprintln(w, "  GET  /version             - Build information (JSON)")
+	fmt.Fprintln(w, "  GET  /ca                  - Get root CA certificate (PEM, ?"+ca.config.CAParam+"= for another CA)")
+	fmt.Fprintln(w, "  GET  /ca/chain            - Get CA chain, issuing CA first (PEM)")
+	fmt.Fprintln(w, "  GET  /crl                 - Get CRL of revoked and held certificates (DER, ?format=pem)")
 	fmt.Fprintln(w, "  POST /sign                - Sign a CSR (JSON)")
 	fmt.Fprintln(w, "  POST /api/v1/sign         - Sign a CSR (JSON alternate)")
 	fmt.Fprintln(w, "  POST /api/v1/certificate/sign - Sign a CSR (JSON alternate)")
+	fmt.Fprintln(w, "       ?pending_delay=30s   - Accept with 202 and an order ID, issue after the delay")
+	fmt.Fprintln(w, "  POST /api/v1/ca/sign      - Cross-sign a CA's CSR as a subordinate CA under the root")
+	fmt.Fprintln(w, "  GET  /api/v1/orders/{id}  - Poll an order: 202 while pending, then the signed certificate")
+	fmt.Fprintln(w, "  GET  /api/v1/certificates - List issued certificates (?limit=&offset=)")
+	fmt.Fprintln(w, "  GET  /api/v1/certificates/{serial} - Get an issued certificate")
+	fmt.Fprintln(w, "  DELETE /api/v1/certificates[/{serial}] - Delete issued certificate(s)")
+	fmt.Fprintln(w, "  POST /api/v1/certificates/{serial}/revoke - Revoke an issued certificate (optional RFC 5280 reason)")
+	fmt.Fprintln(w, "  POST /api/v1/certificates/{serial}/unhold - Release a certificate from hold")
+	fmt.Fprintln(w, "  GET  /api/v1/revocations  - List revocations, including evicted certificates")
+	fmt.Fprintln(w, "  GET  /api/v1/requests     - List recent requests, newest first")
+	fmt.Fprintln(w, "  GET  /admin/requests      - List recorded signing requests with headers and body, oldest first")
+	fmt.Fprintln(w, "  DELETE /admin/requests    - Clear recorded signing requests")
+	fmt.Fprintln(w, "  POST /admin/rotate-ca     - Replace a CA with a new one, optionally cross-signed by the old root")
+	fmt.Fprintln(w, "  GET  /ui                  - Web dashboard")
+	fmt.Fprintln(w, "  GET  /metrics             - Prometheus metrics")
+	fmt.Fprintln(w, "  GET  /openapi.json        - OpenAPI 3 description of this API")
 	fmt.Fprintln(w, "")
 	fmt.Fprintln(w, "Legacy PKI-Compatible Endpoint:")
 	fmt.Fprintln(w, "  POST /cgi/pki.cgi         - Legacy PKI API format")
@@ -369,13 +735,26 @@ func (ca *MockCA) handleRoot(w http.ResponseWriter, r *http.Request) {
 func (ca *MockCA) handleHealth(w http.ResponseWriter, r *http.Request) {
 	ca.logger.Debug("Health check requested")
 
+	// Tenants see their own CA; the tenants are only listed to others
+	// Without a CA named, selectCA returns the default or the tenant's CA
+	issuer, _ := ca.selectCA(r, "")
+	t := requestTenant(r)
 	response := HealthResponse{
 		Status:    "healthy",
-		Version:   version,
-		CA:        ca.caCert.Subject.String(),
-		CAExpires: ca.caCert.NotAfter.Format(time.RFC3339),
-		SignCount: ca.signCount,
-		Uptime:    time.Since(startTime).Round(time.Second).String(),
+		Version:   version.Version,
+		CA:        issuer.caCert.Subject.String(),
+		CAExpires: issuer.caCert.NotAfter.Format(time.RFC3339),
+		SignCount: ca.signCount.Load(),
+		Uptime:    ca.clock.Since(ca.started).Round(time.Second).String(),
+	}
+	switch {
+	case t != nil:
+		response.Tenant = t.Name
+	case len(ca.tenants) > 0:
+		response.Tenants = ca.tenantNames()
+	}
+	if len(ca.cas) > 0 && t == nil {
+		response.CAs = ca.caNames()
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -385,12 +764,42 @@ func (ca *MockCA) handleHealth(w http.ResponseWriter, r *http.Request) {
 func (ca *MockCA) handleGetCA(w http.ResponseWriter, r *http.Request) {
 	ca.logger.Debug("CA certificate requested")
 
+	issuer, ok := ca.queryCA(w, r)
+	if !ok {
+		return
+	}
 	w.Header().Set("Content-Type", "application/x-pem-file")
 	w.Header().Set("Content-Disposition", "attachment; filename=ca.crt")
-	w.Write(ca.caPEM)
+	w.Write(issuer.trustPEM(ca.clock.Now()))
+}
+
+func (ca *MockCA) handleGetCAChain(w http.ResponseWriter, r *http.Request) {
+	ca.logger.Debug("CA chain requested")
+
+	issuer, ok := ca.queryCA(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", "attachment; filename=ca-chain.crt")
+	w.Write(issuer.withCrossSigned(issuer.chainPEM, ca.clock.Now()))
 }
 
 func (ca *MockCA) handleSign(w http.ResponseWriter, r *http.Request) {
+	ca.sign(w, r, nil)
+}
+
+// handleSignCA cross-signs the CSR of an externally provided CA, issuing it
+// a subordinate CA certificate under the root with the subordinate-ca profile
+//
+//	POST /api/v1/ca/sign - Same request formats as /sign; profile is ignored
+func (ca *MockCA) handleSignCA(w http.ResponseWriter, r *http.Request) {
+	ca.sign(w, r, certProfiles["subordinate-ca"])
+}
+
+// sign signs the CSR of a request with the profile it names, or with
+// profile if that is not nil
+func (ca *MockCA) sign(w http.ResponseWriter, r *http.Request, profile *certProfile) {
 	if r.Method != http.MethodPost {
 		ca.sendError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is supported", "")
 		return
@@ -416,22 +825,68 @@ func (ca *MockCA) handleSign(w http.ResponseWriter, r *http.Request) {
 	var signReq SignRequest
 	contentType := r.Header.Get("Content-Type")
 
-	if strings.Contains(contentType, "application/json") {
+	switch {
+	case strings.Contains(contentType, "application/json"):
 		if err := json.Unmarshal(body, &signReq); err != nil {
 			ca.logger.Error("Failed to parse JSON request", "error", err)
 			ca.sendError(w, http.StatusBadRequest, "PARSE_ERROR", "Failed to parse JSON request", err.Error())
 			return
 		}
-	} else {
-		// Try to parse as form data or raw PEM
-		if err := r.ParseForm(); err == nil && r.FormValue("csr") != "" {
-			signReq.CSR = r.FormValue("csr")
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		// The CSR may be uploaded as a file, in PEM or DER
+		form, err := parseMultipartBody(contentType, body)
+		if err != nil {
+			ca.logger.Error("Failed to parse multipart request", "error", err)
+			ca.sendError(w, http.StatusBadRequest, "PARSE_ERROR", "Failed to parse multipart request", err.Error())
+			return
+		}
+		signReq.CSR = csrToPEM([]byte(form.Get("csr")))
+		signReq.Profile = form.Get("profile")
+		signReq.Format, signReq.Password = form.Get("format"), form.Get("password")
+	case strings.HasPrefix(contentType, "application/pkcs10"):
+		// A raw CSR, in DER or PEM; parameters are taken from the query
+		signReq.CSR = csrToPEM(body)
+	default:
+		// Try to parse as form data or raw PEM; the body was read already
+		if form, err := url.ParseQuery(string(body)); err == nil && form.Get("csr") != "" {
+			signReq.CSR = form.Get("csr")
+			signReq.Profile = form.Get("profile")
+			signReq.Format, signReq.Password = form.Get("format"), form.Get("password")
 		} else {
 			// Assume body is raw PEM CSR
 			signReq.CSR = string(body)
 		}
 	}
 
+	// Raw PEM bodies can select a profile with ?profile=
+	if signReq.Profile == "" {
+		signReq.Profile = r.URL.Query().Get("profile")
+	}
+	// and a format with ?format= and ?password=
+	format := strings.ToLower(signReq.Format)
+	if format == "" {
+		format, signReq.Password = requestFormat(r)
+	}
+	if format == "" {
+		format = formatJSON
+	}
+	if err := checkFormat(format, true); err != nil {
+		ca.sendError(w, http.StatusBadRequest, "UNSUPPORTED_FORMAT", "Unsupported response format", err.Error())
+		return
+	}
+	if profile == nil {
+		profile, err = ca.lookupProfile(signReq.Profile)
+		if err != nil {
+			ca.sendError(w, http.StatusBadRequest, "UNKNOWN_PROFILE", "Unknown certificate profile", err.Error())
+			return
+		}
+	}
+	issuer, err := ca.requestedCA(r, body)
+	if err != nil {
+		ca.sendError(w, http.StatusBadRequest, "UNKNOWN_CA", "Unknown CA", err.Error())
+		return
+	}
+
 	if signReq.CSR == "" {
 		ca.logger.Error("No CSR provided in request")
 		ca.sendError(w, http.StatusBadRequest, "MISSING_CSR", "No CSR provided in request", "")
@@ -476,51 +931,109 @@ func (ca *MockCA) handleSign(w http.ResponseWriter, r *http.Request) {
 	)
 
 	// Determine validity
-	validityDays := ca.config.CertValidityDays
+	validityDays := issuer.validityDays(ca.config.CertValidityDays)
 	if signReq.ValidityDays > 0 {
 		validityDays = signReq.ValidityDays
 	}
+	validityDays = profile.validityDays(validityDays)
+
+	if err := ca.checkDenied(csr.Subject.CommonName, csr.DNSNames); err != nil {
+		ca.sendError(w, http.StatusForbidden, "POLICY_DENIED", "Request denied by CA policy", err.Error())
+		return
+	}
+	if _, err := ca.usagesFor(csr, profile); err != nil {
+		ca.sendError(w, http.StatusBadRequest, "EXTENSION_NOT_ALLOWED", "Requested extensions cannot be honored", err.Error())
+		return
+	}
+
+	delay, err := ca.pendingDelay(r)
+	if err != nil {
+		ca.sendError(w, http.StatusBadRequest, "INVALID_PENDING_DELAY", "Invalid pending_delay", err.Error())
+		return
+	}
+	if delay > 0 {
+		ca.acceptOrder(w, issuer, csr, profile, validityDays, delay)
+		return
+	}
+
+	response, err := ca.issue(issuer, csr, profile, validityDays)
+	if err != nil {
+		ca.sendError(w, http.StatusInternalServerError, "SIGNING_ERROR", "Failed to create certificate", err.Error())
+		return
+	}
+	ca.sendSignResponse(w, response, format, signReq.Password)
+}
+
+// sendSignResponse answers with a signing response in a format
+func (ca *MockCA) sendSignResponse(w http.ResponseWriter, response *SignResponse, format, password string) {
+	if format != formatJSON {
+		if err := ca.writeCertificates(w, format, []byte(response.CertificateChain), nil, password); err != nil {
+			ca.sendError(w, http.StatusInternalServerError, "ENCODING_ERROR", "Failed to encode certificate", err.Error())
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// issue signs a certificate for a validated CSR with an issuing CA and
+// records it in the store
+func (ca *MockCA) issue(issuer *issuingCA, csr *x509.CertificateRequest, profile *certProfile, validityDays int) (*SignResponse, error) {
+	usages, err := ca.usagesFor(csr, profile)
+	if err != nil {
+		return nil, err
+	}
 
 	// Generate serial number
-	serialNumber, err := generateSerialNumber()
+	serialNumber, err := generateSerialNumber(ca.random)
 	if err != nil {
 		ca.logger.Error("Failed to generate serial number", "error", err)
-		ca.sendError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to generate serial number", err.Error())
-		return
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
 	}
 
 	// Create certificate
-	notBefore := time.Now().Add(-1 * time.Minute)
-	notAfter := time.Now().AddDate(0, 0, validityDays)
+	subject := issuer.subject(csr.Subject)
+	now := ca.clock.Now()
+	notBefore := now.Add(-ca.config.CertBackdate)
+	notAfter := ca.clampNotAfter(now, now.AddDate(0, 0, validityDays))
 
 	certTemplate := &x509.Certificate{
 		SerialNumber:          serialNumber,
-		Subject:               csr.Subject,
+		Subject:               subject,
 		NotBefore:             notBefore,
 		NotAfter:              notAfter,
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              usages.keyUsage,
+		ExtKeyUsage:           usages.extKeyUsage,
+		UnknownExtKeyUsage:    usages.unknownExtKeyUsage,
+		ExtraExtensions:       usages.extra,
 		BasicConstraintsValid: true,
-		IsCA:                  false,
+		IsCA:                  profile.IsCA,
+		MaxPathLenZero:        profile.IsCA,
 		DNSNames:              csr.DNSNames,
 		IPAddresses:           csr.IPAddresses,
 		URIs:                  csr.URIs,
 		EmailAddresses:        csr.EmailAddresses,
 	}
 
+	// Subordinate CAs are signed by the root, next to any intermediate
+	parent, parentKey, chainPEM := issuer.caCert, issuer.caKey, issuer.chainPEM
+	if profile.IsCA {
+		parent, parentKey, chainPEM = issuer.rootCert, issuer.rootKey, issuer.rootPEM
+	}
+
 	ca.logger.Debug("Creating certificate",
 		"serial", serialNumber.String(),
-		"subject", csr.Subject.String(),
+		"subject", subject.String(),
 		"not_before", notBefore.Format(time.RFC3339),
 		"not_after", notAfter.Format(time.RFC3339),
 		"validity_days", validityDays,
+		"profile", profile.Name,
 	)
 
-	certDER, err := x509.CreateCertificate(rand.Reader, certTemplate, ca.caCert, csr.PublicKey, ca.caKey)
+	certDER, err := x509.CreateCertificate(rand.Reader, certTemplate, parent, csr.PublicKey, parentKey)
 	if err != nil {
 		ca.logger.Error("Failed to create certificate", "error", err)
-		ca.sendError(w, http.StatusInternalServerError, "SIGNING_ERROR", "Failed to create certificate", err.Error())
-		return
+		return nil, err
 	}
 
 	certPEM := pem.EncodeToMemory(&pem.Block{
@@ -528,34 +1041,35 @@ func (ca *MockCA) handleSign(w http.ResponseWriter, r *http.Request) {
 		Bytes: certDER,
 	})
 
-	// Build certificate chain (cert + CA)
-	certChain := string(certPEM) + string(ca.caPEM)
+	// Build certificate chain (cert + issuing CA ... root)
+	certChain := string(certPEM) + string(issuer.withCrossSigned(chainPEM, ca.clock.Now()))
 
-	ca.signCount++
+	ca.store.recordIssued(certDER)
+	totalSigned := ca.signCount.Add(1)
 
 	ca.logger.Info("Certificate signed successfully",
 		"serial", serialNumber.String(),
-		"subject", csr.Subject.String(),
+		"subject", subject.String(),
 		"dns_names", csr.DNSNames,
 		"not_before", notBefore.Format(time.RFC3339),
 		"not_after", notAfter.Format(time.RFC3339),
 		"validity_days", validityDays,
-		"total_signed", ca.signCount,
+		"issuing_ca", issuer.name,
+		"is_ca", profile.IsCA,
+		"total_signed", totalSigned,
 	)
 
-	// Send response
-	response := SignResponse{
+	return &SignResponse{
 		Certificate:      string(certPEM),
 		CertificateChain: certChain,
-		CA:               string(ca.caPEM),
+		CA:               string(issuer.trustPEM(ca.clock.Now())),
 		SerialNumber:     serialNumber.String(),
 		NotBefore:        notBefore.Format(time.RFC3339),
 		NotAfter:         notAfter.Format(time.RFC3339),
-		Subject:          csr.Subject.String(),
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+		Subject:          subject.String(),
+		Profile:          profile.Name,
+		IssuingCA:        issuer.name,
+	}, nil
 }
 
 func (ca *MockCA) sendError(w http.ResponseWriter, status int, code, message, details string) {
@@ -574,9 +1088,9 @@ func (ca *MockCA) sendError(w http.ResponseWriter, status int, code, message, de
 	})
 }
 
-func generateSerialNumber() (*big.Int, error) {
+func generateSerialNumber(random io.Reader) (*big.Int, error) {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	return rand.Int(rand.Reader, serialNumberLimit)
+	return rand.Int(random, serialNumberLimit)
 }
 
 // handlePKISign handles the legacy PKI-compatible /cgi/pki.cgi endpoint
@@ -590,6 +1104,7 @@ func generateSerialNumber() (*big.Int, error) {
 //   - renew=1     Force recreation of certificate
 //   - subject     Full DN (e.g., /C=US/ST=California/L=San Francisco/O=Example/CN=example.com)
 //   - DNS2-DNS20  Subject Alternative Names
+//   - profile     Certificate profile (server, client, code-signing, peer)
 func (ca *MockCA) handlePKISign(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Only POST method is supported", http.StatusMethodNotAllowed)
@@ -617,25 +1132,65 @@ func (ca *MockCA) handlePKISign(w http.ResponseWriter, r *http.Request) {
 
 	ca.logger.Debug("Parsed PKI parameters", "params", params)
 
-	// Get subject DN
+	// Collect URI SANs, e.g. the SPIFFE ID of an X.509-SVID
+	var uris []*url.URL
+	if ca.config.URIParam != "" && params[ca.config.URIParam] != "" {
+		for _, value := range strings.Split(params[ca.config.URIParam], ",") {
+			uri, err := url.Parse(strings.TrimSpace(value))
+			if err != nil || uri.Scheme == "" {
+				http.Error(w, fmt.Sprintf("invalid URI SAN %q", value), http.StatusBadRequest)
+				return
+			}
+			uris = append(uris, uri)
+		}
+	}
+
+	// Get subject DN; SVIDs identify their subject by URI SAN alone
 	subjectDN := params["subject"]
-	if subjectDN == "" {
+	if subjectDN == "" && len(uris) == 0 {
 		ca.logger.Error("No subject provided in request")
 		http.Error(w, "subject parameter is required", http.StatusBadRequest)
 		return
 	}
 
-	// Parse subject DN (format: /C=US/ST=California/L=San Francisco/O=Example/CN=example.com)
-	subject := parseDN(subjectDN)
-	cn := subject.CommonName
-	if cn == "" {
+	// Parse subject DN (format: /C=US/ST=California/L=San Francisco/O=Example/CN=example.com or CN=example.com,O=Example)
+	subjectRDNs, err := parseDN(subjectDN)
+	if err != nil {
+		ca.logger.Error("Invalid subject DN", "subject", subjectDN, "error", err)
+		http.Error(w, "invalid subject: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	cn := subjectName(subjectRDNs).CommonName
+	if cn == "" && len(uris) == 0 {
 		ca.logger.Error("No CN in subject DN", "subject", subjectDN)
 		http.Error(w, "subject must contain CN", http.StatusBadRequest)
 		return
 	}
 
+	profile, err := ca.lookupProfile(params["profile"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := strings.ToLower(params["format"])
+	if format == "" {
+		format = formatPEM
+	}
+	if err := checkFormat(format, false); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	issuer, err := ca.selectCA(r, params[ca.config.CAParam])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Collect DNS SANs
-	dnsNames := []string{cn} // CN is always first SAN
+	var dnsNames []string
+	if cn != "" {
+		dnsNames = append(dnsNames, cn) // CN is always first SAN
+	}
 	for i := 2; i <= 20; i++ {
 		key := fmt.Sprintf("DNS%d", i)
 		if dns, ok := params[key]; ok && dns != "" {
@@ -646,9 +1201,18 @@ func (ca *MockCA) handlePKISign(w http.ResponseWriter, r *http.Request) {
 	isNew := params["new"] == "1"
 	isRenew := params["renew"] == "1"
 
+	// Tenants don't share stored certificates, which chain to their own roots
+	legacyKey := cn
+	if cn == "" {
+		legacyKey = uris[0].String()
+	}
+	if t := requestTenant(r); t != nil {
+		legacyKey = t.Name + "/" + cn
+	}
+
 	// Handle getCERT, getKEY, getCSR requests for existing certs
 	if _, ok := params["getCERT"]; ok {
-		stored, exists := ca.certStore[cn]
+		stored, exists := ca.store.getLegacy(legacyKey)
 		if !exists {
 			http.Error(w, "Certificate not found", http.StatusNotFound)
 			return
@@ -659,7 +1223,7 @@ func (ca *MockCA) handlePKISign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if _, ok := params["getKEY"]; ok {
-		stored, exists := ca.certStore[cn]
+		stored, exists := ca.store.getLegacy(legacyKey)
 		if !exists || stored.KeyPEM == nil {
 			http.Error(w, "Key not found", http.StatusNotFound)
 			return
@@ -670,7 +1234,7 @@ func (ca *MockCA) handlePKISign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if _, ok := params["getCSR"]; ok {
-		stored, exists := ca.certStore[cn]
+		stored, exists := ca.store.getLegacy(legacyKey)
 		if !exists || stored.CSR == nil {
 			http.Error(w, "CSR not found", http.StatusNotFound)
 			return
@@ -682,25 +1246,38 @@ func (ca *MockCA) handlePKISign(w http.ResponseWriter, r *http.Request) {
 
 	// Check for existing certificate if new=1 (not renew)
 	if isNew && !isRenew {
-		if stored, exists := ca.certStore[cn]; exists {
+		if stored, exists := ca.store.getLegacy(legacyKey); exists {
 			ca.logger.Info("Returning existing certificate for CN", "cn", cn)
-			w.Header().Set("Content-Type", "application/x-pem-file")
-			w.Write(stored.CertPEM)
-			w.Write(ca.caPEM) // Append CA cert
+			var key *rsa.PrivateKey
+			if block, _ := pem.Decode(stored.KeyPEM); block != nil {
+				key, _ = x509.ParsePKCS1PrivateKey(block.Bytes)
+			}
+			chainPEM := append(append([]byte{}, stored.CertPEM...), issuer.withCrossSigned(issuer.chainPEM, ca.clock.Now())...) // Append CA chain
+			if err := ca.writeCertificates(w, format, chainPEM, key, params["password"]); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
 			return
 		}
 	}
 
+	if err := ca.checkDenied(cn, dnsNames); err != nil {
+		ca.logger.Warn("Request denied by CA policy", "cn", cn, "reason", err.Error())
+		http.Error(w, "Request denied by CA policy: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
 	// Generate a new certificate
 	ca.logger.Info("Generating new certificate",
 		"cn", cn,
 		"dns_names", dnsNames,
+		"uris", uris,
 		"is_new", isNew,
 		"is_renew", isRenew,
+		"profile", profile.Name,
 	)
 
 	// Generate serial number
-	serialNumber, err := generateSerialNumber()
+	serialNumber, err := generateSerialNumber(ca.random)
 	if err != nil {
 		ca.logger.Error("Failed to generate serial number", "error", err)
 		http.Error(w, "Failed to generate serial number", http.StatusInternalServerError)
@@ -708,33 +1285,43 @@ func (ca *MockCA) handlePKISign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Determine validity
-	validityDays := ca.config.CertValidityDays
-	notBefore := time.Now().Add(-1 * time.Minute)
-	notAfter := time.Now().AddDate(0, 0, validityDays)
+	validityDays := profile.validityDays(issuer.validityDays(ca.config.CertValidityDays))
+	now := ca.clock.Now()
+	notBefore := now.Add(-ca.config.CertBackdate)
+	notAfter := ca.clampNotAfter(now, now.AddDate(0, 0, validityDays))
 
 	// Generate key pair for the certificate
-	certKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	certKey, err := generateKey(ca.random, 2048)
 	if err != nil {
 		ca.logger.Error("Failed to generate key pair", "error", err)
 		http.Error(w, "Failed to generate key pair", http.StatusInternalServerError)
 		return
 	}
 
+	// The subject is marshalled as requested, in its RDN order
+	rawSubject, err := asn1.Marshal(issuer.subjectRDNs(subjectRDNs))
+	if err != nil {
+		ca.logger.Error("Failed to encode subject", "subject", subjectDN, "error", err)
+		http.Error(w, "Failed to encode subject", http.StatusInternalServerError)
+		return
+	}
+
 	// Create certificate template
 	certTemplate := &x509.Certificate{
 		SerialNumber:          serialNumber,
-		Subject:               subject,
+		RawSubject:            rawSubject,
 		NotBefore:             notBefore,
 		NotAfter:              notAfter,
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              profile.KeyUsage,
+		ExtKeyUsage:           profile.ExtKeyUsage,
 		BasicConstraintsValid: true,
 		IsCA:                  false,
 		DNSNames:              dnsNames,
+		URIs:                  uris,
 	}
 
 	// Sign the certificate with our CA
-	certDER, err := x509.CreateCertificate(rand.Reader, certTemplate, ca.caCert, &certKey.PublicKey, ca.caKey)
+	certDER, err := x509.CreateCertificate(rand.Reader, certTemplate, issuer.caCert, &certKey.PublicKey, issuer.caKey)
 	if err != nil {
 		ca.logger.Error("Failed to create certificate", "error", err)
 		http.Error(w, "Failed to create certificate", http.StatusInternalServerError)
@@ -752,13 +1339,15 @@ func (ca *MockCA) handlePKISign(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Store the certificate for later retrieval
-	ca.certStore[cn] = &storedCert{
+	ca.store.putLegacy(legacyKey, &storedCert{
 		CertPEM: certPEM,
 		KeyPEM:  keyPEM,
 		Subject: subjectDN,
-	}
+		Serial:  serialNumber.String(),
+	})
 
-	ca.signCount++
+	ca.store.recordIssued(certDER)
+	totalSigned := ca.signCount.Add(1)
 
 	ca.logger.Info("PKI certificate signed successfully",
 		"serial", serialNumber.String(),
@@ -766,13 +1355,14 @@ func (ca *MockCA) handlePKISign(w http.ResponseWriter, r *http.Request) {
 		"dns_names", dnsNames,
 		"not_before", notBefore.Format(time.RFC3339),
 		"not_after", notAfter.Format(time.RFC3339),
-		"total_signed", ca.signCount,
+		"total_signed", totalSigned,
 	)
 
-	// Return certificate + CA chain as raw PEM (legacy format)
-	w.Header().Set("Content-Type", "application/x-pem-file")
-	w.Write(certPEM)
-	w.Write(ca.caPEM)
+	// Return certificate + CA chain, as raw PEM unless another format was requested
+	chainPEM := append(append([]byte{}, certPEM...), issuer.withCrossSigned(issuer.chainPEM, ca.clock.Now())...)
+	if err := ca.writeCertificates(w, format, chainPEM, certKey, params["password"]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
 
 // parsePKIParams parses semicolon-separated key=value parameters
@@ -780,9 +1370,8 @@ func (ca *MockCA) handlePKISign(w http.ResponseWriter, r *http.Request) {
 func parsePKIParams(body string) map[string]string {
 	params := make(map[string]string)
 
-	// Split by semicolon
-	parts := strings.Split(body, ";")
-	for _, part := range parts {
+	// Split by semicolon; an escaped "\;" belongs to the value, e.g. of an RFC 4514 subject
+	for _, part := range splitUnescaped(body, ';') {
 		part = strings.TrimSpace(part)
 		if part == "" {
 			continue
@@ -802,41 +1391,58 @@ func parsePKIParams(body string) map[string]string {
 	return params
 }
 
-// parseDN parses a DN string in the format /C=US/ST=California/L=San Francisco/O=Example/CN=example.com
-func parseDN(dn string) pkix.Name {
-	name := pkix.Name{}
-
-	// Split by / and parse each component
-	parts := strings.Split(dn, "/")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if part == "" {
-			continue
+// parseMultipartBody returns the fields of a multipart/form-data body,
+// including the contents of uploaded files
+func parseMultipartBody(contentType string, body []byte) (url.Values, error) {
+	_, mediaParams, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), mediaParams["boundary"])
+	form, err := reader.ReadForm(int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	defer form.RemoveAll()
+	values := url.Values(form.Value)
+	for name, files := range form.File {
+		for _, header := range files {
+			f, err := header.Open()
+			if err != nil {
+				return nil, err
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			values.Add(name, string(data))
 		}
+	}
+	return values, nil
+}
 
-		idx := strings.Index(part, "=")
-		if idx <= 0 {
-			continue
-		}
+// csrToPEM returns a CSR in PEM, encoding DER CSRs
+func csrToPEM(csr []byte) string {
+	if bytes.HasPrefix(bytes.TrimSpace(csr), []byte("-----BEGIN")) || len(csr) == 0 {
+		return string(csr)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+}
 
-		key := strings.ToUpper(strings.TrimSpace(part[:idx]))
-		value := strings.TrimSpace(part[idx+1:])
-
-		switch key {
-		case "CN":
-			name.CommonName = value
-		case "O":
-			name.Organization = append(name.Organization, value)
-		case "OU":
-			name.OrganizationalUnit = append(name.OrganizationalUnit, value)
-		case "L":
-			name.Locality = append(name.Locality, value)
-		case "ST":
-			name.Province = append(name.Province, value)
-		case "C":
-			name.Country = append(name.Country, value)
+// splitUnescaped splits s at the separators not escaped with a backslash,
+// keeping the escapes
+func splitUnescaped(s string, separator byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case separator:
+			parts = append(parts, s[start:i])
+			start = i + 1
 		}
 	}
-
-	return name
+	return append(parts, s[start:])
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/cron"
+	"k8s.io/utils/clock"
+)
+
+// maintenanceMiddleware returns 503 Service Unavailable with a Retry-After
+// header while a scheduled maintenance window is open. The Kubernetes probe
+// and metrics endpoints stay available so the Mock CA pod itself is not
+// restarted, and so do the OpenAPI document and the dashboard page, which
+// shows the maintenance errors of the API.
+func maintenanceMiddleware(window *cron.Window, logger *slog.Logger, clk clock.PassiveClock, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || r.URL.Path == "/metrics" || r.URL.Path == "/openapi.json" || r.URL.Path == "/ui" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := clk.Now()
+		active, end := window.ActiveAt(now)
+		if !active {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		retryAfter := int(math.Ceil(end.Sub(now).Seconds()))
+		logger.Info("Rejecting request during maintenance window",
+			"path", r.URL.Path,
+			"window_ends", end.Format(time.RFC3339),
+			"retry_after_seconds", retryAfter,
+		)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			Error:   "CA is in a scheduled maintenance window",
+			Code:    "MAINTENANCE",
+			Details: fmt.Sprintf("maintenance ends at %s", end.Format(time.RFC3339)),
+		})
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsRegistry holds the Mock CA's metrics, served on /metrics
+var metricsRegistry = prometheus.NewRegistry()
+
+// storeEvictions counts certificates evicted from the store
+var storeEvictions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mockca_store_evictions_total",
+		Help: "Issued certificates evicted from the store, by reason (ttl, size)",
+	},
+	[]string{"reason"},
+)
+
+func init() {
+	metricsRegistry.MustRegister(storeEvictions)
+}
+
+// registerMetrics registers the gauges reporting the CA's current state
+func (ca *MockCA) registerMetrics() {
+	metricsRegistry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "mockca_store_certificates",
+			Help: "Issued certificates currently held in the store",
+		}, func() float64 {
+			certificates, _ := ca.store.size()
+			return float64(certificates)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "mockca_store_revocations",
+			Help: "Revocation records held in the store, including those of evicted certificates",
+		}, func() float64 {
+			_, revocations := ca.store.size()
+			return float64(revocations)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "mockca_store_max_size",
+			Help: "Maximum number of issued certificates kept (0 = unlimited)",
+		}, func() float64 {
+			return float64(ca.config.StoreMaxSize)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "mockca_orders_pending",
+			Help: "Orders accepted for delayed issuance whose certificate is not ready yet",
+		}, func() float64 {
+			return float64(ca.orders.pendingOrders(ca.clock.Now()))
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "mockca_certificates_signed_total",
+			Help: "Certificates signed since the server started",
+		}, func() float64 {
+			return float64(ca.signCount.Load())
+		}),
+	)
+}
+
+// metricsHandler serves the Mock CA's metrics in the Prometheus format
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
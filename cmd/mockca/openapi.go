@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/revocation"
+	"github.com/bvorland/cert-manager-external-issuer/internal/version"
+)
+
+// object is a JSON object of the OpenAPI document
+type object = map[string]any
+
+// openAPIHandler serves an OpenAPI 3 description of the Mock CA API. The
+// document is generated once from the request and response types, the
+// certificate profiles and the configured authentication, so it always
+// matches what this server accepts.
+func (ca *MockCA) openAPIHandler() http.HandlerFunc {
+	doc, err := json.MarshalIndent(ca.openAPIDocument(), "", "  ")
+	if err != nil {
+		// Only reachable with an unencodable schema, a programming error
+		panic(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			ca.sendError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only GET method is supported", "")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	}
+}
+
+// openAPIDocument builds the OpenAPI document
+func (ca *MockCA) openAPIDocument() object {
+	schemas := object{}
+	ref := func(v any) object {
+		return object{"$ref": "#/components/schemas/" + addSchema(schemas, reflect.TypeOf(v))}
+	}
+
+	// Operations behind requireAuth declare the configured security scheme
+	// and its failures
+	var security []object
+	securitySchemes := object{}
+	switch ca.config.AuthType {
+	case "bearer":
+		securitySchemes["mockca"] = object{"type": "http", "scheme": "bearer"}
+	case "basic":
+		securitySchemes["mockca"] = object{"type": "http", "scheme": "basic"}
+	case "header":
+		securitySchemes["mockca"] = object{"type": "apiKey", "in": "header", "name": ca.config.AuthHeaderName}
+	}
+	if len(securitySchemes) > 0 {
+		security = []object{{"mockca": []string{}}}
+	}
+
+	errorResponse := func(description string) object {
+		return object{"description": description, "content": object{"application/json": object{"schema": ref(ErrorResponse{})}}}
+	}
+	jsonResponse := func(description string, v any) object {
+		return object{"description": description, "content": object{"application/json": object{"schema": ref(v)}}}
+	}
+	pemResponse := func(description string) object {
+		return object{"description": description, "content": object{"application/x-pem-file": object{"schema": object{"type": "string"}}}}
+	}
+	// withFormats adds the content types of the format parameter to a response
+	withFormats := func(response object) object {
+		content := response["content"].(object)
+		content[formatContentTypes[formatPEM]] = object{"schema": object{"type": "string"}}
+		for _, format := range []string{formatDER, formatPKCS7, formatPKCS12} {
+			content[formatContentTypes[format]] = object{"schema": object{"type": "string", "format": "binary"}}
+		}
+		return response
+	}
+	operation := func(summary string, authenticated bool, responses object) object {
+		op := object{"summary": summary, "responses": responses}
+		if authenticated && security != nil {
+			op["security"] = security
+			responses["401"] = errorResponse("Credentials are missing")
+			responses["403"] = errorResponse("Credentials are wrong")
+		}
+		if ca.config.MaintenanceSchedule != "" {
+			responses["503"] = object{
+				"description": "A scheduled maintenance window is open",
+				"headers":     object{"Retry-After": object{"description": "Seconds until the window closes", "schema": object{"type": "integer"}}},
+				"content":     object{"application/json": object{"schema": ref(ErrorResponse{})}},
+			}
+		}
+		return op
+	}
+
+	profile := object{"type": "string", "enum": profileNames(), "description": "Certificate profile (default " + ca.config.DefaultProfile + ")"}
+	signRequest := ref(SignRequest{})
+	schemas["SignRequest"].(object)["properties"].(object)["profile"] = profile
+	format := object{"type": "string", "enum": []string{formatJSON, formatPEM, formatDER, formatPKCS7, formatPKCS12}, "default": formatJSON, "description": "Response format: the JSON signing response, the PEM chain, the DER leaf, a certs-only PKCS#7 bundle or a PKCS#12 file of the chain"}
+	password := object{"type": "string", "description": "Password of PKCS#12 responses (default: empty)"}
+	schemas["SignRequest"].(object)["properties"].(object)["format"] = format
+	formatParams := []object{
+		{"name": "format", "in": "query", "schema": format, "description": "Format of raw PEM requests' responses"},
+		{"name": "password", "in": "query", "schema": password},
+	}
+	// The CA parameter is named by -ca-param and only offered with -cas
+	var caParams []object
+	if len(ca.cas) > 0 {
+		caSchema := object{"type": "string", "enum": ca.caNames(), "description": "CA to use instead of the default CA"}
+		schemas["SignRequest"].(object)["properties"].(object)[ca.config.CAParam] = caSchema
+		caParams = []object{{"name": ca.config.CAParam, "in": "query", "schema": caSchema}}
+	}
+	pendingHeaders := object{
+		"Location":    object{"description": "Order to poll", "schema": object{"type": "string"}},
+		"Retry-After": object{"description": "Seconds until the order is ready", "schema": object{"type": "integer"}},
+	}
+	pending := jsonResponse("Accepted for delayed issuance; poll the order", OrderResponse{})
+	pending["headers"] = pendingHeaders
+	sign := operation("Sign a CSR", true, object{
+		"200": withFormats(jsonResponse("Issued certificate, in the requested format", SignResponse{})),
+		"202": pending,
+		"400": errorResponse("Invalid request, CSR, profile, CA, format or pending_delay, or requested extensions that cannot be honored"),
+	})
+	if len(ca.config.DenyNames) > 0 {
+		description := "A common or DNS name matches a -deny-names pattern (POLICY_DENIED)"
+		if _, ok := sign["responses"].(object)["403"]; ok {
+			description = "Credentials are wrong, or a common or DNS name matches a -deny-names pattern (POLICY_DENIED)"
+		}
+		sign["responses"].(object)["403"] = errorResponse(description)
+	}
+	sign["parameters"] = []object{
+		{"name": "profile", "in": "query", "schema": profile, "description": "Profile of raw PEM requests"},
+		{"name": "pending_delay", "in": "query", "schema": object{"type": "string", "example": "30s"}, "description": "Accept the request with 202 and issue the certificate after this Go duration (0s: immediately)"},
+	}
+	sign["parameters"] = append(append(sign["parameters"].([]object), formatParams...), caParams...)
+	getOrder := operation("Poll an order of delayed issuance", true, object{
+		"200": withFormats(jsonResponse("Issued certificate, in the requested format", SignResponse{})),
+		"202": pending,
+		"400": errorResponse("Invalid format"),
+		"404": errorResponse("Order not found"),
+	})
+	getOrder["parameters"] = append([]object{{"name": "id", "in": "path", "required": true, "schema": object{"type": "string"}}}, formatParams...)
+	sign["requestBody"] = object{"required": true, "content": object{
+		"application/json": object{"schema": signRequest},
+		"application/x-www-form-urlencoded": object{"schema": object{
+			"type":       "object",
+			"required":   []string{"csr"},
+			"properties": object{"csr": object{"type": "string"}, "profile": profile, "format": format, "password": password},
+		}},
+		"application/x-pem-file": object{"schema": object{"type": "string", "description": "PEM-encoded CSR"}},
+	}}
+
+	legacySign := operation("Legacy PKI-compatible signing", true, object{
+		"200": withFormats(pemResponse("Certificate followed by the CA chain in the format argument (pem, der, pkcs7 or pkcs12 with the key and the password argument), or the certificate, key or CSR asked for with getCERT, getKEY or getCSR")),
+		"400": object{"description": "Missing subject or CN, or unknown profile or format", "content": object{"text/plain": object{"schema": object{"type": "string"}}}},
+		"404": object{"description": "No certificate for the CN", "content": object{"text/plain": object{"schema": object{"type": "string"}}}},
+	})
+	legacySign["requestBody"] = object{"required": true, "content": object{"text/plain": object{"schema": object{
+		"type":        "string",
+		"description": "Semicolon-separated arguments, e.g. new=1;subject=/C=US/O=Example/CN=test.com;DNS2=alt.com",
+	}}}}
+
+	listCertificates := operation("List issued certificates, oldest first", true, object{
+		"200": jsonResponse("A page of issued certificates", CertificateListResponse{}),
+		"400": errorResponse("Invalid limit or offset"),
+	})
+	listCertificates["parameters"] = []object{
+		{"name": "limit", "in": "query", "schema": object{"type": "integer", "minimum": 1, "maximum": maxListLimit, "default": defaultListLimit}},
+		{"name": "offset", "in": "query", "schema": object{"type": "integer", "minimum": 0, "default": 0}},
+	}
+
+	serial := []object{{"name": "serial", "in": "path", "required": true, "schema": object{"type": "string"}, "description": "Decimal serial number"}}
+	revoke := operation("Revoke an issued certificate", true, object{
+		"200": jsonResponse("Revocation record", revocationRecord{}),
+		"400": errorResponse("Invalid request body or reason"),
+		"404": errorResponse("Certificate not found"),
+	})
+	revoke["requestBody"] = object{"required": false, "content": object{"application/json": object{"schema": ref(RevokeRequest{})}}}
+	schemas["RevokeRequest"].(object)["properties"].(object)["reason"] = object{
+		"type":        "string",
+		"enum":        revocation.Names(),
+		"description": "RFC 5280 reason, also accepted as its code; certificateHold suspends the certificate, removeFromCRL releases it",
+	}
+	revoke["responses"].(object)["409"] = errorResponse("removeFromCRL for a certificate that is not on hold")
+	unhold := operation("Release a certificate from hold", true, object{
+		"200": jsonResponse("The revocation record of the released hold", revocationRecord{}),
+		"404": errorResponse("Certificate not found"),
+		"409": errorResponse("Certificate is not on hold"),
+	})
+	crl := operation("CRL of revoked and held certificates, signed by the issuing CA", false, object{
+		"200": object{"description": "CRL", "content": object{
+			"application/pkix-crl":   object{"schema": object{"type": "string", "format": "binary"}},
+			"application/x-pem-file": object{"schema": object{"type": "string"}},
+		}},
+		"400": errorResponse("Invalid format"),
+	})
+	crl["parameters"] = []object{{"name": "format", "in": "query", "schema": object{"type": "string", "enum": []string{"der", "pem"}, "default": "der"}}}
+	getCA := operation("Root CA certificate", false, object{"200": pemResponse("Root CA certificate")})
+	getChain := operation("CA chain, issuing CA first", false, object{"200": pemResponse("CA chain from the issuing CA up to the root")})
+	rotateCA := operation("Replace a CA with a new hierarchy, optionally cross-signed by the previous root", true, object{
+		"200": jsonResponse("Rotated CA", RotateCAResponse{}),
+		"400": errorResponse("Invalid request body or cross-sign period"),
+		"409": errorResponse("The CA was rotated concurrently"),
+	})
+	rotateCA["requestBody"] = object{"required": false, "content": object{"application/json": object{"schema": ref(RotateCARequest{})}}}
+	if caParams != nil {
+		for _, op := range []object{getCA, getChain, crl, rotateCA} {
+			params, _ := op["parameters"].([]object)
+			op["parameters"] = append(params, caParams...)
+			op["responses"].(object)["400"] = errorResponse("Unknown CA")
+		}
+	}
+
+	health := object{"get": operation("Health of the CA", false, object{"200": jsonResponse("The CA is healthy", HealthResponse{})})}
+	// The probes are served during maintenance windows
+	probeOperation := operation("Health of the CA for Kubernetes probes", false, object{"200": jsonResponse("The CA is healthy", HealthResponse{})})
+	delete(probeOperation["responses"].(object), "503")
+	probe := object{"get": probeOperation}
+	signPath := object{"post": sign}
+	signCA := object{}
+	for k, v := range sign {
+		signCA[k] = v
+	}
+	signCA["summary"] = "Cross-sign a CA's CSR as a subordinate CA under the root (subordinate-ca profile)"
+	signCA["parameters"] = append([]object{}, sign["parameters"].([]object)[1:]...)
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "Mock CA Server",
+			"version":     version.Version,
+			"description": "Certificate signing API of the Mock CA, mimicking an external PKI",
+		},
+		"paths": object{
+			"/health":                  health,
+			"/healthz":                 probe,
+			"/readyz":                  probe,
+			"/version":                 object{"get": operation("Build information", false, object{"200": jsonResponse("Build information", version.Info{})})},
+			"/ca":                      object{"get": getCA},
+			"/ca/chain":                object{"get": getChain},
+			"/crl":                     object{"get": crl},
+			"/sign":                    signPath,
+			"/api/v1/sign":             signPath,
+			"/api/v1/certificate/sign": signPath,
+			"/api/v1/ca/sign":          object{"post": signCA},
+			"/cgi/pki.cgi":             object{"post": legacySign},
+			"/api/v1/certificates": object{
+				"get":    listCertificates,
+				"delete": operation("Delete all issued certificates and revocation records", true, object{"204": object{"description": "Deleted"}}),
+			},
+			"/api/v1/certificates/{serial}": object{
+				"parameters": serial,
+				"get": operation("Get an issued certificate including its PEM", true, object{
+					"200": jsonResponse("Issued certificate", CertificateInfo{}),
+					"404": errorResponse("Certificate not found"),
+				}),
+				"delete": operation("Delete an issued certificate", true, object{
+					"204": object{"description": "Deleted"},
+					"404": errorResponse("Certificate not found"),
+				}),
+			},
+			"/api/v1/certificates/{serial}/revoke": object{"parameters": serial, "post": revoke},
+			"/api/v1/certificates/{serial}/unhold": object{"parameters": serial, "post": unhold},
+			"/api/v1/revocations": object{"get": operation("List revocations, including those of evicted certificates", true, object{
+				"200": jsonResponse("Revocation records, oldest first", RevocationListResponse{}),
+			})},
+			"/api/v1/orders/{id}": object{"get": getOrder},
+			"/api/v1/requests": object{"get": operation("List the most recent requests, without probes and metrics scrapes", true, object{
+				"200": jsonResponse("Recent requests, newest first", RecentRequestsResponse{}),
+			})},
+			"/admin/requests": object{
+				"get": operation("List the recorded signing requests with their headers and bodies", true, object{
+					"200": jsonResponse("Recorded signing requests, oldest first", RecordedRequestsResponse{}),
+				}),
+				"delete": operation("Clear the recorded signing requests", true, object{"204": object{"description": "Cleared"}}),
+			},
+			"/admin/rotate-ca": object{"post": rotateCA},
+			"/ui": object{"get": object{"summary": "Web dashboard", "responses": object{
+				"200": object{"description": "Dashboard page, loading its data from this API", "content": object{"text/html": object{"schema": object{"type": "string"}}}},
+			}}},
+			"/metrics": object{"get": object{"summary": "Prometheus metrics", "responses": object{
+				"200": object{"description": "Metrics in the Prometheus text format", "content": object{"text/plain": object{"schema": object{"type": "string"}}}},
+			}}},
+			"/openapi.json": object{"get": object{"summary": "This document", "responses": object{
+				"200": object{"description": "OpenAPI 3 document", "content": object{"application/json": object{"schema": object{"type": "object"}}}},
+			}}},
+		},
+		"components": object{
+			"schemas":         schemas,
+			"securitySchemes": securitySchemes,
+		},
+	}
+}
+
+// addSchema adds the schema of a struct type, and of the structs it refers
+// to, to schemas and returns its name. Fields are described by their json
+// tags; fields without omitempty are required.
+func addSchema(schemas object, t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	if _, ok := schemas[string(name)]; ok {
+		return string(name)
+	}
+	schema := object{"type": "object"}
+	// Reserve the name before recursing, for self-referencing types
+	schemas[string(name)] = schema
+
+	properties := object{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		fieldName, options, _ := strings.Cut(tag, ",")
+		if fieldName == "" {
+			fieldName = field.Name
+		}
+		properties[fieldName] = typeSchema(schemas, field.Type)
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, fieldName)
+		}
+	}
+	schema["properties"] = properties
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return string(name)
+}
+
+// typeSchema returns the schema of a field type
+func typeSchema(schemas object, t reflect.Type) object {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return object{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return object{"type": "string", "format": "byte"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int:
+		return object{"type": "integer"}
+	case reflect.Int64:
+		return object{"type": "integer", "format": "int64"}
+	case reflect.Slice:
+		return object{"type": "array", "items": typeSchema(schemas, t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": typeSchema(schemas, t.Elem())}
+	case reflect.Struct:
+		return object{"$ref": "#/components/schemas/" + addSchema(schemas, t)}
+	}
+	return object{}
+}
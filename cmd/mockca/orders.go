@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// orderRetention is how long an order can still be polled after it became ready
+const orderRetention = time.Hour
+
+// order is a signing request accepted for delayed issuance. The certificate
+// is signed on the first poll after readyAt, so its validity starts then.
+type order struct {
+	id           string
+	issuer       *issuingCA
+	csr          *x509.CertificateRequest
+	profile      *certProfile
+	validityDays int
+	createdAt    time.Time
+	readyAt      time.Time
+	// response is the issued certificate, nil until the first poll after readyAt
+	response *SignResponse
+}
+
+// OrderResponse describes a pending order
+type OrderResponse struct {
+	OrderID   string `json:"order_id"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+	ReadyAt   string `json:"ready_at"`
+}
+
+// orderBook holds the orders of pending issuance in memory; they don't
+// survive restarts
+type orderBook struct {
+	mu     sync.Mutex
+	orders map[string]*order
+}
+
+// pendingDelay returns how long issuance of a signing request is delayed:
+// the pending_delay query parameter, else -pending-delay in pending mode
+func (ca *MockCA) pendingDelay(r *http.Request) (time.Duration, error) {
+	if v := r.URL.Query().Get("pending_delay"); v != "" {
+		delay, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, err
+		}
+		if delay < 0 {
+			return 0, fmt.Errorf("must not be negative, got %s", v)
+		}
+		return delay, nil
+	}
+	if ca.config.PendingMode {
+		return ca.config.PendingDelay, nil
+	}
+	return 0, nil
+}
+
+// acceptOrder answers a signing request with 202 Accepted and an order
+// whose certificate can be fetched from /api/v1/orders/{id} after delay
+func (ca *MockCA) acceptOrder(w http.ResponseWriter, issuer *issuingCA, csr *x509.CertificateRequest, profile *certProfile, validityDays int, delay time.Duration) {
+	idBytes := make([]byte, 16)
+	if _, err := io.ReadFull(ca.random, idBytes); err != nil {
+		ca.sendError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to generate order ID", err.Error())
+		return
+	}
+	now := ca.clock.Now()
+	o := &order{
+		id:           hex.EncodeToString(idBytes),
+		issuer:       issuer,
+		csr:          csr,
+		profile:      profile,
+		validityDays: validityDays,
+		createdAt:    now,
+		readyAt:      now.Add(delay),
+	}
+
+	ca.orders.mu.Lock()
+	// Orders are dropped a while after becoming ready, checked on every new order
+	for id, existing := range ca.orders.orders {
+		if now.Sub(existing.readyAt) > orderRetention {
+			delete(ca.orders.orders, id)
+		}
+	}
+	ca.orders.orders[o.id] = o
+	ca.orders.mu.Unlock()
+
+	ca.logger.Info("Accepted order for delayed issuance",
+		"order_id", o.id,
+		"subject", csr.Subject.String(),
+		"ready_at", o.readyAt.Format(time.RFC3339),
+	)
+	ca.sendPending(w, o, now)
+}
+
+// sendPending answers with 202 Accepted, a Retry-After header and the order
+func (ca *MockCA) sendPending(w http.ResponseWriter, o *order, now time.Time) {
+	retryAfter := int(math.Ceil(o.readyAt.Sub(now).Seconds()))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/orders/"+o.id)
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(OrderResponse{
+		OrderID:   o.id,
+		Status:    "pending",
+		CreatedAt: o.createdAt.UTC().Format(time.RFC3339),
+		ReadyAt:   o.readyAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// handleOrder reports the state of an order
+//
+//	GET /api/v1/orders/{id} - 202 while pending, then 200 with the signing response
+func (ca *MockCA) handleOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ca.sendError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only GET method is supported", "")
+		return
+	}
+	id := r.PathValue("id")
+
+	// The lock is held while signing so an order is issued only once
+	ca.orders.mu.Lock()
+	defer ca.orders.mu.Unlock()
+	o, ok := ca.orders.orders[id]
+	if !ok {
+		ca.sendError(w, http.StatusNotFound, "NOT_FOUND", "Order not found", id)
+		return
+	}
+	now := ca.clock.Now()
+	if now.Before(o.readyAt) {
+		ca.sendPending(w, o, now)
+		return
+	}
+	if o.response == nil {
+		response, err := ca.issue(o.issuer, o.csr, o.profile, o.validityDays)
+		if err != nil {
+			ca.sendError(w, http.StatusInternalServerError, "SIGNING_ERROR", "Failed to create certificate", err.Error())
+			return
+		}
+		o.response = response
+		ca.logger.Info("Issued certificate of order", "order_id", id, "serial", response.SerialNumber)
+	}
+
+	format, password := requestFormat(r)
+	if format == "" {
+		format = formatJSON
+	}
+	if err := checkFormat(format, true); err != nil {
+		ca.sendError(w, http.StatusBadRequest, "UNSUPPORTED_FORMAT", "Unsupported response format", err.Error())
+		return
+	}
+	ca.sendSignResponse(w, o.response, format, password)
+}
+
+// pendingOrders returns the number of orders not ready yet
+func (b *orderBook) pendingOrders(now time.Time) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pending := 0
+	for _, o := range b.orders {
+		if now.Before(o.readyAt) {
+			pending++
+		}
+	}
+	return pending
+}
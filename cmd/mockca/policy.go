@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// policyError is a request the simulated CA policy rejects
+type policyError struct {
+	name    string
+	pattern string
+}
+
+func (e *policyError) Error() string {
+	return fmt.Sprintf("%q matches denied pattern %q", e.name, e.pattern)
+}
+
+// checkDenied rejects requests whose common name or a DNS name matches one
+// of the -deny-names patterns, compared case-insensitively
+func (ca *MockCA) checkDenied(commonName string, dnsNames []string) error {
+	if len(ca.config.DenyNames) == 0 {
+		return nil
+	}
+	names := append([]string{commonName}, dnsNames...)
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		for _, pattern := range ca.config.DenyNames {
+			// Patterns are validated on startup, so Match cannot fail
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+				return &policyError{name: name, pattern: pattern}
+			}
+		}
+	}
+	return nil
+}
+
+// clampNotAfter caps the validity of an issued certificate at
+// -max-cert-validity, so certificates may be shorter-lived than requested
+func (ca *MockCA) clampNotAfter(now, notAfter time.Time) time.Time {
+	if ca.config.MaxCertValidity <= 0 {
+		return notAfter
+	}
+	if limit := now.Add(ca.config.MaxCertValidity); notAfter.After(limit) {
+		ca.logger.Info("Clamped certificate validity",
+			"requested_not_after", notAfter.Format(time.RFC3339),
+			"not_after", limit.Format(time.RFC3339),
+		)
+		return limit
+	}
+	return notAfter
+}
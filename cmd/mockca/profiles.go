@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// certProfile controls the key usages and validity of issued certificates
+type certProfile struct {
+	Name        string
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
+	// MaxValidityDays caps the requested validity (0 = no cap)
+	MaxValidityDays int
+	// IsCA issues subordinate CA certificates signed by the root CA
+	IsCA bool
+}
+
+// certProfiles are the named profiles clients can select with the "profile" request field
+var certProfiles = map[string]*certProfile{
+	"server": {
+		Name:            "server",
+		KeyUsage:        x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		MaxValidityDays: 397,
+	},
+	"client": {
+		Name:            "client",
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		MaxValidityDays: 730,
+	},
+	"code-signing": {
+		Name:            "code-signing",
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		MaxValidityDays: 1095,
+	},
+	// subordinate-ca cross-signs a CA's CSR under the root, for nested hierarchies
+	"subordinate-ca": {
+		Name:            "subordinate-ca",
+		KeyUsage:        x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		MaxValidityDays: 1825,
+		IsCA:            true,
+	},
+	// peer matches what the Mock CA issued before profiles existed
+	"peer": {
+		Name:        "peer",
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	},
+}
+
+// profileNames returns the sorted names of all profiles
+func profileNames() []string {
+	names := make([]string, 0, len(certProfiles))
+	for name := range certProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupProfile returns the named profile, or the default profile when name is empty
+func (ca *MockCA) lookupProfile(name string) (*certProfile, error) {
+	if name == "" {
+		name = ca.config.DefaultProfile
+	}
+	profile, ok := certProfiles[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q (supported: %s)", name, strings.Join(profileNames(), ", "))
+	}
+	return profile, nil
+}
+
+// validityDays applies the profile's validity cap to the requested validity
+func (p *certProfile) validityDays(requested int) int {
+	if p.MaxValidityDays > 0 && requested > p.MaxValidityDays {
+		return p.MaxValidityDays
+	}
+	return requested
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRecordedBody is how much of a request body is recorded
+const maxRecordedBody = 64 << 10
+
+// recordedRequest is a signing request as the Mock CA received it
+type recordedRequest struct {
+	Time    time.Time           `json:"time"`
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Query   map[string][]string `json:"query,omitempty"`
+	Headers map[string][]string `json:"headers"`
+	Body    string              `json:"body"`
+	// BodyTruncated is set when the body was longer than maxRecordedBody
+	BodyTruncated bool `json:"body_truncated,omitempty"`
+	// Params are the parsed body: JSON fields, form fields or the
+	// semicolon-separated parameters of /cgi/pki.cgi; empty for raw PEM
+	Params map[string]any `json:"params,omitempty"`
+	Status int            `json:"status"`
+	// Tenant is the tenant the request belongs to, if any
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// RecordedRequestsResponse lists the recorded signing requests, oldest first
+type RecordedRequestsResponse struct {
+	Items []recordedRequest `json:"items"`
+	Total int               `json:"total"`
+}
+
+// requestRecorder keeps the last signing requests verbatim, headers and
+// credentials included, so e2e tests can assert on what the controller sent
+type requestRecorder struct {
+	mu      sync.Mutex
+	entries []recordedRequest
+	// size is how many requests are kept; 0 turns recording off
+	size int
+}
+
+// add records a request, dropping the oldest one when the recorder is full
+func (rec *requestRecorder) add(entry recordedRequest) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.entries) == rec.size {
+		copy(rec.entries, rec.entries[1:])
+		rec.entries = rec.entries[:len(rec.entries)-1]
+	}
+	rec.entries = append(rec.entries, entry)
+}
+
+// list returns the recorded requests of a tenant, or all of them for
+// tenant "", oldest first
+func (rec *requestRecorder) list(tenant string) []recordedRequest {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	items := []recordedRequest{}
+	for _, entry := range rec.entries {
+		if tenant == "" || entry.Tenant == tenant {
+			items = append(items, entry)
+		}
+	}
+	return items
+}
+
+// clear drops the recorded requests of a tenant, or all of them for tenant ""
+func (rec *requestRecorder) clear(tenant string) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	kept := rec.entries[:0]
+	for _, entry := range rec.entries {
+		if tenant != "" && entry.Tenant != tenant {
+			kept = append(kept, entry)
+		}
+	}
+	rec.entries = kept
+}
+
+// recordedTenant returns the name of a request's tenant, "" if none
+func recordedTenant(r *http.Request) string {
+	if t := requestTenant(r); t != nil {
+		return t.Name
+	}
+	return ""
+}
+
+// recordRequest wraps a signing handler to record its requests and write
+// them to the access log, including those rejected for missing or wrong
+// credentials
+func (ca *MockCA) recordRequest(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ca.recorder.size == 0 && ca.accessLog == nil {
+			next(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			ca.sendError(w, http.StatusBadRequest, "READ_ERROR", "Failed to read request body", err.Error())
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		start := time.Now()
+		next(wrapped, r)
+		if ca.accessLog != nil {
+			ca.accessLog.write(ca.accessLogEntry(r, body, wrapped.statusCode, time.Since(start)))
+		}
+		if ca.recorder.size == 0 {
+			return
+		}
+
+		entry := recordedRequest{
+			Time:    ca.clock.Now().UTC(),
+			Method:  r.Method,
+			Path:    r.URL.Path,
+			Headers: r.Header.Clone(),
+			Body:    string(body),
+			Params:  recordedParams(r, body),
+			Status:  wrapped.statusCode,
+			Tenant:  recordedTenant(r),
+		}
+		if query := r.URL.Query(); len(query) > 0 {
+			entry.Query = query
+		}
+		if len(body) > maxRecordedBody {
+			entry.Body, entry.BodyTruncated = string(body[:maxRecordedBody]), true
+		}
+		ca.recorder.add(entry)
+	}
+}
+
+// recordedParams parses a signing request body the way its endpoint does
+func recordedParams(r *http.Request, body []byte) map[string]any {
+	params := map[string]any{}
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case r.URL.Path == "/cgi/pki.cgi":
+		for k, v := range parsePKIParams(string(body)) {
+			params[k] = v
+		}
+	case strings.Contains(contentType, "application/json"):
+		if err := json.Unmarshal(body, &params); err != nil {
+			return nil
+		}
+	case strings.Contains(contentType, "application/x-www-form-urlencoded"):
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil
+		}
+		for k := range values {
+			params[k] = values.Get(k)
+		}
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		values, err := parseMultipartBody(contentType, body)
+		if err != nil {
+			return nil
+		}
+		for k := range values {
+			params[k] = values.Get(k)
+		}
+		if csr := values.Get("csr"); csr != "" {
+			params["csr"] = csrToPEM([]byte(csr))
+		}
+	case strings.HasPrefix(contentType, "application/pkcs10"):
+		for k, v := range r.URL.Query() {
+			params[k] = v[0]
+		}
+		params["csr"] = csrToPEM(body)
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// handleRecordedRequests lists or clears the recorded signing requests;
+// tenants only see and clear their own
+//
+//	GET    /admin/requests - List the recorded signing requests, oldest first
+//	DELETE /admin/requests - Clear the recorded signing requests
+func (ca *MockCA) handleRecordedRequests(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		items := ca.recorder.list(recordedTenant(r))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(RecordedRequestsResponse{Items: items, Total: len(items)})
+	case http.MethodDelete:
+		ca.recorder.clear(recordedTenant(r))
+		ca.logger.Info("Cleared recorded requests")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		ca.sendError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only GET and DELETE methods are supported", "")
+	}
+}
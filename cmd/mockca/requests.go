@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// recentRequestsSize is how many requests the request log keeps
+const recentRequestsSize = 100
+
+// requestEntry describes a request served by the Mock CA
+type requestEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMS int64     `json:"duration_ms"`
+	RemoteAddr string    `json:"remote_addr"`
+}
+
+// RecentRequestsResponse lists the most recent requests, newest first
+type RecentRequestsResponse struct {
+	Items []requestEntry `json:"items"`
+}
+
+// requestLog keeps the most recent API requests in a ring buffer for the
+// dashboard. Probes, metrics scrapes and the dashboard page are left out.
+type requestLog struct {
+	mu      sync.Mutex
+	entries []requestEntry
+	// next is the slot of the next entry once the buffer is full
+	next int
+}
+
+// record adds a request, overwriting the oldest one when the log is full
+func (l *requestLog) record(entry requestEntry) {
+	if l == nil {
+		return
+	}
+	switch entry.Path {
+	case "/healthz", "/readyz", "/metrics", "/ui", "/api/v1/requests", "/admin/requests":
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < recentRequestsSize {
+		l.entries = append(l.entries, entry)
+		return
+	}
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % recentRequestsSize
+}
+
+// recent returns the logged requests, newest first
+func (l *requestLog) recent() []requestEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := make([]requestEntry, 0, len(l.entries))
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		entries = append(entries, l.entries[(l.next+i)%len(l.entries)])
+	}
+	return entries
+}
+
+// handleRecentRequests lists the most recent requests
+//
+//	GET /api/v1/requests - List recent requests, newest first
+func (ca *MockCA) handleRecentRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ca.sendError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only GET method is supported", "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecentRequestsResponse{Items: ca.requests.recent()})
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RotateCARequest is the optional body of POST /admin/rotate-ca
+type RotateCARequest struct {
+	// CrossSignPeriod keeps the previous root trusted for this long, e.g.
+	// "24h": the new root is cross-signed by it and served next to it
+	CrossSignPeriod string `json:"cross_sign_period,omitempty"`
+}
+
+// RotateCAResponse describes a rotated CA
+type RotateCAResponse struct {
+	// CA names the rotated CA; empty for the default CA
+	CA     string `json:"ca,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	// Subject and Expires describe the new issuing CA
+	Subject            string `json:"ca_subject"`
+	Expires            string `json:"ca_expires"`
+	RootSerial         string `json:"root_serial"`
+	PreviousRootSerial string `json:"previous_root_serial"`
+	// CrossSignedUntil ends the cross-sign period, if one was requested
+	CrossSignedUntil string `json:"cross_signed_until,omitempty"`
+	// CrossCertificate is the new root cross-signed by the previous root
+	CrossCertificate string `json:"cross_certificate,omitempty"`
+}
+
+// errConcurrentRotation reports a CA rotated by another request meanwhile
+var errConcurrentRotation = errors.New("the CA was rotated concurrently")
+
+// handleRotateCA replaces a CA hierarchy with a new one, to test how the
+// controller and workloads behave across a CA rollover. Certificates are
+// signed by the new CA right away; during a cross-sign period chains end
+// with the new root cross-signed by the previous one, and /ca serves both
+// roots, so workloads trusting only the previous root keep working.
+func (ca *MockCA) handleRotateCA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ca.sendError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only POST method is supported", "")
+		return
+	}
+	previous, ok := ca.queryCA(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ca.sendError(w, http.StatusBadRequest, "READ_ERROR", "Failed to read request body", err.Error())
+		return
+	}
+	var req RotateCARequest
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			ca.sendError(w, http.StatusBadRequest, "PARSE_ERROR", "Failed to parse JSON request", err.Error())
+			return
+		}
+	}
+	var crossSign time.Duration
+	if req.CrossSignPeriod != "" {
+		if crossSign, err = time.ParseDuration(req.CrossSignPeriod); err != nil || crossSign < 0 {
+			ca.sendError(w, http.StatusBadRequest, "INVALID_CROSS_SIGN_PERIOD", "Invalid cross-sign period", fmt.Sprintf("%q is not a non-negative duration", req.CrossSignPeriod))
+			return
+		}
+	}
+
+	t := requestTenant(r)
+	rotated, err := ca.rotateCA(t, previous, crossSign)
+	if errors.Is(err, errConcurrentRotation) {
+		ca.sendError(w, http.StatusConflict, "CONCURRENT_ROTATION", "CA rotation conflict", err.Error())
+		return
+	}
+	if err != nil {
+		ca.logger.Error("Failed to rotate CA", "name", previous.name, "error", err)
+		ca.sendError(w, http.StatusInternalServerError, "ROTATION_ERROR", "Failed to rotate CA", err.Error())
+		return
+	}
+
+	response := RotateCAResponse{
+		CA:                 rotated.name,
+		Subject:            rotated.caCert.Subject.String(),
+		Expires:            rotated.caCert.NotAfter.Format(time.RFC3339),
+		RootSerial:         rotated.rootCert.SerialNumber.String(),
+		PreviousRootSerial: previous.rootCert.SerialNumber.String(),
+	}
+	if t != nil {
+		// Tenant CAs are named after their tenant
+		response.CA, response.Tenant = "", t.Name
+	}
+	if crossSign > 0 {
+		response.CrossSignedUntil = rotated.crossSignedUntil.Format(time.RFC3339)
+		response.CrossCertificate = string(rotated.crossPEM)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// rotateCA generates a new hierarchy with the names and defaults of a CA
+// and replaces the CA with it. With a cross-sign period the previous root
+// cross-signs the new one and stays trusted until the period ends.
+func (ca *MockCA) rotateCA(t *tenant, previous *issuingCA, crossSign time.Duration) (*issuingCA, error) {
+	now := ca.clock.Now()
+	notBefore := now.Add(-max(ca.config.CABackdate, ca.config.CertBackdate))
+	// Each generation has distinct names, as the roots of a real rollover,
+	// so clients can tell the cross-signed root from the previous one
+	generation := previous.generation + 1
+	suffix := fmt.Sprintf(" G%d", generation)
+	rootCN := previous.rootCert.Subject.CommonName
+	if previous.generation > 1 {
+		rootCN = strings.TrimSuffix(rootCN, fmt.Sprintf(" G%d", previous.generation))
+	}
+	_, intermediateCN := caCommonNames(ca.config, previous.name)
+	rotated, err := newIssuingCA(ca.logger, ca.random, ca.config, previous.name, rootCN+suffix, intermediateCN+suffix, notBefore)
+	if err != nil {
+		return nil, err
+	}
+	rotated.generation = generation
+	rotated.subjectDefaults = previous.subjectDefaults
+	rotated.certValidityDays = previous.certValidityDays
+
+	if crossSign > 0 {
+		serialNumber, err := generateSerialNumber(ca.random)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate serial: %w", err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:          serialNumber,
+			Subject:               rotated.rootCert.Subject,
+			NotBefore:             notBefore,
+			NotAfter:              now.Add(crossSign),
+			KeyUsage:              rotated.rootCert.KeyUsage,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			MaxPathLen:            rotated.rootCert.MaxPathLen,
+			MaxPathLenZero:        rotated.rootCert.MaxPathLenZero,
+		}
+		crossDER, err := x509.CreateCertificate(rand.Reader, template, previous.rootCert, &rotated.rootKey.PublicKey, previous.rootKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to cross-sign the new root: %w", err)
+		}
+		rotated.crossPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crossDER})
+		rotated.previousRootPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: previous.rootCert.Raw})
+		rotated.crossSignedUntil = template.NotAfter
+	}
+
+	ca.caMu.Lock()
+	defer ca.caMu.Unlock()
+	switch {
+	case t != nil:
+		if t.ca != previous {
+			return nil, errConcurrentRotation
+		}
+		t.ca = rotated
+	case previous.name == "":
+		if ca.issuingCA != previous {
+			return nil, errConcurrentRotation
+		}
+		ca.issuingCA = rotated
+	default:
+		if ca.cas[previous.name] != previous {
+			return nil, errConcurrentRotation
+		}
+		ca.cas[previous.name] = rotated
+	}
+
+	ca.logger.Info("CA rotated",
+		"name", rotated.name,
+		"root_serial", rotated.rootCert.SerialNumber.String(),
+		"previous_root_serial", previous.rootCert.SerialNumber.String(),
+		"cross_sign_period", crossSign,
+	)
+	return rotated, nil
+}
+
+// trustPEM returns the root certificates to trust: the root, followed by
+// the previous root during a cross-sign period
+func (issuer *issuingCA) trustPEM(now time.Time) []byte {
+	if !issuer.crossSigned(now) {
+		return issuer.rootPEM
+	}
+	return append(append([]byte{}, issuer.rootPEM...), issuer.previousRootPEM...)
+}
+
+// withCrossSigned ends a chain with the root cross-signed by the previous
+// root instead of the self-signed root during a cross-sign period, so it
+// verifies up to either root
+func (issuer *issuingCA) withCrossSigned(chain []byte, now time.Time) []byte {
+	if !issuer.crossSigned(now) {
+		return chain
+	}
+	chain = bytes.TrimSuffix(chain, issuer.rootPEM)
+	return append(append([]byte{}, chain...), issuer.crossPEM...)
+}
+
+// crossSigned reports whether the CA is in the cross-sign period of a rotation
+func (issuer *issuingCA) crossSigned(now time.Time) bool {
+	return issuer.crossPEM != nil && now.Before(issuer.crossSignedUntil)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	mathrand "math/rand/v2"
+	"sync"
+	"time"
+
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+// seedTime is the time the clock stands still at with -seed
+var seedTime = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// seededReader is a deterministic source of randomness for -seed. Reads are
+// serialized, so the same requests sent one after another get the same
+// serial numbers, keys and order IDs on every run.
+type seededReader struct {
+	mu  sync.Mutex
+	rng *mathrand.ChaCha8
+}
+
+// newRandom returns the source of serial numbers, keys and order IDs: a
+// seeded reader when seed is not 0, crypto/rand otherwise
+func newRandom(seed int64) io.Reader {
+	if seed == 0 {
+		return rand.Reader
+	}
+	var key [32]byte
+	binary.BigEndian.PutUint64(key[:], uint64(seed))
+	return &seededReader{rng: mathrand.NewChaCha8(key)}
+}
+
+// newSeedClock returns the clock of -seed, standing still at seedTime so
+// validity periods are the same on every run
+func newSeedClock() *testingclock.FakeClock {
+	return testingclock.NewFakeClock(seedTime)
+}
+
+func (r *seededReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rng.Read(p)
+}
+
+// generateKey generates an RSA key. crypto/rsa ignores readers other than
+// crypto/rand, so keys from a seeded reader come from a prime search of
+// their own.
+func generateKey(random io.Reader, bits int) (*rsa.PrivateKey, error) {
+	if _, ok := random.(*seededReader); !ok {
+		return rsa.GenerateKey(random, bits)
+	}
+	e := big.NewInt(65537)
+	one := big.NewInt(1)
+	for {
+		p, err := seededPrime(random, bits/2)
+		if err != nil {
+			return nil, err
+		}
+		q, err := seededPrime(random, bits-bits/2)
+		if err != nil {
+			return nil, err
+		}
+		n := new(big.Int).Mul(p, q)
+		if p.Cmp(q) == 0 || n.BitLen() != bits {
+			continue
+		}
+		phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		d := new(big.Int).ModInverse(e, phi)
+		if d == nil {
+			continue
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: int(e.Int64())},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		key.Precompute()
+		return key, key.Validate()
+	}
+}
+
+// seededPrime returns the first prime of bits bits, with the two top bits
+// set, from a random starting point
+func seededPrime(random io.Reader, bits int) (*big.Int, error) {
+	if bits < 16 {
+		return nil, errors.New("prime size must be at least 16 bits")
+	}
+	b := make([]byte, (bits+7)/8)
+	if _, err := io.ReadFull(random, b); err != nil {
+		return nil, err
+	}
+	p := new(big.Int).SetBytes(b)
+	p.Rsh(p, uint(len(b)*8-bits))
+	p.SetBit(p, bits-1, 1)
+	p.SetBit(p, bits-2, 1)
+	p.SetBit(p, 0, 1)
+	two := big.NewInt(2)
+	for ; p.BitLen() == bits; p.Add(p, two) {
+		if p.ProbablyPrime(20) {
+			return p, nil
+		}
+	}
+	// No prime above the starting point: start over
+	return seededPrime(random, bits)
+}
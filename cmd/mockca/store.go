@@ -0,0 +1,494 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/revocation"
+	"k8s.io/utils/clock"
+)
+
+// certStore holds issued certificates, indexed by serial number and, for the
+// legacy PKI endpoint, by subject CN. It is safe for concurrent use and can
+// optionally persist its contents to a JSON file so they survive restarts.
+//
+// Revocation records are kept separately and are never evicted, so a serial
+// stays revoked after its certificate has left the store. Only records with
+// reason certificateHold are removed again, when the hold is released.
+type certStore struct {
+	mu       sync.RWMutex
+	bySerial map[string]*issuedCert
+	byCN     map[string]*storedCert
+	revoked  map[string]*revocationRecord
+
+	// path is the JSON file used for persistence ("" disables persistence)
+	path string
+	// maxSize is the maximum number of issued certificates kept, least
+	// recently used evicted first (0 = unlimited)
+	maxSize int
+	// ttl is how long issued certificates are kept (0 = forever)
+	ttl time.Duration
+	// flushInterval is how often changes are written to the file (0 = after
+	// every change); dirty records unwritten changes
+	flushInterval time.Duration
+	dirty         bool
+
+	clock  clock.Clock
+	logger *slog.Logger
+}
+
+// revocationRecord records the revocation of a serial number
+type revocationRecord struct {
+	SerialNumber string    `json:"serial_number"`
+	RevokedAt    time.Time `json:"revoked_at"`
+	Reason       string    `json:"reason,omitempty"`
+	// ReasonCode is the RFC 5280 CRLReason code of Reason
+	ReasonCode int `json:"reason_code"`
+	// Issuer is the subject of the CA that issued the certificate, listing it on that CA's CRL
+	Issuer string `json:"issuer,omitempty"`
+}
+
+// held reports whether the revocation is a hold that can be released
+func (r *revocationRecord) held() bool {
+	return r.Reason == revocation.CertificateHold
+}
+
+// storeFile is the on-disk representation of the certificate store
+type storeFile struct {
+	Certificates []persistedCert       `json:"certificates"`
+	Legacy       map[string]storedCert `json:"legacy,omitempty"`
+	Revocations  []revocationRecord    `json:"revocations,omitempty"`
+}
+
+// persistedCert is the on-disk representation of an issued certificate
+type persistedCert struct {
+	CertPEM  string    `json:"certificate"`
+	IssuedAt time.Time `json:"issued_at"`
+	LastUsed time.Time `json:"last_used,omitempty"`
+}
+
+// newCertStore creates a certificate store, loading persisted contents from path if set
+func newCertStore(path string, maxSize int, ttl, flushInterval time.Duration, clk clock.Clock, logger *slog.Logger) (*certStore, error) {
+	s := &certStore{
+		bySerial:      make(map[string]*issuedCert),
+		byCN:          make(map[string]*storedCert),
+		revoked:       make(map[string]*revocationRecord),
+		path:          path,
+		maxSize:       maxSize,
+		ttl:           ttl,
+		flushInterval: flushInterval,
+		clock:         clk,
+		logger:        logger,
+	}
+
+	if path != "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// recordIssued stores a newly issued certificate keyed by its serial number
+func (s *certStore) recordIssued(certDER []byte) {
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		s.logger.Error("Failed to record issued certificate", "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	s.bySerial[cert.SerialNumber.String()] = &issuedCert{
+		Cert:     cert,
+		CertPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+		IssuedAt: now,
+		LastUsed: now,
+	}
+	s.evictLocked()
+	s.changedLocked()
+}
+
+// putLegacy stores the certificate, key and CSR for a legacy PKI subject CN
+func (s *certStore) putLegacy(cn string, stored *storedCert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.byCN[cn] = stored
+	s.changedLocked()
+}
+
+// getLegacy returns the legacy PKI entry for a subject CN
+func (s *certStore) getLegacy(cn string) (*storedCert, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, exists := s.byCN[cn]
+	return stored, exists
+}
+
+// get returns the issued certificate with the given serial number and marks
+// it as used, so it is evicted last
+func (s *certStore) get(serial string) (*issuedCert, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, exists := s.bySerial[serial]
+	if !exists || s.expired(c) {
+		return nil, false
+	}
+	c.LastUsed = s.clock.Now()
+	return c, true
+}
+
+// list returns all issued certificates, oldest first
+func (s *certStore) list() []*issuedCert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	certs := make([]*issuedCert, 0, len(s.bySerial))
+	for _, c := range s.bySerial {
+		if !s.expired(c) {
+			certs = append(certs, c)
+		}
+	}
+	sortByIssuance(certs)
+	return certs
+}
+
+// delete removes an issued certificate and any legacy entry pointing at it
+func (s *certStore) delete(serial string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.bySerial[serial]; !exists {
+		return false
+	}
+	s.deleteLocked(serial)
+	s.changedLocked()
+	return true
+}
+
+// clear removes all certificates and revocation records and returns how many
+// issued certificates were removed
+func (s *certStore) clear() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := len(s.bySerial)
+	s.bySerial = make(map[string]*issuedCert)
+	s.byCN = make(map[string]*storedCert)
+	s.revoked = make(map[string]*revocationRecord)
+	s.changedLocked()
+	return count
+}
+
+// revoke records the revocation of a stored certificate with a reason name
+// and code. Revoking a serial again returns the existing record, unless a
+// held certificate is now revoked for good; unknown serials are not found.
+func (s *certStore) revoke(serial, reason string, code int) (record *revocationRecord, found bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, revoked := s.revoked[serial]
+	if revoked && (!existing.held() || reason == revocation.CertificateHold) {
+		return existing, true
+	}
+	// A held certificate stays revocable after leaving the store
+	c, exists := s.bySerial[serial]
+	if !revoked && (!exists || s.expired(c)) {
+		return nil, false
+	}
+	record = &revocationRecord{SerialNumber: serial, RevokedAt: s.clock.Now().UTC(), Reason: reason, ReasonCode: code}
+	if revoked {
+		record.Issuer = existing.Issuer
+	} else {
+		record.Issuer = c.Cert.Issuer.String()
+	}
+	s.revoked[serial] = record
+	s.changedLocked()
+	return record, true
+}
+
+// unhold releases a held certificate, removing its revocation record. It
+// reports whether the serial was held, and whether it is known at all.
+func (s *certStore) unhold(serial string) (record *revocationRecord, held, found bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.revoked[serial]; ok {
+		if !record.held() {
+			return record, false, true
+		}
+		delete(s.revoked, serial)
+		s.changedLocked()
+		return record, true, true
+	}
+	c, exists := s.bySerial[serial]
+	return nil, false, exists && !s.expired(c)
+}
+
+// revocation returns the revocation record of a serial, if it was revoked
+func (s *certStore) revocation(serial string) (*revocationRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.revoked[serial]
+	return record, ok
+}
+
+// revocations returns all revocation records, oldest first
+func (s *certStore) revocations() []revocationRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]revocationRecord, 0, len(s.revoked))
+	for _, record := range s.revoked {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].RevokedAt.Equal(records[j].RevokedAt) {
+			return records[i].SerialNumber < records[j].SerialNumber
+		}
+		return records[i].RevokedAt.Before(records[j].RevokedAt)
+	})
+	return records
+}
+
+// size returns the number of stored certificates and revocation records
+func (s *certStore) size() (certificates, revocations int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.bySerial), len(s.revoked)
+}
+
+// sweep evicts expired certificates every interval for the lifetime of the
+// server, so the store shrinks even while nothing is issued
+func (s *certStore) sweep(interval time.Duration) {
+	for range s.clock.Tick(interval) {
+		s.mu.Lock()
+		if s.evictLocked() > 0 {
+			s.changedLocked()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// deleteLocked removes an issued certificate; the caller must hold the write lock
+func (s *certStore) deleteLocked(serial string) {
+	delete(s.bySerial, serial)
+	for cn, legacy := range s.byCN {
+		if legacy.Serial == serial {
+			delete(s.byCN, cn)
+		}
+	}
+}
+
+// expired reports whether an issued certificate is older than the store TTL
+func (s *certStore) expired(c *issuedCert) bool {
+	return s.ttl > 0 && s.clock.Since(c.IssuedAt) > s.ttl
+}
+
+// evictLocked drops expired certificates and then the least recently used
+// ones until the store is within its size limit, returning how many were
+// dropped; the caller must hold the write lock
+func (s *certStore) evictLocked() int {
+	expired, overflow := 0, 0
+
+	if s.ttl > 0 {
+		for serial, c := range s.bySerial {
+			if s.expired(c) {
+				s.deleteLocked(serial)
+				expired++
+			}
+		}
+	}
+
+	if s.maxSize > 0 && len(s.bySerial) > s.maxSize {
+		certs := make([]*issuedCert, 0, len(s.bySerial))
+		for _, c := range s.bySerial {
+			certs = append(certs, c)
+		}
+		sort.Slice(certs, func(i, j int) bool {
+			if certs[i].LastUsed.Equal(certs[j].LastUsed) {
+				return certs[i].Cert.SerialNumber.Cmp(certs[j].Cert.SerialNumber) < 0
+			}
+			return certs[i].LastUsed.Before(certs[j].LastUsed)
+		})
+		for _, c := range certs[:len(certs)-s.maxSize] {
+			s.deleteLocked(c.Cert.SerialNumber.String())
+			overflow++
+		}
+	}
+
+	if expired+overflow > 0 {
+		storeEvictions.WithLabelValues("ttl").Add(float64(expired))
+		storeEvictions.WithLabelValues("size").Add(float64(overflow))
+		s.logger.Debug("Evicted issued certificates from store", "expired", expired, "over_size", overflow, "remaining", len(s.bySerial))
+	}
+	return expired + overflow
+}
+
+// load reads persisted contents from the store file; a missing file is not an error
+func (s *certStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read store file %s: %w", s.path, err)
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse store file %s: %w", s.path, err)
+	}
+
+	for _, pc := range file.Certificates {
+		block, _ := pem.Decode([]byte(pc.CertPEM))
+		if block == nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			s.logger.Warn("Skipping unparseable certificate in store file", "error", err)
+			continue
+		}
+		lastUsed := pc.LastUsed
+		if lastUsed.IsZero() {
+			lastUsed = pc.IssuedAt
+		}
+		s.bySerial[cert.SerialNumber.String()] = &issuedCert{
+			Cert:     cert,
+			CertPEM:  []byte(pc.CertPEM),
+			IssuedAt: pc.IssuedAt,
+			LastUsed: lastUsed,
+		}
+	}
+	for _, record := range file.Revocations {
+		record := record
+		// Records written before reason codes were kept carry only the name
+		if name, code, err := revocation.Parse(record.Reason); record.Reason != "" && err == nil {
+			record.Reason, record.ReasonCode = name, code
+		}
+		s.revoked[record.SerialNumber] = &record
+	}
+	for cn, legacy := range file.Legacy {
+		legacy := legacy
+		s.byCN[cn] = &legacy
+	}
+
+	s.evictLocked()
+	s.logger.Info("Loaded certificate store", "path", s.path, "certificates", len(s.bySerial), "revocations", len(s.revoked))
+	return nil
+}
+
+// changedLocked records a change of the store contents, written to the store
+// file by the next flush or, without a flush interval, right away; the caller
+// must hold the write lock
+func (s *certStore) changedLocked() {
+	if s.path == "" {
+		return
+	}
+	s.dirty = true
+	if s.flushInterval <= 0 {
+		s.flushLocked()
+	}
+}
+
+// flush writes unwritten changes to the store file, as on shutdown
+func (s *certStore) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushLocked()
+}
+
+// flushLocked writes unwritten changes to the store file, keeping them
+// pending if that fails so the next flush retries; the caller must hold the
+// write lock
+func (s *certStore) flushLocked() {
+	if s.dirty && s.saveLocked() {
+		s.dirty = false
+	}
+}
+
+// flushEvery writes changes to the store file every flush interval of clk,
+// so bursts of issuance rewrite the file once rather than per certificate
+func (s *certStore) flushEvery(clk clock.Clock) {
+	for range clk.Tick(s.flushInterval) {
+		s.flush()
+	}
+}
+
+// saveLocked writes the store contents to the store file atomically,
+// reporting whether it succeeded; the caller must hold the write lock.
+// Failures are logged, not returned, so a full disk does not break signing.
+func (s *certStore) saveLocked() bool {
+	if s.path == "" {
+		return true
+	}
+
+	file := storeFile{
+		Certificates: make([]persistedCert, 0, len(s.bySerial)),
+		Legacy:       make(map[string]storedCert, len(s.byCN)),
+	}
+	for _, c := range s.bySerial {
+		file.Certificates = append(file.Certificates, persistedCert{CertPEM: string(c.CertPEM), IssuedAt: c.IssuedAt, LastUsed: c.LastUsed})
+	}
+	for _, record := range s.revoked {
+		file.Revocations = append(file.Revocations, *record)
+	}
+	for cn, legacy := range s.byCN {
+		file.Legacy[cn] = *legacy
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		s.logger.Error("Failed to encode certificate store", "error", err)
+		return false
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".mockca-store-*")
+	if err != nil {
+		s.logger.Error("Failed to persist certificate store", "path", s.path, "error", err)
+		return false
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		s.logger.Error("Failed to persist certificate store", "path", s.path, "error", err)
+		return false
+	}
+	if err := tmp.Close(); err != nil {
+		s.logger.Error("Failed to persist certificate store", "path", s.path, "error", err)
+		return false
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		s.logger.Error("Failed to persist certificate store", "path", s.path, "error", err)
+		return false
+	}
+	return true
+}
+
+// sortByIssuance orders certificates oldest first, breaking ties by serial
+func sortByIssuance(certs []*issuedCert) {
+	sort.Slice(certs, func(i, j int) bool {
+		if certs[i].IssuedAt.Equal(certs[j].IssuedAt) {
+			return certs[i].Cert.SerialNumber.Cmp(certs[j].Cert.SerialNumber) < 0
+		}
+		return certs[i].IssuedAt.Before(certs[j].IssuedAt)
+	})
+}
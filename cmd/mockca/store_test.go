@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/revocation"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+var testStart = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// testLogger discards the log
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// testCertificateDER returns a self-signed certificate with a serial number
+func testCertificateDER(t *testing.T, serial int64) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "app.example.com"},
+		NotBefore:    testStart,
+		NotAfter:     testStart.AddDate(1, 0, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestCertStoreTTL(t *testing.T) {
+	clk := clocktesting.NewFakeClock(testStart)
+	path := filepath.Join(t.TempDir(), "store.json")
+	store, err := newCertStore(path, 0, time.Hour, 0, clk, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.recordIssued(testCertificateDER(t, 1))
+	clk.Step(30 * time.Minute)
+	store.recordIssued(testCertificateDER(t, 2))
+	if _, found := store.revoke("2", revocation.KeyCompromise, 1); !found {
+		t.Fatal("certificate 2 not found for revocation")
+	}
+
+	// Retrieving a certificate doesn't extend its TTL, which counts from issuance
+	clk.Step(30 * time.Minute)
+	if _, ok := store.get("1"); !ok {
+		t.Fatal("certificate 1 expired at its TTL, want it kept until after")
+	}
+	clk.Step(time.Second)
+	if _, ok := store.get("1"); ok {
+		t.Fatal("certificate 1 returned after its TTL")
+	}
+	if certs := store.list(); len(certs) != 1 || certs[0].Cert.SerialNumber.Int64() != 2 {
+		t.Fatalf("listed %d certificates after the TTL of certificate 1, want certificate 2", len(certs))
+	}
+	if _, found := store.revoke("1", revocation.KeyCompromise, 1); found {
+		t.Fatal("expired certificate 1 was revoked")
+	}
+
+	// The sweep evicts expired certificates while nothing is issued
+	go store.sweep(time.Minute)
+	waitFor(t, clk.HasWaiters)
+	clk.Step(time.Minute)
+	waitFor(t, func() bool {
+		certificates, _ := store.size()
+		return certificates == 1
+	})
+
+	// Certificates that expired while the server was down are evicted on
+	// load; revocations outlive their certificates
+	later := clocktesting.NewFakeClock(clk.Now().Add(30 * time.Minute))
+	reloaded, err := newCertStore(path, 0, time.Hour, 0, later, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certificates, revocations := reloaded.size(); certificates != 0 || revocations != 1 {
+		t.Fatalf("reloaded store holds %d certificates and %d revocations, want 0 and 1", certificates, revocations)
+	}
+	if _, revoked := reloaded.revocation("2"); !revoked {
+		t.Fatal("revocation of evicted certificate 2 was lost")
+	}
+}
+
+func TestCertStoreFlush(t *testing.T) {
+	clk := clocktesting.NewFakeClock(testStart)
+	dir := filepath.Join(t.TempDir(), "store")
+	path := filepath.Join(dir, "store.json")
+	store, err := newCertStore(path, 0, 0, 5*time.Second, clk, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	persisted := func() (certificates, revocations int) {
+		t.Helper()
+		reloaded, err := newCertStore(path, 0, 0, 0, clk, testLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reloaded.size()
+	}
+
+	// A burst of issuance is written by the next flush, not per certificate.
+	// The first flush fails as the directory is missing; the changes stay
+	// pending for the next.
+	for serial := int64(1); serial <= 3; serial++ {
+		store.recordIssued(testCertificateDER(t, serial))
+	}
+	store.flush()
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if certificates, _ := persisted(); certificates != 0 {
+		t.Fatalf("%d certificates written before the flush, want 0", certificates)
+	}
+	go store.flushEvery(clk)
+	waitFor(t, clk.HasWaiters)
+	clk.Step(5 * time.Second)
+	waitFor(t, func() bool {
+		certificates, _ := persisted()
+		return certificates == 3
+	})
+
+	// Changes after the last periodic flush are written by the shutdown flush
+	store.revoke("2", revocation.KeyCompromise, 1)
+	if _, revocations := persisted(); revocations != 0 {
+		t.Fatal("revocation written before the flush")
+	}
+	store.flush()
+	if certificates, revocations := persisted(); certificates != 3 || revocations != 1 {
+		t.Fatalf("flushed store holds %d certificates and %d revocations, want 3 and 1", certificates, revocations)
+	}
+}
+
+func TestCertStoreWithoutTTL(t *testing.T) {
+	clk := clocktesting.NewFakeClock(testStart)
+	store, err := newCertStore("", 0, 0, 0, clk, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.recordIssued(testCertificateDER(t, 1))
+	clk.Step(10 * 365 * 24 * time.Hour)
+	if _, ok := store.get("1"); !ok {
+		t.Fatal("certificate evicted from a store without TTL")
+	}
+}
+
+func TestMockCABackdate(t *testing.T) {
+	ca, clk := testMockCA(t)
+	if want := testStart.Add(-2 * time.Hour); !ca.caCert.NotBefore.Equal(want) {
+		t.Errorf("CA NotBefore %s, want %s", ca.caCert.NotBefore, want)
+	}
+
+	// Certificates are backdated from the clock's time of issuance
+	clk.Step(24 * time.Hour)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "app.example.com"},
+		DNSNames: []string{"app.example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(SignRequest{
+		CSR:          string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		ValidityDays: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/sign", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	ca.handleSign(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("signing failed with %d: %s", recorder.Code, recorder.Body)
+	}
+	var response SignResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode([]byte(response.Certificate))
+	if block == nil {
+		t.Fatalf("no certificate in response %s", recorder.Body)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clk.Now().Add(-5 * time.Minute); !cert.NotBefore.Equal(want) {
+		t.Errorf("certificate NotBefore %s, want %s", cert.NotBefore, want)
+	}
+	if want := clk.Now().AddDate(0, 0, 2); !cert.NotAfter.Equal(want) {
+		t.Errorf("certificate NotAfter %s, want %s", cert.NotAfter, want)
+	}
+	if _, ok := ca.store.get(cert.SerialNumber.String()); !ok {
+		t.Error("issued certificate not stored")
+	}
+}
+
+var (
+	mockCAOnce  sync.Once
+	mockCA      *MockCA
+	mockCAClock *clocktesting.FakeClock
+	mockCAErr   error
+)
+
+// testMockCA returns a Mock CA created at testStart, backdating certificates
+// by 5m and the CA by 2h. It is shared by the tests, as its metrics can be
+// registered only once per process.
+func testMockCA(t *testing.T) (*MockCA, *clocktesting.FakeClock) {
+	t.Helper()
+	mockCAOnce.Do(func() {
+		mockCAClock = clocktesting.NewFakeClock(testStart)
+		mockCA, mockCAErr = NewMockCA(&Config{
+			CACN:             "Test CA",
+			CAOrg:            "Test",
+			CAValidityYrs:    10,
+			CertValidityDays: 365,
+			CertBackdate:     5 * time.Minute,
+			CABackdate:       2 * time.Hour,
+			ChainMode:        "root",
+			DefaultProfile:   "server",
+			CAParam:          "ca",
+			Clock:            mockCAClock,
+		}, testLogger())
+	})
+	if mockCAErr != nil {
+		t.Fatal(mockCAErr)
+	}
+	return mockCA, mockCAClock
+}
+
+// waitFor waits for a condition set by another goroutine
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 5s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
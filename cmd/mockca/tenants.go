@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tenant is a team sharing the Mock CA. Each tenant has its own CA
+// hierarchy, so certificates issued for one team's e2e environment are never
+// trusted by another's. Requests belong to a tenant by path prefix or API key.
+type tenant struct {
+	Name string `json:"name"`
+	// PathPrefix routes requests below it to the tenant, e.g. /team-a/api/v1/sign
+	PathPrefix string `json:"pathPrefix,omitempty"`
+	// APIKey identifies the tenant's requests in the -tenant-key-header header
+	APIKey string `json:"apiKey,omitempty"`
+	// CACommonName is the common name of the tenant's root CA
+	// (default: -ca-cn followed by the tenant name)
+	CACommonName string `json:"caCommonName,omitempty"`
+	// Subject fills attributes missing from the subjects of issued certificates
+	Subject *tenantSubject `json:"subject,omitempty"`
+	// CertValidityDays replaces -cert-validity for the tenant
+	CertValidityDays int `json:"certValidityDays,omitempty"`
+
+	// ca is the tenant's CA hierarchy
+	ca *issuingCA
+}
+
+// tenantSubject are subject attributes of a tenant's certificates
+type tenantSubject struct {
+	Organization       []string `json:"organization,omitempty"`
+	OrganizationalUnit []string `json:"organizationalUnit,omitempty"`
+	Country            []string `json:"country,omitempty"`
+	Province           []string `json:"province,omitempty"`
+	Locality           []string `json:"locality,omitempty"`
+}
+
+// tenantContextKey is the context key of a request's tenant
+type tenantContextKey struct{}
+
+// loadTenants reads and validates the tenants of a -tenants file
+func loadTenants(path string) ([]*tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file: %w", err)
+	}
+	var tenants []*tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants file %s: %w", path, err)
+	}
+
+	names, prefixes, keys := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for i, t := range tenants {
+		if t.Name == "" || names[t.Name] {
+			return nil, fmt.Errorf("tenant %d: names must be unique and not empty, got %q", i, t.Name)
+		}
+		names[t.Name] = true
+		if t.PathPrefix == "" && t.APIKey == "" {
+			return nil, fmt.Errorf("tenant %s: pathPrefix or apiKey is required", t.Name)
+		}
+		if t.PathPrefix != "" {
+			t.PathPrefix = "/" + strings.Trim(t.PathPrefix, "/")
+			if t.PathPrefix == "/" || prefixes[t.PathPrefix] {
+				return nil, fmt.Errorf("tenant %s: path prefix %q is not unique or empty", t.Name, t.PathPrefix)
+			}
+			prefixes[t.PathPrefix] = true
+		}
+		if t.APIKey != "" {
+			if keys[t.APIKey] {
+				return nil, fmt.Errorf("tenant %s: API key is used by another tenant", t.Name)
+			}
+			keys[t.APIKey] = true
+		}
+		if t.CertValidityDays < 0 {
+			return nil, fmt.Errorf("tenant %s: certificate validity must not be negative", t.Name)
+		}
+	}
+	return tenants, nil
+}
+
+// newTenantCA generates the CA hierarchy of a tenant
+func newTenantCA(ca *MockCA, t *tenant, notBefore time.Time) (*issuingCA, error) {
+	rootCN, intermediateCN := caCommonNames(ca.config, t.Name)
+	if t.CACommonName != "" {
+		rootCN = t.CACommonName
+	}
+	issuer, err := newIssuingCA(ca.logger, ca.random, ca.config, t.Name, rootCN, intermediateCN, notBefore)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", t.Name, err)
+	}
+	issuer.certValidityDays = t.CertValidityDays
+	if s := t.Subject; s != nil {
+		issuer.subjectDefaults = pkix.Name{
+			Organization:       s.Organization,
+			OrganizationalUnit: s.OrganizationalUnit,
+			Country:            s.Country,
+			Province:           s.Province,
+			Locality:           s.Locality,
+		}
+	}
+	return issuer, nil
+}
+
+// tenantNames returns the names of the tenants, sorted
+func (ca *MockCA) tenantNames() []string {
+	names := make([]string, 0, len(ca.tenants))
+	for _, t := range ca.tenants {
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requestTenant returns the tenant a request belongs to, nil if none
+func requestTenant(r *http.Request) *tenant {
+	t, _ := r.Context().Value(tenantContextKey{}).(*tenant)
+	return t
+}
+
+// tenantMiddleware assigns requests to tenants. A request below a tenant's
+// path prefix belongs to it, with the prefix stripped so the usual endpoints
+// serve it; otherwise the API key in -tenant-key-header decides. Unknown keys
+// are rejected rather than served by the default CA.
+func (ca *MockCA) tenantMiddleware(next http.Handler) http.Handler {
+	if len(ca.tenants) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var found *tenant
+		for _, t := range ca.tenants {
+			if t.PathPrefix == "" {
+				continue
+			}
+			if rest, ok := strings.CutPrefix(r.URL.Path, t.PathPrefix); ok && (rest == "" || rest[0] == '/') {
+				found = t
+				r = r.Clone(r.Context())
+				r.URL.Path, r.URL.RawPath = "/"+strings.TrimPrefix(rest, "/"), ""
+				break
+			}
+		}
+		if found == nil {
+			if key := r.Header.Get(ca.config.TenantKeyHeader); key != "" {
+				for _, t := range ca.tenants {
+					if t.APIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(t.APIKey)) == 1 {
+						found = t
+					}
+				}
+				if found == nil {
+					ca.sendError(w, http.StatusForbidden, "UNKNOWN_TENANT", "Unknown tenant API key", "header "+ca.config.TenantKeyHeader)
+					return
+				}
+			}
+		}
+		if found != nil {
+			r = r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, found))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/version"
+)
+
+//go:embed ui/index.html
+var uiHTML string
+
+// uiTemplate renders the dashboard page
+var uiTemplate = template.Must(template.New("ui").Parse(uiHTML))
+
+// uiData configures the dashboard page. It holds no credentials: the page
+// asks for them and sends them with its requests to the JSON API.
+type uiData struct {
+	Version        string
+	AuthType       string
+	AuthHeaderName string
+}
+
+// handleUI serves the web dashboard
+//
+//	GET /ui - Dashboard of issued certificates, the CA chain and recent requests
+//
+// The page itself is static and unauthenticated; it loads its data from the
+// authenticated JSON API, and revokes and deletes certificates through it.
+func (ca *MockCA) handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ca.sendError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only GET method is supported", "")
+		return
+	}
+	authType := ca.config.AuthType
+	if authType == "" {
+		authType = "none"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	if err := uiTemplate.Execute(w, uiData{Version: version.Version, AuthType: authType, AuthHeaderName: ca.config.AuthHeaderName}); err != nil {
+		ca.logger.Error("Failed to render dashboard", "error", err)
+	}
+}
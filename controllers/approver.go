@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// autoApproverReason is the reason of Approved conditions set by the auto-approver
+const autoApproverReason = "external-issuer.io"
+
+// ApproverReconciler approves CertificateRequests for our issuer types in
+// clusters without cert-manager's internal approver or approver-policy.
+// Requests are approved if both the namespace and the request itself match
+// the selectors; requests that don't match are left for another approver.
+type ApproverReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// NamespaceSelector selects namespaces by label (everything when nil)
+	NamespaceSelector labels.Selector
+
+	// RequestSelector selects CertificateRequests by label (everything when
+	// nil). It is not an authorization boundary: whoever can create a
+	// Certificate or CertificateRequest chooses its labels, so only the
+	// NamespaceSelector limits who gets certificates approved.
+	RequestSelector labels.Selector
+
+	// APIReader reads requests bypassing the cache when an approval conflicts
+	APIReader client.Reader
+
+	// DisableClusterIssuers skips requests for ExternalClusterIssuers
+	DisableClusterIssuers bool
+}
+
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests/status,verbs=patch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=signers,verbs=approve,resourceNames=externalissuers.external-issuer.io/*;externalclusterissuers.external-issuer.io/*
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+func (r *ApproverReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	cr := &cmapi.CertificateRequest{}
+	if err := r.Get(ctx, req.NamespacedName, cr); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !r.awaitingApproval(cr) {
+		return ctrl.Result{}, nil
+	}
+
+	if r.RequestSelector != nil && !r.RequestSelector.Matches(labels.Set(cr.Labels)) {
+		logger.V(1).Info("Not auto-approving CertificateRequest, labels don't match", "name", cr.Name)
+		return ctrl.Result{}, nil
+	}
+	if r.NamespaceSelector != nil {
+		ns := &corev1.Namespace{}
+		if err := r.Get(ctx, types.NamespacedName{Name: cr.Namespace}, ns); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to get namespace: %w", err)
+		}
+		if !r.NamespaceSelector.Matches(labels.Set(ns.Labels)) {
+			logger.V(1).Info("Not auto-approving CertificateRequest, namespace labels don't match", "name", cr.Name)
+			return ctrl.Result{}, nil
+		}
+	}
+
+	message := "Auto-approved by external-issuer"
+	approved, err := r.approve(ctx, cr, message)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to approve CertificateRequest: %w", err)
+	}
+	if !approved {
+		logger.Info("CertificateRequest was approved or denied meanwhile, leaving it", "name", cr.Name)
+		return ctrl.Result{}, nil
+	}
+
+	logger.Info("Auto-approved CertificateRequest", "name", cr.Name, "issuer", cr.Spec.IssuerRef.Name)
+	if r.Recorder != nil {
+		r.Recorder.Event(cr, corev1.EventTypeNormal, "AutoApproved", message)
+	}
+	return ctrl.Result{}, nil
+}
+
+// approve sets the Approved condition with a status patch, reporting whether
+// it did. On a conflict the latest request is read again and left alone if
+// it was approved or denied meanwhile, so another approver's decision or an
+// unrelated status write is never overwritten.
+func (r *ApproverReconciler) approve(ctx context.Context, cr *cmapi.CertificateRequest, message string) (bool, error) {
+	now := metav1.Now()
+	condition := cmapi.CertificateRequestCondition{
+		Type:               cmapi.CertificateRequestConditionApproved,
+		Status:             cmmeta.ConditionTrue,
+		Reason:             autoApproverReason,
+		Message:            message,
+		LastTransitionTime: &now,
+	}
+	approved := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		patch := client.MergeFromWithOptions(cr.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		cr.Status.Conditions = setCondition(cr.Status.Conditions, condition)
+		err := r.Status().Patch(ctx, cr, patch)
+		if !apierrors.IsConflict(err) {
+			approved = err == nil
+			return err
+		}
+
+		latest := &cmapi.CertificateRequest{}
+		if getErr := r.apiReader().Get(ctx, client.ObjectKeyFromObject(cr), latest); getErr != nil {
+			return getErr
+		}
+		*cr = *latest
+		if !r.awaitingApproval(cr) {
+			return nil
+		}
+		return err
+	})
+	return approved, err
+}
+
+// apiReader returns the reader for reads that must not be served from the cache
+func (r *ApproverReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// awaitingApproval reports whether a request is for one of our issuers and
+// has been neither approved nor denied
+func (r *ApproverReconciler) awaitingApproval(cr *cmapi.CertificateRequest) bool {
+	ref := cr.Spec.IssuerRef
+	if ref.Group != externalIssuerAPIGroup {
+		return false
+	}
+	if ref.Kind != issuerKind && (ref.Kind != clusterIssuerKind || r.DisableClusterIssuers) {
+		return false
+	}
+	return !isCertificateRequestApproved(cr) && !isCertificateRequestDenied(cr) && !isInTerminalState(cr)
+}
+
+// requestsInNamespace enqueues the pending requests of a namespace whose
+// labels changed, so they are approved once the namespace matches
+func (r *ApproverReconciler) requestsInNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	crs := &cmapi.CertificateRequestList{}
+	if err := r.List(ctx, crs, client.InNamespace(obj.GetName())); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list CertificateRequests for namespace", "namespace", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range crs.Items {
+		if r.awaitingApproval(&crs.Items[i]) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&crs.Items[i])})
+		}
+	}
+	return requests
+}
+
+func (r *ApproverReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named("approver").
+		For(&cmapi.CertificateRequest{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return r.awaitingApproval(obj.(*cmapi.CertificateRequest))
+		})))
+	if r.NamespaceSelector != nil {
+		b = b.Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.requestsInNamespace),
+			builder.WithPredicates(predicate.LabelChangedPredicate{}))
+	}
+	return b.Complete(tracedReconciler{name: "Approver", Reconciler: r})
+}
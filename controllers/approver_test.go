@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestApproverConflicts(t *testing.T) {
+	for name, tc := range map[string]struct {
+		// meanwhile is written to the request right before the approval
+		meanwhile    cmapi.CertificateRequestConditionType
+		status       cmmeta.ConditionStatus
+		wantApproved bool
+	}{
+		"no conflict":         {wantApproved: true},
+		"unrelated status":    {meanwhile: cmapi.CertificateRequestConditionReady, status: cmmeta.ConditionFalse, wantApproved: true},
+		"denied meanwhile":    {meanwhile: cmapi.CertificateRequestConditionDenied, status: cmmeta.ConditionTrue},
+		"approved by another": {meanwhile: cmapi.CertificateRequestConditionApproved, status: cmmeta.ConditionTrue},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cr := &cmapi.CertificateRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "app-tls-1", Namespace: testNamespace},
+				Spec: cmapi.CertificateRequestSpec{
+					IssuerRef: cmmeta.ObjectReference{Group: externalIssuerAPIGroup, Kind: issuerKind, Name: "pki"},
+				},
+			}
+			base := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(cr).
+				WithStatusSubresource(&cmapi.CertificateRequest{}).Build()
+			written := false
+			k8sClient := interceptor.NewClient(base, interceptor.Funcs{
+				SubResourcePatch: func(ctx context.Context, cl client.Client, subResource string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+					if tc.meanwhile != "" && !written {
+						written = true
+						latest := &cmapi.CertificateRequest{}
+						if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), latest); err != nil {
+							return err
+						}
+						latest.Status.Conditions = append(latest.Status.Conditions, cmapi.CertificateRequestCondition{
+							Type: tc.meanwhile, Status: tc.status, Reason: "Meanwhile",
+						})
+						if err := cl.Status().Update(ctx, latest); err != nil {
+							return err
+						}
+					}
+					return cl.SubResource(subResource).Patch(ctx, obj, patch, opts...)
+				},
+			})
+
+			approver := &ApproverReconciler{Client: k8sClient}
+			if _, err := approver.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cr)}); err != nil {
+				t.Fatal(err)
+			}
+
+			latest := &cmapi.CertificateRequest{}
+			if err := base.Get(context.Background(), client.ObjectKeyFromObject(cr), latest); err != nil {
+				t.Fatal(err)
+			}
+			var approvedBy string
+			for _, c := range latest.Status.Conditions {
+				if c.Type == cmapi.CertificateRequestConditionApproved {
+					approvedBy = c.Reason
+				}
+			}
+			if tc.wantApproved && approvedBy != autoApproverReason {
+				t.Errorf("request not auto-approved, conditions %+v", latest.Status.Conditions)
+			}
+			if !tc.wantApproved && approvedBy == autoApproverReason {
+				t.Errorf("request auto-approved over a decision made meanwhile, conditions %+v", latest.Status.Conditions)
+			}
+			for _, c := range latest.Status.Conditions {
+				if c.Type == tc.meanwhile {
+					return
+				}
+			}
+			if tc.meanwhile != "" {
+				t.Errorf("%s condition written meanwhile was overwritten, conditions %+v", tc.meanwhile, latest.Status.Conditions)
+			}
+		})
+	}
+}
+
+func TestWaitingForApprovalEventOnce(t *testing.T) {
+	cr := &cmapi.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-tls-1", Namespace: testNamespace},
+		Spec: cmapi.CertificateRequestSpec{
+			IssuerRef: cmmeta.ObjectReference{Group: externalIssuerAPIGroup, Kind: issuerKind, Name: "pki"},
+		},
+	}
+	k8sClient := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(cr).
+		WithStatusSubresource(&cmapi.CertificateRequest{}).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &CertificateRequestReconciler{Client: k8sClient, Scheme: testScheme(t), Recorder: recorder}
+
+	// Every status write reconciles the request again
+	for i := 0; i < 3; i++ {
+		if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cr)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(recorder.Events)
+	var events []string
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+	if len(events) != 1 || !strings.Contains(events[0], "WaitingForApproval") || strings.Contains(events[0], "--disable-approved-check") {
+		t.Fatalf("events %q, want one WaitingForApproval event pointing at an approver", events)
+	}
+
+	latest := &cmapi.CertificateRequest{}
+	if err := k8sClient.Get(context.Background(), client.ObjectKeyFromObject(cr), latest); err != nil {
+		t.Fatal(err)
+	}
+	if !hasReadyCondition(latest, cmapi.CertificateRequestReasonPending, "Waiting for the CertificateRequest to be approved") {
+		t.Errorf("conditions %+v, want Ready Pending waiting for approval", latest.Status.Conditions)
+	}
+}
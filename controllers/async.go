@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/audit"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	"github.com/bvorland/cert-manager-external-issuer/internal/tracing"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// orderIDAnnotation records the PKI order ID of an asynchronous signing request
+	orderIDAnnotation = "external-issuer.io/order-id"
+
+	// pollDeadlineAnnotation records when polling for the order gives up (RFC 3339)
+	pollDeadlineAnnotation = "external-issuer.io/poll-deadline"
+
+	// pollAttemptsAnnotation records how many polls have been made, driving the backoff
+	pollAttemptsAnnotation = "external-issuer.io/poll-attempts"
+
+	// nextPollAnnotation records when the order is polled next (RFC 3339)
+	nextPollAnnotation = "external-issuer.io/next-poll"
+)
+
+// AsyncSigner is implemented by signers whose backend may issue certificates
+// asynchronously. Sign returns a *signer.PendingError for such requests.
+type AsyncSigner interface {
+	Poll(ctx context.Context, orderID string) (certPEM []byte, caPEM []byte, err error)
+	AsyncConfig() *signer.PKIAsync
+}
+
+// asyncState is the in-flight state of an asynchronous signing request. It is
+// written to CertificateRequest annotations on every transition, so a
+// restarted controller resumes polling exactly where the previous one stopped.
+type asyncState struct {
+	OrderID  string
+	Deadline time.Time
+	Attempts int
+	NextPoll time.Time
+}
+
+// loadAsyncState reads the async state from annotations; nil means no order is in flight
+func loadAsyncState(cr *cmapi.CertificateRequest) (*asyncState, error) {
+	orderID := cr.Annotations[orderIDAnnotation]
+	deadline, inFlight := cr.Annotations[pollDeadlineAnnotation]
+	if orderID == "" || !inFlight {
+		return nil, nil
+	}
+
+	state := &asyncState{OrderID: orderID}
+	var err error
+	if state.Deadline, err = time.Parse(time.RFC3339, deadline); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", pollDeadlineAnnotation, err)
+	}
+	if v := cr.Annotations[pollAttemptsAnnotation]; v != "" {
+		if state.Attempts, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", pollAttemptsAnnotation, err)
+		}
+	}
+	if v := cr.Annotations[nextPollAnnotation]; v != "" {
+		if state.NextPoll, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", nextPollAnnotation, err)
+		}
+	}
+	return state, nil
+}
+
+// saveAsyncState persists the async state in annotations. A nil state ends
+// polling but keeps the order ID annotation for reference.
+func (r *CertificateRequestReconciler) saveAsyncState(ctx context.Context, cr *cmapi.CertificateRequest, state *asyncState) error {
+	patch := client.MergeFrom(cr.DeepCopy())
+	if cr.Annotations == nil {
+		cr.Annotations = map[string]string{}
+	}
+	if state == nil {
+		delete(cr.Annotations, pollDeadlineAnnotation)
+		delete(cr.Annotations, pollAttemptsAnnotation)
+		delete(cr.Annotations, nextPollAnnotation)
+	} else {
+		// The order ID supersedes the signing attempt
+		delete(cr.Annotations, signAttemptAnnotation)
+		cr.Annotations[orderIDAnnotation] = state.OrderID
+		cr.Annotations[pollDeadlineAnnotation] = state.Deadline.UTC().Format(time.RFC3339)
+		cr.Annotations[pollAttemptsAnnotation] = strconv.Itoa(state.Attempts)
+		cr.Annotations[nextPollAnnotation] = state.NextPoll.UTC().Format(time.RFC3339)
+	}
+	if err := r.Patch(ctx, cr, patch); err != nil {
+		return fmt.Errorf("failed to persist async signing state: %w", err)
+	}
+	return nil
+}
+
+// pollBackoff returns the delay before the next poll: the PKI's Retry-After if
+// given, otherwise the poll interval doubled per attempt, capped at the maximum
+func pollBackoff(config *signer.PKIAsync, attempts int, retryAfter time.Duration) time.Duration {
+	maxInterval := config.MaxPollInterval()
+	delay := retryAfter
+	if delay <= 0 {
+		delay = config.PollInterval()
+		for i := 0; i < attempts && delay < maxInterval; i++ {
+			delay *= 2
+		}
+	}
+	if delay > maxInterval {
+		delay = maxInterval
+	}
+	return delay
+}
+
+// startOrder records a newly accepted asynchronous order and schedules the first poll
+func (r *CertificateRequestReconciler) startOrder(ctx context.Context, cr *cmapi.CertificateRequest, asyncSigner AsyncSigner, pending *signer.PendingError) (ctrl.Result, error) {
+	config := asyncSigner.AsyncConfig()
+	now := clockOrReal(r.Clock).Now()
+	delay := pollBackoff(config, 0, pending.RetryAfter)
+	state := &asyncState{
+		OrderID:  pending.OrderID,
+		Deadline: now.Add(config.Timeout()),
+		NextPoll: now.Add(delay),
+	}
+
+	// Persist the order before anything else so a restart cannot lose it
+	if err := r.saveAsyncState(ctx, cr, state); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	log.FromContext(ctx).Info("Certificate issuance pending", "name", cr.Name, "orderID", state.OrderID, "nextPoll", delay)
+	message := fmt.Sprintf("Waiting for PKI to issue order %s", state.OrderID)
+	if config.Manual {
+		// Only a human can complete the ticket, so tell them how
+		message = fmt.Sprintf("Waiting for PKI ticket %s; paste the issued certificate into a Secret with key %s and annotation %s=%s",
+			state.OrderID, corev1.TLSCertKey, certificateRequestAnnotation, cr.Name)
+		r.issuanceEvent(cr, corev1.EventTypeNormal, "TicketCreated", "pki", message)
+	}
+	return ctrl.Result{RequeueAfter: delay}, r.setStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, message)
+}
+
+// pollOrder polls an in-flight asynchronous order, persisting the updated
+// state before scheduling the next attempt
+func (r *CertificateRequestReconciler) pollOrder(ctx context.Context, cr *cmapi.CertificateRequest, issuerSpec *externalissuerapi.ExternalIssuerSpec, certSigner Signer, state *asyncState) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// A certificate pasted by a human completes any pending order
+	if certPEM, caPEM, ok := r.pastedCertificate(ctx, cr); ok {
+		return r.completeOrder(ctx, cr, state, certPEM, caPEM)
+	}
+
+	asyncSigner, ok := certSigner.(AsyncSigner)
+	if !ok || asyncSigner.AsyncConfig() == nil {
+		return ctrl.Result{}, r.failOrder(ctx, cr, fmt.Sprintf("Order %s is pending but the issuer no longer supports asynchronous issuance", state.OrderID))
+	}
+
+	// Reconciles triggered by our own updates (or a restart) must not poll early
+	now := clockOrReal(r.Clock).Now()
+	if wait := state.NextPoll.Sub(now); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	// A poll exceeding the signingTimeout is retried like any transient error
+	timeoutCtx, cancelPoll := signingContext(ctx, issuerSpec)
+	defer cancelPoll()
+	pollCtx, span := tracing.Tracer().Start(timeoutCtx, "Signer.Poll", trace.WithAttributes(
+		attribute.String("signer.order_id", state.OrderID),
+		attribute.Int("signer.poll_attempt", state.Attempts+1),
+	))
+	certPEM, caPEM, err := asyncSigner.Poll(pollCtx, state.OrderID)
+	tracing.RecordError(span, err)
+	span.End()
+	if signingTimedOut(ctx, timeoutCtx, err) {
+		err = fmt.Errorf("poll did not finish within the issuer's signingTimeout of %s: %w", issuerSpec.SigningTimeout.Duration, err)
+	}
+	if err == nil {
+		logger.Info("Successfully signed certificate", "name", cr.Name, "orderID", state.OrderID, "attempts", state.Attempts+1)
+		return r.completeOrder(ctx, cr, state, certPEM, caPEM)
+	}
+
+	// A poll due at the deadline is the last, as no time is left to wait for another
+	if !now.Before(state.Deadline) {
+		logger.Error(err, "Gave up polling for certificate", "name", cr.Name, "orderID", state.OrderID)
+		return ctrl.Result{}, r.failOrder(ctx, cr, fmt.Sprintf("Order %s was not issued before %s: %v", state.OrderID, state.Deadline.Format(time.RFC3339), err))
+	}
+
+	// Transient errors are retried with the same backoff as pending responses,
+	// unless an error mapping of the PKI configuration says otherwise
+	var retryAfter time.Duration
+	var pending *signer.PendingError
+	var mapped *signer.MappedError
+	if errors.As(err, &pending) {
+		retryAfter = pending.RetryAfter
+	} else if errors.As(err, &mapped) {
+		logger.Error(err, "Failed to poll for certificate", "name", cr.Name, "orderID", state.OrderID, "reason", mapped.Reason, "retry", mapped.Retry)
+		if mapped.Retry == signer.RetryClassFail {
+			return ctrl.Result{}, r.failOrder(ctx, cr, fmt.Sprintf("Order %s failed: %s", state.OrderID, mapped.Message))
+		}
+		retryAfter = mapped.RetryAfter
+	} else {
+		logger.Error(err, "Failed to poll for certificate", "name", cr.Name, "orderID", state.OrderID)
+	}
+
+	state.Attempts++
+	delay := pollBackoff(asyncSigner.AsyncConfig(), state.Attempts, retryAfter)
+	if remaining := state.Deadline.Sub(now); delay > remaining {
+		delay = remaining
+	}
+	state.NextPoll = now.Add(delay)
+	if err := r.saveAsyncState(ctx, cr, state); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	logger.V(1).Info("Certificate still pending", "name", cr.Name, "orderID", state.OrderID, "attempts", state.Attempts, "nextPoll", delay)
+	return ctrl.Result{RequeueAfter: delay}, nil
+}
+
+// completeOrder records the certificate of a finished order and ends polling
+func (r *CertificateRequestReconciler) completeOrder(ctx context.Context, cr *cmapi.CertificateRequest, state *asyncState, certPEM, caPEM []byte) (ctrl.Result, error) {
+	// Record the certificate first: once it is stored the request is
+	// terminal, whereas clearing the state first could let a restart
+	// between the two writes submit the CSR again
+	recorded, err := r.recordCertificate(ctx, cr, certPEM, caPEM)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if recorded {
+		r.issuanceEvent(cr, corev1.EventTypeNormal, "Issued", "pki", "Certificate issued for order "+state.OrderID)
+		r.recordIssuance(ctx, cr, clockOrReal(r.Clock).Now())
+		r.audit(ctx, cr, audit.ResultIssued, "")
+		r.exportIssued(ctx, cr)
+		r.runHooks(ctx, cr)
+	}
+	if err := r.saveAsyncState(ctx, cr, nil); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to clear async signing state", "name", cr.Name, "orderID", state.OrderID)
+	}
+	return ctrl.Result{}, nil
+}
+
+// failOrder marks the CertificateRequest as failed and ends polling. The
+// failure is recorded first, as for completed orders: clearing the state
+// first would let a restart between the two writes submit the CSR again.
+func (r *CertificateRequestReconciler) failOrder(ctx context.Context, cr *cmapi.CertificateRequest, message string) error {
+	if err := r.setFailed(ctx, cr, message); err != nil {
+		return err
+	}
+	if err := r.saveAsyncState(ctx, cr, nil); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to clear async signing state", "name", cr.Name)
+	}
+	return nil
+}
@@ -0,0 +1,483 @@
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+const (
+	testNamespace = "default"
+	testRequest   = "app-tls-1"
+	testOrderID   = "order-1"
+)
+
+// killed is raised by a write the controller is killed at
+type killed struct{}
+
+// fakePKI is an asynchronous PKI API that accepts every CSR as an order and
+// answers polls with the certificate once issued is set
+type fakePKI struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	submits  int
+	polls    int
+	issued   bool
+	rejected bool
+	certPEM  []byte
+}
+
+func newFakePKI(t *testing.T) *fakePKI {
+	pki := &fakePKI{certPEM: selfSignedCertificate(t, time.Now(), 24*time.Hour)}
+	pki.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		pki.mu.Lock()
+		defer pki.mu.Unlock()
+		switch {
+		case req.Method == http.MethodPost:
+			pki.submits++
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, `{"order_id": %q}`, testOrderID)
+		case strings.HasPrefix(req.URL.Path, "/orders/"):
+			pki.polls++
+			switch {
+			case pki.rejected:
+				http.Error(w, "order rejected", http.StatusBadRequest)
+			case pki.issued:
+				w.Write(pki.certPEM)
+			default:
+				w.WriteHeader(http.StatusAccepted)
+				fmt.Fprintf(w, `{"order_id": %q}`, testOrderID)
+			}
+		default:
+			// Health checks
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(pki.Close)
+	return pki
+}
+
+func (p *fakePKI) set(issued, rejected bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.issued, p.rejected = issued, rejected
+}
+
+func (p *fakePKI) counts() (submits, polls int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.submits, p.polls
+}
+
+// cluster is the API server state shared by the controller instances of a
+// test; each instance gets its own client, so killing one leaves the state
+type cluster struct {
+	t      *testing.T
+	scheme *runtime.Scheme
+	client client.WithWatch
+	clock  *clocktesting.FakeClock
+}
+
+func newCluster(t *testing.T, pki *fakePKI) *cluster {
+	scheme := testScheme(t)
+	config, err := json.Marshal(map[string]interface{}{
+		"baseUrl":  pki.URL + "/sign",
+		"response": map[string]interface{}{"format": "pem"},
+		"async": map[string]interface{}{
+			"pollUrl":             pki.URL + "/orders/{id}",
+			"pollIntervalSeconds": 10,
+			"timeoutSeconds":      300,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	objects := []client.Object{
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "pki-config", Namespace: testNamespace},
+			Data:       map[string]string{defaultConfigKey: string(config)},
+		},
+		&externalissuerapi.ExternalIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "pki", Namespace: testNamespace},
+			Spec: externalissuerapi.ExternalIssuerSpec{
+				SignerType:   "pki",
+				ConfigMapRef: &externalissuerapi.ConfigMapReference{Name: "pki-config"},
+			},
+			Status: externalissuerapi.ExternalIssuerStatus{Conditions: []metav1.Condition{{
+				Type:               issuerReadyCondition,
+				Status:             metav1.ConditionTrue,
+				Reason:             "Success",
+				LastTransitionTime: metav1.NewTime(now),
+			}}},
+		},
+		&cmapi.CertificateRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: testRequest, Namespace: testNamespace, CreationTimestamp: metav1.NewTime(now)},
+			Spec: cmapi.CertificateRequestSpec{
+				Request:   testCSR(t, "app.example.com"),
+				IssuerRef: cmmeta.ObjectReference{Group: externalIssuerAPIGroup, Kind: issuerKind, Name: "pki"},
+			},
+			Status: cmapi.CertificateRequestStatus{Conditions: []cmapi.CertificateRequestCondition{{
+				Type:               cmapi.CertificateRequestConditionApproved,
+				Status:             cmmeta.ConditionTrue,
+				Reason:             "Approved",
+				LastTransitionTime: &metav1.Time{Time: now},
+			}}},
+		},
+	}
+	c := &cluster{
+		t:      t,
+		scheme: scheme,
+		clock:  clocktesting.NewFakeClock(now),
+		client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(objects...).
+			WithStatusSubresource(&cmapi.CertificateRequest{}, &externalissuerapi.ExternalIssuer{}).
+			Build(),
+	}
+	return c
+}
+
+// instance starts a controller instance. It dies at the first write kill
+// matches, before the write is applied, like a controller killed mid-flight.
+func (c *cluster) instance(kill func(obj client.Object, patch []byte) bool) *CertificateRequestReconciler {
+	killAt := func(obj client.Object, patch client.Patch) {
+		if kill == nil {
+			return
+		}
+		data, err := patch.Data(obj)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if kill(obj, data) {
+			panic(killed{})
+		}
+	}
+	k8sClient := interceptor.NewClient(c.client, interceptor.Funcs{
+		Patch: func(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			killAt(obj, patch)
+			return cl.Patch(ctx, obj, patch, opts...)
+		},
+		SubResourcePatch: func(ctx context.Context, cl client.Client, subResource string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+			killAt(obj, patch)
+			return cl.SubResource(subResource).Patch(ctx, obj, patch, opts...)
+		},
+	})
+	return &CertificateRequestReconciler{
+		Client: k8sClient,
+		Scheme: c.scheme,
+		Clock:  c.clock,
+	}
+}
+
+// reconcile runs a reconcile of the test request and reports whether the
+// instance was killed during it
+func (c *cluster) reconcile(r *CertificateRequestReconciler) (result ctrl.Result, died bool) {
+	c.t.Helper()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			if _, ok := recovered.(killed); !ok {
+				panic(recovered)
+			}
+			died = true
+		}
+	}()
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: testNamespace, Name: testRequest}})
+	if err != nil {
+		c.t.Fatalf("reconcile failed: %v", err)
+	}
+	return result, false
+}
+
+// request returns the stored test request
+func (c *cluster) request() *cmapi.CertificateRequest {
+	c.t.Helper()
+	cr := &cmapi.CertificateRequest{}
+	if err := c.client.Get(context.Background(), types.NamespacedName{Namespace: testNamespace, Name: testRequest}, cr); err != nil {
+		c.t.Fatal(err)
+	}
+	return cr
+}
+
+// readyReason returns the reason of the stored request's Ready condition
+func (c *cluster) readyReason() string {
+	for _, condition := range c.request().Status.Conditions {
+		if condition.Type == cmapi.CertificateRequestConditionReady {
+			return condition.Reason
+		}
+	}
+	return ""
+}
+
+// savesOrder matches the write persisting a new order
+func savesOrder(obj client.Object, _ []byte) bool {
+	return obj.GetAnnotations()[orderIDAnnotation] != "" && obj.GetAnnotations()[pollAttemptsAnnotation] == "0"
+}
+
+// recordsCertificate matches the status write storing the certificate
+func recordsCertificate(obj client.Object, _ []byte) bool {
+	cr, ok := obj.(*cmapi.CertificateRequest)
+	return ok && len(cr.Status.Certificate) > 0
+}
+
+// recordsFailure matches the status write failing the request
+func recordsFailure(obj client.Object, _ []byte) bool {
+	cr, ok := obj.(*cmapi.CertificateRequest)
+	return ok && isInTerminalState(cr)
+}
+
+// clearsOrder matches the write ending polling
+func clearsOrder(_ client.Object, patch []byte) bool {
+	return strings.Contains(string(patch), `"`+pollDeadlineAnnotation+`":null`)
+}
+
+func TestResumeKilledBetweenClaimAndOrder(t *testing.T) {
+	pki := newFakePKI(t)
+	c := newCluster(t, pki)
+
+	// The PKI accepts the order, but the controller dies before recording it
+	if _, died := c.reconcile(c.instance(savesOrder)); !died {
+		t.Fatal("controller was not killed at the order write")
+	}
+	if submits, _ := pki.counts(); submits != 1 {
+		t.Fatalf("CSR submitted %d times, want 1", submits)
+	}
+	cr := c.request()
+	if cr.Annotations[signAttemptAnnotation] == "" || cr.Annotations[orderIDAnnotation] != "" {
+		t.Fatalf("want a signing attempt without order, got annotations %v", cr.Annotations)
+	}
+
+	// The next instance waits for the attempt, which may still be in flight
+	next := c.instance(nil)
+	result, _ := c.reconcile(next)
+	if result.RequeueAfter <= 0 {
+		t.Fatalf("want the attempt waited for, got %+v", result)
+	}
+
+	// ... and then leaves it to a human instead of submitting the CSR again
+	c.clock.Step(result.RequeueAfter)
+	c.reconcile(next)
+	c.reconcile(next)
+	if submits, _ := pki.counts(); submits != 1 {
+		t.Fatalf("CSR submitted %d times after restart, want 1", submits)
+	}
+	if reason := c.readyReason(); reason != cmapi.CertificateRequestReasonPending {
+		t.Fatalf("Ready reason %q, want %s", reason, cmapi.CertificateRequestReasonPending)
+	}
+}
+
+func TestResumeKilledBetweenPollAndComplete(t *testing.T) {
+	pki := newFakePKI(t)
+	c := newCluster(t, pki)
+
+	result, died := c.reconcile(c.instance(nil))
+	if died || c.request().Annotations[orderIDAnnotation] != testOrderID {
+		t.Fatalf("order not recorded, annotations %v", c.request().Annotations)
+	}
+
+	// The order is issued, but the controller dies before storing the certificate
+	pki.set(true, false)
+	c.clock.Step(result.RequeueAfter)
+	if _, died := c.reconcile(c.instance(recordsCertificate)); !died {
+		t.Fatal("controller was not killed at the certificate write")
+	}
+
+	// The next instance polls the order again rather than submitting the CSR
+	next := c.instance(nil)
+	c.reconcile(next)
+	cr := c.request()
+	if len(cr.Status.Certificate) == 0 {
+		t.Fatalf("certificate not recorded after restart, Ready reason %q", c.readyReason())
+	}
+	if cr.Annotations[pollDeadlineAnnotation] != "" {
+		t.Fatalf("order state not cleared: %v", cr.Annotations)
+	}
+	if submits, polls := pki.counts(); submits != 1 || polls != 2 {
+		t.Fatalf("got %d submits and %d polls, want 1 and 2", submits, polls)
+	}
+
+	// Later reconciles leave the issued request alone
+	c.reconcile(next)
+	if submits, polls := pki.counts(); submits != 1 || polls != 2 {
+		t.Fatalf("got %d submits and %d polls after completion, want 1 and 2", submits, polls)
+	}
+}
+
+func TestResumeAfterFailOrder(t *testing.T) {
+	for name, kill := range map[string]func(client.Object, []byte) bool{
+		"killed recording the failure": recordsFailure,
+		"killed clearing the order":    clearsOrder,
+		"not killed":                   nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			pki := newFakePKI(t)
+			c := newCluster(t, pki)
+
+			// The PKI rejects the order until polling gives up
+			c.reconcile(c.instance(nil))
+			pki.set(false, true)
+			c.clock.Step(6 * time.Minute)
+			if _, died := c.reconcile(c.instance(kill)); died != (kill != nil) {
+				t.Fatalf("controller killed: %v, want %v", died, kill != nil)
+			}
+
+			// Whatever was written of the failure, the CSR isn't submitted again
+			next := c.instance(nil)
+			for i := 0; i < 3; i++ {
+				result, _ := c.reconcile(next)
+				c.clock.Step(result.RequeueAfter + time.Minute)
+			}
+			if submits, _ := pki.counts(); submits != 1 {
+				t.Fatalf("CSR submitted %d times, want 1", submits)
+			}
+			if reason := c.readyReason(); reason != cmapi.CertificateRequestReasonFailed {
+				t.Fatalf("Ready reason %q, want %s", reason, cmapi.CertificateRequestReasonFailed)
+			}
+		})
+	}
+}
+
+// testScheme returns a scheme of the kinds the controllers read
+func testScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, cmapi.AddToScheme, externalissuerapi.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return scheme
+}
+
+// testCSR returns a PEM CSR for a DNS name
+func testCSR(t *testing.T, dnsName string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: dnsName},
+		DNSNames: []string{dnsName},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+// selfSignedCertificate returns a PEM certificate valid from notBefore
+func selfSignedCertificate(t *testing.T, notBefore time.Time, validity time.Duration) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "app.example.com"},
+		DNSNames:     []string{"app.example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(validity),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestPollBackoff(t *testing.T) {
+	config := &signer.PKIAsync{PollIntervalSeconds: 10, MaxPollIntervalSeconds: 60}
+	for _, tc := range []struct {
+		attempts   int
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{attempts: 0, want: 10 * time.Second},
+		{attempts: 1, want: 20 * time.Second},
+		{attempts: 2, want: 40 * time.Second},
+		{attempts: 3, want: time.Minute},
+		{attempts: 100, want: time.Minute},
+		{attempts: 3, retryAfter: 5 * time.Second, want: 5 * time.Second},
+		{attempts: 0, retryAfter: time.Hour, want: time.Minute},
+	} {
+		if got := pollBackoff(config, tc.attempts, tc.retryAfter); got != tc.want {
+			t.Errorf("pollBackoff(%d attempts, Retry-After %s) = %s, want %s", tc.attempts, tc.retryAfter, got, tc.want)
+		}
+	}
+
+	// Without a maximum, the delay is capped at ten times the interval
+	if got := pollBackoff(&signer.PKIAsync{PollIntervalSeconds: 10}, 10, 0); got != 100*time.Second {
+		t.Errorf("pollBackoff without maximum = %s, want 100s", got)
+	}
+}
+
+func TestPollScheduleAndDeadline(t *testing.T) {
+	pki := newFakePKI(t)
+	c := newCluster(t, pki)
+	r := c.instance(nil)
+
+	// The order is polled after 10s, 20s, 40s, 80s and then every 100s,
+	// until the 300s timeout ends it
+	result, _ := c.reconcile(r)
+	for i, want := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 100 * time.Second, 50 * time.Second} {
+		if result.RequeueAfter != want {
+			t.Fatalf("poll %d scheduled after %s, want %s", i+1, result.RequeueAfter, want)
+		}
+
+		// Reconciles before the poll is due wait for the rest of the delay
+		c.clock.Step(want - time.Second)
+		if early, _ := c.reconcile(r); early.RequeueAfter != time.Second {
+			t.Fatalf("early reconcile requeued after %s, want 1s", early.RequeueAfter)
+		}
+		if _, polls := pki.counts(); polls != i {
+			t.Fatalf("polled %d times before poll %d was due", polls, i+1)
+		}
+
+		c.clock.Step(time.Second)
+		result, _ = c.reconcile(r)
+		if _, polls := pki.counts(); polls != i+1 {
+			t.Fatalf("polled %d times, want %d", polls, i+1)
+		}
+	}
+
+	if reason := c.readyReason(); reason != cmapi.CertificateRequestReasonFailed {
+		t.Fatalf("Ready reason %q at the poll deadline, want %s", reason, cmapi.CertificateRequestReasonFailed)
+	}
+	if result.RequeueAfter != 0 {
+		t.Fatalf("failed order requeued after %s", result.RequeueAfter)
+	}
+	if attempts := c.request().Annotations[pollAttemptsAnnotation]; attempts != "" {
+		t.Fatalf("order state kept after the deadline: %s attempts", attempts)
+	}
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/audit"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// audit appends the outcome of a request to the audit trail. The outcome is
+// already stored, so a failed write is reported as a log and event but
+// doesn't fail the request.
+func (r *CertificateRequestReconciler) audit(ctx context.Context, cr *cmapi.CertificateRequest, result, message string) {
+	if r.Audit == nil {
+		return
+	}
+	record := audit.Record{
+		Time:               clockOrReal(r.Clock).Now(),
+		Result:             result,
+		IssuerKind:         cr.Spec.IssuerRef.Kind,
+		IssuerName:         cr.Spec.IssuerRef.Name,
+		Namespace:          cr.Namespace,
+		CertificateRequest: cr.Name,
+		Certificate:        cr.Annotations[cmapi.CertificateNameKey],
+		Username:           cr.Spec.Username,
+		Groups:             cr.Spec.Groups,
+		OrderID:            cr.Annotations[orderIDAnnotation],
+		Message:            message,
+	}
+	if csr, err := parseCSR(cr.Spec.Request); err == nil {
+		record.Subject = csr.Subject.String()
+		record.DNSNames = csr.DNSNames
+		record.EmailAddresses = csr.EmailAddresses
+		for _, ip := range csr.IPAddresses {
+			record.IPAddresses = append(record.IPAddresses, ip.String())
+		}
+		for _, uri := range csr.URIs {
+			record.URIs = append(record.URIs, uri.String())
+		}
+	}
+	if result == audit.ResultIssued {
+		if cert, err := parseCertificate(cr.Status.Certificate); err == nil {
+			record.SerialNumber = formatSerial(cert.SerialNumber)
+		}
+	}
+
+	if err := r.Audit.Record(ctx, record); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to write audit record", "name", cr.Name, "result", result)
+		if r.Recorder != nil {
+			r.Recorder.Event(cr, corev1.EventTypeWarning, "AuditFailed", truncateMessage(err.Error(), maxEventMessageLength))
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+const (
+	// backendResultMaxAge is how long a health check result counts for the
+	// probes. Issuers are rechecked every issuerRecheckInterval; results of
+	// issuers no longer reconciled here, e.g. after losing leadership, expire.
+	backendResultMaxAge = 3 * issuerRecheckInterval
+
+	// maxReportedBackendFailures bounds the failures listed in a probe response
+	maxReportedBackendFailures = 5
+)
+
+// BackendHealth keeps the latest health check result of every issuer's PKI
+// backend for the controller's /readyz and /healthz probes. The controller is
+// not ready while issuers were checked recently and none of their backends
+// was reachable.
+type BackendHealth struct {
+	clock clock.PassiveClock
+
+	mu      sync.RWMutex
+	results map[string]backendResult
+}
+
+type backendResult struct {
+	err       error
+	checkedAt time.Time
+	// failingSince is the first of the consecutive failed checks, zero if the
+	// check succeeded
+	failingSince time.Time
+}
+
+// NewBackendHealth creates an empty backend health tracker; a nil clock uses the real clock
+func NewBackendHealth(clk clock.PassiveClock) *BackendHealth {
+	return &BackendHealth{clock: clockOrReal(clk), results: map[string]backendResult{}}
+}
+
+// check runs the health check of an issuer's signer and records its result
+func (h *BackendHealth) check(ctx context.Context, key string, clk clock.PassiveClock, s Signer, signerType string) (time.Duration, error) {
+	latency, err := timedHealthCheck(ctx, clk, s, signerType)
+	h.record(key, err)
+	return latency, err
+}
+
+// record records the result of a health check of an issuer's backend
+func (h *BackendHealth) record(key string, err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.clock.Now()
+	result := backendResult{err: err, checkedAt: now}
+	if err != nil {
+		result.failingSince = now
+		if previous, ok := h.results[key]; ok && previous.err != nil && now.Sub(previous.checkedAt) <= backendResultMaxAge {
+			result.failingSince = previous.failingSince
+		}
+	}
+	h.results[key] = result
+}
+
+// forget drops the result of a deleted issuer, or one whose backend is no
+// longer health checked because its configuration is invalid
+func (h *BackendHealth) forget(key string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.results, key)
+}
+
+// lastCheck returns the latest health check result of an issuer's backend
+func (h *BackendHealth) lastCheck(key string) (backendResult, bool) {
+	if h == nil {
+		return backendResult{}, false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	result, ok := h.results[key]
+	return result, ok
+}
+
+// failuresLocked returns the recent failures sorted by issuer and since when
+// all of them have been failing, or nil if a recently checked backend was
+// reachable; the caller must hold the lock
+func (h *BackendHealth) failuresLocked() ([]string, time.Time) {
+	now := h.clock.Now()
+	var failures []string
+	var since time.Time
+	for key, result := range h.results {
+		if now.Sub(result.checkedAt) > backendResultMaxAge {
+			continue
+		}
+		if result.err == nil {
+			return nil, time.Time{}
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", key, result.err))
+		if result.failingSince.After(since) {
+			since = result.failingSince
+		}
+	}
+	sort.Strings(failures)
+	return failures, since
+}
+
+// ReadyzCheck fails while no recently checked issuer reached its PKI backend.
+// Without any issuer checked the controller is ready.
+func (h *BackendHealth) ReadyzCheck(_ *http.Request) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if failures, _ := h.failuresLocked(); len(failures) > 0 {
+		return backendsUnreachable(failures, 0)
+	}
+	return nil
+}
+
+// LivenessCheck returns a check failing once no PKI backend has been
+// reachable for longer than timeout, so the kubelet restarts the controller
+func (h *BackendHealth) LivenessCheck(timeout time.Duration) healthz.Checker {
+	return func(_ *http.Request) error {
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+		failures, since := h.failuresLocked()
+		if len(failures) == 0 {
+			return nil
+		}
+		if unreachable := h.clock.Since(since); unreachable > timeout {
+			return backendsUnreachable(failures, unreachable)
+		}
+		return nil
+	}
+}
+
+// backendsUnreachable describes the failed health checks of all issuers and,
+// if known, for how long they have been failing
+func backendsUnreachable(failures []string, unreachable time.Duration) error {
+	listed := failures
+	if len(listed) > maxReportedBackendFailures {
+		listed = listed[:maxReportedBackendFailures]
+	}
+	message := strings.Join(listed, "; ")
+	if more := len(failures) - len(listed); more > 0 {
+		message += fmt.Sprintf("; and %d more", more)
+	}
+	if unreachable > 0 {
+		return fmt.Errorf("no PKI backend reachable for %s (%d issuers): %s", unreachable.Round(time.Second), len(failures), message)
+	}
+	return fmt.Errorf("no PKI backend reachable (%d issuers): %s", len(failures), message)
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// controllerVersionAnnotation records the version of the controller that last reconciled an issuer
+	controllerVersionAnnotation = "external-issuer.io/controller-version"
+
+	// controllerCommitAnnotation records the git commit of that controller build
+	controllerCommitAnnotation = "external-issuer.io/controller-commit"
+)
+
+// recordControllerVersion stamps the running controller's build info on an
+// issuer, so fleet tooling can see which issuer version serves each cluster.
+// The patch is skipped when the annotations are already current.
+func recordControllerVersion(ctx context.Context, c client.Client, issuer client.Object) error {
+	info := version.Get()
+	annotations := issuer.GetAnnotations()
+	if annotations[controllerVersionAnnotation] == info.Version && annotations[controllerCommitAnnotation] == info.GitCommit {
+		return nil
+	}
+
+	patch := client.MergeFrom(issuer.DeepCopyObject().(client.Object))
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[controllerVersionAnnotation] = info.Version
+	annotations[controllerCommitAnnotation] = info.GitCommit
+	issuer.SetAnnotations(annotations)
+	if err := c.Patch(ctx, issuer, patch); err != nil {
+		return fmt.Errorf("failed to record controller version: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// certificateRequestAnnotation marks a Secret holding a certificate pasted by
+// a human to complete a pending order; the value is the CertificateRequest name
+const certificateRequestAnnotation = "external-issuer.io/certificate-request"
+
+// pastedCertificate returns a valid certificate pasted into a Secret for a
+// pending CertificateRequest. Invalid certificates are reported with events
+// on the request and the Secret, and the order stays pending.
+func (r *CertificateRequestReconciler) pastedCertificate(ctx context.Context, cr *cmapi.CertificateRequest) (certPEM, caPEM []byte, ok bool) {
+	logger := log.FromContext(ctx)
+
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.InNamespace(cr.Namespace)); err != nil {
+		logger.Error(err, "Failed to list Secrets for pasted certificates", "name", cr.Name)
+		return nil, nil, false
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if secret.Annotations[certificateRequestAnnotation] != cr.Name {
+			continue
+		}
+		certPEM, caPEM, err := validatePastedCertificate(cr.Spec.Request, secret, clockOrReal(r.Clock).Now())
+		if err != nil {
+			logger.Info("Pasted certificate is invalid", "name", cr.Name, "secret", secret.Name, "reason", err.Error())
+			if r.Recorder != nil {
+				message := fmt.Sprintf("Certificate in Secret %s is invalid: %v", secret.Name, err)
+				r.Recorder.Event(cr, corev1.EventTypeWarning, "InvalidPastedCertificate", message)
+				r.Recorder.Event(secret, corev1.EventTypeWarning, "InvalidPastedCertificate", message)
+			}
+			continue
+		}
+		logger.Info("Collected pasted certificate", "name", cr.Name, "secret", secret.Name)
+		r.issuanceEvent(cr, corev1.EventTypeNormal, "PastedCertificateCollected", "pki",
+			fmt.Sprintf("Certificate collected from Secret %s", secret.Name))
+		return certPEM, caPEM, true
+	}
+	return nil, nil, false
+}
+
+// validatePastedCertificate checks that the tls.crt of a Secret is a current
+// certificate for the CSR's key. The CA chain is taken from ca.crt or from
+// the certificates following the leaf in tls.crt.
+func validatePastedCertificate(csrPEM []byte, secret *corev1.Secret, now time.Time) ([]byte, []byte, error) {
+	chain := secret.Data[corev1.TLSCertKey]
+	if len(chain) == 0 {
+		return nil, nil, fmt.Errorf("key %s is empty", corev1.TLSCertKey)
+	}
+	certs, err := parsePEMCertificates(chain)
+	if err != nil {
+		return nil, nil, fmt.Errorf("key %s: %w", corev1.TLSCertKey, err)
+	}
+
+	csr, err := parseCSR(csrPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	leaf := certs[0]
+	leafKey, err := x509.MarshalPKIXPublicKey(leaf.PublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unsupported certificate public key: %w", err)
+	}
+	csrKey, err := x509.MarshalPKIXPublicKey(csr.PublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unsupported CSR public key: %w", err)
+	}
+	if !bytes.Equal(leafKey, csrKey) {
+		return nil, nil, fmt.Errorf("certificate does not match the private key of the request")
+	}
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return nil, nil, fmt.Errorf("certificate is only valid from %s to %s",
+			leaf.NotBefore.UTC().Format(time.RFC3339), leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	var caPEM []byte
+	if ca := secret.Data["ca.crt"]; len(ca) > 0 {
+		if _, err := parsePEMCertificates(ca); err != nil {
+			return nil, nil, fmt.Errorf("key ca.crt: %w", err)
+		}
+		caPEM = ca
+	} else {
+		for _, cert := range certs[1:] {
+			caPEM = append(caPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+		}
+	}
+	return chain, caPEM, nil
+}
+
+// parsePEMCertificates parses all certificates of a PEM bundle
+func parsePEMCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	return certs, nil
+}
+
+// requestForPastedSecret enqueues the CertificateRequest a pasted Secret is for
+func requestForPastedSecret(_ context.Context, obj client.Object) []reconcile.Request {
+	name := obj.GetAnnotations()[certificateRequestAnnotation]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}}}
+}
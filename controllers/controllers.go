@@ -1,23 +1,39 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/audit"
+	"github.com/bvorland/cert-manager-external-issuer/internal/exporter"
+	"github.com/bvorland/cert-manager-external-issuer/internal/hooks"
 	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	"github.com/bvorland/cert-manager-external-issuer/internal/tracing"
+	"github.com/bvorland/cert-manager-external-issuer/pkg/signer/configbuilder"
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 const (
@@ -26,25 +42,116 @@ const (
 	issuerKind             = "ExternalIssuer"
 	clusterIssuerKind      = "ExternalClusterIssuer"
 	defaultConfigKey       = "pki-config.json"
-	defaultNamespace       = "external-issuer-system"
+
+	// defaultClusterResourceNamespace holds ExternalClusterIssuer ConfigMaps
+	// and Secrets unless configured otherwise
+	defaultClusterResourceNamespace = "external-issuer-system"
+
+	// defaultValidity is requested for certificates of requests without a duration
+	defaultValidity = 365 * 24 * time.Hour
+
+	// approvalLatencyAnnotation records how long a CertificateRequest waited for approval
+	approvalLatencyAnnotation = "external-issuer.io/approval-latency"
 )
 
 // Signer interface for certificate signing
 type Signer interface {
-	CheckHealth() error
-	Sign(csrPEM []byte, validityDays int) (certPEM []byte, caPEM []byte, err error)
+	CheckHealth(ctx context.Context) error
+	Sign(ctx context.Context, csrPEM []byte, validityDays int) (certPEM []byte, caPEM []byte, err error)
 }
 
 // CertificateRequestReconciler reconciles CertificateRequest objects
 type CertificateRequestReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// Credentials caches auth tokens between reconciles; nil reads the Secret every time
+	Credentials *CredentialCache
+
+	// ServiceAccountTokens supplies bound tokens for PKI auth type kubernetes
+	ServiceAccountTokens *ServiceAccountTokens
+
+	// OAuthTokens supplies refreshed access tokens for PKI auth with refresh configured
+	OAuthTokens *OAuthTokens
+
+	// Clock supplies the current time for validity periods, issuance windows,
+	// signing attempts and asynchronous polling (default: the real clock)
+	Clock clock.PassiveClock
+
+	// Exporter queues records of issued certificates for the inventory; nil disables exporting
+	Exporter *exporter.Queue
+
+	// Hooks runs post-issuance hooks on issued certificates; nil disables hooks
+	Hooks *hooks.Runner
+
+	// Audit records every issued and failed request in a tamper-evident
+	// trail; nil disables auditing
+	Audit *audit.Trail
+
+	// DrainTimeout bounds how long a signing in flight at shutdown may take to
+	// finish and record its result (default 20s)
+	DrainTimeout time.Duration
+
+	// MaxConcurrentReconciles is how many requests are reconciled at once (default 1)
+	MaxConcurrentReconciles int
+
+	// DefaultValidity is requested for certificates of requests without a
+	// duration (default 365 days)
+	DefaultValidity time.Duration
+
+	// Recorder receives the full text of condition messages that were shortened
+	Recorder record.EventRecorder
+
+	// APIReader reads requests bypassing the cache right before they are
+	// signed; nil uses the client
+	APIReader client.Reader
+
+	// DisableApprovedCheck signs requests without waiting for the Approved
+	// condition, for clusters that don't run an approver
+	DisableApprovedCheck bool
+
+	// DisableClusterIssuers ignores requests for ExternalClusterIssuers, so a
+	// namespaced deployment never reads cluster-scoped resources
+	DisableClusterIssuers bool
+
+	// DisablePKIProfiles fails requests for issuers referencing a PKIProfile,
+	// for namespaced deployments that can't read cluster-scoped resources
+	DisablePKIProfiles bool
+
+	// DisableMockCA fails requests for issuers using the built-in mockca
+	// signer instead of self-signing them
+	DisableMockCA bool
+
+	// AllowMockCAFallback signs requests of issuers with signerType pki but
+	// neither configMapRef nor profileRef with the built-in mockca signer
+	// instead of failing them
+	AllowMockCAFallback bool
+
+	// CAExpiry records the CA chains of issued certificates for the issuers'
+	// Degraded condition; nil disables recording
+	CAExpiry *CAExpiryTracker
+
+	// PolicyAudit records requests issued despite violating an issuer policy
+	// in Audit mode for the issuers' status; nil disables recording
+	PolicyAudit *PolicyAuditTracker
+
+	// ClusterResourceNamespace holds the ConfigMaps and Secrets of
+	// ExternalClusterIssuers that don't name a namespace (default external-issuer-system)
+	ClusterResourceNamespace string
+
+	// SecretKeyAutodetect is whether the token key of auth Secrets whose
+	// reference names none is guessed: warn (default) or disabled
+	SecretKeyAutodetect string
 }
 
-// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch;patch
 // +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=external-issuer.io,resources=externalissuers;externalclusterissuers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=external-issuer.io,resources=externalissuers/status;externalclusterissuers/status,verbs=patch
 // +kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=serviceaccounts/token,verbs=create
 
 func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
@@ -67,6 +174,16 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 		return ctrl.Result{}, nil
 	}
 
+	if cr.Spec.IssuerRef.Kind == clusterIssuerKind && r.DisableClusterIssuers {
+		logger.V(1).Info("Ignoring request for ExternalClusterIssuer, cluster issuers are disabled", "issuer", cr.Spec.IssuerRef.Name)
+		return ctrl.Result{}, nil
+	}
+
+	// Revoke the certificate of a deleted request if its issuer asks for it
+	if !cr.DeletionTimestamp.IsZero() {
+		return r.finalizeRequest(ctx, cr)
+	}
+
 	// Skip if already has a certificate or is in a terminal state
 	if len(cr.Status.Certificate) > 0 {
 		return ctrl.Result{}, nil
@@ -87,109 +204,705 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 	// Approval should be handled by cert-manager's internal approver or approver-policy.
 	// The approver-clusterrole.yaml grants cert-manager permission to approve our issuer types.
 	// See: https://cert-manager.io/docs/usage/certificaterequest/#approval
-	if !isCertificateRequestApproved(cr) {
+	if !r.DisableApprovedCheck && !isCertificateRequestApproved(cr) {
+		// The condition records that the event was emitted; rewriting it
+		// would trigger another reconcile. The controller is notified when
+		// the request is approved.
+		message := "Waiting for the CertificateRequest to be approved"
+		if hasReadyCondition(cr, cmapi.CertificateRequestReasonPending, message) {
+			return ctrl.Result{}, nil
+		}
 		logger.Info("CertificateRequest not yet approved, waiting for approval", "name", cr.Name)
-		// Return without error - the controller will be notified when the CR is updated
-		return ctrl.Result{}, nil
+		if r.Recorder != nil {
+			r.Recorder.Event(cr, corev1.EventTypeWarning, "WaitingForApproval",
+				message+"; install and configure an approver for external-issuer.io issuers, such as "+
+					"cert-manager's internal approver with deploy/rbac/approver-clusterrole.yaml or approver-policy")
+		}
+		return ctrl.Result{}, r.setStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, message)
+	}
+
+	if err := r.recordApprovalLatency(ctx, cr); err != nil {
+		return ctrl.Result{}, err
 	}
 
 	logger.Info("Processing CertificateRequest", "name", cr.Name, "issuer", cr.Spec.IssuerRef.Name)
 
 	// Get the issuer spec
 	issuerSpec, err := r.getIssuerSpec(ctx, cr)
+	if errors.Is(err, errIssuerPaused) {
+		return r.holdPaused(ctx, cr, err)
+	}
 	if err != nil {
 		logger.Error(err, "Failed to get issuer")
 		return ctrl.Result{}, r.setStatus(ctx, cr, cmmeta.ConditionFalse, "IssuerNotFound", err.Error())
 	}
 
 	// Create the appropriate signer based on configuration
-	var certSigner Signer
-	signerType := issuerSpec.SignerType
-	if signerType == "" {
-		signerType = "mockca" // Default for backward compatibility
+	signerType := activeSignerType(issuerSpec)
+	certSigner, reason, err := r.newSigner(ctx, cr, issuerSpec, cr.Spec.IssuerRef.Kind, cr.Namespace)
+	if err != nil {
+		return ctrl.Result{}, r.setStatus(ctx, cr, cmmeta.ConditionFalse, reason, err.Error())
 	}
 
-	if signerType == "pki" && issuerSpec.ConfigMapRef != nil {
-		// Load PKI configuration from ConfigMap
-		pkiConfig, err := r.loadPKIConfig(ctx, issuerSpec.ConfigMapRef, cr.Namespace)
+	// Pin the issuer's subject attributes in outgoing requests
+	if override := subjectOverride(issuerSpec.Subject); override != nil {
+		if setter, ok := certSigner.(subjectSetter); ok {
+			setter.SetSubject(override)
+		}
+	}
+
+	// Tell the PKI which Ingress or Gateway the certificate terminates on
+	if origin := r.requestOrigin(ctx, cr); origin != nil {
+		if setter, ok := certSigner.(originSetter); ok {
+			setter.SetOrigin(originFields(origin))
+		}
+	}
+
+	// Tell the PKI who requested the certificate
+	if setter, ok := certSigner.(requesterSetter); ok {
+		setter.SetRequester(requesterFields(cr))
+	}
+
+	// Resume an asynchronous order persisted by this or a previous controller instance
+	state, err := loadAsyncState(cr)
+	if err != nil {
+		logger.Error(err, "Failed to load async signing state")
+		return ctrl.Result{}, r.failOrder(ctx, cr, err.Error())
+	}
+	if state != nil {
+		if shuttingDown(ctx) {
+			return ctrl.Result{}, nil
+		}
+		issueCtx, cancel := r.issuanceContext(ctx)
+		defer cancel()
+		return r.pollOrder(issueCtx, cr, issuerSpec, certSigner, state)
+	}
+
+	// A signing attempt whose result was lost must not be repeated blindly
+	if result, attempted, err := r.checkSignAttempt(ctx, cr); attempted || err != nil {
+		return result, err
+	}
+
+	// Requests the PKI asked to retry later wait for their retry time
+	if wait, waiting := checkSignRetry(cr, clockOrReal(r.Clock).Now()); waiting {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	// Enforce the issuer policy and subject before contacting the CA; policy
+	// violations in Audit mode are only reported
+	err = r.checkPolicy(ctx, cr, issuerSpec.Policy)
+	var violation *policyViolationError
+	if errors.As(err, &violation) {
+		mode := "enforce"
+		if auditing(issuerSpec.Policy) {
+			mode = "audit"
+			r.auditPolicyViolation(ctx, cr, violation, clockOrReal(r.Clock).Now())
+			err = nil
+		}
+		policyViolations.WithLabelValues(cr.Namespace, cr.Spec.IssuerRef.Kind, cr.Spec.IssuerRef.Name, mode).Inc()
+	}
+	if err == nil {
+		err = checkSubject(cr.Spec.Request, issuerSpec.Subject)
+	}
+	if err == nil {
+		err = checkSVID(cr, issuerSpec)
+	}
+	if err != nil {
+		if errors.As(err, &violation) {
+			logger.Info("CertificateRequest violates issuer policy", "name", cr.Name, "violations", violation.violations)
+			if r.Recorder != nil {
+				r.Recorder.Event(cr, corev1.EventTypeWarning, "PolicyDenied", truncateMessage(err.Error(), maxEventMessageLength))
+			}
+			// Failed rather than Denied: cert-manager only retries Certificates
+			// with backoff when their request failed, a Denied Ready reason
+			// without an approver's Denied condition would leave them stuck
+			return ctrl.Result{}, r.setFailed(ctx, cr, err.Error())
+		}
+		logger.Error(err, "Failed to evaluate issuer policy")
+		return ctrl.Result{}, err
+	}
+
+	// Permitted CA requests are issued as subordinate CAs, if the signer can
+	if cr.Spec.IsCA {
+		err := fmt.Errorf("signer %s cannot issue CA certificates", signerType)
+		if requester, ok := certSigner.(caRequester); ok {
+			err = requester.RequestCA()
+		}
 		if err != nil {
-			logger.Error(err, "Failed to load PKI config")
-			return ctrl.Result{}, r.setStatus(ctx, cr, cmmeta.ConditionFalse, "ConfigError", err.Error())
+			logger.Info("Cannot issue CA certificate", "name", cr.Name, "reason", err.Error())
+			return ctrl.Result{}, r.setFailed(ctx, cr, err.Error())
 		}
-		pkiSigner := signer.NewPKISigner(pkiConfig)
+	}
 
-		// Load auth token if specified
-		if issuerSpec.AuthSecretName != "" {
-			token, err := r.loadAuthToken(ctx, issuerSpec.AuthSecretName, cr.Namespace)
-			if err != nil {
-				logger.Error(err, "Failed to load auth token")
-				return ctrl.Result{}, r.setStatus(ctx, cr, cmmeta.ConditionFalse, "AuthError", err.Error())
+	// SVIDs carry their identity in the URI SAN, which the PKI must receive
+	if issuerSpec.Mode == issuerModeSVID {
+		err := fmt.Errorf("signer %s cannot issue SPIFFE SVIDs", signerType)
+		if requester, ok := certSigner.(svidRequester); ok {
+			err = requester.RequestSVID()
+		}
+		if err != nil {
+			logger.Info("Cannot issue SPIFFE SVID", "name", cr.Name, "reason", err.Error())
+			return ctrl.Result{}, r.setFailed(ctx, cr, err.Error())
+		}
+	}
+
+	// Hold requests until external validators and a second approver approve them
+	if issuerSpec.Policy != nil {
+		if result, held, err := r.checkValidators(ctx, cr, issuerSpec.Policy.Validators); held || err != nil {
+			return result, err
+		}
+		if held, err := r.checkSecondApproval(ctx, cr, issuerSpec.Policy.SecondApproval); held || err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Defer issuance outside the issuer's issuance windows
+	if issuerSpec.Policy != nil {
+		now := clockOrReal(r.Clock).Now()
+		deferral, err := checkIssuanceWindows(cr, issuerSpec.Policy.IssuanceWindows, now)
+		if err != nil {
+			logger.Error(err, "Invalid issuance window policy")
+			return ctrl.Result{}, r.setStatus(ctx, cr, cmmeta.ConditionFalse, "ConfigError", err.Error())
+		}
+		if deferral != nil {
+			result := ctrl.Result{RequeueAfter: deferral.requeueDelay(now)}
+			// Rewriting an unchanged condition would trigger another reconcile
+			if hasReadyCondition(cr, cmapi.CertificateRequestReasonPending, deferral.message) {
+				return result, nil
 			}
-			pkiSigner.SetAuthToken(token)
+			logger.Info("Issuance deferred by issuance window policy", "name", cr.Name, "resumeAt", deferral.resumeAt)
+			return result, r.setStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, deferral.message)
 		}
-		certSigner = pkiSigner
-	} else {
-		// Use Mock CA signer (default)
-		certSigner = signer.NewMockCASigner(issuerSpec.URL)
 	}
 
 	// Check health first
-	if err := certSigner.CheckHealth(); err != nil {
+	if err := checkSignerHealth(ctx, certSigner, signerType); err != nil {
 		logger.Error(err, "CA health check failed")
 		return ctrl.Result{}, r.setStatus(ctx, cr, cmmeta.ConditionFalse, "SignerError", err.Error())
 	}
 
+	// Don't start a signing once shutdown has begun
+	if shuttingDown(ctx) {
+		logger.Info("Shutting down, leaving CertificateRequest to the next controller instance", "name", cr.Name)
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.addRevokeFinalizer(ctx, cr, issuerSpec); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if completed, err := r.alreadyCompleted(ctx, cr); err != nil || completed {
+		if completed {
+			logger.Info("CertificateRequest was completed meanwhile, not signing again", "name", cr.Name)
+		}
+		return ctrl.Result{}, err
+	}
+
+	// Record the attempt before the CSR leaves the cluster; a conflict means
+	// the request changed since it was read and is looked at again
+	if err := r.claimSigning(ctx, cr); err != nil {
+		if apierrors.IsConflict(err) {
+			return ctrl.Result{Requeue: true}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// The signing and the status update recording it finish even during shutdown
+	issueCtx, cancel := r.issuanceContext(ctx)
+	defer cancel()
+
 	// Sign the CSR
-	certPEM, caPEM, err := certSigner.Sign(cr.Spec.Request, 365)
-	if err != nil {
+	timeoutCtx, cancelSigning := signingContext(issueCtx, issuerSpec)
+	defer cancelSigning()
+	signCtx, span := tracing.Tracer().Start(timeoutCtx, "Signer.Sign", trace.WithAttributes(attribute.String("signer.type", signerType)))
+	certPEM, caPEM, err := certSigner.Sign(signCtx, cr.Spec.Request, validityDays(r.requestValidity(cr)))
+	tracing.RecordError(span, err)
+	span.End()
+	var pending *signer.PendingError
+	if asyncSigner, ok := certSigner.(AsyncSigner); ok && errors.As(err, &pending) {
+		return r.startOrder(issueCtx, cr, asyncSigner, pending)
+	}
+	if signingTimedOut(issueCtx, timeoutCtx, err) {
+		logger.Error(err, "Signing timed out", "signingTimeout", issuerSpec.SigningTimeout.Duration)
+		return r.signingTimeout(issueCtx, cr, signerType, issuerSpec.SigningTimeout.Duration)
+	}
+	var mapped *signer.MappedError
+	if errors.As(err, &mapped) {
+		logger.Error(err, "Failed to sign certificate", "reason", mapped.Reason, "retry", mapped.Retry)
+		return r.mappedSigningFailure(issueCtx, cr, signerType, mapped)
+	}
+	var notIssued *signer.NotIssuedError
+	if errors.As(err, &notIssued) {
 		logger.Error(err, "Failed to sign certificate")
-		return ctrl.Result{}, r.setStatus(ctx, cr, cmmeta.ConditionFalse, "SigningFailed", err.Error())
+		if err := r.releaseSigning(issueCtx, cr); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.issuanceEvent(cr, corev1.EventTypeWarning, "SigningFailed", signerType, err.Error())
+		return ctrl.Result{}, r.setStatus(issueCtx, cr, cmmeta.ConditionFalse, "SigningFailed", err.Error())
+	}
+	if err != nil {
+		// The CSR may have reached the PKI, so the attempt is kept and the
+		// request is not signed again until its outcome is checked
+		logger.Error(err, "Failed to sign certificate after sending the request, keeping the signing attempt")
+		message := fmt.Sprintf("%v; the PKI may have issued a certificate, so the request is not signed again automatically", err)
+		r.issuanceEvent(cr, corev1.EventTypeWarning, "SigningFailed", signerType, message)
+		if err := r.setStatus(issueCtx, cr, cmmeta.ConditionFalse, "SigningFailed", message); err != nil {
+			return ctrl.Result{}, err
+		}
+		result, _, err := r.checkSignAttempt(issueCtx, cr)
+		return result, err
 	}
 
-	logger.Info("Successfully signed certificate", "name", cr.Name)
+	logger.Info("Successfully signed certificate", "name", cr.Name, "signerType", signerType)
 
 	// Update the CertificateRequest with the signed certificate
-	cr.Status.Certificate = certPEM
-	cr.Status.CA = caPEM
+	if recorded, err := r.recordCertificate(issueCtx, cr, certPEM, caPEM); err != nil || !recorded {
+		return ctrl.Result{}, err
+	}
+	r.issuanceEvent(cr, corev1.EventTypeNormal, "Issued", signerType, "Certificate issued")
+	r.recordIssuance(ctx, cr, clockOrReal(r.Clock).Now())
+	r.audit(ctx, cr, audit.ResultIssued, "")
+	r.exportIssued(ctx, cr)
+	r.runHooks(ctx, cr)
+	return ctrl.Result{}, nil
+}
+
+// recordApprovalLatency observes the time between creation and approval of a
+// CertificateRequest and records it as an annotation. The annotation marks the
+// request as observed so the latency is only counted once.
+func (r *CertificateRequestReconciler) recordApprovalLatency(ctx context.Context, cr *cmapi.CertificateRequest) error {
+	if _, ok := cr.Annotations[approvalLatencyAnnotation]; ok {
+		return nil
+	}
 
-	return ctrl.Result{}, r.setStatus(ctx, cr, cmmeta.ConditionTrue, "Issued", "Certificate issued successfully")
+	var approvedAt *metav1.Time
+	for _, c := range cr.Status.Conditions {
+		if c.Type == cmapi.CertificateRequestConditionApproved && c.Status == cmmeta.ConditionTrue {
+			approvedAt = c.LastTransitionTime
+		}
+	}
+	if approvedAt == nil {
+		return nil
+	}
+
+	latency := approvedAt.Sub(cr.CreationTimestamp.Time)
+	if latency < 0 {
+		latency = 0
+	}
+	approvalLatency.WithLabelValues(cr.Namespace, cr.Spec.IssuerRef.Kind, cr.Spec.IssuerRef.Name).Observe(latency.Seconds())
+
+	patch := client.MergeFrom(cr.DeepCopy())
+	if cr.Annotations == nil {
+		cr.Annotations = map[string]string{}
+	}
+	cr.Annotations[approvalLatencyAnnotation] = latency.Round(time.Millisecond).String()
+	if err := r.Patch(ctx, cr, patch); err != nil {
+		return fmt.Errorf("failed to record approval latency: %w", err)
+	}
+
+	log.FromContext(ctx).V(1).Info("Recorded approval latency", "name", cr.Name, "latency", latency)
+	return nil
 }
 
 func (r *CertificateRequestReconciler) getIssuerSpec(ctx context.Context, cr *cmapi.CertificateRequest) (*externalissuerapi.ExternalIssuerSpec, error) {
-	if cr.Spec.IssuerRef.Kind == clusterIssuerKind {
+	return readyIssuerSpec(ctx, r.Client, cr.Spec.IssuerRef.Kind, cr.Spec.IssuerRef.Name, cr.Namespace)
+}
+
+// readyIssuerSpec returns the spec of an issuer, failing if it is not ready
+// or, with errIssuerPaused, if it is paused
+func readyIssuerSpec(ctx context.Context, c client.Reader, kind, name, namespace string) (*externalissuerapi.ExternalIssuerSpec, error) {
+	if kind == clusterIssuerKind {
 		// Get ClusterIssuer
 		clusterIssuer := &externalissuerapi.ExternalClusterIssuer{}
-		if err := r.Get(ctx, types.NamespacedName{Name: cr.Spec.IssuerRef.Name}, clusterIssuer); err != nil {
-			return nil, fmt.Errorf("failed to get ClusterIssuer %s: %w", cr.Spec.IssuerRef.Name, err)
+		if err := c.Get(ctx, types.NamespacedName{Name: name}, clusterIssuer); err != nil {
+			return nil, fmt.Errorf("failed to get ClusterIssuer %s: %w", name, err)
+		}
+		if clusterIssuer.Spec.Paused {
+			return nil, fmt.Errorf("clusterIssuer %s: %w", name, errIssuerPaused)
 		}
 		// Check if issuer is ready
 		if !isIssuerReady(clusterIssuer.Status.Conditions) {
-			return nil, fmt.Errorf("clusterIssuer %s is not ready", cr.Spec.IssuerRef.Name)
+			return nil, fmt.Errorf("clusterIssuer %s is not ready", name)
 		}
 		return &clusterIssuer.Spec, nil
 	}
 
 	// Get namespaced Issuer
 	issuer := &externalissuerapi.ExternalIssuer{}
-	if err := r.Get(ctx, types.NamespacedName{Name: cr.Spec.IssuerRef.Name, Namespace: cr.Namespace}, issuer); err != nil {
-		return nil, fmt.Errorf("failed to get Issuer %s/%s: %w", cr.Namespace, cr.Spec.IssuerRef.Name, err)
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, issuer); err != nil {
+		return nil, fmt.Errorf("failed to get Issuer %s/%s: %w", namespace, name, err)
+	}
+	if issuer.Spec.Paused {
+		return nil, fmt.Errorf("issuer %s/%s: %w", namespace, name, errIssuerPaused)
 	}
 	// Check if issuer is ready
 	if !isIssuerReady(issuer.Status.Conditions) {
-		return nil, fmt.Errorf("issuer %s/%s is not ready", cr.Namespace, cr.Spec.IssuerRef.Name)
+		return nil, fmt.Errorf("issuer %s/%s is not ready", namespace, name)
 	}
 	return &issuer.Spec, nil
 }
 
+// newSigner creates the signer configured by an issuer of the given kind for
+// requests in namespace; warnings about the configuration are recorded as
+// events on obj. On error it also returns the condition reason.
+func (r *CertificateRequestReconciler) newSigner(ctx context.Context, obj client.Object, issuerSpec *externalissuerapi.ExternalIssuerSpec, kind, namespace string) (Signer, string, error) {
+	logger := log.FromContext(ctx)
+
+	if !usesPKIConfig(issuerSpec) {
+		// Use Mock CA signer (default)
+		mockSigner, err := newMockCASigner(issuerSpec, r.DisableMockCA, r.AllowMockCAFallback, r.Clock)
+		if errors.Is(err, errMissingPKIConfig) || errors.Is(err, errNegativeBackdate) {
+			return nil, invalidIssuerConfigReason, err
+		}
+		if err != nil {
+			return nil, "ConfigError", err
+		}
+		if mockCAFallback(issuerSpec) {
+			logger.Info("Issuer has signerType pki without configMapRef or profileRef, signing with the mockca fallback")
+		}
+		return mockSigner, "", nil
+	}
+
+	// ExternalClusterIssuers keep their ConfigMaps and Secrets in the cluster
+	// resource namespace, ExternalIssuers in their own namespace
+	resourceNamespace := namespace
+	if kind == clusterIssuerKind {
+		resourceNamespace = clusterResourceNamespace(r.ClusterResourceNamespace)
+	}
+
+	// Load PKI configuration from the PKIProfile or ConfigMap
+	var pkiConfig *signer.PKIConfig
+	var profileAuth *externalissuerapi.AuthSecretReference
+	var err error
+	switch {
+	case issuerSpec.ProfileRef != nil && r.DisablePKIProfiles:
+		err = errPKIProfilesDisabled
+	case issuerSpec.ProfileRef != nil:
+		pkiConfig, profileAuth, err = loadPKIProfile(ctx, r.Client, issuerSpec)
+	default:
+		pkiConfig, err = r.loadPKIConfig(ctx, issuerSpec.ConfigMapRef, resourceNamespace)
+	}
+	if errors.Is(err, errInvalidPKIConfig) {
+		logger.Error(err, "Invalid PKI config")
+		return nil, invalidIssuerConfigReason, err
+	}
+	if err != nil {
+		logger.Error(err, "Failed to load PKI config")
+		return nil, "ConfigError", err
+	}
+	pkiSigner, err := signer.NewPKISigner(pkiConfig)
+	if err != nil {
+		logger.Error(err, "Failed to create PKI signer")
+		return nil, "ConfigError", err
+	}
+	pkiSigner.SetClock(r.Clock)
+	if err := applyBackdate(pkiSigner, issuerSpec); err != nil {
+		return nil, invalidIssuerConfigReason, err
+	}
+
+	// Authenticate with a bound ServiceAccount token if configured
+	if auth := pkiConfig.Auth; auth != nil && auth.Type == "kubernetes" && auth.TokenPath == "" {
+		if r.ServiceAccountTokens == nil {
+			return nil, "ConfigError", fmt.Errorf("ServiceAccount token authentication is not available")
+		}
+		pkiSigner.SetTokenSource(r.ServiceAccountTokens.ForAudience(auth.Audience, auth.ExpirationSeconds))
+	}
+
+	// Load auth credentials if specified
+	if ref := authSecretRef(issuerSpec, profileAuth, resourceNamespace); ref != nil {
+		// A namespaced issuer must not send another namespace's credentials to its CA
+		if kind == issuerKind && ref.Namespace != namespace {
+			return nil, "ConfigError", fmt.Errorf("authSecretRef of an ExternalIssuer must be in namespace %s", namespace)
+		}
+		authType := ""
+		var refresh *signer.PKIAuthRefresh
+		if pkiConfig.Auth != nil {
+			authType = pkiConfig.Auth.Type
+			refresh = pkiConfig.Auth.Refresh
+		}
+		secretKey := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+		if refresh != nil {
+			// Access tokens are obtained with the Secret's refresh token or client credentials
+			if r.OAuthTokens == nil {
+				return nil, "ConfigError", fmt.Errorf("access token refresh is not available")
+			}
+			data, err := r.loadSecretData(ctx, secretKey)
+			if err != nil {
+				logger.Error(err, "Failed to load auth credentials")
+				return nil, "AuthError", err
+			}
+			pkiSigner.SetTokenSource(r.OAuthTokens.ForSecret(secretKey, data, refresh))
+		} else {
+			creds, err := r.loadAuthCredentials(ctx, ref, authType)
+			if err != nil {
+				logger.Error(err, "Failed to load auth credentials")
+				return nil, "AuthError", err
+			}
+			if creds.detectedKey != "" {
+				r.warnAutodetectedKey(ctx, obj, ref, creds.detectedKey)
+			}
+			pkiSigner.SetAuthToken(creds.token)
+			if creds.username != "" {
+				pkiSigner.SetBasicAuth(creds.username, creds.password)
+			}
+			if expiry, ok := signer.JWTExpiry(creds.token); ok {
+				authTokenExpiry.observe(secretKey, expiry)
+			}
+		}
+		pkiSigner.SetAuthRejectedHandler(func() {
+			if refresh != nil {
+				if r.OAuthTokens.Expire(secretKey) {
+					logger.Info("PKI API rejected access token, refreshing it", "secret", secretKey)
+				}
+			} else if r.Credentials.Invalidate(secretKey) {
+				logger.Info("PKI API rejected credentials, invalidated cached Secret", "secret", secretKey)
+			}
+		})
+	}
+	// Collect certificates from object storage with credentials from a Secret
+	if async := pkiConfig.Async; async != nil && async.ObjectStorage != nil && async.ObjectStorage.CredentialsSecretRef != "" {
+		// Cluster issuers keep the Secret next to their ConfigMap (or in the
+		// cluster resource namespace with a PKIProfile), namespaced issuers in their own namespace
+		secretNamespace := resourceNamespace
+		if kind == clusterIssuerKind && issuerSpec.ConfigMapRef != nil && issuerSpec.ConfigMapRef.Namespace != "" {
+			secretNamespace = issuerSpec.ConfigMapRef.Namespace
+		}
+		data, err := r.loadSecretData(ctx, types.NamespacedName{Name: async.ObjectStorage.CredentialsSecretRef, Namespace: secretNamespace})
+		if err != nil {
+			logger.Error(err, "Failed to load object storage credentials")
+			return nil, "AuthError", err
+		}
+		if err := pkiSigner.SetObjectStorageCredentials(data); err != nil {
+			return nil, "ConfigError", err
+		}
+	}
+	return pkiSigner, "", nil
+}
+
+// clusterResourceNamespace returns the configured namespace of
+// ExternalClusterIssuer ConfigMaps and Secrets or the default
+func clusterResourceNamespace(configured string) string {
+	if configured == "" {
+		return defaultClusterResourceNamespace
+	}
+	return configured
+}
+
+// errMissingPKIConfig reports an issuer with signerType pki but neither
+// configMapRef nor profileRef, e.g. because of a typo in the field name
+var errMissingPKIConfig = errors.New("signerType pki requires configMapRef or profileRef")
+
+// errNegativeBackdate reports an issuer whose certificates would only become
+// valid after they were issued
+var errNegativeBackdate = errors.New("backdate must not be negative")
+
+// errInvalidPKIConfig reports a PKI configuration that cannot be decoded or
+// fails validation
+var errInvalidPKIConfig = errors.New("invalid PKI config")
+
+// invalidIssuerConfigReason is the condition reason of issuers and requests
+// failing with errMissingPKIConfig, errNegativeBackdate or errInvalidPKIConfig
+const invalidIssuerConfigReason = "InvalidIssuerConfig"
+
+// activeSignerType returns the signer that handles an issuer's requests
+func activeSignerType(issuerSpec *externalissuerapi.ExternalIssuerSpec) string {
+	if usesPKIConfig(issuerSpec) {
+		return "pki"
+	}
+	return "mockca"
+}
+
+// mockCAFallback reports whether an issuer asks for the PKI but has no PKI
+// configuration, so only the Mock CA could sign its requests
+func mockCAFallback(issuerSpec *externalissuerapi.ExternalIssuerSpec) bool {
+	return issuerSpec.SignerType == "pki" && !usesPKIConfig(issuerSpec)
+}
+
+// newMockCASigner creates the built-in self-signing Mock CA for an issuer
+// without PKI configuration, unless the Mock CA is disabled or not built in.
+// Issuers with signerType pki only get it if the fallback is allowed: their
+// workloads would otherwise silently end up with untrusted certificates.
+func newMockCASigner(issuerSpec *externalissuerapi.ExternalIssuerSpec, disabled, allowFallback bool, clk clock.PassiveClock) (Signer, error) {
+	if mockCAFallback(issuerSpec) {
+		if !allowFallback {
+			return nil, errMissingPKIConfig
+		}
+		if disabled || !signer.MockCABuiltIn {
+			return nil, fmt.Errorf("%w, the built-in mockca signer is disabled", errMissingPKIConfig)
+		}
+	}
+	if disabled || !signer.MockCABuiltIn {
+		return nil, fmt.Errorf("the built-in mockca signer is disabled, set signerType pki with configMapRef or profileRef")
+	}
+	mockSigner := signer.NewMockCASigner(issuerSpec.URL)
+	mockSigner.SetClock(clk)
+	if err := applyBackdate(mockSigner, issuerSpec); err != nil {
+		return nil, err
+	}
+	return mockSigner, nil
+}
+
+// backdateSetter is implemented by signers whose backdating of NotBefore is configurable
+type backdateSetter interface {
+	SetBackdate(backdate time.Duration)
+}
+
+// applyBackdate passes an issuer's backdate, if set, to its signer
+func applyBackdate(s backdateSetter, issuerSpec *externalissuerapi.ExternalIssuerSpec) error {
+	if issuerSpec.Backdate == nil {
+		return nil
+	}
+	if issuerSpec.Backdate.Duration < 0 {
+		return fmt.Errorf("%w, got %s", errNegativeBackdate, issuerSpec.Backdate.Duration)
+	}
+	s.SetBackdate(issuerSpec.Backdate.Duration)
+	return nil
+}
+
+// clockOrReal returns the clock of a reconciler, or the real clock if none is set
+func clockOrReal(c clock.PassiveClock) clock.PassiveClock {
+	if c == nil {
+		return clock.RealClock{}
+	}
+	return c
+}
+
+// issuanceEvent records an event about the issuance of a request, naming the
+// signer so certificates from the Mock CA stand out
+func (r *CertificateRequestReconciler) issuanceEvent(cr *cmapi.CertificateRequest, eventType, reason, signerType, message string) {
+	if r.Recorder == nil {
+		return
+	}
+	suffix := fmt.Sprintf(" (signer: %s)", signerType)
+	r.Recorder.Event(cr, eventType, reason, truncateMessage(message, maxEventMessageLength-len(suffix))+suffix)
+}
+
+// setStatus sets the Ready condition of a CertificateRequest; failures are
+// recorded in the issuer status as well
 func (r *CertificateRequestReconciler) setStatus(ctx context.Context, cr *cmapi.CertificateRequest, status cmmeta.ConditionStatus, reason, message string) error {
-	cr.Status.Conditions = setCondition(cr.Status.Conditions, cmapi.CertificateRequestCondition{
+	if err := r.updateStatus(ctx, cr, status, reason, message, nil); err != nil {
+		return err
+	}
+	if issuanceFailure(status, reason) {
+		r.recordIssuanceFailure(ctx, cr, reason, clockOrReal(r.Clock).Now())
+	}
+	return nil
+}
+
+// setFailed marks the CertificateRequest as permanently failed and audits it
+func (r *CertificateRequestReconciler) setFailed(ctx context.Context, cr *cmapi.CertificateRequest, message string) error {
+	now := metav1.NewTime(clockOrReal(r.Clock).Now())
+	if err := r.updateStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, message, func(status *cmapi.CertificateRequestStatus) {
+		status.FailureTime = &now
+	}); err != nil {
+		return err
+	}
+	r.recordIssuanceFailure(ctx, cr, cmapi.CertificateRequestReasonFailed, now.Time)
+	r.audit(ctx, cr, audit.ResultFailed, message)
+	return nil
+}
+
+// recordCertificate stores an issued certificate. It reports false if the
+// request was completed meanwhile, e.g. by a reconcile working from a stale
+// cache; the certificate stored first is kept.
+//
+// The certificate can't be requested again, so failed writes are retried
+// while the API server is unavailable.
+func (r *CertificateRequestReconciler) recordCertificate(ctx context.Context, cr *cmapi.CertificateRequest, certPEM, caPEM []byte) (bool, error) {
+	err := retry.OnError(recordRetry, func(err error) bool {
+		return !apierrors.IsNotFound(err) && ctx.Err() == nil
+	}, func() error {
+		return r.updateStatus(ctx, cr, cmmeta.ConditionTrue, "Issued", "Certificate issued successfully", func(status *cmapi.CertificateRequestStatus) {
+			status.Certificate = certPEM
+			status.CA = caPEM
+		})
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to record issued certificate", "name", cr.Name,
+			"requestHash", cr.Annotations[requestHashAnnotation])
+		return false, err
+	}
+	if !bytes.Equal(cr.Status.Certificate, certPEM) {
+		log.FromContext(ctx).Info("CertificateRequest was completed by another reconcile, discarding certificate", "name", cr.Name)
+		return false, nil
+	}
+	r.CAExpiry.observe(issuerKey(cr.Spec.IssuerRef.Kind, cr.Namespace, cr.Spec.IssuerRef.Name), caPEM)
+	return true, nil
+}
+
+// updateStatus sets the Ready condition and applies mutate to the status.
+//
+// cert-manager updates the same requests, e.g. to approve them, so the status
+// is patched against the version it was read at and the change is reapplied
+// to the latest version on conflicts. If the latest version is already
+// complete, it is kept and cr is updated to it instead.
+func (r *CertificateRequestReconciler) updateStatus(ctx context.Context, cr *cmapi.CertificateRequest, status cmmeta.ConditionStatus, reason, message string, mutate func(*cmapi.CertificateRequestStatus)) error {
+	logger := log.FromContext(ctx)
+
+	// Keep the condition short; the full message goes to an event and the debug log
+	if summary := summarizeMessage(message); summary != message {
+		logger.V(1).Info("Condition message summarized", "reason", reason, "message", message)
+		if r.Recorder != nil {
+			eventType := corev1.EventTypeNormal
+			if status == cmmeta.ConditionFalse {
+				eventType = corev1.EventTypeWarning
+			}
+			r.Recorder.Event(cr, eventType, reason, truncateMessage(message, maxEventMessageLength))
+		}
+		message = summary
+	}
+
+	condition := cmapi.CertificateRequestCondition{
 		Type:               cmapi.CertificateRequestConditionReady,
 		Status:             status,
 		Reason:             reason,
 		Message:            message,
-		LastTransitionTime: &metav1.Time{Time: metav1.Now().Time},
+		LastTransitionTime: &metav1.Time{Time: clockOrReal(r.Clock).Now()},
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		patch := client.MergeFromWithOptions(cr.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		if mutate != nil {
+			mutate(&cr.Status)
+		}
+		cr.Status.Conditions = setCondition(cr.Status.Conditions, condition)
+		err := r.Status().Patch(ctx, cr, patch)
+		if !apierrors.IsConflict(err) {
+			return err
+		}
+
+		latest := &cmapi.CertificateRequest{}
+		if getErr := r.apiReader().Get(ctx, client.ObjectKeyFromObject(cr), latest); getErr != nil {
+			return getErr
+		}
+		*cr = *latest
+		if len(latest.Status.Certificate) > 0 || isInTerminalState(latest) {
+			logger.Info("CertificateRequest status was written meanwhile, keeping it", "name", cr.Name, "reason", reason)
+			return nil
+		}
+		return err
 	})
-	return r.Status().Update(ctx, cr)
+}
+
+// apiReader returns the reader for reads that must not be served from the cache
+func (r *CertificateRequestReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// alreadyCompleted checks the latest version of a request, bypassing the
+// cache, before it is signed. A cache that hasn't caught up with our own
+// status update or async state would otherwise get the CSR signed twice.
+func (r *CertificateRequestReconciler) alreadyCompleted(ctx context.Context, cr *cmapi.CertificateRequest) (bool, error) {
+	latest := &cmapi.CertificateRequest{}
+	if err := r.apiReader().Get(ctx, client.ObjectKeyFromObject(cr), latest); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	if len(latest.Status.Certificate) > 0 || isInTerminalState(latest) || latest.Annotations[pollDeadlineAnnotation] != "" {
+		return true, nil
+	}
+	return !latest.DeletionTimestamp.IsZero(), nil
 }
 
 func setCondition(conditions []cmapi.CertificateRequestCondition, condition cmapi.CertificateRequestCondition) []cmapi.CertificateRequestCondition {
@@ -213,6 +926,16 @@ func isInTerminalState(cr *cmapi.CertificateRequest) bool {
 	return false
 }
 
+// hasReadyCondition reports whether the Ready condition already carries the reason and message
+func hasReadyCondition(cr *cmapi.CertificateRequest, reason, message string) bool {
+	for _, c := range cr.Status.Conditions {
+		if c.Type == cmapi.CertificateRequestConditionReady {
+			return c.Reason == reason && c.Message == message
+		}
+	}
+	return false
+}
+
 func isCertificateRequestApproved(cr *cmapi.CertificateRequest) bool {
 	for _, c := range cr.Status.Conditions {
 		if c.Type == cmapi.CertificateRequestConditionApproved && c.Status == cmmeta.ConditionTrue {
@@ -243,17 +966,30 @@ func isIssuerReady(conditions []metav1.Condition) bool {
 func (r *CertificateRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&cmapi.CertificateRequest{}).
-		Complete(r)
+		// Certificates pasted for pending tickets complete their request
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(requestForPastedSecret)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(tracedReconciler{name: "CertificateRequest", Reconciler: r})
 }
 
-// loadPKIConfig loads PKI configuration from a ConfigMap
-func (r *CertificateRequestReconciler) loadPKIConfig(ctx context.Context, ref *externalissuerapi.ConfigMapReference, requestNamespace string) (*signer.PKIConfig, error) {
-	namespace := ref.Namespace
-	if namespace == "" {
-		namespace = requestNamespace
+// requestValidity returns the validity requested for the certificate of a
+// request: its duration, or the default validity
+func (r *CertificateRequestReconciler) requestValidity(cr *cmapi.CertificateRequest) time.Duration {
+	if cr.Spec.Duration != nil && cr.Spec.Duration.Duration > 0 {
+		return cr.Spec.Duration.Duration
 	}
+	if r.DefaultValidity > 0 {
+		return r.DefaultValidity
+	}
+	return defaultValidity
+}
+
+// loadPKIConfig loads PKI configuration from a ConfigMap, in the issuer's
+// resource namespace unless the reference names one
+func (r *CertificateRequestReconciler) loadPKIConfig(ctx context.Context, ref *externalissuerapi.ConfigMapReference, resourceNamespace string) (*signer.PKIConfig, error) {
+	namespace := ref.Namespace
 	if namespace == "" {
-		namespace = defaultNamespace
+		namespace = resourceNamespace
 	}
 
 	key := ref.Key
@@ -271,39 +1007,167 @@ func (r *CertificateRequestReconciler) loadPKIConfig(ctx context.Context, ref *e
 		return nil, fmt.Errorf("key %s not found in ConfigMap %s/%s", key, namespace, ref.Name)
 	}
 
-	var config signer.PKIConfig
-	if err := json.Unmarshal([]byte(configData), &config); err != nil {
-		return nil, fmt.Errorf("failed to parse PKI config: %w", err)
+	config, err := configbuilder.Parse([]byte(configData))
+	if err != nil {
+		return nil, fmt.Errorf("%w in ConfigMap %s/%s: %w", errInvalidPKIConfig, namespace, ref.Name, err)
 	}
 
-	return &config, nil
+	return config, nil
 }
 
-// loadAuthToken loads an authentication token from a Secret
-func (r *CertificateRequestReconciler) loadAuthToken(ctx context.Context, secretName, namespace string) (string, error) {
-	if namespace == "" {
-		namespace = defaultNamespace
+// authCredentials are the credentials selected from an auth Secret
+type authCredentials struct {
+	token    string
+	username string
+	password string
+	// detectedKey is the token key guessed because the reference names none
+	detectedKey string
+}
+
+// defaultTokenKeys are tried in order when an auth Secret reference names no key
+var defaultTokenKeys = []string{"token", "api-key", "password", "apiKey"}
+
+// authSecretRef returns the issuer's auth Secret reference with the namespace
+// defaulted, converting the legacy authSecretName and falling back to the
+// PKIProfile's reference; nil without credentials
+func authSecretRef(spec *externalissuerapi.ExternalIssuerSpec, profileRef *externalissuerapi.AuthSecretReference, namespace string) *externalissuerapi.AuthSecretReference {
+	var ref externalissuerapi.AuthSecretReference
+	switch {
+	case spec.AuthSecretRef != nil:
+		ref = *spec.AuthSecretRef
+	case spec.AuthSecretName != "":
+		ref.Name = spec.AuthSecretName
+	case profileRef != nil:
+		ref = *profileRef
+	default:
+		return nil
 	}
+	if ref.Namespace == "" {
+		ref.Namespace = namespace
+	}
+	return &ref
+}
 
+// loadAuthCredentials reads credentials from the referenced Secret, or from
+// the credential cache while the Secret is unchanged
+func (r *CertificateRequestReconciler) loadAuthCredentials(ctx context.Context, ref *externalissuerapi.AuthSecretReference, authType string) (authCredentials, error) {
+	data, err := r.loadSecretData(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace})
+	if err != nil {
+		return authCredentials{}, err
+	}
+	return selectCredentials(data, ref, authType, r.secretKeyAutodetect())
+}
+
+// loadSecretData reads a Secret's data, or takes it from the credential cache
+// while the Secret is unchanged
+func (r *CertificateRequestReconciler) loadSecretData(ctx context.Context, secretKey types.NamespacedName) (map[string][]byte, error) {
+	if data, ok := r.Credentials.get(secretKey); ok {
+		return data, nil
+	}
 	secret := &corev1.Secret{}
-	if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: namespace}, secret); err != nil {
-		return "", fmt.Errorf("failed to get secret %s/%s: %w", namespace, secretName, err)
+	if err := r.Get(ctx, secretKey, secret); err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %w", secretKey, err)
+	}
+	r.Credentials.put(secretKey, secret.Data)
+	return secret.Data, nil
+}
+
+// selectCredentials picks the keys named by the reference. When none is named,
+// basic auth uses the username and password keys of a kubernetes.io/basic-auth
+// Secret, and other auth types guess the token key if autodetect is set.
+func selectCredentials(data map[string][]byte, ref *externalissuerapi.AuthSecretReference, authType string, autodetect bool) (authCredentials, error) {
+	var creds authCredentials
+	secretName := ref.Namespace + "/" + ref.Name
+
+	if ref.UsernameKey != "" || ref.PasswordKey != "" {
+		if ref.UsernameKey == "" || ref.PasswordKey == "" {
+			return creds, fmt.Errorf("authSecretRef for secret %s must set both usernameKey and passwordKey", secretName)
+		}
+		username, ok := data[ref.UsernameKey]
+		if !ok {
+			return creds, fmt.Errorf("key %s not found in secret %s", ref.UsernameKey, secretName)
+		}
+		password, ok := data[ref.PasswordKey]
+		if !ok {
+			return creds, fmt.Errorf("key %s not found in secret %s", ref.PasswordKey, secretName)
+		}
+		creds.username, creds.password = string(username), string(password)
+	}
+
+	if ref.Key != "" {
+		token, ok := data[ref.Key]
+		if !ok {
+			return creds, fmt.Errorf("key %s not found in secret %s", ref.Key, secretName)
+		}
+		creds.token = string(token)
+		return creds, nil
+	}
+	if creds.username != "" {
+		return creds, nil
 	}
 
-	// Try common key names
-	for _, key := range []string{"token", "api-key", "password", "apiKey"} {
-		if token, ok := secret.Data[key]; ok {
-			return string(token), nil
+	if authType == "basic" {
+		username, hasUsername := data[corev1.BasicAuthUsernameKey]
+		password, hasPassword := data[corev1.BasicAuthPasswordKey]
+		if hasUsername && hasPassword {
+			creds.username, creds.password = string(username), string(password)
+			return creds, nil
 		}
 	}
 
-	return "", fmt.Errorf("no token found in secret %s/%s (tried: token, api-key, password, apiKey)", namespace, secretName)
+	if !autodetect {
+		return creds, fmt.Errorf("no key selected in secret %s and key detection is disabled, set authSecretRef.key, or usernameKey and passwordKey", secretName)
+	}
+
+	// Fall back to common key names
+	for _, key := range defaultTokenKeys {
+		if token, ok := data[key]; ok {
+			creds.token, creds.detectedKey = string(token), key
+			return creds, nil
+		}
+	}
+	return creds, fmt.Errorf("no token found in secret %s (tried: %s)", secretName, strings.Join(defaultTokenKeys, ", "))
 }
 
 // IssuerReconciler reconciles ExternalIssuer objects
 type IssuerReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// DisablePKIProfiles ignores PKIProfiles, for namespaced deployments that
+	// can't read cluster-scoped resources
+	DisablePKIProfiles bool
+
+	// DisableMockCA marks issuers using the built-in mockca signer not ready
+	DisableMockCA bool
+
+	// AllowMockCAFallback makes issuers with signerType pki but no PKI
+	// configuration ready with the built-in mockca signer
+	AllowMockCAFallback bool
+
+	// CAExpiry supplies the CA expiry observed in issued certificates for the
+	// Degraded condition; nil leaves the expiry stored in the status
+	CAExpiry *CAExpiryTracker
+
+	// PolicyAudit supplies the policy violations let through in Audit mode
+	// for the status; nil leaves the violations stored in the status
+	PolicyAudit *PolicyAuditTracker
+
+	// Clock supplies the current time for health check latency and expiry
+	// checks (default: the real clock)
+	Clock clock.PassiveClock
+
+	// OAuthTokens refreshes access tokens due for refresh on every recheck
+	// and reports failed refreshes in the Degraded condition
+	OAuthTokens *OAuthTokens
+
+	// Backends records the health check results for the controller's
+	// readiness and liveness probes; nil records nothing
+	Backends *BackendHealth
+
+	// HealthChecks probes the PKI endpoints shared by issuers on a schedule;
+	// nil makes every issuer probe its own endpoint on reconcile
+	HealthChecks *HealthChecker
 }
 
 // +kubebuilder:rbac:groups=external-issuer.io,resources=externalissuers,verbs=get;list;watch;update;patch
@@ -314,8 +1178,10 @@ func (r *IssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	logger := log.FromContext(ctx)
 
 	issuer := &externalissuerapi.ExternalIssuer{}
+	key := issuerKey(issuerKind, req.Namespace, req.Name)
 	if err := r.Get(ctx, req.NamespacedName, issuer); err != nil {
 		if apierrors.IsNotFound(err) {
+			forgetHealth(r.HealthChecks, r.Backends, key)
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, err
@@ -323,49 +1189,111 @@ func (r *IssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 
 	logger.Info("Reconciling ExternalIssuer", "name", issuer.Name, "namespace", issuer.Namespace)
 
-	// Determine signer type and check health
-	var err error
-	signerType := issuer.Spec.SignerType
-	if signerType == "" {
-		signerType = "mockca"
+	if err := recordControllerVersion(ctx, r.Client, issuer); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Paused issuers don't contact the PKI, not even for health checks
+	if issuer.Spec.Paused {
+		forgetHealth(r.HealthChecks, r.Backends, key)
+		meta.SetStatusCondition(&issuer.Status.Conditions, pausedCondition(issuer.Generation, clockOrReal(r.Clock).Now()))
+		return ctrl.Result{}, r.Status().Update(ctx, issuer)
 	}
 
-	if signerType == "pki" && issuer.Spec.ConfigMapRef != nil {
-		pkiConfig, loadErr := r.loadPKIConfigForIssuer(ctx, issuer.Spec.ConfigMapRef, issuer.Namespace)
+	// Determine signer type and check health
+	var err error
+	signerType := activeSignerType(&issuer.Spec)
+
+	var latency time.Duration
+	var authRef *externalissuerapi.AuthSecretReference
+	var auth *signer.PKIAuth
+	endpoint := mockCAStatusEndpoint
+	if usesPKIConfig(&issuer.Spec) {
+		var pkiConfig *signer.PKIConfig
+		var profileAuth *externalissuerapi.AuthSecretReference
+		var loadErr error
+		switch {
+		case issuer.Spec.ProfileRef != nil && r.DisablePKIProfiles:
+			loadErr = errPKIProfilesDisabled
+		case issuer.Spec.ProfileRef != nil:
+			pkiConfig, profileAuth, loadErr = loadPKIProfile(ctx, r.Client, &issuer.Spec)
+		default:
+			pkiConfig, loadErr = r.loadPKIConfigForIssuer(ctx, issuer.Spec.ConfigMapRef, issuer.Namespace)
+		}
+		authRef = authSecretRef(&issuer.Spec, profileAuth, issuer.Namespace)
+		endpoint = ""
+		if pkiConfig != nil {
+			auth = pkiConfig.Auth
+			endpoint = statusEndpoint(pkiConfig)
+		}
 		if loadErr != nil {
 			err = loadErr
+			forgetHealth(r.HealthChecks, r.Backends, key)
+		} else if pkiSigner, newErr := signer.NewPKISigner(pkiConfig); newErr != nil {
+			err = newErr
+			forgetHealth(r.HealthChecks, r.Backends, key)
+		} else if newErr := applyBackdate(pkiSigner, &issuer.Spec); newErr != nil {
+			err = newErr
+			forgetHealth(r.HealthChecks, r.Backends, key)
 		} else {
-			pkiSigner := signer.NewPKISigner(pkiConfig)
-			err = pkiSigner.CheckHealth()
+			pkiSigner.SetClock(r.Clock)
+			latency, err = r.HealthChecks.check(ctx, r.Backends, clockOrReal(r.Clock), pkiEndpoint(pkiConfig), key, issuer, pkiSigner, signerType)
 		}
+	} else if mockSigner, newErr := newMockCASigner(&issuer.Spec, r.DisableMockCA, r.AllowMockCAFallback, r.Clock); newErr != nil {
+		err = newErr
+		forgetHealth(r.HealthChecks, r.Backends, key)
 	} else {
-		mockSigner := signer.NewMockCASigner(issuer.Spec.URL)
-		err = mockSigner.CheckHealth()
+		latency, err = r.HealthChecks.check(ctx, r.Backends, clockOrReal(r.Clock), mockCAEndpoint(issuer.Spec.URL), key, issuer, mockSigner, signerType)
 	}
 
 	condition := metav1.Condition{
 		Type:               issuerReadyCondition,
-		LastTransitionTime: metav1.Now(),
+		LastTransitionTime: metav1.NewTime(clockOrReal(r.Clock).Now()),
 		ObservedGeneration: issuer.Generation,
 	}
 
-	if err != nil {
+	switch {
+	case errors.Is(err, errMissingPKIConfig), errors.Is(err, errNegativeBackdate), errors.Is(err, errInvalidPKIConfig):
+		logger.Error(err, "Invalid issuer configuration")
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = invalidIssuerConfigReason
+		condition.Message = summarizeMessage(err.Error())
+	case err != nil:
 		logger.Error(err, "CA health check failed")
 		condition.Status = metav1.ConditionFalse
 		condition.Reason = "HealthCheckFailed"
-		condition.Message = err.Error()
-	} else {
+		condition.Message = summarizeMessage(err.Error())
+	default:
 		condition.Status = metav1.ConditionTrue
 		condition.Reason = "Success"
 		condition.Message = fmt.Sprintf("%s CA is healthy and ready", signerType)
+		if mockCAFallback(&issuer.Spec) {
+			condition.Message += "; signerType pki falls back to mockca without configMapRef or profileRef"
+		}
 	}
 
 	meta.SetStatusCondition(&issuer.Status.Conditions, condition)
+	issuer.Status.SignerType = signerType
+	issuer.Status.Endpoint = endpoint
+	setDegradedCondition(ctx, r.Client, &issuer.Status, &issuer.Spec, issuerHealth{
+		key:        key,
+		generation: issuer.Generation,
+		checkedAt:  clockOrReal(r.Clock).Now(),
+		latency:    latency,
+		authRef:    authRef,
+		auth:       auth,
+	}, r.CAExpiry, r.OAuthTokens)
+	setPolicyAudit(&issuer.Status, key, r.PolicyAudit)
 	if updateErr := r.Status().Update(ctx, issuer); updateErr != nil {
 		return ctrl.Result{}, updateErr
 	}
 
-	return ctrl.Result{}, nil
+	// Recheck periodically so a slow PKI or expiring CA is noticed; issuers
+	// of scheduled endpoints are reconciled after each probe instead
+	if r.HealthChecks.scheduled(key) {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: issuerRecheckInterval}, nil
 }
 
 func (r *IssuerReconciler) loadPKIConfigForIssuer(ctx context.Context, ref *externalissuerapi.ConfigMapReference, defaultNs string) (*signer.PKIConfig, error) {
@@ -385,23 +1313,66 @@ func (r *IssuerReconciler) loadPKIConfigForIssuer(ctx context.Context, ref *exte
 	if !ok {
 		return nil, fmt.Errorf("key %s not found in ConfigMap", key)
 	}
-	var config signer.PKIConfig
-	if err := json.Unmarshal([]byte(configData), &config); err != nil {
-		return nil, fmt.Errorf("failed to parse PKI config: %w", err)
+	config, err := configbuilder.Parse([]byte(configData))
+	if err != nil {
+		return nil, fmt.Errorf("%w in ConfigMap %s/%s: %w", errInvalidPKIConfig, namespace, ref.Name, err)
 	}
-	return &config, nil
+	return config, nil
 }
 
 func (r *IssuerReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&externalissuerapi.ExternalIssuer{}).
-		Complete(r)
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&externalissuerapi.ExternalIssuer{})
+	if !r.DisablePKIProfiles {
+		b = b.Watches(&externalissuerapi.PKIProfile{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+			return issuersForProfile(ctx, r.Client, &externalissuerapi.ExternalIssuerList{}, obj.GetName())
+		}))
+	}
+	if r.HealthChecks != nil {
+		b = b.WatchesRawSource(r.HealthChecks.Source(issuerKind))
+	}
+	return b.Complete(tracedReconciler{name: "ExternalIssuer", Reconciler: r})
 }
 
 // ClusterIssuerReconciler reconciles ExternalClusterIssuer objects
 type ClusterIssuerReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// DisableMockCA marks issuers using the built-in mockca signer not ready
+	DisableMockCA bool
+
+	// AllowMockCAFallback makes issuers with signerType pki but no PKI
+	// configuration ready with the built-in mockca signer
+	AllowMockCAFallback bool
+
+	// CAExpiry supplies the CA expiry observed in issued certificates for the
+	// Degraded condition; nil leaves the expiry stored in the status
+	CAExpiry *CAExpiryTracker
+
+	// PolicyAudit supplies the policy violations let through in Audit mode
+	// for the status; nil leaves the violations stored in the status
+	PolicyAudit *PolicyAuditTracker
+
+	// Clock supplies the current time for health check latency and expiry
+	// checks (default: the real clock)
+	Clock clock.PassiveClock
+
+	// OAuthTokens refreshes access tokens due for refresh on every recheck
+	// and reports failed refreshes in the Degraded condition
+	OAuthTokens *OAuthTokens
+
+	// Backends records the health check results for the controller's
+	// readiness and liveness probes; nil records nothing
+	Backends *BackendHealth
+
+	// HealthChecks probes the PKI endpoints shared by issuers on a schedule;
+	// nil makes every issuer probe its own endpoint on reconcile
+	HealthChecks *HealthChecker
+
+	// ClusterResourceNamespace holds ConfigMaps that don't name a namespace
+	// (default external-issuer-system)
+	ClusterResourceNamespace string
 }
 
 // +kubebuilder:rbac:groups=external-issuer.io,resources=externalclusterissuers,verbs=get;list;watch;update;patch
@@ -411,8 +1382,10 @@ func (r *ClusterIssuerReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	logger := log.FromContext(ctx)
 
 	issuer := &externalissuerapi.ExternalClusterIssuer{}
+	key := issuerKey(clusterIssuerKind, "", req.Name)
 	if err := r.Get(ctx, req.NamespacedName, issuer); err != nil {
 		if apierrors.IsNotFound(err) {
+			forgetHealth(r.HealthChecks, r.Backends, key)
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, err
@@ -420,55 +1393,115 @@ func (r *ClusterIssuerReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 	logger.Info("Reconciling ExternalClusterIssuer", "name", issuer.Name)
 
-	// Determine signer type and check health
-	var err error
-	signerType := issuer.Spec.SignerType
-	if signerType == "" {
-		signerType = "mockca"
+	if err := recordControllerVersion(ctx, r.Client, issuer); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Paused issuers don't contact the PKI, not even for health checks
+	if issuer.Spec.Paused {
+		forgetHealth(r.HealthChecks, r.Backends, key)
+		meta.SetStatusCondition(&issuer.Status.Conditions, pausedCondition(issuer.Generation, clockOrReal(r.Clock).Now()))
+		return ctrl.Result{}, r.Status().Update(ctx, issuer)
 	}
 
-	if signerType == "pki" && issuer.Spec.ConfigMapRef != nil {
-		pkiConfig, loadErr := r.loadPKIConfigForClusterIssuer(ctx, issuer.Spec.ConfigMapRef)
+	// Determine signer type and check health
+	var err error
+	signerType := activeSignerType(&issuer.Spec)
+
+	var latency time.Duration
+	var authRef *externalissuerapi.AuthSecretReference
+	var auth *signer.PKIAuth
+	endpoint := mockCAStatusEndpoint
+	if usesPKIConfig(&issuer.Spec) {
+		var pkiConfig *signer.PKIConfig
+		var profileAuth *externalissuerapi.AuthSecretReference
+		var loadErr error
+		switch {
+		case issuer.Spec.ProfileRef != nil:
+			pkiConfig, profileAuth, loadErr = loadPKIProfile(ctx, r.Client, &issuer.Spec)
+		default:
+			pkiConfig, loadErr = r.loadPKIConfigForClusterIssuer(ctx, issuer.Spec.ConfigMapRef)
+		}
+		authRef = authSecretRef(&issuer.Spec, profileAuth, clusterResourceNamespace(r.ClusterResourceNamespace))
+		endpoint = ""
+		if pkiConfig != nil {
+			auth = pkiConfig.Auth
+			endpoint = statusEndpoint(pkiConfig)
+		}
 		if loadErr != nil {
 			err = loadErr
+			forgetHealth(r.HealthChecks, r.Backends, key)
+		} else if pkiSigner, newErr := signer.NewPKISigner(pkiConfig); newErr != nil {
+			err = newErr
+			forgetHealth(r.HealthChecks, r.Backends, key)
+		} else if newErr := applyBackdate(pkiSigner, &issuer.Spec); newErr != nil {
+			err = newErr
+			forgetHealth(r.HealthChecks, r.Backends, key)
 		} else {
-			pkiSigner := signer.NewPKISigner(pkiConfig)
-			err = pkiSigner.CheckHealth()
+			pkiSigner.SetClock(r.Clock)
+			latency, err = r.HealthChecks.check(ctx, r.Backends, clockOrReal(r.Clock), pkiEndpoint(pkiConfig), key, issuer, pkiSigner, signerType)
 		}
+	} else if mockSigner, newErr := newMockCASigner(&issuer.Spec, r.DisableMockCA, r.AllowMockCAFallback, r.Clock); newErr != nil {
+		err = newErr
+		forgetHealth(r.HealthChecks, r.Backends, key)
 	} else {
-		mockSigner := signer.NewMockCASigner(issuer.Spec.URL)
-		err = mockSigner.CheckHealth()
+		latency, err = r.HealthChecks.check(ctx, r.Backends, clockOrReal(r.Clock), mockCAEndpoint(issuer.Spec.URL), key, issuer, mockSigner, signerType)
 	}
 
 	condition := metav1.Condition{
 		Type:               issuerReadyCondition,
-		LastTransitionTime: metav1.Now(),
+		LastTransitionTime: metav1.NewTime(clockOrReal(r.Clock).Now()),
 		ObservedGeneration: issuer.Generation,
 	}
 
-	if err != nil {
+	switch {
+	case errors.Is(err, errMissingPKIConfig), errors.Is(err, errNegativeBackdate), errors.Is(err, errInvalidPKIConfig):
+		logger.Error(err, "Invalid issuer configuration")
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = invalidIssuerConfigReason
+		condition.Message = summarizeMessage(err.Error())
+	case err != nil:
 		logger.Error(err, "CA health check failed")
 		condition.Status = metav1.ConditionFalse
 		condition.Reason = "HealthCheckFailed"
-		condition.Message = err.Error()
-	} else {
+		condition.Message = summarizeMessage(err.Error())
+	default:
 		condition.Status = metav1.ConditionTrue
 		condition.Reason = "Success"
 		condition.Message = fmt.Sprintf("%s CA is healthy and ready", signerType)
+		if mockCAFallback(&issuer.Spec) {
+			condition.Message += "; signerType pki falls back to mockca without configMapRef or profileRef"
+		}
 	}
 
 	meta.SetStatusCondition(&issuer.Status.Conditions, condition)
+	issuer.Status.SignerType = signerType
+	issuer.Status.Endpoint = endpoint
+	setDegradedCondition(ctx, r.Client, &issuer.Status, &issuer.Spec, issuerHealth{
+		key:        key,
+		generation: issuer.Generation,
+		checkedAt:  clockOrReal(r.Clock).Now(),
+		latency:    latency,
+		authRef:    authRef,
+		auth:       auth,
+	}, r.CAExpiry, r.OAuthTokens)
+	setPolicyAudit(&issuer.Status, key, r.PolicyAudit)
 	if updateErr := r.Status().Update(ctx, issuer); updateErr != nil {
 		return ctrl.Result{}, updateErr
 	}
 
-	return ctrl.Result{}, nil
+	// Recheck periodically so a slow PKI or expiring CA is noticed; issuers
+	// of scheduled endpoints are reconciled after each probe instead
+	if r.HealthChecks.scheduled(key) {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: issuerRecheckInterval}, nil
 }
 
 func (r *ClusterIssuerReconciler) loadPKIConfigForClusterIssuer(ctx context.Context, ref *externalissuerapi.ConfigMapReference) (*signer.PKIConfig, error) {
 	namespace := ref.Namespace
 	if namespace == "" {
-		namespace = defaultNamespace
+		namespace = clusterResourceNamespace(r.ClusterResourceNamespace)
 	}
 	key := ref.Key
 	if key == "" {
@@ -482,15 +1515,21 @@ func (r *ClusterIssuerReconciler) loadPKIConfigForClusterIssuer(ctx context.Cont
 	if !ok {
 		return nil, fmt.Errorf("key %s not found in ConfigMap", key)
 	}
-	var config signer.PKIConfig
-	if err := json.Unmarshal([]byte(configData), &config); err != nil {
-		return nil, fmt.Errorf("failed to parse PKI config: %w", err)
+	config, err := configbuilder.Parse([]byte(configData))
+	if err != nil {
+		return nil, fmt.Errorf("%w in ConfigMap %s/%s: %w", errInvalidPKIConfig, namespace, ref.Name, err)
 	}
-	return &config, nil
+	return config, nil
 }
 
 func (r *ClusterIssuerReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&externalissuerapi.ExternalClusterIssuer{}).
-		Complete(r)
+		Watches(&externalissuerapi.PKIProfile{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+			return issuersForProfile(ctx, r.Client, &externalissuerapi.ExternalClusterIssuerList{}, obj.GetName())
+		}))
+	if r.HealthChecks != nil {
+		b = b.WatchesRawSource(r.HealthChecks.Source(clusterIssuerKind))
+	}
+	return b.Complete(tracedReconciler{name: "ExternalClusterIssuer", Reconciler: r})
 }
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// CredentialCache holds the data of auth Secrets. Entries are dropped when
+// their Secret changes or the PKI API rejects the credentials, so the next
+// request re-reads the Secret and re-authenticates with the rotated credentials.
+type CredentialCache struct {
+	mu      sync.RWMutex
+	secrets map[types.NamespacedName]map[string][]byte
+}
+
+// NewCredentialCache creates an empty credential cache
+func NewCredentialCache() *CredentialCache {
+	return &CredentialCache{secrets: map[types.NamespacedName]map[string][]byte{}}
+}
+
+// get returns the cached data of a Secret
+func (c *CredentialCache) get(key types.NamespacedName) (map[string][]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	data, ok := c.secrets[key]
+	return data, ok
+}
+
+// put caches the data read from a Secret
+func (c *CredentialCache) put(key types.NamespacedName, data map[string][]byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.secrets[key] = data
+}
+
+// Invalidate drops the cached data of a Secret and reports whether any was cached
+func (c *CredentialCache) Invalidate(key types.NamespacedName) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.secrets[key]
+	delete(c.secrets, key)
+	return ok
+}
+
+// SecretReconciler invalidates cached credentials and the access tokens
+// obtained with them when a Secret is created, updated or deleted
+type SecretReconciler struct {
+	Credentials *CredentialCache
+	OAuthTokens *OAuthTokens
+}
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if r.Credentials.Invalidate(req.NamespacedName) {
+		log.FromContext(ctx).Info("Secret changed, invalidated cached credentials", "secret", req.NamespacedName)
+	}
+	if r.OAuthTokens.Invalidate(req.NamespacedName) {
+		log.FromContext(ctx).Info("Secret changed, dropped access tokens obtained with it", "secret", req.NamespacedName)
+	}
+	authTokenExpiry.forget(req.NamespacedName)
+	return ctrl.Result{}, nil
+}
+
+func (r *SecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("credentials").
+		For(&corev1.Secret{}).
+		Complete(r)
+}
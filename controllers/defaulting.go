@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// defaultSignerType is the signer of issuers that don't name one
+	defaultSignerType = "mockca"
+
+	// defaultIssuerMode is the mode of issuers that don't set one
+	defaultIssuerMode = "x509"
+
+	// defaultDNSStartIndex is the index of the first DNS SAN parameter
+	defaultDNSStartIndex = 2
+
+	// defaultResponseFormat is the format of PKI responses
+	defaultResponseFormat = "pem"
+)
+
+// +kubebuilder:webhook:path=/mutate-external-issuer-io-v1alpha1-externalissuer,mutating=true,failurePolicy=ignore,sideEffects=None,groups=external-issuer.io,resources=externalissuers,verbs=create;update,versions=v1alpha1,name=mexternalissuer.external-issuer.io,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/mutate-external-issuer-io-v1alpha1-externalclusterissuer,mutating=true,failurePolicy=ignore,sideEffects=None,groups=external-issuer.io,resources=externalclusterissuers,verbs=create;update,versions=v1alpha1,name=mexternalclusterissuer.external-issuer.io,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/mutate-external-issuer-io-v1alpha1-pkiprofile,mutating=true,failurePolicy=ignore,sideEffects=None,groups=external-issuer.io,resources=pkiprofiles,verbs=create;update,versions=v1alpha1,name=mpkiprofile.external-issuer.io,admissionReviewVersions=v1
+
+// Defaulter fills in the defaults of issuers and PKIProfiles and normalizes
+// their URLs when they are written, so stored objects state the behavior
+// they get instead of relying on the defaults of the running controller
+type Defaulter struct{}
+
+// SetupWebhookWithManager registers the defaulting webhooks of issuers and PKIProfiles
+func (d *Defaulter) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	for _, obj := range []runtime.Object{
+		&externalissuerapi.ExternalIssuer{},
+		&externalissuerapi.ExternalClusterIssuer{},
+		&externalissuerapi.PKIProfile{},
+	} {
+		if err := ctrl.NewWebhookManagedBy(mgr).For(obj).WithDefaulter(d).Complete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Default fills in the defaults of an issuer or PKIProfile
+func (d *Defaulter) Default(_ context.Context, obj runtime.Object) error {
+	switch obj := obj.(type) {
+	case *externalissuerapi.ExternalIssuer:
+		defaultIssuerSpec(&obj.Spec)
+	case *externalissuerapi.ExternalClusterIssuer:
+		defaultIssuerSpec(&obj.Spec)
+	case *externalissuerapi.PKIProfile:
+		config, err := defaultPKIConfig(obj.Spec.Config.Raw)
+		if err != nil {
+			return err
+		}
+		obj.Spec.Config.Raw = config
+	default:
+		return fmt.Errorf("unexpected object %T", obj)
+	}
+	return nil
+}
+
+// defaultIssuerSpec fills in the defaults of an issuer spec
+func defaultIssuerSpec(spec *externalissuerapi.ExternalIssuerSpec) {
+	if spec.SignerType == "" {
+		spec.SignerType = defaultSignerType
+	}
+	if spec.Mode == "" {
+		spec.Mode = defaultIssuerMode
+	}
+	if spec.ConfigMapRef != nil && spec.ConfigMapRef.Key == "" {
+		spec.ConfigMapRef.Key = defaultConfigKey
+	}
+	spec.URL = normalizeURL(spec.URL)
+}
+
+// defaultPKIConfig fills in the defaults of a PKI configuration in its JSON
+// form, keeping fields this version doesn't know. Where the configuration's
+// preset sets a defaulted field, the preset's value is written, so the stored
+// configuration doesn't change meaning when the preset does.
+func defaultPKIConfig(raw []byte) ([]byte, error) {
+	if len(raw) == 0 {
+		return raw, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("invalid PKI configuration: %w", err)
+	}
+	var config signer.PKIConfig
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("invalid PKI configuration: %w", err)
+	}
+
+	if baseURL, ok := fields["baseUrl"].(string); ok {
+		fields["baseUrl"] = normalizeURL(baseURL)
+	}
+	if endpoints, ok := fields["endpoints"].([]interface{}); ok {
+		for _, endpoint := range endpoints {
+			if endpoint, ok := endpoint.(map[string]interface{}); ok {
+				if endpointURL, ok := endpoint["url"].(string); ok {
+					endpoint["url"] = normalizeURL(endpointURL)
+				}
+			}
+		}
+	}
+
+	if config.Parameters.DNSPrefix != "" {
+		startIndex := config.Parameters.DNSStartIndex
+		if startIndex == 0 {
+			startIndex = defaultDNSStartIndex
+		}
+		setField(fields, "parameters", "dnsStartIndex", startIndex)
+	}
+	format := config.Response.Format
+	if format == "" {
+		format = defaultResponseFormat
+	}
+	setField(fields, "response", "format", format)
+
+	return json.Marshal(fields)
+}
+
+// setField sets a field of a nested object, creating the object if needed
+func setField(fields map[string]interface{}, object, field string, value interface{}) {
+	nested, ok := fields[object].(map[string]interface{})
+	if !ok {
+		nested = map[string]interface{}{}
+		fields[object] = nested
+	}
+	nested[field] = value
+}
+
+// normalizeURL lowercases the scheme and host of a URL and drops default
+// ports and an empty path, so equal endpoints are written alike. URLs that
+// don't parse are left to validation.
+func normalizeURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		port = ""
+	}
+	u.Host = host
+	if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	}
+	if port != "" {
+		u.Host += ":" + port
+	}
+	if u.Path == "/" && u.RawQuery == "" {
+		u.Path = ""
+	}
+	return u.String()
+}
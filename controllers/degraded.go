@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// degradedCondition reports an issuer that still works but is slow or
+	// will break soon, as opposed to Ready=False for one that is broken
+	degradedCondition = "Degraded"
+
+	// credentialsExpiryAnnotation on an auth Secret holds when its credentials expire (RFC 3339)
+	credentialsExpiryAnnotation = "external-issuer.io/expires-at"
+
+	// issuerRecheckInterval is how often issuers are health checked again
+	issuerRecheckInterval = 10 * time.Minute
+
+	defaultHealthCheckLatencyThreshold = 5 * time.Second
+	defaultCAExpiryThreshold           = 30 * 24 * time.Hour
+	defaultCredentialsExpiryThreshold  = 7 * 24 * time.Hour
+)
+
+// CAExpiryTracker remembers the earliest expiry in the CA chain of the
+// certificates last issued through each issuer. The issuer reconcilers report
+// it in the Degraded condition and persist it in the issuer status.
+type CAExpiryTracker struct {
+	mu       sync.RWMutex
+	notAfter map[string]time.Time
+}
+
+// NewCAExpiryTracker creates an empty CA expiry tracker
+func NewCAExpiryTracker() *CAExpiryTracker {
+	return &CAExpiryTracker{notAfter: map[string]time.Time{}}
+}
+
+// issuerKey identifies an issuer of the given kind; cluster issuers have no namespace
+func issuerKey(kind, namespace, name string) string {
+	if kind == clusterIssuerKind {
+		namespace = ""
+	}
+	return kind + "/" + namespace + "/" + name
+}
+
+// observe records the CA chain returned with a certificate of an issuer
+func (t *CAExpiryTracker) observe(key string, caPEM []byte) {
+	if t == nil || len(caPEM) == 0 {
+		return
+	}
+	certs, err := parsePEMCertificates(caPEM)
+	if err != nil || len(certs) == 0 {
+		return
+	}
+	earliest := certs[0].NotAfter
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.notAfter[key] = earliest
+}
+
+// get returns the CA expiry last observed for an issuer
+func (t *CAExpiryTracker) get(key string) (time.Time, bool) {
+	if t == nil {
+		return time.Time{}, false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	notAfter, ok := t.notAfter[key]
+	return notAfter, ok
+}
+
+// timedHealthCheck runs the health check of a signer and returns how long it
+// took if it succeeded
+func timedHealthCheck(ctx context.Context, clk clock.PassiveClock, s Signer, signerType string) (time.Duration, error) {
+	start := clk.Now()
+	if err := checkSignerHealth(ctx, s, signerType); err != nil {
+		return 0, err
+	}
+	return clk.Since(start), nil
+}
+
+// issuerHealth is what an issuer's Degraded condition is computed from
+type issuerHealth struct {
+	// key identifies the issuer, see issuerKey
+	key        string
+	generation int64
+	// checkedAt is when the issuer was health checked
+	checkedAt time.Time
+	// latency is how long the health check took, 0 if it failed
+	latency time.Duration
+	// authRef and auth are the issuer's auth Secret and PKI auth configuration
+	authRef *externalissuerapi.AuthSecretReference
+	auth    *signer.PKIAuth
+}
+
+// threshold returns a configured Degraded threshold or its default
+func threshold(d *metav1.Duration, def time.Duration) time.Duration {
+	if d == nil {
+		return def
+	}
+	return d.Duration
+}
+
+// tokenRefreshError is a failed refresh of an issuer's access token
+type tokenRefreshError struct {
+	err error
+}
+
+func (e *tokenRefreshError) Error() string { return e.err.Error() }
+func (e *tokenRefreshError) Unwrap() error { return e.err }
+
+// credentialsExpiry returns when an issuer's credentials expire: the expiry
+// annotated on its auth Secret or the exp claim of a JWT in it, whichever is
+// earlier. Refreshed access tokens are short-lived by design, so with refresh
+// configured the token is refreshed if due instead and a failed refresh is
+// returned as a tokenRefreshError. A missing Secret or annotation is not an
+// error: the PKI reports bad credentials.
+func credentialsExpiry(ctx context.Context, c client.Reader, ref *externalissuerapi.AuthSecretReference, auth *signer.PKIAuth, tokens *OAuthTokens) (*time.Time, error) {
+	if ref == nil {
+		return nil, nil
+	}
+	key := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, key, secret); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	var expiry *time.Time
+	if value, ok := secret.Annotations[credentialsExpiryAnnotation]; ok {
+		annotated, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation on Secret %s/%s: %w", credentialsExpiryAnnotation, ref.Namespace, ref.Name, err)
+		}
+		expiry = &annotated
+	}
+
+	if auth != nil && auth.Refresh != nil {
+		if tokens != nil {
+			if err := tokens.refreshError(ctx, key, secret.Data, auth.Refresh); err != nil {
+				return expiry, &tokenRefreshError{err: err}
+			}
+		}
+		return expiry, nil
+	}
+	authType := ""
+	if auth != nil {
+		authType = auth.Type
+	}
+	// Only the token's expiry is read here; key detection is reported when signing
+	if creds, err := selectCredentials(secret.Data, ref, authType, true); err == nil {
+		if exp, ok := signer.JWTExpiry(creds.token); ok {
+			authTokenExpiry.observe(key, exp)
+			if expiry == nil || exp.Before(*expiry) {
+				expiry = &exp
+			}
+		}
+	}
+	return expiry, nil
+}
+
+// setDegradedCondition updates the CA expiry in an issuer's status and sets
+// its Degraded condition from the health check latency, the CA expiry and the
+// expiry of the credentials in the auth Secret
+func setDegradedCondition(ctx context.Context, c client.Reader, status *externalissuerapi.ExternalIssuerStatus, spec *externalissuerapi.ExternalIssuerSpec,
+	health issuerHealth, tracker *CAExpiryTracker, tokens *OAuthTokens) {
+	logger := log.FromContext(ctx)
+
+	if notAfter, ok := tracker.get(health.key); ok {
+		status.CANotAfter = &metav1.Time{Time: notAfter}
+	}
+
+	thresholds := spec.Degraded
+	if thresholds == nil {
+		thresholds = &externalissuerapi.DegradedThresholds{}
+	}
+	now := health.checkedAt
+	var reasons, messages []string
+
+	if limit := threshold(thresholds.HealthCheckLatency, defaultHealthCheckLatencyThreshold); limit > 0 && health.latency > limit {
+		reasons = append(reasons, "SlowHealthCheck")
+		messages = append(messages, fmt.Sprintf("health check took longer than %s", limit))
+	}
+	if limit := threshold(thresholds.CAExpiry, defaultCAExpiryThreshold); limit > 0 && status.CANotAfter != nil && status.CANotAfter.Sub(now) < limit {
+		reasons = append(reasons, "CAExpiring")
+		messages = append(messages, fmt.Sprintf("CA certificate expires at %s", status.CANotAfter.UTC().Format(time.RFC3339)))
+	}
+	if limit := threshold(thresholds.CredentialsExpiry, defaultCredentialsExpiryThreshold); limit > 0 {
+		expiry, err := credentialsExpiry(ctx, c, health.authRef, health.auth, tokens)
+		var refreshErr *tokenRefreshError
+		if errors.As(err, &refreshErr) {
+			reasons = append(reasons, "CredentialsRefreshFailed")
+			messages = append(messages, refreshErr.Error())
+		} else if err != nil {
+			logger.Error(err, "Failed to read credentials expiry")
+		}
+		if expiry != nil && expiry.Sub(now) < limit {
+			reasons = append(reasons, "CredentialsExpiring")
+			messages = append(messages, fmt.Sprintf("credentials in Secret %s/%s expire at %s",
+				health.authRef.Namespace, health.authRef.Name, expiry.UTC().Format(time.RFC3339)))
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               degradedCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             "AsExpected",
+		Message:            "Issuer is not degraded",
+		LastTransitionTime: metav1.NewTime(now),
+		ObservedGeneration: health.generation,
+	}
+	if len(reasons) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasons[0]
+		condition.Message = summarizeMessage(strings.Join(messages, "; "))
+		logger.Info("Issuer is degraded", "reasons", reasons)
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// signRetryAnnotation records when a request whose signing failed with a
+// mapped PKI error may be sent again
+const signRetryAnnotation = "external-issuer.io/sign-retry-after"
+
+// checkSignRetry reports whether a request must wait before it is signed
+// again, returning the remaining delay
+func checkSignRetry(cr *cmapi.CertificateRequest, now time.Time) (time.Duration, bool) {
+	value, ok := cr.Annotations[signRetryAnnotation]
+	if !ok {
+		return 0, false
+	}
+	retryAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		// An unreadable retry time doesn't hold the request back
+		return 0, false
+	}
+	if wait := retryAt.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, false
+}
+
+// deferSigning removes the signing attempt of a request like releaseSigning
+// and records when it may be signed again, in one patch so no reconcile sees
+// the request released without its retry time
+func (r *CertificateRequestReconciler) deferSigning(ctx context.Context, cr *cmapi.CertificateRequest, retryAt time.Time) error {
+	patch := client.MergeFrom(cr.DeepCopy())
+	if cr.Annotations == nil {
+		cr.Annotations = map[string]string{}
+	}
+	delete(cr.Annotations, signAttemptAnnotation)
+	cr.Annotations[signRetryAnnotation] = retryAt.UTC().Format(time.RFC3339)
+	if err := r.Patch(ctx, cr, patch); err != nil {
+		return fmt.Errorf("failed to record signing retry: %w", err)
+	}
+	return nil
+}
+
+// mappedSigningFailure reports a signing error matched by an error mapping of
+// the PKI configuration with its reason, retry class and message
+func (r *CertificateRequestReconciler) mappedSigningFailure(ctx context.Context, cr *cmapi.CertificateRequest, signerType string, mapped *signer.MappedError) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if mapped.Retry == signer.RetryClassFail {
+		if err := r.releaseSigning(ctx, cr); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.issuanceEvent(cr, corev1.EventTypeWarning, "SigningFailed", signerType, mapped.Message)
+		return ctrl.Result{}, r.setFailed(ctx, cr, mapped.Message)
+	}
+
+	var result ctrl.Result
+	if mapped.RetryAfter > 0 {
+		retryAt := clockOrReal(r.Clock).Now().Add(mapped.RetryAfter)
+		if err := r.deferSigning(ctx, cr, retryAt); err != nil {
+			return ctrl.Result{}, err
+		}
+		result.RequeueAfter = mapped.RetryAfter
+		logger.Info("Signing retried later", "name", cr.Name, "reason", mapped.Reason, "retryAt", retryAt)
+	} else if err := r.releaseSigning(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	eventType := corev1.EventTypeWarning
+	if mapped.Retry == signer.RetryClassPending {
+		eventType = corev1.EventTypeNormal
+	}
+	r.issuanceEvent(cr, eventType, mapped.Reason, signerType, mapped.Message)
+	return result, r.setStatus(ctx, cr, cmmeta.ConditionFalse, mapped.Reason, mapped.Message)
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/exporter"
+	"github.com/bvorland/cert-manager-external-issuer/internal/hooks"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// exportIssued queues an inventory record for a certificate that was just
+// issued, recording renewals as such
+func (r *CertificateRequestReconciler) exportIssued(ctx context.Context, cr *cmapi.CertificateRequest) {
+	event := exporter.EventIssued
+	if isRenewal(cr) {
+		event = exporter.EventRenewed
+	}
+	r.export(ctx, cr, event)
+}
+
+// export queues an inventory record for the certificate of a request
+func (r *CertificateRequestReconciler) export(ctx context.Context, cr *cmapi.CertificateRequest, event string) {
+	if r.Exporter == nil {
+		return
+	}
+	logger := log.FromContext(ctx)
+
+	record, err := exporter.NewRecord(event, cr.Status.Certificate)
+	if err != nil {
+		logger.Error(err, "Failed to build inventory record", "name", cr.Name)
+		return
+	}
+	record.Namespace = cr.Namespace
+	record.CertificateRequest = cr.Name
+	record.Certificate = cr.Annotations[cmapi.CertificateNameKey]
+	record.IssuerKind = cr.Spec.IssuerRef.Kind
+	record.IssuerName = cr.Spec.IssuerRef.Name
+	record.Origin = r.requestOrigin(ctx, cr)
+
+	if err := r.Exporter.Enqueue(record); err != nil {
+		logger.Error(err, "Failed to queue inventory record", "name", cr.Name)
+	}
+}
+
+// runHooks queues the post-issuance hooks for a certificate that was just issued
+func (r *CertificateRequestReconciler) runHooks(ctx context.Context, cr *cmapi.CertificateRequest) {
+	if r.Hooks == nil {
+		return
+	}
+	event := hooks.Event{
+		Renewal:            isRenewal(cr),
+		Namespace:          cr.Namespace,
+		CertificateRequest: cr.Name,
+		CertificateName:    cr.Annotations[cmapi.CertificateNameKey],
+		IssuerKind:         cr.Spec.IssuerRef.Kind,
+		IssuerName:         cr.Spec.IssuerRef.Name,
+		Certificate:        string(cr.Status.Certificate),
+		CA:                 string(cr.Status.CA),
+	}
+	if err := r.Hooks.Enqueue(event); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to queue post-issuance hooks", "name", cr.Name)
+	}
+}
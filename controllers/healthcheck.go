@@ -0,0 +1,333 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// healthCheckJitter delays each probe by up to this fraction of the
+	// interval, so endpoints registered together aren't probed in lockstep
+	healthCheckJitter = 0.1
+)
+
+// HealthChecker probes the PKI endpoints of the issuers on a schedule.
+// Issuers with the same PKI configuration share an endpoint, its probes and
+// its result, so hundreds of namespaced issuers pointing at one PKI cost one
+// probe per interval. After each probe every issuer of the endpoint is
+// reconciled to update its status.
+//
+// The issuer reconcilers register their issuers' endpoints; an endpoint is
+// probed right away when it is new and dropped with its last issuer.
+type HealthChecker struct {
+	// Backends records each issuer's result for the readiness and liveness
+	// probes; nil records nothing
+	Backends *BackendHealth
+
+	// Interval is the time between probes of an endpoint (default: issuerRecheckInterval)
+	Interval time.Duration
+
+	// Clock schedules the probes and times them (default: the real clock)
+	Clock clock.Clock
+
+	mu        sync.Mutex
+	endpoints map[string]*healthEndpoint
+	// issuers maps issuer keys to the endpoint they are registered with
+	issuers map[string]string
+	// events receive the issuers to reconcile after probes, by kind
+	events map[string]chan event.GenericEvent
+	// running is set while the probes are scheduled
+	running atomic.Bool
+}
+
+// healthEndpoint is a PKI endpoint probed on behalf of its issuers
+type healthEndpoint struct {
+	// probing serializes the probes of the endpoint
+	probing sync.Mutex
+
+	// The fields below are guarded by the HealthChecker's mutex
+	signer     Signer
+	signerType string
+	// issuers reference the registered issuers by issuer key
+	issuers map[string]client.Object
+	// checked is set once the endpoint was probed
+	checked   bool
+	latency   time.Duration
+	err       error
+	nextProbe time.Time
+}
+
+// NewHealthChecker creates a health checker recording results in backends
+func NewHealthChecker(backends *BackendHealth) *HealthChecker {
+	return &HealthChecker{
+		Backends:  backends,
+		endpoints: map[string]*healthEndpoint{},
+		issuers:   map[string]string{},
+		events:    map[string]chan event.GenericEvent{},
+	}
+}
+
+// pkiEndpoint identifies the endpoint of a PKI configuration; issuers whose
+// configurations are equal share their probes
+func pkiEndpoint(config *signer.PKIConfig) string {
+	data, err := json.Marshal(config)
+	if err != nil {
+		// Configurations are plain data; fall back to not sharing probes
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return "pki/" + hex.EncodeToString(sum[:])
+}
+
+// mockCAEndpoint identifies the endpoint of the built-in mockca signer for
+// an issuer's URL
+func mockCAEndpoint(url string) string {
+	return "mockca/" + url
+}
+
+// Source returns the source of the events reconciling issuers of a kind
+// after their endpoint was probed, for the issuer controllers to watch
+func (c *HealthChecker) Source(kind string) source.Source {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	events, ok := c.events[kind]
+	if !ok {
+		events = make(chan event.GenericEvent, 100)
+		c.events[kind] = events
+	}
+	return source.Channel(events, &handler.EnqueueRequestForObject{})
+}
+
+// NeedLeaderElection makes only the leader, which runs the issuer
+// reconcilers, probe the endpoints
+func (c *HealthChecker) NeedLeaderElection() bool {
+	return true
+}
+
+// Start probes the registered endpoints when they are due until ctx is cancelled
+func (c *HealthChecker) Start(ctx context.Context) error {
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithName("health-checker"))
+	c.running.Store(true)
+	defer c.running.Store(false)
+
+	for {
+		wait := c.probeDue(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.clock().After(wait):
+		}
+	}
+}
+
+// scheduled reports whether an issuer is registered with an endpoint that
+// is probed on a schedule; other issuers recheck themselves periodically
+func (c *HealthChecker) scheduled(key string) bool {
+	if c == nil || !c.running.Load() {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.issuers[key]
+	return ok
+}
+
+// check registers an issuer with an endpoint and returns the endpoint's
+// latest result, probing it first with the issuer's signer if it is new.
+// Without a health checker the signer is probed for the issuer alone.
+func (c *HealthChecker) check(ctx context.Context, backends *BackendHealth, clk clock.PassiveClock, endpoint, key string, issuer client.Object, s Signer, signerType string) (time.Duration, error) {
+	if c == nil || endpoint == "" {
+		c.forget(key)
+		return backends.check(ctx, key, clk, s, signerType)
+	}
+
+	c.mu.Lock()
+	if previous, ok := c.issuers[key]; ok && previous != endpoint {
+		c.unregisterLocked(key)
+	}
+	e, ok := c.endpoints[endpoint]
+	if !ok {
+		e = &healthEndpoint{signer: s, signerType: signerType, issuers: map[string]client.Object{}}
+		c.endpoints[endpoint] = e
+		log.FromContext(ctx).V(1).Info("Registered health check endpoint", "endpoint", endpoint, "signerType", signerType)
+	}
+	e.issuers[key] = issuerRef(kindOf(issuer), issuer.GetNamespace(), issuer.GetName())
+	c.issuers[key] = endpoint
+	checked := e.checked
+	c.mu.Unlock()
+
+	if !checked {
+		c.probe(ctx, endpoint, e, false)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Backends.record(key, e.err)
+	return e.latency, e.err
+}
+
+// forget unregisters a deleted issuer, or one whose backend is no longer
+// health checked because its configuration is invalid
+func (c *HealthChecker) forget(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unregisterLocked(key)
+}
+
+// unregisterLocked removes an issuer from its endpoint, dropping the
+// endpoint with its last issuer; the caller must hold the lock
+func (c *HealthChecker) unregisterLocked(key string) {
+	endpoint, ok := c.issuers[key]
+	if !ok {
+		return
+	}
+	delete(c.issuers, key)
+	if e := c.endpoints[endpoint]; e != nil {
+		delete(e.issuers, key)
+		if len(e.issuers) == 0 {
+			delete(c.endpoints, endpoint)
+		}
+	}
+}
+
+// probeDue probes the endpoints that are due concurrently and returns the
+// time until the next endpoint is due
+func (c *HealthChecker) probeDue(ctx context.Context) time.Duration {
+	now := c.clock().Now()
+	next := c.interval()
+
+	c.mu.Lock()
+	due := map[string]*healthEndpoint{}
+	for endpoint, e := range c.endpoints {
+		if !e.checked {
+			// Probed by the reconcile that registered it
+			continue
+		}
+		if wait := e.nextProbe.Sub(now); wait > 0 {
+			next = min(next, wait)
+			continue
+		}
+		due[endpoint] = e
+	}
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for endpoint, e := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.probe(ctx, endpoint, e, true)
+		}()
+	}
+	wg.Wait()
+	if len(due) > 0 {
+		// Probes that took long may have made other endpoints due
+		return 0
+	}
+	return next
+}
+
+// probe checks an endpoint's health, records the result for its issuers and,
+// if fanOut is set, has them reconciled. A probe already running for the
+// endpoint is waited for rather than repeated.
+func (c *HealthChecker) probe(ctx context.Context, endpoint string, e *healthEndpoint, fanOut bool) {
+	e.probing.Lock()
+	defer e.probing.Unlock()
+
+	c.mu.Lock()
+	if e.checked && !fanOut {
+		c.mu.Unlock()
+		return
+	}
+	s, signerType := e.signer, e.signerType
+	c.mu.Unlock()
+
+	latency, err := timedHealthCheck(ctx, c.clock(), s, signerType)
+
+	c.mu.Lock()
+	e.checked, e.latency, e.err = true, latency, err
+	e.nextProbe = c.clock().Now().Add(wait.Jitter(c.interval(), healthCheckJitter))
+	issuers := make([]client.Object, 0, len(e.issuers))
+	for key, issuer := range e.issuers {
+		c.Backends.record(key, err)
+		issuers = append(issuers, issuer)
+	}
+	events := c.events
+	c.mu.Unlock()
+
+	logger := log.FromContext(ctx)
+	if err != nil {
+		logger.Error(err, "Health check of endpoint failed", "endpoint", endpoint, "signerType", signerType, "issuers", len(issuers))
+	} else {
+		logger.V(1).Info("Health check of endpoint succeeded", "endpoint", endpoint, "signerType", signerType, "issuers", len(issuers), "latency", latency)
+	}
+	if !fanOut {
+		return
+	}
+	for _, issuer := range issuers {
+		ch, ok := events[kindOf(issuer)]
+		if !ok {
+			continue
+		}
+		select {
+		case ch <- event.GenericEvent{Object: issuer}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// kindOf returns the issuer kind of an issuer object
+func kindOf(issuer client.Object) string {
+	if _, ok := issuer.(*externalissuerapi.ExternalClusterIssuer); ok {
+		return clusterIssuerKind
+	}
+	return issuerKind
+}
+
+// issuerRef returns an object referencing an issuer, for reconcile events
+func issuerRef(kind, namespace, name string) client.Object {
+	if kind == clusterIssuerKind {
+		return &externalissuerapi.ExternalClusterIssuer{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	return &externalissuerapi.ExternalIssuer{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+}
+
+func (c *HealthChecker) interval() time.Duration {
+	if c.Interval <= 0 {
+		return issuerRecheckInterval
+	}
+	return c.Interval
+}
+
+func (c *HealthChecker) clock() clock.Clock {
+	if c.Clock == nil {
+		return clock.RealClock{}
+	}
+	return c.Clock
+}
+
+// forgetHealth drops the health check results and endpoint of an issuer
+func forgetHealth(checker *HealthChecker, backends *BackendHealth, key string) {
+	checker.forget(key)
+	backends.forget(key)
+}
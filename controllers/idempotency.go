@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// signAttemptAnnotation records when the CSR was sent to the PKI. It is
+	// written before the call, so a certificate whose status update was lost
+	// isn't requested a second time.
+	signAttemptAnnotation = "external-issuer.io/sign-attempt"
+
+	// requestHashAnnotation is the SHA-256 of the CSR sent in the attempt,
+	// for correlating the attempt with the PKI's records
+	requestHashAnnotation = "external-issuer.io/request-hash"
+
+	// signAttemptGrace is added to the drain timeout before an attempt without
+	// a result is considered lost rather than still in flight
+	signAttemptGrace = 10 * time.Second
+)
+
+// recordRetry retries recording an issued certificate while the API server is unavailable
+var recordRetry = wait.Backoff{Duration: time.Second, Factor: 2, Steps: 5, Cap: 10 * time.Second}
+
+// requestHash returns the hash recorded for a CSR
+func requestHash(csrPEM []byte) string {
+	sum := sha256.Sum256(csrPEM)
+	return hex.EncodeToString(sum[:])
+}
+
+// claimSigning records a signing attempt right before the CSR is sent. The
+// patch fails on a conflict, so of two reconciles working from different
+// versions of the request only one gets to sign it.
+func (r *CertificateRequestReconciler) claimSigning(ctx context.Context, cr *cmapi.CertificateRequest) error {
+	patch := client.MergeFromWithOptions(cr.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	if cr.Annotations == nil {
+		cr.Annotations = map[string]string{}
+	}
+	cr.Annotations[signAttemptAnnotation] = clockOrReal(r.Clock).Now().UTC().Format(time.RFC3339)
+	cr.Annotations[requestHashAnnotation] = requestHash(cr.Spec.Request)
+	delete(cr.Annotations, signRetryAnnotation)
+	if err := r.Patch(ctx, cr, patch); err != nil {
+		return fmt.Errorf("failed to record signing attempt: %w", err)
+	}
+	return nil
+}
+
+// releaseSigning removes a signing attempt whose outcome is known not to be a
+// certificate, so the request may be signed again
+func (r *CertificateRequestReconciler) releaseSigning(ctx context.Context, cr *cmapi.CertificateRequest) error {
+	if _, ok := cr.Annotations[signAttemptAnnotation]; !ok {
+		return nil
+	}
+	patch := client.MergeFrom(cr.DeepCopy())
+	delete(cr.Annotations, signAttemptAnnotation)
+	if err := r.Patch(ctx, cr, patch); err != nil {
+		return fmt.Errorf("failed to clear signing attempt: %w", err)
+	}
+	return nil
+}
+
+// checkSignAttempt handles a request that was sent to the PKI without its
+// result being recorded, e.g. because the controller died or the status
+// update failed after the CA issued the certificate. It reports true if such
+// an attempt exists; the request is then not signed again.
+//
+// An attempt younger than the drain timeout may still be in flight on a
+// controller instance that is shutting down and is waited for. Older attempts
+// need a human to check the PKI: signing again could issue a duplicate.
+func (r *CertificateRequestReconciler) checkSignAttempt(ctx context.Context, cr *cmapi.CertificateRequest) (ctrl.Result, bool, error) {
+	value, ok := cr.Annotations[signAttemptAnnotation]
+	if !ok {
+		return ctrl.Result{}, false, nil
+	}
+	attempted, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		// An unreadable attempt is treated as lost
+		attempted = time.Time{}
+	}
+	if remaining := attempted.Add(r.drainTimeout() + signAttemptGrace).Sub(clockOrReal(r.Clock).Now()); remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, true, nil
+	}
+
+	message := fmt.Sprintf("Signing was attempted at %s but its result was not recorded; the PKI may have issued a certificate "+
+		"for request hash %s. Not signing again to avoid a duplicate: check the PKI, then remove annotation %s to sign again",
+		value, cr.Annotations[requestHashAnnotation], signAttemptAnnotation)
+	if hasReadyCondition(cr, cmapi.CertificateRequestReasonPending, summarizeMessage(message)) {
+		return ctrl.Result{}, true, nil
+	}
+	log.FromContext(ctx).Info("Signing attempt without recorded result, not signing again", "name", cr.Name, "attempted", value)
+	if r.Recorder != nil {
+		r.Recorder.Event(cr, corev1.EventTypeWarning, "SigningOutcomeUnknown", truncateMessage(message, maxEventMessageLength))
+	}
+	return ctrl.Result{}, true, r.setStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, message)
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+)
+
+func TestSigningFailureAfterIssuance(t *testing.T) {
+	for name, tc := range map[string]struct {
+		// respond answers the signing request
+		respond      func(w http.ResponseWriter, certPEM []byte)
+		wantSubmits  int
+		wantAttempt  bool
+		wantReadyNow string
+	}{
+		"response lost": {
+			// The PKI issues the certificate, but the connection drops
+			// while the response is read
+			respond: func(w http.ResponseWriter, certPEM []byte) {
+				w.Header().Set("Content-Length", "4096")
+				w.Write(certPEM[:len(certPEM)/2])
+			},
+			wantSubmits:  1,
+			wantAttempt:  true,
+			wantReadyNow: cmapi.CertificateRequestReasonPending,
+		},
+		"server error": {
+			respond: func(w http.ResponseWriter, _ []byte) {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+			},
+			wantSubmits:  1,
+			wantAttempt:  true,
+			wantReadyNow: cmapi.CertificateRequestReasonPending,
+		},
+		"rejected": {
+			respond: func(w http.ResponseWriter, _ []byte) {
+				http.Error(w, "invalid request", http.StatusBadRequest)
+			},
+			wantSubmits:  2,
+			wantReadyNow: "SigningFailed",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pki := &fakePKI{certPEM: selfSignedCertificate(t, time.Now(), 24*time.Hour)}
+			pki.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.Method != http.MethodPost {
+					// Health checks
+					return
+				}
+				pki.mu.Lock()
+				pki.submits++
+				pki.mu.Unlock()
+				tc.respond(w, pki.certPEM)
+			}))
+			t.Cleanup(pki.Close)
+			c := newCluster(t, pki)
+			r := c.instance(nil)
+
+			result, _ := c.reconcile(r)
+			if _, ok := c.request().Annotations[signAttemptAnnotation]; ok != tc.wantAttempt {
+				t.Fatalf("signing attempt recorded %t after the failure, want %t", ok, tc.wantAttempt)
+			}
+
+			// Reconciles after the attempt could have finished sign again only
+			// if the PKI rejected the request
+			c.clock.Step(result.RequeueAfter + signAttemptGrace)
+			c.reconcile(r)
+			if submits, _ := pki.counts(); submits != tc.wantSubmits {
+				t.Fatalf("CSR submitted %d times, want %d", submits, tc.wantSubmits)
+			}
+			if reason := c.readyReason(); reason != tc.wantReadyNow {
+				t.Errorf("Ready reason %q, want %s", reason, tc.wantReadyNow)
+			}
+		})
+	}
+}
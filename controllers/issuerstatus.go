@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// mockCAStatusEndpoint is the endpoint in the status of issuers signing
+// with the built-in Mock CA
+const mockCAStatusEndpoint = "built-in"
+
+// statusEndpoint returns the endpoint reported in the status of issuers
+// using a PKI configuration: the host of the primary endpoint of the PKI API,
+// or the transport of PKIs reached over a message queue or files
+func statusEndpoint(config *signer.PKIConfig) string {
+	if config.Transport != nil && config.Transport.Type != "" && config.Transport.Type != "http" {
+		return config.Transport.Type
+	}
+	urls := config.EndpointURLs()
+	if len(urls) == 0 {
+		return ""
+	}
+	u, err := url.Parse(urls[0])
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Host
+}
+
+// recordIssuance counts an issued certificate and its time in the status of
+// the request's issuer
+func (r *CertificateRequestReconciler) recordIssuance(ctx context.Context, cr *cmapi.CertificateRequest, now time.Time) {
+	r.updateIssuerStatus(ctx, cr, func(status *externalissuerapi.ExternalIssuerStatus) {
+		status.CertificatesIssued++
+		status.LastIssuanceTime = &metav1.Time{Time: now}
+	})
+}
+
+// recordIssuanceFailure records the time and condition reason of a failed
+// request in the status of its issuer
+func (r *CertificateRequestReconciler) recordIssuanceFailure(ctx context.Context, cr *cmapi.CertificateRequest, reason string, now time.Time) {
+	r.updateIssuerStatus(ctx, cr, func(status *externalissuerapi.ExternalIssuerStatus) {
+		status.LastFailureTime = &metav1.Time{Time: now}
+		status.LastFailureReason = reason
+	})
+}
+
+// issuanceFailure reports whether a Ready condition of a request is a failure
+// recorded in the issuer status, rather than a request waiting for its turn
+func issuanceFailure(status cmmeta.ConditionStatus, reason string) bool {
+	return status == cmmeta.ConditionFalse && reason != cmapi.CertificateRequestReasonPending && reason != issuerPausedReason
+}
+
+// updateIssuerStatus applies mutate to the status of a request's issuer.
+// The request's outcome is already stored, so a failed update is only logged.
+//
+// The status is patched against the version it was read at and reapplied to
+// the latest version on conflicts, so concurrent requests don't lose counts;
+// the issuer reconcilers' updates of a stale issuer fail and are retried
+// instead of overwriting it.
+func (r *CertificateRequestReconciler) updateIssuerStatus(ctx context.Context, cr *cmapi.CertificateRequest, mutate func(*externalissuerapi.ExternalIssuerStatus)) {
+	ref := cr.Spec.IssuerRef
+	issuer := issuerRef(ref.Kind, cr.Namespace, ref.Name)
+	key := client.ObjectKeyFromObject(issuer)
+	reader := client.Reader(r.Client)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := reader.Get(ctx, key, issuer); err != nil {
+			return err
+		}
+		// Retries read past the cache, which lags behind the conflicting write
+		reader = r.apiReader()
+		patch := client.MergeFromWithOptions(issuer.DeepCopyObject().(client.Object), client.MergeFromWithOptimisticLock{})
+		mutate(issuerStatus(issuer))
+		return r.Status().Patch(ctx, issuer, patch)
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.FromContext(ctx).Error(err, "Failed to update the issuer status", "issuer", ref.Name, "kind", ref.Kind)
+	}
+}
+
+// issuerStatus returns the status of an ExternalIssuer or ExternalClusterIssuer
+func issuerStatus(issuer client.Object) *externalissuerapi.ExternalIssuerStatus {
+	if clusterIssuer, ok := issuer.(*externalissuerapi.ExternalClusterIssuer); ok {
+		return &clusterIssuer.Status
+	}
+	return &issuer.(*externalissuerapi.ExternalIssuer).Status
+}
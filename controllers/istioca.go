@@ -0,0 +1,389 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/audit"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	istioca "istio.io/api/security/v1alpha1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// defaultIstioCAAudience is the audience of the ServiceAccount tokens
+	// Istio proxies authenticate to their CA with
+	defaultIstioCAAudience = "istio-ca"
+
+	// defaultIstioCAMaxValidity caps the validity Istio proxies may request
+	defaultIstioCAMaxValidity = 24 * time.Hour
+
+	// istioCASignTimeout bounds a signing request of an Istio proxy; a shorter
+	// signingTimeout of the issuer takes precedence
+	istioCASignTimeout = 30 * time.Second
+
+	// istioCAShutdownTimeout is how long requests in flight may take to
+	// finish when the controller stops
+	istioCAShutdownTimeout = 10 * time.Second
+)
+
+// istioCARequests counts the certificate requests of Istio proxies by result
+var istioCARequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "external_issuer_istio_ca_requests_total",
+		Help: "Certificate requests of Istio proxies served by the Istio CA gRPC service, by result",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(istioCARequests)
+}
+
+// IstioCAServer serves the Istio CA API (istio.v1.auth.IstioCertificateService)
+// over gRPC, so Istio proxies get their workload certificates from an issuer's
+// PKI directly, without a cert-manager Certificate per pod.
+//
+// Proxies authenticate with a ServiceAccount token, which is checked with a
+// TokenReview; the CSR must carry exactly the SPIFFE ID of that
+// ServiceAccount. Requests then pass the issuer's policy like
+// CertificateRequests do and are signed by its signer. Asynchronous PKIs are
+// not supported, proxies need their certificate right away.
+//
+// It implements manager.Runnable and serves on every replica.
+type IstioCAServer struct {
+	// Requests supplies the issuer's signer, policy checks and audit trail
+	Requests *CertificateRequestReconciler
+
+	// Addr is the address the gRPC service listens on
+	Addr string
+
+	// CertFile and KeyFile hold the serving certificate, re-read on every
+	// handshake so a renewed certificate is picked up without a restart
+	CertFile string
+	KeyFile  string
+
+	// IssuerKind, IssuerNamespace and IssuerName select the issuer signing
+	// the certificates; IssuerNamespace is empty for ExternalClusterIssuers
+	IssuerKind      string
+	IssuerNamespace string
+	IssuerName      string
+
+	// TrustDomain is the trust domain of the SPIFFE IDs of the proxies
+	TrustDomain string
+
+	// Audience is the audience the proxies' tokens must be bound to (default istio-ca)
+	Audience string
+
+	// MaxValidity caps the validity requested by proxies (default 24h). It
+	// can't be shorter than a day, the shortest validity signers issue.
+	MaxValidity time.Duration
+}
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+
+// NeedLeaderElection lets every replica serve certificates
+func (s *IstioCAServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Validate checks the settings of the server
+func (s *IstioCAServer) Validate() error {
+	if s.MaxValidity > 0 && s.MaxValidity < 24*time.Hour {
+		return fmt.Errorf("maximum validity %s is shorter than a day, the shortest validity signers issue", s.MaxValidity)
+	}
+	return nil
+}
+
+// Start serves the Istio CA API until ctx is cancelled
+func (s *IstioCAServer) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("istio-ca")
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load Istio CA serving certificate: %w", err)
+			}
+			return &cert, nil
+		},
+	}
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	istioca.RegisterIstioCertificateServiceServer(server, &istioCAService{server: s, logger: logger})
+
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for the Istio CA service: %w", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+	logger.Info("Serving the Istio CA API", "addr", s.Addr, "issuer", s.IssuerName, "kind", s.IssuerKind)
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(istioCAShutdownTimeout):
+		server.Stop()
+	}
+	return nil
+}
+
+// istioCAService implements the gRPC service
+type istioCAService struct {
+	istioca.UnimplementedIstioCertificateServiceServer
+
+	server *IstioCAServer
+	logger logr.Logger
+}
+
+// CreateCertificate signs the CSR of an Istio proxy
+func (svc *istioCAService) CreateCertificate(ctx context.Context, req *istioca.IstioCertificateRequest) (*istioca.IstioCertificateResponse, error) {
+	resp, err := svc.createCertificate(ctx, req)
+	result := "success"
+	if err != nil {
+		result = strings.ToLower(status.Code(err).String())
+	}
+	istioCARequests.WithLabelValues(result).Inc()
+	return resp, err
+}
+
+func (svc *istioCAService) createCertificate(ctx context.Context, req *istioca.IstioCertificateRequest) (*istioca.IstioCertificateResponse, error) {
+	s := svc.server
+	r := s.Requests
+
+	username, err := svc.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	namespace, serviceAccount, ok := parseServiceAccountUsername(username)
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "only ServiceAccounts can request workload certificates, got %q", username)
+	}
+	logger := svc.logger
+
+	// The CSR must name the proxy's own identity and nothing else
+	csr, err := parseCSR([]byte(req.Csr))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "CSR signature validation failed: %v", err)
+	}
+	expected := (&url.URL{Scheme: "spiffe", Host: s.TrustDomain, Path: "/ns/" + namespace + "/sa/" + serviceAccount}).String()
+	if len(csr.URIs) != 1 || csr.URIs[0].String() != expected {
+		return nil, status.Errorf(codes.PermissionDenied, "the CSR must carry exactly the URI SAN %s", expected)
+	}
+	if len(csr.DNSNames) > 0 || len(csr.IPAddresses) > 0 || len(csr.EmailAddresses) > 0 {
+		return nil, status.Error(codes.PermissionDenied, "the CSR may only carry the SPIFFE ID URI SAN")
+	}
+
+	validity := s.maxValidity()
+	if requested := time.Duration(req.ValidityDuration) * time.Second; requested > 0 && requested < validity {
+		validity = requested
+	}
+	days := istioValidityDays(validity)
+	validity = time.Duration(days) * 24 * time.Hour
+
+	spec, err := readyIssuerSpec(ctx, r.Client, s.IssuerKind, s.IssuerName, s.IssuerNamespace)
+	if err != nil {
+		logger.Error(err, "Issuer is not available")
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	// Hold the request to the issuer's policy as if it were a CertificateRequest
+	cr := &cmapi.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "istio-ca:" + serviceAccount, Namespace: namespace},
+		Spec: cmapi.CertificateRequestSpec{
+			Request:   []byte(req.Csr),
+			Username:  username,
+			IssuerRef: cmmeta.ObjectReference{Kind: s.IssuerKind, Name: s.IssuerName},
+			Duration:  &metav1.Duration{Duration: validity},
+		},
+	}
+	err = r.checkPolicy(ctx, cr, spec.Policy)
+	var violation *policyViolationError
+	if errors.As(err, &violation) && auditing(spec.Policy) {
+		logger.Info("Workload certificate violates issuer policy in Audit mode", "serviceAccount", namespace+"/"+serviceAccount, "violations", violation.violations)
+		err = nil
+	}
+	if err == nil {
+		err = checkSubject(cr.Spec.Request, spec.Subject)
+	}
+	if err == nil {
+		err = checkSVID(cr, spec)
+	}
+	if errors.As(err, &violation) {
+		r.audit(ctx, cr, audit.ResultFailed, err.Error())
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	certSigner, _, err := r.newSigner(ctx, issuerRef(s.IssuerKind, s.IssuerNamespace, s.IssuerName), spec, s.IssuerKind, s.IssuerNamespace)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if override := subjectOverride(spec.Subject); override != nil {
+		if setter, ok := certSigner.(subjectSetter); ok {
+			setter.SetSubject(override)
+		}
+	}
+	if setter, ok := certSigner.(requesterSetter); ok {
+		setter.SetRequester(requesterFields(cr))
+	}
+	if spec.Mode == issuerModeSVID {
+		if requester, ok := certSigner.(svidRequester); ok {
+			if err := requester.RequestSVID(); err != nil {
+				return nil, status.Error(codes.FailedPrecondition, err.Error())
+			}
+		}
+	}
+
+	timeout := istioCASignTimeout
+	if spec.SigningTimeout != nil && spec.SigningTimeout.Duration > 0 && spec.SigningTimeout.Duration < timeout {
+		timeout = spec.SigningTimeout.Duration
+	}
+	signCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	certPEM, caPEM, err := certSigner.Sign(signCtx, cr.Spec.Request, days)
+	var pending *signer.PendingError
+	if errors.As(err, &pending) {
+		err = fmt.Errorf("the PKI issues asynchronously (order %s), which the Istio CA API doesn't support", pending.OrderID)
+		logger.Error(err, "Failed to sign workload certificate", "serviceAccount", namespace+"/"+serviceAccount)
+		r.audit(ctx, cr, audit.ResultFailed, err.Error())
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if err != nil {
+		logger.Error(err, "Failed to sign workload certificate", "serviceAccount", namespace+"/"+serviceAccount)
+		r.audit(ctx, cr, audit.ResultFailed, err.Error())
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	chain := certChain(certPEM, caPEM)
+	if len(chain) < 2 {
+		return nil, status.Error(codes.Internal, "the issuer returned no CA chain, which Istio proxies need to verify peers")
+	}
+
+	cr.Status.Certificate = certPEM
+	r.audit(ctx, cr, audit.ResultIssued, "")
+	logger.Info("Issued workload certificate", "serviceAccount", namespace+"/"+serviceAccount, "validity", validity)
+	return &istioca.IstioCertificateResponse{CertChain: chain}, nil
+}
+
+// authenticate reviews the ServiceAccount token in the request metadata and
+// returns its username
+func (svc *istioCAService) authenticate(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	for _, value := range md.Get("authorization") {
+		if t, ok := strings.CutPrefix(value, "Bearer "); ok {
+			token = strings.TrimSpace(t)
+		}
+	}
+	if token == "" {
+		return "", status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: []string{svc.server.audience()},
+		},
+	}
+	if err := svc.server.Requests.Create(ctx, review); err != nil {
+		svc.logger.Error(err, "Failed to review token")
+		return "", status.Error(codes.Unavailable, "failed to review token")
+	}
+	if !review.Status.Authenticated {
+		return "", status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return review.Status.User.Username, nil
+}
+
+func (s *IstioCAServer) audience() string {
+	if s.Audience == "" {
+		return defaultIstioCAAudience
+	}
+	return s.Audience
+}
+
+func (s *IstioCAServer) maxValidity() time.Duration {
+	if s.MaxValidity <= 0 {
+		return defaultIstioCAMaxValidity
+	}
+	return s.MaxValidity
+}
+
+// validityDays converts a validity to the whole days signers take, rounding up
+func validityDays(validity time.Duration) int {
+	return int((validity + 24*time.Hour - 1) / (24 * time.Hour))
+}
+
+// istioValidityDays converts the validity of a workload certificate to the
+// whole days signers take. Unlike validityDays it rounds down, so the
+// certificate doesn't outlive the maximum validity, but issues at least a day.
+func istioValidityDays(validity time.Duration) int {
+	return max(int(validity/(24*time.Hour)), 1)
+}
+
+// certChain returns the chain of an issued certificate for Istio proxies, the
+// leaf first, without repeating a CA certificate the signer returned with the
+// leaf as well as in the CA bundle
+func certChain(certPEM, caPEM []byte) []string {
+	chain := splitPEMCertificates(certPEM)
+	for _, cert := range splitPEMCertificates(caPEM) {
+		if !slices.Contains(chain, cert) {
+			chain = append(chain, cert)
+		}
+	}
+	return chain
+}
+
+// splitPEMCertificates returns the PEM blocks of a bundle, one per certificate
+func splitPEMCertificates(bundle []byte) []string {
+	var certs []string
+	for block, rest := pem.Decode(bundle); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, string(pem.EncodeToMemory(block)))
+		}
+	}
+	return certs
+}
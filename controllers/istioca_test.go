@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	istioca "istio.io/api/security/v1alpha1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// istioCACSR returns a PEM CSR with the given URI and DNS SANs
+func istioCACSR(t *testing.T, uri string, dnsNames ...string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spiffeID, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		URIs:     []*url.URL{spiffeID},
+		DNSNames: dnsNames,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
+
+func TestIstioCACreateCertificate(t *testing.T) {
+	if !signer.MockCABuiltIn {
+		t.Skip("the mockca signer is not built in")
+	}
+	issuer := &externalissuerapi.ExternalIssuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "mesh", Namespace: testNamespace},
+		Spec:       externalissuerapi.ExternalIssuerSpec{SignerType: "mockca"},
+		Status: externalissuerapi.ExternalIssuerStatus{Conditions: []metav1.Condition{{
+			Type: issuerReadyCondition, Status: metav1.ConditionTrue, Reason: "Success",
+		}}},
+	}
+	// The API server authenticates the token "app-token" as ServiceAccount default/app
+	k8sClient := interceptor.NewClient(fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(issuer).Build(), interceptor.Funcs{
+		Create: func(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			review, ok := obj.(*authenticationv1.TokenReview)
+			if !ok {
+				return cl.Create(ctx, obj, opts...)
+			}
+			if review.Spec.Token == "app-token" && len(review.Spec.Audiences) == 1 && review.Spec.Audiences[0] == defaultIstioCAAudience {
+				review.Status.Authenticated = true
+				review.Status.User.Username = "system:serviceaccount:default:app"
+			}
+			return nil
+		},
+	})
+	svc := &istioCAService{
+		server: &IstioCAServer{
+			Requests:        &CertificateRequestReconciler{Client: k8sClient, Scheme: testScheme(t)},
+			IssuerKind:      issuerKind,
+			IssuerNamespace: testNamespace,
+			IssuerName:      "mesh",
+			TrustDomain:     "cluster.local",
+		},
+		logger: logr.Discard(),
+	}
+	const appID = "spiffe://cluster.local/ns/default/sa/app"
+
+	for name, tc := range map[string]struct {
+		token    string
+		csr      string
+		wantCode codes.Code
+	}{
+		"issued":               {token: "app-token", csr: istioCACSR(t, appID), wantCode: codes.OK},
+		"missing token":        {csr: istioCACSR(t, appID), wantCode: codes.Unauthenticated},
+		"token rejected":       {token: "stolen-token", csr: istioCACSR(t, appID), wantCode: codes.Unauthenticated},
+		"other ServiceAccount": {token: "app-token", csr: istioCACSR(t, "spiffe://cluster.local/ns/default/sa/admin"), wantCode: codes.PermissionDenied},
+		"other trust domain":   {token: "app-token", csr: istioCACSR(t, "spiffe://evil.example/ns/default/sa/app"), wantCode: codes.PermissionDenied},
+		"extra DNS SAN":        {token: "app-token", csr: istioCACSR(t, appID, "app.default.svc"), wantCode: codes.PermissionDenied},
+		"not a CSR":            {token: "app-token", csr: "-----BEGIN CERTIFICATE REQUEST-----\nAAAA\n-----END CERTIFICATE REQUEST-----\n", wantCode: codes.InvalidArgument},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+tc.token))
+			}
+			// Proxies asking for less than a day get a day, the shortest validity signers issue
+			resp, err := svc.createCertificate(ctx, &istioca.IstioCertificateRequest{Csr: tc.csr, ValidityDuration: 3600})
+			if code := status.Code(err); code != tc.wantCode {
+				t.Fatalf("createCertificate returned %v, want code %s", err, tc.wantCode)
+			}
+			if tc.wantCode != codes.OK {
+				return
+			}
+
+			if len(resp.CertChain) != 2 {
+				t.Fatalf("chain of %d certificates, want the leaf and the Mock CA", len(resp.CertChain))
+			}
+			block, _ := pem.Decode([]byte(resp.CertChain[0]))
+			leaf, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(leaf.URIs) != 1 || leaf.URIs[0].String() != appID {
+				t.Errorf("leaf URI SANs %v, want %s", leaf.URIs, appID)
+			}
+			if validity := time.Until(leaf.NotAfter); validity > 24*time.Hour || validity < 23*time.Hour {
+				t.Errorf("leaf valid for %s more, want a day", validity)
+			}
+			roots := x509.NewCertPool()
+			roots.AppendCertsFromPEM([]byte(resp.CertChain[1]))
+			if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+				t.Errorf("leaf doesn't verify against the chain: %v", err)
+			}
+		})
+	}
+}
+
+func TestIstioCAValidity(t *testing.T) {
+	for _, tc := range []struct {
+		validity time.Duration
+		want     int
+	}{
+		{time.Hour, 1},
+		{24 * time.Hour, 1},
+		{36 * time.Hour, 1},
+		{72 * time.Hour, 3},
+	} {
+		if got := istioValidityDays(tc.validity); got != tc.want {
+			t.Errorf("istioValidityDays(%s) = %d, want %d", tc.validity, got, tc.want)
+		}
+	}
+
+	// A cap below a day couldn't be honored
+	if err := (&IstioCAServer{MaxValidity: 12 * time.Hour}).Validate(); err == nil {
+		t.Error("maximum validity of 12h accepted")
+	}
+	if err := (&IstioCAServer{MaxValidity: 24 * time.Hour}).Validate(); err != nil {
+		t.Errorf("maximum validity of 24h rejected: %v", err)
+	}
+}
+
+func TestIstioCACertChain(t *testing.T) {
+	leaf := string(selfSignedCertificate(t, time.Now(), time.Hour))
+	intermediate := string(selfSignedCertificate(t, time.Now(), 24*time.Hour))
+	root := string(selfSignedCertificate(t, time.Now(), 48*time.Hour))
+
+	for name, tc := range map[string]struct {
+		certPEM, caPEM string
+		want           []string
+	}{
+		"leaf and CA bundle":          {certPEM: leaf, caPEM: intermediate + root, want: []string{leaf, intermediate, root}},
+		"chain repeated in CA bundle": {certPEM: leaf + intermediate, caPEM: intermediate + root, want: []string{leaf, intermediate, root}},
+		"bundle without certificates": {certPEM: leaf, caPEM: "", want: []string{leaf}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := certChain([]byte(tc.certPEM), []byte(tc.caPEM))
+			if strings.Join(got, "") != strings.Join(tc.want, "") {
+				t.Errorf("chain of %d certificates, want %d in order", len(got), len(tc.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// defaultJanitorInterval is how often the RequestJanitor looks for requests to delete
+const defaultJanitorInterval = 10 * time.Minute
+
+// requestsCleanedUp counts the failed and denied CertificateRequests the
+// RequestJanitor deleted
+var requestsCleanedUp = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "external_issuer_certificaterequests_cleaned_up_total",
+		Help: "Failed and denied CertificateRequests deleted after their retention period, by namespace, issuer and reason",
+	},
+	[]string{"namespace", "issuer_kind", "issuer_name", "reason"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(requestsCleanedUp)
+}
+
+// RequestJanitor deletes CertificateRequests of this controller's issuers
+// that failed or were denied longer ago than their retention period, so
+// namespaces don't accumulate them. The retention is the issuer's
+// spec.failedRequestRetention, or Retention for issuers without one; a
+// retention of zero keeps the requests.
+//
+// Requests are listed from the manager's cache, so namespaced deployments
+// and shards only clean up their own. It implements manager.Runnable and
+// runs on the leader only.
+type RequestJanitor struct {
+	Client client.Client
+
+	// Retention is the retention of issuers without spec.failedRequestRetention (0: keep)
+	Retention time.Duration
+
+	// Interval is how often requests are checked (default: 10 minutes)
+	Interval time.Duration
+
+	// Clock supplies the current time (default: the real clock)
+	Clock clock.PassiveClock
+
+	// DisableClusterIssuers leaves requests of ExternalClusterIssuers alone
+	DisableClusterIssuers bool
+}
+
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch;delete
+
+// NeedLeaderElection makes only the leader delete requests
+func (j *RequestJanitor) NeedLeaderElection() bool {
+	return true
+}
+
+// Start cleans up requests every Interval until ctx is cancelled
+func (j *RequestJanitor) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("request-janitor")
+	ctx = log.IntoContext(ctx, logger)
+
+	interval := j.Interval
+	if interval <= 0 {
+		interval = defaultJanitorInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := j.cleanUp(ctx); err != nil {
+			logger.Error(err, "Failed to clean up CertificateRequests")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanUp deletes the requests whose retention period is over
+func (j *RequestJanitor) cleanUp(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	requests := &cmapi.CertificateRequestList{}
+	if err := j.Client.List(ctx, requests); err != nil {
+		return err
+	}
+
+	now := clockOrReal(j.Clock).Now()
+	retentions := map[string]time.Duration{}
+	deleted := 0
+	for i := range requests.Items {
+		cr := &requests.Items[i]
+		ref := cr.Spec.IssuerRef
+		if ref.Group != externalIssuerAPIGroup || !cr.DeletionTimestamp.IsZero() ||
+			(ref.Kind != issuerKind && (ref.Kind != clusterIssuerKind || j.DisableClusterIssuers)) {
+			continue
+		}
+		reason, since, ok := terminalFailure(cr)
+		if !ok {
+			continue
+		}
+
+		key := issuerKey(ref.Kind, cr.Namespace, ref.Name)
+		retention, cached := retentions[key]
+		if !cached {
+			var err error
+			if retention, err = j.retention(ctx, ref.Kind, ref.Name, cr.Namespace); err != nil {
+				return err
+			}
+			retentions[key] = retention
+		}
+		if retention <= 0 || now.Sub(since) < retention {
+			continue
+		}
+
+		// The precondition keeps a request recreated under the same name
+		err := j.Client.Delete(ctx, cr, client.Preconditions{UID: &cr.UID})
+		if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		logger.V(1).Info("Deleted CertificateRequest after its retention period", "namespace", cr.Namespace, "name", cr.Name, "reason", reason, "since", since)
+		requestsCleanedUp.WithLabelValues(cr.Namespace, ref.Kind, ref.Name, reason).Inc()
+		deleted++
+	}
+	if deleted > 0 {
+		logger.Info("Cleaned up failed and denied CertificateRequests", "deleted", deleted)
+	}
+	return nil
+}
+
+// retention returns the retention of an issuer's failed requests; issuers
+// that no longer exist use the controller-wide retention
+func (j *RequestJanitor) retention(ctx context.Context, kind, name, namespace string) (time.Duration, error) {
+	var spec *externalissuerapi.ExternalIssuerSpec
+	if kind == clusterIssuerKind {
+		issuer := &externalissuerapi.ExternalClusterIssuer{}
+		if err := j.Client.Get(ctx, types.NamespacedName{Name: name}, issuer); err != nil {
+			return j.Retention, client.IgnoreNotFound(err)
+		}
+		spec = &issuer.Spec
+	} else {
+		issuer := &externalissuerapi.ExternalIssuer{}
+		if err := j.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, issuer); err != nil {
+			return j.Retention, client.IgnoreNotFound(err)
+		}
+		spec = &issuer.Spec
+	}
+	if spec.FailedRequestRetention != nil {
+		return spec.FailedRequestRetention.Duration, nil
+	}
+	return j.Retention, nil
+}
+
+// terminalFailure returns whether a request failed or was denied, with the
+// reason and the time it did
+func terminalFailure(cr *cmapi.CertificateRequest) (string, time.Time, bool) {
+	for _, c := range cr.Status.Conditions {
+		switch {
+		case c.Type == cmapi.CertificateRequestConditionDenied && c.Status == cmmeta.ConditionTrue,
+			c.Type == cmapi.CertificateRequestConditionReady && c.Status == cmmeta.ConditionFalse &&
+				(c.Reason == cmapi.CertificateRequestReasonFailed || c.Reason == cmapi.CertificateRequestReasonDenied):
+			since := cr.CreationTimestamp.Time
+			if c.LastTransitionTime != nil {
+				since = c.LastTransitionTime.Time
+			}
+			reason := cmapi.CertificateRequestReasonFailed
+			if c.Type == cmapi.CertificateRequestConditionDenied || c.Reason == cmapi.CertificateRequestReasonDenied {
+				reason = cmapi.CertificateRequestReasonDenied
+			}
+			return reason, since, true
+		}
+	}
+	return "", time.Time{}, false
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// janitorRequest returns a request of an issuer whose Ready condition
+// changed to reason at since
+func janitorRequest(name, issuer, reason string, since time.Time) *cmapi.CertificateRequest {
+	status := cmmeta.ConditionFalse
+	if reason == "Issued" {
+		status = cmmeta.ConditionTrue
+	}
+	return &cmapi.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, UID: types.UID(name), CreationTimestamp: metav1.NewTime(since)},
+		Spec: cmapi.CertificateRequestSpec{
+			IssuerRef: cmmeta.ObjectReference{Group: externalIssuerAPIGroup, Kind: issuerKind, Name: issuer},
+		},
+		Status: cmapi.CertificateRequestStatus{Conditions: []cmapi.CertificateRequestCondition{{
+			Type:               cmapi.CertificateRequestConditionReady,
+			Status:             status,
+			Reason:             reason,
+			LastTransitionTime: &metav1.Time{Time: since},
+		}}},
+	}
+}
+
+func TestJanitorRetention(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clocktesting.NewFakeClock(start)
+	k8sClient := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(
+		&externalissuerapi.ExternalIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-retention", Namespace: testNamespace},
+		},
+		&externalissuerapi.ExternalIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "short-retention", Namespace: testNamespace},
+			Spec:       externalissuerapi.ExternalIssuerSpec{FailedRequestRetention: &metav1.Duration{Duration: time.Hour}},
+		},
+		&externalissuerapi.ExternalIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: "keep", Namespace: testNamespace},
+			Spec:       externalissuerapi.ExternalIssuerSpec{FailedRequestRetention: &metav1.Duration{}},
+		},
+		janitorRequest("failed", "default-retention", cmapi.CertificateRequestReasonFailed, start),
+		janitorRequest("denied", "default-retention", cmapi.CertificateRequestReasonDenied, start.Add(time.Hour)),
+		janitorRequest("issued", "default-retention", "Issued", start),
+		janitorRequest("pending", "default-retention", cmapi.CertificateRequestReasonPending, start),
+		janitorRequest("failed-short", "short-retention", cmapi.CertificateRequestReasonFailed, start),
+		janitorRequest("failed-kept", "keep", cmapi.CertificateRequestReasonFailed, start),
+		janitorRequest("failed-orphan", "deleted-issuer", cmapi.CertificateRequestReasonFailed, start),
+	).Build()
+	janitor := &RequestJanitor{Client: k8sClient, Retention: 24 * time.Hour, Clock: clk}
+
+	remaining := func() map[string]bool {
+		t.Helper()
+		if err := janitor.cleanUp(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		requests := &cmapi.CertificateRequestList{}
+		if err := k8sClient.List(context.Background(), requests, client.InNamespace(testNamespace)); err != nil {
+			t.Fatal(err)
+		}
+		names := map[string]bool{}
+		for _, cr := range requests.Items {
+			names[cr.Name] = true
+		}
+		return names
+	}
+	expect := func(step time.Duration, deleted ...string) {
+		t.Helper()
+		clk.Step(step)
+		names := remaining()
+		for _, name := range deleted {
+			if names[name] {
+				t.Errorf("after %s: %s was kept, want it deleted", clk.Since(start), name)
+			}
+		}
+	}
+
+	// Nothing is due right away
+	if names := remaining(); len(names) != 7 {
+		t.Fatalf("deleted %d requests right away, want none", 7-len(names))
+	}
+
+	// The issuer's retention overrides the controller-wide one
+	expect(time.Hour, "failed-short")
+	if names := remaining(); !names["failed"] || !names["denied"] {
+		t.Fatalf("requests deleted before the controller-wide retention: %v", names)
+	}
+
+	// Requests of deleted issuers use the controller-wide retention
+	expect(23*time.Hour, "failed", "failed-orphan")
+	if names := remaining(); !names["denied"] {
+		t.Fatal("denied request deleted before its retention counted from the denial")
+	}
+	expect(time.Hour, "denied")
+
+	// Issued and pending requests and those of issuers keeping them stay
+	clk.Step(365 * 24 * time.Hour)
+	names := remaining()
+	for _, name := range []string{"issued", "pending", "failed-kept"} {
+		if !names[name] {
+			t.Errorf("%s was deleted, want it kept", name)
+		}
+	}
+	if len(names) != 3 {
+		t.Errorf("remaining requests %v, want issued, pending and failed-kept", names)
+	}
+}
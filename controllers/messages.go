@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxConditionMessageLength bounds condition messages so upstream error
+	// pages don't bloat the object; the full text is kept in an event
+	maxConditionMessageLength = 512
+
+	// maxEventMessageLength bounds the event carrying the full message
+	maxEventMessageLength = 16 * 1024
+
+	truncatedSuffix = "... (truncated)"
+)
+
+var (
+	htmlTitlePattern     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlScriptPattern    = regexp.MustCompile(`(?is)<script[^>]*>.*?</script>|<style[^>]*>.*?</style>`)
+	htmlTagPattern       = regexp.MustCompile(`(?s)<[^>]*>`)
+	whitespaceRunPattern = regexp.MustCompile(`\s+`)
+)
+
+// summarizeMessage turns an error message into a single line fit for a
+// condition. HTML error pages are reduced to their title (or visible text),
+// control characters and whitespace runs are collapsed and the result is
+// truncated. The same input always yields the same summary, so unchanged
+// errors don't cause status updates.
+func summarizeMessage(msg string) string {
+	msg = strings.ToValidUTF8(msg, "")
+
+	if i := htmlStart(msg); i >= 0 {
+		prefix, body := msg[:i], msg[i:]
+		text := ""
+		if m := htmlTitlePattern.FindStringSubmatch(body); m != nil {
+			text = m[1]
+		} else {
+			text = htmlTagPattern.ReplaceAllString(htmlScriptPattern.ReplaceAllString(body, " "), " ")
+		}
+		msg = prefix + html.UnescapeString(text)
+	}
+
+	msg = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, msg)
+	msg = strings.TrimSpace(whitespaceRunPattern.ReplaceAllString(msg, " "))
+	return truncateMessage(msg, maxConditionMessageLength)
+}
+
+// htmlStart returns the offset of an HTML document embedded in msg, or -1
+func htmlStart(msg string) int {
+	lower := strings.ToLower(msg)
+	for _, marker := range []string{"<!doctype html", "<html", "<head", "<body"} {
+		if i := strings.Index(lower, marker); i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// truncateMessage cuts msg to at most max bytes on a rune boundary
+func truncateMessage(msg string, max int) string {
+	if len(msg) <= max {
+		return msg
+	}
+	cut := max - len(truncatedSuffix)
+	for cut > 0 && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+	return msg[:cut] + truncatedSuffix
+}
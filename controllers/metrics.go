@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"github.com/bvorland/cert-manager-external-issuer/internal/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// approvalLatency tracks how long CertificateRequests wait between creation and approval
+	approvalLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "external_issuer_certificaterequest_approval_latency_seconds",
+			Help:    "Time CertificateRequests waited between creation and approval, by namespace and issuer",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 900, 1800, 3600, 21600},
+		},
+		[]string{"namespace", "issuer_kind", "issuer_name"},
+	)
+
+	// buildInfo is always 1; its labels identify the running controller build
+	buildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "external_issuer_build_info",
+			Help: "Build information of the running controller, value is always 1",
+		},
+		[]string{"version", "commit", "build_date", "go_version", "platform"},
+	)
+
+	// policyViolations counts CertificateRequests found violating an issuer
+	// policy, failed in Enforce mode and issued anyway in Audit mode
+	policyViolations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "external_issuer_policy_violations_total",
+			Help: "CertificateRequests violating the issuer policy, by namespace, issuer and policy mode",
+		},
+		[]string{"namespace", "issuer_kind", "issuer_name", "mode"},
+	)
+
+	// authTokenExpiry reports the expiry of JWT and refreshed OAuth tokens by auth Secret
+	authTokenExpiry = newTokenExpiryCollector()
+)
+
+func init() {
+	info := version.Get()
+	buildInfo.WithLabelValues(info.Version, info.GitCommit, info.BuildDate, info.GoVersion, info.Platform).Set(1)
+
+	metrics.Registry.MustRegister(approvalLatency, buildInfo, policyViolations, authTokenExpiry)
+}
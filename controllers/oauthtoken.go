@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// Keys of an auth Secret read by the OAuth grants
+	refreshTokenKey = "refresh-token"
+	clientIDKey     = "client-id"
+	clientSecretKey = "client-secret"
+
+	// unknownTokenLifetime is assumed for access tokens whose expiry is neither
+	// returned by the token endpoint nor readable from a JWT
+	unknownTokenLifetime = time.Hour
+
+	// tokenEndpointTimeout bounds a request to an OAuth token endpoint
+	tokenEndpointTimeout = 30 * time.Second
+)
+
+// OAuthTokens obtains access tokens for bearer and header auth from the OAuth
+// token endpoint configured in auth.refresh, with the refresh token or client
+// credentials of the issuer's auth Secret. Tokens are cached per Secret and
+// refreshed once 80% of their lifetime has passed, so signing requests don't
+// start failing with 401 when a token expires.
+type OAuthTokens struct {
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	tokens map[oauthTokenKey]*cachedOAuthToken
+}
+
+// oauthTokenKey identifies the tokens of one Secret at one token endpoint
+type oauthTokenKey struct {
+	secret    types.NamespacedName
+	tokenURL  string
+	grantType string
+	scopes    string
+}
+
+type cachedOAuthToken struct {
+	token     string
+	expiry    time.Time
+	refreshAt time.Time
+	// refreshToken is the refresh token last returned by the token endpoint,
+	// which may have rotated the one in the Secret
+	refreshToken string
+	// refreshErr is why the token, still in use until it expires, was not refreshed
+	refreshErr error
+}
+
+// NewOAuthTokens creates an empty OAuth token cache
+func NewOAuthTokens() *OAuthTokens {
+	return &OAuthTokens{
+		httpClient: &http.Client{Timeout: tokenEndpointTimeout},
+		tokens:     map[oauthTokenKey]*cachedOAuthToken{},
+	}
+}
+
+// ForSecret returns a token source for the credentials in an auth Secret
+func (t *OAuthTokens) ForSecret(secret types.NamespacedName, data map[string][]byte, refresh *signer.PKIAuthRefresh) signer.TokenSource {
+	return &secretTokenSource{tokens: t, secret: secret, data: data, refresh: refresh}
+}
+
+type secretTokenSource struct {
+	tokens  *OAuthTokens
+	secret  types.NamespacedName
+	data    map[string][]byte
+	refresh *signer.PKIAuthRefresh
+}
+
+func (s *secretTokenSource) Token(ctx context.Context) (string, error) {
+	return s.tokens.token(ctx, s.secret, s.data, s.refresh)
+}
+
+// refreshError refreshes a Secret's access token if it is due and returns
+// why the refresh failed, even while the previous token can still be used
+func (t *OAuthTokens) refreshError(ctx context.Context, secret types.NamespacedName, data map[string][]byte, refresh *signer.PKIAuthRefresh) error {
+	if _, err := t.token(ctx, secret, data, refresh); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cached := t.tokens[refreshKey(secret, refresh)]; cached != nil {
+		return cached.refreshErr
+	}
+	return nil
+}
+
+func refreshKey(secret types.NamespacedName, refresh *signer.PKIAuthRefresh) oauthTokenKey {
+	return oauthTokenKey{secret: secret, tokenURL: refresh.TokenURL, grantType: refresh.GrantType, scopes: strings.Join(refresh.Scopes, " ")}
+}
+
+// token returns a cached access token or requests a new one. A token that
+// failed to refresh is still returned until it expires.
+func (t *OAuthTokens) token(ctx context.Context, secret types.NamespacedName, data map[string][]byte, refresh *signer.PKIAuthRefresh) (string, error) {
+	key := refreshKey(secret, refresh)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cached := t.tokens[key]
+	if cached != nil && cached.token != "" && time.Now().Before(cached.refreshAt) {
+		return cached.token, nil
+	}
+
+	refreshToken := string(data[refreshTokenKey])
+	if cached != nil && cached.refreshToken != "" {
+		refreshToken = cached.refreshToken
+	}
+	tok, err := t.fetch(ctx, refresh, data, refreshToken)
+	if err != nil {
+		err = fmt.Errorf("failed to refresh access token with Secret %s: %w", secret, err)
+		if cached != nil && cached.token != "" && time.Now().Before(cached.expiry) {
+			cached.refreshErr = err
+			return cached.token, nil
+		}
+		return "", err
+	}
+
+	// Refresh relative to the lifetime granted, like ServiceAccount tokens
+	now := time.Now()
+	expiry := tok.Expiry
+	if expiry.IsZero() {
+		expiry, _ = signer.JWTExpiry(tok.AccessToken)
+	}
+	if expiry.IsZero() {
+		expiry = now.Add(unknownTokenLifetime)
+	} else {
+		authTokenExpiry.observe(secret, expiry)
+	}
+	t.tokens[key] = &cachedOAuthToken{
+		token:        tok.AccessToken,
+		expiry:       expiry,
+		refreshAt:    now.Add(expiry.Sub(now) * 4 / 5),
+		refreshToken: tok.RefreshToken,
+	}
+	return tok.AccessToken, nil
+}
+
+// fetch requests an access token from the token endpoint
+func (t *OAuthTokens) fetch(ctx context.Context, refresh *signer.PKIAuthRefresh, data map[string][]byte, refreshToken string) (*oauth2.Token, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, t.httpClient)
+	clientID, clientSecret := string(data[clientIDKey]), string(data[clientSecretKey])
+
+	if refresh.GrantType == "client_credentials" {
+		if clientID == "" || clientSecret == "" {
+			return nil, fmt.Errorf("grant type client_credentials requires keys %s and %s", clientIDKey, clientSecretKey)
+		}
+		config := &clientcredentials.Config{ClientID: clientID, ClientSecret: clientSecret, TokenURL: refresh.TokenURL, Scopes: refresh.Scopes}
+		return config.Token(ctx)
+	}
+
+	if refreshToken == "" {
+		return nil, fmt.Errorf("grant type refresh_token requires key %s", refreshTokenKey)
+	}
+	config := &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint:     oauth2.Endpoint{TokenURL: refresh.TokenURL},
+		Scopes:       refresh.Scopes,
+	}
+	// Without an access token the source always goes to the token endpoint
+	return config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+}
+
+// Expire makes the next request for a Secret's access token refresh it, e.g.
+// after the PKI API rejected it. A rotated refresh token is kept.
+func (t *OAuthTokens) Expire(secret types.NamespacedName) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	expired := false
+	for key, cached := range t.tokens {
+		if key.secret == secret {
+			cached.refreshAt = time.Time{}
+			expired = true
+		}
+	}
+	return expired
+}
+
+// Invalidate drops the tokens obtained with a Secret's credentials, so the
+// next request starts over with the credentials in the changed Secret
+func (t *OAuthTokens) Invalidate(secret types.NamespacedName) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	dropped := false
+	for key := range t.tokens {
+		if key.secret == secret {
+			delete(t.tokens, key)
+			dropped = true
+		}
+	}
+	return dropped
+}
+
+// tokenExpiryCollector reports how long the tokens sent to PKI APIs remain
+// valid, computed at scrape time from their expiry
+type tokenExpiryCollector struct {
+	desc *prometheus.Desc
+
+	mu     sync.RWMutex
+	expiry map[types.NamespacedName]time.Time
+}
+
+func newTokenExpiryCollector() *tokenExpiryCollector {
+	return &tokenExpiryCollector{
+		desc: prometheus.NewDesc("external_issuer_auth_token_expiry_seconds",
+			"Seconds until the auth token read from or refreshed with a Secret expires, negative once expired",
+			[]string{"namespace", "secret"}, nil),
+		expiry: map[types.NamespacedName]time.Time{},
+	}
+}
+
+// observe records the expiry of the token last used with a Secret
+func (c *tokenExpiryCollector) observe(secret types.NamespacedName, expiry time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expiry[secret] = expiry
+}
+
+// forget drops the expiry of a Secret's token, e.g. when the Secret changed
+func (c *tokenExpiryCollector) forget(secret types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.expiry, secret)
+}
+
+func (c *tokenExpiryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *tokenExpiryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for secret, expiry := range c.expiry {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, time.Until(expiry).Seconds(), secret.Namespace, secret.Name)
+	}
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+	"maps"
+	"strings"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/exporter"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// originAnnotationPrefix prefixes the CertificateRequest annotations naming
+// the Ingress or Gateway the certificate terminates on: origin-kind,
+// origin-name, origin-namespace and attributes such as origin-site-id.
+// cert-manager copies them from the Certificate to its requests.
+const originAnnotationPrefix = "external-issuer.io/origin-"
+
+// originKinds are the owners of Certificates created by cert-manager's
+// ingress-shim and Gateway API support, by API group
+var originKinds = map[string]string{
+	"networking.k8s.io":         "Ingress",
+	"gateway.networking.k8s.io": "Gateway",
+}
+
+// originSetter is implemented by signers that send the origin of a request
+// to the PKI
+type originSetter interface {
+	SetOrigin(origin map[string]string)
+}
+
+// requestOrigin returns the Ingress or Gateway the certificate of a request
+// terminates on, nil if unknown. Annotations take precedence; without them
+// the owner of the request's Certificate names it.
+func (r *CertificateRequestReconciler) requestOrigin(ctx context.Context, cr *cmapi.CertificateRequest) *exporter.Origin {
+	origin := &exporter.Origin{Attributes: map[string]string{}}
+	for key, value := range cr.Annotations {
+		if field, ok := strings.CutPrefix(key, originAnnotationPrefix); ok && field != "" {
+			origin.Attributes[field] = value
+		}
+	}
+	origin.Kind, origin.Name, origin.Namespace = origin.Attributes["kind"], origin.Attributes["name"], origin.Attributes["namespace"]
+	delete(origin.Attributes, "kind")
+	delete(origin.Attributes, "name")
+	delete(origin.Attributes, "namespace")
+
+	if origin.Kind == "" || origin.Name == "" {
+		if kind, name, ok := r.certificateOwner(ctx, cr); ok {
+			origin.Kind, origin.Name = kind, name
+		}
+	}
+	if origin.Kind == "" && origin.Name == "" && len(origin.Attributes) == 0 {
+		return nil
+	}
+	if origin.Namespace == "" {
+		origin.Namespace = cr.Namespace
+	}
+	if len(origin.Attributes) == 0 {
+		origin.Attributes = nil
+	}
+	return origin
+}
+
+// certificateOwner returns the Ingress or Gateway owning the Certificate of a request
+func (r *CertificateRequestReconciler) certificateOwner(ctx context.Context, cr *cmapi.CertificateRequest) (string, string, bool) {
+	name := cr.Annotations[cmapi.CertificateNameKey]
+	if name == "" {
+		return "", "", false
+	}
+	crt := &cmapi.Certificate{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: cr.Namespace, Name: name}, crt); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.FromContext(ctx).V(1).Info("Failed to get Certificate for the request's origin", "certificate", name, "error", err.Error())
+		}
+		return "", "", false
+	}
+	for _, owner := range crt.OwnerReferences {
+		gv, err := schema.ParseGroupVersion(owner.APIVersion)
+		if err != nil {
+			continue
+		}
+		if kind, ok := originKinds[gv.Group]; ok && owner.Kind == kind {
+			return owner.Kind, owner.Name, true
+		}
+	}
+	return "", "", false
+}
+
+// originFields returns the fields of an origin sent in origin parameters
+func originFields(origin *exporter.Origin) map[string]string {
+	fields := maps.Clone(origin.Attributes)
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	fields["kind"], fields["name"], fields["namespace"] = origin.Kind, origin.Name, origin.Namespace
+	return fields
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// issuerPausedReason is the condition reason of paused issuers and of the
+// requests they hold
+const issuerPausedReason = "IssuerPaused"
+
+// pausedRecheckInterval is how often requests held by a paused issuer check
+// whether it was resumed; the request controller doesn't watch issuers
+const pausedRecheckInterval = time.Minute
+
+// errIssuerPaused is returned for issuers with spec.paused
+var errIssuerPaused = errors.New("issuance is paused until spec.paused is unset")
+
+// pausedCondition is the Ready condition of a paused issuer
+func pausedCondition(generation int64, now time.Time) metav1.Condition {
+	return metav1.Condition{
+		Type:               issuerReadyCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             issuerPausedReason,
+		Message:            "Issuance is paused, the PKI is not contacted until spec.paused is unset",
+		LastTransitionTime: metav1.NewTime(now),
+		ObservedGeneration: generation,
+	}
+}
+
+// holdPaused leaves a request of a paused issuer pending, checking again later
+func (r *CertificateRequestReconciler) holdPaused(ctx context.Context, cr *cmapi.CertificateRequest, err error) (ctrl.Result, error) {
+	result := ctrl.Result{RequeueAfter: pausedRecheckInterval}
+	message := err.Error()
+	// Rewriting an unchanged condition would trigger another reconcile
+	if hasReadyCondition(cr, issuerPausedReason, message) {
+		return result, nil
+	}
+	log.FromContext(ctx).Info("Issuance held by paused issuer", "name", cr.Name, "issuer", cr.Spec.IssuerRef.Name)
+	if r.Recorder != nil {
+		r.Recorder.Event(cr, corev1.EventTypeNormal, issuerPausedReason, truncateMessage(message, maxEventMessageLength))
+	}
+	return result, r.setStatus(ctx, cr, cmmeta.ConditionFalse, issuerPausedReason, message)
+}
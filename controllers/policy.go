@@ -0,0 +1,328 @@
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultClusterDomain = "cluster.local"
+
+	// defaultSPIFFEPathTemplate is the conventional SPIFFE ID path for Kubernetes workloads
+	defaultSPIFFEPathTemplate = "/ns/{namespace}/sa/{serviceAccount}"
+
+	// serviceAccountUsernamePrefix prefixes the username of ServiceAccount tokens
+	serviceAccountUsernamePrefix = "system:serviceaccount:"
+
+	// subjectModeReject fails requests not matching the issuer subject instead of overriding it
+	subjectModeReject = "Reject"
+)
+
+// policyViolationError reports a CertificateRequest rejected by the issuer policy
+type policyViolationError struct {
+	violations []string
+}
+
+func (e *policyViolationError) Error() string {
+	return "issuer policy violation: " + strings.Join(e.violations, "; ")
+}
+
+// checkPolicy evaluates the issuer policy against a CertificateRequest. It
+// returns a *policyViolationError if the request must not be signed, or another
+// error if the policy could not be evaluated.
+func (r *CertificateRequestReconciler) checkPolicy(ctx context.Context, cr *cmapi.CertificateRequest, policy *externalissuerapi.IssuerPolicy) error {
+	// CA requests used to be signed as leaves; now they need explicit permission
+	if cr.Spec.IsCA && (policy == nil || !policy.AllowCAIssuance) {
+		return &policyViolationError{violations: []string{"CA certificates are not allowed by the issuer policy (allowCAIssuance)"}}
+	}
+	if policy == nil {
+		return nil
+	}
+
+	csr, err := parseCSR(cr.Spec.Request)
+	if err != nil {
+		return &policyViolationError{violations: []string{err.Error()}}
+	}
+
+	var violations []string
+	if policy.DNSNameOwnership != nil {
+		v, err := r.checkDNSNameOwnership(ctx, cr.Namespace, csr.DNSNames, policy.DNSNameOwnership)
+		if err != nil {
+			return err
+		}
+		violations = append(violations, v...)
+	}
+	violations = append(violations, checkSANs(csr, policy)...)
+	if policy.SPIFFE != nil {
+		violations = append(violations, checkSPIFFEIDs(cr.Spec.Username, csr.URIs, policy.SPIFFE)...)
+	}
+
+	if len(violations) > 0 {
+		return &policyViolationError{violations: violations}
+	}
+	return nil
+}
+
+// subjectSetter is implemented by signers that can override the subject of
+// outgoing requests
+type subjectSetter interface {
+	SetSubject(subject *signer.SubjectOverride)
+}
+
+// caRequester is implemented by signers that can issue subordinate CA certificates
+type caRequester interface {
+	RequestCA() error
+}
+
+// subjectOverride returns the subject attributes to override, nil if the
+// issuer pins none or rejects mismatches instead
+func subjectOverride(subject *externalissuerapi.IssuerSubject) *signer.SubjectOverride {
+	if subject == nil || subject.Mode == subjectModeReject {
+		return nil
+	}
+	return &signer.SubjectOverride{
+		Organizations:       subject.Organizations,
+		OrganizationalUnits: subject.OrganizationalUnits,
+		Countries:           subject.Countries,
+		Provinces:           subject.Provinces,
+		Localities:          subject.Localities,
+	}
+}
+
+// checkSubject rejects a CertificateRequest whose CSR doesn't carry the
+// subject attributes pinned by an issuer in Reject mode
+func checkSubject(csrPEM []byte, subject *externalissuerapi.IssuerSubject) error {
+	if subject == nil || subject.Mode != subjectModeReject {
+		return nil
+	}
+	csr, err := parseCSR(csrPEM)
+	if err != nil {
+		return &policyViolationError{violations: []string{err.Error()}}
+	}
+
+	var violations []string
+	check := func(attribute string, required, actual []string) {
+		if len(required) > 0 && !sameValues(required, actual) {
+			violations = append(violations, fmt.Sprintf("subject %s must be %q, got %q", attribute, required, actual))
+		}
+	}
+	check("O", subject.Organizations, csr.Subject.Organization)
+	check("OU", subject.OrganizationalUnits, csr.Subject.OrganizationalUnit)
+	check("C", subject.Countries, csr.Subject.Country)
+	check("ST", subject.Provinces, csr.Subject.Province)
+	check("L", subject.Localities, csr.Subject.Locality)
+
+	if len(violations) > 0 {
+		return &policyViolationError{violations: violations}
+	}
+	return nil
+}
+
+// sameValues reports whether two attribute lists hold the same values in any order
+func sameValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// checkDNSNameOwnership returns a violation for every DNS name that neither
+// belongs to a Service or Ingress in the namespace nor lies in an allowed zone
+func (r *CertificateRequestReconciler) checkDNSNameOwnership(ctx context.Context, namespace string, dnsNames []string, policy *externalissuerapi.DNSNameOwnershipPolicy) ([]string, error) {
+	if len(dnsNames) == 0 {
+		return nil, nil
+	}
+
+	owned, err := r.namespaceDNSNames(ctx, namespace, policy.ClusterDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []string
+	for _, name := range dnsNames {
+		name = normalizeDNSName(name)
+		if owned[name] || inAllowedZone(name, policy.AllowedZones) {
+			continue
+		}
+		// A wildcard Ingress host covers single-label names below it
+		if i := strings.Index(name, "."); i > 0 && !strings.HasPrefix(name, "*.") && owned["*"+name[i:]] {
+			continue
+		}
+		violations = append(violations, fmt.Sprintf("DNS name %q is not owned by namespace %q", name, namespace))
+	}
+	return violations, nil
+}
+
+// namespaceDNSNames collects the DNS names of all Services and Ingresses in a namespace
+func (r *CertificateRequestReconciler) namespaceDNSNames(ctx context.Context, namespace, clusterDomain string) (map[string]bool, error) {
+	if clusterDomain == "" {
+		clusterDomain = defaultClusterDomain
+	}
+	owned := map[string]bool{}
+
+	services := &corev1.ServiceList{}
+	if err := r.List(ctx, services, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list Services in %s: %w", namespace, err)
+	}
+	for _, svc := range services.Items {
+		base := svc.Name + "." + namespace
+		owned[svc.Name] = true
+		owned[base] = true
+		owned[base+".svc"] = true
+		owned[base+".svc."+normalizeDNSName(clusterDomain)] = true
+	}
+
+	ingresses := &networkingv1.IngressList{}
+	if err := r.List(ctx, ingresses, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list Ingresses in %s: %w", namespace, err)
+	}
+	for _, ing := range ingresses.Items {
+		for _, rule := range ing.Spec.Rules {
+			if rule.Host != "" {
+				owned[normalizeDNSName(rule.Host)] = true
+			}
+		}
+		for _, tls := range ing.Spec.TLS {
+			for _, host := range tls.Hosts {
+				owned[normalizeDNSName(host)] = true
+			}
+		}
+	}
+
+	return owned, nil
+}
+
+// checkSANs returns a violation for every SAN of a type the policy forbids
+// and every DNS name outside the allowed domains
+func checkSANs(csr *x509.CertificateRequest, policy *externalissuerapi.IssuerPolicy) []string {
+	var violations []string
+	for _, name := range csr.DNSNames {
+		name = normalizeDNSName(name)
+		if strings.HasPrefix(name, "*.") && !allowed(policy.AllowWildcards) {
+			violations = append(violations, fmt.Sprintf("wildcard DNS name %q is not allowed", name))
+			continue
+		}
+		if len(policy.AllowedDNSDomains) > 0 && !inAllowedZone(name, policy.AllowedDNSDomains) {
+			violations = append(violations, fmt.Sprintf("DNS name %q is not in an allowed domain", name))
+		}
+	}
+	if len(csr.IPAddresses) > 0 && !allowed(policy.AllowIPSANs) {
+		violations = append(violations, fmt.Sprintf("IP address SANs are not allowed, got %d", len(csr.IPAddresses)))
+	}
+	if len(csr.URIs) > 0 && !allowed(policy.AllowURISANs) {
+		violations = append(violations, fmt.Sprintf("URI SANs are not allowed, got %d", len(csr.URIs)))
+	}
+	if len(csr.EmailAddresses) > 0 && !allowed(policy.AllowEmailSANs) {
+		violations = append(violations, fmt.Sprintf("email address SANs are not allowed, got %d", len(csr.EmailAddresses)))
+	}
+	return violations
+}
+
+// allowed returns the value of an optional permission, which defaults to true
+func allowed(permission *bool) bool {
+	return permission == nil || *permission
+}
+
+// checkSPIFFEIDs returns a violation for every spiffe:// URI SAN that does not
+// identify the ServiceAccount which created the CertificateRequest
+func checkSPIFFEIDs(username string, uris []*url.URL, policy *externalissuerapi.SPIFFEPolicy) []string {
+	var spiffeIDs []*url.URL
+	for _, uri := range uris {
+		if strings.EqualFold(uri.Scheme, "spiffe") {
+			spiffeIDs = append(spiffeIDs, uri)
+		}
+	}
+	if len(spiffeIDs) == 0 {
+		if policy.Required {
+			return []string{"a SPIFFE ID URI SAN is required"}
+		}
+		return nil
+	}
+
+	namespace, serviceAccount, ok := parseServiceAccountUsername(username)
+	if !ok {
+		return []string{fmt.Sprintf("SPIFFE IDs can only be requested by a ServiceAccount, requester is %q", username)}
+	}
+
+	template := policy.PathTemplate
+	if template == "" {
+		template = defaultSPIFFEPathTemplate
+	}
+	expectedPath := strings.NewReplacer("{namespace}", namespace, "{serviceAccount}", serviceAccount).Replace(template)
+	var expected []string
+	for _, domain := range spiffeTrustDomains(policy) {
+		expected = append(expected, (&url.URL{Scheme: "spiffe", Host: domain, Path: expectedPath}).String())
+	}
+
+	var violations []string
+	for _, id := range spiffeIDs {
+		if slices.Contains(expected, id.String()) {
+			continue
+		}
+		if len(expected) == 1 {
+			violations = append(violations, fmt.Sprintf("SPIFFE ID %q does not match requester, expected %q", id.String(), expected[0]))
+		} else {
+			violations = append(violations, fmt.Sprintf("SPIFFE ID %q does not match requester, expected one of %q", id.String(), expected))
+		}
+	}
+	return violations
+}
+
+// parseServiceAccountUsername extracts namespace and name from a
+// "system:serviceaccount:<namespace>:<name>" username
+func parseServiceAccountUsername(username string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(username, serviceAccountUsernamePrefix)
+	if !ok {
+		return "", "", false
+	}
+	namespace, name, ok := strings.Cut(rest, ":")
+	if !ok || namespace == "" || name == "" {
+		return "", "", false
+	}
+	return namespace, name, true
+}
+
+// inAllowedZone reports whether a DNS name is a zone apex or lies below one of the zones
+func inAllowedZone(name string, zones []string) bool {
+	name = strings.TrimPrefix(name, "*.")
+	for _, zone := range zones {
+		zone = strings.TrimPrefix(normalizeDNSName(zone), "*.")
+		if zone != "" && (name == zone || strings.HasSuffix(name, "."+zone)) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDNSName lowercases a DNS name and strips a trailing dot
+func normalizeDNSName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// parseCSR decodes a PEM-encoded certificate signing request
+func parseCSR(csrPEM []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("invalid CSR PEM")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSR: %w", err)
+	}
+	return csr, nil
+}
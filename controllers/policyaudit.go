@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// policyModeAudit reports policy violations without failing the requests
+	policyModeAudit = "Audit"
+
+	// policyAuditSize is how many violations an issuer's status lists
+	policyAuditSize = 10
+)
+
+// auditing reports whether a policy only reports violations
+func auditing(policy *externalissuerapi.IssuerPolicy) bool {
+	return policy != nil && policy.Mode == policyModeAudit
+}
+
+// PolicyAuditTracker remembers the requests issued despite violating the
+// policy of an issuer in Audit mode. The issuer reconcilers persist them in
+// the issuer status.
+type PolicyAuditTracker struct {
+	mu      sync.Mutex
+	records map[string][]externalissuerapi.PolicyViolationRecord
+}
+
+// NewPolicyAuditTracker creates an empty policy audit tracker
+func NewPolicyAuditTracker() *PolicyAuditTracker {
+	return &PolicyAuditTracker{records: map[string][]externalissuerapi.PolicyViolationRecord{}}
+}
+
+// record adds a violation of an issuer's policy
+func (t *PolicyAuditTracker) record(key string, record externalissuerapi.PolicyViolationRecord) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.records[key] = mergeViolations(t.records[key], []externalissuerapi.PolicyViolationRecord{record})
+}
+
+// recent returns the violations recorded for an issuer
+func (t *PolicyAuditTracker) recent(key string) []externalissuerapi.PolicyViolationRecord {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]externalissuerapi.PolicyViolationRecord{}, t.records[key]...)
+}
+
+// mergeViolations combines violation records, keeping the latest record of
+// each CertificateRequest and the policyAuditSize most recent ones, oldest first
+func mergeViolations(existing, added []externalissuerapi.PolicyViolationRecord) []externalissuerapi.PolicyViolationRecord {
+	byRequest := map[string]externalissuerapi.PolicyViolationRecord{}
+	for _, record := range append(append([]externalissuerapi.PolicyViolationRecord{}, existing...), added...) {
+		if prev, ok := byRequest[record.CertificateRequest]; !ok || !record.Time.Before(&prev.Time) {
+			byRequest[record.CertificateRequest] = record
+		}
+	}
+	merged := make([]externalissuerapi.PolicyViolationRecord, 0, len(byRequest))
+	for _, record := range byRequest {
+		merged = append(merged, record)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Time.Equal(&merged[j].Time) {
+			return merged[i].CertificateRequest < merged[j].CertificateRequest
+		}
+		return merged[i].Time.Before(&merged[j].Time)
+	})
+	if len(merged) > policyAuditSize {
+		merged = merged[len(merged)-policyAuditSize:]
+	}
+	return merged
+}
+
+// setPolicyAudit adds the violations recorded since the issuer was last
+// reconciled to its status; records already in the status survive restarts
+func setPolicyAudit(status *externalissuerapi.ExternalIssuerStatus, key string, tracker *PolicyAuditTracker) {
+	if recent := tracker.recent(key); len(recent) > 0 {
+		status.PolicyAudit = mergeViolations(status.PolicyAudit, recent)
+	}
+}
+
+// auditPolicyViolation reports a request that violates an issuer policy in
+// Audit mode, which is issued anyway
+func (r *CertificateRequestReconciler) auditPolicyViolation(ctx context.Context, cr *cmapi.CertificateRequest, violation *policyViolationError, now time.Time) {
+	log.FromContext(ctx).Info("CertificateRequest violates issuer policy in audit mode, issuing anyway", "name", cr.Name, "violations", violation.violations)
+	if r.Recorder != nil {
+		r.Recorder.Event(cr, corev1.EventTypeWarning, "PolicyAudit",
+			truncateMessage("would be denied in Enforce mode: "+strings.Join(violation.violations, "; "), maxEventMessageLength))
+	}
+	r.PolicyAudit.record(issuerKey(cr.Spec.IssuerRef.Kind, cr.Namespace, cr.Spec.IssuerRef.Name), externalissuerapi.PolicyViolationRecord{
+		Time:               metav1.NewTime(now),
+		CertificateRequest: cr.Namespace + "/" + cr.Name,
+		Violations:         violation.violations,
+	})
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	"github.com/bvorland/cert-manager-external-issuer/pkg/signer/configbuilder"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups=external-issuer.io,resources=pkiprofiles,verbs=get;list;watch
+
+// errPKIProfilesDisabled is returned for issuers referencing a PKIProfile in
+// namespaced deployments, which can't read cluster-scoped resources
+var errPKIProfilesDisabled = fmt.Errorf("profileRef is not supported when cluster-scoped resources are disabled; use configMapRef")
+
+// usesPKIConfig reports whether an issuer signs with the PKI signer configured
+// by a ConfigMap or PKIProfile
+func usesPKIConfig(spec *externalissuerapi.ExternalIssuerSpec) bool {
+	return spec.SignerType == "pki" && (spec.ConfigMapRef != nil || spec.ProfileRef != nil)
+}
+
+// loadPKIProfile loads the PKI configuration of the PKIProfile an issuer
+// references, along with the profile's auth Secret reference
+func loadPKIProfile(ctx context.Context, c client.Reader, spec *externalissuerapi.ExternalIssuerSpec) (*signer.PKIConfig, *externalissuerapi.AuthSecretReference, error) {
+	if spec.ConfigMapRef != nil {
+		return nil, nil, fmt.Errorf("configMapRef and profileRef are mutually exclusive")
+	}
+
+	profile := &externalissuerapi.PKIProfile{}
+	if err := c.Get(ctx, types.NamespacedName{Name: spec.ProfileRef.Name}, profile); err != nil {
+		return nil, nil, fmt.Errorf("failed to get PKIProfile %s: %w", spec.ProfileRef.Name, err)
+	}
+	if len(profile.Spec.Config.Raw) == 0 {
+		return nil, nil, fmt.Errorf("PKIProfile %s has no config", profile.Name)
+	}
+
+	config, err := configbuilder.Parse(profile.Spec.Config.Raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w in PKIProfile %s: %w", errInvalidPKIConfig, profile.Name, err)
+	}
+	return config, profile.Spec.AuthSecretRef, nil
+}
+
+// issuersForProfile enqueues the issuers referencing a changed PKIProfile, so
+// their Ready condition reflects the new configuration
+func issuersForProfile(ctx context.Context, c client.Reader, list client.ObjectList, profileName string) []reconcile.Request {
+	if err := c.List(ctx, list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list issuers for PKIProfile", "profile", profileName)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	add := func(obj client.Object, spec *externalissuerapi.ExternalIssuerSpec) {
+		if spec.ProfileRef != nil && spec.ProfileRef.Name == profileName {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(obj)})
+		}
+	}
+	switch l := list.(type) {
+	case *externalissuerapi.ExternalIssuerList:
+		for i := range l.Items {
+			add(&l.Items[i], &l.Items[i].Spec)
+		}
+	case *externalissuerapi.ExternalClusterIssuerList:
+		for i := range l.Items {
+			add(&l.Items[i], &l.Items[i].Spec)
+		}
+	}
+	return requests
+}
@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// renewAnnotation opts a TLS Secret that is not managed by a cert-manager Certificate into renewal
+	renewAnnotation = "external-issuer.io/renew"
+
+	// renewBeforeAnnotation sets how long before expiry the certificate is renewed (Go duration)
+	renewBeforeAnnotation = "external-issuer.io/renew-before"
+
+	// renewalRequestAnnotation names the CertificateRequest currently renewing the Secret
+	renewalRequestAnnotation = "external-issuer.io/renewal-request"
+
+	// renewalRetryAnnotation records when a failed renewal is attempted again (RFC 3339)
+	renewalRetryAnnotation = "external-issuer.io/renewal-retry-after"
+
+	// renewalRetryDelay is the wait after a renewal request failed or was denied
+	renewalRetryDelay = time.Hour
+)
+
+// SecretRenewalReconciler renews certificates in TLS Secrets that were issued by
+// an external issuer but are not managed by a cert-manager Certificate, such as
+// Secrets written by CI pipelines from raw CertificateRequests.
+//
+// Secrets opt in with the external-issuer.io/renew: "true" annotation and name
+// their issuer with the cert-manager.io/issuer-name and issuer-kind annotations.
+// When renewal is due a CertificateRequest is created from the Secret's private
+// key and the current certificate's subject and SANs; once it is issued,
+// tls.crt and ca.crt are replaced in place.
+type SecretRenewalReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Clock supplies the current time for renewal and retry times (default: the real clock)
+	Clock clock.PassiveClock
+}
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch;create;delete
+
+func (r *SecretRenewalReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, req.NamespacedName, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !wantsRenewal(secret) {
+		return ctrl.Result{}, nil
+	}
+
+	if name := secret.Annotations[renewalRequestAnnotation]; name != "" {
+		return r.completeRenewal(ctx, secret, name)
+	}
+
+	cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		// Nothing to renew until the Secret is fixed, which triggers a new reconcile
+		logger.Error(err, "Cannot renew Secret", "secret", req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	renewAt, err := renewalTime(cert, secret.Annotations[renewBeforeAnnotation])
+	if err != nil {
+		logger.Error(err, "Cannot renew Secret", "secret", req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+	if retry, err := time.Parse(time.RFC3339, secret.Annotations[renewalRetryAnnotation]); err == nil && retry.After(renewAt) {
+		renewAt = retry
+	}
+	if wait := renewAt.Sub(clockOrReal(r.Clock).Now()); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	cr, err := r.renewalRequest(secret, cert)
+	if err != nil {
+		logger.Error(err, "Cannot renew Secret", "secret", req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+	if err := r.Create(ctx, cr); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to create renewal CertificateRequest: %w", err)
+	}
+
+	patch := client.MergeFrom(secret.DeepCopy())
+	secret.Annotations[renewalRequestAnnotation] = cr.Name
+	delete(secret.Annotations, renewalRetryAnnotation)
+	if err := r.Patch(ctx, secret, patch); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to record renewal request: %w", err)
+	}
+
+	logger.Info("Created renewal CertificateRequest", "secret", req.NamespacedName, "request", cr.Name, "notAfter", cert.NotAfter)
+	return ctrl.Result{}, nil
+}
+
+// completeRenewal copies the certificate of a finished renewal request into the
+// Secret, or schedules a retry if the request failed
+func (r *SecretRenewalReconciler) completeRenewal(ctx context.Context, secret *corev1.Secret, name string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	cr := &cmapi.CertificateRequest{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: secret.Namespace}, cr); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		// The request was deleted before it completed; start over
+		patch := client.MergeFrom(secret.DeepCopy())
+		delete(secret.Annotations, renewalRequestAnnotation)
+		return ctrl.Result{}, r.Patch(ctx, secret, patch)
+	}
+
+	switch {
+	case len(cr.Status.Certificate) > 0:
+		patch := client.MergeFrom(secret.DeepCopy())
+		secret.Data[corev1.TLSCertKey] = cr.Status.Certificate
+		if len(cr.Status.CA) > 0 {
+			secret.Data[cmmeta.TLSCAKey] = cr.Status.CA
+		}
+		delete(secret.Annotations, renewalRequestAnnotation)
+		if err := r.Patch(ctx, secret, patch); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to store renewed certificate: %w", err)
+		}
+		// The certificate now lives in the Secret
+		if err := r.Delete(ctx, cr); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete completed renewal request", "request", cr.Name)
+		}
+		logger.Info("Renewed certificate in Secret", "secret", client.ObjectKeyFromObject(secret), "request", cr.Name)
+		return ctrl.Result{}, nil
+
+	case isInTerminalState(cr):
+		patch := client.MergeFrom(secret.DeepCopy())
+		delete(secret.Annotations, renewalRequestAnnotation)
+		secret.Annotations[renewalRetryAnnotation] = clockOrReal(r.Clock).Now().Add(renewalRetryDelay).UTC().Format(time.RFC3339)
+		if err := r.Patch(ctx, secret, patch); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to record renewal failure: %w", err)
+		}
+		logger.Info("Renewal request failed, retrying later", "secret", client.ObjectKeyFromObject(secret), "request", cr.Name, "retryAfter", renewalRetryDelay)
+		return ctrl.Result{RequeueAfter: renewalRetryDelay}, nil
+
+	default:
+		// Still pending; updates of the owned request trigger another reconcile
+		return ctrl.Result{}, nil
+	}
+}
+
+// renewalRequest builds a CertificateRequest that re-issues the Secret's
+// certificate for the same key, subject and SANs
+func (r *SecretRenewalReconciler) renewalRequest(secret *corev1.Secret, cert *x509.Certificate) (*cmapi.CertificateRequest, error) {
+	issuerRef := cmmeta.ObjectReference{
+		Name:  secret.Annotations[cmapi.IssuerNameAnnotationKey],
+		Kind:  secret.Annotations[cmapi.IssuerKindAnnotationKey],
+		Group: secret.Annotations[cmapi.IssuerGroupAnnotationKey],
+	}
+	if issuerRef.Name == "" {
+		return nil, fmt.Errorf("annotation %s is required", cmapi.IssuerNameAnnotationKey)
+	}
+	if issuerRef.Kind == "" {
+		issuerRef.Kind = issuerKind
+	}
+	if issuerRef.Group == "" {
+		issuerRef.Group = externalIssuerAPIGroup
+	}
+	if issuerRef.Group != externalIssuerAPIGroup || (issuerRef.Kind != issuerKind && issuerRef.Kind != clusterIssuerKind) {
+		return nil, fmt.Errorf("issuer %s %s.%s is not an external issuer", issuerRef.Name, issuerRef.Kind, issuerRef.Group)
+	}
+
+	key, err := parsePrivateKey(secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, err
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        cert.Subject,
+		DNSNames:       cert.DNSNames,
+		IPAddresses:    cert.IPAddresses,
+		URIs:           cert.URIs,
+		EmailAddresses: cert.EmailAddresses,
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CSR: %w", err)
+	}
+
+	cr := &cmapi.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: secret.Name + "-renewal-",
+			Namespace:    secret.Namespace,
+		},
+		Spec: cmapi.CertificateRequestSpec{
+			Request:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}),
+			IssuerRef: issuerRef,
+			Duration:  &metav1.Duration{Duration: cert.NotAfter.Sub(cert.NotBefore)},
+			Usages:    certificateUsages(cert),
+		},
+	}
+	// Renewal requests are garbage collected with their Secret
+	if err := controllerutil.SetControllerReference(secret, cr, r.Scheme); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// wantsRenewal reports whether a Secret opted into renewal and is not managed by cert-manager
+func wantsRenewal(secret *corev1.Secret) bool {
+	if secret.Annotations[renewAnnotation] != "true" {
+		return false
+	}
+	_, managed := secret.Annotations[cmapi.CertificateNameKey]
+	return !managed
+}
+
+// renewalTime returns when a certificate is due for renewal: renewBefore ahead
+// of expiry, or after two thirds of its lifetime like cert-manager by default
+func renewalTime(cert *x509.Certificate, renewBefore string) (time.Time, error) {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	before := lifetime / 3
+	if renewBefore != "" {
+		d, err := time.ParseDuration(renewBefore)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s annotation: %w", renewBeforeAnnotation, err)
+		}
+		if d > 0 && d < lifetime {
+			before = d
+		}
+	}
+	return cert.NotAfter.Add(-before), nil
+}
+
+// certificateUsages maps a certificate's key usages to cert-manager usages
+func certificateUsages(cert *x509.Certificate) []cmapi.KeyUsage {
+	var usages []cmapi.KeyUsage
+	if cert.KeyUsage&x509.KeyUsageDigitalSignature != 0 {
+		usages = append(usages, cmapi.UsageDigitalSignature)
+	}
+	if cert.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+		usages = append(usages, cmapi.UsageKeyEncipherment)
+	}
+	for _, eku := range cert.ExtKeyUsage {
+		switch eku {
+		case x509.ExtKeyUsageServerAuth:
+			usages = append(usages, cmapi.UsageServerAuth)
+		case x509.ExtKeyUsageClientAuth:
+			usages = append(usages, cmapi.UsageClientAuth)
+		}
+	}
+	return usages
+}
+
+// parseCertificate decodes the first certificate of a PEM bundle
+func parseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse certificate: %w", err)
+			}
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("no certificate found in %s", corev1.TLSCertKey)
+}
+
+// parsePrivateKey decodes a PEM private key in PKCS#1, SEC 1 or PKCS#8 form
+func parsePrivateKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no private key found in %s", corev1.TLSPrivateKeyKey)
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+func (r *SecretRenewalReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("secret-renewal").
+		For(&corev1.Secret{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetAnnotations()[renewAnnotation] == "true"
+		}))).
+		Owns(&cmapi.CertificateRequest{}).
+		Complete(tracedReconciler{name: "SecretRenewal", Reconciler: r})
+}
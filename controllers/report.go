@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// defaultReportInterval is how often the ExternalIssuerReport is refreshed
+const defaultReportInterval = time.Minute
+
+// +kubebuilder:rbac:groups=external-issuer.io,resources=externalissuerreports,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=external-issuer.io,resources=externalissuerreports/status,verbs=get;update
+
+// IssuerReporter keeps an ExternalIssuerReport summarizing the controller's
+// issuers up to date: their readiness and health checks, CA expiries and the
+// state of their CertificateRequests, so there is a single object to watch
+// or scrape for the whole PKI integration.
+//
+// The report covers the issuers and requests in the manager's cache, so each
+// shard of a sharded deployment writes its own report. It implements
+// manager.Runnable and runs on the leader only.
+type IssuerReporter struct {
+	Client client.Client
+
+	// Name is the name of the ExternalIssuerReport
+	Name string
+
+	// Backends supplies the results of the issuers' health checks
+	Backends *BackendHealth
+
+	// Interval is how often the report is refreshed (default: 1 minute)
+	Interval time.Duration
+
+	// Clock supplies the current time (default: the real clock)
+	Clock clock.PassiveClock
+
+	// DisableClusterIssuers leaves ExternalClusterIssuers out of the report
+	DisableClusterIssuers bool
+}
+
+// NeedLeaderElection makes only the leader write the report
+func (r *IssuerReporter) NeedLeaderElection() bool {
+	return true
+}
+
+// Start refreshes the report every Interval until ctx is cancelled
+func (r *IssuerReporter) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("issuer-reporter")
+	ctx = log.IntoContext(ctx, logger)
+
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultReportInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.report(ctx); err != nil {
+			logger.Error(err, "Failed to update the ExternalIssuerReport", "name", r.Name)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// report writes the current state of the issuers to the report, creating it if needed
+func (r *IssuerReporter) report(ctx context.Context) error {
+	status, err := r.status(ctx)
+	if err != nil {
+		return err
+	}
+
+	report := &externalissuerapi.ExternalIssuerReport{}
+	err = r.Client.Get(ctx, types.NamespacedName{Name: r.Name}, report)
+	if apierrors.IsNotFound(err) {
+		report.Name = r.Name
+		err = r.Client.Create(ctx, report)
+	}
+	if err != nil {
+		return err
+	}
+	report.Status = *status
+	return r.Client.Status().Update(ctx, report)
+}
+
+// status collects the state of the issuers and their requests
+func (r *IssuerReporter) status(ctx context.Context) (*externalissuerapi.ExternalIssuerReportStatus, error) {
+	issuers := &externalissuerapi.ExternalIssuerList{}
+	if err := r.Client.List(ctx, issuers); err != nil {
+		return nil, err
+	}
+	var reports []externalissuerapi.IssuerReport
+	for i := range issuers.Items {
+		issuer := &issuers.Items[i]
+		reports = append(reports, r.issuerReport(issuerKind, issuer.Namespace, issuer.Name, &issuer.Spec, &issuer.Status))
+	}
+	if !r.DisableClusterIssuers {
+		clusterIssuers := &externalissuerapi.ExternalClusterIssuerList{}
+		if err := r.Client.List(ctx, clusterIssuers); err != nil {
+			return nil, err
+		}
+		for i := range clusterIssuers.Items {
+			issuer := &clusterIssuers.Items[i]
+			reports = append(reports, r.issuerReport(clusterIssuerKind, "", issuer.Name, &issuer.Spec, &issuer.Status))
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	requests := &cmapi.CertificateRequestList{}
+	if err := r.Client.List(ctx, requests); err != nil {
+		return nil, err
+	}
+	counts := map[string]*externalissuerapi.RequestCounts{}
+	for i := range reports {
+		counts[issuerKey(reports[i].Kind, reports[i].Namespace, reports[i].Name)] = &reports[i].Requests
+	}
+	status := &externalissuerapi.ExternalIssuerReportStatus{}
+	for i := range requests.Items {
+		cr := &requests.Items[i]
+		ref := cr.Spec.IssuerRef
+		if ref.Group != externalIssuerAPIGroup || (ref.Kind != issuerKind && (ref.Kind != clusterIssuerKind || r.DisableClusterIssuers)) {
+			continue
+		}
+		countRequest(cr, &status.Requests)
+		// Requests of deleted issuers only count towards the totals
+		if issuerCounts := counts[issuerKey(ref.Kind, cr.Namespace, ref.Name)]; issuerCounts != nil {
+			countRequest(cr, issuerCounts)
+		}
+	}
+
+	now := metav1.NewTime(clockOrReal(r.Clock).Now())
+	status.LastUpdateTime = &now
+	status.Issuers = reports
+	for _, report := range reports {
+		if report.Ready == metav1.ConditionTrue {
+			status.ReadyIssuers++
+		}
+		if report.CANotAfter != nil && (status.CANotAfter == nil || report.CANotAfter.Before(status.CANotAfter)) {
+			status.CANotAfter = report.CANotAfter.DeepCopy()
+		}
+	}
+	return status, nil
+}
+
+// issuerReport summarizes an issuer; its requests are counted separately
+func (r *IssuerReporter) issuerReport(kind, namespace, name string, spec *externalissuerapi.ExternalIssuerSpec, issuerStatus *externalissuerapi.ExternalIssuerStatus) externalissuerapi.IssuerReport {
+	report := externalissuerapi.IssuerReport{
+		Kind:       kind,
+		Namespace:  namespace,
+		Name:       name,
+		Paused:     spec.Paused,
+		CANotAfter: issuerStatus.CANotAfter.DeepCopy(),
+	}
+	if ready := meta.FindStatusCondition(issuerStatus.Conditions, issuerReadyCondition); ready != nil {
+		report.Ready = ready.Status
+		report.Reason = ready.Reason
+	}
+	if degraded := meta.FindStatusCondition(issuerStatus.Conditions, degradedCondition); degraded != nil && degraded.Status == metav1.ConditionTrue {
+		report.Degraded = degraded.Reason
+	}
+	if result, ok := r.Backends.lastCheck(issuerKey(kind, namespace, name)); ok {
+		checkedAt := metav1.NewTime(result.checkedAt)
+		report.LastHealthCheckTime = &checkedAt
+		if result.err != nil {
+			report.HealthCheckError = truncateMessage(result.err.Error(), maxEventMessageLength)
+			failingSince := metav1.NewTime(result.failingSince)
+			report.FailingSince = &failingSince
+		}
+	}
+	return report
+}
+
+// countRequest counts a CertificateRequest by its state
+func countRequest(cr *cmapi.CertificateRequest, counts *externalissuerapi.RequestCounts) {
+	if reason, _, ok := terminalFailure(cr); ok {
+		if reason == cmapi.CertificateRequestReasonDenied {
+			counts.Denied++
+		} else {
+			counts.Failed++
+		}
+		return
+	}
+	if ready := requestCondition(cr, cmapi.CertificateRequestConditionReady); ready != nil && ready.Status == cmmeta.ConditionTrue {
+		counts.Issued++
+		return
+	}
+	counts.Pending++
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"strings"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+)
+
+// requesterSetter is implemented by signers that send the identity of the
+// requester of a certificate to the PKI
+type requesterSetter interface {
+	SetRequester(requester map[string]string)
+}
+
+// requesterFields returns the identity of the user or ServiceAccount that
+// created a request, as recorded by the API server in its spec: username,
+// uid, groups and extra.<key>, with several values joined by commas
+func requesterFields(cr *cmapi.CertificateRequest) map[string]string {
+	fields := map[string]string{
+		"username": cr.Spec.Username,
+		"uid":      cr.Spec.UID,
+		"groups":   strings.Join(cr.Spec.Groups, ","),
+	}
+	for key, values := range cr.Spec.Extra {
+		fields["extra."+key] = strings.Join(values, ",")
+	}
+	return fields
+}
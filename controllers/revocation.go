@@ -0,0 +1,368 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/exporter"
+	"github.com/bvorland/cert-manager-external-issuer/internal/revocation"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// revokedCondition is the condition type of CertificateRevocationRequests
+	revokedCondition = "Revoked"
+
+	// revocationRetryDelay is the wait before retrying a revocation that
+	// could not be completed yet
+	revocationRetryDelay = time.Minute
+)
+
+// Revoker is implemented by signers whose backend can revoke certificates
+// they issued. Revoke takes an RFC 5280 reason; certificateHold suspends the
+// certificate until Unhold releases it. Both return
+// signer.ErrRevocationNotConfigured when the backend has no revocation
+// endpoint configured.
+type Revoker interface {
+	Revoke(ctx context.Context, serial *big.Int, reason string) (time.Time, error)
+	Unhold(ctx context.Context, serial *big.Int) (time.Time, error)
+}
+
+// revocationAction is what a CertificateRevocationRequest does with its
+// certificate, depending on the reason
+type revocationAction struct {
+	// conditionReason is the reason of the Revoked condition and of the event once done
+	conditionReason string
+	verb            string
+	event           string
+}
+
+var (
+	revokeAction  = revocationAction{conditionReason: "Revoked", verb: "revoked", event: exporter.EventRevoked}
+	holdAction    = revocationAction{conditionReason: "Held", verb: "put on hold", event: exporter.EventHeld}
+	releaseAction = revocationAction{conditionReason: "Released", verb: "released from hold", event: exporter.EventReleased}
+)
+
+// actionFor returns the action of a revocation reason
+func actionFor(reason string) revocationAction {
+	switch reason {
+	case revocation.CertificateHold:
+		return holdAction
+	case revocation.RemoveFromCRL:
+		return releaseAction
+	}
+	return revokeAction
+}
+
+// RevocationReconciler revokes certificates requested by
+// CertificateRevocationRequests through the PKI backend of their issuer
+type RevocationReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Credentials caches auth tokens between reconciles; nil reads the Secret every time
+	Credentials *CredentialCache
+
+	// ServiceAccountTokens supplies bound tokens for PKI auth type kubernetes
+	ServiceAccountTokens *ServiceAccountTokens
+
+	// OAuthTokens supplies refreshed access tokens for PKI auth with refresh configured
+	OAuthTokens *OAuthTokens
+
+	// Clock supplies the current time for signers and inventory records (default: the real clock)
+	Clock clock.PassiveClock
+
+	// Exporter queues records of revoked certificates for the inventory; nil disables exporting
+	Exporter *exporter.Queue
+
+	// Recorder receives events for revoked certificates and failures
+	Recorder record.EventRecorder
+
+	// DisableClusterIssuers fails requests for ExternalClusterIssuers, so a
+	// namespaced deployment never reads cluster-scoped resources
+	DisableClusterIssuers bool
+
+	// DisablePKIProfiles fails requests for issuers referencing a PKIProfile
+	DisablePKIProfiles bool
+
+	// DisableMockCA fails requests for issuers using the built-in mockca signer
+	DisableMockCA bool
+
+	// AllowMockCAFallback uses the built-in mockca signer for issuers with
+	// signerType pki but no PKI configuration
+	AllowMockCAFallback bool
+
+	// ClusterResourceNamespace holds the ConfigMaps and Secrets of
+	// ExternalClusterIssuers that don't name a namespace (default external-issuer-system)
+	ClusterResourceNamespace string
+
+	// SecretKeyAutodetect is whether the token key of auth Secrets is
+	// guessed, as for issuance
+	SecretKeyAutodetect string
+}
+
+// +kubebuilder:rbac:groups=external-issuer.io,resources=certificaterevocationrequests,verbs=get;list;watch
+// +kubebuilder:rbac:groups=external-issuer.io,resources=certificaterevocationrequests/status,verbs=get;update;patch
+
+func (r *RevocationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	crr := &externalissuerapi.CertificateRevocationRequest{}
+	if err := r.Get(ctx, req.NamespacedName, crr); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Revocation is final, and failed requests are recreated rather than retried
+	if c := meta.FindStatusCondition(crr.Status.Conditions, revokedCondition); c != nil &&
+		(c.Status == metav1.ConditionTrue || c.Reason == "Failed") {
+		return ctrl.Result{}, nil
+	}
+
+	reason := crr.Spec.Reason
+	if reason != "" {
+		var err error
+		if reason, _, err = revocation.Parse(reason); err != nil {
+			return ctrl.Result{}, r.setFailed(ctx, crr, err.Error())
+		}
+	}
+	action := actionFor(reason)
+
+	target, err := r.findTarget(ctx, crr)
+	if err != nil {
+		var invalid *targetError
+		if errors.As(err, &invalid) {
+			return ctrl.Result{}, r.setFailed(ctx, crr, err.Error())
+		}
+		return ctrl.Result{}, err
+	}
+	kind, name := target.issuerKind, target.issuerName
+	crr.Status.SerialNumber = formatSerial(target.serial)
+
+	if kind == clusterIssuerKind && r.DisableClusterIssuers {
+		return ctrl.Result{}, r.setFailed(ctx, crr, "ExternalClusterIssuers are disabled in this deployment")
+	}
+
+	issuerSpec, err := readyIssuerSpec(ctx, r.Client, kind, name, crr.Namespace)
+	if err != nil {
+		logger.Info("Issuer not available for revocation, retrying", "name", crr.Name, "reason", err.Error())
+		return ctrl.Result{RequeueAfter: revocationRetryDelay},
+			r.setCondition(ctx, crr, metav1.ConditionFalse, "IssuerNotReady", err.Error())
+	}
+
+	// Signers are built exactly as for issuance, with the same credential sources
+	signers := &CertificateRequestReconciler{
+		Client:                   r.Client,
+		Credentials:              r.Credentials,
+		ServiceAccountTokens:     r.ServiceAccountTokens,
+		OAuthTokens:              r.OAuthTokens,
+		Clock:                    r.Clock,
+		DisablePKIProfiles:       r.DisablePKIProfiles,
+		DisableMockCA:            r.DisableMockCA,
+		ClusterResourceNamespace: r.ClusterResourceNamespace,
+		AllowMockCAFallback:      r.AllowMockCAFallback,
+		SecretKeyAutodetect:      r.SecretKeyAutodetect,
+		Recorder:                 r.Recorder,
+	}
+	certSigner, reason, err := signers.newSigner(ctx, crr, issuerSpec, kind, crr.Namespace)
+	if err != nil {
+		return ctrl.Result{RequeueAfter: revocationRetryDelay}, r.setCondition(ctx, crr, metav1.ConditionFalse, reason, err.Error())
+	}
+
+	revoker, err := revokerFor(certSigner, issuerSpec)
+	if err != nil {
+		return ctrl.Result{}, r.setFailed(ctx, crr, err.Error())
+	}
+
+	var revokedAt time.Time
+	if action == releaseAction {
+		revokedAt, err = revoker.Unhold(ctx, target.serial)
+	} else {
+		revokedAt, err = revoker.Revoke(ctx, target.serial, reason)
+	}
+	if errors.Is(err, signer.ErrRevocationNotConfigured) {
+		return ctrl.Result{}, r.setFailed(ctx, crr, fmt.Sprintf("issuer %s cannot revoke certificates: %v", name, err))
+	}
+	if err != nil {
+		logger.Error(err, "Failed to revoke certificate", "name", crr.Name, "serial", crr.Status.SerialNumber, "reason", reason)
+		if r.Recorder != nil {
+			r.Recorder.Event(crr, corev1.EventTypeWarning, "RevocationError", truncateMessage(err.Error(), maxEventMessageLength))
+		}
+		return ctrl.Result{RequeueAfter: revocationRetryDelay},
+			r.setCondition(ctx, crr, metav1.ConditionFalse, "RevocationError", err.Error())
+	}
+
+	logger.Info("Certificate "+action.verb, "name", crr.Name, "serial", crr.Status.SerialNumber, "issuer", name, "reason", reason)
+	crr.Status.RevocationTime = &metav1.Time{Time: revokedAt}
+	crr.Status.Reason = reason
+	if r.Recorder != nil {
+		r.Recorder.Event(crr, corev1.EventTypeNormal, action.conditionReason,
+			fmt.Sprintf("Certificate %s %s by %s %s", crr.Status.SerialNumber, action.verb, kind, name))
+	}
+	if err := r.setCondition(ctx, crr, metav1.ConditionTrue, action.conditionReason, "Certificate "+action.verb); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.exportRevoked(ctx, crr, target, action.event)
+	return ctrl.Result{}, nil
+}
+
+// revocationTarget is the certificate a CertificateRevocationRequest revokes
+type revocationTarget struct {
+	serial *big.Int
+	// certPEM is the certificate when it was read from a Secret
+	certPEM    []byte
+	issuerKind string
+	issuerName string
+}
+
+// revokerFor returns the signer of an issuer as a Revoker, failing for
+// signers that can't revoke certificates
+func revokerFor(certSigner Signer, issuerSpec *externalissuerapi.ExternalIssuerSpec) (Revoker, error) {
+	revoker, ok := certSigner.(Revoker)
+	if !ok {
+		return nil, fmt.Errorf("signer %s cannot revoke certificates", activeSignerType(issuerSpec))
+	}
+	return revoker, nil
+}
+
+// targetError reports a CertificateRevocationRequest whose certificate or
+// issuer can't be determined; the request fails permanently
+type targetError struct {
+	message string
+}
+
+func (e *targetError) Error() string {
+	return e.message
+}
+
+// findTarget determines the certificate to revoke and its issuer
+func (r *RevocationReconciler) findTarget(ctx context.Context, crr *externalissuerapi.CertificateRevocationRequest) (*revocationTarget, error) {
+	spec := crr.Spec
+	if (spec.SerialNumber == "") == (spec.SecretName == "") {
+		return nil, &targetError{"exactly one of serialNumber and secretName must be set"}
+	}
+
+	target := &revocationTarget{}
+	if spec.SecretName != "" {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: spec.SecretName, Namespace: crr.Namespace}, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, &targetError{fmt.Sprintf("Secret %s not found", spec.SecretName)}
+			}
+			return nil, fmt.Errorf("failed to get Secret %s: %w", spec.SecretName, err)
+		}
+		certs, err := parsePEMCertificates(secret.Data[corev1.TLSCertKey])
+		if err != nil {
+			return nil, &targetError{fmt.Sprintf("Secret %s key %s: %v", spec.SecretName, corev1.TLSCertKey, err)}
+		}
+		target.serial = certs[0].SerialNumber
+		target.certPEM = secret.Data[corev1.TLSCertKey]
+		target.issuerKind, target.issuerName, _ = secretIssuer(secret)
+	} else {
+		var ok bool
+		if target.serial, ok = parseSerial(spec.SerialNumber); !ok {
+			return nil, &targetError{fmt.Sprintf("invalid serialNumber %q: must be hexadecimal", spec.SerialNumber)}
+		}
+	}
+
+	if ref := spec.IssuerRef; ref != nil {
+		target.issuerKind, target.issuerName = ref.Kind, ref.Name
+		if target.issuerKind == "" {
+			target.issuerKind = issuerKind
+		}
+	}
+	if target.issuerName == "" {
+		return nil, &targetError{"issuerRef is required unless the Secret names its issuer in cert-manager annotations"}
+	}
+	return target, nil
+}
+
+// exportRevoked queues an inventory record for a revoked, held or released
+// certificate. Without the certificate itself the record only carries the
+// serial number.
+func (r *RevocationReconciler) exportRevoked(ctx context.Context, crr *externalissuerapi.CertificateRevocationRequest, target *revocationTarget, event string) {
+	if r.Exporter == nil {
+		return
+	}
+	logger := log.FromContext(ctx)
+
+	record := exporter.Record{
+		Event:        event,
+		Timestamp:    clockOrReal(r.Clock).Now().UTC(),
+		SerialNumber: formatSerial(target.serial),
+	}
+	if target.certPEM != nil {
+		var err error
+		if record, err = exporter.NewRecord(event, target.certPEM); err != nil {
+			logger.Error(err, "Failed to build inventory record", "name", crr.Name)
+			return
+		}
+	}
+	record.Namespace = crr.Namespace
+	record.IssuerKind = target.issuerKind
+	record.IssuerName = target.issuerName
+
+	if err := r.Exporter.Enqueue(record); err != nil {
+		logger.Error(err, "Failed to queue inventory record", "name", crr.Name)
+	}
+}
+
+// parseSerial parses a hexadecimal serial number, optionally colon-separated
+func parseSerial(s string) (*big.Int, bool) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ":", "")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if s == "" {
+		return nil, false
+	}
+	return new(big.Int).SetString(s, 16)
+}
+
+// formatSerial formats a serial number as uppercase hexadecimal, as printed
+// by openssl x509 -serial
+func formatSerial(serial *big.Int) string {
+	return strings.ToUpper(serial.Text(16))
+}
+
+// setCondition sets the Revoked condition and updates the status
+func (r *RevocationReconciler) setCondition(ctx context.Context, crr *externalissuerapi.CertificateRevocationRequest, status metav1.ConditionStatus, reason, message string) error {
+	meta.SetStatusCondition(&crr.Status.Conditions, metav1.Condition{
+		Type:               revokedCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            summarizeMessage(message),
+		ObservedGeneration: crr.Generation,
+	})
+	return r.Status().Update(ctx, crr)
+}
+
+// setFailed marks the CertificateRevocationRequest as permanently failed
+func (r *RevocationReconciler) setFailed(ctx context.Context, crr *externalissuerapi.CertificateRevocationRequest, message string) error {
+	log.FromContext(ctx).Info("Certificate revocation failed", "name", crr.Name, "reason", message)
+	if r.Recorder != nil {
+		r.Recorder.Event(crr, corev1.EventTypeWarning, "Failed", truncateMessage(message, maxEventMessageLength))
+	}
+	return r.setCondition(ctx, crr, metav1.ConditionFalse, "Failed", message)
+}
+
+func (r *RevocationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&externalissuerapi.CertificateRevocationRequest{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(tracedReconciler{name: "CertificateRevocationRequest", Reconciler: r})
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/exporter"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// revokeFinalizer holds CertificateRequests of issuers with revokeOnDelete
+	// until their certificate has been revoked
+	revokeFinalizer = "external-issuer.io/revoke-on-delete"
+
+	// skipRevocationAnnotation releases a deleted CertificateRequest without
+	// revoking its certificate, e.g. when the PKI is gone for good
+	skipRevocationAnnotation = "external-issuer.io/skip-revocation"
+
+	// deletionRevocationReason is the revocation reason sent for deleted certificates
+	deletionRevocationReason = "cessationOfOperation"
+)
+
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch
+
+// addRevokeFinalizer adds the revocation finalizer to a request before it is
+// signed, so the certificate can't outlive its request unrevoked
+func (r *CertificateRequestReconciler) addRevokeFinalizer(ctx context.Context, cr *cmapi.CertificateRequest, issuerSpec *externalissuerapi.ExternalIssuerSpec) error {
+	if !issuerSpec.RevokeOnDelete || controllerutil.ContainsFinalizer(cr, revokeFinalizer) {
+		return nil
+	}
+	patch := client.MergeFromWithOptions(cr.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	controllerutil.AddFinalizer(cr, revokeFinalizer)
+	if err := r.Patch(ctx, cr, patch); err != nil {
+		return fmt.Errorf("failed to add revocation finalizer: %w", err)
+	}
+	return nil
+}
+
+// finalizeRequest revokes the certificate of a deleted CertificateRequest and
+// releases it. Permanent obstacles, such as a deleted issuer, release the
+// request without revocation; failed revocations are retried.
+func (r *CertificateRequestReconciler) finalizeRequest(ctx context.Context, cr *cmapi.CertificateRequest) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(cr, revokeFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	logger := log.FromContext(ctx)
+
+	revoked, err := r.revokeDeleted(ctx, cr)
+	if err != nil {
+		var skipped *revocationSkippedError
+		if !errors.As(err, &skipped) {
+			logger.Error(err, "Failed to revoke certificate of deleted CertificateRequest", "name", cr.Name)
+			if r.Recorder != nil {
+				r.Recorder.Event(cr, corev1.EventTypeWarning, "RevocationError", truncateMessage(err.Error(), maxEventMessageLength))
+			}
+			return ctrl.Result{}, err
+		}
+		logger.Info("Releasing deleted CertificateRequest without revocation", "name", cr.Name, "reason", err.Error())
+		if r.Recorder != nil {
+			r.Recorder.Event(cr, corev1.EventTypeWarning, "RevocationSkipped", err.Error())
+		}
+	}
+	if revoked {
+		logger.Info("Revoked certificate of deleted CertificateRequest", "name", cr.Name)
+		if r.Recorder != nil {
+			r.Recorder.Event(cr, corev1.EventTypeNormal, "Revoked", "Certificate revoked on deletion")
+		}
+		r.export(ctx, cr, exporter.EventRevoked)
+	}
+
+	patch := client.MergeFromWithOptions(cr.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	controllerutil.RemoveFinalizer(cr, revokeFinalizer)
+	if err := r.Patch(ctx, cr, patch); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// revocationSkippedError reports why the certificate of a deleted request is
+// not revoked; the request is released anyway
+type revocationSkippedError struct {
+	message string
+}
+
+func (e *revocationSkippedError) Error() string {
+	return e.message
+}
+
+// revokeDeleted revokes the certificate of a deleted request if it is no
+// longer in use. It reports false without error when there is nothing to revoke.
+func (r *CertificateRequestReconciler) revokeDeleted(ctx context.Context, cr *cmapi.CertificateRequest) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	if cr.Annotations[skipRevocationAnnotation] == "true" {
+		return false, &revocationSkippedError{fmt.Sprintf("annotation %s is set", skipRevocationAnnotation)}
+	}
+	if len(cr.Status.Certificate) == 0 {
+		return false, nil
+	}
+
+	// Requests deleted while their Certificate or Secret lives on are old
+	// revisions cleaned up by cert-manager or renewals already copied into
+	// the Secret; only revoke once the owner is gone
+	if inUse, err := r.ownerExists(ctx, cr); err != nil || inUse {
+		if inUse {
+			logger.V(1).Info("Owner of deleted CertificateRequest still exists, not revoking", "name", cr.Name)
+		}
+		return false, err
+	}
+
+	issuerSpec, err := readyIssuerSpec(ctx, r.Client, cr.Spec.IssuerRef.Kind, cr.Spec.IssuerRef.Name, cr.Namespace)
+	if apierrors.IsNotFound(err) {
+		return false, &revocationSkippedError{fmt.Sprintf("%s %s no longer exists, certificate not revoked", cr.Spec.IssuerRef.Kind, cr.Spec.IssuerRef.Name)}
+	}
+	if err != nil {
+		return false, err
+	}
+	if !issuerSpec.RevokeOnDelete {
+		logger.Info("Issuer no longer has revokeOnDelete, not revoking", "name", cr.Name, "issuer", cr.Spec.IssuerRef.Name)
+		return false, nil
+	}
+
+	certs, err := parsePEMCertificates(cr.Status.Certificate)
+	if err != nil {
+		return false, &revocationSkippedError{fmt.Sprintf("certificate of the request is invalid: %v", err)}
+	}
+
+	certSigner, _, err := r.newSigner(ctx, cr, issuerSpec, cr.Spec.IssuerRef.Kind, cr.Namespace)
+	if err != nil {
+		return false, err
+	}
+	revoker, err := revokerFor(certSigner, issuerSpec)
+	if err != nil {
+		return false, &revocationSkippedError{err.Error()}
+	}
+	if _, err := revoker.Revoke(ctx, certs[0].SerialNumber, deletionRevocationReason); err != nil {
+		if errors.Is(err, signer.ErrRevocationNotConfigured) {
+			return false, &revocationSkippedError{fmt.Sprintf("issuer %s cannot revoke certificates: %v", cr.Spec.IssuerRef.Name, err)}
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ownerExists reports whether the controller owner of a request, such as its
+// cert-manager Certificate, still exists and is not being deleted
+func (r *CertificateRequestReconciler) ownerExists(ctx context.Context, cr *cmapi.CertificateRequest) (bool, error) {
+	ref := metav1.GetControllerOf(cr)
+	if ref == nil {
+		return false, nil
+	}
+
+	owner := &metav1.PartialObjectMetadata{}
+	owner.SetGroupVersionKind(schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind))
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cr.Namespace}, owner); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get owner %s %s: %w", ref.Kind, ref.Name, err)
+	}
+	// An owner recreated under the same name doesn't use this certificate
+	return owner.UID == ref.UID && owner.DeletionTimestamp.IsZero(), nil
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultTokenExpirationSeconds is the lifetime of requested ServiceAccount tokens
+const defaultTokenExpirationSeconds = 3600
+
+// ServiceAccountTokens requests bound tokens for the controller's own
+// ServiceAccount through the TokenRequest API. The external PKI validates them
+// with a TokenReview, so no static API key has to be managed. Tokens are cached
+// per audience and refreshed once 80% of their lifetime has passed.
+type ServiceAccountTokens struct {
+	client         client.Client
+	namespace      string
+	serviceAccount string
+
+	mu     sync.Mutex
+	tokens map[string]cachedServiceAccountToken
+}
+
+type cachedServiceAccountToken struct {
+	token     string
+	refreshAt time.Time
+}
+
+// NewServiceAccountTokens creates a token source for the given ServiceAccount
+func NewServiceAccountTokens(c client.Client, namespace, serviceAccount string) *ServiceAccountTokens {
+	return &ServiceAccountTokens{
+		client:         c,
+		namespace:      namespace,
+		serviceAccount: serviceAccount,
+		tokens:         map[string]cachedServiceAccountToken{},
+	}
+}
+
+// ForAudience returns a token source for one audience
+func (t *ServiceAccountTokens) ForAudience(audience string, expirationSeconds int64) signer.TokenSource {
+	if expirationSeconds <= 0 {
+		expirationSeconds = defaultTokenExpirationSeconds
+	}
+	return &audienceTokenSource{tokens: t, audience: audience, expirationSeconds: expirationSeconds}
+}
+
+type audienceTokenSource struct {
+	tokens            *ServiceAccountTokens
+	audience          string
+	expirationSeconds int64
+}
+
+func (s *audienceTokenSource) Token(ctx context.Context) (string, error) {
+	return s.tokens.token(ctx, s.audience, s.expirationSeconds)
+}
+
+// token returns a cached token for the audience or requests a new one
+func (t *ServiceAccountTokens) token(ctx context.Context, audience string, expirationSeconds int64) (string, error) {
+	key := fmt.Sprintf("%s/%d", audience, expirationSeconds)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cached, ok := t.tokens[key]; ok && time.Now().Before(cached.refreshAt) {
+		return cached.token, nil
+	}
+
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: t.serviceAccount, Namespace: t.namespace}}
+	tr := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         []string{audience},
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}
+	if err := t.client.SubResource("token").Create(ctx, sa, tr); err != nil {
+		return "", fmt.Errorf("failed to request token for ServiceAccount %s/%s: %w", t.namespace, t.serviceAccount, err)
+	}
+
+	// The API server may shorten the lifetime, so refresh relative to what was granted
+	now := time.Now()
+	lifetime := tr.Status.ExpirationTimestamp.Sub(now)
+	t.tokens[key] = cachedServiceAccountToken{token: tr.Status.Token, refreshAt: now.Add(lifetime * 4 / 5)}
+	return tr.Status.Token, nil
+}
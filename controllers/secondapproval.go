@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// secondApprovalCondition is the CertificateRequest condition a second
+// approver sets to True, or to False to deny, for requests the issuer policy
+// holds for a second approval
+const secondApprovalCondition cmapi.CertificateRequestConditionType = "SecondApproval"
+
+// checkSecondApproval holds a request matching the second approval policy
+// until its SecondApproval condition is True, and fails it when the
+// condition is False. It reports whether the request was held or failed.
+func (r *CertificateRequestReconciler) checkSecondApproval(ctx context.Context, cr *cmapi.CertificateRequest, policy *externalissuerapi.SecondApprovalPolicy) (bool, error) {
+	logger := log.FromContext(ctx)
+	reasons, err := secondApprovalReasons(cr, policy)
+	if err != nil {
+		return true, r.setFailed(ctx, cr, err.Error())
+	}
+	if len(reasons) == 0 {
+		return false, nil
+	}
+
+	switch condition := requestCondition(cr, secondApprovalCondition); {
+	case condition != nil && condition.Status == cmmeta.ConditionTrue:
+		return false, nil
+	case condition != nil && condition.Status == cmmeta.ConditionFalse:
+		message := "Second approval denied"
+		if condition.Message != "" {
+			message += ": " + condition.Message
+		}
+		logger.Info("CertificateRequest denied by second approver", "name", cr.Name, "reason", condition.Reason)
+		if r.Recorder != nil {
+			r.Recorder.Event(cr, corev1.EventTypeWarning, "SecondApprovalDenied", truncateMessage(message, maxEventMessageLength))
+		}
+		return true, r.setFailed(ctx, cr, message)
+	}
+
+	message := fmt.Sprintf("Waiting for a second approval of %s", strings.Join(reasons, ", "))
+	// Rewriting an unchanged condition would trigger another reconcile
+	if hasReadyCondition(cr, cmapi.CertificateRequestReasonPending, message) {
+		return true, nil
+	}
+	logger.Info("Issuance held for a second approval", "name", cr.Name, "reasons", reasons)
+	if r.Recorder != nil {
+		guidance := fmt.Sprintf("%s: an approver other than the one who approved the request must set its %s condition to True to issue it, or to False to deny it",
+			message, secondApprovalCondition)
+		r.Recorder.Event(cr, corev1.EventTypeWarning, "WaitingForSecondApproval", truncateMessage(guidance, maxEventMessageLength))
+	}
+	return true, r.setStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, message)
+}
+
+// secondApprovalReasons returns what makes a request need a second approval
+// under the policy, nil if nothing does
+func secondApprovalReasons(cr *cmapi.CertificateRequest, policy *externalissuerapi.SecondApprovalPolicy) ([]string, error) {
+	if policy == nil || (policy.AllowRenewals && isRenewal(cr)) {
+		return nil, nil
+	}
+	csr, err := parseCSR(cr.Spec.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	var reasons []string
+	for _, name := range csr.DNSNames {
+		name = normalizeDNSName(name)
+		switch {
+		case policy.Wildcards && strings.HasPrefix(name, "*."):
+			reasons = append(reasons, fmt.Sprintf("wildcard DNS name %q", name))
+		case inAllowedZone(name, policy.DNSDomains):
+			reasons = append(reasons, fmt.Sprintf("DNS name %q", name))
+		}
+	}
+	if policy.MinDuration != nil {
+		duration := cmapi.DefaultCertificateDuration
+		if cr.Spec.Duration != nil {
+			duration = cr.Spec.Duration.Duration
+		}
+		if duration >= policy.MinDuration.Duration {
+			reasons = append(reasons, fmt.Sprintf("a validity of %s", duration))
+		}
+	}
+	return reasons, nil
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Modes of token key autodetection for auth Secrets whose reference names no key
+const (
+	// SecretKeyAutodetectWarn tries the defaultTokenKeys and emits a
+	// deprecation event naming the key found, so users can migrate
+	SecretKeyAutodetectWarn = "warn"
+	// SecretKeyAutodetectDisabled requires authSecretRef to name the key
+	SecretKeyAutodetectDisabled = "disabled"
+)
+
+// ValidSecretKeyAutodetect reports whether mode is a known autodetection mode
+func ValidSecretKeyAutodetect(mode string) bool {
+	return mode == "" || mode == SecretKeyAutodetectWarn || mode == SecretKeyAutodetectDisabled
+}
+
+// secretKeyAutodetect reports whether token keys are guessed (default: yes, with a warning)
+func (r *CertificateRequestReconciler) secretKeyAutodetect() bool {
+	return r.SecretKeyAutodetect != SecretKeyAutodetectDisabled
+}
+
+// warnAutodetectedKey reports a token key guessed from an auth Secret on the
+// object the signer was built for, naming the key to set instead
+func (r *CertificateRequestReconciler) warnAutodetectedKey(ctx context.Context, obj client.Object, ref *externalissuerapi.AuthSecretReference, key string) {
+	message := fmt.Sprintf("Token key %q was detected in Secret %s/%s; key detection is deprecated, set authSecretRef.key: %s on the issuer", key, ref.Namespace, ref.Name, key)
+	log.FromContext(ctx).Info("Deprecated auth Secret key detection", "secret", ref.Namespace+"/"+ref.Name, "key", key)
+	if r.Recorder != nil && obj != nil {
+		r.Recorder.Event(obj, corev1.EventTypeWarning, "DeprecatedSecretKeyDetection", truncateMessage(message, maxEventMessageLength))
+	}
+}
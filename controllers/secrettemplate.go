@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// SecretTemplateReconciler copies an issuer's secretTemplate labels and
+// annotations onto the Secrets of certificates it issued. cert-manager writes
+// these Secrets from the Certificate's own secretTemplate and a
+// CertificateRequest cannot carry one, so the template is applied after
+// cert-manager has written the Secret. Only keys of the template are touched.
+type SecretTemplateReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// DisableClusterIssuers skips Secrets issued by ExternalClusterIssuers
+	DisableClusterIssuers bool
+}
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;patch
+
+func (r *SecretTemplateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, req.NamespacedName, secret); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	kind, name, ok := secretIssuer(secret)
+	if !ok || (kind == clusterIssuerKind && r.DisableClusterIssuers) {
+		return ctrl.Result{}, nil
+	}
+
+	template, err := r.issuerSecretTemplate(ctx, kind, name, secret.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if template == nil {
+		return ctrl.Result{}, nil
+	}
+
+	patch := client.MergeFrom(secret.DeepCopy())
+	labelsChanged := mergeMetadata(&secret.Labels, template.Labels)
+	annotationsChanged := mergeMetadata(&secret.Annotations, template.Annotations)
+	if !labelsChanged && !annotationsChanged {
+		return ctrl.Result{}, nil
+	}
+	if err := r.Patch(ctx, secret, patch); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to apply secret template: %w", err)
+	}
+
+	logger.Info("Applied issuer secret template", "secret", req.NamespacedName, "issuerKind", kind, "issuer", name)
+	return ctrl.Result{}, nil
+}
+
+// issuerSecretTemplate returns the secretTemplate of the issuer, nil if the
+// issuer has none or no longer exists
+func (r *SecretTemplateReconciler) issuerSecretTemplate(ctx context.Context, kind, name, namespace string) (*externalissuerapi.SecretTemplate, error) {
+	var spec externalissuerapi.ExternalIssuerSpec
+	if kind == clusterIssuerKind {
+		issuer := &externalissuerapi.ExternalClusterIssuer{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name}, issuer); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		spec = issuer.Spec
+	} else {
+		issuer := &externalissuerapi.ExternalIssuer{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, issuer); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		spec = issuer.Spec
+	}
+	return spec.SecretTemplate, nil
+}
+
+// secretIssuer returns the external issuer recorded on a certificate Secret.
+// cert-manager sets the issuer annotations on every Secret it writes; Secrets
+// renewed by the controller itself may omit the group and kind.
+func secretIssuer(secret *corev1.Secret) (kind, name string, ok bool) {
+	annotations := secret.Annotations
+	name = annotations[cmapi.IssuerNameAnnotationKey]
+	if name == "" {
+		return "", "", false
+	}
+	switch annotations[cmapi.IssuerGroupAnnotationKey] {
+	case externalIssuerAPIGroup:
+	case "":
+		if annotations[renewAnnotation] != "true" {
+			return "", "", false
+		}
+	default:
+		return "", "", false
+	}
+	kind = annotations[cmapi.IssuerKindAnnotationKey]
+	if kind == "" {
+		kind = issuerKind
+	}
+	if kind != issuerKind && kind != clusterIssuerKind {
+		return "", "", false
+	}
+	return kind, name, true
+}
+
+// mergeMetadata sets the template's entries in a label or annotation map and
+// reports whether anything changed
+func mergeMetadata(target *map[string]string, template map[string]string) bool {
+	changed := false
+	for key, value := range template {
+		if current, ok := (*target)[key]; ok && current == value {
+			continue
+		}
+		if *target == nil {
+			*target = map[string]string{}
+		}
+		(*target)[key] = value
+		changed = true
+	}
+	return changed
+}
+
+// secretsForIssuer enqueues the Secrets issued through an issuer when its
+// template may have changed
+func (r *SecretTemplateReconciler) secretsForIssuer(kind string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		secrets := &corev1.SecretList{}
+		var opts []client.ListOption
+		if kind == issuerKind {
+			opts = append(opts, client.InNamespace(obj.GetNamespace()))
+		}
+		if err := r.List(ctx, secrets, opts...); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list Secrets for issuer", "issuer", obj.GetName())
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for i := range secrets.Items {
+			secret := &secrets.Items[i]
+			if secretKind, name, ok := secretIssuer(secret); ok && secretKind == kind && name == obj.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(secret)})
+			}
+		}
+		return requests
+	}
+}
+
+func (r *SecretTemplateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named("secret-template").
+		For(&corev1.Secret{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			_, _, ok := secretIssuer(obj.(*corev1.Secret))
+			return ok
+		}))).
+		Watches(&externalissuerapi.ExternalIssuer{}, handler.EnqueueRequestsFromMapFunc(r.secretsForIssuer(issuerKind)),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	if !r.DisableClusterIssuers {
+		b = b.Watches(&externalissuerapi.ExternalClusterIssuer{}, handler.EnqueueRequestsFromMapFunc(r.secretsForIssuer(clusterIssuerKind)),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	}
+	return b.Complete(tracedReconciler{name: "SecretTemplate", Reconciler: r})
+}
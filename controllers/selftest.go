@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/audit"
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// issuerVerifiedCondition reports whether the issuer's last self-test
+	// issued a valid certificate
+	issuerVerifiedCondition = "Verified"
+
+	// selfTestAnnotation runs the self-test of an issuer whenever its value
+	// changes, e.g. to the current time
+	selfTestAnnotation = "external-issuer.io/self-test"
+
+	// defaultSelfTestCommonName is the common name of test certificates; the
+	// .invalid TLD can't name a real host
+	defaultSelfTestCommonName = "external-issuer-self-test.invalid"
+
+	// selfTestTimeout bounds a self-test signing; a shorter signingTimeout of
+	// the issuer takes precedence
+	selfTestTimeout = 30 * time.Second
+
+	// selfTestValidity is requested for test certificates, the shortest
+	// validity signers take
+	selfTestValidity = 24 * time.Hour
+
+	selfTestPassedReason  = "SelfTestPassed"
+	selfTestFailedReason  = "SelfTestFailed"
+	selfTestPendingReason = "Pending"
+)
+
+// SelfTestReconciler issues a throwaway certificate through the signer of
+// issuers that ask for it, with spec.selfTest or the self-test annotation,
+// and records in the Verified condition whether it worked. Health checks only
+// prove the PKI answers; the self-test proves it signs.
+//
+// The test certificate is not stored, and its key is discarded right away.
+type SelfTestReconciler struct {
+	// Requests builds the issuer's signer with the credential sources of
+	// issuance and records the test issuance in the audit trail
+	Requests *CertificateRequestReconciler
+
+	// Kind is the kind of issuer reconciled, ExternalIssuer or ExternalClusterIssuer
+	Kind string
+}
+
+// +kubebuilder:rbac:groups=external-issuer.io,resources=externalissuers;externalclusterissuers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=external-issuer.io,resources=externalissuers/status;externalclusterissuers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+func (r *SelfTestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	issuer := issuerRef(r.Kind, req.Namespace, req.Name)
+	if err := r.Requests.Get(ctx, req.NamespacedName, issuer); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	spec, status := issuerSpecOf(issuer), issuerStatus(issuer)
+	trigger := issuer.GetAnnotations()[selfTestAnnotation]
+	if spec.Paused || (spec.SelfTest == nil && !triggered(trigger, status.SelfTest)) {
+		return ctrl.Result{}, nil
+	}
+	// Issuers that aren't ready fail their health check already; the test
+	// runs once they are, as the Ready condition update requeues them
+	if !isIssuerReady(status.Conditions) {
+		return ctrl.Result{}, nil
+	}
+
+	now := clockOrReal(r.Requests.Clock).Now()
+	if due, wait := selfTestDue(issuer.GetGeneration(), spec, status, trigger, now); !due {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	logger.Info("Running issuer self-test", "kind", r.Kind, "name", req.Name, "namespace", req.Namespace)
+	condition, serial := r.selfTest(ctx, issuer, spec)
+	condition.Type = issuerVerifiedCondition
+	condition.ObservedGeneration = issuer.GetGeneration()
+	condition.LastTransitionTime = metav1.NewTime(now)
+
+	if r.Requests.Recorder != nil {
+		eventType := corev1.EventTypeNormal
+		if condition.Status != metav1.ConditionTrue {
+			eventType = corev1.EventTypeWarning
+		}
+		r.Requests.Recorder.Event(issuer, eventType, condition.Reason, truncateMessage(condition.Message, maxEventMessageLength))
+	}
+
+	if err := r.setSelfTestStatus(ctx, issuer, func(status *externalissuerapi.ExternalIssuerStatus) {
+		meta.SetStatusCondition(&status.Conditions, condition)
+		status.SelfTest = &externalissuerapi.SelfTestStatus{
+			LastRunTime:  metav1.NewTime(now),
+			Trigger:      trigger,
+			SerialNumber: serial,
+		}
+	}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if condition.Reason == selfTestPendingReason {
+		return ctrl.Result{RequeueAfter: selfTestRetryDelay(spec)}, nil
+	}
+	if spec.SelfTest != nil && spec.SelfTest.Interval != nil {
+		return ctrl.Result{RequeueAfter: spec.SelfTest.Interval.Duration}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// triggered reports whether the self-test annotation asks for a run that
+// hasn't happened yet
+func triggered(trigger string, last *externalissuerapi.SelfTestStatus) bool {
+	return trigger != "" && (last == nil || last.Trigger != trigger)
+}
+
+// selfTestDue reports whether an issuer's self-test should run now, and
+// otherwise how long until it is due
+func selfTestDue(generation int64, spec *externalissuerapi.ExternalIssuerSpec, status *externalissuerapi.ExternalIssuerStatus, trigger string, now time.Time) (bool, time.Duration) {
+	if triggered(trigger, status.SelfTest) || status.SelfTest == nil {
+		return true, 0
+	}
+	verified := meta.FindStatusCondition(status.Conditions, issuerVerifiedCondition)
+	if verified == nil || verified.ObservedGeneration != generation {
+		return true, 0
+	}
+	interval := selfTestRetryDelay(spec)
+	if verified.Reason != selfTestPendingReason {
+		if spec.SelfTest == nil || spec.SelfTest.Interval == nil {
+			return false, 0
+		}
+		interval = spec.SelfTest.Interval.Duration
+	}
+	if wait := status.SelfTest.LastRunTime.Add(interval).Sub(now); wait > 0 {
+		return false, wait
+	}
+	return true, 0
+}
+
+// selfTestRetryDelay is how long after a self-test the PKI answered with a
+// pending order it is run again
+func selfTestRetryDelay(spec *externalissuerapi.ExternalIssuerSpec) time.Duration {
+	if spec.SelfTest != nil && spec.SelfTest.Interval != nil {
+		return spec.SelfTest.Interval.Duration
+	}
+	return issuerRecheckInterval
+}
+
+// selfTest issues a test certificate and returns the resulting Verified
+// condition and the serial number of the certificate, if one was issued
+func (r *SelfTestReconciler) selfTest(ctx context.Context, issuer client.Object, spec *externalissuerapi.ExternalIssuerSpec) (metav1.Condition, string) {
+	failed := func(format string, args ...interface{}) metav1.Condition {
+		return metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  selfTestFailedReason,
+			Message: summarizeMessage(fmt.Sprintf(format, args...)),
+		}
+	}
+
+	commonName, dnsNames := defaultSelfTestCommonName, []string(nil)
+	if spec.SelfTest != nil {
+		if spec.SelfTest.CommonName != "" {
+			commonName = spec.SelfTest.CommonName
+		}
+		dnsNames = spec.SelfTest.DNSNames
+	}
+	if len(dnsNames) == 0 {
+		dnsNames = []string{commonName}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return failed("failed to generate the test key: %v", err), ""
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: dnsNames,
+	}, key)
+	if err != nil {
+		return failed("failed to create the test CSR: %v", err), ""
+	}
+
+	// The test issuance is audited like a request of the issuer
+	cr := &cmapi.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "self-test:" + issuer.GetName(), Namespace: issuer.GetNamespace()},
+		Spec: cmapi.CertificateRequestSpec{
+			Request:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+			IssuerRef: cmmeta.ObjectReference{Kind: r.Kind, Name: issuer.GetName()},
+			Duration:  &metav1.Duration{Duration: selfTestValidity},
+		},
+	}
+
+	certSigner, _, err := r.Requests.newSigner(ctx, issuer, spec, r.Kind, issuer.GetNamespace())
+	if err != nil {
+		return failed("failed to create the signer: %v", err), ""
+	}
+	if override := subjectOverride(spec.Subject); override != nil {
+		if setter, ok := certSigner.(subjectSetter); ok {
+			setter.SetSubject(override)
+		}
+	}
+
+	signCtx, cancel := signingContext(ctx, spec)
+	defer cancel()
+	if _, bounded := signCtx.Deadline(); !bounded {
+		signCtx, cancel = context.WithTimeout(signCtx, selfTestTimeout)
+		defer cancel()
+	}
+	certPEM, caPEM, err := certSigner.Sign(signCtx, cr.Spec.Request, validityDays(selfTestValidity))
+	var pending *signer.PendingError
+	if errors.As(err, &pending) {
+		// The order is left to the PKI; asynchronous PKIs are verified once
+		// they sign right away, e.g. for test names approved automatically
+		return metav1.Condition{
+			Status:  metav1.ConditionUnknown,
+			Reason:  selfTestPendingReason,
+			Message: fmt.Sprintf("The PKI accepted the test request as order %s but didn't sign it right away", pending.OrderID),
+		}, ""
+	}
+	if err != nil {
+		r.Requests.audit(ctx, cr, audit.ResultFailed, err.Error())
+		return failed("test signing failed: %v", err), ""
+	}
+
+	cert, err := verifySelfTestCertificate(certPEM, caPEM, &key.PublicKey, dnsNames, clockOrReal(r.Requests.Clock).Now())
+	serial := ""
+	if cert != nil {
+		serial = formatSerial(cert.SerialNumber)
+	}
+	if err != nil {
+		r.Requests.audit(ctx, cr, audit.ResultFailed, err.Error())
+		return failed("test certificate is invalid: %v", err), serial
+	}
+	cr.Status.Certificate = certPEM
+	r.Requests.audit(ctx, cr, audit.ResultIssued, "")
+	return metav1.Condition{
+		Status:  metav1.ConditionTrue,
+		Reason:  selfTestPassedReason,
+		Message: fmt.Sprintf("Issued a valid test certificate for %s (serial %s)", commonName, serial),
+	}, serial
+}
+
+// verifySelfTestCertificate checks that a test certificate is for the test
+// key and names, is valid now and chains to the returned CA, if any. The
+// certificate is returned once it parses.
+func verifySelfTestCertificate(certPEM, caPEM []byte, key *ecdsa.PublicKey, dnsNames []string, now time.Time) (*x509.Certificate, error) {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	if !key.Equal(cert.PublicKey) {
+		return cert, errors.New("the certificate is not for the test key")
+	}
+	for _, name := range dnsNames {
+		if !slices.Contains(cert.DNSNames, name) {
+			return cert, fmt.Errorf("the certificate lacks the DNS name %s", name)
+		}
+	}
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return cert, fmt.Errorf("the certificate is valid from %s to %s, not now", cert.NotBefore.UTC().Format(time.RFC3339), cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	// The CA may come with the certificate, in the chain of certPEM, or in caPEM
+	var chain []*x509.Certificate
+	for _, bundle := range [][]byte{certPEM, caPEM} {
+		for block, rest := pem.Decode(bundle); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			ca, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return cert, fmt.Errorf("failed to parse the CA chain: %w", err)
+			}
+			if !bytes.Equal(ca.Raw, cert.Raw) {
+				chain = append(chain, ca)
+			}
+		}
+	}
+	if len(chain) == 0 {
+		return cert, nil
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	roots.AddCert(chain[len(chain)-1])
+	for _, ca := range chain[:len(chain)-1] {
+		intermediates.AddCert(ca)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return cert, fmt.Errorf("the certificate doesn't chain to the returned CA: %w", err)
+	}
+	return cert, nil
+}
+
+// setSelfTestStatus applies mutate to the status of an issuer, patched
+// against the version it was read at and reapplied to the latest version on
+// conflicts, so the test isn't run again for a lost write
+func (r *SelfTestReconciler) setSelfTestStatus(ctx context.Context, issuer client.Object, mutate func(*externalissuerapi.ExternalIssuerStatus)) error {
+	key := client.ObjectKeyFromObject(issuer)
+	first := true
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			// Retries read past the cache, which lags behind the conflicting write
+			if err := r.Requests.apiReader().Get(ctx, key, issuer); err != nil {
+				return err
+			}
+		}
+		first = false
+		patch := client.MergeFromWithOptions(issuer.DeepCopyObject().(client.Object), client.MergeFromWithOptimisticLock{})
+		mutate(issuerStatus(issuer))
+		return r.Requests.Status().Patch(ctx, issuer, patch)
+	})
+	return client.IgnoreNotFound(err)
+}
+
+// issuerSpecOf returns the spec of an ExternalIssuer or ExternalClusterIssuer
+func issuerSpecOf(issuer client.Object) *externalissuerapi.ExternalIssuerSpec {
+	if clusterIssuer, ok := issuer.(*externalissuerapi.ExternalClusterIssuer); ok {
+		return &clusterIssuer.Spec
+	}
+	return &issuer.(*externalissuerapi.ExternalIssuer).Spec
+}
+
+func (r *SelfTestReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	name := "SelfTest" + r.Kind
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		For(issuerRef(r.Kind, "", "")).
+		Complete(tracedReconciler{name: name, Reconciler: r})
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"context"
+	"time"
+)
+
+// defaultDrainTimeout bounds an in-flight signing when no drain timeout is configured
+const defaultDrainTimeout = 20 * time.Second
+
+// issuanceContext returns the context for the critical section between sending
+// a request to the PKI and recording its outcome on the CertificateRequest.
+//
+// The reconcile context is cancelled as soon as the manager begins shutting
+// down. Aborting there would drop a certificate the CA already issued and sign
+// the request again on the next controller instance, so the critical section
+// is detached from cancellation. Only once the reconcile context is cancelled
+// does the drain timeout start; until then signing takes as long as it needs.
+func (r *CertificateRequestReconciler) issuanceContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	issueCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	drainTimeout := r.drainTimeout()
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(drainTimeout)
+		defer timer.Stop()
+		select {
+		case <-issueCtx.Done():
+		case <-timer.C:
+			cancel()
+		}
+	})
+	return issueCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// drainTimeout returns the configured drain timeout or the default
+func (r *CertificateRequestReconciler) drainTimeout() time.Duration {
+	if r.DrainTimeout <= 0 {
+		return defaultDrainTimeout
+	}
+	return r.DrainTimeout
+}
+
+// shuttingDown reports whether the manager stopped accepting new work. Requests
+// not yet sent to the PKI are left to the next controller instance.
+func shuttingDown(ctx context.Context) bool {
+	return ctx.Err() != nil
+}
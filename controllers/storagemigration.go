@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// migrationPageSize is the number of objects listed per request
+	migrationPageSize = 500
+
+	minMigrationRetryDelay = 5 * time.Second
+	maxMigrationRetryDelay = 5 * time.Minute
+)
+
+// StorageVersionCRDs are the CRDs of this controller whose stored objects are
+// migrated to the current storage version
+var StorageVersionCRDs = []string{
+	"externalissuers.external-issuer.io",
+	"externalclusterissuers.external-issuer.io",
+	"pkiprofiles.external-issuer.io",
+	"certificaterevocationrequests.external-issuer.io",
+	"externalissuerreports.external-issuer.io",
+}
+
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=update
+// +kubebuilder:rbac:groups=external-issuer.io,resources=pkiprofiles;certificaterevocationrequests;externalissuerreports,verbs=patch
+
+// StorageVersionMigrator rewrites objects still stored in an older API version
+// once a new storage version is rolled out, e.g. after moving from v1alpha1
+// to v1beta1, and then drops the old version from the CRD's storedVersions.
+// The old version can then be removed from the CRD, so the conversion webhook
+// isn't needed forever to read objects written before the upgrade.
+//
+// Objects are rewritten with an empty patch, which the API server stores in
+// the current storage version. It implements manager.Runnable and runs on the
+// leader only.
+type StorageVersionMigrator struct {
+	// Client writes objects and CRD status
+	Client client.Client
+	// APIReader reads CRDs and lists objects from the API server, bypassing the cache
+	APIReader client.Reader
+	// CRDs are the names of the CRDs to migrate (default: StorageVersionCRDs)
+	CRDs []string
+}
+
+// NeedLeaderElection makes only the leader migrate objects
+func (m *StorageVersionMigrator) NeedLeaderElection() bool {
+	return true
+}
+
+// Start migrates every CRD, retrying failures with backoff until they succeed
+// or ctx is cancelled. Migration never stops the manager.
+func (m *StorageVersionMigrator) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("storage-version-migrator")
+	ctx = log.IntoContext(ctx, logger)
+
+	crds := m.CRDs
+	if len(crds) == 0 {
+		crds = StorageVersionCRDs
+	}
+	for _, name := range crds {
+		delay := minMigrationRetryDelay
+		for {
+			err := m.migrate(ctx, name)
+			if err == nil {
+				break
+			}
+			if apierrors.IsForbidden(err) {
+				logger.Error(err, "Not allowed to migrate stored objects, giving up", "crd", name)
+				break
+			}
+			logger.Error(err, "Failed to migrate stored objects, retrying", "crd", name, "retryAfter", delay)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxMigrationRetryDelay)
+		}
+	}
+	return nil
+}
+
+// migrate rewrites the objects of one CRD if its storedVersions include
+// versions other than the storage version
+func (m *StorageVersionMigrator) migrate(ctx context.Context, name string) error {
+	logger := log.FromContext(ctx).WithValues("crd", name)
+
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := m.APIReader.Get(ctx, types.NamespacedName{Name: name}, crd); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.V(1).Info("CRD not installed, nothing to migrate")
+			return nil
+		}
+		return fmt.Errorf("failed to get CRD: %w", err)
+	}
+
+	storageVersion := ""
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			storageVersion = v.Name
+		}
+	}
+	if storageVersion == "" {
+		return fmt.Errorf("CRD %s has no storage version", name)
+	}
+	var stale []string
+	for _, v := range crd.Status.StoredVersions {
+		if v != storageVersion {
+			stale = append(stale, v)
+		}
+	}
+	if len(stale) == 0 {
+		logger.V(1).Info("Stored objects are up to date", "storageVersion", storageVersion)
+		return nil
+	}
+
+	logger.Info("Migrating stored objects", "from", stale, "to", storageVersion)
+	gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: storageVersion, Kind: crd.Spec.Names.Kind}
+	migrated, err := m.rewriteAll(ctx, gvk, crd.Spec.Names.ListKind)
+	if err != nil {
+		return err
+	}
+
+	// Objects created meanwhile were written in the storage version. The
+	// update fails on a conflict if the CRD changed, e.g. to yet another
+	// storage version, and the migration is repeated.
+	crd.Status.StoredVersions = []string{storageVersion}
+	if err := m.Client.Status().Update(ctx, crd); err != nil {
+		return fmt.Errorf("failed to update storedVersions: %w", err)
+	}
+	logger.Info("Migrated stored objects", "objects", migrated, "storageVersion", storageVersion)
+	return nil
+}
+
+// rewriteAll rewrites every object of a kind in the storage version
+func (m *StorageVersionMigrator) rewriteAll(ctx context.Context, gvk schema.GroupVersionKind, listKind string) (int, error) {
+	migrated := 0
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(listKind))
+	for {
+		if err := m.APIReader.List(ctx, list, client.Limit(migrationPageSize), client.Continue(list.GetContinue())); err != nil {
+			return migrated, fmt.Errorf("failed to list %s: %w", gvk.Kind, err)
+		}
+		for i := range list.Items {
+			item := &list.Items[i]
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(gvk)
+			obj.SetName(item.GetName())
+			obj.SetNamespace(item.GetNamespace())
+			if err := m.Client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, []byte("{}"))); err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return migrated, fmt.Errorf("failed to rewrite %s %s: %w", gvk.Kind, client.ObjectKeyFromObject(item), err)
+			}
+			migrated++
+		}
+		if list.GetContinue() == "" {
+			return migrated, nil
+		}
+	}
+}
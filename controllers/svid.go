@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+)
+
+const (
+	// issuerModeSVID issues SPIFFE X.509-SVIDs
+	issuerModeSVID = "spiffe-svid"
+
+	// maxSPIFFEIDLength is the longest SPIFFE ID the SPIFFE-ID specification allows
+	maxSPIFFEIDLength = 2048
+)
+
+// svidRequester is implemented by signers that can issue SPIFFE X.509-SVIDs
+type svidRequester interface {
+	RequestSVID() error
+}
+
+// checkSVID rejects a request to an issuer in spiffe-svid mode that isn't a
+// valid X.509-SVID request: it must carry exactly one URI SAN, a well-formed
+// SPIFFE ID in a trust domain allowed by the issuer's SPIFFE policy, and must
+// not ask for a CA certificate. Unlike the policy, it is enforced in Audit
+// mode as well.
+func checkSVID(cr *cmapi.CertificateRequest, spec *externalissuerapi.ExternalIssuerSpec) error {
+	if spec.Mode != issuerModeSVID {
+		return nil
+	}
+	csr, err := parseCSR(cr.Spec.Request)
+	if err != nil {
+		return &policyViolationError{violations: []string{err.Error()}}
+	}
+
+	var violations []string
+	if cr.Spec.IsCA {
+		violations = append(violations, "X.509-SVIDs cannot be CA certificates")
+	}
+	switch len(csr.URIs) {
+	case 1:
+		id := csr.URIs[0]
+		if err := validateSPIFFEID(id); err != nil {
+			violations = append(violations, err.Error())
+		} else if domains := spiffeTrustDomains(spec.Policy.SPIFFE); !slices.Contains(domains, id.Host) {
+			violations = append(violations, fmt.Sprintf("SPIFFE ID %q is not in an allowed trust domain %q", id.String(), domains))
+		}
+	case 0:
+		violations = append(violations, "an X.509-SVID request needs a SPIFFE ID URI SAN")
+	default:
+		violations = append(violations, fmt.Sprintf("an X.509-SVID request must carry exactly one URI SAN, got %d", len(csr.URIs)))
+	}
+
+	if len(violations) > 0 {
+		return &policyViolationError{violations: violations}
+	}
+	return nil
+}
+
+// spiffeTrustDomains returns the trust domains a SPIFFE policy allows
+func spiffeTrustDomains(policy *externalissuerapi.SPIFFEPolicy) []string {
+	if policy == nil {
+		return nil
+	}
+	var domains []string
+	if policy.TrustDomain != "" {
+		domains = append(domains, policy.TrustDomain)
+	}
+	return append(domains, policy.TrustDomains...)
+}
+
+// validateSPIFFEID checks a URI against the SPIFFE-ID specification: scheme
+// spiffe, a lowercase trust domain without port or user info, and a path of
+// non-empty segments of letters, digits, dots, dashes and underscores, without
+// query or fragment
+func validateSPIFFEID(id *url.URL) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("URI SAN %q is not a valid SPIFFE ID: %s", id.String(), reason)
+	}
+	switch {
+	case id.Scheme != "spiffe":
+		return invalid("scheme must be spiffe")
+	case len(id.String()) > maxSPIFFEIDLength:
+		return invalid(fmt.Sprintf("longer than %d characters", maxSPIFFEIDLength))
+	case id.User != nil || id.Port() != "":
+		return invalid("trust domain must not carry user info or a port")
+	case id.RawQuery != "" || id.Fragment != "" || id.ForceQuery:
+		return invalid("must not have a query or fragment")
+	}
+	if id.Host == "" {
+		return invalid("trust domain is missing")
+	}
+	for _, c := range id.Host {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return invalid("trust domain may only contain lowercase letters, digits, dots, dashes and underscores")
+		}
+	}
+	if id.Path == "" {
+		return nil
+	}
+	for _, segment := range strings.Split(strings.TrimPrefix(id.Path, "/"), "/") {
+		switch segment {
+		case "":
+			return invalid("path segments must not be empty")
+		case ".", "..":
+			return invalid("path segments must not be . or ..")
+		}
+		for _, c := range segment {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+				return invalid("path may only contain letters, digits, dots, dashes and underscores")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// signingTimeoutReason is the condition reason of requests whose signing
+// exceeded the issuer's signingTimeout
+const signingTimeoutReason = "SigningTimeout"
+
+// signingContext bounds a signing or poll by the issuer's signingTimeout, if set
+func signingContext(ctx context.Context, issuerSpec *externalissuerapi.ExternalIssuerSpec) (context.Context, context.CancelFunc) {
+	if issuerSpec.SigningTimeout == nil || issuerSpec.SigningTimeout.Duration <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, issuerSpec.SigningTimeout.Duration)
+}
+
+// signingTimedOut reports whether a signing or poll failed because the
+// signingTimeout of signCtx passed, rather than its parent ctx ending
+func signingTimedOut(ctx, signCtx context.Context, err error) bool {
+	return err != nil && ctx.Err() == nil && errors.Is(signCtx.Err(), context.DeadlineExceeded)
+}
+
+// signingTimeout reports a request whose signing exceeded the issuer's
+// signingTimeout. The PKI may still issue the certificate, so the signing
+// attempt is kept and the request is handled like any attempt whose result
+// was lost.
+func (r *CertificateRequestReconciler) signingTimeout(ctx context.Context, cr *cmapi.CertificateRequest, signerType string, timeout time.Duration) (ctrl.Result, error) {
+	message := fmt.Sprintf("Signing did not finish within the issuer's signingTimeout of %s; "+
+		"the PKI may still issue the certificate, so the request is not signed again automatically", timeout)
+	r.issuanceEvent(cr, corev1.EventTypeWarning, signingTimeoutReason, signerType, message)
+	if err := r.setStatus(ctx, cr, cmmeta.ConditionFalse, signingTimeoutReason, message); err != nil {
+		return ctrl.Result{}, err
+	}
+	result, _, err := r.checkSignAttempt(ctx, cr)
+	return result, err
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSigningTimeoutKeepsAttempt(t *testing.T) {
+	// The PKI takes longer than the signingTimeout and may issue the
+	// certificate after the controller gave up waiting
+	pki := &fakePKI{}
+	pki.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			// Health checks
+			return
+		}
+		pki.mu.Lock()
+		pki.submits++
+		pki.mu.Unlock()
+		<-req.Context().Done()
+	}))
+	t.Cleanup(pki.Close)
+	c := newCluster(t, pki)
+
+	issuer := &externalissuerapi.ExternalIssuer{}
+	if err := c.client.Get(context.Background(), types.NamespacedName{Namespace: testNamespace, Name: "pki"}, issuer); err != nil {
+		t.Fatal(err)
+	}
+	issuer.Spec.SigningTimeout = &metav1.Duration{Duration: 50 * time.Millisecond}
+	if err := c.client.Update(context.Background(), issuer); err != nil {
+		t.Fatal(err)
+	}
+
+	r := c.instance(nil)
+	result, _ := c.reconcile(r)
+	if reason := c.readyReason(); reason != signingTimeoutReason {
+		t.Fatalf("Ready reason %q, want %s", reason, signingTimeoutReason)
+	}
+	if _, ok := c.request().Annotations[signAttemptAnnotation]; !ok || result.RequeueAfter <= 0 {
+		t.Fatalf("want the signing attempt kept and waited for, got annotations %v and %+v", c.request().Annotations, result)
+	}
+
+	// Once the attempt could have finished, the request is left to a human
+	c.clock.Step(result.RequeueAfter)
+	c.reconcile(r)
+	if submits, _ := pki.counts(); submits != 1 {
+		t.Fatalf("CSR submitted %d times, want 1", submits)
+	}
+	if reason := c.readyReason(); reason != cmapi.CertificateRequestReasonPending {
+		t.Errorf("Ready reason %q, want %s", reason, cmapi.CertificateRequestReasonPending)
+	}
+}
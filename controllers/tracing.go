@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// tracedReconciler starts a span around every reconcile so that Kubernetes API
+// and PKI calls made during it are grouped into one trace
+type tracedReconciler struct {
+	name string
+	reconcile.Reconciler
+}
+
+func (t tracedReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := tracing.Tracer().Start(ctx, t.name+".Reconcile", trace.WithAttributes(
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("k8s.object.name", req.Name),
+	))
+	defer span.End()
+
+	result, err := t.Reconciler.Reconcile(ctx, req)
+	tracing.RecordError(span, err)
+	if result.RequeueAfter > 0 {
+		span.SetAttributes(attribute.String("reconcile.requeue_after", result.RequeueAfter.String()))
+	}
+	return result, err
+}
+
+// WithTracing wraps a Kubernetes client so every API call gets a span,
+// separating Kubernetes API time from external CA time in issuance traces
+func WithTracing(c client.Client) client.Client {
+	return &tracingClient{Client: c}
+}
+
+type tracingClient struct {
+	client.Client
+}
+
+// startSpan starts a client span for a Kubernetes API operation
+func (c *tracingClient) startSpan(ctx context.Context, op string, obj client.Object) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("k8s.operation", op)}
+	if obj != nil {
+		if gvk, err := c.GroupVersionKindFor(obj); err == nil {
+			attrs = append(attrs, attribute.String("k8s.kind", gvk.Kind))
+		}
+		attrs = append(attrs,
+			attribute.String("k8s.namespace.name", obj.GetNamespace()),
+			attribute.String("k8s.object.name", obj.GetName()),
+		)
+	}
+	return tracing.Tracer().Start(ctx, "k8s."+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func (c *tracingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	ctx, span := c.startSpan(ctx, "Get", nil)
+	defer span.End()
+	span.SetAttributes(attribute.String("k8s.namespace.name", key.Namespace), attribute.String("k8s.object.name", key.Name))
+	if gvk, err := c.GroupVersionKindFor(obj); err == nil {
+		span.SetAttributes(attribute.String("k8s.kind", gvk.Kind))
+	}
+	err := c.Client.Get(ctx, key, obj, opts...)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (c *tracingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	ctx, span := c.startSpan(ctx, "List", nil)
+	defer span.End()
+	err := c.Client.List(ctx, list, opts...)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (c *tracingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	ctx, span := c.startSpan(ctx, "Create", obj)
+	defer span.End()
+	err := c.Client.Create(ctx, obj, opts...)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (c *tracingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	ctx, span := c.startSpan(ctx, "Update", obj)
+	defer span.End()
+	err := c.Client.Update(ctx, obj, opts...)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (c *tracingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	ctx, span := c.startSpan(ctx, "Patch", obj)
+	defer span.End()
+	err := c.Client.Patch(ctx, obj, patch, opts...)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (c *tracingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	ctx, span := c.startSpan(ctx, "Delete", obj)
+	defer span.End()
+	err := c.Client.Delete(ctx, obj, opts...)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (c *tracingClient) Status() client.SubResourceWriter {
+	return &tracingStatusWriter{SubResourceWriter: c.Client.Status(), client: c}
+}
+
+type tracingStatusWriter struct {
+	client.SubResourceWriter
+	client *tracingClient
+}
+
+func (w *tracingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	ctx, span := w.client.startSpan(ctx, "UpdateStatus", obj)
+	defer span.End()
+	err := w.SubResourceWriter.Update(ctx, obj, opts...)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (w *tracingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	ctx, span := w.client.startSpan(ctx, "PatchStatus", obj)
+	defer span.End()
+	err := w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+	tracing.RecordError(span, err)
+	return err
+}
+
+// checkSignerHealth runs a signer health check inside its own span
+func checkSignerHealth(ctx context.Context, s Signer, signerType string) error {
+	ctx, span := tracing.Tracer().Start(ctx, "Signer.CheckHealth", trace.WithAttributes(attribute.String("signer.type", signerType)))
+	defer span.End()
+	err := s.CheckHealth(ctx)
+	tracing.RecordError(span, err)
+	return err
+}
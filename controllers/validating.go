@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/pkg/signer/configbuilder"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:path=/validate-external-issuer-io-v1alpha1-pkiprofile,mutating=false,failurePolicy=fail,sideEffects=None,groups=external-issuer.io,resources=pkiprofiles,verbs=create;update,versions=v1alpha1,name=vpkiprofile.external-issuer.io,admissionReviewVersions=v1
+
+// ConfigValidator rejects PKIProfiles whose PKI configuration the controller
+// would refuse to load, with the checks of configbuilder.Validate, so invalid
+// configurations fail when they are applied instead of when an issuer uses
+// them
+type ConfigValidator struct{}
+
+// SetupWebhookWithManager registers the validating webhook of PKIProfiles
+func (v *ConfigValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&externalissuerapi.PKIProfile{}).WithValidator(v).Complete()
+}
+
+// ValidateCreate validates the configuration of a new PKIProfile
+func (v *ConfigValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, validatePKIProfile(obj)
+}
+
+// ValidateUpdate validates the configuration of an updated PKIProfile
+func (v *ConfigValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	return nil, validatePKIProfile(newObj)
+}
+
+// ValidateDelete allows deleting any PKIProfile
+func (v *ConfigValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validatePKIProfile parses the configuration of a PKIProfile like the
+// controller does when an issuer references it
+func validatePKIProfile(obj runtime.Object) error {
+	profile, ok := obj.(*externalissuerapi.PKIProfile)
+	if !ok {
+		return fmt.Errorf("unexpected object %T", obj)
+	}
+	if len(profile.Spec.Config.Raw) == 0 {
+		return fmt.Errorf("spec.config: PKIProfile %s has no config", profile.Name)
+	}
+	if _, err := configbuilder.Parse(profile.Spec.Config.Raw); err != nil {
+		return fmt.Errorf("%w in spec.config: %w", errInvalidPKIConfig, err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestConfigValidator(t *testing.T) {
+	profile := func(config string) *externalissuerapi.PKIProfile {
+		return &externalissuerapi.PKIProfile{
+			ObjectMeta: metav1.ObjectMeta{Name: "corp-pki"},
+			Spec:       externalissuerapi.PKIProfileSpec{Config: runtime.RawExtension{Raw: []byte(config)}},
+		}
+	}
+	v := &ConfigValidator{}
+	ctx := context.Background()
+
+	valid := profile(`{"baseUrl": "https://pki.example.com/sign", "response": {"format": "pem"}}`)
+	if _, err := v.ValidateCreate(ctx, valid); err != nil {
+		t.Errorf("valid profile rejected: %v", err)
+	}
+
+	for name, config := range map[string]string{
+		"unknown field": `{"baseUrl": "https://pki.example.com/sign", "reponse": {}}`,
+		"invalid value": `{"baseUrl": "https://pki.example.com/sign", "response": {"format": "der"}}`,
+		"empty":         ``,
+	} {
+		if _, err := v.ValidateCreate(ctx, profile(config)); err == nil || !strings.Contains(err.Error(), "spec.config") {
+			t.Errorf("%s: created profile returned %v, want a spec.config error", name, err)
+		}
+		if _, err := v.ValidateUpdate(ctx, valid, profile(config)); err == nil {
+			t.Errorf("%s: updated profile accepted", name)
+		}
+	}
+	if _, err := v.ValidateDelete(ctx, profile(`{}`)); err != nil {
+		t.Errorf("deleting an invalid profile rejected: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reservedConditionTypes are the CertificateRequest conditions set by
+// cert-manager, its approvers and this controller, which validators cannot use
+var reservedConditionTypes = []cmapi.CertificateRequestConditionType{
+	cmapi.CertificateRequestConditionReady,
+	cmapi.CertificateRequestConditionInvalidRequest,
+	cmapi.CertificateRequestConditionApproved,
+	cmapi.CertificateRequestConditionDenied,
+	secondApprovalCondition,
+}
+
+// checkValidators holds a request until the conditions of the issuer's
+// external validators are all True, and fails it when one is False or a
+// validator timed out. It reports whether the request was held or failed;
+// held requests are looked at again when the next validator times out.
+func (r *CertificateRequestReconciler) checkValidators(ctx context.Context, cr *cmapi.CertificateRequest, validators []externalissuerapi.ExternalValidator) (ctrl.Result, bool, error) {
+	if len(validators) == 0 {
+		return ctrl.Result{}, false, nil
+	}
+	logger := log.FromContext(ctx)
+	now := clockOrReal(r.Clock).Now()
+
+	var waiting []string
+	var result ctrl.Result
+	for _, v := range validators {
+		conditionType := cmapi.CertificateRequestConditionType(v.ConditionType)
+		if v.ConditionType == "" || slices.Contains(reservedConditionTypes, conditionType) {
+			err := fmt.Errorf("invalid validator condition type %q: must be set and not one of %v", v.ConditionType, reservedConditionTypes)
+			logger.Error(err, "Invalid validator policy")
+			return ctrl.Result{}, true, r.setStatus(ctx, cr, cmmeta.ConditionFalse, "ConfigError", err.Error())
+		}
+
+		condition := requestCondition(cr, conditionType)
+		switch {
+		case condition != nil && condition.Status == cmmeta.ConditionTrue:
+			continue
+		case condition != nil && condition.Status == cmmeta.ConditionFalse:
+			message := fmt.Sprintf("Validation %s failed", v.ConditionType)
+			if condition.Message != "" {
+				message += ": " + condition.Message
+			}
+			return ctrl.Result{}, true, r.failValidation(ctx, cr, "ValidationFailed", message)
+		}
+
+		if v.Timeout != nil {
+			deadline := cr.CreationTimestamp.Add(v.Timeout.Duration)
+			if !now.Before(deadline) {
+				message := fmt.Sprintf("Validation %s was not completed within %s", v.ConditionType, v.Timeout.Duration)
+				return ctrl.Result{}, true, r.failValidation(ctx, cr, "ValidationTimedOut", message)
+			}
+			if wait := deadline.Sub(now); result.RequeueAfter == 0 || wait < result.RequeueAfter {
+				result.RequeueAfter = wait
+			}
+		}
+		waiting = append(waiting, v.ConditionType)
+	}
+	if len(waiting) == 0 {
+		return ctrl.Result{}, false, nil
+	}
+
+	message := fmt.Sprintf("Waiting for validation: %s", strings.Join(waiting, ", "))
+	// Rewriting an unchanged condition would trigger another reconcile
+	if hasReadyCondition(cr, cmapi.CertificateRequestReasonPending, message) {
+		return result, true, nil
+	}
+	logger.Info("Issuance held for external validation", "name", cr.Name, "conditions", waiting)
+	if r.Recorder != nil {
+		guidance := fmt.Sprintf("%s; the request is signed once the external validators set these conditions to True", message)
+		r.Recorder.Event(cr, corev1.EventTypeNormal, "WaitingForValidation", truncateMessage(guidance, maxEventMessageLength))
+	}
+	return result, true, r.setStatus(ctx, cr, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, message)
+}
+
+// failValidation fails a request rejected by, or timed out waiting for, an external validator
+func (r *CertificateRequestReconciler) failValidation(ctx context.Context, cr *cmapi.CertificateRequest, reason, message string) error {
+	log.FromContext(ctx).Info("CertificateRequest failed external validation", "name", cr.Name, "reason", reason, "message", message)
+	if r.Recorder != nil {
+		r.Recorder.Event(cr, corev1.EventTypeWarning, reason, truncateMessage(message, maxEventMessageLength))
+	}
+	return r.setFailed(ctx, cr, message)
+}
+
+// requestCondition returns a condition of a request, nil if it isn't set
+func requestCondition(cr *cmapi.CertificateRequest, conditionType cmapi.CertificateRequestConditionType) *cmapi.CertificateRequestCondition {
+	for i, c := range cr.Status.Conditions {
+		if c.Type == conditionType {
+			return &cr.Status.Conditions[i]
+		}
+	}
+	return nil
+}
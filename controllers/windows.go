@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	"github.com/bvorland/cert-manager-external-issuer/internal/cron"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// windowRecheckInterval bounds how long a deferred request waits before the
+// windows are evaluated again, e.g. after the policy was changed
+const windowRecheckInterval = time.Hour
+
+// issuanceDeferral explains why a request may not be issued yet and when to
+// look at it again
+type issuanceDeferral struct {
+	message  string
+	resumeAt time.Time
+}
+
+// checkIssuanceWindows returns a deferral if the issuance window policy does
+// not allow issuing the request at now, or an error if the policy is invalid
+func checkIssuanceWindows(cr *cmapi.CertificateRequest, policy *externalissuerapi.IssuanceWindowPolicy, now time.Time) (*issuanceDeferral, error) {
+	if policy == nil || (policy.AllowRenewals && isRenewal(cr)) {
+		return nil, nil
+	}
+
+	for _, w := range policy.Blocked {
+		window, loc, err := parseIssuanceWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocked issuance window %q: %w", w.Schedule, err)
+		}
+		if active, end := window.ActiveAt(now.In(loc)); active {
+			return &issuanceDeferral{
+				message:  fmt.Sprintf("Issuance is blocked by window %q until %s", w.Schedule, end.UTC().Format(time.RFC3339)),
+				resumeAt: end,
+			}, nil
+		}
+	}
+
+	if len(policy.Allowed) == 0 {
+		return nil, nil
+	}
+	var next time.Time
+	for _, w := range policy.Allowed {
+		window, loc, err := parseIssuanceWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed issuance window %q: %w", w.Schedule, err)
+		}
+		if active, _ := window.ActiveAt(now.In(loc)); active {
+			return nil, nil
+		}
+		if start := window.Schedule.Next(now.In(loc)); !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+
+	message := "Outside the allowed issuance windows"
+	if !next.IsZero() {
+		message = fmt.Sprintf("Outside the allowed issuance windows, next window opens at %s", next.UTC().Format(time.RFC3339))
+	}
+	return &issuanceDeferral{message: message, resumeAt: next}, nil
+}
+
+// parseIssuanceWindow parses a window and its time zone
+func parseIssuanceWindow(w externalissuerapi.IssuanceWindow) (*cron.Window, *time.Location, error) {
+	loc := time.UTC
+	if w.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(w.TimeZone); err != nil {
+			return nil, nil, fmt.Errorf("unknown time zone: %w", err)
+		}
+	}
+	window, err := cron.ParseWindow(w.Schedule, w.Duration.Duration)
+	if err != nil {
+		return nil, nil, err
+	}
+	return window, loc, nil
+}
+
+// requeueDelay returns how long to wait before re-evaluating a deferred request
+func (d *issuanceDeferral) requeueDelay(now time.Time) time.Duration {
+	if d.resumeAt.IsZero() {
+		return windowRecheckInterval
+	}
+	delay := d.resumeAt.Sub(now)
+	if delay > windowRecheckInterval {
+		return windowRecheckInterval
+	}
+	if delay < time.Second {
+		return time.Second
+	}
+	return delay
+}
+
+// isRenewal reports whether a request re-issues an existing certificate:
+// a Certificate revision after the first, or a renewal of an annotated Secret
+func isRenewal(cr *cmapi.CertificateRequest) bool {
+	if revision, err := strconv.Atoi(cr.Annotations[cmapi.CertificateRequestRevisionAnnotationKey]); err == nil && revision > 1 {
+		return true
+	}
+	if owner := metav1.GetControllerOf(cr); owner != nil && owner.Kind == "Secret" && owner.APIVersion == "v1" {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	externalissuerapi "github.com/bvorland/cert-manager-external-issuer/api/v1alpha1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func issuanceWindow(schedule string, duration time.Duration, timeZone string) externalissuerapi.IssuanceWindow {
+	return externalissuerapi.IssuanceWindow{Schedule: schedule, Duration: metav1.Duration{Duration: duration}, TimeZone: timeZone}
+}
+
+func TestCheckIssuanceWindows(t *testing.T) {
+	// Business hours in Berlin and a freeze over the turn of the year
+	businessHours := issuanceWindow("0 8 * * MON-FRI", 10*time.Hour, "Europe/Berlin")
+	nightly := issuanceWindow("0 22 * * *", 4*time.Hour, "")
+	freeze := issuanceWindow("0 0 24 12 *", 10*24*time.Hour, "")
+	dstNight := issuanceWindow("0 2 * * *", time.Hour, "Europe/Berlin")
+
+	utc := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name         string
+		policy       *externalissuerapi.IssuanceWindowPolicy
+		renewal      bool
+		now          time.Time
+		wantResumeAt *time.Time
+		wantMessage  string
+		wantErr      string
+	}{
+		{
+			name: "no policy",
+			now:  utc(2025, 1, 11, 3, 0),
+		},
+		{
+			name:   "allowed window open",
+			policy: &externalissuerapi.IssuanceWindowPolicy{Allowed: []externalissuerapi.IssuanceWindow{businessHours}},
+			// Wednesday 17:59 CET
+			now: utc(2025, 1, 8, 16, 59),
+		},
+		{
+			name:         "allowed window closed",
+			policy:       &externalissuerapi.IssuanceWindowPolicy{Allowed: []externalissuerapi.IssuanceWindow{businessHours}},
+			now:          utc(2025, 1, 8, 17, 0),
+			wantResumeAt: ptr.To(utc(2025, 1, 9, 7, 0)),
+			wantMessage:  "next window opens at 2025-01-09T07:00:00Z",
+		},
+		{
+			name:         "allowed window over the weekend",
+			policy:       &externalissuerapi.IssuanceWindowPolicy{Allowed: []externalissuerapi.IssuanceWindow{businessHours}},
+			now:          utc(2025, 1, 11, 10, 0),
+			wantResumeAt: ptr.To(utc(2025, 1, 13, 7, 0)),
+		},
+		{
+			name:   "allowed window across midnight",
+			policy: &externalissuerapi.IssuanceWindowPolicy{Allowed: []externalissuerapi.IssuanceWindow{businessHours, nightly}},
+			now:    utc(2025, 1, 11, 1, 30),
+		},
+		{
+			name:         "earliest allowed window",
+			policy:       &externalissuerapi.IssuanceWindowPolicy{Allowed: []externalissuerapi.IssuanceWindow{businessHours, nightly}},
+			now:          utc(2025, 1, 11, 10, 0),
+			wantResumeAt: ptr.To(utc(2025, 1, 11, 22, 0)),
+		},
+		{
+			name:   "allowed window in the hour DST skips",
+			policy: &externalissuerapi.IssuanceWindowPolicy{Allowed: []externalissuerapi.IssuanceWindow{dstNight}},
+			// 03:30 CEST on 2025-03-30, the window opened at 03:00 CEST
+			now: utc(2025, 3, 30, 1, 30),
+		},
+		{
+			name:         "blocked window open",
+			policy:       &externalissuerapi.IssuanceWindowPolicy{Blocked: []externalissuerapi.IssuanceWindow{freeze}},
+			now:          utc(2024, 12, 31, 12, 0),
+			wantResumeAt: ptr.To(utc(2025, 1, 3, 0, 0)),
+			wantMessage:  "blocked by window \"0 0 24 12 *\" until 2025-01-03T00:00:00Z",
+		},
+		{
+			name:   "blocked window closed",
+			policy: &externalissuerapi.IssuanceWindowPolicy{Blocked: []externalissuerapi.IssuanceWindow{freeze}},
+			now:    utc(2025, 1, 3, 0, 0),
+		},
+		{
+			name: "blocked wins over allowed",
+			policy: &externalissuerapi.IssuanceWindowPolicy{
+				Allowed: []externalissuerapi.IssuanceWindow{businessHours},
+				Blocked: []externalissuerapi.IssuanceWindow{freeze},
+			},
+			now:          utc(2025, 1, 2, 9, 0),
+			wantResumeAt: ptr.To(utc(2025, 1, 3, 0, 0)),
+		},
+		{
+			name: "renewal allowed",
+			policy: &externalissuerapi.IssuanceWindowPolicy{
+				Blocked:       []externalissuerapi.IssuanceWindow{freeze},
+				AllowRenewals: true,
+			},
+			renewal: true,
+			now:     utc(2024, 12, 31, 12, 0),
+		},
+		{
+			name: "new certificate with renewals allowed",
+			policy: &externalissuerapi.IssuanceWindowPolicy{
+				Blocked:       []externalissuerapi.IssuanceWindow{freeze},
+				AllowRenewals: true,
+			},
+			now:          utc(2024, 12, 31, 12, 0),
+			wantResumeAt: ptr.To(utc(2025, 1, 3, 0, 0)),
+		},
+		{
+			name:    "invalid schedule",
+			policy:  &externalissuerapi.IssuanceWindowPolicy{Allowed: []externalissuerapi.IssuanceWindow{issuanceWindow("0 25 * * *", time.Hour, "")}},
+			now:     utc(2025, 1, 8, 12, 0),
+			wantErr: "invalid allowed issuance window",
+		},
+		{
+			name:    "unknown time zone",
+			policy:  &externalissuerapi.IssuanceWindowPolicy{Blocked: []externalissuerapi.IssuanceWindow{issuanceWindow("0 8 * * *", time.Hour, "Mars/Olympus_Mons")}},
+			now:     utc(2025, 1, 8, 12, 0),
+			wantErr: "unknown time zone",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: testNamespace}}
+			if tt.renewal {
+				cr.Annotations = map[string]string{cmapi.CertificateRequestRevisionAnnotationKey: "2"}
+			}
+
+			deferral, err := checkIssuanceWindows(cr, tt.policy, tt.now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("checkIssuanceWindows returned %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantResumeAt == nil {
+				if deferral != nil {
+					t.Fatalf("request deferred: %s", deferral.message)
+				}
+				return
+			}
+			if deferral == nil {
+				t.Fatal("request not deferred")
+			}
+			if !deferral.resumeAt.Equal(*tt.wantResumeAt) {
+				t.Errorf("resumes at %s, want %s", deferral.resumeAt, *tt.wantResumeAt)
+			}
+			if !strings.Contains(deferral.message, tt.wantMessage) {
+				t.Errorf("message %q, want it to contain %q", deferral.message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestRequeueDelay(t *testing.T) {
+	now := time.Date(2025, 1, 8, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		resumeAt time.Time
+		want     time.Duration
+	}{
+		{time.Time{}, windowRecheckInterval},
+		{now.Add(10 * time.Minute), 10 * time.Minute},
+		{now.Add(24 * time.Hour), windowRecheckInterval},
+		{now, time.Second},
+		{now.Add(-time.Minute), time.Second},
+	}
+	for _, tt := range tests {
+		d := &issuanceDeferral{resumeAt: tt.resumeAt}
+		if got := d.requeueDelay(now); got != tt.want {
+			t.Errorf("requeueDelay with resumeAt %s = %s, want %s", tt.resumeAt, got, tt.want)
+		}
+	}
+}
+
+func TestIsRenewal(t *testing.T) {
+	tests := []struct {
+		name string
+		cr   cmapi.CertificateRequest
+		want bool
+	}{
+		{"first revision", cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{cmapi.CertificateRequestRevisionAnnotationKey: "1"}}}, false},
+		{"later revision", cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{cmapi.CertificateRequestRevisionAnnotationKey: "3"}}}, true},
+		{"no revision", cmapi.CertificateRequest{}, false},
+		{"annotated Secret", cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "v1", Kind: "Secret", Name: "app-tls", Controller: ptr.To(true)},
+		}}}, true},
+	}
+	for _, tt := range tests {
+		if got := isRenewal(&tt.cr); got != tt.want {
+			t.Errorf("%s: isRenewal = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package audit keeps a tamper-evident trail of every certificate requested
+// from the PKI through the external issuers.
+//
+// Records are chained: each carries the SHA-256 hash of its predecessor and
+// its own hash over both, so removing, reordering or altering a record breaks
+// the chain from there on. Verify checks a trail written to a file.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Results of audited requests
+const (
+	ResultIssued = "issued"
+	ResultFailed = "failed"
+)
+
+// Record describes the outcome of one CertificateRequest
+type Record struct {
+	// Sequence numbers the records of a trail, starting at 1
+	Sequence uint64    `json:"sequence"`
+	Time     time.Time `json:"time"`
+	Result   string    `json:"result"`
+
+	IssuerKind         string `json:"issuerKind"`
+	IssuerName         string `json:"issuerName"`
+	Namespace          string `json:"namespace"`
+	CertificateRequest string `json:"certificateRequest"`
+	// Certificate is the cert-manager Certificate the request belongs to, if any
+	Certificate string `json:"certificate,omitempty"`
+
+	// Username and Groups identify who created the CertificateRequest, as
+	// recorded by the API server in its spec
+	Username string   `json:"username,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+
+	// Subject and SANs are the ones requested in the CSR
+	Subject        string   `json:"subject"`
+	DNSNames       []string `json:"dnsNames,omitempty"`
+	IPAddresses    []string `json:"ipAddresses,omitempty"`
+	URIs           []string `json:"uris,omitempty"`
+	EmailAddresses []string `json:"emailAddresses,omitempty"`
+
+	// SerialNumber is the upper-case hexadecimal serial number of the issued certificate
+	SerialNumber string `json:"serialNumber,omitempty"`
+	// OrderID is the order or ticket ID of the PKI for asynchronous issuance
+	OrderID string `json:"orderId,omitempty"`
+	// Message explains failed requests
+	Message string `json:"message,omitempty"`
+
+	// PreviousHash is the hash of the preceding record, empty for the first
+	PreviousHash string `json:"previousHash"`
+	// Hash is the hex SHA-256 of the record's JSON encoding without the hash
+	Hash string `json:"hash,omitempty"`
+}
+
+// computeHash returns the hash of a record, computed with Hash unset
+func computeHash(record Record) (string, error) {
+	record.Hash = ""
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Sink stores chained records
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+	Close() error
+}
+
+// Options selects and configures the sinks of the audit trail
+type Options struct {
+	// File appends each record as a JSON line; the chain continues across restarts
+	File string
+
+	// WebhookURL receives each record as a JSON POST
+	WebhookURL string
+	// WebhookBearerTokenFile holds a bearer token sent to WebhookURL, re-read on every request
+	WebhookBearerTokenFile string
+}
+
+// Trail chains records and writes them to its sinks
+type Trail struct {
+	mu       sync.Mutex
+	sinks    []Sink
+	sequence uint64
+	lastHash string
+}
+
+// New creates the configured audit trail, or nil if auditing is disabled.
+// A trail with a file continues the chain of the records already in it.
+func New(opts Options) (*Trail, error) {
+	t := &Trail{}
+	if opts.File != "" {
+		file, last, err := openFileSink(opts.File)
+		if err != nil {
+			return nil, err
+		}
+		t.sinks = append(t.sinks, file)
+		if last != nil {
+			t.sequence, t.lastHash = last.Sequence, last.Hash
+		}
+	}
+	if opts.WebhookURL != "" {
+		webhook, err := newWebhookSink(opts.WebhookURL, opts.WebhookBearerTokenFile)
+		if err != nil {
+			t.Close()
+			return nil, err
+		}
+		t.sinks = append(t.sinks, webhook)
+	}
+	if len(t.sinks) == 0 {
+		return nil, nil
+	}
+	return t, nil
+}
+
+// Record chains a record to the trail and writes it to every sink. Records
+// are written in sequence; a sink that fails doesn't keep the record from
+// the others.
+func (t *Trail) Record(ctx context.Context, record Record) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	record.Sequence = t.sequence + 1
+	record.Time = record.Time.UTC()
+	record.PreviousHash = t.lastHash
+	hash, err := computeHash(record)
+	if err != nil {
+		return err
+	}
+	record.Hash = hash
+
+	var errs []error
+	for _, sink := range t.sinks {
+		if err := sink.Write(ctx, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	t.sequence, t.lastHash = record.Sequence, record.Hash
+	return errors.Join(errs...)
+}
+
+// Close closes the sinks of the trail
+func (t *Trail) Close() error {
+	if t == nil {
+		return nil
+	}
+	var errs []error
+	for _, sink := range t.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Verify checks the chain of a trail written as JSON lines and returns the
+// number of records. It fails at the first record that was altered or whose
+// predecessor was removed or replaced.
+func Verify(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	var previous *Record
+	count := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			return count, fmt.Errorf("record %d: invalid JSON: %w", count+1, err)
+		}
+		hash, err := computeHash(record)
+		if err != nil {
+			return count, err
+		}
+		if hash != record.Hash {
+			return count, fmt.Errorf("record %d (sequence %d): hash mismatch, the record was altered", count+1, record.Sequence)
+		}
+		if previous != nil {
+			if record.PreviousHash != previous.Hash {
+				return count, fmt.Errorf("record %d (sequence %d): previous hash mismatch, a record before it was removed or replaced", count+1, record.Sequence)
+			}
+			if record.Sequence != previous.Sequence+1 {
+				return count, fmt.Errorf("record %d: sequence %d follows %d", count+1, record.Sequence, previous.Sequence)
+			}
+		}
+		previous = &record
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, fmt.Errorf("failed to read audit trail: %w", err)
+	}
+	return count, nil
+}
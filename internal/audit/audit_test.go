@@ -0,0 +1,199 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memorySink keeps the records written to it
+type memorySink struct {
+	records []Record
+}
+
+func (s *memorySink) Write(_ context.Context, record Record) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+// chain records n requests and returns them as chained by a trail
+func chain(t *testing.T, n int) []Record {
+	t.Helper()
+	sink := &memorySink{}
+	trail := &Trail{sinks: []Sink{sink}}
+	for i := range n {
+		err := trail.Record(context.Background(), Record{
+			Time:               time.Date(2025, 1, 2, 3, 4, i, 0, time.UTC),
+			Result:             ResultIssued,
+			IssuerKind:         "ExternalIssuer",
+			IssuerName:         "pki",
+			Namespace:          "default",
+			CertificateRequest: "app-" + string(rune('a'+i)),
+			Subject:            "CN=app",
+			DNSNames:           []string{"app.example.com"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sink.records
+}
+
+// jsonLines encodes records the way the file sink writes them
+func jsonLines(t *testing.T, records []Record) string {
+	t.Helper()
+	var b bytes.Buffer
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(append(line, '\n'))
+	}
+	return b.String()
+}
+
+func TestComputeHash(t *testing.T) {
+	record := chain(t, 1)[0]
+	hash, err := computeHash(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != record.Hash {
+		t.Errorf("computeHash = %s, want the hash the trail set, %s", hash, record.Hash)
+	}
+
+	// The hash covers every field but itself
+	record.Hash = "0000"
+	if again, _ := computeHash(record); again != hash {
+		t.Error("hash depends on the Hash field")
+	}
+	record.Groups = []string{"system:authenticated"}
+	if changed, _ := computeHash(record); changed == hash {
+		t.Error("hash does not cover Groups")
+	}
+}
+
+func TestRecordChains(t *testing.T) {
+	records := chain(t, 3)
+	for i, record := range records {
+		if record.Sequence != uint64(i+1) {
+			t.Errorf("record %d has sequence %d", i+1, record.Sequence)
+		}
+		previous := ""
+		if i > 0 {
+			previous = records[i-1].Hash
+		}
+		if record.PreviousHash != previous {
+			t.Errorf("record %d has previous hash %q, want %q", i+1, record.PreviousHash, previous)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		trail     func([]Record) []Record
+		raw       func(string) string
+		wantCount int
+		wantErr   string
+	}{
+		{
+			name:      "valid chain",
+			wantCount: 3,
+		},
+		{
+			name:      "blank lines",
+			raw:       func(s string) string { return "\n" + strings.ReplaceAll(s, "\n", "\n\n") },
+			wantCount: 3,
+		},
+		{
+			name:      "empty trail",
+			trail:     func([]Record) []Record { return nil },
+			wantCount: 0,
+		},
+		{
+			name: "record modified in place",
+			trail: func(r []Record) []Record {
+				r[1].DNSNames = []string{"evil.example.com"}
+				return r
+			},
+			wantCount: 1,
+			wantErr:   "record 2 (sequence 2): hash mismatch",
+		},
+		{
+			name: "record modified and rehashed",
+			trail: func(r []Record) []Record {
+				r[1].Result = ResultFailed
+				r[1].Hash, _ = computeHash(r[1])
+				return r
+			},
+			wantCount: 2,
+			wantErr:   "record 3 (sequence 3): previous hash mismatch",
+		},
+		{
+			name:      "record removed",
+			trail:     func(r []Record) []Record { return []Record{r[0], r[2]} },
+			wantCount: 1,
+			wantErr:   "record 2 (sequence 3): previous hash mismatch",
+		},
+		{
+			name:      "records reordered",
+			trail:     func(r []Record) []Record { return []Record{r[0], r[2], r[1]} },
+			wantCount: 1,
+			wantErr:   "record 2 (sequence 3): previous hash mismatch",
+		},
+		{
+			name: "sequence rewritten",
+			trail: func(r []Record) []Record {
+				r[1].Sequence = 7
+				r[1].Hash, _ = computeHash(r[1])
+				r[2].PreviousHash = r[1].Hash
+				r[2].Hash, _ = computeHash(r[2])
+				return r
+			},
+			wantCount: 1,
+			wantErr:   "record 2: sequence 7 follows 1",
+		},
+		{
+			name:      "invalid JSON",
+			raw:       func(s string) string { return s + "{\"sequence\": 4,\n" },
+			wantCount: 3,
+			wantErr:   "record 4: invalid JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := chain(t, 3)
+			if tt.trail != nil {
+				records = tt.trail(records)
+			}
+			raw := jsonLines(t, records)
+			if tt.raw != nil {
+				raw = tt.raw(raw)
+			}
+
+			count, err := Verify(strings.NewReader(raw))
+			if count != tt.wantCount {
+				t.Errorf("Verify counted %d records, want %d", count, tt.wantCount)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Verify returned %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// maxRecordSize bounds the size of a record line read back from a file
+const maxRecordSize = 1 << 20
+
+// fileSink appends records as JSON lines to a file, syncing every record to
+// disk before the request it describes is reported as done
+type fileSink struct {
+	file *os.File
+}
+
+// openFileSink opens the audit file for appending and returns its last
+// record, nil for a new file. A last record that doesn't verify is an error:
+// continuing the chain from it would hide the tampering.
+func openFileSink(path string) (*fileSink, *Record, error) {
+	last, complete, err := lastRecord(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	// Drop the torn tail of an interrupted write, so the next record starts on a line of its own
+	info, err := file.Stat()
+	if err == nil && info.Size() > complete {
+		err = file.Truncate(complete)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to truncate the incomplete last line of the audit file: %w", err)
+	}
+	return &fileSink{file: file}, last, nil
+}
+
+// lastRecord reads the last record of an audit file and the size of its
+// complete lines. A last line without a newline is a record whose write was
+// interrupted; it was never synced, so the request it describes was not
+// reported as done, and it is ignored.
+func lastRecord(path string) (*Record, int64, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var line []byte
+	var complete int64
+	for {
+		chunk, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read audit file: %w", err)
+		}
+		if len(chunk) > maxRecordSize {
+			return nil, 0, fmt.Errorf("record in audit file %s exceeds %d bytes", path, maxRecordSize)
+		}
+		complete += int64(len(chunk))
+		if trimmed := bytes.TrimSpace(chunk); len(trimmed) > 0 {
+			line = trimmed
+		}
+	}
+	if line == nil {
+		return nil, complete, nil
+	}
+
+	var record Record
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, 0, fmt.Errorf("invalid last record in audit file %s: %w", path, err)
+	}
+	if hash, err := computeHash(record); err != nil || hash != record.Hash {
+		return nil, 0, fmt.Errorf("last record in audit file %s (sequence %d) doesn't match its hash", path, record.Sequence)
+	}
+	return &record, complete, nil
+}
+
+func (s *fileSink) Write(_ context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit file: %w", err)
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLastRecord(t *testing.T) {
+	records := chain(t, 2)
+	lines := jsonLines(t, records)
+	torn := jsonLines(t, chain(t, 3)[2:])
+	torn = torn[:len(torn)/2]
+
+	tampered := records[1]
+	tampered.Subject = "CN=evil"
+
+	tests := []struct {
+		name         string
+		content      *string
+		wantSequence uint64
+		wantComplete int
+		wantErr      string
+	}{
+		{
+			name: "no file",
+		},
+		{
+			name:    "empty file",
+			content: ptr(""),
+		},
+		{
+			name:         "records",
+			content:      ptr(lines),
+			wantSequence: 2,
+			wantComplete: len(lines),
+		},
+		{
+			name:         "trailing blank line",
+			content:      ptr(lines + "\n"),
+			wantSequence: 2,
+			wantComplete: len(lines) + 1,
+		},
+		{
+			name:         "truncated last line",
+			content:      ptr(lines + torn),
+			wantSequence: 2,
+			wantComplete: len(lines),
+		},
+		{
+			name:    "tampered last record",
+			content: ptr(jsonLines(t, []Record{records[0], tampered})),
+			wantErr: "doesn't match its hash",
+		},
+		{
+			name:    "invalid last line",
+			content: ptr(lines + "garbage\n"),
+			wantErr: "invalid last record",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			if tt.content != nil {
+				if err := os.WriteFile(path, []byte(*tt.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			last, complete, err := lastRecord(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("lastRecord returned %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete != int64(tt.wantComplete) {
+				t.Errorf("complete lines end at %d, want %d", complete, tt.wantComplete)
+			}
+			switch {
+			case tt.wantSequence == 0 && last != nil:
+				t.Errorf("last record %d, want none", last.Sequence)
+			case tt.wantSequence != 0 && (last == nil || last.Sequence != tt.wantSequence):
+				t.Errorf("last record %v, want sequence %d", last, tt.wantSequence)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+// TestFileRestart checks that a restarted trail continues the chain in its
+// file, also after a write that was interrupted mid-record
+func TestFileRestart(t *testing.T) {
+	for _, interrupted := range []bool{false, true} {
+		name := "clean"
+		if interrupted {
+			name = "interrupted write"
+		}
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			record := func(trail *Trail, cr string) {
+				t.Helper()
+				err := trail.Record(context.Background(), Record{Time: time.Now(), Result: ResultIssued, CertificateRequest: cr})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			trail, err := New(Options{File: path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			record(trail, "first")
+			record(trail, "second")
+			if err := trail.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if interrupted {
+				f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.WriteString(`{"sequence":3,"time":"2025-01-02T03:04:05Z","res`); err != nil {
+					t.Fatal(err)
+				}
+				f.Close()
+			}
+
+			trail, err = New(Options{File: path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			record(trail, "third")
+			if err := trail.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			count, err := Verify(f)
+			if err != nil {
+				t.Fatalf("Verify after the restart returned %v", err)
+			}
+			if count != 3 {
+				t.Errorf("trail has %d records, want 3", count)
+			}
+			last, _, err := lastRecord(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if last.Sequence != 3 || last.CertificateRequest != "third" {
+				t.Errorf("last record is %d %s, want 3 third", last.Sequence, last.CertificateRequest)
+			}
+		})
+	}
+}
+
+func TestNewRefusesTamperedFile(t *testing.T) {
+	records := chain(t, 2)
+	records[1].Message = "altered"
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte(jsonLines(t, records)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Options{File: path}); err == nil {
+		t.Error("New continued the chain of a tampered audit file")
+	}
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// webhookAttempts is how often a record is posted before it is given up
+	webhookAttempts = 3
+
+	webhookRetryDelay = time.Second
+)
+
+// webhookSink posts records as JSON to an HTTP endpoint, e.g. a SIEM
+// collector. Records are posted in sequence, so the receiver sees the chain
+// in order.
+type webhookSink struct {
+	url        string
+	tokenFile  string
+	httpClient *http.Client
+}
+
+// newWebhookSink creates a sink posting to endpoint
+func newWebhookSink(endpoint, tokenFile string) (*webhookSink, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid audit webhook URL %q: must be an http(s) URL", endpoint)
+	}
+	return &webhookSink{
+		url:        endpoint,
+		tokenFile:  tokenFile,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Write posts a record, retrying a few times before giving up
+func (s *webhookSink) Write(ctx context.Context, record Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	for attempt := 1; ; attempt++ {
+		err = s.post(ctx, body)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(webhookRetryDelay * time.Duration(attempt)):
+		}
+	}
+}
+
+func (s *webhookSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create audit request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.tokenFile != "" {
+		// Re-read so a rotated token Secret is picked up without a restart
+		token, err := os.ReadFile(s.tokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read audit webhook token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("audit webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("audit webhook error: %d, %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	return nil
+}
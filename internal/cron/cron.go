@@ -0,0 +1,225 @@
+// Package cron parses standard five-field cron expressions and evaluates
+// recurring time windows built from them.
+//
+// Supported syntax per field: "*", single values, ranges ("1-5"), steps
+// ("*/15", "0-30/10") and comma-separated lists of those. Month and weekday
+// names (JAN-DEC, SUN-SAT) are accepted. As in classic cron, when both
+// day-of-month and day-of-week are restricted a day matches if either does.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// domAny/dowAny record whether the day fields were "*"
+	domAny, dowAny bool
+}
+
+type fieldSpec struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = fieldSpec{name: "minute", min: 0, max: 59}
+	hourField   = fieldSpec{name: "hour", min: 0, max: 23}
+	domField    = fieldSpec{name: "day-of-month", min: 1, max: 31}
+	monthField  = fieldSpec{name: "month", min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	dowField = fieldSpec{name: "day-of-week", min: 0, max: 7, names: map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}}
+)
+
+// Parse parses a five-field cron expression: minute hour day-of-month month day-of-week
+func Parse(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, got %d", expr, len(fields))
+	}
+
+	s := &Schedule{
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}
+	var err error
+	if s.minute, err = parseField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], domField); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(fields[4], dowField); err != nil {
+		return nil, err
+	}
+	// 7 is an alias for Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	return s, nil
+}
+
+// parseField parses one cron field into a bitset of allowed values
+func parseField(field string, spec fieldSpec) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			rangePart = part[:idx]
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field %q", spec.name, part)
+			}
+			step = n
+		}
+
+		lo, hi := spec.min, spec.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = parseValue(bounds[0], spec); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = parseValue(bounds[1], spec); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// "5/15" means "5-max/15"
+				hi = spec.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range in %s field %q", spec.name, part)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// parseValue parses a single numeric or named value of a cron field
+func parseValue(value string, spec fieldSpec) (int, error) {
+	if n, ok := spec.names[strings.ToUpper(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < spec.min || n > spec.max {
+		return 0, fmt.Errorf("invalid value %q in %s field (allowed %d-%d)", value, spec.name, spec.min, spec.max)
+	}
+	return n, nil
+}
+
+// Matches reports whether the minute containing t matches the schedule
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.minute&(1<<uint(t.Minute())) != 0 &&
+		s.hour&(1<<uint(t.Hour())) != 0 &&
+		s.month&(1<<uint(t.Month())) != 0 &&
+		s.dayMatches(t)
+}
+
+// dayMatches applies classic cron day-of-month/day-of-week semantics
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first matching minute strictly after t, or the zero time
+// if the schedule does not match within the next five years. The schedule
+// applies to the wall clock of t's location: an occurrence at a time a DST
+// change skips is shifted by the change, one at a time it repeats happens once.
+func (s *Schedule) Next(t time.Time) time.Time {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	for {
+		if wall = s.nextWall(wall); wall.IsZero() {
+			return wall
+		}
+		next := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, t.Location())
+		if next.After(t) {
+			return next
+		}
+	}
+}
+
+// nextWall returns the first matching minute strictly after the wall clock
+// time t, given in UTC, or the zero time if there is none within five years
+func (s *Schedule) nextWall(t time.Time) time.Time {
+	t = t.Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// Window is a recurring time window that opens whenever Schedule matches and
+// stays open for Duration
+type Window struct {
+	Schedule *Schedule
+	Duration time.Duration
+}
+
+// ParseWindow parses a cron expression and window duration
+func ParseWindow(expr string, duration time.Duration) (*Window, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("window duration must be positive, got %s", duration)
+	}
+	schedule, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Window{Schedule: schedule, Duration: duration}, nil
+}
+
+// ActiveAt reports whether the window is open at t and, if so, when it closes.
+// Overlapping occurrences extend the window to the end of the latest one.
+func (w *Window) ActiveAt(t time.Time) (bool, time.Time) {
+	var end time.Time
+	for start := w.Schedule.Next(t.Add(-w.Duration).Add(-time.Minute)); !start.IsZero() && !start.After(t); start = w.Schedule.Next(start) {
+		if candidate := start.Add(w.Duration); candidate.After(t) {
+			end = candidate
+		}
+	}
+	return !end.IsZero(), end
+}
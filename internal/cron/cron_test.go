@@ -0,0 +1,221 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"* * * *", "must have 5 fields"},
+		{"* * * * * *", "must have 5 fields"},
+		{"60 * * * *", `invalid value "60" in minute field`},
+		{"* 24 * * *", `invalid value "24" in hour field`},
+		{"* * 0 * *", `invalid value "0" in day-of-month field`},
+		{"* * * 13 *", `invalid value "13" in month field`},
+		{"* * * * 8", `invalid value "8" in day-of-week field`},
+		{"* * * FOO *", `invalid value "FOO" in month field`},
+		{"*/0 * * * *", "invalid step"},
+		{"*/x * * * *", "invalid step"},
+		{"30-10 * * * *", "invalid range"},
+		{"1,,2 * * * *", "invalid value"},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.expr); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Parse(%q) returned %v, want an error containing %q", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	// 2025-01-08 is a Wednesday
+	day := func(month time.Month, d, hour, minute int) time.Time {
+		return time.Date(2025, month, d, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"* * * * *", day(1, 8, 10, 17), true},
+
+		// Steps and ranges
+		{"*/15 * * * *", day(1, 8, 10, 45), true},
+		{"*/15 * * * *", day(1, 8, 10, 50), false},
+		{"0-30/10 * * * *", day(1, 8, 10, 20), true},
+		{"0-30/10 * * * *", day(1, 8, 10, 25), false},
+		{"0-30/10 * * * *", day(1, 8, 10, 40), false},
+		{"5/20 * * * *", day(1, 8, 10, 45), true},
+		{"5/20 * * * *", day(1, 8, 10, 50), false},
+		{"0 9-17 * * MON-FRI", day(1, 8, 12, 0), true},
+		{"0 9-17 * * MON-FRI", day(1, 8, 18, 0), false},
+		{"0 9-17 * * MON-FRI", day(1, 11, 12, 0), false},
+		{"0 0,12 1,15 * *", day(1, 15, 12, 0), true},
+		{"0 0,12 1,15 * *", day(1, 16, 12, 0), false},
+		{"0 0 * jan,JUL *", day(7, 1, 0, 0), true},
+		{"0 0 * jan,JUL *", day(8, 1, 0, 0), false},
+
+		// 7 and 0 are both Sunday
+		{"0 0 * * 7", day(1, 12, 0, 0), true},
+		{"0 0 * * 0", day(1, 12, 0, 0), true},
+		{"0 0 * * 5-7", day(1, 12, 0, 0), true},
+
+		// Restricting both day fields matches either, restricting one matches only that
+		{"0 0 13 * FRI", day(6, 13, 0, 0), true},
+		{"0 0 13 * FRI", day(3, 13, 0, 0), true},
+		{"0 0 13 * FRI", day(1, 10, 0, 0), true},
+		{"0 0 13 * FRI", day(1, 11, 0, 0), false},
+		{"0 0 13 * *", day(1, 10, 0, 0), false},
+		{"0 0 * * FRI", day(3, 13, 0, 0), false},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		if got := s.Matches(tt.t); got != tt.want {
+			t.Errorf("%q matches %s: %t, want %t", tt.expr, tt.t.Format("Mon 2006-01-02 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{
+			name: "strictly after",
+			expr: "* * * * *",
+			from: time.Date(2025, 1, 8, 10, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 1, 8, 10, 1, 0, 0, time.UTC),
+		},
+		{
+			name: "within the minute",
+			expr: "* * * * *",
+			from: time.Date(2025, 1, 8, 10, 0, 30, 0, time.UTC),
+			want: time.Date(2025, 1, 8, 10, 1, 0, 0, time.UTC),
+		},
+		{
+			name: "next day",
+			expr: "30 2 * * *",
+			from: time.Date(2025, 1, 8, 3, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 1, 9, 2, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "either day field",
+			expr: "0 0 13 * FRI",
+			from: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "leap day",
+			expr: "0 0 29 2 *",
+			from: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "never",
+			expr: "0 0 31 2 *",
+			from: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "wall clock of the location",
+			expr: "0 9 * * *",
+			from: time.Date(2025, 1, 8, 0, 0, 0, 0, berlin),
+			want: time.Date(2025, 1, 8, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "skipped by DST",
+			expr: "30 2 * * *",
+			from: time.Date(2025, 3, 30, 0, 0, 0, 0, berlin),
+			want: time.Date(2025, 3, 30, 1, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "repeated by DST",
+			expr: "30 2 * * *",
+			from: time.Date(2025, 10, 26, 1, 30, 0, 0, time.UTC).In(berlin),
+			want: time.Date(2025, 10, 27, 1, 30, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+
+	// The repeated hour of a DST change only matches once
+	s, _ := Parse("30 2 * * *")
+	first := s.Next(time.Date(2025, 10, 26, 0, 0, 0, 0, berlin))
+	if first.Day() != 26 || first.Hour() != 2 || first.Minute() != 30 {
+		t.Errorf("Next before the DST change = %s, want 02:30 on the 26th", first)
+	}
+	if second := s.Next(first); second.Day() != 27 {
+		t.Errorf("Next after %s = %s, want the 27th", first, second)
+	}
+}
+
+func TestActiveAt(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	utc := func(month time.Month, d, hour, minute int) time.Time {
+		return time.Date(2025, month, d, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name     string
+		expr     string
+		duration time.Duration
+		at       time.Time
+		wantEnd  time.Time
+	}{
+		{"open", "0 22 * * *", 4 * time.Hour, utc(1, 8, 23, 0), utc(1, 9, 2, 0)},
+		{"across midnight", "0 22 * * *", 4 * time.Hour, utc(1, 9, 1, 59), utc(1, 9, 2, 0)},
+		{"closed at the end", "0 22 * * *", 4 * time.Hour, utc(1, 9, 2, 0), time.Time{}},
+		{"not yet open", "0 22 * * *", 4 * time.Hour, utc(1, 8, 21, 59), time.Time{}},
+		{"opens on the start", "0 22 * * *", 4 * time.Hour, utc(1, 8, 22, 0), utc(1, 9, 2, 0)},
+		{"opened the day before", "0 23 * * FRI", 3 * time.Hour, utc(1, 11, 1, 0), utc(1, 11, 2, 0)},
+		{"closed on other days", "0 23 * * FRI", 3 * time.Hour, utc(1, 12, 1, 0), time.Time{}},
+		{"overlapping occurrences", "0 * * * *", 90 * time.Minute, utc(1, 8, 10, 15), utc(1, 8, 11, 30)},
+		{"over several days", "0 0 1 * *", 72 * time.Hour, utc(1, 3, 12, 0), utc(1, 4, 0, 0)},
+
+		// 02:00 doesn't exist on 2025-03-30 in Berlin: the window opens at 03:00 CEST
+		{"skipped by DST", "0 2 * * *", time.Hour, time.Date(2025, 3, 30, 3, 30, 0, 0, berlin), time.Date(2025, 3, 30, 4, 0, 0, 0, berlin)},
+		// Durations are elapsed time: 01:00 CEST plus 3h is 03:00 CET on 2025-10-26
+		{"across DST", "0 1 * * *", 3 * time.Hour, utc(10, 26, 1, 30).In(berlin), utc(10, 26, 2, 0)},
+		{"closed after DST", "0 1 * * *", 3 * time.Hour, utc(10, 26, 2, 0).In(berlin), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := ParseWindow(tt.expr, tt.duration)
+			if err != nil {
+				t.Fatal(err)
+			}
+			active, end := w.ActiveAt(tt.at)
+			if active != !tt.wantEnd.IsZero() || !end.Equal(tt.wantEnd) {
+				t.Errorf("ActiveAt(%s) = %t, %s; want end %s", tt.at, active, end, tt.wantEnd)
+			}
+		})
+	}
+
+	if _, err := ParseWindow("* * * * *", 0); err == nil {
+		t.Error("ParseWindow accepted a window without duration")
+	}
+}
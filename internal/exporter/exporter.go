@@ -0,0 +1,127 @@
+// Package exporter pushes records of issued certificates to an external
+// inventory system (CMDB) over HTTP or Kafka.
+//
+// Records are queued and delivered in the background with retries, so a slow
+// or unavailable inventory never blocks certificate issuance.
+package exporter
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+// Event types of exported records
+const (
+	EventIssued   = "issued"
+	EventRenewed  = "renewed"
+	EventRevoked  = "revoked"
+	EventHeld     = "held"
+	EventReleased = "released"
+)
+
+// Record describes one certificate lifecycle event
+type Record struct {
+	Event             string    `json:"event"`
+	Timestamp         time.Time `json:"timestamp"`
+	SerialNumber      string    `json:"serialNumber"`
+	FingerprintSHA256 string    `json:"fingerprintSha256"`
+	Subject           string    `json:"subject"`
+	DNSNames          []string  `json:"dnsNames,omitempty"`
+	IPAddresses       []string  `json:"ipAddresses,omitempty"`
+	URIs              []string  `json:"uris,omitempty"`
+	EmailAddresses    []string  `json:"emailAddresses,omitempty"`
+	NotBefore         time.Time `json:"notBefore"`
+	NotAfter          time.Time `json:"notAfter"`
+
+	// Namespace owns the certificate
+	Namespace          string `json:"namespace"`
+	CertificateRequest string `json:"certificateRequest"`
+	// Certificate is the cert-manager Certificate the request belongs to, if any
+	Certificate string `json:"certificate,omitempty"`
+	IssuerKind  string `json:"issuerKind"`
+	IssuerName  string `json:"issuerName"`
+	// Origin is the Ingress or Gateway the certificate terminates on, if known
+	Origin *Origin `json:"origin,omitempty"`
+}
+
+// Origin identifies the Ingress or Gateway a certificate was requested for
+type Origin struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// Attributes are further metadata of the edge, e.g. its site ID
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// NewRecord builds a record from the first certificate of a PEM chain
+func NewRecord(event string, certPEM []byte) (Record, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return Record{}, fmt.Errorf("no certificate found in PEM data")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	fingerprint := sha256.Sum256(cert.Raw)
+	record := Record{
+		Event:             event,
+		Timestamp:         time.Now().UTC(),
+		SerialNumber:      fmt.Sprintf("%X", cert.SerialNumber),
+		FingerprintSHA256: hex.EncodeToString(fingerprint[:]),
+		Subject:           cert.Subject.String(),
+		DNSNames:          cert.DNSNames,
+		EmailAddresses:    cert.EmailAddresses,
+		NotBefore:         cert.NotBefore.UTC(),
+		NotAfter:          cert.NotAfter.UTC(),
+	}
+	for _, ip := range cert.IPAddresses {
+		record.IPAddresses = append(record.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		record.URIs = append(record.URIs, uri.String())
+	}
+	return record, nil
+}
+
+// Exporter delivers records to an inventory system
+type Exporter interface {
+	Export(ctx context.Context, record Record) error
+	Close() error
+}
+
+// Options selects and configures the exporter backend
+type Options struct {
+	// HTTPURL receives each record as a JSON POST
+	HTTPURL string
+	// HTTPBearerTokenFile holds a bearer token sent to HTTPURL, re-read on every request
+	HTTPBearerTokenFile string
+
+	// KafkaBrokers are the bootstrap brokers (host:port) of the Kafka cluster
+	KafkaBrokers []string
+	// KafkaTopic receives each record as a JSON message keyed by serial number
+	KafkaTopic string
+}
+
+// New creates the configured exporter, or nil if exporting is disabled
+func New(opts Options) (Exporter, error) {
+	switch {
+	case opts.HTTPURL != "" && len(opts.KafkaBrokers) > 0:
+		return nil, fmt.Errorf("only one of the HTTP and Kafka exporters can be configured")
+	case opts.HTTPURL != "":
+		return NewHTTPExporter(opts.HTTPURL, opts.HTTPBearerTokenFile)
+	case len(opts.KafkaBrokers) > 0:
+		if opts.KafkaTopic == "" {
+			return nil, fmt.Errorf("a Kafka topic is required")
+		}
+		return NewKafkaExporter(opts.KafkaBrokers, opts.KafkaTopic), nil
+	default:
+		return nil, nil
+	}
+}
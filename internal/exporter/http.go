@@ -0,0 +1,70 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTPExporter posts records as JSON to an HTTP endpoint
+type HTTPExporter struct {
+	url        string
+	tokenFile  string
+	httpClient *http.Client
+}
+
+// NewHTTPExporter creates an exporter posting to endpoint
+func NewHTTPExporter(endpoint, tokenFile string) (*HTTPExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid export URL %q: must be an http(s) URL", endpoint)
+	}
+	return &HTTPExporter{
+		url:        endpoint,
+		tokenFile:  tokenFile,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (e *HTTPExporter) Export(ctx context.Context, record Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create export request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.tokenFile != "" {
+		// Re-read so a rotated token Secret is picked up without a restart
+		token, err := os.ReadFile(e.tokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read export token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("export request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("export endpoint error: %d, %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+func (e *HTTPExporter) Close() error {
+	return nil
+}
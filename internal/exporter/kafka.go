@@ -0,0 +1,42 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaExporter publishes records as JSON messages to a Kafka topic. Messages
+// are keyed by serial number so all events of a certificate stay ordered.
+type KafkaExporter struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaExporter creates an exporter publishing to topic
+func NewKafkaExporter(brokers []string, topic string) *KafkaExporter {
+	return &KafkaExporter{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+func (e *KafkaExporter) Export(ctx context.Context, record Record) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+	if err := e.writer.WriteMessages(ctx, kafka.Message{Key: []byte(record.SerialNumber), Value: value}); err != nil {
+		return fmt.Errorf("failed to publish record: %w", err)
+	}
+	return nil
+}
+
+func (e *KafkaExporter) Close() error {
+	return e.writer.Close()
+}
@@ -0,0 +1,111 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// defaultQueueSize bounds the records waiting for delivery
+	defaultQueueSize = 1000
+
+	// maxRetryDuration is how long delivery of one record is retried
+	maxRetryDuration = 10 * time.Minute
+
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+)
+
+// exportedRecords counts export outcomes
+var exportedRecords = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "external_issuer_export_records_total",
+		Help: "Certificate records sent to the inventory exporter, by event and result (success, failed, dropped)",
+	},
+	[]string{"event", "result"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(exportedRecords)
+}
+
+// Queue delivers records in the background, retrying failed deliveries with
+// exponential backoff. It implements manager.Runnable.
+type Queue struct {
+	exporter Exporter
+	records  chan Record
+}
+
+// NewQueue creates a queue in front of an exporter
+func NewQueue(exporter Exporter, size int) *Queue {
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	return &Queue{exporter: exporter, records: make(chan Record, size)}
+}
+
+// Enqueue schedules a record for delivery without blocking. Records are
+// dropped when the queue is full so issuance is never held up by the exporter.
+func (q *Queue) Enqueue(record Record) error {
+	select {
+	case q.records <- record:
+		return nil
+	default:
+		exportedRecords.WithLabelValues(record.Event, "dropped").Inc()
+		return fmt.Errorf("export queue full, dropped record for serial %s", record.SerialNumber)
+	}
+}
+
+// Start delivers queued records until ctx is cancelled
+func (q *Queue) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("exporter")
+	defer func() {
+		if err := q.exporter.Close(); err != nil {
+			logger.Error(err, "Failed to close exporter")
+		}
+		if pending := len(q.records); pending > 0 {
+			logger.Info("Shutting down with undelivered records", "count", pending)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case record := <-q.records:
+			if err := q.deliver(ctx, record); err != nil {
+				exportedRecords.WithLabelValues(record.Event, "failed").Inc()
+				logger.Error(err, "Failed to export certificate record", "serial", record.SerialNumber,
+					"namespace", record.Namespace, "certificateRequest", record.CertificateRequest)
+				continue
+			}
+			exportedRecords.WithLabelValues(record.Event, "success").Inc()
+		}
+	}
+}
+
+// deliver exports one record, retrying until it succeeds or maxRetryDuration passes
+func (q *Queue) deliver(ctx context.Context, record Record) error {
+	deadline := time.Now().Add(maxRetryDuration)
+	delay := minRetryDelay
+	for {
+		err := q.exporter.Export(ctx, record)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
@@ -0,0 +1,120 @@
+// Package hooks runs custom actions on certificates after they are issued,
+// such as pushing them to a hardware load balancer or notifying a chat
+// channel, without changes to the reconciler.
+//
+// Hooks are either in-process plugins, which register a factory from an init
+// function and are compiled into the controller by importing their package,
+// or the built-in webhook posting each event to an HTTP endpoint. Hooks run
+// in the background with retries, so a failing hook never blocks issuance.
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Event describes a certificate that was just issued
+type Event struct {
+	// Renewal is true for later revisions of a cert-manager Certificate
+	Renewal bool `json:"renewal"`
+
+	Namespace          string `json:"namespace"`
+	CertificateRequest string `json:"certificateRequest"`
+	// CertificateName is the cert-manager Certificate the request belongs to, if any
+	CertificateName string `json:"certificateName,omitempty"`
+	IssuerKind      string `json:"issuerKind"`
+	IssuerName      string `json:"issuerName"`
+
+	// Certificate is the PEM certificate chain, leaf first
+	Certificate string `json:"certificate"`
+	// CA is the PEM CA certificate(s) returned by the issuer
+	CA string `json:"ca,omitempty"`
+}
+
+// Hook is an action run for every issued certificate. Run is retried with
+// backoff while it returns an error, so it should be idempotent.
+type Hook interface {
+	Run(ctx context.Context, event Event) error
+}
+
+// Factory creates a hook when it is enabled. Plugins read their own
+// configuration, e.g. from environment variables or mounted files.
+type Factory func() (Hook, error)
+
+var registry = struct {
+	sync.Mutex
+	factories map[string]Factory
+}{factories: map[string]Factory{}}
+
+// Register makes an in-process hook available under name. It is meant to be
+// called from the init function of the plugin's package and panics if the
+// name is taken.
+func Register(name string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.factories[name]; ok {
+		panic(fmt.Sprintf("hooks: hook %q registered twice", name))
+	}
+	registry.factories[name] = factory
+}
+
+// Registered returns the names of all registered hooks
+func Registered() []string {
+	registry.Lock()
+	defer registry.Unlock()
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options selects the hooks to run
+type Options struct {
+	// Enabled are the names of registered hooks to run
+	Enabled []string
+
+	// WebhookURL receives each event as a JSON POST
+	WebhookURL string
+	// WebhookBearerTokenFile holds a bearer token sent to WebhookURL, re-read on every request
+	WebhookBearerTokenFile string
+}
+
+// New creates the enabled hooks by name, or nil if none are enabled
+func New(opts Options) (map[string]Hook, error) {
+	enabled := map[string]Hook{}
+	for _, name := range opts.Enabled {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		registry.Lock()
+		factory, ok := registry.factories[name]
+		registry.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown hook %q (registered: %v)", name, Registered())
+		}
+		hook, err := factory()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create hook %q: %w", name, err)
+		}
+		enabled[name] = hook
+	}
+	if opts.WebhookURL != "" {
+		if _, ok := enabled["webhook"]; ok {
+			return nil, fmt.Errorf("hook name \"webhook\" is reserved for the built-in webhook")
+		}
+		hook, err := NewWebhook(opts.WebhookURL, opts.WebhookBearerTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		enabled["webhook"] = hook
+	}
+	if len(enabled) == 0 {
+		return nil, nil
+	}
+	return enabled, nil
+}
@@ -0,0 +1,144 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// defaultQueueSize bounds the events waiting for each hook
+	defaultQueueSize = 1000
+
+	// maxRetryDuration is how long one hook run is retried
+	maxRetryDuration = 10 * time.Minute
+
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+)
+
+// hookRuns counts hook outcomes
+var hookRuns = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "external_issuer_hook_runs_total",
+		Help: "Post-issuance hook runs, by hook and result (success, failed, dropped)",
+	},
+	[]string{"hook", "result"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(hookRuns)
+}
+
+// queuedHook is a hook with its own queue, so a slow or failing hook doesn't
+// delay the others
+type queuedHook struct {
+	name   string
+	hook   Hook
+	events chan Event
+}
+
+// Runner runs hooks in the background, retrying failed runs with
+// exponential backoff. It implements manager.Runnable.
+type Runner struct {
+	hooks []*queuedHook
+}
+
+// NewRunner creates a runner for hooks by name
+func NewRunner(hooks map[string]Hook, size int) *Runner {
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	r := &Runner{}
+	for name, hook := range hooks {
+		r.hooks = append(r.hooks, &queuedHook{name: name, hook: hook, events: make(chan Event, size)})
+	}
+	sort.Slice(r.hooks, func(i, j int) bool { return r.hooks[i].name < r.hooks[j].name })
+	return r
+}
+
+// Names returns the names of the hooks run
+func (r *Runner) Names() []string {
+	names := make([]string, 0, len(r.hooks))
+	for _, h := range r.hooks {
+		names = append(names, h.name)
+	}
+	return names
+}
+
+// Enqueue schedules an event for every hook without blocking. Events are
+// dropped for hooks whose queue is full so issuance is never held up.
+func (r *Runner) Enqueue(event Event) error {
+	var dropped []string
+	for _, h := range r.hooks {
+		select {
+		case h.events <- event:
+		default:
+			hookRuns.WithLabelValues(h.name, "dropped").Inc()
+			dropped = append(dropped, h.name)
+		}
+	}
+	if len(dropped) > 0 {
+		return fmt.Errorf("hook queue full, dropped event for %s/%s for hooks %v", event.Namespace, event.CertificateRequest, dropped)
+	}
+	return nil
+}
+
+// Start runs queued events until ctx is cancelled
+func (r *Runner) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("hooks")
+
+	var wg sync.WaitGroup
+	for _, h := range r.hooks {
+		wg.Add(1)
+		go func(h *queuedHook) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					if pending := len(h.events); pending > 0 {
+						logger.Info("Shutting down with pending hook events", "hook", h.name, "count", pending)
+					}
+					return
+				case event := <-h.events:
+					if err := run(ctx, h.hook, event); err != nil {
+						hookRuns.WithLabelValues(h.name, "failed").Inc()
+						logger.Error(err, "Post-issuance hook failed", "hook", h.name,
+							"namespace", event.Namespace, "certificateRequest", event.CertificateRequest)
+						continue
+					}
+					hookRuns.WithLabelValues(h.name, "success").Inc()
+				}
+			}
+		}(h)
+	}
+	wg.Wait()
+	return nil
+}
+
+// run runs a hook for one event, retrying until it succeeds or maxRetryDuration passes
+func run(ctx context.Context, hook Hook, event Event) error {
+	deadline := time.Now().Add(maxRetryDuration)
+	delay := minRetryDelay
+	for {
+		err := hook.Run(ctx, event)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
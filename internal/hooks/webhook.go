@@ -0,0 +1,66 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Webhook posts events as JSON to an HTTP endpoint
+type Webhook struct {
+	url        string
+	tokenFile  string
+	httpClient *http.Client
+}
+
+// NewWebhook creates a hook posting to endpoint
+func NewWebhook(endpoint, tokenFile string) (*Webhook, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid hook webhook URL %q: must be an http(s) URL", endpoint)
+	}
+	return &Webhook{
+		url:        endpoint,
+		tokenFile:  tokenFile,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (w *Webhook) Run(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.tokenFile != "" {
+		// Re-read so a rotated token Secret is picked up without a restart
+		token, err := os.ReadFile(w.tokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read webhook token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook error: %d, %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
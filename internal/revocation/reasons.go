@@ -0,0 +1,68 @@
+// Package revocation defines the certificate revocation reasons of RFC 5280
+// (CRLReason), shared by the controller, the PKI signer and the Mock CA server.
+package revocation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Revocation reasons of RFC 5280 section 5.3.1
+const (
+	Unspecified          = "unspecified"
+	KeyCompromise        = "keyCompromise"
+	CACompromise         = "cACompromise"
+	AffiliationChanged   = "affiliationChanged"
+	Superseded           = "superseded"
+	CessationOfOperation = "cessationOfOperation"
+	// CertificateHold suspends a certificate; it can be released again
+	CertificateHold = "certificateHold"
+	// RemoveFromCRL releases a certificate from hold
+	RemoveFromCRL      = "removeFromCRL"
+	PrivilegeWithdrawn = "privilegeWithdrawn"
+	AACompromise       = "aACompromise"
+)
+
+// reasons lists the reasons by their CRLReason code; code 7 is not used
+var reasons = []string{
+	0:  Unspecified,
+	1:  KeyCompromise,
+	2:  CACompromise,
+	3:  AffiliationChanged,
+	4:  Superseded,
+	5:  CessationOfOperation,
+	6:  CertificateHold,
+	8:  RemoveFromCRL,
+	9:  PrivilegeWithdrawn,
+	10: AACompromise,
+}
+
+// Names returns the names of all reasons, ordered by code
+func Names() []string {
+	names := make([]string, 0, len(reasons))
+	for _, name := range reasons {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Parse returns the name and CRLReason code of a reason given by name, in
+// any case, or by its decimal code
+func Parse(reason string) (string, int, error) {
+	reason = strings.TrimSpace(reason)
+	if code, err := strconv.Atoi(reason); err == nil {
+		if code >= 0 && code < len(reasons) && reasons[code] != "" {
+			return reasons[code], code, nil
+		}
+	} else {
+		for code, name := range reasons {
+			if name != "" && strings.EqualFold(name, reason) {
+				return name, code, nil
+			}
+		}
+	}
+	return "", 0, fmt.Errorf("unknown revocation reason %q (supported: %s)", reason, strings.Join(Names(), ", "))
+}
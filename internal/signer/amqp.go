@@ -0,0 +1,83 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// amqpQueue publishes requests to an AMQP exchange and consumes responses
+// from an exclusive, server-named reply queue
+type amqpQueue struct {
+	config     *AMQPTransport
+	conn       *amqp.Connection
+	replyQueue string
+
+	mu      sync.Mutex
+	channel *amqp.Channel
+}
+
+// dialAMQP connects to the broker and starts consuming the reply queue.
+// disconnected is called once the connection is lost.
+func dialAMQP(config *AMQPTransport, deliver func(message []byte, correlationID string), disconnected func()) (*amqpQueue, error) {
+	if config.URL == "" || config.RoutingKey == "" {
+		return nil, fmt.Errorf("transport.amqp requires url and routingKey")
+	}
+
+	conn, err := amqp.Dial(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to AMQP broker: %w", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open AMQP channel: %w", err)
+	}
+	replyQueue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to declare AMQP reply queue: %w", err)
+	}
+	deliveries, err := channel.Consume(replyQueue.Name, "", true, true, false, false, nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to consume AMQP reply queue: %w", err)
+	}
+
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		for d := range deliveries {
+			deliver(d.Body, d.CorrelationId)
+		}
+	}()
+	go func() {
+		<-closed
+		disconnected()
+	}()
+
+	return &amqpQueue{config: config, conn: conn, replyQueue: replyQueue.Name, channel: channel}, nil
+}
+
+func (q *amqpQueue) publish(ctx context.Context, correlationID string, message []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.channel.PublishWithContext(ctx, q.config.Exchange, q.config.RoutingKey, false, false, amqp.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: correlationID,
+		ReplyTo:       q.replyQueue,
+		Body:          message,
+	})
+}
+
+func (q *amqpQueue) ping(ctx context.Context) error {
+	if q.conn.IsClosed() {
+		return fmt.Errorf("AMQP connection is closed")
+	}
+	return nil
+}
+
+func (q *amqpQueue) close() error {
+	return q.conn.Close()
+}
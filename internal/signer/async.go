@@ -0,0 +1,258 @@
+package signer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPollInterval is the initial delay between polls of a pending order
+	defaultPollInterval = 30 * time.Second
+
+	// defaultPollTimeout is how long a pending order is polled before giving up
+	defaultPollTimeout = time.Hour
+)
+
+// PKIAsync configures asynchronous issuance, where the PKI API accepts a
+// request and issues the certificate later under an order ID
+type PKIAsync struct {
+	// PendingStatusCodes are HTTP status codes meaning "accepted, not yet issued" (default: [202])
+	PendingStatusCodes []int `json:"pendingStatusCodes,omitempty"`
+
+	// OrderIDField is the JSON field of a pending response holding the order ID (default: "order_id")
+	OrderIDField string `json:"orderIdField,omitempty"`
+
+	// OrderIDHeader is a response header holding the order ID; takes precedence over OrderIDField
+	OrderIDHeader string `json:"orderIdHeader,omitempty"`
+
+	// OrderIDPattern is a regular expression whose first group captures the
+	// order ID from a response that is not JSON, such as an HTML page.
+	// Successful responses it matches are pending orders.
+	OrderIDPattern string `json:"orderIdPattern,omitempty"`
+
+	// PollURL is the URL polled for the certificate; "{id}" is replaced with the order ID
+	PollURL string `json:"pollUrl"`
+
+	// PollIntervalSeconds is the initial delay between polls; it doubles on every attempt (default: 30)
+	PollIntervalSeconds int `json:"pollIntervalSeconds,omitempty"`
+
+	// MaxPollIntervalSeconds caps the delay between polls (default: 10x the poll interval)
+	MaxPollIntervalSeconds int `json:"maxPollIntervalSeconds,omitempty"`
+
+	// TimeoutSeconds is how long an order is polled before the request fails (default: 3600)
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+
+	// ObjectStorage collects certificates from a bucket instead of polling PollURL
+	ObjectStorage *PKIObjectStorage `json:"objectStorage,omitempty"`
+
+	// Manual means the order ID is a ticket handled by humans, who paste the
+	// issued certificate into a Secret; nothing is polled
+	Manual bool `json:"manual,omitempty"`
+}
+
+// PendingError is returned by Sign and Poll when the PKI API accepted the
+// request but has not issued the certificate yet
+type PendingError struct {
+	// OrderID identifies the request at the PKI API
+	OrderID string
+
+	// RetryAfter is the delay suggested by the PKI API (zero if none)
+	RetryAfter time.Duration
+}
+
+func (e *PendingError) Error() string {
+	return fmt.Sprintf("certificate issuance pending (order %s)", e.OrderID)
+}
+
+// PollInterval returns the initial delay between polls
+func (a *PKIAsync) PollInterval() time.Duration {
+	if a == nil || a.PollIntervalSeconds <= 0 {
+		return defaultPollInterval
+	}
+	return time.Duration(a.PollIntervalSeconds) * time.Second
+}
+
+// MaxPollInterval returns the maximum delay between polls
+func (a *PKIAsync) MaxPollInterval() time.Duration {
+	if a == nil || a.MaxPollIntervalSeconds <= 0 {
+		return 10 * a.PollInterval()
+	}
+	return time.Duration(a.MaxPollIntervalSeconds) * time.Second
+}
+
+// Timeout returns how long a pending order is polled before giving up
+func (a *PKIAsync) Timeout() time.Duration {
+	if a == nil || a.TimeoutSeconds <= 0 {
+		return defaultPollTimeout
+	}
+	return time.Duration(a.TimeoutSeconds) * time.Second
+}
+
+// isPending reports whether an HTTP status code marks a pending order
+func (a *PKIAsync) isPending(statusCode int) bool {
+	if a == nil {
+		return false
+	}
+	if len(a.PendingStatusCodes) == 0 {
+		return statusCode == http.StatusAccepted
+	}
+	for _, code := range a.PendingStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// hasOrderID reports whether a successful response holds an order ID
+// matching OrderIDPattern
+func (s *PKISigner) hasOrderID(statusCode int, body []byte) bool {
+	if s.orderIDPattern == nil || statusCode < 200 || statusCode > 299 {
+		return false
+	}
+	return s.matchOrderID(body) != ""
+}
+
+// matchOrderID returns the order ID OrderIDPattern captures from a response
+func (s *PKISigner) matchOrderID(body []byte) string {
+	if m := s.orderIDPattern.FindSubmatch(body); len(m) > 1 {
+		return string(m[1])
+	}
+	return ""
+}
+
+// compileOrderIDPattern compiles the OrderIDPattern of a configuration once
+// for all responses of a signer; nil if there is none
+func compileOrderIDPattern(async *PKIAsync) (*regexp.Regexp, error) {
+	if async == nil || async.OrderIDPattern == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(async.OrderIDPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid async.orderIdPattern: %w", err)
+	}
+	return pattern, nil
+}
+
+// AsyncConfig returns the asynchronous issuance settings (nil if disabled)
+func (s *PKISigner) AsyncConfig() *PKIAsync {
+	return s.config.Async
+}
+
+// pendingFromResponse builds a PendingError from a pending response
+func (s *PKISigner) pendingFromResponse(resp *http.Response, body []byte, knownOrderID string) error {
+	async := s.config.Async
+
+	orderID := knownOrderID
+	if async.OrderIDHeader != "" {
+		if v := resp.Header.Get(async.OrderIDHeader); v != "" {
+			orderID = v
+		}
+	} else if orderID == "" && s.orderIDPattern != nil {
+		orderID = s.matchOrderID(body)
+	} else if orderID == "" {
+		field := async.OrderIDField
+		if field == "" {
+			field = "order_id"
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(body, &fields); err == nil {
+			if v, ok := fields[field]; ok {
+				orderID = strings.TrimSpace(fmt.Sprint(v))
+			}
+		}
+	}
+	if orderID == "" {
+		return fmt.Errorf("PKI API returned pending status %d without an order ID", resp.StatusCode)
+	}
+
+	pending := &PendingError{OrderID: orderID}
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+			pending.RetryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+	return pending
+}
+
+// Poll checks whether a pending order has been issued. It returns the
+// certificate and CA chain once available, or a *PendingError while pending.
+func (s *PKISigner) Poll(ctx context.Context, orderID string) ([]byte, []byte, error) {
+	resp, err := s.pollResponse(ctx, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	async := s.config.Async
+
+	body, err := s.readResponse(resp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read poll response: %w", err)
+	}
+
+	if async.isPending(resp.StatusCode) {
+		return nil, nil, s.pendingFromResponse(resp, body, orderID)
+	}
+	if err := s.checkResponse(resp, body, "PKI API error polling order "+orderID); err != nil {
+		return nil, nil, err
+	}
+
+	certPEM, err := s.parseResponse(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkChainLimits(certPEM); err != nil {
+		return nil, nil, err
+	}
+	// The certificate may have been issued long before this poll
+	if err := s.checkNotBefore(certPEM, time.Time{}, s.clock.Now()); err != nil {
+		return nil, nil, err
+	}
+
+	return certPEM, s.extractCAChain(certPEM), nil
+}
+
+// pollResponse fetches the PKI's current response for an order
+func (s *PKISigner) pollResponse(ctx context.Context, orderID string) (*http.Response, error) {
+	if s.files != nil {
+		req, err := http.NewRequestWithContext(ctx, "GET", "file:///"+url.PathEscape(orderID), nil)
+		if err != nil {
+			return nil, err
+		}
+		return s.files.response(ctx, req, orderID)
+	}
+
+	async := s.config.Async
+	if async != nil && async.Manual {
+		return nil, &PendingError{OrderID: orderID}
+	}
+	if async != nil && async.ObjectStorage != nil {
+		return s.collectObject(ctx, orderID)
+	}
+	if async == nil || async.PollURL == "" {
+		return nil, fmt.Errorf("asynchronous issuance is not configured")
+	}
+
+	pollURL := strings.ReplaceAll(async.PollURL, "{id}", url.PathEscape(orderID))
+	req, err := http.NewRequestWithContext(ctx, "GET", pollURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create poll request: %w", err)
+	}
+	if err := s.addAuth(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("poll request failed: %w", err)
+	}
+	s.checkAuthRejected(resp.StatusCode)
+	return resp, nil
+}
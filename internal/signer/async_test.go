@@ -0,0 +1,35 @@
+package signer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOrderIDPattern(t *testing.T) {
+	config, _ := Preset("adcs-certsrv")
+	config.BaseURL = "https://ca.corp.example.com/certsrv/certfnsh.asp"
+	s, err := NewPKISigner(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := []byte(`<p>Your certificate request has been received. Your Request Id is 4711.</p>`)
+	if !s.hasOrderID(200, page) {
+		t.Fatal("certsrv page with a request ID is not a pending order")
+	}
+	if got := s.matchOrderID(page); got != "4711" {
+		t.Errorf("order ID %q, want 4711", got)
+	}
+	if s.hasOrderID(500, page) {
+		t.Error("error response taken for a pending order")
+	}
+	if s.hasOrderID(200, []byte("-----BEGIN CERTIFICATE-----")) {
+		t.Error("response without a request ID taken for a pending order")
+	}
+
+	// Invalid patterns fail when the signer is built, not on every response
+	config.Async.OrderIDPattern = `Request Id is (\d+`
+	if _, err := NewPKISigner(&config); err == nil || !strings.Contains(err.Error(), "orderIdPattern") {
+		t.Errorf("NewPKISigner with an invalid pattern returned %v, want an orderIdPattern error", err)
+	}
+}
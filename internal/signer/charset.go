@@ -0,0 +1,97 @@
+package signer
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Character sets of subject DN attributes accepted by PKIs
+const (
+	// SubjectCharsetUTF8 sends attribute values unchanged
+	SubjectCharsetUTF8 = "utf8"
+	// SubjectCharsetASCII accepts ASCII characters only
+	SubjectCharsetASCII = "ascii"
+	// SubjectCharsetPrintable accepts the characters of an ASN.1 PrintableString only
+	SubjectCharsetPrintable = "printable"
+)
+
+// transliterations are ASCII spellings of letters that don't decompose into
+// a base letter and combining marks
+var transliterations = map[rune]string{
+	'ß': "ss", 'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe", 'Ø': "O", 'ø': "o",
+	'Đ': "D", 'đ': "d", 'Ł': "L", 'ł': "l", 'Þ': "TH", 'þ': "th", 'Ð': "D", 'ð': "d",
+	'ı': "i", '‘': "'", '’': "'", '‚': ",", '“': "\"", '”': "\"", '–': "-", '—': "-",
+}
+
+// convertAttributes converts the values of subject attributes to the
+// character set of the PKI, failing on characters it does not accept
+func (p *PKIParameters) convertAttributes(attributes []dnAttribute) error {
+	if p.SubjectCharset == "" || p.SubjectCharset == SubjectCharsetUTF8 {
+		return nil
+	}
+	for i := range attributes {
+		a := &attributes[i]
+		value, err := p.convertValue(a.name, a.value)
+		if err != nil {
+			return err
+		}
+		if value != a.value && a.der != nil {
+			if a.der, err = asn1.Marshal(value); err != nil {
+				return fmt.Errorf("failed to encode subject attribute %s: %w", a.name, err)
+			}
+		}
+		a.value = value
+	}
+	return nil
+}
+
+// convertValue converts one attribute value
+func (p *PKIParameters) convertValue(attribute, value string) (string, error) {
+	if p.SubjectTransliterate {
+		value = transliterate(value)
+	}
+	for _, r := range value {
+		if !p.acceptsRune(r) {
+			err := fmt.Errorf("subject attribute %s %q contains %q, which the PKI does not accept (subject charset %s)",
+				attribute, value, r, p.SubjectCharset)
+			if !p.SubjectTransliterate {
+				err = fmt.Errorf("%w; remove it from the subject or enable parameters.subjectTransliterate", err)
+			}
+			return value, err
+		}
+	}
+	return value, nil
+}
+
+// acceptsRune reports whether the subject character set contains a character
+func (p *PKIParameters) acceptsRune(r rune) bool {
+	if p.SubjectCharset == SubjectCharsetASCII {
+		return r <= unicode.MaxASCII && unicode.IsPrint(r)
+	}
+	// PrintableString, RFC 5280 Appendix B
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return true
+	}
+	return strings.ContainsRune(" '()+,-./:=?", r)
+}
+
+// transliterate spells a value in ASCII where possible: letters with
+// diacritics lose them and a few other letters get their usual spelling
+func transliterate(value string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(value) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case transliterations[r] != "":
+			b.WriteString(transliterations[r])
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(b.String())
+}
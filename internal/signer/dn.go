@@ -0,0 +1,209 @@
+package signer
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// dnAttribute is an attribute of a subject DN sent to the PKI
+type dnAttribute struct {
+	// name is the short name of the attribute type, or its dotted OID
+	name  string
+	value string
+	// der is the encoding of a value of an attribute type without a short
+	// name, sent as "#<hex>" as RFC 4514 requires instead of value
+	der []byte
+}
+
+// dnAttributeType is an attribute type with a short name
+type dnAttributeType struct {
+	name string
+	oid  asn1.ObjectIdentifier
+}
+
+// dnAttributeTypes are the attribute types with a short name, in the default
+// order of comma-separated DNs (most specific first)
+var dnAttributeTypes = []dnAttributeType{
+	{"CN", asn1.ObjectIdentifier{2, 5, 4, 3}},
+	{"UID", asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}},
+	{"emailAddress", asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}},
+	{"SERIALNUMBER", asn1.ObjectIdentifier{2, 5, 4, 5}},
+	{"OU", asn1.ObjectIdentifier{2, 5, 4, 11}},
+	{"O", asn1.ObjectIdentifier{2, 5, 4, 10}},
+	{"STREET", asn1.ObjectIdentifier{2, 5, 4, 9}},
+	{"L", asn1.ObjectIdentifier{2, 5, 4, 7}},
+	{"ST", asn1.ObjectIdentifier{2, 5, 4, 8}},
+	{"POSTALCODE", asn1.ObjectIdentifier{2, 5, 4, 17}},
+	{"C", asn1.ObjectIdentifier{2, 5, 4, 6}},
+	{"DC", asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}},
+}
+
+// dottedOID matches an attribute type given as dotted OID
+var dottedOID = regexp.MustCompile(`^[0-2](\.(0|[1-9][0-9]*))+$`)
+
+// ValidRDNType reports whether an entry of parameters.subjectRDNOrder names
+// an attribute type: a short name such as "CN" or a dotted OID
+func ValidRDNType(name string) bool {
+	return dottedOID.MatchString(name) || slices.ContainsFunc(dnAttributeTypes, func(t dnAttributeType) bool {
+		return strings.EqualFold(t.name, name)
+	})
+}
+
+// subjectAttributes returns the attributes of a subject in the default order
+// of comma-separated DNs. Attributes with a field in pkix.Name are taken from
+// the fields, which subject overrides replace, the others from Names.
+func subjectAttributes(subject pkix.Name) []dnAttribute {
+	fields := map[string][]string{
+		"CN":           {subject.CommonName},
+		"SERIALNUMBER": {subject.SerialNumber},
+		"OU":           subject.OrganizationalUnit,
+		"O":            subject.Organization,
+		"STREET":       subject.StreetAddress,
+		"L":            subject.Locality,
+		"ST":           subject.Province,
+		"POSTALCODE":   subject.PostalCode,
+		"C":            subject.Country,
+	}
+	others := map[string][]dnAttribute{}
+	var custom []dnAttribute
+	for _, atv := range subject.Names {
+		i := slices.IndexFunc(dnAttributeTypes, func(t dnAttributeType) bool {
+			return t.oid.Equal(atv.Type)
+		})
+		switch {
+		case i >= 0 && hasField(fields, dnAttributeTypes[i].name):
+		case i >= 0:
+			if value, ok := atv.Value.(string); ok {
+				name := dnAttributeTypes[i].name
+				others[name] = append(others[name], dnAttribute{name: name, value: value})
+			}
+		default:
+			attribute := dnAttribute{name: atv.Type.String()}
+			if value, ok := atv.Value.(string); ok {
+				attribute.value = value
+			}
+			// Values are re-encoded the way the CSR parser decoded them
+			if der, err := asn1.Marshal(atv.Value); err == nil {
+				attribute.der = der
+			}
+			custom = append(custom, attribute)
+		}
+	}
+
+	var attributes []dnAttribute
+	for _, t := range dnAttributeTypes {
+		for _, value := range fields[t.name] {
+			if value != "" {
+				attributes = append(attributes, dnAttribute{name: t.name, value: value})
+			}
+		}
+		attributes = append(attributes, others[t.name]...)
+	}
+	return append(attributes, custom...)
+}
+
+// hasField reports whether an attribute type is taken from a pkix.Name field
+func hasField(fields map[string][]string, name string) bool {
+	_, ok := fields[name]
+	return ok
+}
+
+// orderAttributes orders attributes by the configured RDN order; attributes
+// of types it doesn't list follow in their current order
+func orderAttributes(attributes []dnAttribute, order []string) []dnAttribute {
+	if len(order) == 0 {
+		return attributes
+	}
+	rank := func(a dnAttribute) int {
+		i := slices.IndexFunc(order, func(name string) bool { return strings.EqualFold(name, a.name) })
+		if i < 0 {
+			return len(order)
+		}
+		return i
+	}
+	ordered := slices.Clone(attributes)
+	slices.SortStableFunc(ordered, func(a, b dnAttribute) int { return rank(a) - rank(b) })
+	return ordered
+}
+
+// buildSubjectDN builds the subject DN sent to the PKI from the CSR, in the
+// configured format and RDN order with special characters escaped
+func (s *PKISigner) buildSubjectDN(csr *x509.CertificateRequest) (string, error) {
+	subject := csr.Subject
+	if s.subject != nil {
+		subject = s.subject.Apply(subject)
+	}
+	attributes := subjectAttributes(subject)
+	// Fallback to first DNS name if no CN
+	if len(attributes) == 0 && len(csr.DNSNames) > 0 {
+		attributes = []dnAttribute{{name: "CN", value: csr.DNSNames[0]}}
+	}
+
+	params := s.config.Parameters
+	if err := params.convertAttributes(attributes); err != nil {
+		// Retrying cannot change the subject of the CSR
+		mapping := PKIErrorMapping{Retry: RetryClassFail}
+		return "", mapping.mapped(err.Error(), err)
+	}
+
+	// Slash format (legacy PKI format): most general attribute first,
+	// /C=US/ST=California/L=San Francisco/O=Example/CN=example.com
+	if params.SubjectDNFormat == "slash" {
+		slices.Reverse(attributes)
+		var b strings.Builder
+		for _, a := range orderAttributes(attributes, params.SubjectRDNOrder) {
+			fmt.Fprintf(&b, "/%s=%s", a.name, escapeSlashDNValue(a))
+		}
+		return b.String(), nil
+	}
+
+	// Default comma-separated format (RFC 4514): CN=...,O=...,C=...
+	parts := make([]string, 0, len(attributes))
+	for _, a := range orderAttributes(attributes, params.SubjectRDNOrder) {
+		parts = append(parts, a.name+"="+escapeDNValue(a))
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// escapeDNValue escapes an attribute value as RFC 4514 section 2.4 requires
+func escapeDNValue(a dnAttribute) string {
+	if a.der != nil {
+		return "#" + hex.EncodeToString(a.der)
+	}
+	var b strings.Builder
+	for i, r := range a.value {
+		switch {
+		case r == 0:
+			b.WriteString(`\00`)
+			continue
+		case strings.ContainsRune(`"+,;<>\`, r),
+			i == 0 && (r == ' ' || r == '#'),
+			i == len(a.value)-1 && r == ' ':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// escapeSlashDNValue escapes an attribute value of a slash-separated DN the
+// way OpenSSL parses "-subj": separators are preceded by a backslash
+func escapeSlashDNValue(a dnAttribute) string {
+	if a.der != nil && a.value == "" {
+		return "#" + hex.EncodeToString(a.der)
+	}
+	var b strings.Builder
+	for _, r := range a.value {
+		if strings.ContainsRune(`/+\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package signer
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// endpointCooldown is how long an endpoint that failed is passed over in
+// favor of the other endpoints of a configuration
+const endpointCooldown = 30 * time.Second
+
+// PKIEndpoint is an alternative URL of the PKI API, e.g. a CA in another region
+type PKIEndpoint struct {
+	// URL is the full URL of the endpoint, used like BaseURL
+	URL string `json:"url"`
+
+	// Priority orders the endpoints, lowest first; endpoints of equal
+	// priority are tried in the order they are listed. BaseURL has priority 0.
+	Priority int `json:"priority,omitempty"`
+}
+
+// EndpointURLs returns the URLs of the PKI API in order of priority, BaseURL
+// first among those of priority 0
+func (c *PKIConfig) EndpointURLs() []string {
+	endpoints := make([]PKIEndpoint, 0, len(c.Endpoints)+1)
+	if c.BaseURL != "" {
+		endpoints = append(endpoints, PKIEndpoint{URL: c.BaseURL})
+	}
+	endpoints = append(endpoints, c.Endpoints...)
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return endpoints[i].Priority < endpoints[j].Priority
+	})
+
+	urls := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		urls[i] = endpoint.URL
+	}
+	return urls
+}
+
+// endpointHealth tracks endpoints that failed recently. It is shared by all
+// signers, as they are created per request.
+var endpointHealth = &healthTracker{down: map[string]time.Time{}}
+
+// healthTracker remembers when endpoints last failed
+type healthTracker struct {
+	mu   sync.Mutex
+	down map[string]time.Time
+}
+
+// markDown records that an endpoint failed
+func (h *healthTracker) markDown(endpoint string, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.down[endpoint] = now
+}
+
+// markUp records that an endpoint answered
+func (h *healthTracker) markUp(endpoint string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.down, endpoint)
+}
+
+// order returns the endpoints that haven't failed within the cooldown
+// first, then the others, which are still tried when all endpoints are down
+func (h *healthTracker) order(endpoints []string, now time.Time) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	healthy := make([]string, 0, len(endpoints))
+	var down []string
+	for _, endpoint := range endpoints {
+		if failed, ok := h.down[endpoint]; ok && now.Sub(failed) < endpointCooldown {
+			down = append(down, endpoint)
+		} else {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	return append(healthy, down...)
+}
+
+// endpoints returns the URLs to send a request to, in order
+func (s *PKISigner) endpoints() []string {
+	urls := s.config.EndpointURLs()
+	if len(urls) == 0 {
+		// Offline PKIs reached by file drop have no URL
+		return []string{""}
+	}
+	return endpointHealth.order(urls, time.Now())
+}
+
+// failover reports whether a request that failed with err, or was answered
+// with statusCode, should be retried at the next endpoint. Only unreachable
+// or failing endpoints are passed over: other error responses concern the
+// request and would be the same at every endpoint.
+func failover(err error, statusCode int) bool {
+	return err != nil || statusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,192 @@
+package signer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Retry classes of mapped PKI API errors
+const (
+	// RetryClassRetry reports the request as failed for now and retries it
+	RetryClassRetry = "retry"
+	// RetryClassPending reports the request as waiting on the PKI and retries it
+	RetryClassPending = "pending"
+	// RetryClassFail fails the request permanently
+	RetryClassFail = "fail"
+)
+
+// PKIErrorMapping maps error responses of the PKI API to how requests are
+// reported, e.g. to tell users to contact the PKI team when a quota is
+// exhausted instead of showing the raw response
+type PKIErrorMapping struct {
+	// StatusCodes are the HTTP status codes matched (default: any error status)
+	StatusCodes []int `json:"statusCodes,omitempty"`
+
+	// Pattern is a regular expression matched against the response body,
+	// e.g. an error code such as "ERR_QUOTA" (default: any body)
+	Pattern string `json:"pattern,omitempty"`
+
+	// Reason is the reason of the Ready condition (default: "SigningFailed"
+	// for retry, "Pending" for pending); failed requests always use "Failed"
+	Reason string `json:"reason,omitempty"`
+
+	// Retry is the retry class: "retry" (default), "pending" or "fail"
+	Retry string `json:"retry,omitempty"`
+
+	// Message is shown in the condition and events instead of the response;
+	// "$1" or "${name}" expand to submatches of Pattern
+	Message string `json:"message,omitempty"`
+
+	// RetryAfterSeconds is the delay before the request is retried
+	// (default: 300 for pending, immediately for retry)
+	RetryAfterSeconds int `json:"retryAfterSeconds,omitempty"`
+}
+
+// defaultPendingRetry is the delay before retrying requests mapped to pending
+const defaultPendingRetry = 5 * time.Minute
+
+// MappedError is an error response of the PKI API matched by an error mapping
+type MappedError struct {
+	// Reason is the reason of the Ready condition
+	Reason string
+
+	// Retry is the retry class of the error
+	Retry string
+
+	// Message is the message shown to users
+	Message string
+
+	// RetryAfter is the delay before the request is retried (zero: immediately)
+	RetryAfter time.Duration
+
+	// Err is the error response
+	Err error
+}
+
+func (e *MappedError) Error() string {
+	if e.Message == e.Err.Error() {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (%v)", e.Message, e.Err)
+}
+
+func (e *MappedError) Unwrap() error {
+	return e.Err
+}
+
+// apiError returns the error for an error response of the PKI API, mapped
+// by the first matching error mapping
+func (s *PKISigner) apiError(err error, statusCode int, body []byte) error {
+	for _, mapping := range s.config.ErrorMappings {
+		if len(mapping.StatusCodes) > 0 && !slices.Contains(mapping.StatusCodes, statusCode) {
+			continue
+		}
+		message := err.Error()
+		if mapping.Pattern != "" {
+			// Patterns are validated with the configuration
+			re, compileErr := regexp.Compile(mapping.Pattern)
+			if compileErr != nil {
+				continue
+			}
+			match := re.FindSubmatchIndex(body)
+			if match == nil {
+				continue
+			}
+			if mapping.Message != "" {
+				message = string(re.Expand(nil, []byte(mapping.Message), body, match))
+			}
+		} else if mapping.Message != "" {
+			message = mapping.Message
+		}
+		return mapping.mapped(message, err)
+	}
+
+	// Vendor error codes apply when no error mapping matches
+	if code, ok := responseField(body, s.config.Response.ErrorCodeField); ok {
+		if retry, ok := s.config.Response.ErrorCodes[code]; ok {
+			mapping := PKIErrorMapping{Retry: retry}
+			return mapping.mapped(err.Error(), err)
+		}
+	}
+	return err
+}
+
+// checkResponse returns the error for a response of the PKI API that is not
+// successful, by its status code, content type or status field, nil otherwise
+func (s *PKISigner) checkResponse(resp *http.Response, body []byte, prefix string) error {
+	response := s.config.Response
+	statusCode := resp.StatusCode
+	success := statusCode == http.StatusOK
+	if len(response.SuccessStatusCodes) > 0 {
+		success = slices.Contains(response.SuccessStatusCodes, statusCode)
+	}
+	if !success {
+		return s.apiError(fmt.Errorf("%s: %d, %s", prefix, statusCode, string(body)), statusCode, body)
+	}
+	if err := s.checkContentType(resp.Header.Get("Content-Type")); err != nil {
+		return err
+	}
+
+	if response.StatusField == "" {
+		return nil
+	}
+	status, ok := responseField(body, response.StatusField)
+	if !ok {
+		return s.apiError(fmt.Errorf("%s: %d, no %s in response, %s", prefix, statusCode, response.StatusField, string(body)), statusCode, body)
+	}
+	if !slices.Contains(response.SuccessValues, status) {
+		return s.apiError(fmt.Errorf("%s: %d, %s %q, %s", prefix, statusCode, response.StatusField, status, string(body)), statusCode, body)
+	}
+	return nil
+}
+
+// responseField returns a top-level field of a JSON response body
+func responseField(body []byte, field string) (string, bool) {
+	if field == "" {
+		return "", false
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", false
+	}
+	v, ok := fields[field]
+	if !ok || v == nil {
+		return "", false
+	}
+	return strings.TrimSpace(fmt.Sprint(v)), true
+}
+
+// mapped builds the MappedError of a matching error mapping
+func (m *PKIErrorMapping) mapped(message string, err error) *MappedError {
+	mapped := &MappedError{
+		Reason:     m.Reason,
+		Retry:      m.Retry,
+		Message:    message,
+		RetryAfter: time.Duration(m.RetryAfterSeconds) * time.Second,
+		Err:        err,
+	}
+	if mapped.Retry == "" {
+		mapped.Retry = RetryClassRetry
+	}
+	switch mapped.Retry {
+	case RetryClassFail:
+		mapped.Reason = "Failed"
+	case RetryClassPending:
+		if mapped.Reason == "" {
+			mapped.Reason = "Pending"
+		}
+		if mapped.RetryAfter <= 0 {
+			mapped.RetryAfter = defaultPendingRetry
+		}
+	default:
+		if mapped.Reason == "" {
+			mapped.Reason = "SigningFailed"
+		}
+	}
+	return mapped
+}
@@ -0,0 +1,160 @@
+package signer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// FileTransport exchanges requests and responses as files, for offline CAs
+// that are only reachable through a data diode or removable media. Requests
+// are written to RequestDir; the CA's response is expected in ResponseDir
+// under the same name. Both are usually mounted volumes.
+type FileTransport struct {
+	// RequestDir receives one <order ID>.json file per request
+	RequestDir string `json:"requestDir"`
+
+	// ResponseDir is polled for <order ID>.json or <order ID>.pem responses
+	ResponseDir string `json:"responseDir"`
+}
+
+// dropStore stores request and response files by name
+type dropStore interface {
+	// put writes a file so that it only becomes visible once complete
+	put(ctx context.Context, name string, data []byte) error
+
+	// get reads a file; found is false if it doesn't exist (yet)
+	get(ctx context.Context, name string) (data []byte, found bool, err error)
+
+	// check verifies that the store is usable
+	check(ctx context.Context) error
+}
+
+// fileDrop submits requests as files and collects responses by order ID.
+// Every request is asynchronous: submitting returns a PendingError and the
+// response is picked up by Poll, so a request can take days to come back.
+type fileDrop struct {
+	requests  dropStore
+	responses dropStore
+}
+
+// submit writes the request and returns the order ID to poll for
+func (f *fileDrop) submit(req *http.Request) error {
+	orderID, err := newCorrelationID()
+	if err != nil {
+		return err
+	}
+
+	message := QueueRequest{
+		CorrelationID: orderID,
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		Headers:       map[string]string{},
+	}
+	for name := range req.Header {
+		message.Headers[name] = req.Header.Get(name)
+	}
+	if req.Body != nil {
+		defer req.Body.Close()
+		if message.Body, err = io.ReadAll(req.Body); err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+	encoded, err := json.MarshalIndent(message, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode request file: %w", err)
+	}
+
+	if err := f.requests.put(req.Context(), orderID+".json", encoded); err != nil {
+		return fmt.Errorf("failed to write request file: %w", err)
+	}
+	return &PendingError{OrderID: orderID}
+}
+
+// response returns the CA's response to an order, or a PendingError while
+// there is none. A .json response is a QueueResponse; a .pem response is the
+// certificate chain itself.
+func (f *fileDrop) response(ctx context.Context, req *http.Request, orderID string) (*http.Response, error) {
+	data, found, err := f.responses.get(ctx, orderID+".json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response file: %w", err)
+	}
+	if found {
+		var resp QueueResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("invalid response file %s.json: %w", orderID, err)
+		}
+		return resp.httpResponse(req), nil
+	}
+
+	data, found, err = f.responses.get(ctx, orderID+".pem")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response file: %w", err)
+	}
+	if found {
+		resp := QueueResponse{StatusCode: http.StatusOK, Body: data}
+		return resp.httpResponse(req), nil
+	}
+
+	return nil, &PendingError{OrderID: orderID}
+}
+
+// check verifies that both directories are usable
+func (f *fileDrop) check(ctx context.Context) error {
+	if err := f.requests.check(ctx); err != nil {
+		return fmt.Errorf("request location: %w", err)
+	}
+	if err := f.responses.check(ctx); err != nil {
+		return fmt.Errorf("response location: %w", err)
+	}
+	return nil
+}
+
+// dirStore is a dropStore in a local directory, e.g. a mounted PVC
+type dirStore struct {
+	dir string
+}
+
+func (d dirStore) put(_ context.Context, name string, data []byte) error {
+	// Write to a temporary name first so the diode never picks up a partial file
+	tmp, err := os.CreateTemp(d.dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(d.dir, name))
+}
+
+func (d dirStore) get(_ context.Context, name string) ([]byte, bool, error) {
+	data, err := os.ReadFile(filepath.Join(d.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (d dirStore) check(_ context.Context) error {
+	info, err := os.Stat(d.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", d.dir)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaCorrelationHeader carries the correlation ID of request and response messages
+const kafkaCorrelationHeader = "correlation-id"
+
+// kafkaQueue publishes requests to a Kafka topic and reads every partition of
+// the response topic from its end, so no consumer group has to be managed
+type kafkaQueue struct {
+	config  *KafkaTransport
+	writer  *kafka.Writer
+	readers []*kafka.Reader
+}
+
+// newKafkaQueue creates the request writer and starts reading responses
+func newKafkaQueue(config *KafkaTransport, deliver func(message []byte, correlationID string)) (*kafkaQueue, error) {
+	if len(config.Brokers) == 0 || config.RequestTopic == "" || config.ResponseTopic == "" {
+		return nil, fmt.Errorf("transport.kafka requires brokers, requestTopic and responseTopic")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := kafka.DialContext(ctx, "tcp", config.Brokers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Kafka broker: %w", err)
+	}
+	partitions, err := conn.ReadPartitions(config.ResponseTopic)
+	conn.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partitions of topic %s: %w", config.ResponseTopic, err)
+	}
+
+	q := &kafkaQueue{
+		config: config,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(config.Brokers...),
+			Topic:        config.RequestTopic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+	for _, partition := range partitions {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:   config.Brokers,
+			Topic:     config.ResponseTopic,
+			Partition: partition.ID,
+		})
+		// Only responses to requests of this process matter
+		if err := reader.SetOffset(kafka.LastOffset); err != nil {
+			q.close()
+			return nil, fmt.Errorf("failed to seek topic %s: %w", config.ResponseTopic, err)
+		}
+		q.readers = append(q.readers, reader)
+		go func() {
+			for {
+				msg, err := reader.ReadMessage(context.Background())
+				if err != nil {
+					// The reader retries internally; an error means it was closed
+					return
+				}
+				deliver(msg.Value, kafkaCorrelationID(msg))
+			}
+		}()
+	}
+	return q, nil
+}
+
+func (q *kafkaQueue) publish(ctx context.Context, correlationID string, message []byte) error {
+	return q.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(correlationID),
+		Value:   message,
+		Headers: []kafka.Header{{Key: kafkaCorrelationHeader, Value: []byte(correlationID)}},
+	})
+}
+
+func (q *kafkaQueue) ping(ctx context.Context) error {
+	conn, err := kafka.DialContext(ctx, "tcp", q.config.Brokers[0])
+	if err != nil {
+		return fmt.Errorf("failed to connect to Kafka broker: %w", err)
+	}
+	return conn.Close()
+}
+
+func (q *kafkaQueue) close() error {
+	for _, reader := range q.readers {
+		reader.Close()
+	}
+	return q.writer.Close()
+}
+
+// kafkaCorrelationID returns the correlation ID header of a message, falling back to its key
+func kafkaCorrelationID(msg kafka.Message) string {
+	for _, header := range msg.Headers {
+		if header.Key == kafkaCorrelationHeader {
+			return string(header.Value)
+		}
+	}
+	return string(msg.Key)
+}
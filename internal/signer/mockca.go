@@ -0,0 +1,229 @@
+//go:build !nomockca
+
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// MockCABuiltIn reports whether the built-in mockca signer is compiled in;
+// builds with the nomockca tag leave it out
+const MockCABuiltIn = true
+
+const (
+	// defaultCABackdate is how far NotBefore of the Mock CA certificate lies in the past
+	defaultCABackdate = time.Hour
+
+	// defaultBackdate is how far NotBefore of issued certificates lies in the
+	// past, so clients whose clock is behind accept them
+	defaultBackdate = time.Minute
+)
+
+// MockCASigner implements local self-signing for development and testing
+// It generates a CA certificate on first use and signs certificates locally
+type MockCASigner struct {
+	caCert    *x509.Certificate
+	caKey     interface{}
+	caPEM     []byte
+	caKeyPEM  []byte
+	generated bool
+	subject   *SubjectOverride
+	isCA      bool
+	clock     clock.PassiveClock
+	backdate  time.Duration
+}
+
+// NewMockCASigner creates a new self-signing Mock CA
+func NewMockCASigner(baseURL string) *MockCASigner {
+	// baseURL is ignored for self-signing - kept for API compatibility
+	return &MockCASigner{clock: clock.RealClock{}, backdate: defaultBackdate}
+}
+
+// SetClock sets the clock validity periods are computed from; nil restores the real clock
+func (s *MockCASigner) SetClock(c clock.PassiveClock) {
+	if c == nil {
+		c = clock.RealClock{}
+	}
+	s.clock = c
+}
+
+// SetBackdate sets how far NotBefore of issued certificates lies in the past
+func (s *MockCASigner) SetBackdate(backdate time.Duration) {
+	s.backdate = backdate
+}
+
+// ensureCA generates the CA certificate and key if not already done
+func (s *MockCASigner) ensureCA() error {
+	if s.generated {
+		return nil
+	}
+
+	// Generate CA private key (RSA 2048)
+	caPrivKey, err := generateRSAKey(2048)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	// Create CA certificate template
+	serialNumber, err := generateSerialNumber()
+	if err != nil {
+		return fmt.Errorf("failed to generate serial: %w", err)
+	}
+
+	now := s.clock.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   "External Issuer Mock CA",
+			Organization: []string{"cert-manager-external-issuer"},
+		},
+		NotBefore:             now.Add(-max(defaultCABackdate, s.backdate)),
+		NotAfter:              now.AddDate(10, 0, 0), // Valid for 10 years
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            1,
+	}
+
+	// Self-sign the CA certificate
+	caCertDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caPrivKey.PublicKey, caPrivKey)
+	if err != nil {
+		return fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	s.caCert, err = x509.ParseCertificate(caCertDER)
+	if err != nil {
+		return fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	s.caKey = caPrivKey
+
+	// Encode to PEM
+	s.caPEM = pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: caCertDER,
+	})
+
+	s.caKeyPEM = pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(caPrivKey),
+	})
+
+	s.generated = true
+	return nil
+}
+
+// SetSubject replaces subject attributes of the CSR in issued certificates
+func (s *MockCASigner) SetSubject(subject *SubjectOverride) {
+	s.subject = subject
+}
+
+// RequestCA makes the signer issue a subordinate CA certificate
+func (s *MockCASigner) RequestCA() error {
+	s.isCA = true
+	return nil
+}
+
+// RequestSVID lets the signer issue SPIFFE X.509-SVIDs; URI SANs are always
+// copied from the CSR
+func (s *MockCASigner) RequestSVID() error {
+	return nil
+}
+
+// CheckHealth verifies the Mock CA is ready
+func (s *MockCASigner) CheckHealth(ctx context.Context) error {
+	// For self-signing, we just ensure CA is generated
+	if err := s.ensureCA(); err != nil {
+		return fmt.Errorf("Mock CA initialization failed: %w", err)
+	}
+	return nil
+}
+
+// Sign signs a CSR using the local Mock CA. The signing happens in process,
+// so a failed one never issued a certificate.
+func (s *MockCASigner) Sign(ctx context.Context, csrPEM []byte, validityDays int) ([]byte, []byte, error) {
+	// Ensure CA is initialized
+	if err := s.ensureCA(); err != nil {
+		return nil, nil, notIssued(fmt.Errorf("CA not ready: %w", err))
+	}
+
+	// Parse the CSR
+	block, _ := pem.Decode(csrPEM)
+	if block == nil {
+		return nil, nil, notIssued(fmt.Errorf("invalid CSR PEM"))
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, nil, notIssued(fmt.Errorf("failed to parse CSR: %w", err))
+	}
+
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, notIssued(fmt.Errorf("CSR signature validation failed: %w", err))
+	}
+
+	// Generate serial number
+	serialNumber, err := generateSerialNumber()
+	if err != nil {
+		return nil, nil, notIssued(fmt.Errorf("failed to generate serial: %w", err))
+	}
+
+	// Create certificate template
+	now := s.clock.Now()
+	certTemplate := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               s.subject.Apply(csr.Subject),
+		NotBefore:             now.Add(-s.backdate),
+		NotAfter:              now.AddDate(0, 0, validityDays),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		DNSNames:              csr.DNSNames,
+		IPAddresses:           csr.IPAddresses,
+		URIs:                  csr.URIs,
+		EmailAddresses:        csr.EmailAddresses,
+	}
+	if s.isCA {
+		// A subordinate CA below the Mock CA may only issue leaf certificates
+		certTemplate.IsCA = true
+		certTemplate.MaxPathLenZero = true
+		certTemplate.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+		certTemplate.ExtKeyUsage = nil
+	}
+
+	// Sign the certificate with our CA
+	certDER, err := x509.CreateCertificate(rand.Reader, certTemplate, s.caCert, csr.PublicKey, s.caKey)
+	if err != nil {
+		return nil, nil, notIssued(fmt.Errorf("failed to sign certificate: %w", err))
+	}
+
+	// Encode to PEM
+	certPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: certDER,
+	})
+
+	return certPEM, s.caPEM, nil
+}
+
+// generateRSAKey generates an RSA private key of the specified bit size
+func generateRSAKey(bits int) (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, bits)
+}
+
+// generateSerialNumber generates a random serial number for certificates
+func generateSerialNumber() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	return rand.Int(rand.Reader, serialNumberLimit)
+}
@@ -0,0 +1,56 @@
+//go:build nomockca
+
+package signer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// MockCABuiltIn reports whether the built-in mockca signer is compiled in;
+// builds with the nomockca tag leave it out
+const MockCABuiltIn = false
+
+// errMockCANotBuiltIn is returned by the placeholder signer of nomockca builds
+var errMockCANotBuiltIn = errors.New("the mockca signer is not built into this controller")
+
+// MockCASigner is a placeholder in builds without the mockca signer; it can't
+// issue certificates
+type MockCASigner struct{}
+
+// NewMockCASigner returns a signer failing every request
+func NewMockCASigner(baseURL string) *MockCASigner {
+	return &MockCASigner{}
+}
+
+// SetSubject does nothing
+func (s *MockCASigner) SetSubject(subject *SubjectOverride) {}
+
+// SetClock does nothing
+func (s *MockCASigner) SetClock(c clock.PassiveClock) {}
+
+// SetBackdate does nothing
+func (s *MockCASigner) SetBackdate(backdate time.Duration) {}
+
+// RequestCA fails, no certificates can be issued
+func (s *MockCASigner) RequestCA() error {
+	return errMockCANotBuiltIn
+}
+
+// RequestSVID fails, no certificates can be issued
+func (s *MockCASigner) RequestSVID() error {
+	return errMockCANotBuiltIn
+}
+
+// CheckHealth fails, no certificates can be issued
+func (s *MockCASigner) CheckHealth(ctx context.Context) error {
+	return errMockCANotBuiltIn
+}
+
+// Sign fails, no certificates can be issued
+func (s *MockCASigner) Sign(ctx context.Context, csrPEM []byte, validityDays int) ([]byte, []byte, error) {
+	return nil, nil, notIssued(errMockCANotBuiltIn)
+}
@@ -0,0 +1,83 @@
+//go:build !nomockca
+
+package signer
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestMockCASignerBackdate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for name, tc := range map[string]struct {
+		backdate     time.Duration
+		wantCert     time.Duration
+		wantCA       time.Duration
+		validityDays int
+	}{
+		"default":                  {backdate: -1, wantCert: time.Minute, wantCA: time.Hour, validityDays: 30},
+		"none":                     {backdate: 0, wantCert: 0, wantCA: time.Hour, validityDays: 1},
+		"beyond the CA's backdate": {backdate: 3 * time.Hour, wantCert: 3 * time.Hour, wantCA: 3 * time.Hour, validityDays: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clk := clocktesting.NewFakeClock(now)
+			s := NewMockCASigner("")
+			s.SetClock(clk)
+			if tc.backdate >= 0 {
+				s.SetBackdate(tc.backdate)
+			}
+
+			certPEM, caPEM, err := s.Sign(context.Background(), testCSR(t), tc.validityDays)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert, ca := parseTestCertificate(t, certPEM), parseTestCertificate(t, caPEM)
+			if want := now.Add(-tc.wantCert); !cert.NotBefore.Equal(want) {
+				t.Errorf("certificate NotBefore %s, want %s", cert.NotBefore, want)
+			}
+			if want := now.AddDate(0, 0, tc.validityDays); !cert.NotAfter.Equal(want) {
+				t.Errorf("certificate NotAfter %s, want %s", cert.NotAfter, want)
+			}
+			if want := now.Add(-tc.wantCA); !ca.NotBefore.Equal(want) {
+				t.Errorf("CA NotBefore %s, want %s", ca.NotBefore, want)
+			}
+
+			// The backdated certificate verifies at its NotBefore, when the
+			// CA is valid as well
+			roots := x509.NewCertPool()
+			roots.AddCert(ca)
+			if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, CurrentTime: cert.NotBefore}); err != nil {
+				t.Errorf("certificate doesn't verify at its NotBefore: %v", err)
+			}
+
+			// Validity periods follow the clock, not the wall time
+			clk.Step(48 * time.Hour)
+			certPEM, _, err = s.Sign(context.Background(), testCSR(t), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := clk.Now().Add(-tc.wantCert); !parseTestCertificate(t, certPEM).NotBefore.Equal(want) {
+				t.Errorf("certificate issued after 48h has NotBefore %s, want %s", parseTestCertificate(t, certPEM).NotBefore, want)
+			}
+		})
+	}
+}
+
+// parseTestCertificate decodes the first certificate of a PEM bundle
+func parseTestCertificate(t *testing.T, certPEM []byte) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatal("no PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
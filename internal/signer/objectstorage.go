@@ -0,0 +1,428 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5" //nolint:gosec // Only compared against the MD5 the object store reports
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+	"k8s.io/utils/clock"
+)
+
+// maxObjectSize bounds certificate objects read from object storage
+const maxObjectSize = 1 << 20
+
+// PKIObjectStorage collects issued certificates from an S3 or GCS bucket
+// instead of polling the PKI API. Ticket-based PKIs often drop the
+// certificate into a bucket once the ticket is fulfilled.
+type PKIObjectStorage struct {
+	// Provider is "s3" (including S3-compatible stores) or "gcs"
+	Provider string `json:"provider"`
+
+	// Bucket holding the issued certificates
+	Bucket string `json:"bucket"`
+
+	// KeyPattern is the object key of a certificate; "{id}" is replaced with the order ID
+	KeyPattern string `json:"keyPattern"`
+
+	// ChecksumKeyPattern is the key of an object holding the hex SHA-256 of the
+	// certificate object (sha256sum format); "{id}" is replaced with the order ID
+	ChecksumKeyPattern string `json:"checksumKeyPattern,omitempty"`
+
+	// Endpoint overrides the API endpoint, e.g. for MinIO or a private endpoint
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Region of the S3 bucket (default: us-east-1)
+	Region string `json:"region,omitempty"`
+
+	// CredentialsSecretRef names the Secret with the storage credentials:
+	// access-key-id and secret-access-key (optionally session-token) for s3,
+	// service-account.json for gcs
+	CredentialsSecretRef string `json:"credentialsSecretRef,omitempty"`
+}
+
+// objectKey returns the key of the object for an order ID
+func objectKey(pattern, orderID string) string {
+	return strings.ReplaceAll(pattern, "{id}", orderID)
+}
+
+// objectStore reads objects from a bucket
+type objectStore interface {
+	// get returns an object and the checksums the store reports for it;
+	// found is false if the object doesn't exist (yet)
+	get(ctx context.Context, key string) (data []byte, checksums http.Header, found bool, err error)
+}
+
+// newObjectStore creates the client for a provider from the Secret data
+func newObjectStore(config *PKIObjectStorage, credentials map[string][]byte, httpClient *http.Client, clk clock.PassiveClock) (objectStore, error) {
+	switch config.Provider {
+	case "s3":
+		store := &s3Store{config: config, httpClient: httpClient, clock: clk}
+		if credentials != nil {
+			store.accessKeyID = string(credentials["access-key-id"])
+			store.secretAccessKey = string(credentials["secret-access-key"])
+			store.sessionToken = string(credentials["session-token"])
+			if store.accessKeyID == "" || store.secretAccessKey == "" {
+				return nil, fmt.Errorf("S3 credentials require access-key-id and secret-access-key")
+			}
+		}
+		return store, nil
+	case "gcs":
+		store := &gcsStore{config: config, httpClient: httpClient}
+		if credentials != nil {
+			key, ok := credentials["service-account.json"]
+			if !ok {
+				return nil, fmt.Errorf("GCS credentials require service-account.json")
+			}
+			tokens, err := gcsTokenSource(key, httpClient)
+			if err != nil {
+				return nil, err
+			}
+			store.tokens = tokens
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unsupported object storage provider %q", config.Provider)
+	}
+}
+
+// SetObjectStorageCredentials configures the credentials for collecting
+// certificates from object storage; nil sends anonymous requests
+func (s *PKISigner) SetObjectStorageCredentials(credentials map[string][]byte) error {
+	config := s.config.Async.ObjectStorage
+	store, err := newObjectStore(config, credentials, s.httpClient, s.clock)
+	if err != nil {
+		return err
+	}
+	s.objects = store
+	return nil
+}
+
+// collectObject fetches the certificate of an order from object storage,
+// verifying it against every checksum available
+func (s *PKISigner) collectObject(ctx context.Context, orderID string) (*http.Response, error) {
+	config := s.config.Async.ObjectStorage
+	if s.objects == nil {
+		if err := s.SetObjectStorageCredentials(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	key := objectKey(config.KeyPattern, orderID)
+	data, checksums, found, err := s.objects.get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s from bucket %s: %w", key, config.Bucket, err)
+	}
+	if !found {
+		return nil, &PendingError{OrderID: orderID}
+	}
+	if err := verifyStoreChecksums(data, checksums); err != nil {
+		return nil, fmt.Errorf("object %s: %w", key, err)
+	}
+
+	if config.ChecksumKeyPattern != "" {
+		checksumKey := objectKey(config.ChecksumKeyPattern, orderID)
+		sum, _, found, err := s.objects.get(ctx, checksumKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s from bucket %s: %w", checksumKey, config.Bucket, err)
+		}
+		// The checksum may be uploaded after the certificate
+		if !found {
+			return nil, &PendingError{OrderID: orderID}
+		}
+		fields := strings.Fields(string(sum))
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("checksum object %s is empty", checksumKey)
+		}
+		actual := sha256.Sum256(data)
+		if !strings.EqualFold(fields[0], hex.EncodeToString(actual[:])) {
+			return nil, fmt.Errorf("object %s does not match the SHA-256 in %s", key, checksumKey)
+		}
+	}
+
+	resp := QueueResponse{StatusCode: http.StatusOK, Body: data}
+	return resp.httpResponse(nil), nil
+}
+
+// verifyStoreChecksums compares an object with the checksums the store
+// returned: S3's SHA-256 checksum (for objects uploaded with one) or GCS's
+// MD5 hash. S3 ETags are not used, as they are no MD5 for encrypted objects.
+func verifyStoreChecksums(data []byte, checksums http.Header) error {
+	if v := checksums.Get("X-Amz-Checksum-Sha256"); v != "" {
+		sum := sha256.Sum256(data)
+		if v != base64.StdEncoding.EncodeToString(sum[:]) {
+			return fmt.Errorf("SHA-256 checksum mismatch")
+		}
+	}
+	for _, hash := range checksums.Values("X-Goog-Hash") {
+		for _, part := range strings.Split(hash, ",") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(part), "md5="); ok {
+				sum := md5.Sum(data) //nolint:gosec // Integrity check against the store, not a security boundary
+				if v != base64.StdEncoding.EncodeToString(sum[:]) {
+					return fmt.Errorf("MD5 checksum mismatch")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// readObject reads a response body, returning found=false for a missing object
+func readObject(resp *http.Response) ([]byte, http.Header, bool, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil, false, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxObjectSize+1))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, false, fmt.Errorf("status %d: %s", resp.StatusCode, summarizeBody(body))
+	}
+	if len(body) > maxObjectSize {
+		return nil, nil, false, fmt.Errorf("object exceeds %d bytes", maxObjectSize)
+	}
+	return body, resp.Header, true, nil
+}
+
+// summarizeBody shortens an error response for the error message
+func summarizeBody(body []byte) string {
+	const max = 256
+	if len(body) > max {
+		return string(body[:max]) + "..."
+	}
+	return string(body)
+}
+
+// s3Store reads objects with the S3 REST API, signed with AWS Signature Version 4
+type s3Store struct {
+	config          *PKIObjectStorage
+	httpClient      *http.Client
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	clock           clock.PassiveClock
+}
+
+func (s *s3Store) get(ctx context.Context, key string) ([]byte, http.Header, bool, error) {
+	region := s.config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := s.config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	// Path-style addressing works for AWS and S3-compatible stores alike
+	objectURL := strings.TrimSuffix(endpoint, "/") + "/" + s.config.Bucket + "/" + escapeObjectKey(key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, objectURL, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	req.Header.Set("x-amz-checksum-mode", "ENABLED")
+	if s.accessKeyID != "" {
+		s.sign(req, region, s.clock.Now().UTC())
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return readObject(resp)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to a GET request
+func (s *s3Store) sign(req *http.Request, region string, now time.Time) {
+	const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	req.Header.Set("x-amz-date", now.Format(amzDateFormat))
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", s.sessionToken)
+	}
+	signV4(req, s.accessKeyID, s.secretAccessKey, region, "s3", emptyPayloadHash, now)
+}
+
+// amzDateFormat is the format of the x-amz-date header
+const amzDateFormat = "20060102T150405Z"
+
+// signV4 adds an AWS Signature Version 4 Authorization header to a request
+// whose headers, including x-amz-date, are set. All of its headers are
+// signed, each with all of its values.
+func signV4(req *http.Request, accessKeyID, secretAccessKey, region, service, payloadHash string, now time.Time) {
+	amzDate := now.Format(amzDateFormat)
+	date := now.Format("20060102")
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery returns the query string of Signature Version 4: keys and
+// values URI-encoded, spaces as %20 rather than +, sorted by key and value
+func canonicalQuery(query url.Values) string {
+	type pair struct{ key, value string }
+	var pairs []pair
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, pair{uriEncode(key, false), uriEncode(value, false)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].key != pairs[j].key {
+			return pairs[i].key < pairs[j].key
+		}
+		return pairs[i].value < pairs[j].value
+	})
+	encoded := make([]string, len(pairs))
+	for i, p := range pairs {
+		encoded[i] = p.key + "=" + p.value
+	}
+	return strings.Join(encoded, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapeObjectKey URI-encodes every segment of an object key the way
+// Signature Version 4 expects, keeping the slashes
+func escapeObjectKey(key string) string {
+	return uriEncode(key, true)
+}
+
+// uriEncode percent-encodes everything but the unreserved characters of
+// RFC 3986, and slashes if keepSlash is set
+func uriEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// gcsStore reads objects with the GCS JSON API
+type gcsStore struct {
+	config     *PKIObjectStorage
+	httpClient *http.Client
+	tokens     oauth2.TokenSource
+}
+
+func (g *gcsStore) get(ctx context.Context, key string) ([]byte, http.Header, bool, error) {
+	endpoint := g.config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://storage.googleapis.com"
+	}
+	objectURL := strings.TrimSuffix(endpoint, "/") + "/storage/v1/b/" + url.PathEscape(g.config.Bucket) +
+		"/o/" + url.PathEscape(key) + "?alt=media"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, objectURL, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if g.tokens != nil {
+		token, err := g.tokens.Token()
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to get GCS access token: %w", err)
+		}
+		token.SetAuthHeader(req)
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return readObject(resp)
+}
+
+// gcsTokenSource exchanges a service account key for read-only access tokens
+func gcsTokenSource(serviceAccountJSON []byte, httpClient *http.Client) (oauth2.TokenSource, error) {
+	var key struct {
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		PrivateKeyID string `json:"private_key_id"`
+		TokenURI     string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(serviceAccountJSON, &key); err != nil {
+		return nil, fmt.Errorf("invalid service-account.json: %w", err)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("service-account.json requires client_email and private_key")
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	config := &jwt.Config{
+		Email:        key.ClientEmail,
+		PrivateKey:   bytes.TrimSpace([]byte(key.PrivateKey)),
+		PrivateKeyID: key.PrivateKeyID,
+		TokenURL:     key.TokenURI,
+		Scopes:       []string{"https://www.googleapis.com/auth/devstorage.read_only"},
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+	return oauth2.ReuseTokenSource(nil, config.TokenSource(ctx)), nil
+}
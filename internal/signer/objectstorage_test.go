@@ -0,0 +1,281 @@
+package signer
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec // Only used to build the GCS checksum header
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+// TestSignV4 checks the signer against the AWS Signature Version 4 test suite
+// (https://docs.aws.amazon.com/general/latest/gr/signature-v4-test-suite.html)
+func TestSignV4(t *testing.T) {
+	const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		url       string
+		headers   [][2]string
+		signature string
+	}{
+		{
+			name:      "get-vanilla",
+			url:       "https://example.amazonaws.com/",
+			signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:      "get-vanilla-query-order-key-case",
+			url:       "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name: "get-vanilla-query-unreserved",
+			url: "https://example.amazonaws.com/?-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz=" +
+				"-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+			signature: "9c3e54bfcdf0b19771a7f523ee5669cdf59bc7cc0884027167c21bb143a40197",
+		},
+		{
+			name:      "get-vanilla-utf8-query",
+			url:       "https://example.amazonaws.com/?ሴ=bar",
+			signature: "2cdec8eed098649ff3a119c94853b13c643bcf08f8b0a1d91e12c9027818dd04",
+		},
+		{
+			name:      "get-space",
+			url:       "https://example.amazonaws.com/example%20space/",
+			signature: "652487583200325589f1fba4c7e578f72c47cb61beeca81406b39ddec1366741",
+		},
+		{
+			name:      "get-utf8",
+			url:       "https://example.amazonaws.com/%E1%88%B4",
+			signature: "8318018e0b0f223aa2bbf98705b62bb787dc9c0e678f255a891fd03141be5d85",
+		},
+		{
+			name:      "get-header-key-duplicate",
+			url:       "https://example.amazonaws.com/",
+			headers:   [][2]string{{"My-Header1", "value2"}, {"My-Header1", "value2"}, {"My-Header1", "value1"}},
+			signature: "c9d5ea9f3f72853aea855b47ea873832890dbdd183b4468f858259531a5138ea",
+		},
+		{
+			name:      "get-header-value-trim",
+			url:       "https://example.amazonaws.com/",
+			headers:   [][2]string{{"My-Header1", " value1"}, {"My-Header2", ` "a   b   c"`}},
+			signature: "acc3ed3afb60bb290fc8d2dd0098b9911fcaa05412b367055dee359757a9c736",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, h := range tt.headers {
+				req.Header.Add(h[0], h[1])
+			}
+			req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+
+			signV4(req, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", emptyPayloadHash, now)
+
+			auth := req.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, ") {
+				t.Errorf("Authorization %q has the wrong credential scope", auth)
+			}
+			if !strings.HasSuffix(auth, ", Signature="+tt.signature) {
+				t.Errorf("Authorization %q, want signature %s", auth, tt.signature)
+			}
+		})
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := []struct {
+		query url.Values
+		want  string
+	}{
+		{url.Values{"a": {"b c"}}, "a=b%20c"},
+		{url.Values{"b": {"2", "1"}, "a": {"3"}}, "a=3&b=1&b=2"},
+		{url.Values{"a-b": {"1"}, "a": {"2"}}, "a=2&a-b=1"},
+		{url.Values{"k": {"a+b/c=d"}}, "k=a%2Bb%2Fc%3Dd"},
+		{url.Values{}, ""},
+	}
+	for _, tt := range tests {
+		if got := canonicalQuery(tt.query); got != tt.want {
+			t.Errorf("canonicalQuery(%v) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestCollectObject(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	cert := []byte("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n")
+	sha := sha256.Sum256(cert)
+	md5sum := md5.Sum(cert) //nolint:gosec // GCS reports MD5 hashes
+	otherSHA := sha256.Sum256([]byte("other"))
+
+	type object struct {
+		data    string
+		headers map[string]string
+	}
+	tests := []struct {
+		name     string
+		provider string
+		checksum bool
+		objects  map[string]object
+		pending  bool
+		wantErr  string
+	}{
+		{
+			name:     "s3",
+			provider: "s3",
+			objects: map[string]object{
+				"/certs/orders/42.pem": {string(cert), map[string]string{"X-Amz-Checksum-Sha256": base64.StdEncoding.EncodeToString(sha[:])}},
+			},
+		},
+		{
+			name:     "s3 not yet uploaded",
+			provider: "s3",
+			pending:  true,
+		},
+		{
+			name:     "s3 checksum mismatch",
+			provider: "s3",
+			objects: map[string]object{
+				"/certs/orders/42.pem": {string(cert), map[string]string{"X-Amz-Checksum-Sha256": base64.StdEncoding.EncodeToString(otherSHA[:])}},
+			},
+			wantErr: "SHA-256 checksum mismatch",
+		},
+		{
+			name:     "s3 checksum object",
+			provider: "s3",
+			checksum: true,
+			objects: map[string]object{
+				"/certs/orders/42.pem":        {string(cert), nil},
+				"/certs/orders/42.pem.sha256": {hex.EncodeToString(sha[:]) + "  42.pem\n", nil},
+			},
+		},
+		{
+			name:     "s3 checksum object not yet uploaded",
+			provider: "s3",
+			checksum: true,
+			objects: map[string]object{
+				"/certs/orders/42.pem": {string(cert), nil},
+			},
+			pending: true,
+		},
+		{
+			name:     "s3 checksum object mismatch",
+			provider: "s3",
+			checksum: true,
+			objects: map[string]object{
+				"/certs/orders/42.pem":        {string(cert), nil},
+				"/certs/orders/42.pem.sha256": {hex.EncodeToString(otherSHA[:]) + "  42.pem\n", nil},
+			},
+			wantErr: "does not match the SHA-256",
+		},
+		{
+			name:     "gcs",
+			provider: "gcs",
+			objects: map[string]object{
+				"/storage/v1/b/certs/o/orders/42.pem": {string(cert), map[string]string{"X-Goog-Hash": "crc32c=AAAAAA==,md5=" + base64.StdEncoding.EncodeToString(md5sum[:])}},
+			},
+		},
+		{
+			name:     "gcs not yet uploaded",
+			provider: "gcs",
+			pending:  true,
+		},
+		{
+			name:     "gcs checksum mismatch",
+			provider: "gcs",
+			objects: map[string]object{
+				"/storage/v1/b/certs/o/orders/42.pem": {string(cert), map[string]string{"X-Goog-Hash": "md5=AAAAAAAAAAAAAAAAAAAAAA=="}},
+			},
+			wantErr: "MD5 checksum mismatch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.provider == "s3" {
+					auth := r.Header.Get("Authorization")
+					if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20250102/") || r.Header.Get("X-Amz-Date") != "20250102T030405Z" {
+						http.Error(w, "unsigned request", http.StatusForbidden)
+						return
+					}
+				} else if r.URL.Query().Get("alt") != "media" {
+					http.Error(w, "metadata requested", http.StatusBadRequest)
+					return
+				}
+				obj, ok := tt.objects[r.URL.Path]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				for k, v := range obj.headers {
+					w.Header().Set(k, v)
+				}
+				_, _ = io.WriteString(w, obj.data)
+			}))
+			defer server.Close()
+
+			storage := &PKIObjectStorage{
+				Provider:   tt.provider,
+				Bucket:     "certs",
+				KeyPattern: "orders/{id}.pem",
+				Endpoint:   server.URL,
+			}
+			if tt.checksum {
+				storage.ChecksumKeyPattern = "orders/{id}.pem.sha256"
+			}
+			s, err := NewPKISigner(&PKIConfig{BaseURL: server.URL + "/sign", Async: &PKIAsync{ObjectStorage: storage}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.SetClock(clocktesting.NewFakePassiveClock(now))
+			if tt.provider == "s3" {
+				err := s.SetObjectStorageCredentials(map[string][]byte{
+					"access-key-id":     []byte("AKIDEXAMPLE"),
+					"secret-access-key": []byte("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			resp, err := s.collectObject(context.Background(), "42")
+			var pending *PendingError
+			switch {
+			case tt.pending:
+				if !errors.As(err, &pending) {
+					t.Fatalf("collectObject returned %v, want a PendingError", err)
+				}
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("collectObject returned %v, want an error containing %q", err, tt.wantErr)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+				body, _ := io.ReadAll(resp.Body)
+				if string(body) != string(cert) {
+					t.Errorf("collected %q, want %q", body, cert)
+				}
+			}
+		})
+	}
+}
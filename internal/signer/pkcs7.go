@@ -0,0 +1,87 @@
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// oidSignedData is the PKCS#7 signedData content type (1.2.840.113549.1.7.2)
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+// pkcs7ContentInfo is the outer PKCS#7 ContentInfo structure
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// pkcs7SignedData is the PKCS#7 SignedData structure. Only the certificate
+// set is used; "certs-only" bundles returned by most CAs carry no signers.
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// parsePKCS7Certificates extracts the certificates from a PKCS#7 bundle.
+// The bundle may be PEM ("PKCS7" or "CERTIFICATE" blocks), base64 or raw DER.
+func parsePKCS7Certificates(data []byte) ([]*x509.Certificate, error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		der = block.Bytes
+	} else if decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), "")); err == nil {
+		der = decoded
+	}
+
+	var ci pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 content info: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("unsupported PKCS#7 content type %s", ci.ContentType)
+	}
+
+	var sd pkcs7SignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signed data: %w", err)
+	}
+	if len(sd.Certificates.Bytes) == 0 {
+		return nil, fmt.Errorf("no certificates in PKCS#7 bundle")
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 certificates: %w", err)
+	}
+	return certs, nil
+}
+
+// pkcs7ToPEM converts a PKCS#7 bundle into a PEM chain with the leaf first.
+// PKCS#7 certificate sets are unordered, so the first non-CA certificate is
+// moved to the front and the remaining certificates keep their order.
+func pkcs7ToPEM(data []byte) ([]byte, error) {
+	certs, err := parsePKCS7Certificates(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, cert := range certs {
+		if !cert.IsCA {
+			copy(certs[1:i+1], certs[:i])
+			certs[0] = cert
+			break
+		}
+	}
+
+	var out []byte
+	for _, cert := range certs {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return out, nil
+}
@@ -0,0 +1,131 @@
+package signer
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+)
+
+// presets return the settings of PKI products that configurations start
+// from with "preset"; site-specific settings such as the base URL, auth and
+// profiles are left to the configuration.
+//
+// There is no globalsign preset: GlobalSign Atlas (HVCA) takes the subject
+// and validity as nested JSON objects and a public key instead of a CSR, and
+// authenticates with a client certificate and a login call, none of which a
+// PKIConfig can express.
+var presets = map[string]func() PKIConfig{
+	// EJBCA REST API, POST /ejbca/ejbca-rest-api/v1/certificate/pkcs10enroll
+	"ejbca": func() PKIConfig {
+		return PKIConfig{
+			Method: "POST",
+			Parameters: PKIParameters{
+				ParamFormat: "json",
+				GetCSRParam: "certificate_request",
+				ExtraParams: map[string]string{"include_chain": "true"},
+			},
+			Response: PKIResponse{
+				Format:              "json",
+				CertificateField:    "certificate",
+				ChainField:          "certificate_chain",
+				CertificateEncoding: "base64-der",
+				SuccessStatusCodes:  []int{200, 201},
+			},
+		}
+	},
+
+	// Active Directory Certificate Services web enrollment, POST
+	// /certsrv/certfnsh.asp; the certificate is collected from certnew.p7b
+	// with the request ID of the returned page
+	"adcs-certsrv": func() PKIConfig {
+		return PKIConfig{
+			Method: "POST",
+			Parameters: PKIParameters{
+				NewCertParam: "Mode",
+				NewCertValue: "newreq",
+				GetCSRParam:  "CertRequest",
+				ExtraParams: map[string]string{
+					"CertAttrib":       "CertificateTemplate:WebServer",
+					"TargetStoreFlags": "0",
+					"SaveCert":         "yes",
+				},
+			},
+			Response: PKIResponse{
+				Format: "pkcs7",
+			},
+			Async: &PKIAsync{
+				OrderIDPattern: `(?:ReqID=|Request Id is )(\d+)`,
+			},
+		}
+	},
+
+	// CGI endpoints of legacy PKIs, as emulated by the Mock CA at /cgi/pki.cgi
+	"legacy-pki-cgi": func() PKIConfig {
+		return PKIConfig{
+			Method: "POST",
+			Parameters: PKIParameters{
+				ParamFormat:     "semicolon",
+				SubjectDNFormat: "slash",
+				NewCertParam:    "new",
+				NewCertValue:    "1",
+				RenewCertParam:  "renew",
+				RenewCertValue:  "1",
+				SubjectParam:    "subject",
+				DNSPrefix:       "DNS",
+				DNSStartIndex:   2,
+				DNSMaxCount:     20,
+			},
+			Response: PKIResponse{
+				Format: "pem",
+			},
+		}
+	},
+}
+
+func init() {
+	// PrimeKey appliances run EJBCA Enterprise, which serves the same REST API
+	presets["primekey"] = presets["ejbca"]
+}
+
+// PresetNames returns the names of the presets, sorted
+func PresetNames() []string {
+	return slices.Sorted(maps.Keys(presets))
+}
+
+// Preset returns the settings of a preset, or false if there is none of that name
+func Preset(name string) (PKIConfig, bool) {
+	preset, ok := presets[name]
+	if !ok {
+		return PKIConfig{}, false
+	}
+	config := preset()
+	config.Preset = name
+	return config, true
+}
+
+// UnmarshalJSON decodes a configuration on top of the settings of its
+// preset, so fields it sets override the preset's. Objects are merged field
+// by field, lists are replaced, and null clears a setting of the preset.
+// Unknown presets are left to validation.
+func (c *PKIConfig) UnmarshalJSON(data []byte) error {
+	var preset struct {
+		Preset string `json:"preset"`
+	}
+	if err := json.Unmarshal(data, &preset); err != nil {
+		return err
+	}
+
+	// plain has the fields of PKIConfig without this method
+	type plain PKIConfig
+	var config plain
+	if preset.Preset != "" {
+		if defaults, ok := Preset(preset.Preset); ok {
+			config = plain(defaults)
+		}
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	*c = PKIConfig(config)
+	return nil
+}
@@ -0,0 +1,125 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"maps"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// pkcs10ContentType is the media type of a CSR (RFC 5967)
+const pkcs10ContentType = "application/pkcs10"
+
+// encodeSigningRequest encodes the POST body of a signing request in the
+// configured parameter format, returning the URL of endpoint to send it to,
+// the body and its content type. Formats that upload the CSR as a file or as
+// the body take it from csr; raw-der moves the other parameters to the query
+// string.
+func (s *PKISigner) encodeSigningRequest(endpoint string, params url.Values, csr *x509.CertificateRequest) (string, string, string, error) {
+	cfg := s.config.Parameters
+	switch cfg.ParamFormat {
+	case "multipart":
+		file := &multipartFile{field: cfg.GetCSRParam, name: "csr.pem", data: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})}
+		if cfg.CSRFormat == "der" {
+			file.name, file.data = "csr.der", csr.Raw
+		}
+		body, contentType, err := encodeMultipart(params, file)
+		return endpoint, body, contentType, err
+	case "raw-der":
+		requestURL := endpoint
+		if len(params) > 0 {
+			separator := "?"
+			if strings.Contains(requestURL, "?") {
+				separator = "&"
+			}
+			requestURL += separator + params.Encode()
+		}
+		return requestURL, string(csr.Raw), pkcs10ContentType, nil
+	default:
+		body, contentType, err := encodeParams(params, cfg.ParamFormat)
+		return endpoint, body, contentType, err
+	}
+}
+
+// encodeParams encodes request parameters in a parameter format, returning
+// the body and its content type
+func encodeParams(params url.Values, format string) (string, string, error) {
+	switch format {
+	case "json":
+		// JSON object: {"key":"value","key2":"value2"}
+		fields := make(map[string]string, len(params))
+		for key, values := range params {
+			if len(values) > 0 {
+				fields[key] = values[0]
+			}
+		}
+		encoded, err := json.Marshal(fields)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to encode JSON request: %w", err)
+		}
+		return string(encoded), "application/json", nil
+	case "multipart":
+		return encodeMultipart(params, nil)
+	case "semicolon":
+		// Legacy PKI format: key=value;key2=value2
+		var parts []string
+		for key, values := range params {
+			if len(values) > 0 && values[0] != "" {
+				parts = append(parts, key+"="+values[0])
+			} else if len(values) > 0 {
+				parts = append(parts, key)
+			}
+		}
+		return strings.Join(parts, ";"), "text/plain", nil
+	default:
+		// Standard URL-encoded format: key=value&key2=value2
+		return params.Encode(), "application/x-www-form-urlencoded", nil
+	}
+}
+
+// multipartFile is a file field of a multipart/form-data body
+type multipartFile struct {
+	field string
+	name  string
+	data  []byte
+}
+
+// encodeMultipart encodes parameters as multipart/form-data fields, sorted
+// by name; the parameter named like file is replaced by the file
+func encodeMultipart(params url.Values, file *multipartFile) (string, string, error) {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	for _, key := range slices.Sorted(maps.Keys(params)) {
+		if file != nil && key == file.field {
+			continue
+		}
+		for _, value := range params[key] {
+			if err := w.WriteField(key, value); err != nil {
+				return "", "", fmt.Errorf("failed to encode multipart request: %w", err)
+			}
+		}
+	}
+	if file != nil {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, file.field, file.name))
+		header.Set("Content-Type", pkcs10ContentType)
+		part, err := w.CreatePart(header)
+		if err == nil {
+			_, err = part.Write(file.data)
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("failed to encode multipart request: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", "", fmt.Errorf("failed to encode multipart request: %w", err)
+	}
+	return b.String(), w.FormDataContentType(), nil
+}
@@ -0,0 +1,126 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestEncodeSigningRequest(t *testing.T) {
+	block, _ := pem.Decode(testCSR(t))
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := url.Values{"profile": {"server"}, "csr": {string(testCSR(t))}}
+	const endpoint = "https://pki.example.com/sign?tenant=a"
+
+	encode := func(t *testing.T, format, csrFormat string) (string, string, string) {
+		t.Helper()
+		s := &PKISigner{config: &PKIConfig{Parameters: PKIParameters{ParamFormat: format, GetCSRParam: "csr", CSRFormat: csrFormat}}}
+		requestURL, body, contentType, err := s.encodeSigningRequest(endpoint, params, csr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return requestURL, body, contentType
+	}
+
+	t.Run("json", func(t *testing.T) {
+		requestURL, body, contentType := encode(t, "json", "")
+		if requestURL != endpoint || contentType != "application/json" {
+			t.Fatalf("sent to %s as %s, want %s as application/json", requestURL, contentType, endpoint)
+		}
+		var fields map[string]string
+		if err := json.Unmarshal([]byte(body), &fields); err != nil {
+			t.Fatalf("body %q is not a JSON object of strings: %v", body, err)
+		}
+		if fields["profile"] != "server" || fields["csr"] != params.Get("csr") {
+			t.Errorf("JSON fields %v, want the parameters", fields)
+		}
+	})
+
+	t.Run("form", func(t *testing.T) {
+		_, body, contentType := encode(t, "", "")
+		if contentType != "application/x-www-form-urlencoded" || body != params.Encode() {
+			t.Errorf("body %q as %s, want the URL-encoded parameters", body, contentType)
+		}
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		for _, csrFormat := range []string{"pem", "der"} {
+			_, body, contentType := encode(t, "multipart", csrFormat)
+			mediaType, mediaParams, err := mime.ParseMediaType(contentType)
+			if err != nil || mediaType != "multipart/form-data" {
+				t.Fatalf("content type %q, want multipart/form-data", contentType)
+			}
+			form, err := multipart.NewReader(strings.NewReader(body), mediaParams["boundary"]).ReadForm(1 << 20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := form.Value["profile"]; len(got) != 1 || got[0] != "server" {
+				t.Errorf("%s: profile field %v, want server", csrFormat, got)
+			}
+			if _, ok := form.Value["csr"]; ok {
+				t.Errorf("%s: CSR sent as a field as well as a file", csrFormat)
+			}
+			files := form.File["csr"]
+			if len(files) != 1 {
+				t.Fatalf("%s: %d CSR files, want 1", csrFormat, len(files))
+			}
+			f, err := files[0].Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(f)
+			f.Close()
+			want := csr.Raw
+			if csrFormat == "pem" {
+				want = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})
+			}
+			if string(data) != string(want) {
+				t.Errorf("%s: uploaded CSR differs from the %s encoding", csrFormat, csrFormat)
+			}
+		}
+	})
+
+	t.Run("raw-der", func(t *testing.T) {
+		requestURL, body, contentType := encode(t, "raw-der", "")
+		if contentType != pkcs10ContentType || body != string(csr.Raw) {
+			t.Errorf("body as %s, want the DER CSR as %s", contentType, pkcs10ContentType)
+		}
+		u, err := url.Parse(requestURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q := u.Query(); q.Get("tenant") != "a" || q.Get("profile") != "server" {
+			t.Errorf("query %q, want the endpoint's query and the parameters", u.RawQuery)
+		}
+	})
+}
+
+// testCSR returns a PEM CSR for a test DNS name
+func testCSR(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "app.example.com"},
+		DNSNames: []string{"app.example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
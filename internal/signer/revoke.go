@@ -0,0 +1,183 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/revocation"
+)
+
+// ErrRevocationNotConfigured is returned by Revoke when the PKI configuration
+// has no revocation endpoint
+var ErrRevocationNotConfigured = errors.New("revocation is not configured")
+
+// PKIRevocation configures revocation of issued certificates through the PKI API
+type PKIRevocation struct {
+	// URL is the revocation endpoint; "{serial}" is replaced with the serial number
+	URL string `json:"url"`
+
+	// Method is the HTTP method to use: POST (default), PUT or DELETE
+	Method string `json:"method,omitempty"`
+
+	// SerialFormat is the serial number format: "hex" (default, lowercase
+	// without colons) or "decimal"
+	SerialFormat string `json:"serialFormat,omitempty"`
+
+	// SerialParam is the body parameter carrying the serial number, if any
+	SerialParam string `json:"serialParam,omitempty"`
+
+	// ReasonParam is the body parameter carrying the revocation reason, if any
+	ReasonParam string `json:"reasonParam,omitempty"`
+
+	// ReasonFormat is how the reason is sent: "name" (default, the RFC 5280
+	// name such as keyCompromise) or "code" (the CRLReason code such as 1)
+	ReasonFormat string `json:"reasonFormat,omitempty"`
+
+	// UnholdURL is the endpoint releasing a certificate from hold; "{serial}"
+	// is replaced with the serial number. Without it, certificates are released
+	// by revoking them with reason removeFromCRL, which needs reasonParam.
+	UnholdURL string `json:"unholdUrl,omitempty"`
+
+	// UnholdMethod is the HTTP method of unholdUrl: POST (default), PUT or DELETE
+	UnholdMethod string `json:"unholdMethod,omitempty"`
+
+	// ParamFormat is the body format, as in parameters.paramFormat except
+	// raw-der (default: the format of signing requests, ampersand for raw-der)
+	ParamFormat string `json:"paramFormat,omitempty"`
+}
+
+// FormatSerial formats a serial number for the revocation API
+func (r *PKIRevocation) FormatSerial(serial *big.Int) string {
+	if r.SerialFormat == "decimal" {
+		return serial.String()
+	}
+	return serial.Text(16)
+}
+
+// FormatReason formats a revocation reason for the revocation API
+func (r *PKIRevocation) FormatReason(name string, code int) string {
+	if r.ReasonFormat == "code" {
+		return strconv.Itoa(code)
+	}
+	return name
+}
+
+// Revoke revokes the certificate with the given serial number. The reason is
+// an RFC 5280 reason name or code; certificateHold suspends the certificate
+// until Unhold. It returns when the PKI API accepted the revocation.
+func (s *PKISigner) Revoke(ctx context.Context, serial *big.Int, reason string) (time.Time, error) {
+	revocationConfig, err := s.revocationConfig()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if reason == "" {
+		return s.sendRevocation(ctx, revocationConfig.Method, revocationConfig.URL, serial, "", "revoking")
+	}
+	name, code, err := revocation.Parse(reason)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if name == revocation.RemoveFromCRL {
+		return time.Time{}, fmt.Errorf("reason %s releases a held certificate, not revokes it", name)
+	}
+	return s.sendRevocation(ctx, revocationConfig.Method, revocationConfig.URL, serial, revocationConfig.FormatReason(name, code), "revoking")
+}
+
+// Unhold releases a certificate revoked with reason certificateHold, through
+// unholdUrl or else by revoking it with reason removeFromCRL. It returns when
+// the PKI API accepted the release.
+func (s *PKISigner) Unhold(ctx context.Context, serial *big.Int) (time.Time, error) {
+	revocationConfig, err := s.revocationConfig()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if revocationConfig.UnholdURL != "" {
+		return s.sendRevocation(ctx, revocationConfig.UnholdMethod, revocationConfig.UnholdURL, serial, "", "releasing")
+	}
+	if revocationConfig.ReasonParam == "" {
+		return time.Time{}, fmt.Errorf("%w: releasing held certificates needs unholdUrl or reasonParam", ErrRevocationNotConfigured)
+	}
+	_, code, _ := revocation.Parse(revocation.RemoveFromCRL)
+	return s.sendRevocation(ctx, revocationConfig.Method, revocationConfig.URL, serial,
+		revocationConfig.FormatReason(revocation.RemoveFromCRL, code), "releasing")
+}
+
+// revocationConfig returns the revocation configuration, failing if the
+// backend can't revoke certificates
+func (s *PKISigner) revocationConfig() (*PKIRevocation, error) {
+	revocationConfig := s.config.Revocation
+	if revocationConfig == nil || revocationConfig.URL == "" {
+		return nil, ErrRevocationNotConfigured
+	}
+	// Request files are answered by certificates, never by revocation results
+	if s.files != nil {
+		return nil, fmt.Errorf("%w: not supported with transport type file", ErrRevocationNotConfigured)
+	}
+	return revocationConfig, nil
+}
+
+// sendRevocation sends a revocation or release request for a serial number
+// with an optional formatted reason; action names the request in errors
+func (s *PKISigner) sendRevocation(ctx context.Context, method, rawURL string, serial *big.Int, reason, action string) (time.Time, error) {
+	revocationConfig := s.config.Revocation
+	method = strings.ToUpper(method)
+	if method == "" {
+		method = "POST"
+	}
+	format := revocationConfig.ParamFormat
+	if format == "" {
+		format = s.config.Parameters.ParamFormat
+	}
+
+	formatted := revocationConfig.FormatSerial(serial)
+	params := url.Values{}
+	if revocationConfig.SerialParam != "" {
+		params.Set(revocationConfig.SerialParam, formatted)
+	}
+	if revocationConfig.ReasonParam != "" && reason != "" {
+		params.Set(revocationConfig.ReasonParam, reason)
+	}
+
+	var body io.Reader
+	var contentType string
+	if len(params) > 0 {
+		encoded, ct, err := encodeParams(params, format)
+		if err != nil {
+			return time.Time{}, err
+		}
+		body, contentType = strings.NewReader(encoded), ct
+	}
+
+	requestURL := strings.ReplaceAll(rawURL, "{serial}", url.PathEscape(formatted))
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, body)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create revocation request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if err := s.addAuth(req); err != nil {
+		return time.Time{}, err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("revocation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	s.checkAuthRejected(resp.StatusCode)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return time.Time{}, fmt.Errorf("PKI API error %s certificate %s: %d, %s", action, formatted, resp.StatusCode, string(respBody))
+	}
+	return s.clock.Now(), nil
+}
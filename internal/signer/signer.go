@@ -1,26 +1,42 @@
 package signer
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
-	"math/big"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/tracing"
+	"golang.org/x/net/http/httpproxy"
+	"k8s.io/utils/clock"
 )
 
 // PKIConfig holds configuration for connecting to an external PKI API
 type PKIConfig struct {
+	// Preset pre-populates the settings of a PKI product, such as "ejbca" or
+	// "adcs-certsrv"; the other fields of the configuration override them
+	Preset string `json:"preset,omitempty"`
+
 	// BaseURL is the full URL to the PKI API endpoint
 	BaseURL string `json:"baseUrl"`
 
+	// Endpoints are further URLs of the PKI API that signing requests fail
+	// over to when an endpoint is unreachable or answers with a server error
+	Endpoints []PKIEndpoint `json:"endpoints,omitempty"`
+
 	// Method is the HTTP method to use (GET or POST)
 	Method string `json:"method"`
 
@@ -35,11 +51,34 @@ type PKIConfig struct {
 
 	// TLS configures TLS settings
 	TLS *PKITLS `json:"tls,omitempty"`
+
+	// Proxy is the URL of a forward proxy used to reach the PKI API
+	// Supported schemes: http, https, socks5, socks5h
+	// When empty, HTTPS_PROXY/HTTP_PROXY/NO_PROXY from the environment are honored
+	Proxy string `json:"proxy,omitempty"`
+
+	// Async enables asynchronous issuance, where the PKI API answers with an
+	// order ID that is polled until the certificate is available
+	Async *PKIAsync `json:"async,omitempty"`
+
+	// Transport sends requests over a message queue instead of HTTP
+	Transport *PKITransport `json:"transport,omitempty"`
+
+	// Revocation enables revoking certificates through the PKI API
+	Revocation *PKIRevocation `json:"revocation,omitempty"`
+
+	// ErrorMappings map error responses of the PKI API to condition reasons,
+	// retry classes and messages; the first matching mapping applies
+	ErrorMappings []PKIErrorMapping `json:"errorMappings,omitempty"`
 }
 
 // PKIParameters configures request parameters for the PKI API
 type PKIParameters struct {
-	// ParamFormat is the parameter format: "ampersand" (default) or "semicolon" (legacy PKI format)
+	// ParamFormat is the parameter format: "ampersand" (default), "semicolon" (legacy PKI format),
+	// "json" (parameters sent as a JSON object in a POST body), "multipart"
+	// (multipart/form-data POST body with the CSR uploaded as the file field
+	// GetCSRParam) or "raw-der" (the DER-encoded CSR as an application/pkcs10
+	// POST body, the other parameters in the query string)
 	ParamFormat string `json:"paramFormat"`
 
 	// NewCertParam is the parameter name for new certificate requests
@@ -60,6 +99,20 @@ type PKIParameters struct {
 	// SubjectDNFormat is the DN format: "comma" (default) or "slash" (legacy format: /C=US/ST=California/L=San Francisco/O=Example/CN=...)
 	SubjectDNFormat string `json:"subjectDNFormat"`
 
+	// SubjectRDNOrder is the order of attribute types in the subject DN as
+	// written, e.g. ["C", "O", "CN"]; short names or dotted OIDs, unlisted
+	// types follow in the default order of SubjectDNFormat
+	SubjectRDNOrder []string `json:"subjectRDNOrder,omitempty"`
+
+	// SubjectCharset is the character set of subject attribute values the PKI
+	// accepts: "utf8" (default), "ascii" or "printable" (ASN.1 PrintableString);
+	// requests with other characters fail before they are sent
+	SubjectCharset string `json:"subjectCharset,omitempty"`
+
+	// SubjectTransliterate spells subject attribute values in ASCII where
+	// possible (e.g. "Müller" as "Muller") before checking SubjectCharset
+	SubjectTransliterate bool `json:"subjectTransliterate,omitempty"`
+
 	// DNSPrefix is the prefix for SAN DNS parameters (e.g., "DNS" -> "DNS2", "DNS3")
 	DNSPrefix string `json:"dnsPrefix"`
 
@@ -69,19 +122,55 @@ type PKIParameters struct {
 	// DNSMaxCount is the maximum number of DNS SANs to include
 	DNSMaxCount int `json:"dnsMaxCount"`
 
+	// URIParam is the parameter name for URI SANs such as SPIFFE IDs; several
+	// are sent comma-separated
+	URIParam string `json:"uriParam,omitempty"`
+
 	// GetCertParam is the parameter to request certificate in response
 	GetCertParam string `json:"getCertParam"`
 
 	// GetKeyParam is the parameter to request private key (rarely used)
 	GetKeyParam string `json:"getKeyParam"`
 
-	// GetCSRParam is the parameter name to send the CSR
+	// GetCSRParam is the parameter name to send the PEM-encoded CSR, so the
+	// PKI certifies the requester's key; required to issue CA certificates
+	// that cert-manager can use for nested issuer hierarchies
 	GetCSRParam string `json:"getCSRParam"`
+
+	// CSRFormat is the encoding of the CSR file uploaded with ParamFormat
+	// multipart: "pem" (default) or "der"
+	CSRFormat string `json:"csrFormat,omitempty"`
+
+	// CAParam is the parameter requesting a subordinate CA certificate;
+	// CA requests are rejected when it is not set
+	CAParam string `json:"caParam,omitempty"`
+
+	// CAValue is the value of CAParam for CA requests (default: "true")
+	CAValue string `json:"caValue,omitempty"`
+
+	// OriginParams send metadata of the Ingress or Gateway a certificate
+	// terminates on, mapping origin fields ("kind", "name", "namespace" or an
+	// attribute such as "site-id") to parameter names
+	OriginParams map[string]string `json:"originParams,omitempty"`
+
+	// RequesterParams send the identity of the user or ServiceAccount that
+	// created the CertificateRequest, mapping requester fields ("username",
+	// "uid", "groups" or "extra.<key>") to parameter names; fields with
+	// several values are sent comma-separated
+	RequesterParams map[string]string `json:"requesterParams,omitempty"`
+
+	// RequesterHeaders send requester fields as HTTP headers instead, e.g.
+	// {"username": "X-Requested-By"}
+	RequesterHeaders map[string]string `json:"requesterHeaders,omitempty"`
+
+	// ExtraParams are fixed parameters sent with every signing request, such
+	// as the certificate profile or template to issue from
+	ExtraParams map[string]string `json:"extraParams,omitempty"`
 }
 
 // PKIResponse configures how to parse the PKI API response
 type PKIResponse struct {
-	// Format is the response format: "pem", "json", "base64"
+	// Format is the response format: "pem", "json", "base64", "pkcs7"
 	Format string `json:"format"`
 
 	// CertificateField is the JSON field containing the certificate (if format=json)
@@ -89,11 +178,64 @@ type PKIResponse struct {
 
 	// ChainField is the JSON field containing the CA chain (if format=json)
 	ChainField string `json:"chainField,omitempty"`
+
+	// CertificateEncoding is the encoding of the certificates in CertificateField
+	// and ChainField: "pem" (default) or "base64-der", where ChainField may
+	// also hold an array of certificates
+	CertificateEncoding string `json:"certificateEncoding,omitempty"`
+
+	// MaxChainCertificates is the maximum number of certificates (leaf included)
+	// accepted in a response (default: 10)
+	MaxChainCertificates int `json:"maxChainCertificates,omitempty"`
+
+	// MaxChainBytes is the maximum size in bytes of the returned certificate chain (default: 65536)
+	MaxChainBytes int `json:"maxChainBytes,omitempty"`
+
+	// MaxBackdateSeconds is how far NotBefore of a returned certificate may lie
+	// before the request was sent; certificates that are not valid yet when
+	// received are rejected as well (default: 0, not checked)
+	MaxBackdateSeconds int `json:"maxBackdateSeconds,omitempty"`
+
+	// MaxResponseBytes is the maximum size in bytes of a response body read
+	// from the PKI API (default: 4194304)
+	MaxResponseBytes int `json:"maxResponseBytes,omitempty"`
+
+	// ContentTypes are the media types accepted for successful responses,
+	// e.g. "application/json" or "text/*" (default: any but text/html)
+	ContentTypes []string `json:"contentTypes,omitempty"`
+
+	// SuccessStatusCodes are the HTTP status codes of successful responses (default: [200])
+	SuccessStatusCodes []int `json:"successStatusCodes,omitempty"`
+
+	// StatusField is the JSON field telling whether the request succeeded,
+	// for PKIs that report errors with a success status code
+	StatusField string `json:"statusField,omitempty"`
+
+	// SuccessValues are the values of StatusField meaning success
+	SuccessValues []string `json:"successValues,omitempty"`
+
+	// ErrorCodeField is the JSON field of error responses holding the vendor error code
+	ErrorCodeField string `json:"errorCodeField,omitempty"`
+
+	// ErrorCodes map vendor error codes to retry classes: "retry", "pending"
+	// or "fail"; unmapped codes are retried
+	ErrorCodes map[string]string `json:"errorCodes,omitempty"`
 }
 
+const (
+	// defaultMaxChainCertificates bounds the chain length when not configured
+	defaultMaxChainCertificates = 10
+
+	// defaultMaxChainBytes bounds the chain size when not configured
+	defaultMaxChainBytes = 64 * 1024
+
+	// defaultMaxResponseBytes bounds response bodies when not configured
+	defaultMaxResponseBytes = 4 << 20
+)
+
 // PKIAuth configures authentication for the PKI API
 type PKIAuth struct {
-	// Type is the authentication type: "bearer", "basic", "header", "none"
+	// Type is the authentication type: "bearer", "basic", "header", "kubernetes", "none"
 	Type string `json:"type"`
 
 	// HeaderName is the custom header name (for type=header)
@@ -101,6 +243,34 @@ type PKIAuth struct {
 
 	// SecretRef is the name of the Secret containing credentials
 	SecretRef string `json:"secretRef,omitempty"`
+
+	// Audience is the audience of the requested ServiceAccount token (for type=kubernetes)
+	Audience string `json:"audience,omitempty"`
+
+	// ExpirationSeconds is the lifetime of requested ServiceAccount tokens (for type=kubernetes, default 3600)
+	ExpirationSeconds int64 `json:"expirationSeconds,omitempty"`
+
+	// TokenPath reads a projected ServiceAccount token from this file instead of
+	// requesting one (for type=kubernetes)
+	TokenPath string `json:"tokenPath,omitempty"`
+
+	// Refresh obtains short-lived access tokens from an OAuth token endpoint
+	// instead of sending a static token (for type=bearer and type=header)
+	Refresh *PKIAuthRefresh `json:"refresh,omitempty"`
+}
+
+// PKIAuthRefresh configures the OAuth flow access tokens are obtained with
+type PKIAuthRefresh struct {
+	// TokenURL is the OAuth token endpoint
+	TokenURL string `json:"tokenURL"`
+
+	// GrantType is "refresh_token" (default), using the refresh-token key of
+	// the auth Secret, or "client_credentials", using its client-id and
+	// client-secret keys
+	GrantType string `json:"grantType,omitempty"`
+
+	// Scopes are requested with every token
+	Scopes []string `json:"scopes,omitempty"`
 }
 
 // PKITLS configures TLS settings for the PKI API connection
@@ -114,28 +284,140 @@ type PKITLS struct {
 
 // PKISigner implements certificate signing via an external PKI API
 type PKISigner struct {
-	config     *PKIConfig
-	httpClient *http.Client
-	authToken  string
+	config       *PKIConfig
+	httpClient   *http.Client
+	queue        *queueTransport
+	files        *fileDrop
+	objects      objectStore
+	authToken    string
+	username     string
+	password     string
+	authRejected func()
+	tokenSource  TokenSource
+	subject      *SubjectOverride
+	origin       map[string]string
+	requester    map[string]string
+	isCA         bool
+	maxBackdate  *time.Duration
+	clock        clock.PassiveClock
+
+	// orderIDPattern is the compiled async.orderIdPattern
+	orderIDPattern *regexp.Regexp
 }
 
 // NewPKISigner creates a new PKI signer with the given configuration
-func NewPKISigner(config *PKIConfig) *PKISigner {
-	client := &http.Client{Timeout: 60 * time.Second}
+func NewPKISigner(config *PKIConfig) (*PKISigner, error) {
+	orderIDPattern, err := compileOrderIDPattern(config.Async)
+	if err != nil {
+		return nil, err
+	}
+
+	// Offline PKIs exchange requests as files; every request is asynchronous
+	if config.Transport != nil && config.Transport.Type == "file" {
+		if config.Transport.File == nil {
+			return nil, fmt.Errorf("transport type file requires transport.file")
+		}
+		fileConfig := *config
+		if fileConfig.Async == nil {
+			fileConfig.Async = &PKIAsync{}
+		}
+		return &PKISigner{
+			config:         &fileConfig,
+			orderIDPattern: orderIDPattern,
+			clock:          clock.RealClock{},
+			files: &fileDrop{
+				requests:  dirStore{dir: config.Transport.File.RequestDir},
+				responses: dirStore{dir: config.Transport.File.ResponseDir},
+			},
+		}, nil
+	}
+
+	// Requests to isolated PKIs travel over a message queue shared by all signers
+	if config.Transport != nil && config.Transport.Type != "" && config.Transport.Type != "http" {
+		queue, err := sharedQueueTransport(config.Transport)
+		if err != nil {
+			return nil, err
+		}
+		return &PKISigner{
+			config:         config,
+			httpClient:     &http.Client{Timeout: 60 * time.Second, Transport: tracing.Transport(queue)},
+			queue:          queue,
+			orderIDPattern: orderIDPattern,
+			clock:          clock.RealClock{},
+		}, nil
+	}
+
+	proxy, err := proxyFunc(config.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
 
 	// Configure TLS settings if specified
 	if config.TLS != nil && config.TLS.InsecureSkipVerify {
-		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, //nolint:gosec // Explicitly configured by user for testing
-			},
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec // Explicitly configured by user for testing
 		}
 	}
 
 	return &PKISigner{
-		config:     config,
-		httpClient: client,
+		config:         config,
+		httpClient:     &http.Client{Timeout: 60 * time.Second, Transport: tracing.Transport(transport)},
+		orderIDPattern: orderIDPattern,
+		clock:          clock.RealClock{},
+	}, nil
+}
+
+// SetClock sets the clock issuance and revocation times are taken from; nil
+// restores the real clock
+func (s *PKISigner) SetClock(c clock.PassiveClock) {
+	if c == nil {
+		c = clock.RealClock{}
+	}
+	s.clock = c
+}
+
+// proxyFunc returns the proxy selection function for the PKI API transport.
+// An explicit proxy URL takes precedence over HTTPS_PROXY/HTTP_PROXY, but
+// NO_PROXY from the environment is honored in both cases.
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	if proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	if err := ValidateProxyURL(proxy); err != nil {
+		return nil, err
 	}
+
+	cfg := httpproxy.FromEnvironment()
+	cfg.HTTPProxy = proxy
+	cfg.HTTPSProxy = proxy
+	selectProxy := cfg.ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return selectProxy(req.URL)
+	}, nil
+}
+
+// ValidateProxyURL checks that a proxy URL is well-formed and uses a supported scheme
+func ValidateProxyURL(proxy string) error {
+	// Proxy URLs may carry credentials: unparseable ones are left out of the
+	// error, which would quote them, and others are redacted
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return errors.New("invalid proxy URL: it cannot be parsed (not shown as it may contain credentials)")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q (supported: http, https, socks5, socks5h)", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid proxy URL %q: missing host", u.Redacted())
+	}
+	return nil
 }
 
 // SetAuthToken sets the authentication token for API requests
@@ -143,22 +425,129 @@ func (s *PKISigner) SetAuthToken(token string) {
 	s.authToken = token
 }
 
-// CheckHealth verifies connectivity to the PKI API
-func (s *PKISigner) CheckHealth() error {
-	req, err := http.NewRequest("GET", s.config.BaseURL, nil)
+// SetBasicAuth sets the username and password for auth type basic; they take
+// precedence over a pre-encoded token
+func (s *PKISigner) SetBasicAuth(username, password string) {
+	s.username = username
+	s.password = password
+}
+
+// SetSubject replaces subject attributes of the CSR in requests to the PKI API
+func (s *PKISigner) SetSubject(subject *SubjectOverride) {
+	s.subject = subject
+}
+
+// SetOrigin sets the fields of the Ingress or Gateway the certificate
+// terminates on, sent in the configured origin parameters
+func (s *PKISigner) SetOrigin(origin map[string]string) {
+	s.origin = origin
+}
+
+// SetRequester sets the identity fields of the requester of the certificate,
+// sent in the configured requester parameters and headers
+func (s *PKISigner) SetRequester(requester map[string]string) {
+	s.requester = requester
+}
+
+// ValidRequesterField reports whether field names a requester field that can
+// be sent in requester parameters and headers
+func ValidRequesterField(field string) bool {
+	switch field {
+	case "username", "uid", "groups":
+		return true
+	}
+	key, ok := strings.CutPrefix(field, "extra.")
+	return ok && key != ""
+}
+
+// SetBackdate sets how far NotBefore of returned certificates may lie before
+// the request was sent, overriding response.maxBackdateSeconds
+func (s *PKISigner) SetBackdate(backdate time.Duration) {
+	s.maxBackdate = &backdate
+}
+
+// RequestCA makes the signer request a subordinate CA certificate. It fails
+// if the PKI configuration has no parameter for CA requests.
+func (s *PKISigner) RequestCA() error {
+	if s.config.Parameters.CAParam == "" {
+		return fmt.Errorf("the PKI configuration does not support CA certificates (parameters.caParam is not set)")
+	}
+	s.isCA = true
+	return nil
+}
+
+// RequestSVID makes the signer issue SPIFFE X.509-SVIDs. It fails if the PKI
+// configuration sends neither the URI SANs nor the CSR, as the PKI would not
+// learn the SPIFFE ID.
+func (s *PKISigner) RequestSVID() error {
+	params := s.config.Parameters
+	if params.URIParam == "" && params.GetCSRParam == "" && params.ParamFormat != "raw-der" {
+		return fmt.Errorf("the PKI configuration does not send SPIFFE IDs (set parameters.uriParam or parameters.getCSRParam)")
+	}
+	return nil
+}
+
+// SetAuthRejectedHandler registers a callback invoked when the PKI API answers
+// 401 or 403, so callers can drop a cached token that may have been rotated
+func (s *PKISigner) SetAuthRejectedHandler(fn func()) {
+	s.authRejected = fn
+}
+
+// checkAuthRejected invokes the auth rejected handler for 401/403 responses
+func (s *PKISigner) checkAuthRejected(statusCode int) {
+	if s.authRejected != nil && (statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden) {
+		s.authRejected()
+	}
+}
+
+// CheckHealth verifies connectivity to the PKI API; with several endpoints,
+// one reachable endpoint is enough
+func (s *PKISigner) CheckHealth(ctx context.Context) error {
+	if s.files != nil {
+		return s.files.check(ctx)
+	}
+
+	// The PKI behind a queue may not answer health requests; check the broker instead
+	if s.queue != nil {
+		if err := s.queue.ping(ctx); err != nil {
+			return fmt.Errorf("failed to connect to PKI message queue: %w", err)
+		}
+		return nil
+	}
+
+	var err error
+	for _, endpoint := range s.endpoints() {
+		if err = s.checkEndpoint(ctx, endpoint); err == nil {
+			endpointHealth.markUp(endpoint)
+			return nil
+		}
+		endpointHealth.markDown(endpoint, time.Now())
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
+
+// checkEndpoint verifies connectivity to one endpoint of the PKI API
+func (s *PKISigner) checkEndpoint(ctx context.Context, endpoint string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create health check request: %w", err)
 	}
-	s.addAuth(req)
+	if err := s.addAuth(req); err != nil {
+		return err
+	}
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to connect to PKI API: %w", err)
 	}
 	defer resp.Body.Close()
+	s.checkAuthRejected(resp.StatusCode)
 
 	if resp.StatusCode >= 500 {
-		body, _ := io.ReadAll(resp.Body)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
 		return fmt.Errorf("PKI API error: %d, %s", resp.StatusCode, string(body))
 	}
 
@@ -166,27 +555,38 @@ func (s *PKISigner) CheckHealth() error {
 }
 
 // Sign signs a CSR using the external PKI API
-func (s *PKISigner) Sign(csrPEM []byte, validityDays int) ([]byte, []byte, error) {
+func (s *PKISigner) Sign(ctx context.Context, csrPEM []byte, validityDays int) ([]byte, []byte, error) {
 	// Parse the CSR
 	block, _ := pem.Decode(csrPEM)
 	if block == nil || block.Type != "CERTIFICATE REQUEST" {
-		return nil, nil, fmt.Errorf("invalid CSR PEM")
+		return nil, nil, notIssued(fmt.Errorf("invalid CSR PEM"))
 	}
 
 	csr, err := x509.ParseCertificateRequest(block.Bytes)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse CSR: %w", err)
+		return nil, nil, notIssued(fmt.Errorf("failed to parse CSR: %w", err))
 	}
 
 	// Build request parameters
-	params := s.buildRequestParams(csr)
+	params, err := s.buildRequestParams(csr)
+	if err != nil {
+		return nil, nil, notIssued(err)
+	}
 
 	// Make the signing request
-	certPEM, err := s.makeRequest(params)
+	sent := s.clock.Now()
+	certPEM, err := s.makeRequest(ctx, params, csr)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	if err := s.checkChainLimits(certPEM); err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkNotBefore(certPEM, sent, s.clock.Now()); err != nil {
+		return nil, nil, err
+	}
+
 	// Extract CA chain from the full certificate chain
 	caPEM := s.extractCAChain(certPEM)
 
@@ -194,19 +594,29 @@ func (s *PKISigner) Sign(csrPEM []byte, validityDays int) ([]byte, []byte, error
 }
 
 // buildRequestParams builds HTTP request parameters from the CSR
-func (s *PKISigner) buildRequestParams(csr *x509.CertificateRequest) url.Values {
+func (s *PKISigner) buildRequestParams(csr *x509.CertificateRequest) (url.Values, error) {
 	params := url.Values{}
 	cfg := s.config.Parameters
 
+	// Add fixed parameters first, so the mapped ones take precedence
+	for name, value := range cfg.ExtraParams {
+		params.Set(name, value)
+	}
+
 	// Add new certificate action parameter
 	if cfg.NewCertParam != "" {
 		params.Set(cfg.NewCertParam, cfg.NewCertValue)
 	}
 
 	// Build subject DN
-	subject := s.buildSubjectDN(csr)
-	if cfg.SubjectParam != "" && subject != "" {
-		params.Set(cfg.SubjectParam, subject)
+	if cfg.SubjectParam != "" {
+		subject, err := s.buildSubjectDN(csr)
+		if err != nil {
+			return nil, err
+		}
+		if subject != "" {
+			params.Set(cfg.SubjectParam, subject)
+		}
 	}
 
 	// Add DNS SANs
@@ -228,154 +638,270 @@ func (s *PKISigner) buildRequestParams(csr *x509.CertificateRequest) url.Values
 		}
 	}
 
-	// Add certificate format request
-	if cfg.GetCertParam != "" {
-		params.Set(cfg.GetCertParam, "")
+	// Add URI SANs
+	if len(csr.URIs) > 0 && cfg.URIParam != "" {
+		uris := make([]string, len(csr.URIs))
+		for i, uri := range csr.URIs {
+			uris[i] = uri.String()
+		}
+		params.Set(cfg.URIParam, strings.Join(uris, ","))
 	}
 
-	return params
-}
-
-// buildSubjectDN builds a subject DN string from the CSR
-func (s *PKISigner) buildSubjectDN(csr *x509.CertificateRequest) string {
-	// Check if using slash format (legacy PKI format: /C=US/ST=California/L=San Francisco/O=Example/CN=example.com)
-	if s.config.Parameters.SubjectDNFormat == "slash" {
-		return s.buildSubjectDNSlash(csr)
+	// Send the CSR itself
+	if cfg.GetCSRParam != "" {
+		params.Set(cfg.GetCSRParam, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})))
 	}
-	// Default comma-separated format: CN=...,O=...,C=...
-	return s.buildSubjectDNComma(csr)
-}
 
-// buildSubjectDNSlash builds a DN in slash format: /C=US/ST=California/L=San Francisco/O=Example/CN=example.com
-func (s *PKISigner) buildSubjectDNSlash(csr *x509.CertificateRequest) string {
-	var parts []string
-
-	// Note: Slash format uses reverse order (most general first)
-	for _, c := range csr.Subject.Country {
-		parts = append(parts, "/C="+c)
-	}
-	for _, st := range csr.Subject.Province {
-		parts = append(parts, "/ST="+st)
-	}
-	for _, l := range csr.Subject.Locality {
-		parts = append(parts, "/L="+l)
-	}
-	for _, o := range csr.Subject.Organization {
-		parts = append(parts, "/O="+o)
+	// Request a subordinate CA certificate
+	if s.isCA {
+		value := cfg.CAValue
+		if value == "" {
+			value = "true"
+		}
+		params.Set(cfg.CAParam, value)
 	}
-	for _, ou := range csr.Subject.OrganizationalUnit {
-		parts = append(parts, "/OU="+ou)
+
+	// Identify the edge the certificate terminates on
+	for field, param := range cfg.OriginParams {
+		if value := s.origin[field]; value != "" {
+			params.Set(param, value)
+		}
 	}
-	if csr.Subject.CommonName != "" {
-		parts = append(parts, "/CN="+csr.Subject.CommonName)
+
+	// Identify who requested the certificate, so the PKI can authorize and
+	// audit per requester
+	for field, param := range cfg.RequesterParams {
+		if value := s.requester[field]; value != "" {
+			params.Set(param, value)
+		}
 	}
 
-	// Fallback to first DNS name if no CN
-	if len(parts) == 0 && len(csr.DNSNames) > 0 {
-		parts = append(parts, "/CN="+csr.DNSNames[0])
+	// Add certificate format request
+	if cfg.GetCertParam != "" {
+		params.Set(cfg.GetCertParam, "")
 	}
 
-	return strings.Join(parts, "")
+	return params, nil
 }
 
-// buildSubjectDNComma builds a DN in comma format: CN=...,O=...,C=...
-func (s *PKISigner) buildSubjectDNComma(csr *x509.CertificateRequest) string {
-	var parts []string
-
-	if csr.Subject.CommonName != "" {
-		parts = append(parts, "CN="+csr.Subject.CommonName)
-	}
-	for _, ou := range csr.Subject.OrganizationalUnit {
-		parts = append(parts, "OU="+ou)
-	}
-	for _, o := range csr.Subject.Organization {
-		parts = append(parts, "O="+o)
-	}
-	for _, l := range csr.Subject.Locality {
-		parts = append(parts, "L="+l)
-	}
-	for _, st := range csr.Subject.Province {
-		parts = append(parts, "ST="+st)
-	}
-	for _, c := range csr.Subject.Country {
-		parts = append(parts, "C="+c)
-	}
-
-	// Fallback to first DNS name if no CN
-	if len(parts) == 0 && len(csr.DNSNames) > 0 {
-		parts = append(parts, "CN="+csr.DNSNames[0])
+// makeRequest sends the signing request for a CSR to the PKI API, failing
+// over to the next endpoint while endpoints are unreachable or failing
+func (s *PKISigner) makeRequest(ctx context.Context, params url.Values, csr *x509.CertificateRequest) ([]byte, error) {
+	endpoints := s.endpoints()
+	// sent records whether an endpoint failed over from may have received the
+	// CSR, leaving open whether a certificate was issued
+	sent := false
+	for i, endpoint := range endpoints {
+		resp, err := s.sendRequest(ctx, endpoint, params, csr)
+		if s.files != nil {
+			return nil, err
+		}
+		last := i == len(endpoints)-1 || ctx.Err() != nil
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		if failover(err, statusCode) && !s.config.Async.isPending(statusCode) {
+			endpointHealth.markDown(endpoint, time.Now())
+			if !last {
+				if resp != nil {
+					resp.Body.Close()
+				}
+				sent = sent || !notSent(err)
+				continue
+			}
+		} else {
+			endpointHealth.markUp(endpoint)
+		}
+		if err != nil {
+			if !sent && notSent(err) {
+				return nil, notIssued(err)
+			}
+			return nil, err
+		}
+		certPEM, err := s.handleResponse(resp)
+		resp.Body.Close()
+		if err != nil && !sent && rejected(resp.StatusCode) {
+			return nil, notIssued(err)
+		}
+		return certPEM, err
 	}
-
-	return strings.Join(parts, ",")
+	return nil, notIssued(fmt.Errorf("no PKI API endpoint configured"))
 }
 
-// makeRequest sends the signing request to the PKI API
-func (s *PKISigner) makeRequest(params url.Values) ([]byte, error) {
+// sendRequest sends the signing request to one endpoint of the PKI API.
+// Requests to offline PKIs are written to a file instead; they never return
+// a response.
+func (s *PKISigner) sendRequest(ctx context.Context, endpoint string, params url.Values, csr *x509.CertificateRequest) (*http.Response, error) {
 	method := strings.ToUpper(s.config.Method)
 	if method == "" {
 		method = "POST"
 	}
 
-	// Build request body based on format
-	var body string
-	if s.config.Parameters.ParamFormat == "semicolon" {
-		// Legacy PKI format: key=value;key2=value2
-		var parts []string
-		for key, values := range params {
-			if len(values) > 0 && values[0] != "" {
-				parts = append(parts, key+"="+values[0])
-			} else if len(values) > 0 {
-				parts = append(parts, key)
-			}
-		}
-		body = strings.Join(parts, ";")
-	} else {
-		// Standard URL-encoded format: key=value&key2=value2
-		body = params.Encode()
+	requestURL, body, contentType, err := s.encodeSigningRequest(endpoint, params, csr)
+	if err != nil {
+		return nil, &notSentError{err}
 	}
 
 	var req *http.Request
-	var err error
 
 	if method == "GET" {
 		if s.config.Parameters.ParamFormat == "semicolon" {
-			req, err = http.NewRequest("GET", s.config.BaseURL+"?"+body, nil)
+			req, err = http.NewRequestWithContext(ctx, "GET", endpoint+"?"+body, nil)
 		} else {
-			req, err = http.NewRequest("GET", s.config.BaseURL+"?"+params.Encode(), nil)
+			req, err = http.NewRequestWithContext(ctx, "GET", endpoint+"?"+params.Encode(), nil)
 		}
 	} else {
-		req, err = http.NewRequest("POST", s.config.BaseURL, strings.NewReader(body))
-		if s.config.Parameters.ParamFormat == "semicolon" {
-			req.Header.Set("Content-Type", "text/plain")
-		} else {
-			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-		}
+		req, err = http.NewRequestWithContext(ctx, "POST", requestURL, strings.NewReader(body))
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, &notSentError{fmt.Errorf("failed to create request: %w", err)}
+	}
+
+	if method != "GET" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for field, header := range s.config.Parameters.RequesterHeaders {
+		if value := s.requester[field]; value != "" {
+			req.Header.Set(header, value)
+		}
 	}
 
-	s.addAuth(req)
+	// Request files leave the cluster, so credentials are never written to them
+	if s.files != nil {
+		return nil, s.files.submit(req)
+	}
+
+	if err := s.addAuth(req); err != nil {
+		return nil, &notSentError{err}
+	}
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
-	defer resp.Body.Close()
+	s.checkAuthRejected(resp.StatusCode)
+	return resp, nil
+}
+
+// NotIssuedError is a signing error known not to have issued a certificate:
+// the request failed before it reached the PKI, or the PKI rejected it.
+// After other errors, such as a connection lost while the response was read,
+// the PKI may have issued a certificate.
+type NotIssuedError struct {
+	Err error
+}
 
-	respBody, err := io.ReadAll(resp.Body)
+func (e *NotIssuedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NotIssuedError) Unwrap() error {
+	return e.Err
+}
+
+// notIssued marks err as known not to have issued a certificate
+func notIssued(err error) error {
+	return &NotIssuedError{Err: err}
+}
+
+// notSentError is an error preparing a request to the PKI API before it was sent
+type notSentError struct {
+	err error
+}
+
+func (e *notSentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *notSentError) Unwrap() error {
+	return e.err
+}
+
+// notSent reports whether a request failed with err before the PKI API could
+// receive it: it was not prepared, or no connection was established
+func notSent(err error) bool {
+	var prepareErr *notSentError
+	if errors.As(err, &prepareErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect")
+}
+
+// rejected reports whether an error response with statusCode is a definite
+// rejection of the request. Server errors are not: a PKI may fail after it
+// issued the certificate.
+func rejected(statusCode int) bool {
+	return statusCode >= http.StatusBadRequest && statusCode < http.StatusInternalServerError
+}
+
+// handleResponse reads the response to a signing request
+func (s *PKISigner) handleResponse(resp *http.Response) ([]byte, error) {
+	respBody, err := s.readResponse(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("PKI API error: %d, %s", resp.StatusCode, string(respBody))
+	if s.config.Async.isPending(resp.StatusCode) || s.hasOrderID(resp.StatusCode, respBody) {
+		return nil, s.pendingFromResponse(resp, respBody, "")
+	}
+	if err := s.checkResponse(resp, respBody, "PKI API error"); err != nil {
+		return nil, err
 	}
 
 	return s.parseResponse(respBody)
 }
 
+// readResponse reads a response body of the PKI API, failing instead of
+// buffering bodies larger than the configured limit
+func (s *PKISigner) readResponse(resp *http.Response) ([]byte, error) {
+	maxBytes := s.config.Response.MaxResponseBytes
+	if maxBytes == 0 {
+		maxBytes = defaultMaxResponseBytes
+	}
+	if resp.ContentLength > int64(maxBytes) {
+		return nil, fmt.Errorf("response of %d bytes exceeds the limit of %d bytes", resp.ContentLength, maxBytes)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxBytes {
+		return nil, fmt.Errorf("response exceeds the limit of %d bytes", maxBytes)
+	}
+	return body, nil
+}
+
+// checkContentType rejects successful responses of a media type that
+// cannot hold a certificate, such as the HTML login page of a proxy
+func (s *PKISigner) checkContentType(contentType string) error {
+	// Responses of message queues and files carry no content type
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q in response: %w", contentType, err)
+	}
+
+	accepted := s.config.Response.ContentTypes
+	if len(accepted) == 0 {
+		if mediaType == "text/html" {
+			return fmt.Errorf("unexpected content type %s in response, not a certificate", mediaType)
+		}
+		return nil
+	}
+	for _, pattern := range accepted {
+		pattern = strings.ToLower(pattern)
+		if pattern == mediaType || (strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected content type %s in response, expected %s", mediaType, strings.Join(accepted, ", "))
+}
+
 // parseResponse parses the PKI API response based on configured format
 func (s *PKISigner) parseResponse(body []byte) ([]byte, error) {
 	format := s.config.Response.Format
@@ -383,6 +909,18 @@ func (s *PKISigner) parseResponse(body []byte) ([]byte, error) {
 		format = "pem"
 	}
 
+	if format == "pkcs7" {
+		certPEM, err := pkcs7ToPEM(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PKCS#7 response: %w", err)
+		}
+		return certPEM, nil
+	}
+
+	if format == "json" {
+		body = s.jsonCertificates(body)
+	}
+
 	// For PEM format, check if response contains a certificate
 	if !strings.Contains(string(body), "-----BEGIN CERTIFICATE-----") {
 		return nil, fmt.Errorf("no certificate in response")
@@ -391,6 +929,108 @@ func (s *PKISigner) parseResponse(body []byte) ([]byte, error) {
 	return body, nil
 }
 
+// jsonCertificates returns the certificate and chain of a JSON response as
+// a PEM chain; the chain field may repeat the certificate
+func (s *PKISigner) jsonCertificates(body []byte) []byte {
+	cert, _ := responseField(body, s.config.Response.CertificateField)
+	chain, _ := responseField(body, s.config.Response.ChainField)
+	if s.config.Response.CertificateEncoding == "base64-der" {
+		cert = derFieldToPEM(body, s.config.Response.CertificateField)
+		chain = derFieldToPEM(body, s.config.Response.ChainField)
+	}
+	if cert == "" || strings.HasPrefix(chain, cert) {
+		return []byte(chain + "\n")
+	}
+	if chain == "" {
+		return []byte(cert + "\n")
+	}
+	return []byte(cert + "\n" + chain + "\n")
+}
+
+// derFieldToPEM returns the certificates of a top-level field of a JSON
+// response holding base64-encoded DER, a string or an array of strings, as PEM
+func derFieldToPEM(body []byte, field string) string {
+	if field == "" {
+		return ""
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ""
+	}
+	var values []string
+	if err := json.Unmarshal(fields[field], &values); err != nil {
+		var value string
+		if err := json.Unmarshal(fields[field], &value); err != nil {
+			return ""
+		}
+		values = []string{value}
+	}
+	var b strings.Builder
+	for _, value := range values {
+		der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+		if err != nil {
+			continue
+		}
+		b.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// checkChainLimits rejects pathological responses, such as an upstream
+// returning its entire truststore, before they end up in every TLS Secret
+func (s *PKISigner) checkChainLimits(chainPEM []byte) error {
+	maxBytes := s.config.Response.MaxChainBytes
+	if maxBytes == 0 {
+		maxBytes = defaultMaxChainBytes
+	}
+	if len(chainPEM) > maxBytes {
+		return fmt.Errorf("certificate chain in response is %d bytes, exceeding the limit of %d bytes", len(chainPEM), maxBytes)
+	}
+
+	maxCerts := s.config.Response.MaxChainCertificates
+	if maxCerts == 0 {
+		maxCerts = defaultMaxChainCertificates
+	}
+	if count := strings.Count(string(chainPEM), "-----BEGIN CERTIFICATE-----"); count > maxCerts {
+		return fmt.Errorf("certificate chain in response contains %d certificates, exceeding the limit of %d", count, maxCerts)
+	}
+
+	return nil
+}
+
+// checkNotBefore rejects a returned certificate that the PKI backdated
+// further than allowed or that is not valid yet, which clients with strict
+// clock skew policies would refuse. A zero sent time skips the backdating
+// check, for certificates whose time of signing is unknown.
+func (s *PKISigner) checkNotBefore(chainPEM []byte, sent, received time.Time) error {
+	maxBackdate := time.Duration(s.config.Response.MaxBackdateSeconds) * time.Second
+	if s.maxBackdate != nil {
+		maxBackdate = *s.maxBackdate
+	}
+	if maxBackdate <= 0 {
+		return nil
+	}
+	block, _ := pem.Decode(chainPEM)
+	if block == nil {
+		return fmt.Errorf("no certificate in response")
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate in response: %w", err)
+	}
+
+	if leaf.NotBefore.After(received) {
+		return fmt.Errorf("certificate in response is not valid before %s, later than it was received; check the PKI's clock",
+			leaf.NotBefore.UTC().Format(time.RFC3339))
+	}
+	// NotBefore has a precision of one second
+	if !sent.IsZero() && leaf.NotBefore.Before(sent.Truncate(time.Second).Add(-maxBackdate)) {
+		return fmt.Errorf("certificate in response is valid from %s, backdated by more than the %s allowed",
+			leaf.NotBefore.UTC().Format(time.RFC3339), maxBackdate)
+	}
+	return nil
+}
+
 // extractCAChain extracts the CA chain from a full certificate chain
 // The first certificate is the leaf, remaining are the CA chain
 func (s *PKISigner) extractCAChain(fullChain []byte) []byte {
@@ -424,25 +1064,45 @@ func (s *PKISigner) extractCAChain(fullChain []byte) []byte {
 }
 
 // addAuth adds authentication headers to the request
-func (s *PKISigner) addAuth(req *http.Request) {
+func (s *PKISigner) addAuth(req *http.Request) error {
 	if s.config.Auth == nil {
-		return
+		return nil
 	}
 
 	switch s.config.Auth.Type {
 	case "header":
-		if s.authToken != "" {
-			req.Header.Set(s.config.Auth.HeaderName, s.authToken)
+		token, err := s.staticOrRefreshedToken(req.Context())
+		if err != nil {
+			return err
+		}
+		if token != "" {
+			req.Header.Set(s.config.Auth.HeaderName, token)
 		}
 	case "basic":
-		if s.authToken != "" {
+		if s.username != "" {
+			req.SetBasicAuth(s.username, s.password)
+		} else if username, password, ok := strings.Cut(s.authToken, ":"); ok {
+			// A plain user:pass token; base64 never contains a colon
+			req.SetBasicAuth(username, password)
+		} else if s.authToken != "" {
 			req.Header.Set("Authorization", "Basic "+s.authToken)
 		}
 	case "bearer":
-		if s.authToken != "" {
-			req.Header.Set("Authorization", "Bearer "+s.authToken)
+		token, err := s.staticOrRefreshedToken(req.Context())
+		if err != nil {
+			return err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	case "kubernetes":
+		token, err := s.serviceAccountToken(req.Context())
+		if err != nil {
+			return err
 		}
+		req.Header.Set("Authorization", "Bearer "+token)
 	}
+	return nil
 }
 
 // DefaultPKIConfig returns a default PKI configuration template
@@ -483,157 +1143,36 @@ type SignResponse struct {
 	Chain       string `json:"chain"`
 }
 
-// generateRSAKey generates an RSA private key of the specified bit size
-func generateRSAKey(bits int) (*rsa.PrivateKey, error) {
-	return rsa.GenerateKey(rand.Reader, bits)
-}
-
-// generateSerialNumber generates a random serial number for certificates
-func generateSerialNumber() (*big.Int, error) {
-	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	return rand.Int(rand.Reader, serialNumberLimit)
-}
-
-// MockCASigner implements local self-signing for development and testing
-// It generates a CA certificate on first use and signs certificates locally
-type MockCASigner struct {
-	caCert    *x509.Certificate
-	caKey     interface{}
-	caPEM     []byte
-	caKeyPEM  []byte
-	generated bool
+// SubjectOverride replaces subject attributes of the CSR in outgoing
+// requests, e.g. to match the organization of a PKI contract. Empty
+// attributes are taken from the CSR.
+type SubjectOverride struct {
+	Organizations       []string
+	OrganizationalUnits []string
+	Countries           []string
+	Provinces           []string
+	Localities          []string
 }
 
-// NewMockCASigner creates a new self-signing Mock CA
-func NewMockCASigner(baseURL string) *MockCASigner {
-	// baseURL is ignored for self-signing - kept for API compatibility
-	return &MockCASigner{}
-}
-
-// ensureCA generates the CA certificate and key if not already done
-func (s *MockCASigner) ensureCA() error {
-	if s.generated {
-		return nil
+// Apply returns the subject with the overridden attributes replaced
+func (o *SubjectOverride) Apply(subject pkix.Name) pkix.Name {
+	if o == nil {
+		return subject
 	}
-
-	// Generate CA private key (RSA 2048)
-	caPrivKey, err := generateRSAKey(2048)
-	if err != nil {
-		return fmt.Errorf("failed to generate CA key: %w", err)
-	}
-
-	// Create CA certificate template
-	serialNumber, err := generateSerialNumber()
-	if err != nil {
-		return fmt.Errorf("failed to generate serial: %w", err)
-	}
-
-	caTemplate := &x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			CommonName:   "External Issuer Mock CA",
-			Organization: []string{"cert-manager-external-issuer"},
-		},
-		NotBefore:             time.Now().Add(-1 * time.Hour),
-		NotAfter:              time.Now().AddDate(10, 0, 0), // Valid for 10 years
-		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
-		BasicConstraintsValid: true,
-		IsCA:                  true,
-		MaxPathLen:            1,
-	}
-
-	// Self-sign the CA certificate
-	caCertDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caPrivKey.PublicKey, caPrivKey)
-	if err != nil {
-		return fmt.Errorf("failed to create CA certificate: %w", err)
-	}
-
-	s.caCert, err = x509.ParseCertificate(caCertDER)
-	if err != nil {
-		return fmt.Errorf("failed to parse CA certificate: %w", err)
-	}
-
-	s.caKey = caPrivKey
-
-	// Encode to PEM
-	s.caPEM = pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: caCertDER,
-	})
-
-	s.caKeyPEM = pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(caPrivKey),
-	})
-
-	s.generated = true
-	return nil
-}
-
-// CheckHealth verifies the Mock CA is ready
-func (s *MockCASigner) CheckHealth() error {
-	// For self-signing, we just ensure CA is generated
-	if err := s.ensureCA(); err != nil {
-		return fmt.Errorf("Mock CA initialization failed: %w", err)
+	if len(o.Organizations) > 0 {
+		subject.Organization = o.Organizations
 	}
-	return nil
-}
-
-// Sign signs a CSR using the local Mock CA
-func (s *MockCASigner) Sign(csrPEM []byte, validityDays int) ([]byte, []byte, error) {
-	// Ensure CA is initialized
-	if err := s.ensureCA(); err != nil {
-		return nil, nil, fmt.Errorf("CA not ready: %w", err)
+	if len(o.OrganizationalUnits) > 0 {
+		subject.OrganizationalUnit = o.OrganizationalUnits
 	}
-
-	// Parse the CSR
-	block, _ := pem.Decode(csrPEM)
-	if block == nil {
-		return nil, nil, fmt.Errorf("invalid CSR PEM")
+	if len(o.Countries) > 0 {
+		subject.Country = o.Countries
 	}
-
-	csr, err := x509.ParseCertificateRequest(block.Bytes)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse CSR: %w", err)
+	if len(o.Provinces) > 0 {
+		subject.Province = o.Provinces
 	}
-
-	if err := csr.CheckSignature(); err != nil {
-		return nil, nil, fmt.Errorf("CSR signature validation failed: %w", err)
+	if len(o.Localities) > 0 {
+		subject.Locality = o.Localities
 	}
-
-	// Generate serial number
-	serialNumber, err := generateSerialNumber()
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate serial: %w", err)
-	}
-
-	// Create certificate template
-	certTemplate := &x509.Certificate{
-		SerialNumber:          serialNumber,
-		Subject:               csr.Subject,
-		NotBefore:             time.Now().Add(-1 * time.Minute),
-		NotAfter:              time.Now().AddDate(0, 0, validityDays),
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
-		BasicConstraintsValid: true,
-		IsCA:                  false,
-		DNSNames:              csr.DNSNames,
-		IPAddresses:           csr.IPAddresses,
-		URIs:                  csr.URIs,
-		EmailAddresses:        csr.EmailAddresses,
-	}
-
-	// Sign the certificate with our CA
-	certDER, err := x509.CreateCertificate(rand.Reader, certTemplate, s.caCert, csr.PublicKey, s.caKey)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to sign certificate: %w", err)
-	}
-
-	// Encode to PEM
-	certPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: certDER,
-	})
-
-	return certPEM, s.caPEM, nil
+	return subject
 }
@@ -0,0 +1,83 @@
+package signer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// TokenSource supplies bearer tokens that may change between requests, such
+// as short-lived Kubernetes ServiceAccount tokens or refreshed OAuth access tokens
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// SetTokenSource sets the source of ServiceAccount tokens for auth type
+// kubernetes, or of access tokens for bearer and header auth with refresh configured
+func (s *PKISigner) SetTokenSource(ts TokenSource) {
+	s.tokenSource = ts
+}
+
+// serviceAccountToken returns the token for auth type kubernetes. A projected
+// token file is re-read on every request because the kubelet rotates it.
+func (s *PKISigner) serviceAccountToken(ctx context.Context) (string, error) {
+	if path := s.config.Auth.TokenPath; path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read ServiceAccount token: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if s.tokenSource == nil {
+		return "", fmt.Errorf("no ServiceAccount token source configured for auth type kubernetes")
+	}
+	token, err := s.tokenSource.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get ServiceAccount token: %w", err)
+	}
+	return token, nil
+}
+
+// staticOrRefreshedToken returns the token for auth types bearer and header:
+// the token from the auth Secret, or a refreshed access token with refresh configured
+func (s *PKISigner) staticOrRefreshedToken(ctx context.Context) (string, error) {
+	if s.config.Auth.Refresh == nil {
+		return s.authToken, nil
+	}
+	if s.tokenSource == nil {
+		return "", fmt.Errorf("no access token source configured for auth refresh")
+	}
+	token, err := s.tokenSource.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token: %w", err)
+	}
+	return token, nil
+}
+
+// JWTExpiry returns the exp claim of a token that is a JWT. The signature is
+// not verified: the expiry is only used to refresh and warn in time.
+func JWTExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp *json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	exp, err := claims.Exp.Float64()
+	if err != nil || exp <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
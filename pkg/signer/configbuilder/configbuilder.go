@@ -0,0 +1,845 @@
+// Package configbuilder provides a fluent API for building and validating
+// PKI API configurations.
+//
+// Validate is the single source of truth for PKIConfig correctness; the
+// controllers load every configuration from a ConfigMap or PKIProfile with
+// Parse, which also rejects unknown fields, and Validate, and the optional
+// validating webhook checks PKIProfiles with Parse when they are written. The
+// "external-issuer config generate" command builds configurations with
+// Builder, so generated ConfigMaps pass the same checks.
+//
+// The configuration types are re-exported from the controller's signer as
+// aliases, so modules other than this one can use the builder.
+//
+// Example:
+//
+//	config, err := configbuilder.New("https://pki.example.com/api/sign").
+//		WithJSONRequest().
+//		WithSubjectParam("subject", "comma").
+//		WithBearerFromSecret("pki-auth").
+//		WithPKCS7Response().
+//		Build()
+package configbuilder
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bvorland/cert-manager-external-issuer/internal/signer"
+	"golang.org/x/net/http/httpguts"
+)
+
+// Builder builds a PKIConfig step by step
+type Builder struct {
+	config PKIConfig
+}
+
+// New creates a builder for a PKI API at the given base URL
+func New(baseURL string) *Builder {
+	return &Builder{config: PKIConfig{BaseURL: baseURL}}
+}
+
+// FromPreset creates a builder for a PKI API at the given base URL starting
+// from the settings of a preset; Build fails for unknown presets
+func FromPreset(preset, baseURL string) *Builder {
+	config, ok := signer.Preset(preset)
+	if !ok {
+		config.Preset = preset
+	}
+	config.BaseURL = baseURL
+	return &Builder{config: config}
+}
+
+// From creates a builder starting from a copy of an existing configuration
+func From(config *PKIConfig) *Builder {
+	b := &Builder{config: *config}
+	if config.Auth != nil {
+		auth := *config.Auth
+		if auth.Refresh != nil {
+			refresh := *auth.Refresh
+			refresh.Scopes = append([]string(nil), refresh.Scopes...)
+			auth.Refresh = &refresh
+		}
+		b.config.Auth = &auth
+	}
+	if config.TLS != nil {
+		tlsConfig := *config.TLS
+		b.config.TLS = &tlsConfig
+	}
+	if config.Async != nil {
+		async := *config.Async
+		async.PendingStatusCodes = slices.Clone(async.PendingStatusCodes)
+		b.config.Async = &async
+	}
+	b.config.Endpoints = slices.Clone(config.Endpoints)
+	b.config.ErrorMappings = append([]PKIErrorMapping(nil), config.ErrorMappings...)
+	b.config.Parameters.OriginParams = maps.Clone(config.Parameters.OriginParams)
+	b.config.Parameters.RequesterParams = maps.Clone(config.Parameters.RequesterParams)
+	b.config.Parameters.RequesterHeaders = maps.Clone(config.Parameters.RequesterHeaders)
+	b.config.Parameters.ExtraParams = maps.Clone(config.Parameters.ExtraParams)
+	b.config.Response.ErrorCodes = maps.Clone(config.Response.ErrorCodes)
+	return b
+}
+
+// WithEndpoint adds a URL of the PKI API to fail over to; lower priorities
+// are tried first, the base URL has priority 0
+func (b *Builder) WithEndpoint(endpointURL string, priority int) *Builder {
+	b.config.Endpoints = append(b.config.Endpoints, PKIEndpoint{URL: endpointURL, Priority: priority})
+	return b
+}
+
+// WithMethod sets the HTTP method (GET or POST)
+func (b *Builder) WithMethod(method string) *Builder {
+	b.config.Method = strings.ToUpper(method)
+	return b
+}
+
+// WithFormRequest sends parameters URL-encoded (key=value&key2=value2)
+func (b *Builder) WithFormRequest() *Builder {
+	b.config.Parameters.ParamFormat = "ampersand"
+	return b
+}
+
+// WithSemicolonRequest sends parameters in the legacy semicolon format (key=value;key2=value2)
+func (b *Builder) WithSemicolonRequest() *Builder {
+	b.config.Parameters.ParamFormat = "semicolon"
+	return b
+}
+
+// WithJSONRequest sends parameters as a JSON object in a POST body
+func (b *Builder) WithJSONRequest() *Builder {
+	b.config.Method = "POST"
+	b.config.Parameters.ParamFormat = "json"
+	return b
+}
+
+// WithMultipartRequest sends parameters as a multipart/form-data POST body,
+// uploading the CSR as a file field in csrFormat "pem" or "der"
+func (b *Builder) WithMultipartRequest(csrField, csrFormat string) *Builder {
+	b.config.Method = "POST"
+	b.config.Parameters.ParamFormat = "multipart"
+	b.config.Parameters.GetCSRParam = csrField
+	b.config.Parameters.CSRFormat = csrFormat
+	return b
+}
+
+// WithRawCSRRequest sends the DER-encoded CSR as an application/pkcs10 POST
+// body and the other parameters in the query string
+func (b *Builder) WithRawCSRRequest() *Builder {
+	b.config.Method = "POST"
+	b.config.Parameters.ParamFormat = "raw-der"
+	b.config.Parameters.GetCSRParam = ""
+	return b
+}
+
+// WithNewCertParam sets the parameter sent for new certificate requests
+func (b *Builder) WithNewCertParam(name, value string) *Builder {
+	b.config.Parameters.NewCertParam = name
+	b.config.Parameters.NewCertValue = value
+	return b
+}
+
+// WithRenewCertParam sets the parameter sent for renewal requests
+func (b *Builder) WithRenewCertParam(name, value string) *Builder {
+	b.config.Parameters.RenewCertParam = name
+	b.config.Parameters.RenewCertValue = value
+	return b
+}
+
+// WithSubjectParam sets the subject DN parameter name and DN format ("comma" or "slash")
+func (b *Builder) WithSubjectParam(name, dnFormat string) *Builder {
+	b.config.Parameters.SubjectParam = name
+	b.config.Parameters.SubjectDNFormat = dnFormat
+	return b
+}
+
+// WithSubjectRDNOrder sets the order of attribute types in the subject DN as written
+func (b *Builder) WithSubjectRDNOrder(order ...string) *Builder {
+	b.config.Parameters.SubjectRDNOrder = order
+	return b
+}
+
+// WithSubjectCharset restricts subject attribute values to a character set,
+// optionally transliterating them to ASCII first
+func (b *Builder) WithSubjectCharset(charset string, transliterate bool) *Builder {
+	b.config.Parameters.SubjectCharset = charset
+	b.config.Parameters.SubjectTransliterate = transliterate
+	return b
+}
+
+// WithDNSParams sets how DNS SANs are mapped to numbered parameters
+func (b *Builder) WithDNSParams(prefix string, startIndex, maxCount int) *Builder {
+	b.config.Parameters.DNSPrefix = prefix
+	b.config.Parameters.DNSStartIndex = startIndex
+	b.config.Parameters.DNSMaxCount = maxCount
+	return b
+}
+
+// WithCSRParam sends the PEM-encoded CSR in the named parameter
+func (b *Builder) WithCSRParam(name string) *Builder {
+	b.config.Parameters.GetCSRParam = name
+	return b
+}
+
+// WithCAParam sets the parameter requesting a subordinate CA certificate
+// for CertificateRequests with isCA set
+func (b *Builder) WithCAParam(name, value string) *Builder {
+	b.config.Parameters.CAParam = name
+	b.config.Parameters.CAValue = value
+	return b
+}
+
+// WithOriginParam sends a field of the Ingress or Gateway a certificate
+// terminates on, e.g. "site-id", in the named parameter
+func (b *Builder) WithOriginParam(field, name string) *Builder {
+	if b.config.Parameters.OriginParams == nil {
+		b.config.Parameters.OriginParams = map[string]string{}
+	}
+	b.config.Parameters.OriginParams[field] = name
+	return b
+}
+
+// WithExtraParam sends a fixed parameter with every signing request
+func (b *Builder) WithExtraParam(name, value string) *Builder {
+	if b.config.Parameters.ExtraParams == nil {
+		b.config.Parameters.ExtraParams = map[string]string{}
+	}
+	b.config.Parameters.ExtraParams[name] = value
+	return b
+}
+
+// WithBearerFromSecret authenticates with a bearer token read from the named Secret
+func (b *Builder) WithBearerFromSecret(secretName string) *Builder {
+	b.config.Auth = &PKIAuth{Type: "bearer", SecretRef: secretName}
+	return b
+}
+
+// WithTokenRefresh obtains access tokens for bearer or header auth from an
+// OAuth token endpoint with the given grant type; call it after the auth type is set
+func (b *Builder) WithTokenRefresh(tokenURL, grantType string, scopes ...string) *Builder {
+	if b.config.Auth != nil {
+		b.config.Auth.Refresh = &PKIAuthRefresh{TokenURL: tokenURL, GrantType: grantType, Scopes: scopes}
+	}
+	return b
+}
+
+// WithBasicFromSecret authenticates with basic credentials read from the named Secret
+func (b *Builder) WithBasicFromSecret(secretName string) *Builder {
+	b.config.Auth = &PKIAuth{Type: "basic", SecretRef: secretName}
+	return b
+}
+
+// WithHeaderFromSecret sends a token read from the named Secret in a custom header
+func (b *Builder) WithHeaderFromSecret(headerName, secretName string) *Builder {
+	b.config.Auth = &PKIAuth{Type: "header", HeaderName: headerName, SecretRef: secretName}
+	return b
+}
+
+// WithServiceAccountToken authenticates with a bound ServiceAccount token for the given audience
+func (b *Builder) WithServiceAccountToken(audience string) *Builder {
+	b.config.Auth = &PKIAuth{Type: "kubernetes", Audience: audience}
+	return b
+}
+
+// WithPEMResponse expects a PEM certificate chain in the response body
+func (b *Builder) WithPEMResponse() *Builder {
+	b.config.Response = PKIResponse{Format: "pem"}
+	return b
+}
+
+// WithJSONResponse expects a JSON response with the certificate and chain in the given fields
+func (b *Builder) WithJSONResponse(certificateField, chainField string) *Builder {
+	b.config.Response = PKIResponse{
+		Format:           "json",
+		CertificateField: certificateField,
+		ChainField:       chainField,
+	}
+	return b
+}
+
+// WithCertificateEncoding sets the encoding of the certificates in the fields
+// of a JSON response: "pem" or "base64-der"
+func (b *Builder) WithCertificateEncoding(encoding string) *Builder {
+	b.config.Response.CertificateEncoding = encoding
+	return b
+}
+
+// WithPKCS7Response expects a PKCS#7 certificate bundle (PEM, base64 or DER) in the response body
+func (b *Builder) WithPKCS7Response() *Builder {
+	b.config.Response = PKIResponse{Format: "pkcs7"}
+	return b
+}
+
+// WithChainLimits bounds the number of certificates and total bytes accepted in a response chain
+func (b *Builder) WithChainLimits(maxCertificates, maxBytes int) *Builder {
+	b.config.Response.MaxChainCertificates = maxCertificates
+	b.config.Response.MaxChainBytes = maxBytes
+	return b
+}
+
+// WithMaxBackdate rejects returned certificates backdated further than
+// maxBackdate before the request, or not valid yet when received
+func (b *Builder) WithMaxBackdate(maxBackdate time.Duration) *Builder {
+	b.config.Response.MaxBackdateSeconds = int(maxBackdate / time.Second)
+	return b
+}
+
+// WithProxy routes PKI API requests through the given forward proxy
+func (b *Builder) WithProxy(proxy string) *Builder {
+	b.config.Proxy = proxy
+	return b
+}
+
+// WithAsync enables asynchronous issuance, polling pollURL ("{id}" is replaced
+// with the order ID) until the certificate is available
+func (b *Builder) WithAsync(pollURL, orderIDField string) *Builder {
+	if b.config.Async == nil {
+		b.config.Async = &PKIAsync{}
+	}
+	b.config.Async.PollURL = pollURL
+	b.config.Async.OrderIDField = orderIDField
+	return b
+}
+
+// WithOrderIDPattern captures order IDs from responses that are not JSON
+// with the first group of a regular expression
+func (b *Builder) WithOrderIDPattern(pattern string) *Builder {
+	if b.config.Async == nil {
+		b.config.Async = &PKIAsync{}
+	}
+	b.config.Async.OrderIDPattern = pattern
+	return b
+}
+
+// WithPollTiming sets the initial poll interval, maximum poll interval and overall timeout
+func (b *Builder) WithPollTiming(interval, maxInterval, timeout time.Duration) *Builder {
+	if b.config.Async == nil {
+		b.config.Async = &PKIAsync{}
+	}
+	b.config.Async.PollIntervalSeconds = int(interval.Seconds())
+	b.config.Async.MaxPollIntervalSeconds = int(maxInterval.Seconds())
+	b.config.Async.TimeoutSeconds = int(timeout.Seconds())
+	return b
+}
+
+// WithRevocation enables revocation by requests to revokeURL ("{serial}" is
+// replaced with the serial number), sending the reason as reasonParam
+func (b *Builder) WithRevocation(revokeURL, reasonParam string) *Builder {
+	b.config.Revocation = &PKIRevocation{URL: revokeURL, ReasonParam: reasonParam}
+	return b
+}
+
+// WithUnhold releases held certificates by requests to unholdURL ("{serial}"
+// is replaced with the serial number) rather than with reason removeFromCRL
+func (b *Builder) WithUnhold(unholdURL string) *Builder {
+	if b.config.Revocation == nil {
+		b.config.Revocation = &PKIRevocation{}
+	}
+	b.config.Revocation.UnholdURL = unholdURL
+	return b
+}
+
+// WithMaxResponseBytes bounds the size of response bodies read from the PKI API
+func (b *Builder) WithMaxResponseBytes(maxBytes int) *Builder {
+	b.config.Response.MaxResponseBytes = maxBytes
+	return b
+}
+
+// WithContentTypes accepts successful responses of the given media types only
+func (b *Builder) WithContentTypes(contentTypes ...string) *Builder {
+	b.config.Response.ContentTypes = contentTypes
+	return b
+}
+
+// WithSuccessStatus treats responses as successful only when the JSON field
+// statusField holds one of values, for PKIs that report errors with status 200
+func (b *Builder) WithSuccessStatus(statusField string, values ...string) *Builder {
+	b.config.Response.StatusField = statusField
+	b.config.Response.SuccessValues = values
+	return b
+}
+
+// WithErrorCode reports error responses whose JSON field errorCodeField
+// holds code with the given retry class
+func (b *Builder) WithErrorCode(errorCodeField, code, retry string) *Builder {
+	b.config.Response.ErrorCodeField = errorCodeField
+	if b.config.Response.ErrorCodes == nil {
+		b.config.Response.ErrorCodes = map[string]string{}
+	}
+	b.config.Response.ErrorCodes[code] = retry
+	return b
+}
+
+// WithErrorMapping reports error responses whose body matches pattern with
+// the given retry class and message
+func (b *Builder) WithErrorMapping(pattern, retry, message string) *Builder {
+	b.config.ErrorMappings = append(b.config.ErrorMappings, PKIErrorMapping{Pattern: pattern, Retry: retry, Message: message})
+	return b
+}
+
+// WithInsecureSkipVerify disables TLS verification (NOT recommended for production)
+func (b *Builder) WithInsecureSkipVerify() *Builder {
+	if b.config.TLS == nil {
+		b.config.TLS = &PKITLS{}
+	}
+	b.config.TLS.InsecureSkipVerify = true
+	return b
+}
+
+// Build validates and returns the configuration
+func (b *Builder) Build() (*PKIConfig, error) {
+	config := b.config
+	if err := Validate(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate checks a PKIConfig for missing or inconsistent settings.
+// All problems are reported together, each prefixed with its JSON field path.
+func Validate(config *PKIConfig) error {
+	var problems []string
+	fail := func(field, format string, args ...interface{}) {
+		problems = append(problems, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	if config.Preset != "" {
+		if _, ok := signer.Preset(config.Preset); !ok {
+			fail("preset", "must be one of %s, got %q", strings.Join(PresetNames(), ", "), config.Preset)
+		}
+	}
+
+	// Offline PKIs reached by file drop have no URL and answer in files
+	fileDrop := config.Transport != nil && config.Transport.Type == "file"
+
+	if config.BaseURL == "" {
+		if !fileDrop && len(config.Endpoints) == 0 {
+			fail("baseUrl", "is required")
+		}
+	} else {
+		validateURL(fail, "baseUrl", config.BaseURL)
+	}
+	if fileDrop && len(config.Endpoints) > 0 {
+		fail("endpoints", "are not supported with transport type file")
+	}
+	for i, endpoint := range config.Endpoints {
+		validateURL(fail, fmt.Sprintf("endpoints[%d].url", i), endpoint.URL)
+	}
+
+	method := strings.ToUpper(config.Method)
+	switch method {
+	case "", "GET", "POST":
+	default:
+		fail("method", "must be GET or POST, got %q", config.Method)
+	}
+
+	params := config.Parameters
+	switch params.ParamFormat {
+	case "", "ampersand", "semicolon":
+	case "json", "multipart", "raw-der":
+		if method == "GET" {
+			fail("parameters.paramFormat", "%s requires method POST", params.ParamFormat)
+		}
+	default:
+		fail("parameters.paramFormat", "must be ampersand, semicolon, json, multipart or raw-der, got %q", params.ParamFormat)
+	}
+	switch {
+	case params.ParamFormat == "multipart" && params.GetCSRParam == "":
+		fail("parameters.getCSRParam", "is required with paramFormat multipart, it names the file field of the CSR")
+	case params.ParamFormat == "raw-der" && params.GetCSRParam != "":
+		fail("parameters.getCSRParam", "must not be set with paramFormat raw-der, which sends the CSR as the body")
+	}
+	switch params.CSRFormat {
+	case "":
+	case "pem", "der":
+		if params.ParamFormat != "multipart" {
+			fail("parameters.csrFormat", "is only used with paramFormat multipart")
+		}
+	default:
+		fail("parameters.csrFormat", "must be pem or der, got %q", params.CSRFormat)
+	}
+	switch params.SubjectDNFormat {
+	case "", "comma", "slash":
+	default:
+		fail("parameters.subjectDNFormat", "must be comma or slash, got %q", params.SubjectDNFormat)
+	}
+	for i, name := range params.SubjectRDNOrder {
+		if !signer.ValidRDNType(name) {
+			fail("parameters.subjectRDNOrder", "unknown attribute type %q, must be a short name such as CN or a dotted OID", name)
+		}
+		if slices.ContainsFunc(params.SubjectRDNOrder[:i], func(seen string) bool { return strings.EqualFold(seen, name) }) {
+			fail("parameters.subjectRDNOrder", "attribute type %q is listed twice", name)
+		}
+	}
+	switch params.SubjectCharset {
+	case "", SubjectCharsetUTF8, SubjectCharsetASCII, SubjectCharsetPrintable:
+	default:
+		fail("parameters.subjectCharset", "must be utf8, ascii or printable, got %q", params.SubjectCharset)
+	}
+	if params.DNSStartIndex < 0 {
+		fail("parameters.dnsStartIndex", "must not be negative")
+	}
+	if params.DNSMaxCount < 0 {
+		fail("parameters.dnsMaxCount", "must not be negative")
+	}
+	if params.NewCertValue != "" && params.NewCertParam == "" {
+		fail("parameters.newCertParam", "is required when newCertValue is set")
+	}
+	if params.RenewCertValue != "" && params.RenewCertParam == "" {
+		fail("parameters.renewCertParam", "is required when renewCertValue is set")
+	}
+	// PEM line breaks are only escaped in URL-encoded queries
+	if params.GetCSRParam != "" && method == "GET" && params.ParamFormat == "semicolon" {
+		fail("parameters.getCSRParam", "cannot be sent in a semicolon-separated GET query")
+	}
+	if params.CAValue != "" && params.CAParam == "" {
+		fail("parameters.caParam", "is required when caValue is set")
+	}
+	for _, field := range slices.Sorted(maps.Keys(params.OriginParams)) {
+		if name := params.OriginParams[field]; field == "" || name == "" {
+			fail("parameters.originParams", "fields and parameter names must not be empty, got %q: %q", field, name)
+		}
+	}
+	for _, field := range slices.Sorted(maps.Keys(params.RequesterParams)) {
+		if !signer.ValidRequesterField(field) {
+			fail("parameters.requesterParams", "unknown requester field %q, must be username, uid, groups or extra.<key>", field)
+		} else if params.RequesterParams[field] == "" {
+			fail("parameters.requesterParams", "parameter name of field %q must not be empty", field)
+		}
+	}
+	for _, field := range slices.Sorted(maps.Keys(params.RequesterHeaders)) {
+		if !signer.ValidRequesterField(field) {
+			fail("parameters.requesterHeaders", "unknown requester field %q, must be username, uid, groups or extra.<key>", field)
+		} else if header := params.RequesterHeaders[field]; !httpguts.ValidHeaderFieldName(header) {
+			fail("parameters.requesterHeaders", "invalid header name %q for field %q", header, field)
+		} else if reservedHeader(header) {
+			fail("parameters.requesterHeaders", "header %q of field %q is set by the signer", header, field)
+		}
+	}
+	if _, ok := params.ExtraParams[""]; ok {
+		fail("parameters.extraParams", "parameter names must not be empty")
+	}
+
+	switch config.Response.Format {
+	case "", "pem", "base64", "pkcs7":
+	case "json":
+		if config.Response.CertificateField == "" {
+			fail("response.certificateField", "is required when format is json")
+		}
+	default:
+		fail("response.format", "must be pem, json, base64 or pkcs7, got %q", config.Response.Format)
+	}
+	switch config.Response.CertificateEncoding {
+	case "", "pem":
+	case "base64-der":
+		if config.Response.Format != "json" {
+			fail("response.certificateEncoding", "is only used with format json")
+		}
+	default:
+		fail("response.certificateEncoding", "must be pem or base64-der, got %q", config.Response.CertificateEncoding)
+	}
+
+	if config.Response.MaxChainCertificates < 0 {
+		fail("response.maxChainCertificates", "must not be negative")
+	}
+	if config.Response.MaxChainBytes < 0 {
+		fail("response.maxChainBytes", "must not be negative")
+	}
+	if config.Response.MaxBackdateSeconds < 0 {
+		fail("response.maxBackdateSeconds", "must not be negative")
+	}
+	if config.Response.MaxResponseBytes < 0 {
+		fail("response.maxResponseBytes", "must not be negative")
+	}
+	for _, contentType := range config.Response.ContentTypes {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil || !strings.Contains(contentType, "/") {
+			fail("response.contentTypes", "invalid media type %q", contentType)
+		}
+	}
+	var pendingCodes []int
+	if config.Async != nil {
+		pendingCodes = config.Async.PendingStatusCodes
+		if len(pendingCodes) == 0 {
+			pendingCodes = []int{http.StatusAccepted}
+		}
+	}
+	for _, code := range config.Response.SuccessStatusCodes {
+		if code < 200 || code > 299 {
+			fail("response.successStatusCodes", "invalid success status code %d", code)
+		}
+		if slices.Contains(pendingCodes, code) {
+			fail("response.successStatusCodes", "status code %d is also a pending status code", code)
+		}
+	}
+	if config.Response.StatusField != "" && len(config.Response.SuccessValues) == 0 {
+		fail("response.successValues", "is required when statusField is set")
+	}
+	if config.Response.StatusField == "" && len(config.Response.SuccessValues) > 0 {
+		fail("response.statusField", "is required when successValues is set")
+	}
+	if config.Response.ErrorCodeField == "" && len(config.Response.ErrorCodes) > 0 {
+		fail("response.errorCodeField", "is required when errorCodes is set")
+	}
+	for _, code := range slices.Sorted(maps.Keys(config.Response.ErrorCodes)) {
+		switch retry := config.Response.ErrorCodes[code]; retry {
+		case RetryClassRetry, RetryClassPending, RetryClassFail:
+		default:
+			fail("response.errorCodes", "must map to retry, pending or fail, got %q: %q", code, retry)
+		}
+	}
+
+	if t := config.Transport; t != nil {
+		switch t.Type {
+		case "", "http":
+		case "amqp":
+			if t.AMQP == nil {
+				fail("transport.amqp", "is required for transport type amqp")
+			} else {
+				if u, err := url.Parse(t.AMQP.URL); t.AMQP.URL == "" || err != nil || (u.Scheme != "amqp" && u.Scheme != "amqps") {
+					fail("transport.amqp.url", "must be an amqp:// or amqps:// URL")
+				}
+				if t.AMQP.RoutingKey == "" {
+					fail("transport.amqp.routingKey", "is required")
+				}
+			}
+		case "kafka":
+			if t.Kafka == nil {
+				fail("transport.kafka", "is required for transport type kafka")
+			} else {
+				if len(t.Kafka.Brokers) == 0 {
+					fail("transport.kafka.brokers", "is required")
+				}
+				if t.Kafka.RequestTopic == "" {
+					fail("transport.kafka.requestTopic", "is required")
+				}
+				if t.Kafka.ResponseTopic == "" {
+					fail("transport.kafka.responseTopic", "is required")
+				}
+			}
+		case "file":
+			if t.File == nil {
+				fail("transport.file", "is required for transport type file")
+			} else {
+				if t.File.RequestDir == "" {
+					fail("transport.file.requestDir", "is required")
+				}
+				if t.File.ResponseDir == "" {
+					fail("transport.file.responseDir", "is required")
+				}
+			}
+		default:
+			fail("transport.type", "must be http, amqp, kafka or file, got %q", t.Type)
+		}
+	}
+
+	if config.Auth != nil {
+		switch config.Auth.Type {
+		case "", "none", "bearer", "basic":
+		case "header":
+			if config.Auth.HeaderName == "" {
+				fail("auth.headerName", "is required for auth type header")
+			}
+		case "kubernetes":
+			if config.Auth.Audience == "" && config.Auth.TokenPath == "" {
+				fail("auth.audience", "is required for auth type kubernetes unless tokenPath is set")
+			}
+			// The TokenRequest API rejects lifetimes shorter than 10 minutes
+			if config.Auth.ExpirationSeconds != 0 && config.Auth.ExpirationSeconds < 600 {
+				fail("auth.expirationSeconds", "must be at least 600, got %d", config.Auth.ExpirationSeconds)
+			}
+		default:
+			fail("auth.type", "must be bearer, basic, header, kubernetes or none, got %q", config.Auth.Type)
+		}
+		if refresh := config.Auth.Refresh; refresh != nil {
+			if config.Auth.Type != "bearer" && config.Auth.Type != "header" {
+				fail("auth.refresh", "is only supported for auth types bearer and header")
+			}
+			if u, err := url.Parse(refresh.TokenURL); refresh.TokenURL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				fail("auth.refresh.tokenURL", "must be an http or https URL, got %q", refresh.TokenURL)
+			}
+			switch refresh.GrantType {
+			case "", "refresh_token", "client_credentials":
+			default:
+				fail("auth.refresh.grantType", "must be refresh_token or client_credentials, got %q", refresh.GrantType)
+			}
+		}
+	}
+
+	if config.Proxy != "" {
+		if err := signer.ValidateProxyURL(config.Proxy); err != nil {
+			fail("proxy", "%v", err)
+		}
+	}
+
+	if async := config.Async; async != nil {
+		if async.PollURL == "" {
+			if !fileDrop && async.ObjectStorage == nil && !async.Manual {
+				fail("async.pollUrl", "is required unless objectStorage or manual is set")
+			}
+		} else if u, err := url.Parse(strings.ReplaceAll(async.PollURL, "{id}", "id")); err != nil {
+			fail("async.pollUrl", "invalid URL: %v", err)
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			fail("async.pollUrl", "must use http or https, got %q", u.Scheme)
+		}
+		if async.OrderIDPattern != "" {
+			if pattern, err := regexp.Compile(async.OrderIDPattern); err != nil {
+				fail("async.orderIdPattern", "invalid regular expression: %v", err)
+			} else if pattern.NumSubexp() == 0 {
+				fail("async.orderIdPattern", "must capture the order ID in a group")
+			}
+		}
+		for _, code := range async.PendingStatusCodes {
+			if code == http.StatusOK || code < 100 || code > 599 {
+				fail("async.pendingStatusCodes", "invalid pending status code %d", code)
+			}
+		}
+		if async.PollIntervalSeconds < 0 {
+			fail("async.pollIntervalSeconds", "must not be negative")
+		}
+		if async.MaxPollIntervalSeconds < 0 {
+			fail("async.maxPollIntervalSeconds", "must not be negative")
+		}
+		if async.TimeoutSeconds < 0 {
+			fail("async.timeoutSeconds", "must not be negative")
+		}
+		if storage := async.ObjectStorage; storage != nil {
+			switch storage.Provider {
+			case "s3", "gcs":
+			default:
+				fail("async.objectStorage.provider", "must be s3 or gcs, got %q", storage.Provider)
+			}
+			if storage.Bucket == "" {
+				fail("async.objectStorage.bucket", "is required")
+			}
+			if !strings.Contains(storage.KeyPattern, "{id}") {
+				fail("async.objectStorage.keyPattern", "must contain {id}")
+			}
+			if storage.ChecksumKeyPattern != "" && !strings.Contains(storage.ChecksumKeyPattern, "{id}") {
+				fail("async.objectStorage.checksumKeyPattern", "must contain {id}")
+			}
+			if storage.Endpoint != "" {
+				if u, err := url.Parse(storage.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					fail("async.objectStorage.endpoint", "must be an http or https URL")
+				}
+			}
+			if fileDrop {
+				fail("async.objectStorage", "cannot be combined with transport type file")
+			}
+		}
+	}
+
+	if revocation := config.Revocation; revocation != nil {
+		if revocation.URL == "" {
+			fail("revocation.url", "is required")
+		} else if u, err := url.Parse(strings.ReplaceAll(revocation.URL, "{serial}", "serial")); err != nil {
+			fail("revocation.url", "invalid URL: %v", err)
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			fail("revocation.url", "must use http or https, got %q", u.Scheme)
+		}
+		switch strings.ToUpper(revocation.Method) {
+		case "", "POST", "PUT", "DELETE":
+		default:
+			fail("revocation.method", "must be POST, PUT or DELETE, got %q", revocation.Method)
+		}
+		switch revocation.SerialFormat {
+		case "", "hex", "decimal":
+		default:
+			fail("revocation.serialFormat", "must be hex or decimal, got %q", revocation.SerialFormat)
+		}
+		switch revocation.ReasonFormat {
+		case "", "name", "code":
+		default:
+			fail("revocation.reasonFormat", "must be name or code, got %q", revocation.ReasonFormat)
+		}
+		if revocation.UnholdURL != "" {
+			if u, err := url.Parse(strings.ReplaceAll(revocation.UnholdURL, "{serial}", "serial")); err != nil {
+				fail("revocation.unholdUrl", "invalid URL: %v", err)
+			} else if u.Scheme != "http" && u.Scheme != "https" {
+				fail("revocation.unholdUrl", "must use http or https, got %q", u.Scheme)
+			}
+		}
+		switch strings.ToUpper(revocation.UnholdMethod) {
+		case "", "POST", "PUT", "DELETE":
+		default:
+			fail("revocation.unholdMethod", "must be POST, PUT or DELETE, got %q", revocation.UnholdMethod)
+		}
+		switch revocation.ParamFormat {
+		case "", "ampersand", "semicolon", "json", "multipart":
+		default:
+			fail("revocation.paramFormat", "must be ampersand, semicolon, json or multipart, got %q", revocation.ParamFormat)
+		}
+		if fileDrop {
+			fail("revocation", "cannot be combined with transport type file")
+		}
+	}
+
+	for i, mapping := range config.ErrorMappings {
+		field := fmt.Sprintf("errorMappings[%d]", i)
+		for _, code := range mapping.StatusCodes {
+			// Success status codes only carry errors in the status field
+			if code < 100 || code > 599 || (code == http.StatusOK && config.Response.StatusField == "") {
+				fail(field+".statusCodes", "invalid error status code %d", code)
+			}
+		}
+		if mapping.Pattern != "" {
+			if _, err := regexp.Compile(mapping.Pattern); err != nil {
+				fail(field+".pattern", "invalid regular expression: %v", err)
+			}
+		}
+		switch mapping.Retry {
+		case "", RetryClassRetry, RetryClassPending:
+		case RetryClassFail:
+			if mapping.RetryAfterSeconds != 0 {
+				fail(field+".retryAfterSeconds", "cannot be set for retry class fail")
+			}
+			if mapping.Reason != "" && mapping.Reason != "Failed" {
+				fail(field+".reason", "cannot be set for retry class fail, which always uses Failed")
+			}
+		default:
+			fail(field+".retry", "must be retry, pending or fail, got %q", mapping.Retry)
+		}
+		if mapping.RetryAfterSeconds < 0 {
+			fail(field+".retryAfterSeconds", "must not be negative")
+		}
+		// cert-manager treats Failed requests as terminal
+		if mapping.Reason == "Failed" && mapping.Retry != RetryClassFail {
+			fail(field+".reason", "Failed is only used with retry class fail")
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateURL checks that rawURL is an http(s) URL of the PKI API
+func validateURL(fail func(field, format string, args ...interface{}), field, rawURL string) {
+	if rawURL == "" {
+		fail(field, "is required")
+	} else if u, err := url.Parse(rawURL); err != nil {
+		fail(field, "invalid URL: %v", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		fail(field, "must use http or https, got %q", u.Scheme)
+	} else if u.Host == "" {
+		fail(field, "missing host")
+	}
+}
+
+// reservedHeader reports whether the signer sets a header itself, so a
+// requester field must not be sent in it
+func reservedHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Authorization", "Content-Type", "Content-Length", "Host":
+		return true
+	}
+	return false
+}
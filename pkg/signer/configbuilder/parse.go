@@ -0,0 +1,177 @@
+package configbuilder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Parse decodes a PKIConfig from JSON and validates it. Unlike json.Unmarshal
+// it rejects unknown fields, so a typo such as "pramFormat" fails instead of
+// silently leaving the setting at its default. All problems are reported
+// together, each prefixed with its JSON field path.
+func Parse(data []byte) (*PKIConfig, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, syntaxError(data, err)
+	}
+	if _, ok := raw.(map[string]interface{}); !ok {
+		return nil, errors.New("configuration must be a JSON object")
+	}
+	if problems := unknownFields(raw, reflect.TypeOf(PKIConfig{}), ""); len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+
+	var config PKIConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return nil, fmt.Errorf("%s: must be %s, got %s", typeErr.Field, typeName(typeErr.Type), typeErr.Value)
+		}
+		return nil, err
+	}
+	if err := Validate(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// syntaxError adds the line and column of a JSON syntax error
+func syntaxError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err
+	}
+	before := data[:min(int(syntaxErr.Offset), len(data))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Errorf("invalid JSON at line %d, column %d: %w", line, column, err)
+}
+
+// unknownFields returns a problem for every field of a decoded JSON value
+// that t has no field for, matching names the way encoding/json does
+func unknownFields(value interface{}, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var problems []string
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields := jsonFields(t)
+		names := slices.Sorted(maps.Keys(fields))
+		for _, key := range slices.Sorted(maps.Keys(object)) {
+			field, ok := fields[key]
+			if !ok {
+				i := slices.IndexFunc(names, func(name string) bool { return strings.EqualFold(name, key) })
+				if i < 0 {
+					problems = append(problems, unknownField(joinPath(path, key), key, names))
+					continue
+				}
+				field = fields[names[i]]
+			}
+			problems = append(problems, unknownFields(object[key], field.Type, joinPath(path, key))...)
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for _, key := range slices.Sorted(maps.Keys(object)) {
+			problems = append(problems, unknownFields(object[key], t.Elem(), joinPath(path, key))...)
+		}
+	case reflect.Slice:
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range list {
+			problems = append(problems, unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return problems
+}
+
+// jsonFields returns the fields of a struct by their JSON names
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// unknownField describes an unknown field, suggesting a known one of a
+// similar name
+func unknownField(path, key string, known []string) string {
+	for _, name := range known {
+		if editDistance(strings.ToLower(key), strings.ToLower(name)) <= 2 {
+			return fmt.Sprintf("%s: unknown field, did you mean %q?", path, name)
+		}
+	}
+	return path + ": unknown field"
+}
+
+// editDistance returns the Levenshtein distance of two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// joinPath appends a field name to a JSON field path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// typeName describes a Go type in JSON terms
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	default:
+		return "an object"
+	}
+}
@@ -0,0 +1,58 @@
+package configbuilder
+
+import "github.com/bvorland/cert-manager-external-issuer/internal/signer"
+
+// The configuration types belong to the controller's signer, which other
+// modules can't import; they are re-exported here so configurations can be
+// built and inspected outside this module.
+type (
+	// PKIConfig is the configuration of a PKI API
+	PKIConfig = signer.PKIConfig
+	// PKIEndpoint is a further URL of the PKI API to fail over to
+	PKIEndpoint = signer.PKIEndpoint
+	// PKIParameters configures how signing requests are built
+	PKIParameters = signer.PKIParameters
+	// PKIResponse configures how responses are parsed
+	PKIResponse = signer.PKIResponse
+	// PKIAuth configures authentication to the PKI API
+	PKIAuth = signer.PKIAuth
+	// PKIAuthRefresh configures refreshing OAuth access tokens
+	PKIAuthRefresh = signer.PKIAuthRefresh
+	// PKITLS configures TLS to the PKI API
+	PKITLS = signer.PKITLS
+	// PKIAsync configures asynchronous issuance
+	PKIAsync = signer.PKIAsync
+	// PKIObjectStorage configures collecting certificates from a bucket
+	PKIObjectStorage = signer.PKIObjectStorage
+	// PKITransport configures sending requests other than over HTTP
+	PKITransport = signer.PKITransport
+	// AMQPTransport configures requests over AMQP
+	AMQPTransport = signer.AMQPTransport
+	// KafkaTransport configures requests over Kafka
+	KafkaTransport = signer.KafkaTransport
+	// FileTransport configures requests exchanged as files
+	FileTransport = signer.FileTransport
+	// PKIRevocation configures revoking certificates
+	PKIRevocation = signer.PKIRevocation
+	// PKIErrorMapping maps error responses to condition reasons and retries
+	PKIErrorMapping = signer.PKIErrorMapping
+)
+
+// Retry classes of error mappings
+const (
+	RetryClassRetry   = signer.RetryClassRetry
+	RetryClassPending = signer.RetryClassPending
+	RetryClassFail    = signer.RetryClassFail
+)
+
+// Subject character sets
+const (
+	SubjectCharsetUTF8      = signer.SubjectCharsetUTF8
+	SubjectCharsetASCII     = signer.SubjectCharsetASCII
+	SubjectCharsetPrintable = signer.SubjectCharsetPrintable
+)
+
+// PresetNames returns the names of the vendor presets FromPreset accepts
+func PresetNames() []string {
+	return signer.PresetNames()
+}